@@ -16,15 +16,63 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/k0sproject/k0s/pkg/airgap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/k0sproject/k0s/pkg/airgap"
+	helmv1beta1 "github.com/k0sproject/k0s/pkg/apis/helm.k0sproject.io/v1beta1"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/helm"
+)
+
+var (
+	airgapHelm     bool
+	verifyArch     string
+	verifyOS       string
+	verifyOutput   string
+	bundleOutput   string
+	bundlePlatform string
+	bundleSplit    bool
+	airgapAuthFile string
+	pullOutput     string
 )
 
 func init() {
+	listImagesCmd.Flags().BoolVar(&airgapHelm, "helm", true, "List the images of the Helm extensions, the charts are downloaded and rendered locally")
 	airgapCmd.AddCommand(listImagesCmd)
 	addPersistentFlags(listImagesCmd)
+
+	verifyCmd.Flags().StringVar(&verifyArch, "arch", runtime.GOARCH, "The architecture of the nodes importing the bundles")
+	verifyCmd.Flags().StringVar(&verifyOS, "os", "linux", "The operating system of the nodes importing the bundles")
+	verifyCmd.Flags().StringVarP(&verifyOutput, "output", "o", "text", "Output format, text or json")
+	airgapCmd.AddCommand(verifyCmd)
+	addPersistentFlags(verifyCmd)
+
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "bundle.tar", "The bundle file, with --split the platform is added to the name of each bundle")
+	bundleCmd.Flags().StringVar(&bundlePlatform, "platform", "linux/"+runtime.GOARCH, "Comma separated list of the platforms to bundle the images for, e.g. linux/amd64,linux/arm64,windows/amd64")
+	bundleCmd.Flags().BoolVar(&bundleSplit, "split", false, "Write a bundle per platform instead of a single multi-platform bundle")
+	bundleCmd.Flags().BoolVar(&airgapHelm, "helm", true, "Bundle the images of the Helm extensions, the charts are downloaded and rendered locally")
+	airgapCmd.AddCommand(bundleCmd)
+	addPersistentFlags(bundleCmd)
+
+	pushCmd.Flags().StringVar(&airgapAuthFile, "auth-file", "", "docker config.json with the credentials of the registry")
+	airgapCmd.AddCommand(pushCmd)
+
+	pullCmd.Flags().StringVar(&airgapAuthFile, "auth-file", "", "docker config.json with the credentials of the registry")
+	pullCmd.Flags().StringVarP(&pullOutput, "output", "o", "bundle.tar", "The bundle file")
+	airgapCmd.AddCommand(pullCmd)
 }
 
 var (
@@ -35,9 +83,13 @@ var (
 	}
 
 	listImagesCmd = &cobra.Command{
-		Use:     "list-images",
-		Short:   "List image names and version needed for air-gap install",
-		Example: `k0s airgap list-images`,
+		Use:   "list-images",
+		Short: "List image names and version needed for air-gap install",
+		Long: `Lists the images of the k0s components, the images of the containers of the Helm extension charts and the
+extra images of spec.images.extra. The charts are rendered with their values like helm template does, the images
+pulled by the workloads at runtime, e.g. by operators, are not known until they run.`,
+		Example: `k0s airgap list-images
+k0s airgap list-images --helm=false`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// we don't need warning messages in case of default config
 			logrus.SetLevel(logrus.ErrorLevel)
@@ -45,11 +97,361 @@ var (
 			if err != nil {
 				return err
 			}
-			uris := airgap.GetImageURIs(cfg.Spec.Images)
+			uris, err := airgapImages(cfg)
+			if err != nil {
+				return err
+			}
 			for _, uri := range uris {
 				fmt.Println(uri)
 			}
 			return nil
 		},
 	}
+
+	bundleCmd = &cobra.Command{
+		Use:   "bundle [image...]",
+		Short: "Pull the images needed for air-gap install into a bundle",
+		Long: `Pulls the images listed by k0s airgap list-images, or the images given as arguments, for the platforms and
+writes them into an OCI image bundle. The multi-platform images keep their index in the bundle, so a single bundle can
+be imported on the workers of all the platforms. The images without a variant for some of the platforms are bundled for
+the others. With a Windows platform the pause image of the Windows workers is bundled too.`,
+		Example: `k0s airgap bundle --platform linux/amd64,linux/arm64 --output bundle.tar
+k0s airgap bundle --platform linux/amd64,windows/amd64 --split --output bundle.tar`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			platformList, err := airgap.ParsePlatforms(bundlePlatform)
+			if err != nil {
+				return err
+			}
+			uris := args
+			if len(uris) == 0 {
+				logrus.SetLevel(logrus.ErrorLevel)
+				cfg, err := ConfigFromYaml(cfgFile)
+				if err != nil {
+					return err
+				}
+				if uris, err = airgapImages(cfg); err != nil {
+					return err
+				}
+				logrus.SetLevel(logrus.InfoLevel)
+				for _, p := range platformList {
+					if p.OS == "windows" {
+						uris = uniqueStrings(append(uris, constant.KubePauseWindowsContainerImage))
+					}
+				}
+			}
+
+			cacheDir, err := ioutil.TempDir("", "k0s-airgap-bundle")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(cacheDir)
+			builder, err := airgap.NewBundleBuilder(cacheDir)
+			if err != nil {
+				return err
+			}
+
+			if !bundleSplit {
+				return writeBundle(context.Background(), builder, bundleOutput, uris, platformList)
+			}
+			for _, p := range platformList {
+				if err := writeBundle(context.Background(), builder, splitBundleName(bundleOutput, p), uris, []ocispec.Platform{p}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	pushCmd = &cobra.Command{
+		Use:   "push bundle reference",
+		Short: "Push an image bundle to a registry as an OCI artifact",
+		Long: `Pushes the image bundle to the registry as an OCI artifact, so that the workers can pull it with
+k0s worker --image-bundle instead of copying it to each of them. The registries on localhost are accessed over plain
+HTTP.`,
+		Example: `k0s airgap push bundle.tar registry.example.com/k0s/images:v0.11.0 --auth-file ~/.docker/config.json`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resolver, err := airgap.NewResolver(airgapAuthFile)
+			if err != nil {
+				return err
+			}
+			desc, err := airgap.PushBundle(context.Background(), resolver, args[1], args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s@%s\n", airgap.NormalizeReference(args[1]), desc.Digest)
+			return nil
+		},
+	}
+
+	pullCmd = &cobra.Command{
+		Use:     "pull reference",
+		Short:   "Pull an image bundle pushed with k0s airgap push",
+		Example: `k0s airgap pull registry.example.com/k0s/images:v0.11.0 --output /var/lib/k0s/images/bundle.tar`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			resolver, err := airgap.NewResolver(airgapAuthFile)
+			if err != nil {
+				return err
+			}
+			fetcher, layer, err := airgap.ResolveBundle(ctx, resolver, args[0])
+			if err != nil {
+				return err
+			}
+			f, err := ioutil.TempFile(filepath.Dir(pullOutput), filepath.Base(pullOutput)+".tmp")
+			if err != nil {
+				return err
+			}
+			defer os.Remove(f.Name())
+			if err := airgap.FetchBundle(ctx, fetcher, layer, f); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			return os.Rename(f.Name(), pullOutput)
+		},
+	}
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify [bundle...]",
+		Short: "Verify the image bundles before importing them",
+		Long: `Verifies that the image bundles have all the images listed by k0s airgap list-images for the platform,
+and that the layers and the manifests of the images are not corrupt. The bundles in the images directory of the data
+directory are verified by default. Exits with a non-zero status if any problems are found.`,
+		Example: `k0s airgap verify
+k0s airgap verify --arch arm64 bundle_file
+k0s airgap verify --os windows --arch amd64 bundle_file`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if verifyOutput != "text" && verifyOutput != "json" {
+				return fmt.Errorf("invalid output format %q, must be text or json", verifyOutput)
+			}
+			logrus.SetLevel(logrus.ErrorLevel)
+			cfg, err := ConfigFromYaml(cfgFile)
+			if err != nil {
+				return err
+			}
+			bundles := args
+			if len(bundles) == 0 {
+				files, err := ioutil.ReadDir(k0sVars.OCIBundleDir)
+				if err != nil {
+					return fmt.Errorf("can't read the bundles: %v", err)
+				}
+				for _, file := range files {
+					if !file.IsDir() {
+						bundles = append(bundles, filepath.Join(k0sVars.OCIBundleDir, file.Name()))
+					}
+				}
+			}
+			if len(bundles) == 0 {
+				return fmt.Errorf("no bundles found in %s", k0sVars.OCIBundleDir)
+			}
+
+			expected := airgapImageURIs(cfg)
+			if verifyOS == "windows" {
+				// the k0s components run on the Linux nodes only
+				expected = append([]string{constant.KubePauseWindowsContainerImage}, cfg.Spec.Images.Extra...)
+			}
+			results, err := verifyBundles(bundles, expected, verifyOS, verifyArch)
+			if err != nil {
+				return err
+			}
+			failed := false
+			for _, result := range results {
+				failed = failed || result.Status != "ok"
+			}
+			if verifyOutput == "json" {
+				out, err := json.MarshalIndent(results, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			} else {
+				for _, result := range results {
+					name := result.Image
+					if name == "" {
+						name = result.Bundle
+					}
+					fmt.Printf("%-8s %s\n", result.Status, name)
+					for _, problem := range result.Problems {
+						fmt.Printf("         %s\n", problem)
+					}
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
 )
+
+// airgapImageURIs lists the images of the cluster config needed for an airgap install
+func airgapImageURIs(cfg *v1beta1.ClusterConfig) []string {
+	uris := airgap.GetImageURIs(cfg.Spec.Images)
+	if ccm := cfg.Spec.CloudControllerManager(); ccm != nil {
+		uris = append(uris, ccm.Image)
+	}
+	if nvidia := cfg.Spec.Nvidia(); nvidia != nil && nvidia.GPUOperator == nil {
+		uris = append(uris, cfg.Spec.NvidiaDevicePluginImage())
+	}
+	if cfg.Spec.LocalPath() != nil {
+		uris = append(uris, cfg.Spec.LocalPathProvisionerImage(), cfg.Spec.LocalPathHelperImage())
+	}
+	if cfg.Spec.Snapshotter() != nil {
+		uris = append(uris, cfg.Spec.SnapshotControllerImage())
+	}
+	return append(uris, cfg.Spec.Images.Extra...)
+}
+
+// airgapImages lists the images of the config and, unless disabled with --helm=false, of the Helm extensions
+func airgapImages(cfg *v1beta1.ClusterConfig) ([]string, error) {
+	uris := airgapImageURIs(cfg)
+	if airgapHelm {
+		helmURIs, err := helmExtensionImages(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%v, use --helm=false to skip the images of the Helm extensions", err)
+		}
+		uris = append(uris, helmURIs...)
+	}
+	return uniqueStrings(uris), nil
+}
+
+// writeBundle writes the bundle into a temporary file first, so that a failed pull leaves no partial bundle behind
+func writeBundle(ctx context.Context, builder *airgap.BundleBuilder, path string, uris []string, platformList []ocispec.Platform) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := builder.Write(ctx, f, uris, platformList); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	logrus.Infof("wrote %d images to %s", len(uris), path)
+	return nil
+}
+
+// splitBundleName adds the platform to the bundle name, e.g. bundle-linux-arm64.tar for bundle.tar
+func splitBundleName(path string, p ocispec.Platform) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), strings.ReplaceAll(platforms.Format(p), "/", "-"), ext)
+}
+
+// helmExtensionImages renders the charts of the Helm extensions and lists the images of their containers. The
+// repositories are added to a temporary helm home, so that listing the images needs no access to the data directory.
+func helmExtensionImages(cfg *v1beta1.ClusterConfig) ([]string, error) {
+	extensions := cfg.Spec.HelmExtensions()
+	if extensions == nil || len(extensions.Charts) == 0 {
+		return nil, nil
+	}
+	helmHome, err := ioutil.TempDir("", "k0s-airgap-helm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(helmHome)
+	vars := k0sVars
+	vars.HelmRepositoryConfig = filepath.Join(helmHome, "repositories.yaml")
+	vars.HelmRepositoryCache = filepath.Join(helmHome, "cache")
+	commands := helm.NewCommands(vars)
+
+	for _, repo := range extensions.Repositories {
+		if err := commands.AddRepository(repo); err != nil {
+			return nil, err
+		}
+	}
+	var uris []string
+	for _, chart := range extensions.Charts {
+		values := helmv1beta1.ChartSpec{Values: chart.Values}.YamlValues()
+		manifests, err := commands.TemplateChart(chart.ChartName, chart.Version, chart.TargetNS, values)
+		if err != nil {
+			return nil, err
+		}
+		images, err := airgap.ImagesFromManifests(manifests)
+		if err != nil {
+			return nil, fmt.Errorf("can't list the images of chart `%s`: %v", chart.Name, err)
+		}
+		uris = append(uris, images...)
+	}
+	return uris, nil
+}
+
+// uniqueStrings removes the duplicates, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// bundleVerifyResult is the result of verifying an image against the bundles
+type bundleVerifyResult struct {
+	Image    string   `json:"image"`
+	Status   string   `json:"status"`
+	Bundle   string   `json:"bundle,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// verifyBundles reads the bundles and looks up the expected images from them. The images are missing if they aren't
+// in any of the bundles, and invalid if they are for another architecture or have missing or corrupt parts.
+func verifyBundles(paths []string, expected []string, platformOS, arch string) ([]bundleVerifyResult, error) {
+	bundles := make(map[string]*airgap.Bundle, len(paths))
+	var results []bundleVerifyResult
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		bundle, err := airgap.ReadBundle(f, platformOS, arch)
+		f.Close()
+		if err != nil {
+			results = append(results, bundleVerifyResult{Bundle: path, Status: "corrupt", Problems: []string{err.Error()}})
+			continue
+		}
+		if len(bundle.Problems) > 0 {
+			results = append(results, bundleVerifyResult{Bundle: path, Status: "invalid", Problems: bundle.Problems})
+		}
+		bundles[path] = bundle
+	}
+
+	for _, uri := range expected {
+		result := bundleVerifyResult{Image: uri, Status: "missing"}
+		for _, path := range paths {
+			bundle, ok := bundles[path]
+			if !ok {
+				continue
+			}
+			image := bundle.Find(uri)
+			if image == nil {
+				continue
+			}
+			problems := append([]string(nil), image.Problems...)
+			if image.Architecture != "" && image.Architecture != arch {
+				problems = append(problems, fmt.Sprintf("architecture is %s, expected %s", image.Architecture, arch))
+			}
+			// a valid copy in another bundle is good enough
+			if len(problems) == 0 {
+				result = bundleVerifyResult{Image: uri, Status: "ok", Bundle: path}
+				break
+			}
+			if result.Status == "missing" {
+				result = bundleVerifyResult{Image: uri, Status: "invalid", Bundle: path, Problems: problems}
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -17,38 +17,57 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/k0sproject/k0s/internal/ratelimit"
 	"github.com/k0sproject/k0s/internal/util"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s "k8s.io/client-go/kubernetes"
 
 	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/certificate"
 	"github.com/k0sproject/k0s/pkg/etcd"
+	"github.com/k0sproject/k0s/pkg/fips"
 	"github.com/k0sproject/k0s/pkg/kubernetes"
+	"github.com/k0sproject/k0s/pkg/token"
 )
 
 func init() {
+	addFIPSFlag(APICmd)
 	addPersistentFlags(APICmd)
 }
 
 var (
 	kubeClient    k8s.Interface
 	clusterConfig *v1beta1.ClusterConfig
+	// caFingerprint identifies the current cluster CA, tokens issued for a previous CA are rejected
+	caFingerprint string
+	// joinLimiter limits the join token authenticated requests per source address, nil if not limited
+	joinLimiter *ratelimit.Limiter
+	// frontProxyCA issues the client certificate the kube-apiserver presents when proxying requests to the k0s API
+	frontProxyCA *x509.Certificate
 
 	APICmd = &cobra.Command{
 		Use:   "api",
@@ -65,25 +84,68 @@ func startAPI() error {
 	if err != nil {
 		return err
 	}
+	caCert, err := ioutil.ReadFile(filepath.Join(k0sVars.CertRootDir, "ca.crt"))
+	if err != nil {
+		return err
+	}
+	if caFingerprint, err = token.CAFingerprint(caCert); err != nil {
+		return err
+	}
 	// Single kube client for whole lifetime of the API
 	kubeClient, err = kubernetes.NewClient(k0sVars.AdminKubeConfigPath)
 	if err != nil {
 		return err
 	}
+	apiCACert, err := ioutil.ReadFile(filepath.Join(k0sVars.CertRootDir, "k0s-api-ca.crt"))
+	if err != nil {
+		return err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(apiCACert) {
+		return fmt.Errorf("failed to load k0s API client CA")
+	}
+	// the client certificates issued before the controller adopted the CA shared by the controllers stay valid
+	if previousCACert, err := ioutil.ReadFile(filepath.Join(k0sVars.CertRootDir, "k0s-api-ca-previous.crt")); err == nil {
+		clientCAs.AppendCertsFromPEM(previousCACert)
+	}
+	// the requests tunneled through the Kubernetes API service proxy are made with the front proxy client certificate
+	frontProxyCACert, err := ioutil.ReadFile(filepath.Join(k0sVars.CertRootDir, "front-proxy-ca.crt"))
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(frontProxyCACert)
+	if block == nil {
+		return fmt.Errorf("failed to load the front proxy CA")
+	}
+	if frontProxyCA, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return fmt.Errorf("failed to load the front proxy CA: %v", err)
+	}
+	clientCAs.AddCert(frontProxyCA)
 	prefix := "/v1beta1"
 	router := mux.NewRouter()
 
+	if perMinute, burst := clusterConfig.Spec.API.Join.Limits(); perMinute > 0 {
+		joinLimiter = ratelimit.New(perMinute, burst)
+	}
+	// the join token is only accepted for bootstrapping a client certificate, everything else requires the client certificate
+	// unless the request is tunneled through the Kubernetes API service proxy, see controllerHandler
+	joinHandler := clientCertHandler()
+	if joinLimiter != nil {
+		joinHandler = rateLimitMiddleware(joinHandler, joinLimiter)
+	}
+	router.Path(prefix + "/certificates/client").Methods("POST").Handler(joinHandler)
+
 	if clusterConfig.Spec.Storage.Type == v1beta1.EtcdStorageType {
 		// Only mount the etcd handler if we're running on etcd storage
 		// by default the mux will return 404 back which the caller should handle
 		router.Path(prefix + "/etcd/members").Methods("POST").Handler(
-			controllerHandler(etcdHandler()),
+			controllerHandler(etcdHandler(), true),
 		)
 	}
 
 	if clusterConfig.Spec.Storage.IsJoinable() {
 		router.Path(prefix + "/ca").Methods("GET").Handler(
-			controllerHandler(caHandler()),
+			controllerHandler(caHandler(), clusterConfig.Spec.Storage.Type != v1beta1.EtcdStorageType),
 		)
 
 	}
@@ -93,9 +155,20 @@ func startAPI() error {
 
 	srv := &http.Server{
 		Handler:      router,
-		Addr:         ":9443",
+		Addr:         fmt.Sprintf(":%d", clusterConfig.Spec.API.JoinAPIPort()),
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
+		TLSConfig: &tls.Config{
+			ClientCAs:  clientCAs,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		},
+	}
+
+	if fipsMode {
+		if err := fips.Check(); err != nil {
+			return err
+		}
+		fips.TLSConfig(srv.TLSConfig)
 	}
 
 	log.Fatal(srv.ListenAndServeTLS(
@@ -258,6 +331,19 @@ func caHandler() http.Handler {
 		}
 		caResp.SAPub = saPub
 
+		apiCAKey, err := ioutil.ReadFile(path.Join(k0sVars.CertRootDir, "k0s-api-ca.key"))
+		if err != nil {
+			sendError(err, resp)
+			return
+		}
+		caResp.APICAKey = apiCAKey
+		apiCACert, err := ioutil.ReadFile(path.Join(k0sVars.CertRootDir, "k0s-api-ca.crt"))
+		if err != nil {
+			sendError(err, resp)
+			return
+		}
+		caResp.APICACert = apiCACert
+
 		resp.Header().Set("content-type", "application/json")
 		if err := json.NewEncoder(resp).Encode(caResp); err != nil {
 			sendError(err, resp)
@@ -266,6 +352,171 @@ func caHandler() http.Handler {
 	})
 }
 
+// clientCertHandler issues a client certificate for the role of the join token
+func clientCertHandler() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		attempt := newJoinAttempt(req)
+		reject := func(err error, status int) {
+			attempt.failed(err, status)
+			sendError(err, resp, status)
+		}
+
+		role, joinToken := tokenRole(req)
+		if role == "" {
+			attempt.failed(fmt.Errorf("invalid join token"), http.StatusUnauthorized)
+			sendError(fmt.Errorf("Go away"), resp, http.StatusUnauthorized)
+			return
+		}
+		attempt.Role = role
+
+		var certReq v1beta1.ClientCertRequest
+		if err := json.NewDecoder(req.Body).Decode(&certReq); err != nil {
+			reject(err, http.StatusBadRequest)
+			return
+		}
+		if err := certReq.Validate(); err != nil {
+			reject(err, http.StatusBadRequest)
+			return
+		}
+		block, _ := pem.Decode(certReq.CSR)
+		if block == nil || block.Type != "CERTIFICATE REQUEST" {
+			reject(fmt.Errorf("csr must be a PEM encoded CERTIFICATE REQUEST"), http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			reject(err, http.StatusBadRequest)
+			return
+		}
+		if csr.Subject.CommonName == "" {
+			reject(fmt.Errorf("csr common name cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		attempt.Node = csr.Subject.CommonName
+		if err := joinToken.Constraints.Allows(remoteIP(req), csr.Subject.CommonName); err != nil {
+			reject(fmt.Errorf("join token %s rejected: %v", joinToken.ID, err), http.StatusForbidden)
+			return
+		}
+		// the use is counted before issuing the certificate, so concurrent joins can't exceed the limit of the token
+		if err := token.NewManagerForClient(kubeClient).RecordUse(joinToken.ID); err != nil {
+			if apierrors.IsNotFound(err) {
+				reject(fmt.Errorf("join token %s has been used up", joinToken.ID), http.StatusForbidden)
+				return
+			}
+			reject(err, http.StatusInternalServerError)
+			return
+		}
+
+		certManager := certificate.Manager{K0sVars: k0sVars}
+		if clusterConfig.Spec.Certificates != nil {
+			certManager.Lifetime = clusterConfig.Spec.Certificates.Lifetime
+		}
+		cert, err := certManager.SignClientCSR(certReq.CSR, csr.Subject.CommonName, clientCertOrgByRole[role],
+			filepath.Join(k0sVars.CertRootDir, "k0s-api-ca.crt"), filepath.Join(k0sVars.CertRootDir, "k0s-api-ca.key"))
+		if err != nil {
+			reject(err, http.StatusInternalServerError)
+			return
+		}
+		attempt.succeeded()
+
+		resp.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(resp).Encode(v1beta1.ClientCertResponse{Cert: cert}); err != nil {
+			sendError(err, resp)
+			return
+		}
+	})
+}
+
+// rateLimitMiddleware limits the requests per source IP, the join tokens can't be brute-forced then
+func rateLimitMiddleware(next http.Handler, limiter *ratelimit.Limiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := limiter.Allow(remoteIP(r).String())
+		if !allowed {
+			err := fmt.Errorf("too many join attempts, retry in %s", wait.Round(time.Second))
+			newJoinAttempt(r).failed(err, http.StatusTooManyRequests)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			sendError(err, w, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// joinAttempt is the audit record of a request to the join endpoint
+type joinAttempt struct {
+	SourceIP net.IP
+	TokenID  string
+	Role     string
+	Node     string
+}
+
+var tokenIDRegexp = regexp.MustCompile(`^[a-z0-9]{6}$`)
+
+func newJoinAttempt(r *http.Request) *joinAttempt {
+	a := &joinAttempt{SourceIP: remoteIP(r)}
+	// only the public part of the token is recorded
+	if id := strings.SplitN(requestToken(r), ".", 2)[0]; tokenIDRegexp.MatchString(id) {
+		a.TokenID = id
+	}
+	return a
+}
+
+func (a *joinAttempt) log() *logrus.Entry {
+	return logrus.WithFields(logrus.Fields{
+		"component": "join-audit",
+		"source_ip": a.SourceIP.String(),
+		"token_id":  a.TokenID,
+		"role":      a.Role,
+		"node":      a.Node,
+	})
+}
+
+func (a *joinAttempt) succeeded() {
+	a.log().WithField("result", "success").Info("join attempt")
+}
+
+// failed logs the failed attempt, the ones rejected for authentication or authorization are also recorded as
+// Events on the bootstrap token secret if enabled
+func (a *joinAttempt) failed(reason error, status int) {
+	a.log().WithField("result", "failure").WithField("reason", reason.Error()).Warn("join attempt")
+	if a.TokenID == "" || !clusterConfig.Spec.API.Join.EventsEnabled() {
+		return
+	}
+	if status != http.StatusUnauthorized && status != http.StatusForbidden {
+		return
+	}
+	go func() {
+		if err := a.recordEvent(reason); err != nil {
+			logrus.Warnf("failed to record join failure event: %s", err.Error())
+		}
+	}()
+}
+
+func (a *joinAttempt) recordEvent(reason error) error {
+	secretName := "bootstrap-token-" + a.TokenID
+	now := v1.Now()
+	_, err := kubeClient.CoreV1().Events("kube-system").Create(context.TODO(), &corev1.Event{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", secretName, now.UnixNano()),
+			Namespace: "kube-system",
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Namespace:  "kube-system",
+			Name:       secretName,
+		},
+		Reason:         "JoinFailed",
+		Message:        fmt.Sprintf("join attempt from %s rejected: %s", a.SourceIP, reason.Error()),
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: "k0s-api"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, v1.CreateOptions{})
+	return err
+}
+
 func sendError(err error, resp http.ResponseWriter, status ...int) {
 	code := http.StatusInternalServerError
 	if len(status) == 1 {
@@ -281,75 +532,187 @@ func sendError(err error, resp http.ResponseWriter, status ...int) {
 	}
 }
 
-func authMiddleware(next http.Handler, role string) http.Handler {
+// requestToken returns the join token of the request. The requests tunneled through the Kubernetes API service proxy
+// carry it in a header of its own as the kube-apiserver drops the Authorization header.
+func requestToken(r *http.Request) string {
+	if parts := strings.Split(r.Header.Get("Authorization"), "Bearer "); len(parts) == 2 {
+		return parts[1]
+	}
+	return r.Header.Get(v1beta1.JoinTokenHeader)
+}
+
+// tokenRole returns the role and the join token the request is authorized with, or an empty string if the token is not valid
+func tokenRole(r *http.Request) (string, token.Token) {
+	tokenString := requestToken(r)
+	if tokenString == "" {
+		return "", token.Token{}
+	}
+	for _, role := range []string{controllerRole, workerRole} {
+		if t, ok := validToken(tokenString, role); ok {
+			return role, t
+		}
+	}
+	return "", token.Token{}
+}
+
+// remoteIP returns the IP address the request was made from
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// clientCertMiddleware only lets through the requests made with a client certificate issued for the role
+func clientCertMiddleware(next http.Handler, role string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || proxiedByKubeAPI(r) {
 			sendError(fmt.Errorf("Go away"), w, http.StatusUnauthorized)
 			return
 		}
+		if !util.StringSliceContains(r.TLS.VerifiedChains[0][0].Subject.Organization, clientCertOrgByRole[role]) {
+			sendError(fmt.Errorf("Go away"), w, http.StatusForbidden)
+			return
+		}
 
-		parts := strings.Split(auth, "Bearer ")
-		if len(parts) == 2 {
-			token := parts[1]
-			if !isValidToken(token, role) {
-				sendError(fmt.Errorf("Go away"), w, http.StatusUnauthorized)
-				return
-			}
-		} else {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// controllerTokenMiddleware lets through the requests made with a valid controller join token
+func controllerTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if role, _ := tokenRole(r); role != controllerRole {
+			newJoinAttempt(r).failed(fmt.Errorf("invalid controller join token"), http.StatusUnauthorized)
 			sendError(fmt.Errorf("Go away"), w, http.StatusUnauthorized)
 			return
 		}
-
 		next.ServeHTTP(w, r)
 	})
 }
 
-func controllerHandler(next http.Handler) http.Handler {
-	return authMiddleware(next, controllerRole)
+// proxiedByKubeAPI tells if the request was made by the kube-apiserver, i.e. with the front proxy client certificate
+func proxiedByKubeAPI(r *http.Request) bool {
+	if frontProxyCA == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	chain := r.TLS.VerifiedChains[0]
+	return chain[0].Subject.CommonName == frontProxyClientName && chain[len(chain)-1].Equal(frontProxyCA)
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// recordUseMiddleware counts a use of the join token once the request succeeded. The controllers joining through the
+// Kubernetes API service proxy don't bootstrap a client certificate, which is where the use is counted otherwise, so
+// it's counted when they make the last call of the join.
+func recordUseMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status != http.StatusOK {
+			return
+		}
+		_, joinToken := tokenRole(r)
+		if err := token.NewManagerForClient(kubeClient).RecordUse(joinToken.ID); err != nil && !apierrors.IsNotFound(err) {
+			logrus.Errorf("failed to record the use of join token %s: %v", joinToken.ID, err)
+		}
+	})
+}
+
+// controllerHandler requires the controller client certificate. The controllers joining through the Kubernetes API
+// service proxy can't present it, the kube-apiserver terminates their TLS connection, so the requests proxied by the
+// kube-apiserver are authorized with the controller join token instead. A join token sent directly to the k0s API is
+// never accepted here. lastJoinCall tells if the handler serves the last call a joining controller makes, the proxied
+// requests to it count a use of the join token.
+func controllerHandler(next http.Handler, lastJoinCall bool) http.Handler {
+	certAuth := clientCertMiddleware(next, controllerRole)
+	tokenAuth := next
+	if lastJoinCall {
+		tokenAuth = recordUseMiddleware(tokenAuth)
+	}
+	tokenAuth = controllerTokenMiddleware(tokenAuth)
+	if joinLimiter != nil {
+		tokenAuth = rateLimitMiddleware(tokenAuth, joinLimiter)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if proxiedByKubeAPI(r) {
+			tokenAuth.ServeHTTP(w, r)
+			return
+		}
+		certAuth.ServeHTTP(w, r)
+	})
 }
 
 func workerHandler(next http.Handler) http.Handler {
-	return authMiddleware(next, workerRole)
+	return clientCertMiddleware(next, workerRole)
 }
 
 const workerRole = "worker"
 const controllerRole = "controller"
 
+// frontProxyClientName is the common name of the front proxy client certificate, the kube-apiserver
+// requestheader-allowed-names. The k0s API assumes only the kube-apiserver holds this certificate, passed to it
+// with --proxy-client-cert-file, so a request made with it has gone through the Kubernetes API authentication.
+const frontProxyClientName = "front-proxy-client"
+
+var clientCertOrgByRole = map[string]string{
+	workerRole:     "k0s:workers",
+	controllerRole: "k0s:controllers",
+}
+
 var allowedUsageByRole = map[string]string{
 	workerRole:     "usage-bootstrap-api-worker-calls",
 	controllerRole: "usage-controller-join",
 }
 
-/** The token is in form of xyz.foobar where:
+/*
+* The token is in form of xyz.foobar where:
 - xyz: the token "ID" in kube api
 - foobar: the token itself
 We need to validate:
 - that we find a secret with the ID
 - that the token matches whats inside the secret
+- that the token has not expired and was issued for the current CA
+The constraints of the token are left for the caller to verify.
 */
-func isValidToken(token string, role string) bool {
-	parts := strings.Split(token, ".")
+func validToken(tokenString string, role string) (token.Token, bool) {
+	parts := strings.Split(tokenString, ".")
 	logrus.Debugf("token parts: %v", parts)
 	if len(parts) != 2 {
-		return false
+		return token.Token{}, false
 	}
 
 	secretName := fmt.Sprintf("bootstrap-token-%s", parts[0])
 	secret, err := kubeClient.CoreV1().Secrets("kube-system").Get(context.TODO(), secretName, v1.GetOptions{})
 	if err != nil {
 		logrus.Errorf("failed to get bootstrap token: %s", err.Error())
-		return false
+		return token.Token{}, false
 	}
 
 	if string(secret.Data["token-secret"]) != parts[1] {
-		return false
+		return token.Token{}, false
 	}
 
 	usageValue, ok := secret.Data[allowedUsageByRole[role]]
 	if !ok || string(usageValue) != "true" {
-		return false
+		return token.Token{}, false
+	}
+
+	t := token.FromSecret(*secret)
+	if t.IsStale(caFingerprint, time.Now()) {
+		logrus.Infof("rejecting token %s, it has expired or was issued for a previous cluster CA", parts[0])
+		return token.Token{}, false
 	}
 
-	return true
+	return t, true
 }
@@ -0,0 +1,147 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/token"
+)
+
+// testCert issues a certificate for the given subject, self-signed if parent is nil
+func testCert(t *testing.T, subject pkix.Name, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestControllerHandler(t *testing.T) {
+	proxyCA, proxyCAKey := testCert(t, pkix.Name{CommonName: "front-proxy-ca"}, nil, nil)
+	apiCA, apiCAKey := testCert(t, pkix.Name{CommonName: "k0s-api-ca"}, nil, nil)
+	proxyClient, _ := testCert(t, pkix.Name{CommonName: frontProxyClientName}, proxyCA, proxyCAKey)
+	otherProxyClient, _ := testCert(t, pkix.Name{CommonName: "someone"}, proxyCA, proxyCAKey)
+	controllerCert, _ := testCert(t, pkix.Name{CommonName: "controller1", Organization: []string{"k0s:controllers"}}, apiCA, apiCAKey)
+	workerCert, _ := testCert(t, pkix.Name{CommonName: "worker1", Organization: []string{"k0s:workers"}}, apiCA, apiCAKey)
+
+	frontProxyCA = proxyCA
+	clusterConfig = &v1beta1.ClusterConfig{Spec: &v1beta1.ClusterSpec{API: &v1beta1.APISpec{}}}
+	defer func() {
+		frontProxyCA, clusterConfig, kubeClient = nil, nil, nil
+	}()
+
+	tokenSecret := func(id, usage string, maxUses string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{
+				Name:        "bootstrap-token-" + id,
+				Namespace:   "kube-system",
+				Annotations: map[string]string{token.MaxUsesAnnotation: maxUses},
+			},
+			Data: map[string][]byte{
+				"token-id":     []byte(id),
+				"token-secret": []byte("0123456789abcdef"),
+				usage:          []byte("true"),
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		chain        []*x509.Certificate
+		token        string
+		lastJoinCall bool
+		status       int
+		usedUp       bool
+	}{
+		{"proxied_controller_token", []*x509.Certificate{proxyClient, proxyCA}, "abcdef.0123456789abcdef", false, http.StatusOK, false},
+		{"proxied_controller_token_last_call", []*x509.Certificate{proxyClient, proxyCA}, "abcdef.0123456789abcdef", true, http.StatusOK, true},
+		{"proxied_worker_token", []*x509.Certificate{proxyClient, proxyCA}, "ghijkl.0123456789abcdef", true, http.StatusUnauthorized, false},
+		{"proxied_without_token", []*x509.Certificate{proxyClient, proxyCA}, "", true, http.StatusUnauthorized, false},
+		{"proxied_wrong_token_secret", []*x509.Certificate{proxyClient, proxyCA}, "abcdef.fedcba9876543210", true, http.StatusUnauthorized, false},
+		{"front_proxy_ca_other_name", []*x509.Certificate{otherProxyClient, proxyCA}, "abcdef.0123456789abcdef", true, http.StatusForbidden, false},
+		{"direct_controller_cert", []*x509.Certificate{controllerCert, apiCA}, "", true, http.StatusOK, false},
+		{"direct_controller_cert_and_token", []*x509.Certificate{controllerCert, apiCA}, "abcdef.0123456789abcdef", true, http.StatusOK, false},
+		{"direct_worker_cert", []*x509.Certificate{workerCert, apiCA}, "", true, http.StatusForbidden, false},
+		{"direct_controller_token", nil, "abcdef.0123456789abcdef", true, http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				tokenSecret("abcdef", "usage-controller-join", "1"),
+				tokenSecret("ghijkl", "usage-bootstrap-api-worker-calls", "1"),
+			)
+			kubeClient = client
+
+			called := false
+			handler := controllerHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}), tt.lastJoinCall)
+
+			req := httptest.NewRequest(http.MethodGet, "/v1beta1/ca", nil)
+			req.TLS = &tls.ConnectionState{}
+			if tt.chain != nil {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{tt.chain}
+			}
+			if tt.token != "" {
+				req.Header.Set(v1beta1.JoinTokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.status == http.StatusOK, called)
+			_, err := client.CoreV1().Secrets("kube-system").Get(context.TODO(), "bootstrap-token-abcdef", v1.GetOptions{})
+			if tt.usedUp {
+				assert.True(t, apierrors.IsNotFound(err), "the single use token should be used up")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
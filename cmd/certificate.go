@@ -0,0 +1,192 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/certificate"
+)
+
+var (
+	certCheckOnly      bool
+	certOutput         string
+	certExpiringWithin time.Duration
+)
+
+func init() {
+	certificateRenewCmd.Flags().BoolVar(&certCheckOnly, "check", false, "Only show the expiry dates of the certificates, nothing is renewed")
+	certificateRenewCmd.Flags().StringVarP(&certOutput, "output", "o", "table", "Output format of --check, table or json")
+	certificateRenewCmd.Flags().DurationVar(&certExpiringWithin, "expiring-within", 30*24*time.Hour, "Renew the certificates expiring within the given duration")
+	certificateCmd.AddCommand(certificateRenewCmd)
+	addPersistentFlags(certificateCmd)
+}
+
+var (
+	certificateCmd = &cobra.Command{
+		Use:   "certificate",
+		Short: "Manage the certificates of the controller",
+	}
+
+	certificateRenewCmd = &cobra.Command{
+		Use:   "renew",
+		Short: "Renew the expiring control plane certificates. Must be run as root (or with sudo)",
+		Long: `Re-issues the control plane certificates expiring soon with the lifetime set in spec.certificates, and updates the kubeconfigs embedding them.
+A running k0s controller restarts the components using the renewed certificates within a minute.
+The CAs are not renewed, once a CA has expired use "k0s config certs renew --force" while k0s is stopped.`,
+		Example: `	$ k0s certificate renew
+	$ k0s certificate renew --expiring-within 2160h
+	$ k0s certificate renew --check -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if certCheckOnly {
+				return checkCertificates(certOutput)
+			}
+			return renewExpiringCertificates(time.Now().Add(certExpiringWithin))
+		},
+	}
+)
+
+func checkCertificates(output string) error {
+	certs, err := certificate.ListCertificates(k0sVars.CertRootDir)
+	if err != nil {
+		return fmt.Errorf("failed to read certificates: %v", err)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificates found in %s, is the control plane initialized on this node?", k0sVars.CertRootDir)
+	}
+
+	switch output {
+	case "json":
+		jsn, err := json.MarshalIndent(certs, "", "   ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsn))
+	case "table":
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Certificate", "Subject", "Expires at", "Residual time", "CA"})
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetTablePadding("\t") // pad with tabs
+		table.SetNoWhiteSpace(true)
+		now := time.Now()
+		for _, cert := range certs {
+			name, _ := filepath.Rel(k0sVars.CertRootDir, cert.Path)
+			residual := "expired"
+			if cert.NotAfter.After(now) {
+				residual = cert.NotAfter.Sub(now).Round(time.Hour).String()
+			}
+			ca := "no"
+			if cert.IsCA {
+				ca = "yes"
+			}
+			table.Append([]string{name, cert.Subject, cert.NotAfter.Format(time.RFC3339), residual, ca})
+		}
+		table.Render()
+	default:
+		return fmt.Errorf("unknown output format %q, use table or json", output)
+	}
+	return nil
+}
+
+func renewExpiringCertificates(deadline time.Time) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("this command must be run as root")
+	}
+	clusterConfig, err := ConfigFromYaml(cfgFile)
+	if err != nil {
+		return err
+	}
+	certs, err := certificate.ListCertificates(k0sVars.CertRootDir)
+	if err != nil {
+		return fmt.Errorf("failed to read certificates: %v", err)
+	}
+
+	certManager := certificate.Manager{
+		K0sVars:  k0sVars,
+		Lifetime: clusterConfig.Spec.Certificates.Lifetime,
+	}
+	kubeconfigs := certKubeconfigs()
+	var renewed []string
+	for _, cert := range certs {
+		if cert.NotAfter.After(deadline) {
+			continue
+		}
+		if cert.IsCA {
+			fmt.Printf("warning: CA %s expires at %s, it has to be renewed with `k0s config certs renew --force` once expired\n", cert.Path, cert.NotAfter.Format(time.RFC3339))
+			continue
+		}
+		if err := certManager.RenewCertificate(cert.Path); err != nil {
+			return err
+		}
+		renewed = append(renewed, cert.Path)
+
+		name := strings.TrimSuffix(cert.Path, ".crt")
+		if kubeconfig, ok := kubeconfigs[filepath.Base(name)]; ok && util.FileExists(kubeconfig) {
+			if err := updateKubeconfigCertificate(kubeconfig, cert.Path, name+".key"); err != nil {
+				return fmt.Errorf("failed to update %s: %v", kubeconfig, err)
+			}
+		}
+	}
+
+	if len(renewed) == 0 {
+		fmt.Printf("no certificates expiring before %s\n", deadline.Format(time.RFC3339))
+		return nil
+	}
+	fmt.Printf("renewed the certificates:\n  - %s\n", strings.Join(renewed, "\n  - "))
+	fmt.Println("a running k0s controller restarts the affected components within a minute")
+	return nil
+}
+
+// updateKubeconfigCertificate replaces the client certificate embedded in the kubeconfig, keeping its owner and permissions
+func updateKubeconfigCertificate(kubeconfig, certPath, keyPath string) error {
+	cfg, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return err
+	}
+	cert, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	for _, authInfo := range cfg.AuthInfos {
+		authInfo.ClientCertificateData = cert
+		authInfo.ClientKeyData = key
+	}
+	return clientcmd.WriteToFile(*cfg, kubeconfig)
+}
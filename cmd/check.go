@@ -0,0 +1,96 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/k0sproject/k0s/pkg/check"
+	"github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+var (
+	netpolCheckImage   string
+	netpolCheckTimeout time.Duration
+)
+
+func init() {
+	checkNetworkPolicyCmd.Flags().StringVar(&netpolCheckImage, "image", check.DefaultNetworkPolicyCheckImage, "Image used for the test pods, must be available for all the node operating systems")
+	checkNetworkPolicyCmd.Flags().DurationVar(&netpolCheckTimeout, "timeout", 2*time.Minute, "Timeout for the test pods to start and finish")
+	checkCmd.AddCommand(checkNetworkPolicyCmd)
+	addPersistentFlags(checkCmd)
+}
+
+var (
+	checkCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Run checks against the running cluster",
+	}
+
+	checkNetworkPolicyCmd = &cobra.Command{
+		Use:   "network-policy",
+		Short: "Verify that the network provider enforces NetworkPolicies",
+		Long: `Runs test pods in temporary namespaces and verifies the connectivity between them with no policy,
+a deny all ingress policy and a policy allowing traffic from another namespace. If there are windows nodes in the
+cluster, the same matrix is verified on them too. The temporary namespaces are removed after the check.`,
+		Example: `	$ k0s check network-policy`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := kubernetes.NewClient(k0sVars.AdminKubeConfigPath)
+			if err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+
+			results, err := check.NewNetworkPolicyCheck(client, netpolCheckImage, netpolCheckTimeout).Run(context.Background())
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"OS", "Case", "From", "Expected", "Result", "Status"})
+			table.SetAutoWrapText(false)
+			table.SetAutoFormatHeaders(true)
+			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			table.SetCenterSeparator("")
+			table.SetColumnSeparator("")
+			table.SetRowSeparator("")
+			table.SetHeaderLine(false)
+			table.SetBorder(false)
+			table.SetTablePadding("\t") // pad with tabs
+			table.SetNoWhiteSpace(true)
+			failed := 0
+			for _, r := range results {
+				table.Append(r.ToArray())
+				if !r.Passed() {
+					failed++
+				}
+			}
+			table.Render()
+
+			if err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d network policy probes failed, the network provider does not enforce NetworkPolicies", failed, len(results))
+			}
+			return nil
+		},
+	}
+)
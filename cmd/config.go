@@ -24,6 +24,11 @@ import (
 )
 
 var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configuration related sub-commands",
+}
+
+var defaultConfigCmd = &cobra.Command{
 	Use:   "default-config",
 	Short: "Output the default k0s configuration yaml to stdout",
 	RunE: func(cmd *cobra.Command, args []string) error {
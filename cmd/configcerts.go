@@ -0,0 +1,236 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/spf13/cobra"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/certificate"
+	"github.com/k0sproject/k0s/pkg/component/controller"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+var forceRenew bool
+
+func init() {
+	configCertsRenewCmd.Flags().BoolVar(&forceRenew, "force", false, "Renew the certificates even if a CA has expired. All the certificates signed by it are re-created and the workers need to re-join the cluster")
+	configCertsCmd.AddCommand(configCertsRenewCmd)
+	configCertsCmd.AddCommand(configCertsAddSANCmd)
+	configCmd.AddCommand(configCertsCmd)
+	addPersistentFlags(configCertsRenewCmd)
+	addPersistentFlags(configCertsAddSANCmd)
+}
+
+var (
+	configCertsCmd = &cobra.Command{
+		Use:   "certs",
+		Short: "Manage the certificates of the controller",
+	}
+
+	configCertsRenewCmd = &cobra.Command{
+		Use:   "renew",
+		Short: "Renew the expired certificates of the controller. Must be run as root (or with sudo) while k0s is stopped",
+		Long: `Removes the expired certificates, their keys and the kubeconfigs embedding them so that k0s re-creates them on the next start.
+If a CA has expired, --force is needed as all the certificates are re-created.`,
+		Example: `	$ k0s config certs renew
+	$ k0s config certs renew --force`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return renewCertificates(forceRenew)
+		},
+	}
+)
+
+var configCertsAddSANCmd = &cobra.Command{
+	Use:   "add-san [address...]",
+	Short: "Add SANs to the kube-apiserver and k0s API certificates of the controller. Must be run as root (or with sudo)",
+	Long: `Re-issues the kube-apiserver and k0s API serving certificates of this controller with the given IP addresses
+or DNS names added. The SANs are remembered, so they are kept when the certificates are re-created on the following starts.
+The running kube-apiserver picks up the new certificate on its own, the k0s API on the next restart of k0s.
+In a multi-controller setup, the command has to be run on every controller, or the addresses added to spec.api.sans.`,
+	Example: `	$ k0s config certs add-san 203.0.113.10 k8s.example.com`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return addSANs(args)
+	},
+}
+
+func addSANs(sans []string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("this command must be run as root")
+	}
+	for _, san := range sans {
+		if !govalidator.IsIP(san) && !govalidator.IsDNSName(san) {
+			return fmt.Errorf("%s is not a valid IP address or DNS name", san)
+		}
+	}
+	clusterConfig, err := ConfigFromYaml(cfgFile)
+	if err != nil {
+		return err
+	}
+
+	added, err := certificate.AddExtraSANs(k0sVars.CertRootDir, sans)
+	if err != nil {
+		return fmt.Errorf("failed to record the SANs: %v", err)
+	}
+	hostnames, err := controller.APIServerSANs(clusterConfig.Spec, k0sVars)
+	if err != nil {
+		return err
+	}
+
+	certManager := certificate.Manager{K0sVars: k0sVars}
+	if clusterConfig.Spec.Certificates != nil {
+		certManager.Lifetime = clusterConfig.Spec.Certificates.Lifetime
+	}
+	for _, name := range []string{"server", "k0s-api"} {
+		cn := "kubernetes"
+		if name == "k0s-api" {
+			cn = "k0s-api"
+		}
+		_, err := certManager.EnsureCertificate(certificate.Request{
+			Name:      name,
+			CN:        cn,
+			O:         "kubernetes",
+			CACert:    filepath.Join(k0sVars.CertRootDir, "ca.crt"),
+			CAKey:     filepath.Join(k0sVars.CertRootDir, "ca.key"),
+			Hostnames: hostnames,
+		}, constant.ApiserverUser)
+		if err != nil {
+			return fmt.Errorf("failed to re-issue the %s certificate: %v", name, err)
+		}
+	}
+
+	if len(added) == 0 {
+		fmt.Println("the SANs were already added, the certificates are up to date")
+		return nil
+	}
+	fmt.Printf("re-issued the kube-apiserver and k0s API certificates with: %s\n", strings.Join(added, ", "))
+	return nil
+}
+
+// kubeconfigs embedding a client certificate, these need to be re-created with the certificate
+func certKubeconfigs() map[string]string {
+	return map[string]string{
+		"admin":        k0sVars.AdminKubeConfigPath,
+		"konnectivity": k0sVars.KonnectivityKubeConfigPath,
+		"ccm":          filepath.Join(k0sVars.CertRootDir, "ccm.conf"),
+		"scheduler":    filepath.Join(k0sVars.CertRootDir, "scheduler.conf"),
+	}
+}
+
+func renewCertificates(force bool) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("this command must be run as root")
+	}
+	k0sStatus, _ := getPid()
+	if k0sStatus.Pid != 0 {
+		return fmt.Errorf("k0s seems to be running! please stop k0s before renewing the certificates")
+	}
+
+	expired, err := certificate.FindExpired(k0sVars.CertRootDir, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to check certificates: %v", err)
+	}
+	if len(expired) == 0 {
+		fmt.Println("no expired certificates found")
+		return nil
+	}
+
+	// the etcd peers trust each other by the etcd CA, so it's only re-created if it has expired itself
+	var caExpired, etcdCAExpired bool
+	for _, cert := range expired {
+		if cert.IsCA {
+			if filepath.Dir(cert.Path) == k0sVars.EtcdCertDir {
+				etcdCAExpired = true
+			} else {
+				caExpired = true
+			}
+		}
+	}
+	if (caExpired || etcdCAExpired) && !force {
+		return fmt.Errorf("a CA has expired, re-run with --force to re-create all the certificates:\n%s", formatExpired(expired))
+	}
+
+	var toRemove []string
+	kubeconfigs := certKubeconfigs()
+	for _, cert := range expired {
+		name := strings.TrimSuffix(cert.Path, ".crt")
+		toRemove = append(toRemove, cert.Path, name+".key")
+		if kubeconfig, ok := kubeconfigs[filepath.Base(name)]; ok {
+			toRemove = append(toRemove, kubeconfig)
+		}
+	}
+	if caExpired || etcdCAExpired {
+		// everything signed by the expired CA needs to be re-created, the sa key pair is kept so that existing service account tokens stay valid
+		err := filepath.Walk(k0sVars.CertRootDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path == k0sVars.EtcdCertDir && !etcdCAExpired {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Dir(path) != k0sVars.EtcdCertDir && !caExpired {
+				return nil
+			}
+			if (strings.HasSuffix(path, ".crt") || strings.HasSuffix(path, ".key") || strings.HasSuffix(path, ".conf")) && filepath.Base(path) != "sa.key" {
+				toRemove = append(toRemove, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range toRemove {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", f, err)
+		}
+	}
+
+	fmt.Printf("removed the expired certificates, they will be re-created on the next start of k0s:\n%s\n", formatExpired(expired))
+	if caExpired {
+		fmt.Println("the CA will be re-created, all the workers need to re-join the cluster")
+	}
+	// etcd is stopped with k0s, so its members can't be listed here
+	if etcdCAExpired && util.FileExists(filepath.Join(k0sVars.EtcdDataDir, "member", "snap", "db")) {
+		fmt.Printf("WARNING: the etcd CA will be re-created. If etcd has other members, they won't be able to peer with this controller "+
+			"until they use the same CA: after starting this controller, renew the certificates of the other controllers and copy "+
+			"%s and %s to them before starting them\n",
+			filepath.Join(k0sVars.EtcdCertDir, "ca.crt"), filepath.Join(k0sVars.EtcdCertDir, "ca.key"))
+	}
+	return nil
+}
+
+func formatExpired(expired []certificate.ExpiredCertificate) string {
+	lines := make([]string, 0, len(expired))
+	for _, cert := range expired {
+		lines = append(lines, "  - "+cert.String())
+	}
+	return strings.Join(lines, "\n")
+}
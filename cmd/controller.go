@@ -31,10 +31,10 @@ import (
 	"github.com/k0sproject/k0s/pkg/kubernetes"
 	"github.com/k0sproject/k0s/pkg/telemetry"
 
-	"github.com/avast/retry-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/internal/util"
 	"github.com/k0sproject/k0s/pkg/applier"
 	"github.com/k0sproject/k0s/pkg/certificate"
@@ -42,7 +42,9 @@ import (
 	"github.com/k0sproject/k0s/pkg/component/controller"
 	"github.com/k0sproject/k0s/pkg/component/worker"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/hostsfile"
 	"github.com/k0sproject/k0s/pkg/performance"
+	"github.com/k0sproject/k0s/pkg/token"
 
 	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
@@ -55,6 +57,12 @@ func init() {
 	controllerCmd.Flags().StringVar(&tokenFile, "token-file", "", "Path to the file containing join-token.")
 	controllerCmd.Flags().StringVar(&criSocket, "cri-socket", "", "contrainer runtime socket to use, default to internal containerd. Format: [remote|docker]:[path-to-socket]")
 	controllerCmd.Flags().StringToStringVarP(&cmdLogLevels, "logging", "l", defaultLogLevels, "Logging Levels for the different components")
+	controllerCmd.Flags().StringVar(&controllerCACert, "ca-cert", "", "Path to an existing CA certificate to use as the cluster CA instead of generating one. Only used when the cluster is created")
+	controllerCmd.Flags().StringVar(&controllerCAKey, "ca-key", "", "Path to the private key of the CA given with --ca-cert")
+	controllerCmd.Flags().StringVar(&controllerCADir, "ca-dir", "", "Path to a directory with existing CAs (ca, front-proxy-ca and etcd/ca .crt and .key files) to use instead of generating them. Only used when the cluster is created")
+	controllerCmd.Flags().StringVar(&staticTokenFile, "static-token-file", "", "Path to a file with pre-shared join tokens to provision into the cluster")
+	controllerCmd.Flags().StringVar(&joinTransport, "join-transport", joinTransportAuto, "How to reach the k0s API of the existing controllers when joining: direct, kube-api (through the Kubernetes API service proxy) or auto (kube-api if direct is unreachable)")
+	addFIPSFlag(controllerCmd)
 	addPersistentFlags(controllerCmd)
 	installControllerCmd.Flags().AddFlagSet(controllerCmd.Flags())
 }
@@ -64,6 +72,11 @@ var (
 	enableWorker            bool
 	singleNode              bool
 	controllerToken         string
+	controllerCACert        string
+	controllerCAKey         string
+	controllerCADir         string
+	staticTokenFile         string
+	joinTransport           string
 	controllerCmd           = &cobra.Command{
 		Use:     "controller [join-token]",
 		Short:   "Run controller",
@@ -76,6 +89,9 @@ var (
 	$ k0s controller --token-file [path_to_file]
 	Note: Token can be passed either as a CLI argument or as a flag`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if build.WorkerOnly {
+				return errWorkerOnly
+			}
 			if len(args) > 0 {
 				controllerToken = args[0]
 			}
@@ -90,6 +106,12 @@ var (
 				}
 				controllerToken = string(bytes)
 			}
+			if (controllerCACert == "") != (controllerCAKey == "") {
+				return fmt.Errorf("--ca-cert and --ca-key must be given together")
+			}
+			if controllerCACert != "" && controllerCADir != "" {
+				return fmt.Errorf("--ca-cert and --ca-dir cannot be used together")
+			}
 			if singleNode {
 				enableWorker = true
 				k0sVars.DefaultStorageType = "kine"
@@ -100,6 +122,34 @@ var (
 	}
 )
 
+const (
+	joinTransportDirect  = "direct"
+	joinTransportKubeAPI = "kube-api"
+	joinTransportAuto    = "auto"
+)
+
+// selectJoinTransport makes the join client tunnel the calls through the Kubernetes API service proxy when asked to,
+// or in auto mode when the k0s API of the existing controllers can't be connected to directly
+func selectJoinTransport(joinClient *v1beta1.JoinClient, apiPort int) error {
+	switch joinTransport {
+	case joinTransportDirect:
+		return nil
+	case joinTransportKubeAPI:
+	case joinTransportAuto:
+		if joinClient.Reachable(5 * time.Second) {
+			return nil
+		}
+		logrus.Warnf("k0s API at %s is not reachable, joining through the Kubernetes API", joinClient.Address())
+	default:
+		return fmt.Errorf("invalid join transport %q, must be one of %s, %s or %s", joinTransport, joinTransportDirect, joinTransportKubeAPI, joinTransportAuto)
+	}
+	if err := joinClient.UseKubeAPIProxy(apiPort); err != nil {
+		return err
+	}
+	logrus.Infof("joining through the Kubernetes API service proxy at %s", joinClient.Address())
+	return nil
+}
+
 // If we've got CA in place we assume the node has already joined previously
 func needToJoin() bool {
 	if util.FileExists(filepath.Join(k0sVars.CertRootDir, "ca.key")) &&
@@ -115,6 +165,26 @@ func startController(token string) error {
 	if err != nil {
 		return err
 	}
+	for _, deviation := range clusterConfig.Spec.ApplyPreset() {
+		logrus.Infof("%s preset: %s", clusterConfig.Spec.Preset, deviation)
+	}
+	for _, deviation := range clusterConfig.Spec.ApplyHardening() {
+		logrus.Infof("%s hardening: %s", clusterConfig.Spec.Hardening.Profile, deviation)
+	}
+	if fipsMode {
+		if err := fipsPreflight(clusterConfig, ""); err != nil {
+			return err
+		}
+		logrus.Info("running in FIPS mode")
+	}
+
+	writableDirs := []string{k0sVars.DataDir, k0sVars.RunDir, k0sVars.BinDir}
+	if enableWorker {
+		writableDirs = worker.WritableDirs(k0sVars, criSocket)
+	}
+	if err := checkWritableDirs(writableDirs); err != nil {
+		return err
+	}
 
 	// create directories early with the proper permissions
 	if err = util.InitDirectory(k0sVars.DataDir, constant.DataDirMode); err != nil {
@@ -125,7 +195,14 @@ func startController(token string) error {
 	}
 
 	componentManager := component.NewManager()
-	certificateManager := certificate.Manager{K0sVars: k0sVars}
+	componentManager.TimingsPath = filepath.Join(k0sVars.RunDir, "controller-components.json")
+	certificateManager := certificate.Manager{
+		K0sVars:    k0sVars,
+		CALifetime: clusterConfig.Spec.Certificates.CALifetime,
+		Lifetime:   clusterConfig.Spec.Certificates.Lifetime,
+	}
+	// restarts the components when their certificates are renewed with `k0s certificate renew`
+	certReloader := controller.NewCertificateReloader(k0sVars)
 
 	var join = false
 
@@ -136,6 +213,17 @@ func startController(token string) error {
 		if err != nil {
 			return errors.Wrapf(err, "failed to create join client")
 		}
+		if err := selectJoinTransport(joinClient, clusterConfig.Spec.API.APIPort()); err != nil {
+			return err
+		}
+		// the calls tunneled through the Kubernetes API are authenticated with the join token, the client certificate
+		// couldn't be passed through the proxy and bootstrapping it would count the only use of a single use token
+		if !joinClient.ViaKubeAPI() {
+			clientCert, clientKey := filepath.Join(k0sVars.CertRootDir, "k0s-api-client.crt"), filepath.Join(k0sVars.CertRootDir, "k0s-api-client.key")
+			if err := joinClient.BootstrapClientCertificate(clientCert, clientKey); err != nil {
+				return err
+			}
+		}
 
 		componentManager.AddSync(&controller.CASyncer{
 			JoinClient: joinClient,
@@ -143,9 +231,12 @@ func startController(token string) error {
 		})
 	}
 	componentManager.AddSync(&controller.Certificates{
-		ClusterSpec: clusterConfig.Spec,
-		CertManager: certificateManager,
-		K0sVars:     k0sVars,
+		ClusterSpec:  clusterConfig.Spec,
+		CertManager:  certificateManager,
+		K0sVars:      k0sVars,
+		ImportCACert: controllerCACert,
+		ImportCAKey:  controllerCAKey,
+		ImportCADir:  controllerCADir,
 	})
 
 	logrus.Infof("using public address: %s", clusterConfig.Spec.API.Address)
@@ -171,49 +262,68 @@ func startController(token string) error {
 			JoinClient:  joinClient,
 			K0sVars:     k0sVars,
 			LogLevel:    logging["etcd"],
+			FIPS:        fipsMode,
+			CIS:         clusterConfig.Spec.Hardening.CIS(),
 		}
 	default:
 		return errors.New(fmt.Sprintf("Invalid storage type: %s", clusterConfig.Spec.Storage.Type))
 	}
 	logrus.Infof("Using storage backend %s", clusterConfig.Spec.Storage.Type)
 	componentManager.Add(storageBackend)
+	if etcd, ok := storageBackend.(*controller.Etcd); ok {
+		certReloader.Add("etcd", etcd)
+	}
 
 	// common factory to get the admin kube client that's needed in many components
 	adminClientFactory := kubernetes.NewAdminClientFactory(k0sVars)
 
-	componentManager.Add(&controller.APIServer{
+	apiServer := &controller.APIServer{
 		ClusterConfig:      clusterConfig,
 		K0sVars:            k0sVars,
 		LogLevel:           logging["kube-apiserver"],
 		Storage:            storageBackend,
 		EnableKonnectivity: !singleNode,
-	})
+		FIPS:               fipsMode,
+	}
+	if clusterConfig.Spec.Hardening.CIS() {
+		apiServer.DefaultAuditPolicy = controller.CISAuditPolicy
+	}
+	componentManager.Add(apiServer)
+	certReloader.Add("kube-apiserver", apiServer)
 
 	if clusterConfig.Spec.API.ExternalAddress != "" {
-		componentManager.Add(&controller.K0sLease{
+		componentManager.AddWithDeps(&controller.K0sLease{
 			ClusterConfig:     clusterConfig,
 			KubeClientFactory: adminClientFactory,
-		})
+		}, apiServer)
 	}
 
 	if !singleNode {
-		componentManager.Add(&controller.Konnectivity{
+		konnectivity := &controller.Konnectivity{
 			ClusterConfig:     clusterConfig,
 			LogLevel:          logging["konnectivity-server"],
 			K0sVars:           k0sVars,
 			KubeClientFactory: adminClientFactory,
-		})
+		}
+		componentManager.AddWithDeps(konnectivity, apiServer)
+		certReloader.Add("konnectivity-server", konnectivity)
 	}
-	componentManager.Add(&controller.Scheduler{
+	scheduler := &controller.Scheduler{
 		ClusterConfig: clusterConfig,
 		LogLevel:      logging["kube-scheduler"],
 		K0sVars:       k0sVars,
-	})
-	componentManager.Add(&controller.Manager{
+		FIPS:          fipsMode,
+	}
+	componentManager.AddWithDeps(scheduler, apiServer)
+	certReloader.Add("kube-scheduler", scheduler)
+	controllerManager := &controller.Manager{
 		ClusterConfig: clusterConfig,
 		LogLevel:      logging["kube-controller-manager"],
 		K0sVars:       k0sVars,
-	})
+		FIPS:          fipsMode,
+	}
+	componentManager.AddWithDeps(controllerManager, apiServer)
+	certReloader.Add("kube-controller-manager", controllerManager)
 
 	// One leader elector per controller
 	var leaderElector controller.LeaderElector
@@ -222,36 +332,75 @@ func startController(token string) error {
 	} else {
 		leaderElector = &controller.DummyLeaderElector{Leader: true}
 	}
-	componentManager.Add(leaderElector)
+	componentManager.AddWithDeps(leaderElector, apiServer)
 
-	componentManager.Add(&applier.Manager{K0sVars: k0sVars, KubeClientFactory: adminClientFactory, LeaderElector: leaderElector})
+	componentManager.AddWithDeps(&applier.Manager{K0sVars: k0sVars, KubeClientFactory: adminClientFactory, LeaderElector: leaderElector}, leaderElector)
 	if !singleNode {
-		componentManager.Add(&controller.K0SControlAPI{
-			ConfigPath: cfgFile,
+		configPath, err := localConfigPath()
+		if err != nil {
+			return err
+		}
+		controlAPI := &controller.K0SControlAPI{
+			ConfigPath: configPath,
 			K0sVars:    k0sVars,
-		})
+			FIPS:       fipsMode,
+			ExpandEnv:  cfgExpandEnv,
+		}
+		componentManager.AddWithDeps(controlAPI, apiServer)
+		certReloader.Add("k0s-api", controlAPI)
+		componentManager.AddWithDeps(controller.NewK0sAPIService(clusterConfig,
+			leaderElector,
+			adminClientFactory), leaderElector)
+		componentManager.AddWithDeps(controller.NewK0sAPICA(k0sVars,
+			leaderElector,
+			adminClientFactory), leaderElector)
 	}
 
 	if clusterConfig.Spec.Telemetry.Enabled {
-		componentManager.Add(&telemetry.Component{
+		componentManager.AddWithDeps(&telemetry.Component{
 			ClusterConfig:     clusterConfig,
 			Version:           build.Version,
 			K0sVars:           k0sVars,
 			KubeClientFactory: adminClientFactory,
-		})
+		}, apiServer)
 	}
 
 	if clusterConfig.Spec.API.ExternalAddress != "" {
-		componentManager.Add(controller.NewEndpointReconciler(
+		componentManager.AddWithDeps(controller.NewEndpointReconciler(
 			clusterConfig,
 			leaderElector,
 			adminClientFactory,
-		))
+		), leaderElector)
 	}
 
-	componentManager.Add(controller.NewCSRApprover(clusterConfig,
+	if staticTokenFile != "" {
+		componentManager.AddWithDeps(controller.NewStaticTokens(staticTokenFile,
+			leaderElector,
+			adminClientFactory), leaderElector)
+	}
+
+	componentManager.AddWithDeps(controller.NewCSRApprover(clusterConfig,
+		leaderElector,
+		adminClientFactory), leaderElector)
+	componentManager.AddWithDeps(controller.NewNodeLabeler(clusterConfig.Spec.NodeLabels,
 		leaderElector,
-		adminClientFactory))
+		adminClientFactory), leaderElector)
+
+	auditPolicyReconciler := controller.NewAuditPolicyReconciler(k0sVars,
+		apiServer,
+		adminClientFactory)
+	if clusterConfig.Spec.Hardening.CIS() {
+		auditPolicyReconciler.DefaultPolicy = controller.CISAuditPolicy
+	}
+	componentManager.AddWithDeps(auditPolicyReconciler, apiServer)
+
+	// started last, once all the components it restarts are running
+	componentManager.Add(certReloader)
+
+	// the workers get the host aliases through their profile, the controllers straight from the config
+	if err := hostsfile.Update(hostsfile.DefaultPath, clusterConfig.Spec.HostAliases.HostsEntries()); err != nil {
+		logrus.Warnf("failed to update host aliases: %s", err.Error())
+	}
 
 	perfTimer.Checkpoint("starting-component-init")
 	// init components
@@ -370,11 +519,15 @@ func createClusterReconcilers(clusterConf *config.ClusterConfig, k0sVars constan
 	reconcilers["crd"] = controller.NewCRD(manifestsSaver)
 	reconcilers["helmAddons"] = controller.NewHelmAddons(clusterConf, manifestsSaver, k0sVars, cf, leaderElector)
 
-	metricServer, err := controller.NewMetricServer(clusterConf, k0sVars, cf)
-	if err != nil {
-		logrus.Warnf("failed to initialize metric controller reconciler: %s", err.Error())
+	if clusterSpec.Components.BuiltinMetrics() {
+		reconcilers["metricsAggregator"] = controller.NewMetricsAggregator(clusterConf, k0sVars, cf, leaderElector)
 	} else {
-		reconcilers["metricServer"] = metricServer
+		metricServer, err := controller.NewMetricServer(clusterConf, k0sVars, cf)
+		if err != nil {
+			logrus.Warnf("failed to initialize metric controller reconciler: %s", err.Error())
+		} else {
+			reconcilers["metricServer"] = metricServer
+		}
 	}
 
 	kubeletConfig, err := controller.NewKubeletConfig(clusterSpec, k0sVars)
@@ -384,7 +537,13 @@ func createClusterReconcilers(clusterConf *config.ClusterConfig, k0sVars constan
 		reconcilers["kubeletConfig"] = kubeletConfig
 	}
 
-	systemRBAC, err := controller.NewSystemRBAC(k0sVars.ManifestsDir)
+	reconcilers["cloudControllerManager"] = controller.NewCloudControllerManager(clusterSpec, k0sVars)
+	reconcilers["nvidia"] = controller.NewNvidia(clusterSpec, k0sVars)
+	reconcilers["gitops"] = controller.NewGitOps(clusterSpec, k0sVars, cf)
+	reconcilers["localPath"] = controller.NewLocalPath(clusterSpec, k0sVars)
+	reconcilers["snapshotter"] = controller.NewSnapshotter(clusterSpec, k0sVars)
+
+	systemRBAC, err := controller.NewSystemRBAC(k0sVars.ManifestsDir, clusterSpec)
 	if err != nil {
 		logrus.Warnf("failed to initialize system RBAC reconciler: %s", err.Error())
 	} else {
@@ -425,9 +584,10 @@ func startControllerWorker(ctx context.Context, clusterConfig *config.ClusterCon
 	// be fully initialized and running before running worker components
 
 	workerComponentManager := component.NewManager()
+	workerComponentManager.TimingsPath = filepath.Join(k0sVars.RunDir, "worker-components.json")
 	if !util.FileExists(k0sVars.KubeletAuthConfigPath) {
 		// wait for controller to start up
-		err := retry.Do(func() error {
+		err := retry.Do(ctx, "wait for admin kubeconfig", func() error {
 			if !util.FileExists(k0sVars.AdminKubeConfigPath) {
 				return fmt.Errorf("file does not exist: %s", k0sVars.AdminKubeConfigPath)
 			}
@@ -438,12 +598,12 @@ func startControllerWorker(ctx context.Context, clusterConfig *config.ClusterCon
 		}
 
 		var bootstrapConfig string
-		err = retry.Do(func() error {
+		err = retry.Do(ctx, "create kubelet bootstrap config", func() error {
 			// five minutes here are coming from maximum theoretical duration of kubelet bootstrap process
-			// we use retry.Do with 10 attempts, back-off delay and delay duration 500 ms which gives us
-			// 225 seconds here
+			// the default backoff of retry.Do gives up after roughly three minutes, so
+			// 225 seconds covers that
 			tokenAge := time.Second * 225
-			config, err := createKubeletBootstrapConfig(clusterConfig, "worker", tokenAge)
+			config, err := createKubeletBootstrapConfig(clusterConfig, "worker", tokenAge, token.NodeMetadata{}, token.Constraints{}, 0)
 
 			if err != nil {
 				return err
@@ -467,17 +627,22 @@ func startControllerWorker(ctx context.Context, clusterConfig *config.ClusterCon
 		return err
 	}
 
-	workerComponentManager.Add(&worker.ContainerD{
-		LogLevel: logging["containerd"],
-		K0sVars:  k0sVars,
-	})
-	workerComponentManager.Add(worker.NewOCIBundleReconciler(k0sVars))
+	if criSocket == "" {
+		workerComponentManager.Add(&worker.ContainerD{
+			LogLevel:            logging["containerd"],
+			K0sVars:             k0sVars,
+			KubeletConfigClient: kubeletConfigClient,
+			Profile:             profile,
+		})
+	}
+	workerComponentManager.Add(worker.NewOCIBundleReconciler(k0sVars, criSocket))
 	workerComponentManager.Add(&worker.Kubelet{
 		CRISocket:           criSocket,
 		KubeletConfigClient: kubeletConfigClient,
 		Profile:             profile,
 		LogLevel:            logging["kubelet"],
 		K0sVars:             k0sVars,
+		FIPS:                fipsMode,
 	})
 
 	if err := workerComponentManager.Init(); err != nil {
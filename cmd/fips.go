@@ -0,0 +1,67 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/fips"
+)
+
+var fipsMode bool
+
+func addFIPSFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&fipsMode, "fips", false, "Run in FIPS mode, restricts the TLS settings of the components to FIPS approved ones. Requires a k0s build with FIPS support")
+}
+
+// fipsPreflight fails if k0s is not a FIPS build or the config has TLS settings not allowed in FIPS mode
+func fipsPreflight(clusterConfig *config.ClusterConfig, kubeletArgs string) error {
+	if err := fips.Check(); err != nil {
+		return err
+	}
+
+	var errors []error
+	if clusterConfig != nil {
+		errors = append(errors, fips.ValidateArgs("kube-apiserver", clusterConfig.Spec.API.ExtraArgs)...)
+		if clusterConfig.Spec.ControllerManager != nil {
+			errors = append(errors, fips.ValidateArgs("kube-controller-manager", clusterConfig.Spec.ControllerManager.ExtraArgs)...)
+		}
+		if clusterConfig.Spec.Scheduler != nil {
+			errors = append(errors, fips.ValidateArgs("kube-scheduler", clusterConfig.Spec.Scheduler.ExtraArgs)...)
+		}
+	}
+	if kubeletArgs != "" {
+		args := map[string]string{}
+		for name, value := range util.SplitFlags(kubeletArgs) {
+			args[strings.TrimPrefix(name, "--")] = value
+		}
+		errors = append(errors, fips.ValidateArgs("kubelet", args)...)
+	}
+
+	if len(errors) > 0 {
+		messages := make([]string, len(errors))
+		for i, e := range errors {
+			messages[i] = e.Error()
+		}
+		return fmt.Errorf("configuration not allowed in FIPS mode:\n%s", strings.Join(messages, "\n"))
+	}
+	return nil
+}
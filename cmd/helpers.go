@@ -16,24 +16,36 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 
+	"github.com/k0sproject/k0s/internal/configsource"
+	"github.com/k0sproject/k0s/internal/util"
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/component/controller"
+	"github.com/k0sproject/k0s/pkg/constant"
 )
 
 // ConfigFromYaml returns given k0s config or default config
 func ConfigFromYaml(cfgPath string) (clusterConfig *config.ClusterConfig, err error) {
-	if cfgPath == "" {
+	if cfgPath == "" && len(cfgPatches) == 0 {
 		logrus.Info("no config file given, using defaults")
 		clusterConfig = config.DefaultClusterConfig(k0sVars)
-	} else if isInputFromPipe() {
-		clusterConfig, err = config.FromYamlPipe(os.Stdin, k0sVars)
 	} else {
-		clusterConfig, err = config.FromYamlFile(cfgPath, k0sVars)
+		var yml string
+		yml, err = readConfigFile(cfgPath)
+		if err != nil {
+			return nil, err
+		}
+		clusterConfig, err = config.FromYamlString(yml, k0sVars)
 	}
 
 	if err != nil {
@@ -41,6 +53,9 @@ func ConfigFromYaml(cfgPath string) (clusterConfig *config.ClusterConfig, err er
 	}
 	// validate
 	errors := clusterConfig.Validate()
+	if len(errors) == 0 {
+		errors = validateWorkerProfiles(clusterConfig)
+	}
 	if len(errors) > 0 {
 		messages := make([]string, len(errors))
 		for _, e := range errors {
@@ -57,6 +72,76 @@ func ConfigFromYaml(cfgPath string) (clusterConfig *config.ClusterConfig, err er
 	return clusterConfig, nil
 }
 
+// readConfigFile reads the config from the file, the stdin or the URL and merges the --config-patch patches into it,
+// with --expand-env the environment variable references in it are expanded. The default config is the base if no config
+// is given. The config read is kept as is in cfgContent.
+func readConfigFile(cfgPath string) (string, error) {
+	var input []byte
+	var err error
+	if cfgPath == "" {
+		input, err = yaml.Marshal(config.DefaultClusterConfig(k0sVars))
+	} else {
+		source := cfgPath
+		if source != configsource.Stdin && !configsource.IsRemote(source) && isInputFromPipe() {
+			source = configsource.Stdin
+		}
+		input, err = configsource.Read(context.Background(), source, configsource.Options{
+			SHA256:        cfgSHA256,
+			PublicKeyPath: cfgPublicKey,
+		})
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read config file at %s", cfgPath)
+	}
+
+	if len(cfgPatches) > 0 {
+		patches := make([]string, len(cfgPatches))
+		for i, patchPath := range cfgPatches {
+			patch, err := configsource.Read(context.Background(), patchPath, configsource.Options{})
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to read config patch at %s", patchPath)
+			}
+			patches[i] = string(patch)
+		}
+		merged, err := config.MergeYAML(string(input), patches...)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to merge the config patches")
+		}
+		input = []byte(merged)
+	}
+
+	cfgContent = input
+	if !cfgExpandEnv {
+		return string(input), nil
+	}
+	return config.ExpandEnv(string(input))
+}
+
+// localConfigPath returns the path of the config file for the child processes reading the config themselves. A config
+// read from the stdin or a URL, or merged from patches, is written into the run dir, so that it isn't read again.
+func localConfigPath() (string, error) {
+	if len(cfgPatches) == 0 && (cfgFile == "" || (cfgFile != configsource.Stdin && !configsource.IsRemote(cfgFile) && !isInputFromPipe())) {
+		return cfgFile, nil
+	}
+	if err := util.InitDirectory(k0sVars.RunDir, constant.RunDirMode); err != nil {
+		return "", err
+	}
+	path := filepath.Join(k0sVars.RunDir, "k0s.yaml")
+	if err := ioutil.WriteFile(path, cfgContent, 0600); err != nil {
+		return "", errors.Wrap(err, "failed to write the config into the run dir")
+	}
+	return path, nil
+}
+
+// validateWorkerProfiles simulates rendering the kubelet config of each worker profile to catch profiles that would break the workers
+func validateWorkerProfiles(clusterConfig *config.ClusterConfig) []error {
+	kubeletConfig, err := controller.NewKubeletConfig(clusterConfig.Spec, k0sVars)
+	if err != nil {
+		return []error{err}
+	}
+	return kubeletConfig.Validate()
+}
+
 func isInputFromPipe() bool {
 	fi, _ := os.Stdin.Stat()
 	return fi.Mode()&os.ModeCharDevice == 0
@@ -19,10 +19,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/k0sproject/k0s/internal/configsource"
 	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/build"
 	"github.com/k0sproject/k0s/pkg/install"
 )
 
@@ -36,8 +39,18 @@ func init() {
 	installControllerCmd.Flags().AddFlagSet(controllerCmd.Flags())
 	installWorkerCmd.Flags().AddFlagSet(workerCmd.Flags())
 	addPersistentFlags(installCmd)
+
+	for _, cmd := range []*cobra.Command{installControllerCmd, installWorkerCmd} {
+		cmd.Flags().BoolVar(&installSELinux, "selinux", false, "load the k0s SELinux policy module and label the k0s data and run directories")
+	}
 }
 
+var (
+	installSELinux bool
+	// installOnlyFlags are handled by the install command and not passed on to the k0s service
+	installOnlyFlags = map[string]bool{"selinux": true}
+)
+
 var (
 	installCmd = &cobra.Command{
 		Use:   "install",
@@ -55,14 +68,21 @@ var (
 With controller subcommand you can setup a single node cluster by running:
 
 	k0s install controller --enable-worker
+
+On SELinux enforcing hosts, load the k0s policy module and label the k0s directories by running:
+
+	k0s install controller --selinux
 	`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if build.WorkerOnly {
+				return errWorkerOnly
+			}
 			if err := convertFileParamsToAbsolute(); err != nil {
 				cmd.SilenceUsage = true
 				return err
 			}
 			flagsAndVals := []string{"controller"}
-			flagsAndVals = append(flagsAndVals, cmdFlagsToArgs(cmd)...)
+			flagsAndVals = append(flagsAndVals, serviceArgs(cmd)...)
 			flagsAndVals = append(flagsAndVals, args...)
 			if err := setup("controller", flagsAndVals); err != nil {
 				cmd.SilenceUsage = true
@@ -70,7 +90,7 @@ With controller subcommand you can setup a single node cluster by running:
 			}
 			return nil
 		},
-		PreRunE: preRunValidateConfig,
+		PreRunE: preRunValidateInstallConfig,
 	}
 
 	installWorkerCmd = &cobra.Command{
@@ -87,7 +107,7 @@ Windows flags like "--api-server", "--cidr-range" and "--cluster-dns" will be ig
 			}
 
 			flagsAndVals := []string{"worker"}
-			flagsAndVals = append(flagsAndVals, cmdFlagsToArgs(cmd)...)
+			flagsAndVals = append(flagsAndVals, serviceArgs(cmd)...)
 			flagsAndVals = append(flagsAndVals, args...)
 			if err := setup("worker", flagsAndVals); err != nil {
 				cmd.SilenceUsage = true
@@ -96,7 +116,7 @@ Windows flags like "--api-server", "--cidr-range" and "--cluster-dns" will be ig
 
 			return nil
 		},
-		PreRunE: preRunValidateConfig,
+		PreRunE: preRunValidateInstallConfig,
 	}
 )
 
@@ -109,7 +129,7 @@ func setup(role string, args []string) error {
 	}
 
 	// if cfgFile is not provided k0s will handle this so no need to check if the file exists.
-	if cfgFile != "" && !util.IsDirectory(cfgFile) && !util.FileExists(cfgFile) {
+	if cfgFile != "" && !configsource.IsRemote(cfgFile) && !util.IsDirectory(cfgFile) && !util.FileExists(cfgFile) {
 		return fmt.Errorf("file %s does not exist", cfgFile)
 	}
 
@@ -123,6 +143,12 @@ func setup(role string, args []string) error {
 		}
 	}
 
+	if installSELinux {
+		if err := install.InstallSELinuxPolicy(k0sVars); err != nil {
+			return fmt.Errorf("failed to install SELinux policy: %v", err)
+		}
+	}
+
 	err := install.EnsureService(args)
 	if err != nil {
 		return fmt.Errorf("failed to install k0s service: %v", err)
@@ -130,15 +156,43 @@ func setup(role string, args []string) error {
 	return nil
 }
 
+// serviceArgs returns the flags of the install command which are passed on to the k0s service
+func serviceArgs(cmd *cobra.Command) []string {
+	var args []string
+	for _, arg := range cmdFlagsToArgs(cmd) {
+		name := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)[0]
+		if !installOnlyFlags[name] {
+			args = append(args, arg)
+		}
+	}
+	return args
+}
+
 func convertFileParamsToAbsolute() (err error) {
-	// don't convert if cfgFile is empty
-	if cfgFile != "" {
+	// don't convert if cfgFile is empty, the stdin or a URL
+	if cfgFile != "" && cfgFile != configsource.Stdin && !configsource.IsRemote(cfgFile) {
 		cfgFile, err = filepath.Abs(cfgFile)
 		if err != nil {
 			return err
 		}
 	}
 
+	for i, patchPath := range cfgPatches {
+		if !configsource.IsRemote(patchPath) {
+			cfgPatches[i], err = filepath.Abs(patchPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfgPublicKey != "" {
+		cfgPublicKey, err = filepath.Abs(cfgPublicKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	if dataDir != "" {
 		dataDir, err = filepath.Abs(dataDir)
 		if err != nil {
@@ -146,6 +200,20 @@ func convertFileParamsToAbsolute() (err error) {
 		}
 	}
 
+	if bundleSource != "" && !strings.Contains(bundleSource, "://") {
+		if bundleSource, err = filepath.Abs(bundleSource); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []*string{&runDir, &binDir, &containerdConfigDir} {
+		if *dir != "" {
+			if *dir, err = filepath.Abs(*dir); err != nil {
+				return err
+			}
+		}
+	}
+
 	if tokenFile != "" {
 		tokenFile, err = filepath.Abs(tokenFile)
 		if err != nil {
@@ -156,9 +224,23 @@ func convertFileParamsToAbsolute() (err error) {
 		}
 	}
 
+	if staticTokenFile != "" {
+		staticTokenFile, err = filepath.Abs(staticTokenFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func preRunValidateConfig(cmd *cobra.Command, args []string) error {
 	return validateConfig(cfgFile)
 }
+
+func preRunValidateInstallConfig(cmd *cobra.Command, args []string) error {
+	if cfgFile == configsource.Stdin {
+		return fmt.Errorf("the service can't read the config from the stdin, use a file or a URL")
+	}
+	return preRunValidateConfig(cmd, args)
+}
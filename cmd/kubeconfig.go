@@ -17,8 +17,13 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"fmt"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/cloudflare/cfssl/log"
 	"github.com/k0sproject/k0s/internal/util"
@@ -26,21 +31,37 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
 
-	"html/template"
 	"io/ioutil"
 	"os"
 	"path"
 )
 
+const (
+	kubeconfigAuthCert = "cert"
+	kubeconfigAuthOIDC = "oidc"
+	kubeconfigAuthExec = "exec"
+)
+
 func init() {
 	kubeconfigCreateCmd.Flags().StringVar(&groups, "groups", "", "Specify groups")
+	kubeconfigCreateCmd.Flags().StringVar(&kubeconfigAuth, "auth", kubeconfigAuthCert, "How the user authenticates: cert (client certificate), oidc (kubectl oidc auth provider) or exec (kubelogin credential plugin). oidc and exec use the OIDC provider configured in spec.api.oidc")
+	kubeconfigCreateCmd.Flags().StringVar(&oidcClientSecret, "oidc-client-secret", "", "OIDC client secret to use with --auth=oidc or --auth=exec")
+	kubeconfigCreateCmd.Flags().StringVar(&execCommand, "exec-command", "kubectl", "Command to run kubelogin with --auth=exec, either kubectl for the oidc-login plugin or the path of a standalone kubelogin")
+	kubeconfigCreateCmd.Flags().DurationVar(&kubeconfigTTL, "ttl", 0, "Issue a new client certificate valid for the given duration instead of the stored one with the lifetime set in spec.certificates")
+	kubeconfigCreateCmd.Flags().StringVar(&kubeconfigRenew, "renew", "", "Path to an existing kubeconfig to renew the client certificate of in place, for the same user and groups")
 	kubeconfigCmd.AddCommand(kubeconfigCreateCmd)
 	kubeconfigCmd.AddCommand(kubeConfigAdminCmd)
 }
 
 var (
-	groups string
+	groups           string
+	kubeconfigAuth   string
+	oidcClientSecret string
+	execCommand      string
+	kubeconfigTTL    time.Duration
+	kubeconfigRenew  string
 
 	userKubeconfigTemplate = template.Must(template.New("kubeconfig").Parse(`
 apiVersion: v1
@@ -64,6 +85,76 @@ users:
     client-key-data: {{.ClientKey}}
 `))
 
+	// oidcKubeconfigTemplate uses the kubelogin (kubectl oidc-login) credential plugin to fetch the tokens
+	oidcKubeconfigTemplate = template.Must(template.New("kubeconfig").Parse(`
+apiVersion: v1
+clusters:
+- cluster:
+    server: {{.JoinURL}}
+    certificate-authority-data: {{.CACert}}
+  name: k0s
+contexts:
+- context:
+    cluster: k0s
+    user: {{.User}}
+  name: k0s
+current-context: k0s
+kind: Config
+preferences: {}
+users:
+- name: {{.User}}
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: {{.ExecCommand}}
+      args:
+{{- if eq .ExecCommand "kubectl" }}
+      - oidc-login
+{{- end }}
+      - get-token
+      - --oidc-issuer-url={{.IssuerURL}}
+      - --oidc-client-id={{.ClientID}}
+{{- if .ClientSecret }}
+      - --oidc-client-secret={{.ClientSecret}}
+{{- end }}
+{{- if .IssuerCACert }}
+      - --certificate-authority-data={{.IssuerCACert}}
+{{- end }}
+`))
+
+	// oidcAuthProviderKubeconfigTemplate uses the oidc auth provider built in kubectl, the user has to set the
+	// id-token and refresh-token after logging in to the identity provider
+	oidcAuthProviderKubeconfigTemplate = template.Must(template.New("kubeconfig").Parse(`
+apiVersion: v1
+clusters:
+- cluster:
+    server: {{.JoinURL}}
+    certificate-authority-data: {{.CACert}}
+  name: k0s
+contexts:
+- context:
+    cluster: k0s
+    user: {{.User}}
+  name: k0s
+current-context: k0s
+kind: Config
+preferences: {}
+users:
+- name: {{.User}}
+  user:
+    auth-provider:
+      name: oidc
+      config:
+        idp-issuer-url: {{.IssuerURL}}
+        client-id: {{.ClientID}}
+{{- if .ClientSecret }}
+        client-secret: {{.ClientSecret}}
+{{- end }}
+{{- if .IssuerCACert }}
+        idp-certificate-authority-data: {{.IssuerCACert}}
+{{- end }}
+`))
+
 	// kubeconfigCmd creates new certs and kubeConfig for a user
 	kubeconfigCmd = &cobra.Command{
 		Use:   "kubeconfig [command]",
@@ -83,32 +174,105 @@ Note: A certificate once signed cannot be revoked for a particular user`,
 	$ k0s kubeconfig create [username]
 
 	optionally add groups:
-	$ k0s kubeconfig create [username] --groups [groups]`,
+	$ k0s kubeconfig create [username] --groups [groups]
+
+	create a kubeconfig authenticating with the OIDC provider set in spec.api.oidc through kubelogin:
+	$ k0s kubeconfig create [username] --auth exec
+
+	or through the oidc auth provider of kubectl:
+	$ k0s kubeconfig create [username] --auth oidc --oidc-client-secret [secret]
+
+	create a kubeconfig with a client certificate valid for 8 hours, e.g. for a CI job:
+	$ k0s kubeconfig create [username] --ttl 8h > ci.kubeconfig
+
+	renew the client certificate of the kubeconfig in place:
+	$ k0s kubeconfig create --renew ci.kubeconfig --ttl 8h`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// disable cfssl log
 			log.Level = log.LevelFatal
 
-			if len(args) == 0 {
+			switch kubeconfigAuth {
+			case kubeconfigAuthCert, kubeconfigAuthOIDC, kubeconfigAuthExec:
+			default:
+				return errors.Errorf("invalid --auth %q, must be one of %s, %s or %s", kubeconfigAuth, kubeconfigAuthCert, kubeconfigAuthOIDC, kubeconfigAuthExec)
+			}
+			if kubeconfigTTL < 0 {
+				return errors.New("--ttl must be positive")
+			}
+			if kubeconfigAuth != kubeconfigAuthCert && (kubeconfigTTL > 0 || kubeconfigRenew != "") {
+				return errors.Errorf("--ttl and --renew can't be used with --auth=%s", kubeconfigAuth)
+			}
+			if len(args) == 0 && kubeconfigRenew == "" {
 				return errors.New("Username is mandatory")
 			}
-			var username = args[0]
 			var config = k0sVars
 
-			clusterAPIURL, err := getAPIURL()
+			// Disable logrus
+			logrus.SetLevel(logrus.FatalLevel)
+			clusterConfig, err := ConfigFromYaml(cfgFile)
 			if err != nil {
-				return errors.Wrap(err, "failed to fetch cluster's API Address: %v.")
+				return errors.Wrap(err, "failed to read cluster config")
+			}
+			if kubeconfigRenew != "" {
+				certManager := certificate.Manager{
+					K0sVars:  config,
+					Lifetime: kubeconfigTTL,
+				}
+				return renewKubeconfig(kubeconfigRenew, certManager, args)
 			}
-			caCert, err := ioutil.ReadFile(path.Join(config.CertRootDir, "ca.crt"))
+			var username = args[0]
+			clusterAPIURL := clusterConfig.Spec.API.APIAddressURL()
+
+			caCert, err := certificate.TrustBundle(path.Join(config.CertRootDir, "ca.crt"))
 			if err != nil {
 				return errors.Wrapf(err, "failed to read cluster ca certificate, is the control plane initialized on this node?")
 			}
 
-			caCertPath, caCertKey := path.Join(config.CertRootDir, "ca.crt"), path.Join(config.CertRootDir, "ca.key")
-
-			if err != nil {
-				return err
+			var buf bytes.Buffer
+			if kubeconfigAuth != kubeconfigAuthCert {
+				oidcSpec := clusterConfig.Spec.API.OIDC
+				if oidcSpec == nil {
+					return errors.Errorf("--auth=%s requires spec.api.oidc to be configured", kubeconfigAuth)
+				}
+				data := struct {
+					CACert       string
+					User         string
+					JoinURL      string
+					IssuerURL    string
+					ClientID     string
+					ClientSecret string
+					IssuerCACert string
+					ExecCommand  string
+				}{
+					CACert:       base64.StdEncoding.EncodeToString(caCert),
+					User:         username,
+					JoinURL:      clusterAPIURL,
+					IssuerURL:    oidcSpec.IssuerURL,
+					ClientID:     oidcSpec.ClientID,
+					ClientSecret: oidcClientSecret,
+					ExecCommand:  execCommand,
+				}
+				// the CA of the identity provider is embedded, the users may not have it
+				if oidcSpec.CAFile != "" {
+					issuerCA, err := ioutil.ReadFile(oidcSpec.CAFile)
+					if err != nil {
+						return errors.Wrap(err, "failed to read the CA of the OIDC provider")
+					}
+					data.IssuerCACert = base64.StdEncoding.EncodeToString(issuerCA)
+				}
+				tmpl := oidcKubeconfigTemplate
+				if kubeconfigAuth == kubeconfigAuthOIDC {
+					tmpl = oidcAuthProviderKubeconfigTemplate
+				}
+				if err := tmpl.Execute(&buf, &data); err != nil {
+					return err
+				}
+				os.Stdout.Write(buf.Bytes())
+				return nil
 			}
 
+			caCertPath, caCertKey := path.Join(config.CertRootDir, "ca.crt"), path.Join(config.CertRootDir, "ca.key")
+
 			userReq := certificate.Request{
 				Name:   username,
 				CN:     username,
@@ -117,9 +281,17 @@ Note: A certificate once signed cannot be revoked for a particular user`,
 				CAKey:  caCertKey,
 			}
 			certManager := certificate.Manager{
-				K0sVars: config,
+				K0sVars:  config,
+				Lifetime: clusterConfig.Spec.Certificates.Lifetime,
+			}
+			var userCert certificate.Certificate
+			if kubeconfigTTL > 0 {
+				// short-lived certificates are not stored, every kubeconfig gets its own
+				certManager.Lifetime = kubeconfigTTL
+				userCert, err = certManager.IssueCertificate(userReq)
+			} else {
+				userCert, err = certManager.EnsureCertificate(userReq, "root")
 			}
-			userCert, err := certManager.EnsureCertificate(userReq, "root")
 			if err != nil {
 				return err
 			}
@@ -138,8 +310,6 @@ Note: A certificate once signed cannot be revoked for a particular user`,
 				JoinURL:    clusterAPIURL,
 			}
 
-			var buf bytes.Buffer
-
 			err = userKubeconfigTemplate.Execute(&buf, &data)
 			if err != nil {
 				return err
@@ -163,11 +333,13 @@ Note: A certificate once signed cannot be revoked for a particular user`,
 					log.Fatal(err)
 				}
 
-				clusterAPIURL, err := getAPIURL()
+				// Disable logrus
+				logrus.SetLevel(logrus.FatalLevel)
+				clusterConfig, err := ConfigFromYaml(cfgFile)
 				if err != nil {
 					return errors.Wrap(err, "failed to fetch cluster's API Address: %v.")
 				}
-				newContent := strings.Replace(string(content), "https://localhost:6443", clusterAPIURL, -1)
+				newContent := strings.Replace(string(content), clusterConfig.Spec.API.LocalURL(), clusterConfig.Spec.API.APIAddressURL(), -1)
 				os.Stdout.Write([]byte(newContent))
 			} else {
 				return errors.Errorf("failed to read admin config, is the control plane initialized on this node?")
@@ -177,13 +349,89 @@ Note: A certificate once signed cannot be revoked for a particular user`,
 	}
 )
 
-func getAPIURL() (string, error) {
-	// Disable logrus
-	logrus.SetLevel(logrus.FatalLevel)
+// renewKubeconfig replaces the client certificate of the current user of the kubeconfig at kubeconfigPath with a new one issued
+// for the same user and groups. Without a lifetime set on the manager the new certificate is valid for as long as the
+// old one was.
+func renewKubeconfig(kubeconfigPath string, certManager certificate.Manager, args []string) error {
+	kubeconfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load kubeconfig %s", kubeconfigPath)
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return fmt.Errorf("kubeconfig %s has no current context", kubeconfigPath)
+	}
+	authInfo, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if !ok || len(authInfo.ClientCertificateData) == 0 {
+		return fmt.Errorf("kubeconfig %s has no embedded client certificate to renew", kubeconfigPath)
+	}
+
+	caCertPath, caKeyPath := path.Join(certManager.K0sVars.CertRootDir, "ca.crt"), path.Join(certManager.K0sVars.CertRootDir, "ca.key")
+	oldCert, err := verifyClientCertificate(authInfo.ClientCertificateData, caCertPath)
+	if err != nil {
+		return errors.Wrapf(err, "can't renew the client certificate of kubeconfig %s", kubeconfigPath)
+	}
+	if len(args) > 0 && args[0] != oldCert.Subject.CommonName {
+		return fmt.Errorf("kubeconfig %s is for user %s, not %s", kubeconfigPath, oldCert.Subject.CommonName, args[0])
+	}
+	if certManager.Lifetime == 0 {
+		certManager.Lifetime = oldCert.NotAfter.Sub(oldCert.NotBefore)
+	}
+
+	userCert, err := certManager.IssueCertificate(certificate.Request{
+		Name:   oldCert.Subject.CommonName,
+		CN:     oldCert.Subject.CommonName,
+		O:      strings.Join(oldCert.Subject.Organization, ","),
+		CACert: caCertPath,
+		CAKey:  caKeyPath,
+	})
+	if err != nil {
+		return err
+	}
+	authInfo.ClientCertificateData = []byte(userCert.Cert)
+	authInfo.ClientKeyData = []byte(userCert.Key)
+
+	return clientcmd.WriteToFile(*kubeconfig, kubeconfigPath)
+}
 
-	clusterConfig, err := ConfigFromYaml(cfgFile)
+// verifyClientCertificate parses the PEM encoded client certificate and checks it was issued by the cluster CA, a
+// kubeconfig of another cluster is not renewed by accident then. The certificate may have expired already.
+func verifyClientCertificate(certPEM []byte, caCertPath string) (*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+
+	caCert, err := certificate.TrustBundle(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   certs[0].NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
 	if err != nil {
-		return "", err
+		return nil, errors.Wrap(err, "the certificate is not issued by the cluster CA")
 	}
-	return clusterConfig.Spec.API.APIAddressURL(), nil
+	return certs[0], nil
 }
@@ -24,10 +24,12 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/k0sproject/k0s/pkg/hostsfile"
 	"github.com/k0sproject/k0s/pkg/install"
 )
 
 func init() {
+	resetCmd.Flags().StringVar(&criSocket, "cri-socket", "", "container runtime socket the worker uses, if not the internal containerd. Format: [remote|docker]:[path-to-socket]")
 	addPersistentFlags(resetCmd)
 }
 
@@ -70,7 +72,10 @@ func reset() error {
 		logger.Infof("failed to uninstall k0s service: %v", err)
 	}
 	// Get Cleanup Config
-	cfg := install.NewCleanUpConfig(k0sVars.DataDir)
+	cfg, err := install.NewCleanUpConfig(k0sVars, criSocket)
+	if err != nil {
+		return err
+	}
 
 	if strings.Contains(role, "controller") {
 		clusterConfig, err := ConfigFromYaml(cfgFile)
@@ -89,6 +94,10 @@ func reset() error {
 		}
 	}
 
+	if err := hostsfile.Remove(hostsfile.DefaultPath); err != nil {
+		logger.Infof("failed to remove host aliases from %s: %v", hostsfile.DefaultPath, err)
+	}
+
 	if err := cfg.RemoveAllDirectories(); err != nil {
 		logger.Info(err.Error())
 	}
@@ -16,9 +16,12 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -26,12 +29,26 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/k0sproject/k0s/internal/retry"
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/build"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
 var (
+	binDir              string
+	bundleSource        string
+	containerdConfigDir string
+	runDir              string
+
 	cfgFile       string
+	cfgContent    []byte
+	cfgExpandEnv  bool
+	cfgPatches    []string
+	cfgPublicKey  string
+	cfgSHA256     string
 	cmdLogLevels  map[string]string
 	dataDir       string
 	debug         bool
@@ -40,6 +57,9 @@ var (
 	logging       map[string]string
 )
 
+// errWorkerOnly is returned by the controller commands of the worker-only build
+var errWorkerOnly = errors.New("this is the worker-only k0s build without the controller components, use the full k0s binary for controllers")
+
 var defaultLogLevels = map[string]string{
 	"etcd":                    "info",
 	"containerd":              "info",
@@ -53,11 +73,16 @@ var defaultLogLevels = map[string]string{
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "", "Data Directory for k0s (default: /var/lib/k0s). DO NOT CHANGE for an existing setup, things will break!")
+	rootCmd.PersistentFlags().StringVar(&runDir, "run-dir", "", "Run directory for the pid files and the sockets (default: /run/k0s as root, <data-dir>/run otherwise)")
+	rootCmd.PersistentFlags().StringVar(&binDir, "bin-dir", "", "Directory the embedded binaries are staged to (default: <data-dir>/bin)")
+	rootCmd.PersistentFlags().StringVar(&bundleSource, "bundle-source", "", "URL or local directory of the component bundle the binaries left out of a slim k0s build are fetched from")
+	rootCmd.PersistentFlags().StringVar(&containerdConfigDir, "containerd-config-dir", "", "Directory of the k0s managed containerd config, its drop-ins and the registry host configs (default: /etc/k0s)")
 	rootCmd.PersistentFlags().StringVar(&debugListenOn, "debugListenOn", ":6060", "Http listenOn for debug pprof handler")
 
 	addPersistentFlags(rootCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(defaultConfigCmd)
 	rootCmd.AddCommand(tokenCmd)
 	rootCmd.AddCommand(controllerCmd)
 	rootCmd.AddCommand(workerCmd)
@@ -72,6 +97,10 @@ func init() {
 	rootCmd.AddCommand(kubectlCmd)
 	rootCmd.AddCommand(airgapCmd)
 	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(certificateCmd)
+	rootCmd.AddCommand(sysinfoCmd)
+	rootCmd.AddCommand(tpmCmd)
 
 	rootCmd.DisableAutoGenTag = true
 	longDesc = "k0s - The zero friction Kubernetes - https://k0sproject.io"
@@ -91,6 +120,8 @@ var (
 			// set DEBUG from env, or from command flag
 			if viper.GetString("debug") != "" || debug {
 				logrus.SetLevel(logrus.DebugLevel)
+				http.HandleFunc("/debug/components", componentUsageHandler)
+				http.HandleFunc("/debug/retries", retryMetricsHandler)
 				go func() {
 					log.Println("starting debug server under", debugListenOn)
 					log.Println(http.ListenAndServe(debugListenOn, nil))
@@ -101,7 +132,8 @@ var (
 			logging = setLogging(cmdLogLevels)
 
 			// Get relevant Vars from constant package
-			k0sVars = constant.GetConfig(dataDir)
+			k0sVars = constant.GetConfigDirs(k0sDirs())
+			assets.BundleSource = bundleSource
 		},
 	}
 
@@ -127,6 +159,43 @@ var (
 	}
 )
 
+// componentUsageHandler serves the CPU and memory usage of the supervised components as JSON
+func componentUsageHandler(w http.ResponseWriter, r *http.Request) {
+	usages, err := supervisor.ReadUsage(k0sVars.RunDir, time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(usages)
+}
+
+// retryMetricsHandler serves the metrics of the retried operations as JSON, keyed by the operation name
+func retryMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	type operation struct {
+		Calls        int    `json:"calls"`
+		Attempts     int    `json:"attempts"`
+		Failures     int    `json:"failures"`
+		LastError    string `json:"lastError,omitempty"`
+		LastDuration string `json:"lastDuration"`
+	}
+	operations := map[string]operation{}
+	for name, m := range retry.Snapshot() {
+		op := operation{
+			Calls:        m.Calls,
+			Attempts:     m.Attempts,
+			Failures:     m.Failures,
+			LastDuration: m.LastDuration.String(),
+		}
+		if m.LastError != nil {
+			op.LastError = m.LastError.Error()
+		}
+		operations[name] = op
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(operations)
+}
+
 func generateDocs() error {
 	if err := doc.GenMarkdownTree(rootCmd, "./docs/cli"); err != nil {
 		return err
@@ -144,11 +213,34 @@ func setLogging(inputLogs map[string]string) map[string]string {
 
 func addPersistentFlags(cmd *cobra.Command) {
 	flagset := &pflag.FlagSet{}
-	flagset.StringVarP(&cfgFile, "config", "c", "", "config file (default: ./k0s.yaml)")
+	flagset.StringVarP(&cfgFile, "config", "c", "", "config file, - for the stdin or a http(s) URL (default: ./k0s.yaml)")
+	flagset.StringSliceVar(&cfgPatches, "config-patch", nil, "Merge the config patch files or URLs into the config in the given order")
+	flagset.StringVar(&cfgSHA256, "config-sha256", "", "Verify the config against the hex encoded SHA256 checksum")
+	flagset.StringVar(&cfgPublicKey, "config-public-key", "", "Verify the config from a URL against the detached signature at <URL>.sig with the PEM encoded ed25519 public key")
+	flagset.BoolVar(&cfgExpandEnv, "expand-env", false, "Expand the ${VAR} environment variable references in the config file")
 	flagset.BoolVarP(&debug, "debug", "d", false, "Debug logging (default: false)")
 	cmd.Flags().AddFlagSet(flagset)
 }
 
+// k0sDirs returns the directories given on the command line
+func k0sDirs() constant.Dirs {
+	return constant.Dirs{
+		DataDir:             dataDir,
+		RunDir:              runDir,
+		BinDir:              binDir,
+		ContainerdConfigDir: containerdConfigDir,
+	}
+}
+
+// checkWritableDirs checks that k0s can write to the given directories, which fails on read-only root filesystems
+// unless the directories are relocated to writable volumes
+func checkWritableDirs(dirs []string) error {
+	if err := util.CheckWritableDirs(dirs, constant.DataDirMode); err != nil {
+		return fmt.Errorf("%v: relocate them to writable volumes with --data-dir, --run-dir, --bin-dir and --containerd-config-dir", err)
+	}
+	return nil
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
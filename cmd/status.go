@@ -21,15 +21,24 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/olekukonko/tablewriter"
 	"github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 
+	"github.com/k0sproject/k0s/pkg/assets"
+	"github.com/k0sproject/k0s/pkg/component"
+	"github.com/k0sproject/k0s/pkg/component/worker"
 	"github.com/k0sproject/k0s/pkg/install"
+	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
 var (
@@ -66,6 +75,14 @@ var (
 				if status.Role, err = install.GetRoleByPID(status.Pid); err != nil {
 					return err
 				}
+				status.BinaryVerificationFailures = assets.ReadVerificationFailures(k0sVars.BinDir)
+				status.ComponentStartup = readComponentTimings()
+				if strings.Contains(status.Role, "worker") {
+					status.PodResourcesSocket = k0sVars.KubeletPodResourcesSocket
+					if dropIns, err := worker.ReadContainerdDropInStatus(k0sVars); err == nil {
+						status.InvalidContainerdDropIns = dropIns.Invalid
+					}
+				}
 			} else {
 				fmt.Fprintln(os.Stderr, "K0s not running")
 				os.Exit(1)
@@ -81,6 +98,22 @@ var (
 func init() {
 	status = &K0sStatus{}
 	statusCmd.PersistentFlags().StringVarP(&output, "out", "o", "", "sets type of out put to json or yaml")
+	statusCmd.AddCommand(statusComponentsCmd)
+}
+
+// readComponentTimings reads the startup timings of the controller and worker components of the running k0s
+func readComponentTimings() map[string]component.Timing {
+	timings := map[string]component.Timing{}
+	for _, file := range []string{"controller-components.json", "worker-components.json"} {
+		t, err := component.ReadTimings(filepath.Join(k0sVars.RunDir, file))
+		if err != nil {
+			continue
+		}
+		for name, timing := range t {
+			timings[name] = timing
+		}
+	}
+	return timings
 }
 
 type K0sStatus struct {
@@ -90,7 +123,16 @@ type K0sStatus struct {
 	Role     string
 	SysInit  string
 	StubFile string
-	output   string
+	// PodResourcesSocket is the kubelet podresources API socket of the worker
+	PodResourcesSocket string `json:",omitempty" yaml:",omitempty"`
+	// InvalidContainerdDropIns are the containerd config drop-ins skipped as invalid, with their errors
+	InvalidContainerdDropIns map[string]string `json:",omitempty" yaml:",omitempty"`
+	// BinaryVerificationFailures are the last integrity verification failures of the staged binaries, which have
+	// been staged again since
+	BinaryVerificationFailures map[string]string `json:",omitempty" yaml:",omitempty"`
+	// ComponentStartup are the startup timings of the components, keyed by the component
+	ComponentStartup map[string]component.Timing `json:",omitempty" yaml:",omitempty"`
+	output           string
 }
 
 func (s K0sStatus) String() {
@@ -119,10 +161,90 @@ func (s K0sStatus) String() {
 		if s.StubFile != "" {
 			fmt.Println("Service file:", s.StubFile)
 		}
+		if s.PodResourcesSocket != "" {
+			fmt.Println("Pod resources socket:", s.PodResourcesSocket)
+		}
+		for dropIn, err := range s.InvalidContainerdDropIns {
+			fmt.Printf("Invalid containerd drop-in: %s: %s\n", dropIn, err)
+		}
+		for bin, failure := range s.BinaryVerificationFailures {
+			fmt.Printf("Binary verification failure: %s: %s\n", bin, failure)
+		}
+		if len(s.ComponentStartup) > 0 {
+			names := make([]string, 0, len(s.ComponentStartup))
+			for name := range s.ComponentStartup {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Println("Component startup:")
+			for _, name := range names {
+				timing := s.ComponentStartup[name]
+				fmt.Printf("  %s: init %s, waited %s, started %s\n", name,
+					timing.Init.Round(time.Millisecond), timing.Waited.Round(time.Millisecond), timing.Start.Round(time.Millisecond))
+			}
+		}
 	}
 
 }
 
+var statusComponentsCmd = &cobra.Command{
+	Use:     "components",
+	Short:   "Show the CPU and memory usage of the components k0s runs",
+	Example: `k0s status components -o json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("currently only supported on linux")
+		}
+		usages, err := supervisor.ReadUsage(k0sVars.RunDir, time.Second)
+		if err != nil {
+			return err
+		}
+		if len(usages) == 0 {
+			return fmt.Errorf("no running components found in %s, is k0s running?", k0sVars.RunDir)
+		}
+
+		switch output {
+		case "json":
+			jsn, err := json.MarshalIndent(usages, "", "   ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(jsn))
+		case "yaml":
+			ym, err := yaml.Marshal(usages)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(ym))
+		default:
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Component", "PID", "CPU", "CPU time", "Memory"})
+			table.SetAutoWrapText(false)
+			table.SetAutoFormatHeaders(true)
+			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			table.SetCenterSeparator("")
+			table.SetColumnSeparator("")
+			table.SetRowSeparator("")
+			table.SetHeaderLine(false)
+			table.SetBorder(false)
+			table.SetTablePadding("\t")
+			table.SetNoWhiteSpace(true)
+			for _, u := range usages {
+				table.Append([]string{
+					u.Name,
+					strconv.Itoa(u.PID),
+					fmt.Sprintf("%.1f%%", u.CPUPercent),
+					u.CPUTime.Round(time.Second).String(),
+					fmt.Sprintf("%.1fMi", float64(u.RSS)/(1<<20)),
+				})
+			}
+			table.Render()
+		}
+		return nil
+	},
+}
+
 func getPid() (status *K0sStatus, err error) {
 	pid, ppid, err := install.GetProcessID()
 	if err == nil && pid != nil {
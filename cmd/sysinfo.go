@@ -0,0 +1,108 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/k0sproject/k0s/pkg/sysinfo"
+)
+
+var sysinfoCIS bool
+
+func init() {
+	sysinfoCmd.Flags().BoolVar(&sysinfoCIS, "cis", false, "Report the CIS benchmark recommendations the cis hardening profile leaves to the administrator")
+	addPersistentFlags(sysinfoCmd)
+}
+
+var sysinfoCmd = &cobra.Command{
+	Use:   "sysinfo",
+	Short: "Display information about the host k0s is running on",
+	Long: `Displays the SELinux mode, the NUMA nodes and the pre-allocated hugepages of the host.
+
+With --cis the CIS Kubernetes Benchmark recommendations which the cis hardening profile cannot apply on its own are
+checked against the host and the cluster config, the items which cannot be checked automatically are listed as MANUAL.`,
+	Example: `	$ k0s sysinfo
+	$ k0s sysinfo --cis --config k0s.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if err := printSysinfo(); err != nil {
+			return err
+		}
+		if !sysinfoCIS {
+			return nil
+		}
+
+		clusterConfig, err := ConfigFromYaml(cfgFile)
+		if err != nil {
+			return err
+		}
+		items := sysinfo.CISManualItems(clusterConfig.Spec, k0sVars, sysinfo.ProcRoot)
+
+		fmt.Println()
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Status", "Recommendation", "Remediation"})
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetTablePadding("\t") // pad with tabs
+		table.SetNoWhiteSpace(true)
+		for _, item := range items {
+			table.Append(item.ToArray())
+		}
+		table.Render()
+		return nil
+	},
+}
+
+func printSysinfo() error {
+	mode, err := sysinfo.SELinuxMode(sysinfo.SysfsRoot)
+	if err != nil {
+		return fmt.Errorf("failed to probe SELinux mode: %v", err)
+	}
+	nodes, err := sysinfo.NUMANodes(sysinfo.SysfsRoot)
+	if err != nil {
+		return fmt.Errorf("failed to probe NUMA nodes: %v", err)
+	}
+	hugepages, err := sysinfo.Hugepages(sysinfo.SysfsRoot)
+	if err != nil {
+		return fmt.Errorf("failed to probe hugepages: %v", err)
+	}
+
+	fmt.Printf("SELinux: %s\n", mode)
+	fmt.Printf("NUMA nodes: %d\n", nodes)
+	sizes := make([]string, 0, len(hugepages))
+	for size := range hugepages {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+	for _, size := range sizes {
+		fmt.Printf("Hugepages %s: %d\n", size, hugepages[size])
+	}
+	return nil
+}
@@ -36,8 +36,15 @@ var (
 	kubeConfig  string
 	tokenExpiry string
 	tokenRole   string
+	tokenLabels []string
+	tokenTaints []string
 	waitCreate  bool
 
+	tokenAllowedCIDRs    []string
+	tokenAllowedNodeName string
+	tokenMaxUses         int
+	tokenStatic          string
+
 	// tokenCmd creates new token management command
 	tokenCmd = &cobra.Command{
 		Use:   "token",
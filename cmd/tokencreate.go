@@ -17,26 +17,32 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"html/template"
-	"io/ioutil"
 	"path/filepath"
 	"time"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/certificate"
 	"github.com/k0sproject/k0s/pkg/token"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/util/retry"
 )
 
 func init() {
 	tokenCreateCmd.Flags().StringVar(&tokenExpiry, "expiry", "0s", "Expiration time of the token. Format 1.5h, 2h45m or 300ms.")
 	tokenCreateCmd.Flags().StringVar(&tokenRole, "role", "worker", "Either worker or controller")
 	tokenCreateCmd.Flags().BoolVar(&waitCreate, "wait", false, "wait forever (default false)")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenLabels, "label", []string{}, "label to set on the nodes joining with the token, key=value. Worker tokens only")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenTaints, "taint", []string{}, "taint to set on the nodes joining with the token, key[=value]:Effect. Worker tokens only")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenAllowedCIDRs, "allowed-cidr", []string{}, "network the k0s join API accepts the token from, any network if not set")
+	tokenCreateCmd.Flags().StringVar(&tokenAllowedNodeName, "allowed-node-name", "", "glob pattern the name of the node joining through the k0s join API must match, e.g. edge-*")
+	tokenCreateCmd.Flags().IntVar(&tokenMaxUses, "max-uses", 0, "number of joins after which the token is invalidated, unlimited if 0")
+	tokenCreateCmd.Flags().StringVar(&tokenStatic, "static-token", "", "render the join token for a pre-shared token of the static token file instead of creating a new token")
 
 	addPersistentFlags(tokenCreateCmd)
 
@@ -59,6 +65,23 @@ contexts:
 - context:
     cluster: k0s
     user: {{.User}}
+{{- if not .Node.IsEmpty }}
+    extensions:
+    - name: {{.NodeExtension}}
+      extension:
+{{- if .Node.Labels }}
+        labels:
+{{- range .Node.Labels }}
+        - {{.}}
+{{- end }}
+{{- end }}
+{{- if .Node.Taints }}
+        taints:
+{{- range .Node.Taints }}
+        - {{.}}
+{{- end }}
+{{- end }}
+{{- end }}
   name: k0s
 current-context: k0s
 kind: Config
@@ -74,6 +97,10 @@ users:
 		Short: "Create join token",
 		Example: `k0s token create --role worker --expiry 100h //sets expiration time to 100 hours
 k0s token create --role worker --expiry 10m  //sets expiration time to 10 minutes
+k0s token create --role worker --label pool=edge --taint dedicated=edge:NoSchedule //sets the label and the taint on the joining nodes
+k0s token create --role controller --allowed-cidr 10.0.0.0/24 --allowed-node-name 'controller-*' //accepts the token only from 10.0.0.0/24 for nodes named controller-*
+k0s token create --role worker --max-uses 1 //the token can be used for joining a single node
+k0s token create --role worker --static-token abcdef.0123456789abcdef //renders the join token for a token of the static token file
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Disable logrus for token commands
@@ -87,21 +114,44 @@ k0s token create --role worker --expiry 10m  //sets expiration time to 10 minute
 			if err != nil {
 				return err
 			}
+			node := token.NodeMetadata{Labels: tokenLabels, Taints: tokenTaints}
+			if err := node.Validate(); err != nil {
+				return err
+			}
+			constraints := token.Constraints{SourceCIDRs: tokenAllowedCIDRs, NodeNamePattern: tokenAllowedNodeName}
+			if err := constraints.Validate(); err != nil {
+				return err
+			}
+
+			if tokenStatic != "" {
+				if cmd.Flags().Changed("expiry") || !node.IsEmpty() || !constraints.IsEmpty() || tokenMaxUses != 0 {
+					return fmt.Errorf("--static-token can't be combined with --expiry, --label, --taint, --allowed-cidr, --allowed-node-name or --max-uses")
+				}
+				if err := (token.StaticToken{Token: tokenStatic, Role: tokenRole}).Validate(); err != nil {
+					return err
+				}
+				bootstrapConfig, err := staticTokenBootstrapConfig(clusterConfig, tokenRole, tokenStatic)
+				if err != nil {
+					return err
+				}
+				fmt.Println(bootstrapConfig)
+				return nil
+			}
 
 			var bootstrapConfig string
 			// we will retry every second for two minutes and then error
-			err = retry.OnError(wait.Backoff{
-				Steps:    120,
-				Duration: 1 * time.Second,
+			err = retry.Do(context.Background(), "create join token", func() error {
+				bootstrapConfig, err = createKubeletBootstrapConfig(clusterConfig, tokenRole, expiry, node, constraints, tokenMaxUses)
+
+				return err
+			}, retry.WithBackoff(retry.Backoff{
+				Delay:    1 * time.Second,
 				Factor:   1.0,
 				Jitter:   0.1,
-			}, func(err error) bool {
+				Attempts: 120,
+			}), retry.If(func(err error) bool {
 				return waitCreate
-			}, func() error {
-				bootstrapConfig, err = createKubeletBootstrapConfig(clusterConfig, tokenRole, expiry)
-
-				return err
-			})
+			}))
 			if err != nil {
 				return err
 			}
@@ -113,29 +163,58 @@ k0s token create --role worker --expiry 10m  //sets expiration time to 10 minute
 	}
 )
 
-func createKubeletBootstrapConfig(clusterConfig *config.ClusterConfig, role string, expiry time.Duration) (string, error) {
-	caCert, err := ioutil.ReadFile(filepath.Join(k0sVars.CertRootDir, "ca.crt"))
+func createKubeletBootstrapConfig(clusterConfig *config.ClusterConfig, role string, expiry time.Duration, node token.NodeMetadata, constraints token.Constraints, maxUses int) (string, error) {
+	caCert, err := clusterCACert()
 	if err != nil {
-		msg := fmt.Sprintf("failed to read cluster ca certificate from %s. is the control plane initialized on this node?", filepath.Join(k0sVars.CertRootDir, "ca.crt"))
-		return "", errors.Wrapf(err, msg)
+		return "", err
+	}
+	caFingerprint, err := token.CAFingerprint(caCert)
+	if err != nil {
+		return "", err
 	}
 	manager, err := token.NewManager(filepath.Join(k0sVars.AdminKubeConfigPath))
 	if err != nil {
 		return "", err
 	}
-	tokenString, err := manager.Create(expiry, role)
+	tokenString, err := manager.Create(expiry, role, caFingerprint, node, constraints, maxUses)
 	if err != nil {
 		return "", err
 	}
+	return renderJoinToken(clusterConfig, role, caCert, tokenString, node)
+}
+
+// staticTokenBootstrapConfig renders the join token for a pre-shared token, the controllers provision the token itself from the static token file
+func staticTokenBootstrapConfig(clusterConfig *config.ClusterConfig, role string, tokenString string) (string, error) {
+	caCert, err := clusterCACert()
+	if err != nil {
+		return "", err
+	}
+	return renderJoinToken(clusterConfig, role, caCert, tokenString, token.NodeMetadata{})
+}
+
+func clusterCACert() ([]byte, error) {
+	caCert, err := certificate.TrustBundle(filepath.Join(k0sVars.CertRootDir, "ca.crt"))
+	if err != nil {
+		msg := fmt.Sprintf("failed to read cluster ca certificate from %s. is the control plane initialized on this node?", filepath.Join(k0sVars.CertRootDir, "ca.crt"))
+		return nil, errors.Wrapf(err, msg)
+	}
+	return caCert, nil
+}
+
+func renderJoinToken(clusterConfig *config.ClusterConfig, role string, caCert []byte, tokenString string, node token.NodeMetadata) (string, error) {
 	data := struct {
-		CACert  string
-		Token   string
-		User    string
-		JoinURL string
-		APIUrl  string
+		CACert        string
+		Token         string
+		User          string
+		JoinURL       string
+		APIUrl        string
+		Node          token.NodeMetadata
+		NodeExtension string
 	}{
-		CACert: base64.StdEncoding.EncodeToString(caCert),
-		Token:  tokenString,
+		CACert:        base64.StdEncoding.EncodeToString(caCert),
+		Token:         tokenString,
+		Node:          node,
+		NodeExtension: token.NodeMetadataExtension,
 	}
 	if role == "worker" {
 		data.User = "kubelet-bootstrap"
@@ -147,7 +226,7 @@ func createKubeletBootstrapConfig(clusterConfig *config.ClusterConfig, role stri
 
 	var buf bytes.Buffer
 
-	err = kubeconfigTemplate.Execute(&buf, &data)
+	err := kubeconfigTemplate.Execute(&buf, &data)
 	if err != nil {
 		return "", err
 	}
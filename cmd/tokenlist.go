@@ -16,24 +16,37 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/k0sproject/k0s/pkg/token"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	staleTokens     bool
+	tokenListOutput string
 )
 
 func init() {
 	tokenListCmd.Flags().StringVar(&tokenRole, "role", "", "Either worker,controller or empty for all roles")
+	tokenListCmd.Flags().BoolVar(&staleTokens, "stale", false, "List only the tokens which can no longer be used, because they have expired or were issued for a previous cluster CA")
+	tokenListCmd.Flags().StringVarP(&tokenListOutput, "out", "o", "", "sets type of output to json or yaml")
 }
 
 var (
 	tokenListCmd = &cobra.Command{
-		Use:     "list",
-		Short:   "List join tokens",
-		Example: `k0s token list --role worker // list worker tokens`,
+		Use:   "list",
+		Short: "List join tokens",
+		Example: `k0s token list --role worker // list worker tokens
+k0s token list --stale // list the tokens which can be invalidated
+k0s token list -o json // list the tokens with all their details as JSON`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			manager, err := token.NewManager(filepath.Join(k0sVars.AdminKubeConfigPath))
 			if err != nil {
@@ -44,14 +57,43 @@ var (
 			if err != nil {
 				return err
 			}
+			if staleTokens {
+				if tokens, err = filterStaleTokens(tokens); err != nil {
+					return err
+				}
+			}
+
+			switch tokenListOutput {
+			case "json":
+				// an empty list rather than null for the scripts
+				if tokens == nil {
+					tokens = []token.Token{}
+				}
+				jsn, err := json.MarshalIndent(tokens, "", "   ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jsn))
+				return nil
+			case "yaml":
+				ym, err := yaml.Marshal(tokens)
+				if err != nil {
+					return err
+				}
+				fmt.Print(string(ym))
+				return nil
+			case "":
+			default:
+				return fmt.Errorf("unsupported output format %q, use json or yaml", tokenListOutput)
+			}
+
 			if len(tokens) == 0 {
 				fmt.Println("No k0s join tokens found")
 				return nil
 			}
 
-			//fmt.Printf("Tokens: %v \n", tokens)
 			table := tablewriter.NewWriter(os.Stdout)
-			table.SetHeader([]string{"ID", "Role", "Expires at"})
+			table.SetHeader([]string{"ID", "Role", "Created at", "Expires at", "Uses left", "Labels", "Taints"})
 			table.SetAutoWrapText(false)
 			table.SetAutoFormatHeaders(true)
 			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
@@ -73,3 +115,24 @@ var (
 		},
 	}
 )
+
+// filterStaleTokens returns the tokens which have expired or were issued for a previous cluster CA
+func filterStaleTokens(tokens []token.Token) ([]token.Token, error) {
+	caCert, err := ioutil.ReadFile(filepath.Join(k0sVars.CertRootDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cluster CA certificate, is the control plane initialized on this node? %v", err)
+	}
+	caFingerprint, err := token.CAFingerprint(caCert)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var stale []token.Token
+	for _, t := range tokens {
+		if t.IsStale(caFingerprint, now) {
+			stale = append(stale, t)
+		}
+	}
+	return stale, nil
+}
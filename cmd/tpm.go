@@ -0,0 +1,59 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/k0sproject/k0s/pkg/tpm"
+)
+
+var tpmKeyHandle string
+
+func init() {
+	tpmFingerprintCmd.Flags().StringVar(&tpmKeyHandle, "tpm-key-handle", tpm.DefaultKeyHandle, "persistent handle of the TPM key")
+	tpmCmd.AddCommand(tpmFingerprintCmd)
+	addPersistentFlags(tpmCmd)
+}
+
+var tpmCmd = &cobra.Command{
+	Use:   "tpm",
+	Short: "TPM node attestation related commands",
+}
+
+var tpmFingerprintCmd = &cobra.Command{
+	Use:   "fingerprint",
+	Short: "Print the fingerprint of the TPM key the worker attests with",
+	Long: `Prints the fingerprint of the TPM key the worker attests with when started with --tpm-attestation.
+The machine is enrolled by creating a TPMEnrollment object with the fingerprint on the cluster.`,
+	Example: `	$ k0s tpm fingerprint
+	$ k0s tpm fingerprint --tpm-key-handle 0x81010003`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		key, err := tpm.LoadKey(tpmKeyHandle)
+		if err != nil {
+			return err
+		}
+		fingerprint, err := tpm.Fingerprint(key.Public())
+		if err != nil {
+			return err
+		}
+		fmt.Println(fingerprint)
+		return nil
+	},
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -26,6 +27,9 @@ import (
 )
 
 var (
+	validateStrict bool
+	validateOutput string
+
 	validateCmd = &cobra.Command{
 		Use:   "validate",
 		Short: "Helper command for validating the config file",
@@ -33,12 +37,41 @@ var (
 	validateConfigCmd = &cobra.Command{
 		Use:   "config",
 		Short: "Helper command for validating the config file",
-		Long: `Example:
-   k0s validate config --config path_to_config.yaml`,
+		Long: `Validates the ClusterConfig of the config file, which may have several YAML documents. The documents of
+other kinds than the k0s Cluster are skipped. The same checks are run as when the controller starts.
+
+Example:
+   k0s validate config --config path_to_config.yaml
+   k0s validate config --config path_to_config.yaml --strict --output json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := validateConfig(cfgFile)
+			if validateOutput != "text" && validateOutput != "json" {
+				return fmt.Errorf("invalid output format %q, must be text or json", validateOutput)
+			}
+			configs, errors, err := validateConfigDocuments(cfgFile, validateStrict)
 			if err != nil {
-				fmt.Println(err)
+				return err
+			}
+			if validateOutput == "json" {
+				if errors == nil {
+					errors = []config.ValidationError{}
+				}
+				out, err := json.MarshalIndent(errors, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(out))
+			} else {
+				for _, e := range errors {
+					fmt.Println(e.Error())
+				}
+			}
+			if len(errors) > 0 {
+				os.Exit(1)
+			}
+			if validateOutput == "text" {
+				for _, doc := range configs {
+					printDeviations(doc.Config)
+				}
 			}
 			return nil
 		},
@@ -46,28 +79,66 @@ var (
 )
 
 func init() {
+	validateConfigCmd.Flags().BoolVar(&validateStrict, "strict", false, "Reject the fields unknown to k0s")
+	validateConfigCmd.Flags().StringVarP(&validateOutput, "output", "o", "text", "Output format, text or json with the document, line and field of each error")
 	validateCmd.AddCommand(validateConfigCmd)
 	addPersistentFlags(validateConfigCmd)
 }
 
+// validateConfigDocuments validates all the ClusterConfig documents of the config file and returns the errors with their
+// locations, the worker profiles of the valid configs are validated too
+func validateConfigDocuments(cfgPath string, strict bool) ([]config.ConfigDocument, []config.ValidationError, error) {
+	if cfgPath == "" && len(cfgPatches) == 0 {
+		return []config.ConfigDocument{{Config: config.DefaultClusterConfig(k0sVars)}}, nil, nil
+	}
+	input, err := readConfigFile(cfgPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configs, errors := config.ValidateYAML(input, k0sVars, strict)
+	for _, doc := range configs {
+		for _, err := range validateWorkerProfiles(doc.Config) {
+			errors = append(errors, config.ValidationError{Document: doc.Index, Field: "spec.workerProfiles", Message: err.Error()})
+		}
+	}
+	return configs, errors, nil
+}
+
+// printDeviations lists what the preset and the hardening profile change, to make it easy to review the deviations
+// from the defaults
+func printDeviations(clusterConfig *config.ClusterConfig) {
+	for _, deviation := range clusterConfig.Spec.ApplyPreset() {
+		fmt.Printf("%s preset: %s\n", clusterConfig.Spec.Preset, deviation)
+	}
+	for _, deviation := range clusterConfig.Spec.ApplyHardening() {
+		fmt.Printf("%s hardening: %s\n", clusterConfig.Spec.Hardening.Profile, deviation)
+	}
+}
+
 // XXX: This is a duplication of the code under cmd/helpers.go ConfigFromYaml function.
 // XXX: we should fix this and remove the duplication
 func validateConfig(cfgPath string) (err error) {
 	var clusterConfig *config.ClusterConfig
 
-	if cfgPath == "" {
+	if cfgPath == "" && len(cfgPatches) == 0 {
 		// no config file exists, using defaults
 		clusterConfig = config.DefaultClusterConfig(k0sVars)
-	} else if isInputFromPipe() {
-		clusterConfig, err = config.FromYamlPipe(os.Stdin, k0sVars)
 	} else {
-		clusterConfig, err = config.FromYamlFile(cfgPath, k0sVars)
+		var yml string
+		if yml, err = readConfigFile(cfgPath); err != nil {
+			return err
+		}
+		clusterConfig, err = config.FromYamlString(yml, k0sVars)
 	}
 	if err != nil {
 		return err
 	}
 
 	errors := clusterConfig.Validate()
+	if len(errors) == 0 {
+		errors = validateWorkerProfiles(clusterConfig)
+	}
 	if len(errors) > 0 {
 		messages := make([]string, len(errors))
 		for _, e := range errors {
@@ -75,5 +146,6 @@ func validateConfig(cfgPath string) (err error) {
 		}
 		return fmt.Errorf(strings.Join(messages, "\n"))
 	}
+	printDeviations(clusterConfig)
 	return nil
 }
@@ -22,7 +22,9 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
@@ -31,11 +33,13 @@ import (
 	"github.com/sirupsen/logrus"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/internal/util"
 	"github.com/k0sproject/k0s/pkg/component"
 	"github.com/k0sproject/k0s/pkg/component/worker"
 	"github.com/k0sproject/k0s/pkg/constant"
 	"github.com/k0sproject/k0s/pkg/token"
+	"github.com/k0sproject/k0s/pkg/tpm"
 )
 
 func init() {
@@ -45,26 +49,44 @@ func init() {
 	workerCmd.Flags().StringVar(&cidrRange, "cidr-range", "10.96.0.0/12", "HACK: cidr range for the windows worker node")
 	workerCmd.Flags().StringVar(&clusterDNS, "cluster-dns", "10.96.0.10", "HACK: cluster dns for the windows worker node")
 	workerCmd.Flags().BoolVar(&cloudProvider, "enable-cloud-provider", false, "Whether or not to enable cloud provider support in kubelet")
+	workerCmd.Flags().BoolVar(&detectRuntimes, "detect-runtimes", false, "detect the container runtimes installed on the node, e.g. nvidia-container-runtime, and configure them in the k0s managed containerd")
 	workerCmd.Flags().StringVar(&tokenFile, "token-file", "", "Path to the file containing token.")
+	workerCmd.Flags().StringVar(&tokenSource, "token-source", "", fmt.Sprintf("cloud provider to read the join token from the instance user-data of on the first start, one of %s", strings.Join(token.CloudProviders, ", ")))
 	workerCmd.Flags().StringToStringVarP(&cmdLogLevels, "logging", "l", defaultLogLevels, "Logging Levels for the different components")
-	workerCmd.Flags().StringSliceVarP(&labels, "labels", "", []string{}, "Node labels, list of key=value pairs")
+	workerCmd.Flags().StringSliceVarP(&labels, "labels", "", []string{}, "Node labels, list of key=value pairs. The labels kubelet isn't allowed to set are set by the controllers if allowed by spec.nodeLabels")
+	workerCmd.Flags().StringSliceVar(&taints, "taints", []string{}, "Node taints, list of key[=value]:Effect taints set when registering the node")
 	workerCmd.Flags().StringVar(&kubeletExtraArgs, "kubelet-extra-args", "", "extra args for kubelet")
+	workerCmd.Flags().StringVar(&providerIDTemplate, "kubelet-provider-id-template", "", "template of the provider ID of the node, filled in from the instance metadata of the cloud provider of its scheme, e.g. aws:///{{.Zone}}/{{.InstanceID}}")
+	workerCmd.Flags().StringSliceVar(&imageBundles, "image-bundle", []string{}, "image bundle artifacts to pull from the registry and import on start, see k0s airgap push")
+	workerCmd.Flags().StringVar(&imageBundleAuthFile, "image-bundle-auth-file", "", "docker config.json with the credentials of the registry of the image bundle artifacts")
+	workerCmd.Flags().BoolVar(&tpmAttestation, "tpm-attestation", false, "attest the TPM key of the node when joining, see spec.csrApprover.tpmAttestation")
+	workerCmd.Flags().StringVar(&tpmKeyHandle, "tpm-key-handle", tpm.DefaultKeyHandle, "persistent handle of the TPM key to attest with")
+	workerCmd.Flags().BoolVar(&rootless, "rootless", false, "run the worker as a non-root user in a user namespace created with rootlesskit, the data dir defaults to ~/.local/share/k0s (experimental)")
+	addFIPSFlag(workerCmd)
 
 	installWorkerCmd.Flags().AddFlagSet(workerCmd.Flags())
 	addPersistentFlags(workerCmd)
 }
 
 var (
-	apiServer        string
-	cidrRange        string
-	cloudProvider    bool
-	clusterDNS       string
-	criSocket        string
-	labels           []string
-	tokenArg         string
-	tokenFile        string
-	workerProfile    string
-	kubeletExtraArgs string
+	apiServer           string
+	cidrRange           string
+	cloudProvider       bool
+	clusterDNS          string
+	criSocket           string
+	detectRuntimes      bool
+	imageBundles        []string
+	imageBundleAuthFile string
+	labels              []string
+	providerIDTemplate  string
+	rootless            bool
+	taints              []string
+	tokenArg            string
+	tokenFile           string
+	tokenSource         string
+	workerProfile       string
+	kubeletExtraArgs    string
+	tpmAttestation      bool
 
 	workerCmd = &cobra.Command{
 		Use:   "worker [join-token]",
@@ -75,8 +97,17 @@ var (
 
 	or CLI flag:
 	$ k0s worker --token-file [path_to_file]
-	Note: Token can be passed either as a CLI argument or as a flag`,
+	Note: Token can be passed either as a CLI argument or as a flag
+
+	or from the cloud instance user-data:
+	$ k0s worker --token-source aws`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if rootless {
+				if err := setupRootless(); err != nil {
+					return err
+				}
+			}
+
 			if len(args) > 0 {
 				tokenArg = args[0]
 			}
@@ -92,60 +123,215 @@ var (
 				}
 				tokenArg = string(bytes)
 			}
+
+			if tokenSource != "" {
+				if len(tokenArg) > 0 {
+					return fmt.Errorf("--token-source can't be used together with a join token")
+				}
+				// the token is only needed for the first join, after that kubelet has its own credentials
+				if !util.FileExists(k0sVars.KubeletAuthConfigPath) && !util.FileExists(k0sVars.KubeletBootstrapConfigPath) {
+					t, err := tokenFromCloudMetadata(tokenSource)
+					if err != nil {
+						return err
+					}
+					tokenArg = t
+				}
+			}
 			return startWorker(tokenArg)
 		},
 	}
 )
 
-func startWorker(token string) error {
+// tokenFromCloudMetadata reads the join token from the instance user-data, retrying for a while as the
+// metadata service may not be reachable yet right after the instance has booted
+func tokenFromCloudMetadata(provider string) (string, error) {
+	if !util.StringSliceContains(token.CloudProviders, provider) {
+		return "", fmt.Errorf("unsupported token source %q, must be one of %s", provider, strings.Join(token.CloudProviders, ", "))
+	}
+	var joinToken string
+	err := retry.Do(context.Background(), "read join token from "+provider+" instance metadata", func() error {
+		var err error
+		joinToken, err = token.FetchFromCloudMetadata(context.Background(), provider)
+		return err
+	})
+	return joinToken, err
+}
+
+// providerIDFromCloudMetadata renders the provider ID template, retrying for a while like tokenFromCloudMetadata
+func providerIDFromCloudMetadata(providerIDTemplate string) (string, error) {
+	if err := token.ValidateProviderIDTemplate(providerIDTemplate); err != nil {
+		return "", err
+	}
+	var providerID string
+	err := retry.Do(context.Background(), "render provider ID from instance metadata", func() error {
+		var err error
+		providerID, err = token.RenderProviderID(context.Background(), providerIDTemplate)
+		return err
+	})
+	return providerID, err
+}
+
+// setupRootless re-executes k0s in a user namespace unless it runs in one already, and defaults the data dir to
+// one writable by the user
+func setupRootless() error {
+	if !worker.InUserNamespace() {
+		// the data dir defaults are the same after the re-exec, the environment of the user is kept
+		return worker.ReexecRootless()
+	}
+	if dataDir == "" {
+		rootlessDataDir, err := worker.RootlessDataDir()
+		if err != nil {
+			return err
+		}
+		dataDir = rootlessDataDir
+		k0sVars = constant.GetConfigDirs(k0sDirs())
+	}
+	logrus.Infof("running rootless with data dir %s", k0sVars.DataDir)
+	return nil
+}
 
-	worker.KernelSetup()
-	if token == "" && !util.FileExists(k0sVars.KubeletAuthConfigPath) {
+func startWorker(joinToken string) error {
+	if fipsMode {
+		if err := fipsPreflight(nil, kubeletExtraArgs); err != nil {
+			return err
+		}
+	}
+
+	if err := checkWritableDirs(worker.WritableDirs(k0sVars, criSocket)); err != nil {
+		return err
+	}
+
+	// the kernel can't be tuned from a user namespace
+	if !rootless {
+		worker.KernelSetup()
+	}
+	if joinToken == "" && !util.FileExists(k0sVars.KubeletAuthConfigPath) {
 		return fmt.Errorf("normal kubelet kubeconfig does not exist and no join-token given. dunno how to make kubelet auth to api")
 	}
 
 	// Dump join token into kubelet-bootstrap kubeconfig if it does not already exist
-	if token != "" && !util.FileExists(k0sVars.KubeletBootstrapConfigPath) {
-		if err := handleKubeletBootstrapToken(token, k0sVars); err != nil {
+	if joinToken != "" && !util.FileExists(k0sVars.KubeletBootstrapConfigPath) {
+		if err := handleKubeletBootstrapToken(joinToken, k0sVars); err != nil {
 			return err
 		}
 	}
 
+	// the attestation has to be in place before kubelet requests its client certificate
+	if tpmAttestation && !util.FileExists(k0sVars.KubeletAuthConfigPath) {
+		if err := worker.AttestTPM(k0sVars, tpmKeyHandle); err != nil {
+			return errors.Wrap(err, "TPM attestation failed")
+		}
+	}
+
+	// the labels and taints of the join token are set by kubelet when registering the node
+	var nodeMetadata token.NodeMetadata
+	if util.FileExists(k0sVars.KubeletBootstrapConfigPath) {
+		kubeconfig, err := ioutil.ReadFile(k0sVars.KubeletBootstrapConfigPath)
+		if err != nil {
+			return err
+		}
+		if nodeMetadata, err = token.NodeMetadataFromKubeconfig(kubeconfig); err != nil {
+			return errors.Wrap(err, "invalid node labels or taints in join token")
+		}
+	}
+
+	if err := (token.NodeMetadata{Labels: labels, Taints: taints}).Validate(); err != nil {
+		return errors.Wrap(err, "invalid --labels or --taints")
+	}
+
+	// kubelet sets the provider ID only when registering the node, so a registered node can do without it
+	var providerID string
+	if providerIDTemplate != "" {
+		var err error
+		if providerID, err = providerIDFromCloudMetadata(providerIDTemplate); err != nil {
+			if !util.FileExists(k0sVars.KubeletAuthConfigPath) {
+				return errors.Wrap(err, "failed to render the provider ID")
+			}
+			logrus.WithError(err).Warn("failed to render the provider ID, starting kubelet without it")
+		} else {
+			logrus.Infof("using provider ID %s", providerID)
+		}
+	}
+
 	kubeletConfigClient, err := loadKubeletConfigClient(k0sVars)
 	if err != nil {
 		return err
 	}
 
 	componentManager := component.NewManager()
+	componentManager.TimingsPath = filepath.Join(k0sVars.RunDir, "worker-components.json")
 	if runtime.GOOS == "windows" && criSocket == "" {
 		return fmt.Errorf("windows worker needs to have external CRI")
 	}
-	if criSocket == "" {
-		componentManager.Add(&worker.ContainerD{
-			LogLevel: logging["containerd"],
-			K0sVars:  k0sVars,
-		})
+	if workerProfile == "default" && runtime.GOOS == "windows" {
+		workerProfile = "default-windows"
 	}
 
-	componentManager.Add(worker.NewOCIBundleReconciler(k0sVars))
+	var detectedRuntimes map[string]string
+	if detectRuntimes && criSocket == "" {
+		detectedRuntimes = worker.DetectContainerdRuntimes()
+		for name, binary := range detectedRuntimes {
+			logrus.Infof("detected container runtime %s at %s", name, binary)
+			if label, ok := worker.ContainerdRuntimeNodeLabels[name]; ok {
+				labels = append(labels, label)
+			}
+		}
+	}
 
-	if workerProfile == "default" && runtime.GOOS == "windows" {
-		workerProfile = "default-windows"
+	// kubelet refuses to start with labels like node-role.kubernetes.io/worker, the controllers set those
+	kubeletLabels, requestedLabels := worker.SplitNodeLabels(labels)
+
+	if criSocket == "" {
+		containerd := &worker.ContainerD{
+			LogLevel:            logging["containerd"],
+			K0sVars:             k0sVars,
+			KubeletConfigClient: kubeletConfigClient,
+			Profile:             workerProfile,
+			DetectedRuntimes:    detectedRuntimes,
+			Rootless:            rootless,
+		}
+		componentManager.Add(containerd)
+		componentManager.AddWithDeps(&worker.PeerMirror{
+			KubeletConfigClient: kubeletConfigClient,
+			Profile:             workerProfile,
+			K0sVars:             k0sVars,
+		}, containerd)
 	}
 
-	componentManager.Add(&worker.Kubelet{
+	ociBundleReconciler := worker.NewOCIBundleReconciler(k0sVars, criSocket)
+	ociBundleReconciler.BundleRefs = imageBundles
+	ociBundleReconciler.RegistryAuthFile = imageBundleAuthFile
+	componentManager.Add(ociBundleReconciler)
+
+	kubelet := &worker.Kubelet{
 		CRISocket:           criSocket,
 		EnableCloudProvider: cloudProvider,
 		K0sVars:             k0sVars,
 		KubeletConfigClient: kubeletConfigClient,
 		LogLevel:            logging["kubelet"],
 		Profile:             workerProfile,
-		Labels:              labels,
+		Labels:              append(kubeletLabels, nodeMetadata.Labels...),
+		Taints:              append(taints, nodeMetadata.Taints...),
+		RequestedLabels:     requestedLabels,
+		ProviderID:          providerID,
+		Rootless:            rootless,
 		ExtraArgs:           kubeletExtraArgs,
-	})
+		FIPS:                fipsMode,
+	}
+	componentManager.Add(kubelet)
+
+	componentManager.AddWithDeps(&worker.APIServerSANCheck{K0sVars: k0sVars}, kubelet)
+	componentManager.AddWithDeps(&worker.ImagePrePuller{K0sVars: k0sVars, CRISocket: criSocket, KubeletExtraArgs: kubeletExtraArgs}, kubelet)
+
+	if runtime.GOOS != "windows" {
+		componentManager.AddWithDeps(&worker.HostAliases{
+			KubeletConfigClient: kubeletConfigClient,
+			Profile:             workerProfile,
+		}, kubelet)
+	}
 
 	if runtime.GOOS == "windows" {
-		if token == "" {
+		if joinToken == "" {
 			return fmt.Errorf("no join-token given, which is required for windows bootstrap")
 		}
 		componentManager.Add(&worker.KubeProxy{
@@ -154,7 +340,8 @@ func startWorker(token string) error {
 			CIDRRange: cidrRange,
 		})
 		componentManager.Add(&worker.CalicoInstaller{
-			Token:      token,
+			K0sVars:    k0sVars,
+			Token:      joinToken,
 			APIAddress: apiServer,
 			CIDRRange:  cidrRange,
 			ClusterDNS: clusterDNS,
@@ -166,7 +353,9 @@ func startWorker(token string) error {
 		return err
 	}
 
-	worker.KernelSetup()
+	if !rootless {
+		worker.KernelSetup()
+	}
 
 	// Set up signal handling. Use buffered channel so we dont miss
 	// signals during startup
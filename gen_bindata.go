@@ -20,6 +20,8 @@ package main
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
@@ -42,10 +44,16 @@ type fileInfo struct {
 	Path         string
 	TempFile     string
 	Offset, Size int64
+	// Digest is the hex encoded SHA256 of the uncompressed file
+	Digest string
+	// Remote is set for the files left out of the binary and written to the bundle dir instead
+	Remote bool
 }
 
-func compressFiles(prefix string) []fileInfo {
+func compressFiles(prefix string, include, exclude map[string]bool, bundleDir string) []fileInfo {
 	var tmpFiles []fileInfo
+	var mu sync.Mutex
+	digests := make(map[string]string)
 
 	// compress the files
 	var wg sync.WaitGroup
@@ -55,17 +63,32 @@ func compressFiles(prefix string) []fileInfo {
 			log.Fatal(err)
 		}
 		for _, f := range files {
-			tmpf, err := ioutil.TempFile("", f.Name())
+			if len(include) > 0 && !include[f.Name()] {
+				continue
+			}
+			filePath := path.Join(dir, f.Name())
+			name := strings.TrimPrefix(filePath, prefix) + ".gz"
+
+			var tmpf *os.File
+			remote := exclude[f.Name()]
+			if remote {
+				// the bundle has the same layout as the embedded files
+				if err := os.MkdirAll(path.Join(bundleDir, path.Dir(name)), 0755); err != nil {
+					log.Fatal(err)
+				}
+				tmpf, err = os.Create(path.Join(bundleDir, name))
+			} else {
+				tmpf, err = ioutil.TempFile("", f.Name())
+			}
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			filePath := path.Join(dir, f.Name())
-			name := strings.TrimPrefix(filePath, prefix) + ".gz"
 			tmpFiles = append(tmpFiles, fileInfo{
 				Name:     name,
 				Path:     filePath,
 				TempFile: tmpf.Name(),
+				Remote:   remote,
 			})
 
 			gz, err := gzip.NewWriterLevel(tmpf, gzip.BestCompression)
@@ -80,10 +103,14 @@ func compressFiles(prefix string) []fileInfo {
 
 			wg.Add(1)
 			go func(wg *sync.WaitGroup) {
-				size, err := io.Copy(gz, inf)
+				h := sha256.New()
+				size, err := io.Copy(io.MultiWriter(gz, h), inf)
 				if err != nil {
 					log.Fatal(err)
 				}
+				mu.Lock()
+				digests[name] = hex.EncodeToString(h.Sum(nil))
+				mu.Unlock()
 
 				fi, err := tmpf.Stat()
 				if err != nil {
@@ -98,18 +125,43 @@ func compressFiles(prefix string) []fileInfo {
 		}
 	}
 	wg.Wait()
+	for i := range tmpFiles {
+		tmpFiles[i].Digest = digests[tmpFiles[i].Name]
+		if tmpFiles[i].Remote {
+			fi, err := os.Stat(tmpFiles[i].TempFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			tmpFiles[i].Size = fi.Size()
+		}
+	}
 	return tmpFiles
 }
 
+// nameSet returns the set of the comma separated names
+func nameSet(names string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
 func main() {
-	var prefix, pkg, outfile, gofile string
+	var prefix, pkg, outfile, gofile, include, exclude, bundleDir, tags string
 
-	var bindata []fileInfo
+	var bindata, remoteBindata []fileInfo
 
 	flag.StringVar(&prefix, "prefix", "", "Optional path prefix to strip off asset names.")
 	flag.StringVar(&pkg, "pkg", "main", "Package name to use in the generated code.")
 	flag.StringVar(&outfile, "o", "./bindata", "Optional name of the output file to be generated.")
 	flag.StringVar(&gofile, "gofile", "./bindata.go", "Optional name of the go file to be generated.")
+	flag.StringVar(&include, "include", "", "Optional comma separated names of the only files to process.")
+	flag.StringVar(&tags, "tags", "", "Optional build constraint of the go file to be generated.")
+	flag.StringVar(&exclude, "exclude", "", "Optional comma separated names of the files to leave out of the binary and write to the bundle dir.")
+	flag.StringVar(&bundleDir, "bundle-dir", "./bundle", "Optional name of the dir the bundle of the excluded files is written to.")
 	flag.Parse()
 
 	if flag.NArg() == 0 {
@@ -117,7 +169,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	tmpFiles := compressFiles(prefix)
+	tmpFiles := compressFiles(prefix, nameSet(include), nameSet(exclude), bundleDir)
 
 	outf, err := os.Create(outfile)
 	if err != nil {
@@ -129,6 +181,10 @@ func main() {
 
 	fmt.Fprintf(os.Stderr, "Writing %s...\n", outfile)
 	for _, t := range tmpFiles {
+		if t.Remote {
+			remoteBindata = append(remoteBindata, t)
+			continue
+		}
 		inf, err := os.Open(t.TempFile)
 		if err != nil {
 			log.Fatal(err)
@@ -155,32 +211,49 @@ func main() {
 	defer f.Close()
 
 	packageTemplate.Execute(f, struct {
-		OutFile     string
-		Pkg         string
-		BinData     []fileInfo
-		BinDataSize int64
+		Tags          string
+		OutFile       string
+		Pkg           string
+		BinData       []fileInfo
+		BinDataSize   int64
+		RemoteBinData []fileInfo
 	}{
-		OutFile:     outfile,
-		Pkg:         pkg,
-		BinData:     bindata,
-		BinDataSize: offset,
+		Tags:          tags,
+		OutFile:       outfile,
+		Pkg:           pkg,
+		BinData:       bindata,
+		BinDataSize:   offset,
+		RemoteBinData: remoteBindata,
 	})
 
 }
 
-var packageTemplate = template.Must(template.New("").Parse(`// Code generated by go generate; DO NOT EDIT.
+var packageTemplate = template.Must(template.New("").Parse(`{{ if .Tags }}// +build {{ .Tags }}
+
+{{ end }}// Code generated by go generate; DO NOT EDIT.
 
 // datafile: {{ .OutFile }}
 
 package {{ .Pkg }}
 
 var (
-	BinData = map[string]struct{ offset, size int64 }{
+	BinData = map[string]struct {
+		offset, size int64
+		digest       string
+	}{
 	{{ range .BinData }}
-		"{{ .Name }}": { {{ .Offset }}, {{ .Size }}}, {{ end }}
+		"{{ .Name }}": { {{ .Offset }}, {{ .Size }}, "{{ .Digest }}"}, {{ end }}
 	}
 
 	BinDataSize int64 = {{ .BinDataSize }}
+
+	RemoteBinData = map[string]struct {
+		size   int64
+		digest string
+	}{
+	{{ range .RemoteBinData }}
+		"{{ .Name }}": { {{ .Size }}, "{{ .Digest }}"}, {{ end }}
+	}
 )
 
 `))
@@ -3,11 +3,11 @@ module github.com/k0sproject/k0s
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/Masterminds/semver v1.5.0 // indirect
 	github.com/Masterminds/sprig v2.22.0+incompatible
 	github.com/Microsoft/hcsshim v0.8.7
 	github.com/asaskevich/govalidator v0.0.0-20200428143746-21a406dcc535
-	github.com/avast/retry-go v2.6.0+incompatible
 	github.com/cloudflare/cfssl v1.4.1
 	github.com/containerd/containerd v1.4.1
 	github.com/denisbrodbeck/machineid v1.0.1
@@ -15,6 +15,7 @@ require (
 	github.com/docker/libnetwork v0.5.6
 	github.com/evanphx/json-patch v4.9.0+incompatible
 	github.com/fatih/color v1.10.0 // indirect
+	github.com/godbus/dbus/v5 v5.0.3
 	github.com/gogo/googleapis v1.4.0 // indirect
 	github.com/gorilla/mux v1.8.0
 	github.com/huandu/xstrings v1.3.2 // indirect
@@ -31,8 +32,11 @@ require (
 	github.com/olekukonko/tablewriter v0.0.2
 	github.com/onsi/ginkgo v1.14.1 // indirect
 	github.com/onsi/gomega v1.10.2 // indirect
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.1
 	github.com/opencontainers/selinux v1.8.0 // indirect
 	github.com/pkg/errors v0.9.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rogpeppe/go-internal v1.6.1 // indirect
 	github.com/segmentio/analytics-go v3.1.0+incompatible
 	github.com/sirupsen/logrus v1.7.0
@@ -61,8 +65,10 @@ require (
 	k8s.io/client-go v0.20.5
 	k8s.io/kube-aggregator v0.20.5
 	k8s.io/kubectl v0.20.2
+	k8s.io/kubelet v0.20.5
 	k8s.io/mount-utils v0.20.4
 	k8s.io/utils v0.0.0-20201110183641-67b214c5f920
+	sigs.k8s.io/kustomize v2.0.3+incompatible
 )
 
 // We need to force to a git commit of 3.4.13 release, see https://github.com/etcd-io/etcd/issues/12109
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configsource reads the k0s config from a file, the stdin or a URL and verifies its checksum and signature
+package configsource
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/retry"
+)
+
+// Stdin is the config source reading the config from the standard input
+const Stdin = "-"
+
+// SignatureSuffix is appended to the config URL to get the URL of its detached signature
+const SignatureSuffix = ".sig"
+
+// Options are the ways to verify the config read
+type Options struct {
+	// SHA256 is the hex encoded checksum the config must have, not checked if empty
+	SHA256 string
+	// PublicKeyPath is the path of a PEM encoded ed25519 public key. If set, the config must have a valid base64 encoded
+	// detached signature made with the private key, fetched from the config URL with SignatureSuffix appended.
+	PublicKeyPath string
+	// Stdin is the reader used for the Stdin source, os.Stdin if nil
+	Stdin io.Reader
+}
+
+// IsRemote tells if the config source is a URL
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// Read reads the config from the source, which is a file path, Stdin or a http(s) URL, and verifies it. Plain http
+// is only allowed when the config is verified with a checksum or a signature.
+func Read(ctx context.Context, source string, opts Options) ([]byte, error) {
+	var content []byte
+	var err error
+	switch {
+	case source == Stdin:
+		stdin := opts.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		content, err = ioutil.ReadAll(stdin)
+	case IsRemote(source):
+		if strings.HasPrefix(source, "http://") && opts.SHA256 == "" && opts.PublicKeyPath == "" {
+			return nil, fmt.Errorf("config from plain http URL %s must be verified with a checksum or a signature", source)
+		}
+		content, err = fetch(ctx, source)
+	default:
+		if opts.PublicKeyPath != "" {
+			return nil, fmt.Errorf("config signatures can only be verified for URLs")
+		}
+		content, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config from %s: %w", source, err)
+	}
+
+	if opts.SHA256 != "" {
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), opts.SHA256) {
+			return nil, fmt.Errorf("config from %s doesn't match the sha256 checksum %s", source, opts.SHA256)
+		}
+	}
+	if opts.PublicKeyPath != "" {
+		if err := verifySignature(ctx, source, content, opts.PublicKeyPath); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// fetch gets the URL, retrying the failures which may be temporary
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	var content []byte
+	err := retry.Do(ctx, "fetch config", func() error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return retry.Unrecoverable(err)
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err := fmt.Errorf("unexpected response status: %s", resp.Status)
+			if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return retry.Unrecoverable(err)
+			}
+			return err
+		}
+		content, err = ioutil.ReadAll(resp.Body)
+		return err
+	}, retry.Attempts(5))
+	return content, err
+}
+
+// verifySignature checks the detached signature of the config against the public key
+func verifySignature(ctx context.Context, source string, content []byte, publicKeyPath string) error {
+	keyPEM, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config signing key: %w", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("config signing key %s is not PEM encoded", publicKeyPath)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse config signing key: %w", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("config signing key %s is not an ed25519 key", publicKeyPath)
+	}
+
+	encoded, err := fetch(ctx, source+SignatureSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("config signature is not base64 encoded: %w", err)
+	}
+	if !ed25519.Verify(publicKey, content, signature) {
+		return fmt.Errorf("config from %s doesn't match its signature", source)
+	}
+	return nil
+}
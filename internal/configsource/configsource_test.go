@@ -0,0 +1,114 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package configsource
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = "spec:\n  api:\n    address: 10.0.0.1\n"
+
+func TestReadStdinAndFile(t *testing.T) {
+	content, err := Read(context.TODO(), Stdin, Options{Stdin: strings.NewReader(testConfig)})
+	require.NoError(t, err)
+	assert.Equal(t, testConfig, string(content))
+
+	dir, err := ioutil.TempDir("", "configsource")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "k0s.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testConfig), 0600))
+
+	sum := sha256.Sum256([]byte(testConfig))
+	content, err = Read(context.TODO(), path, Options{SHA256: hex.EncodeToString(sum[:])})
+	require.NoError(t, err)
+	assert.Equal(t, testConfig, string(content))
+
+	_, err = Read(context.TODO(), path, Options{SHA256: strings.Repeat("0", 64)})
+	assert.Error(t, err)
+}
+
+func TestReadURL(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(testConfig)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/k0s.yaml":
+			_, _ = w.Write([]byte(testConfig))
+		case "/k0s.yaml" + SignatureSuffix:
+			_, _ = w.Write([]byte(signature + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	url := server.URL + "/k0s.yaml"
+
+	dir, err := ioutil.TempDir("", "configsource")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	t.Run("plain_http_needs_verification", func(t *testing.T) {
+		_, err := Read(context.TODO(), url, Options{})
+		assert.Error(t, err)
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		content, err := Read(context.TODO(), url, Options{PublicKeyPath: keyPath})
+		require.NoError(t, err)
+		assert.Equal(t, testConfig, string(content))
+	})
+
+	t.Run("wrong_key", func(t *testing.T) {
+		otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKIXPublicKey(otherKey)
+		require.NoError(t, err)
+		otherKeyPath := filepath.Join(dir, "other.pem")
+		require.NoError(t, ioutil.WriteFile(otherKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+		_, err = Read(context.TODO(), url, Options{PublicKeyPath: otherKeyPath})
+		assert.Error(t, err)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		_, err := Read(context.TODO(), server.URL+"/missing.yaml", Options{SHA256: strings.Repeat("0", 64)})
+		assert.Error(t, err)
+	})
+}
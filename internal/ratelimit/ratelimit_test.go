@@ -0,0 +1,61 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := New(60, 2)
+	l.now = func() time.Time { return now }
+
+	allowed, _ := l.Allow("10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("10.0.0.1")
+	assert.True(t, allowed)
+	allowed, wait := l.Allow("10.0.0.1")
+	assert.False(t, allowed, "burst should be used up")
+	assert.Equal(t, time.Second, wait)
+
+	// the other clients are not affected
+	allowed, _ = l.Allow("10.0.0.2")
+	assert.True(t, allowed)
+
+	now = now.Add(time.Second)
+	allowed, _ = l.Allow("10.0.0.1")
+	assert.True(t, allowed, "a token should have been refilled")
+	allowed, _ = l.Allow("10.0.0.1")
+	assert.False(t, allowed)
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := New(60, 5)
+	l.now = func() time.Time { return now }
+
+	l.Allow("10.0.0.1")
+	l.Allow("10.0.0.2")
+	assert.Len(t, l.buckets, 2)
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("10.0.0.3")
+	assert.Len(t, l.buckets, 1)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package retry provides the jittered exponential backoff used for retrying operations across k0s
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Backoff describes how the delay between attempts grows
+type Backoff struct {
+	// Delay is the delay after the first failed attempt
+	Delay time.Duration
+	// MaxDelay caps the delay between attempts, zero means no cap
+	MaxDelay time.Duration
+	// Factor multiplies the delay after each failed attempt
+	Factor float64
+	// Jitter adds a random delay of up to Jitter*delay to each delay
+	Jitter float64
+	// Attempts is the maximum number of attempts, zero means retrying until the context is done
+	Attempts int
+}
+
+// DefaultBackoff gives up after 10 attempts, roughly three minutes
+var DefaultBackoff = Backoff{
+	Delay:    500 * time.Millisecond,
+	MaxDelay: 1 * time.Minute,
+	Factor:   2.0,
+	Jitter:   0.1,
+	Attempts: 10,
+}
+
+// delay returns the delay after the given failed attempt, starting from 1
+func (b Backoff) delay(attempt int) time.Duration {
+	d := float64(b.Delay)
+	for i := 1; i < attempt; i++ {
+		d *= b.Factor
+		if b.MaxDelay > 0 && d > float64(b.MaxDelay) {
+			d = float64(b.MaxDelay)
+			break
+		}
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+type config struct {
+	backoff Backoff
+	retryIf func(error) bool
+	onRetry func(attempt int, err error)
+}
+
+// Option customizes a single Do call
+type Option func(*config)
+
+// WithBackoff replaces the DefaultBackoff
+func WithBackoff(b Backoff) Option {
+	return func(c *config) {
+		c.backoff = b
+	}
+}
+
+// Attempts sets the maximum number of attempts, zero means retrying until the context is done
+func Attempts(n int) Option {
+	return func(c *config) {
+		c.backoff.Attempts = n
+	}
+}
+
+// Delay sets the delay after the first failed attempt
+func Delay(d time.Duration) Option {
+	return func(c *config) {
+		c.backoff.Delay = d
+	}
+}
+
+// Factor sets the factor the delay grows by after each failed attempt, 1.0 gives a constant delay
+func Factor(f float64) Option {
+	return func(c *config) {
+		c.backoff.Factor = f
+	}
+}
+
+// If retries only the errors for which the given function returns true
+func If(retryIf func(error) bool) Option {
+	return func(c *config) {
+		c.retryIf = retryIf
+	}
+}
+
+// OnRetry calls the given function after each failed attempt that is going to be retried
+func OnRetry(onRetry func(attempt int, err error)) Option {
+	return func(c *config) {
+		c.onRetry = onRetry
+	}
+}
+
+type unrecoverableError struct {
+	error
+}
+
+func (e unrecoverableError) Unwrap() error {
+	return e.error
+}
+
+// Unrecoverable wraps an error so that Do returns it right away instead of retrying
+func Unrecoverable(err error) error {
+	return unrecoverableError{err}
+}
+
+// Do calls fn until it succeeds, the attempts run out, the error is not retryable or ctx is done.
+// The name identifies the operation in the logs and the metrics.
+func Do(ctx context.Context, name string, fn func() error, opts ...Option) error {
+	c := config{backoff: DefaultBackoff}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	start := time.Now()
+	attempt := 0
+	var err error
+	defer func() {
+		record(name, attempt, err, time.Since(start))
+	}()
+
+	for {
+		attempt++
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		var unrecoverable unrecoverableError
+		if errors.As(err, &unrecoverable) {
+			err = unrecoverable.error
+			return err
+		}
+		if c.retryIf != nil && !c.retryIf(err) {
+			return err
+		}
+		if c.backoff.Attempts > 0 && attempt >= c.backoff.Attempts {
+			return err
+		}
+
+		if c.onRetry != nil {
+			c.onRetry(attempt, err)
+		}
+		logrus.WithField("retry", name).WithError(err).Debugf("attempt %d failed, retrying", attempt)
+
+		timer := time.NewTimer(c.backoff.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Metrics are the accumulated statistics of the Do calls with the same name
+type Metrics struct {
+	// Calls is the number of Do calls
+	Calls int
+	// Attempts is the total number of attempts over all calls
+	Attempts int
+	// Failures is the number of calls that gave up with an error
+	Failures int
+	// LastError is the error of the latest call that gave up, if any
+	LastError error
+	// LastDuration is the duration of the latest call
+	LastDuration time.Duration
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   = map[string]Metrics{}
+)
+
+func record(name string, attempts int, err error, duration time.Duration) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	m := metrics[name]
+	m.Calls++
+	m.Attempts += attempts
+	m.LastDuration = duration
+	if err != nil {
+		m.Failures++
+		m.LastError = err
+	}
+	metrics[name] = m
+}
+
+// Snapshot returns a copy of the metrics collected so far, keyed by the operation name
+func Snapshot() map[string]Metrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	snapshot := make(map[string]Metrics, len(metrics))
+	for name, m := range metrics {
+		snapshot[name] = m
+	}
+	return snapshot
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Delay: time.Second, MaxDelay: 5 * time.Second, Factor: 2.0}
+	assert.Equal(t, time.Second, b.delay(1))
+	assert.Equal(t, 2*time.Second, b.delay(2))
+	assert.Equal(t, 4*time.Second, b.delay(3))
+	assert.Equal(t, 5*time.Second, b.delay(4))
+	assert.Equal(t, 5*time.Second, b.delay(100))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.delay(1)
+		assert.True(t, d >= time.Second && d <= 1500*time.Millisecond, "delay %s out of range", d)
+	}
+}
+
+func fastBackoff(attempts int) Option {
+	return WithBackoff(Backoff{Delay: time.Millisecond, Factor: 1.0, Attempts: attempts})
+}
+
+func TestDo(t *testing.T) {
+	t.Run("succeeds after failures", func(t *testing.T) {
+		calls := 0
+		retried := 0
+		err := Do(context.Background(), t.Name(), func() error {
+			calls++
+			if calls < 3 {
+				return fmt.Errorf("attempt %d", calls)
+			}
+			return nil
+		}, fastBackoff(5), OnRetry(func(int, error) { retried++ }))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, 2, retried)
+
+		m := Snapshot()[t.Name()]
+		assert.Equal(t, Metrics{Calls: 1, Attempts: 3, LastDuration: m.LastDuration}, m)
+	})
+
+	t.Run("gives up after attempts", func(t *testing.T) {
+		calls := 0
+		err := Do(context.Background(), t.Name(), func() error {
+			calls++
+			return fmt.Errorf("attempt %d", calls)
+		}, fastBackoff(4))
+		assert.EqualError(t, err, "attempt 4")
+		assert.Equal(t, 4, calls)
+
+		m := Snapshot()[t.Name()]
+		assert.Equal(t, 1, m.Failures)
+		assert.Equal(t, 4, m.Attempts)
+		assert.EqualError(t, m.LastError, "attempt 4")
+	})
+
+	t.Run("stops on unrecoverable errors", func(t *testing.T) {
+		calls := 0
+		fatal := errors.New("fatal")
+		err := Do(context.Background(), t.Name(), func() error {
+			calls++
+			return Unrecoverable(fatal)
+		}, fastBackoff(5))
+		assert.Equal(t, fatal, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("retries only matching errors", func(t *testing.T) {
+		calls := 0
+		err := Do(context.Background(), t.Name(), func() error {
+			calls++
+			return fmt.Errorf("attempt %d", calls)
+		}, fastBackoff(5), If(func(err error) bool { return err.Error() == "attempt 1" }))
+		assert.EqualError(t, err, "attempt 2")
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := Do(ctx, t.Name(), func() error {
+			calls++
+			cancel()
+			return errors.New("failed")
+		}, Attempts(0), Delay(time.Hour))
+		assert.EqualError(t, err, "failed")
+		assert.Equal(t, 1, calls)
+	})
+}
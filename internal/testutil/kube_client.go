@@ -1,8 +1,11 @@
 package testutil
 
 import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
 	discoveryfake "k8s.io/client-go/discovery/fake"
@@ -25,11 +28,15 @@ func NewFakeClientFactory(objects ...runtime.Object) FakeClientFactory {
 		{Group: "", Version: "v1", Resource: "nodes"}:                                         "NodeList",
 		{Group: "", Version: "v1", Resource: "configmaps"}:                                    "ConfigMapList",
 		{Group: "certificates.k8s.io", Version: "v1", Resource: "certificatesigningrequests"}: "CertificateSigningRequestList",
+		{Group: "attestation.k0sproject.io", Version: "v1beta1", Resource: "tpmenrollments"}:  "TPMEnrollmentList",
 	}
 
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), gvkLists)
+	dynamicClient.PrependReactor("patch", "*", serverSideApplyReactor(dynamicClient.Tracker()))
+
 	return FakeClientFactory{
 		Client:          fake.NewSimpleClientset(objects...),
-		DynamicClient:   dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), gvkLists),
+		DynamicClient:   dynamicClient,
 		DiscoveryClient: memory.NewMemCacheClient(rawDiscovery),
 		RawDiscovery:    rawDiscovery,
 	}
@@ -53,3 +60,26 @@ func (f FakeClientFactory) GetDynamicClient() (dynamic.Interface, error) {
 func (f FakeClientFactory) GetDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
 	return f.DiscoveryClient, nil
 }
+
+// serverSideApplyReactor handles the server-side apply patches the fake clients don't support by replacing the whole
+// object, without any field management
+func serverSideApplyReactor(tracker kubetesting.ObjectTracker) kubetesting.ReactionFunc {
+	return func(action kubetesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(kubetesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		_, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if apierrors.IsNotFound(err) {
+			return true, obj, tracker.Create(patch.GetResource(), obj, patch.GetNamespace())
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		return true, obj, tracker.Update(patch.GetResource(), obj, patch.GetNamespace())
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/user"
+	"strings"
 )
 
 // IsDirectory check the given path exists and is a directory
@@ -61,6 +62,33 @@ func InitDirectory(path string, perm os.FileMode) error {
 	return nil
 }
 
+// CheckWritableDirs creates the missing directories and checks that files can be created in them. The error lists
+// all the directories failing the check.
+func CheckWritableDirs(dirs []string, perm os.FileMode) error {
+	var failed []string
+	for _, dir := range dirs {
+		if err := checkWritableDir(dir, perm); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", dir, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("directories not writable: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func checkWritableDir(dir string, perm os.FileMode) error {
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".k0s-write-check-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // HomeDir fetches the running user's home directory, regardless of Sudo
 func HomeDir() (string, error) {
 	var runUser string
@@ -0,0 +1,50 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckWritableDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-writable")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the missing dirs are created
+	run := filepath.Join(dir, "run", "k0s")
+	assert.NoError(t, CheckWritableDirs([]string{dir, run}, 0755))
+	assert.True(t, IsDirectory(run))
+	files, err := ioutil.ReadDir(run)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	// a file in the way of the dirs can't be written as root either
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	err = CheckWritableDirs([]string{dir, filepath.Join(file, "bin"), filepath.Join(file, "run")}, 0755)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(file, "bin"))
+	assert.Contains(t, err.Error(), filepath.Join(file, "run"))
+	assert.NotContains(t, err.Error(), dir+":")
+}
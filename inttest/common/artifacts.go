@@ -0,0 +1,124 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	artifactsDirEnv     = "K0S_INTTEST_ARTIFACTS_DIR"
+	defaultArtifactsDir = "/tmp/k0s-inttest-artifacts"
+)
+
+// artifactsDir returns the directory the artifacts of the suite are collected to
+func (s *FootlooseSuite) artifactsDir() string {
+	root := os.Getenv(artifactsDirEnv)
+	if root == "" {
+		root = defaultArtifactsDir
+	}
+	return path.Join(root, s.T().Name())
+}
+
+// collectArtifacts gathers the k0s logs, status and etcd health of each node and the kube-system pod descriptions
+// and logs into the artifacts directory after a failed suite. The layout is described in inttest/README.md.
+func (s *FootlooseSuite) collectArtifacts(nodes []string) {
+	dir := s.artifactsDir()
+	s.T().Logf("collecting the artifacts of the failed suite to %s", dir)
+
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			s.collectNodeArtifacts(node, path.Join(dir, node))
+		}(node)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.collectKubeSystemArtifacts(path.Join(dir, "kube-system"))
+	}()
+	wg.Wait()
+}
+
+func (s *FootlooseSuite) collectNodeArtifacts(node string, dir string) {
+	ssh, err := s.SSH(node)
+	if err != nil {
+		s.T().Logf("failed to ssh to node %s to collect artifacts: %s", node, err)
+		return
+	}
+	defer ssh.Disconnect()
+
+	s.writeArtifact(ssh, dir, "k0s.log", "cat /tmp/k0s-*.log")
+	s.writeArtifact(ssh, dir, "status.json", "k0s status -o json")
+	if strings.HasPrefix(node, "controller") {
+		s.writeArtifact(ssh, dir, "etcd-health.txt", fmt.Sprintf("k0s etcd health %s && k0s etcd member-list %s", s.dataDirFlag(), s.dataDirFlag()))
+	}
+}
+
+func (s *FootlooseSuite) collectKubeSystemArtifacts(dir string) {
+	ssh, err := s.SSH("controller0")
+	if err != nil {
+		s.T().Logf("failed to ssh to controller0 to collect kube-system artifacts: %s", err)
+		return
+	}
+	defer ssh.Disconnect()
+
+	kubectl := "k0s kubectl -n kube-system"
+	if s.dataDir != "" {
+		kubectl = fmt.Sprintf("k0s kubectl --kubeconfig=%s -n kube-system", path.Join(s.dataDir, "pki/admin.conf"))
+	}
+	s.writeArtifact(ssh, dir, "pods.txt", kubectl+" describe pods")
+
+	pods, err := ssh.ExecWithOutput(kubectl + " get pods -o name")
+	if err != nil {
+		s.T().Logf("failed to list kube-system pods: %s", err)
+		return
+	}
+	for _, pod := range strings.Fields(pods) {
+		name := strings.TrimPrefix(pod, "pod/")
+		s.writeArtifact(ssh, dir, name+".log", fmt.Sprintf("%s logs --all-containers %s", kubectl, name))
+	}
+}
+
+// writeArtifact runs cmd on the node and writes its output to dir/name. The output is written even if the command fails,
+// with the error appended, as it's usually what explains the failure.
+func (s *FootlooseSuite) writeArtifact(ssh *SSHConnection, dir string, name string, cmd string) {
+	output, err := ssh.ExecWithOutput(cmd)
+	if err != nil {
+		output = fmt.Sprintf("%s\n%q failed: %s", output, cmd, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.T().Logf("failed to create artifacts directory %s: %s", dir, err)
+		return
+	}
+	if err := ioutil.WriteFile(path.Join(dir, name), []byte(output), 0644); err != nil {
+		s.T().Logf("failed to write artifact %s: %s", path.Join(dir, name), err)
+	}
+}
+
+func (s *FootlooseSuite) dataDirFlag() string {
+	if s.dataDir == "" {
+		return ""
+	}
+	return "--data-dir=" + s.dataDir
+}
@@ -24,15 +24,18 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v2"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/internal/util"
 	"github.com/k0sproject/k0s/pkg/constant"
 
@@ -52,7 +55,13 @@ type FootlooseSuite struct {
 	ControllerCount int
 	WorkerCount     int
 	ExtraVolumes    []config.Volume
-	tearDownTimer   *time.Timer
+	// ReuseCluster makes InitCluster set up the cluster only once, the later tests of the suite get the already running cluster
+	ReuseCluster  bool
+	tearDownTimer *time.Timer
+
+	clusterInitialized bool
+	// dataDir is the data dir of the main controller, used when collecting artifacts
+	dataDir string
 
 	footlooseConfig config.Config
 
@@ -102,14 +111,11 @@ func (s *FootlooseSuite) SetupSuite() {
 	}()
 
 	// SSH through cluster should wait until we actually can get it through, but it doesn't
-	for i := 0; i < 20; i++ {
-		err = s.Cluster.SSH("controller0", "root", "hostname")
-		if err == nil {
-			break
-		}
+	err = retry.Do(context.Background(), "ssh to controller0", func() error {
+		return s.Cluster.SSH("controller0", "root", "hostname")
+	}, retry.Attempts(20), retry.Delay(300*time.Millisecond), retry.Factor(1.0), retry.OnRetry(func(int, error) {
 		s.T().Logf("retrying ssh to controller0")
-		time.Sleep(300 * time.Millisecond)
-	}
+	}))
 	if err != nil {
 		s.FailNowf("failed to ssh to controller0: %s", err.Error())
 		s.T().FailNow()
@@ -131,22 +137,23 @@ func (s *FootlooseSuite) TearDownSuite() {
 		s.T().Logf("failed to inspect footloose cluster")
 	}
 
-	for _, m := range machines {
-		ssh, err := s.SSH(m.Hostname())
-		if err != nil {
-			s.T().Logf("failed to ssh to node %s to get logs", m.Hostname())
-			continue
-		}
-		log, err := ssh.ExecWithOutput("cat /tmp/k0s-*.log")
-		if err != nil {
-			s.T().Logf("failed to cat logs on machine %s: %s", m.Hostname(), err)
-		}
-		logPath := path.Join("/tmp", fmt.Sprintf("%s.log", m.Hostname()))
-		if err := ioutil.WriteFile(logPath, []byte(log), 0700); err != nil {
-			s.T().Logf("failed to save logs from machine %s: %s", m.Hostname(), err)
-		}
+	nodes := make([]string, len(machines))
+	for i, m := range machines {
+		nodes[i] = m.Hostname()
+	}
 
-		s.T().Logf("wrote log of node %s to %s", m.Hostname(), logPath)
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			s.collectNodeLogs(node)
+		}(node)
+	}
+	wg.Wait()
+
+	if s.T().Failed() {
+		s.collectArtifacts(nodes)
 	}
 
 	if s.keepEnvironment() {
@@ -176,6 +183,58 @@ func (s *FootlooseSuite) TearDownSuite() {
 
 }
 
+// collectNodeLogs writes the k0s logs of the node to /tmp/<node>.log
+func (s *FootlooseSuite) collectNodeLogs(node string) {
+	ssh, err := s.SSH(node)
+	if err != nil {
+		s.T().Logf("failed to ssh to node %s to get logs", node)
+		return
+	}
+	defer ssh.Disconnect()
+	log, err := ssh.ExecWithOutput("cat /tmp/k0s-*.log")
+	if err != nil {
+		s.T().Logf("failed to cat logs on machine %s: %s", node, err)
+	}
+	logPath := path.Join("/tmp", fmt.Sprintf("%s.log", node))
+	if err := ioutil.WriteFile(logPath, []byte(log), 0700); err != nil {
+		s.T().Logf("failed to save logs from machine %s: %s", node, err)
+	}
+
+	s.T().Logf("wrote log of node %s to %s", node, logPath)
+}
+
+// logNodeFailure shows the tail of the k0s logs of a node which failed to start, so that concurrent failures can be told apart
+func (s *FootlooseSuite) logNodeFailure(node string) {
+	ssh, err := s.SSH(node)
+	if err != nil {
+		s.T().Logf("failed to ssh to node %s to get logs", node)
+		return
+	}
+	defer ssh.Disconnect()
+	log, err := ssh.ExecWithOutput("tail -n 50 /tmp/k0s-*.log")
+	if err != nil {
+		s.T().Logf("failed to get logs of node %s: %s", node, err)
+		return
+	}
+	s.T().Logf("%s failed to start, last lines of its k0s logs:\n%s", node, log)
+}
+
+// onNodes runs fn concurrently on the given nodes and returns the first error
+func (s *FootlooseSuite) onNodes(nodes []string, fn func(node string) error) error {
+	var eg errgroup.Group
+	for _, node := range nodes {
+		node := node
+		eg.Go(func() error {
+			if err := fn(node); err != nil {
+				s.logNodeFailure(node)
+				return fmt.Errorf("%s: %v", node, err)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
 const keepAfterTestsEnv = "K0S_KEEP_AFTER_TESTS"
 
 func (s *FootlooseSuite) keepEnvironment() bool {
@@ -230,18 +289,59 @@ func (s *FootlooseSuite) InitMainController(k0sArgs []string) error {
 		s.T().Logf("failed to execute '%s' on %s", startCmd, controllerNode)
 		return err
 	}
-	return s.WaitForKubeAPI(controllerNode, getDataDir(k0sArgs))
+	s.dataDir = getDataDir(k0sArgs)
+	return s.WaitForKubeAPI(controllerNode, s.dataDir)
+}
+
+// InitCluster initializes the main controller and then joins the other controllers and the workers concurrently.
+// The controllers join one at a time as etcd only accepts a new member once the previous one has started.
+// The controller args must be valid on all the controllers, the data dir is taken from them.
+func (s *FootlooseSuite) InitCluster(controllerArgs []string, workerArgs ...string) error {
+	dataDir := getDataDir(controllerArgs)
+	if s.ReuseCluster && s.clusterInitialized {
+		s.T().Log("reusing the already initialized cluster")
+		return s.WaitForKubeAPI("controller0", dataDir)
+	}
+
+	if err := s.InitMainController(controllerArgs); err != nil {
+		s.logNodeFailure("controller0")
+		return fmt.Errorf("controller0: %v", err)
+	}
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		for idx := 1; idx < s.ControllerCount; idx++ {
+			token, err := s.GetJoinToken("controller", dataDir)
+			if err != nil {
+				return err
+			}
+			if err := s.JoinController(idx, token, dataDir, controllerArgs...); err != nil {
+				s.logNodeFailure(fmt.Sprintf("controller%d", idx))
+				return fmt.Errorf("controller%d: %v", idx, err)
+			}
+		}
+		return nil
+	})
+	eg.Go(func() error {
+		return s.RunWorkers(dataDir, workerArgs...)
+	})
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	s.clusterInitialized = true
+	return nil
 }
 
 // JoinController joins the cluster with a given token
-func (s *FootlooseSuite) JoinController(idx int, token string, dataDir string) error {
+func (s *FootlooseSuite) JoinController(idx int, token string, dataDir string, args ...string) error {
 	controllerNode := fmt.Sprintf("controller%d", idx)
 	ssh, err := s.SSH(controllerNode)
 	if err != nil {
 		return err
 	}
 	defer ssh.Disconnect()
-	_, err = ssh.ExecWithOutput(fmt.Sprintf("nohup k0s controller --debug %s >/tmp/k0s-controller.log 2>&1 &", token))
+	_, err = ssh.ExecWithOutput(fmt.Sprintf("nohup k0s controller --debug %s %s >/tmp/k0s-controller.log 2>&1 &", strings.Join(args, " "), token))
 	if err != nil {
 		return err
 	}
@@ -269,13 +369,8 @@ func (s *FootlooseSuite) GetJoinToken(role string, dataDir string) (string, erro
 
 }
 
-// RunWorkers joins all the workers to the cluster
+// RunWorkers joins all the workers to the cluster concurrently
 func (s *FootlooseSuite) RunWorkers(dataDir string, args ...string) error {
-	ssh, err := s.SSH("controller0")
-	if err != nil {
-		return err
-	}
-	defer ssh.Disconnect()
 	token, err := s.GetJoinToken("worker", dataDir)
 	if err != nil {
 		return err
@@ -288,19 +383,19 @@ func (s *FootlooseSuite) RunWorkers(dataDir string, args ...string) error {
 	}
 	workerCommand := fmt.Sprintf(`nohup k0s --debug worker %s "%s" >/tmp/k0s-worker.log 2>&1 &`, strings.Join(args, " "), token)
 
-	for i := 0; i < s.WorkerCount; i++ {
-		workerNode := fmt.Sprintf("worker%d", i)
-		sshWorker, err := s.SSH(workerNode)
-		if err != nil {
-			return err
-		}
-		defer sshWorker.Disconnect()
-		_, err = sshWorker.ExecWithOutput(workerCommand)
+	workers := make([]string, s.WorkerCount)
+	for i := range workers {
+		workers[i] = fmt.Sprintf("worker%d", i)
+	}
+	return s.onNodes(workers, func(node string) error {
+		ssh, err := s.SSH(node)
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+		defer ssh.Disconnect()
+		_, err = ssh.ExecWithOutput(workerCommand)
+		return err
+	})
 }
 
 // SSH establishes an SSH connection to the node
@@ -330,6 +425,17 @@ func (s *FootlooseSuite) SSH(node string) (*SSHConnection, error) {
 	return ssh, nil
 }
 
+// ExecOnNode runs the command on the node over a fresh SSH connection and returns its output
+func (s *FootlooseSuite) ExecOnNode(ctx context.Context, node string, cmd string) (string, error) {
+	ssh, err := s.SSH(node)
+	if err != nil {
+		return "", err
+	}
+	defer ssh.Disconnect()
+
+	return ssh.ExecWithOutputContext(ctx, cmd)
+}
+
 // MachineForName gets the named machine details
 func (s *FootlooseSuite) MachineForName(name string) (*cluster.Machine, error) {
 	machines, err := s.Cluster.Inspect(nil)
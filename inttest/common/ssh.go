@@ -16,6 +16,7 @@ limitations under the License.
 package common
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -74,13 +75,33 @@ func (c *SSHConnection) Connect() error {
 
 // ExecWithOutput execs a command on the host and returns its output
 func (c *SSHConnection) ExecWithOutput(cmd string) (string, error) {
+	return c.ExecWithOutputContext(context.Background(), cmd)
+}
+
+// ExecWithOutputContext execs a command on the host and returns its output.
+// The command is killed and the session closed once ctx is done.
+func (c *SSHConnection) ExecWithOutputContext(ctx context.Context, cmd string) (string, error) {
 	session, err := c.client.NewSession()
 	if err != nil {
 		return "", err
 	}
 	defer session.Close()
 
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = session.Signal(ssh.SIGKILL)
+			session.Close()
+		case <-done:
+		}
+	}()
+
 	output, err := session.CombinedOutput(cmd)
+	if ctx.Err() != nil {
+		return trimOutput(output), ctx.Err()
+	}
 	if err != nil {
 		return trimOutput(output), err
 	}
@@ -127,6 +127,17 @@ func (s *VMSuite) SSH(ip string) (*SSHConnection, error) {
 	return ssh, nil
 }
 
+// ExecOnNode runs the command on the node over a fresh SSH connection and returns its output
+func (s *VMSuite) ExecOnNode(ctx context.Context, ip string, cmd string) (string, error) {
+	ssh, err := s.SSH(ip)
+	if err != nil {
+		return "", err
+	}
+	defer ssh.Disconnect()
+
+	return ssh.ExecWithOutputContext(ctx, cmd)
+}
+
 // RunWorkers joins all the workers to the cluster
 func (s *VMSuite) RunWorkers() error {
 	ssh, err := s.SSH(s.ControllerIP)
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kubeapijoin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/k0sproject/k0s/inttest/common"
+	"github.com/stretchr/testify/suite"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type KubeAPIJoinSuite struct {
+	common.FootlooseSuite
+}
+
+func (s *KubeAPIJoinSuite) TestJoinThroughKubeAPI() {
+	s.NoError(s.InitMainController([]string{}))
+
+	ssh, err := s.SSH("controller0")
+	s.Require().NoError(err)
+	defer ssh.Disconnect()
+	output, err := ssh.ExecWithOutput("k0s token create --role=controller --max-uses=1")
+	s.Require().NoError(err)
+	// in case of no k0s.conf given, there might be warnings on the first few lines
+	lines := strings.Split(output, "\n")
+	token := lines[len(lines)-1]
+
+	s.NoError(s.JoinController(1, token, "", "--join-transport=kube-api"))
+
+	ssh1, err := s.SSH("controller1")
+	s.Require().NoError(err)
+	defer ssh1.Disconnect()
+	_, err = ssh1.ExecWithOutput("grep 'joining through the Kubernetes API service proxy' /tmp/k0s-controller.log")
+	s.NoError(err, "controller1 didn't join through the Kubernetes API")
+	_, err = ssh1.ExecWithOutput("test ! -e /var/lib/k0s/pki/k0s-api-client.crt")
+	s.NoError(err, "controller1 shouldn't bootstrap a k0s API client certificate")
+
+	s.Equal(s.GetFileFromController(0, "/var/lib/k0s/pki/ca.crt"), s.GetFileFromController(1, "/var/lib/k0s/pki/ca.crt"))
+	s.Equal(s.GetFileFromController(0, "/var/lib/k0s/pki/sa.key"), s.GetFileFromController(1, "/var/lib/k0s/pki/sa.key"))
+
+	// the single use token has been used up by the join
+	kc, err := s.KubeClient("controller0", "")
+	s.Require().NoError(err)
+	secrets, err := kc.CoreV1().Secrets("kube-system").List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "type=bootstrap.kubernetes.io/token",
+	})
+	s.Require().NoError(err)
+	for _, secret := range secrets.Items {
+		s.NotEqual("true", string(secret.Data["usage-controller-join"]), "controller token %s hasn't been used up", secret.Name)
+	}
+}
+
+func TestKubeAPIJoinSuite(t *testing.T) {
+	s := KubeAPIJoinSuite{
+		common.FootlooseSuite{
+			ControllerCount: 2,
+		},
+	}
+	suite.Run(t, &s)
+}
@@ -44,17 +44,10 @@ func (s *MultiControllerSuite) TestK0sGetsUp() {
 	ipAddress := s.getMainIPAddress()
 	s.T().Logf("ip address: %s", ipAddress)
 
-	s.putFile("controller0", "/tmp/k0s.yaml", fmt.Sprintf(k0sConfigWithMultiController, ipAddress))
-	s.NoError(s.InitMainController([]string{"--config=/tmp/k0s.yaml"}))
-
-	token, err := s.GetJoinToken("controller", "")
-	s.NoError(err)
-	s.putFile("controller1", "/tmp/k0s.yaml", fmt.Sprintf(k0sConfigWithMultiController, ipAddress))
-	s.NoError(s.JoinController(1, token, ""))
-
-	s.putFile("controller2", "/tmp/k0s.yaml", fmt.Sprintf(k0sConfigWithMultiController, ipAddress))
-	s.NoError(s.JoinController(2, token, ""))
-	s.NoError(s.RunWorkers(""))
+	for i := 0; i < s.ControllerCount; i++ {
+		s.putFile(fmt.Sprintf("controller%d", i), "/tmp/k0s.yaml", fmt.Sprintf(k0sConfigWithMultiController, ipAddress))
+	}
+	s.Require().NoError(s.InitCluster([]string{"--config=/tmp/k0s.yaml"}))
 
 	kc, err := s.KubeClient("controller0", "")
 	s.NoError(err)
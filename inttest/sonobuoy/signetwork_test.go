@@ -16,6 +16,7 @@ limitations under the License.
 package sonobuoy
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -25,10 +26,10 @@ import (
 	"testing"
 	"time"
 
-	"github.com/avast/retry-go"
 	"github.com/stretchr/testify/suite"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/inttest/common"
 )
 
@@ -106,7 +107,7 @@ func (s *NetworkSuite) retrieveResults() (Result, error) {
 
 	var resultPath string
 
-	err := retry.Do(func() error {
+	err := retry.Do(context.Background(), "sonobuoy retrieve", func() error {
 		retrieveCmd := exec.Command(s.sonoBin, "retrieve")
 		retrieveOutput, err := retrieveCmd.Output()
 		if err != nil {
@@ -0,0 +1,221 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// BundleConfigMediaType is the config media type of the bundle artifacts
+	BundleConfigMediaType = "application/vnd.k0sproject.airgap.config.v1+json"
+	// BundleLayerMediaType is the media type of the bundle tarball layer of the bundle artifacts
+	BundleLayerMediaType = "application/vnd.k0sproject.airgap.bundle.v1.tar"
+)
+
+// NewResolver creates a registry resolver authenticating with the credentials of the docker config.json, anonymous
+// if authFile is empty. The registries on localhost are accessed over plain HTTP.
+func NewResolver(authFile string) (remotes.Resolver, error) {
+	var creds func(host string) (string, string, error)
+	if authFile != "" {
+		data, err := ioutil.ReadFile(authFile)
+		if err != nil {
+			return nil, err
+		}
+		if creds, err = dockerConfigCreds(data); err != nil {
+			return nil, err
+		}
+	}
+	authorizer := docker.NewDockerAuthorizer(docker.WithAuthCreds(creds))
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(docker.WithAuthorizer(authorizer), docker.WithPlainHTTP(docker.MatchLocalhost)),
+	}), nil
+}
+
+// dockerConfigCreds returns the credential lookup of the auths of a docker config.json, the keys of the auths may be
+// URLs, e.g. https://index.docker.io/v1/
+func dockerConfigCreds(data []byte) (func(host string) (string, string, error), error) {
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the docker config: %w", err)
+	}
+	type credentials struct{ username, password string }
+	byHost := make(map[string]credentials, len(config.Auths))
+	for key, auth := range config.Auths {
+		host := key
+		if u, err := url.Parse(key); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		c := credentials{auth.Username, auth.Password}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of %s in the docker config: %w", key, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid auth of %s in the docker config", key)
+			}
+			c = credentials{parts[0], parts[1]}
+		}
+		byHost[host] = c
+	}
+	return func(host string) (string, string, error) {
+		names := []string{host}
+		if host == "registry-1.docker.io" {
+			names = append(names, "docker.io", "index.docker.io")
+		}
+		for _, name := range names {
+			if c, ok := byHost[name]; ok {
+				return c.username, c.password, nil
+			}
+		}
+		return "", "", nil
+	}, nil
+}
+
+// PushBundle pushes the bundle tarball as an OCI artifact with a single layer
+func PushBundle(ctx context.Context, resolver remotes.Resolver, ref string, bundlePath string) (ocispec.Descriptor, error) {
+	ref = NormalizeReference(ref)
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer f.Close()
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), f)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	layer := ocispec.Descriptor{MediaType: BundleLayerMediaType, Digest: digester.Digest(), Size: size}
+
+	config := []byte("{}")
+	configDesc := ocispec.Descriptor{MediaType: BundleConfigMediaType, Digest: digest.FromBytes(config), Size: int64(len(config))}
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	manifestDesc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromBytes(manifest), Size: int64(len(manifest))}
+
+	pusher, err := resolver.Pusher(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := push(ctx, pusher, layer, f); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := push(ctx, pusher, configDesc, bytes.NewReader(config)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	// the manifest is pushed last, so the tag points to a complete artifact only
+	if err := push(ctx, pusher, manifestDesc, bytes.NewReader(manifest)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return manifestDesc, nil
+}
+
+func push(ctx context.Context, pusher remotes.Pusher, desc ocispec.Descriptor, r io.Reader) error {
+	w, err := pusher.Push(ctx, desc)
+	if errdefs.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to push %s: %w", desc.Digest, err)
+	}
+	defer w.Close()
+	if err := content.Copy(ctx, w, r, desc.Size, desc.Digest); err != nil && !errdefs.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to push %s: %w", desc.Digest, err)
+	}
+	return nil
+}
+
+// ResolveBundle resolves the manifest of the bundle artifact and returns the descriptor of its bundle layer
+func ResolveBundle(ctx context.Context, resolver remotes.Resolver, ref string) (remotes.Fetcher, ocispec.Descriptor, error) {
+	ref = NormalizeReference(ref)
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, fmt.Errorf("can't resolve %s: %w", ref, err)
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, fmt.Errorf("can't fetch the manifest of %s: %w", ref, err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxMetadataSize))
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, ocispec.Descriptor{}, fmt.Errorf("invalid manifest of %s: %w", ref, err)
+	}
+	if manifest.Config.MediaType != BundleConfigMediaType || len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != BundleLayerMediaType {
+		return nil, ocispec.Descriptor{}, fmt.Errorf("%s is not an airgap bundle artifact", ref)
+	}
+	return fetcher, manifest.Layers[0], nil
+}
+
+// FetchBundle writes the bundle layer into w and verifies its digest
+func FetchBundle(ctx context.Context, fetcher remotes.Fetcher, layer ocispec.Descriptor, w io.Writer) error {
+	rc, err := fetcher.Fetch(ctx, layer)
+	if err != nil {
+		return fmt.Errorf("can't fetch the bundle %s: %w", layer.Digest, err)
+	}
+	defer rc.Close()
+	verifier := layer.Digest.Verifier()
+	size, err := io.Copy(io.MultiWriter(w, verifier), rc)
+	if err != nil {
+		return fmt.Errorf("can't fetch the bundle %s: %w", layer.Digest, err)
+	}
+	if size != layer.Size || !verifier.Verified() {
+		return fmt.Errorf("the bundle %s is corrupt", layer.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerConfigCreds(t *testing.T) {
+	creds, err := dockerConfigCreds([]byte(`{"auths":{
+		"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"},
+		"registry.local:5000":{"username":"k0s","password":"secret"}
+	}}`))
+	require.NoError(t, err)
+
+	for host, expected := range map[string][2]string{
+		"registry-1.docker.io": {"user", "pass"},
+		"registry.local:5000":  {"k0s", "secret"},
+		"quay.io":              {"", ""},
+	} {
+		username, password, err := creds(host)
+		require.NoError(t, err)
+		assert.Equal(t, expected, [2]string{username, password}, host)
+	}
+
+	_, err = dockerConfigCreds([]byte(`{"auths":{"quay.io":{"auth":"bm9jb2xvbg=="}}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/archive"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// BundleBuilder pulls images from their registries and writes them into bundles for several platforms. The content
+// is cached in a local content store, so the images shared by several bundles are pulled only once.
+type BundleBuilder struct {
+	store    content.Store
+	resolver remotes.Resolver
+	pulled   map[string]ocispec.Descriptor
+}
+
+// NewBundleBuilder creates a builder caching the content in the directory
+func NewBundleBuilder(cacheDir string) (*BundleBuilder, error) {
+	store, err := local.NewStore(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the content store: %w", err)
+	}
+	return &BundleBuilder{
+		store:    store,
+		resolver: docker.NewResolver(docker.ResolverOptions{}),
+		pulled:   make(map[string]ocispec.Descriptor),
+	}, nil
+}
+
+// ParsePlatforms parses a comma separated list of os/arch[/variant] platforms
+func ParsePlatforms(list string) ([]ocispec.Platform, error) {
+	var result []ocispec.Platform
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		p, err := platforms.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, platforms.Normalize(p))
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no platforms given")
+	}
+	return result, nil
+}
+
+// Write pulls the images for the platforms and writes them as an OCI image layout tarball. The multi-platform images
+// keep their index, so that the bundle can be imported on the nodes of each platform. The images without a variant
+// for some of the platforms are bundled for the others, the images with none of the platforms fail the bundle.
+func (b *BundleBuilder) Write(ctx context.Context, w io.Writer, refs []string, platformList []ocispec.Platform) error {
+	matcher := platforms.Any(platformList...)
+	opts := []archive.ExportOpt{archive.WithPlatform(matcher)}
+	for _, ref := range refs {
+		ref = NormalizeReference(ref)
+		desc, err := b.pull(ctx, ref, matcher)
+		if err != nil {
+			return err
+		}
+		available, err := images.Platforms(ctx, b.store, desc)
+		if err != nil {
+			return fmt.Errorf("can't read the platforms of %s: %w", ref, err)
+		}
+		missing := MissingPlatforms(available, platformList)
+		if len(missing) == len(platformList) {
+			return fmt.Errorf("%s has none of the platforms %s", ref, formatPlatforms(platformList))
+		}
+		if len(missing) > 0 {
+			logrus.Warnf("%s has no variant for %s", ref, formatPlatforms(missing))
+		}
+		opts = append(opts, archive.WithManifest(desc, ref))
+	}
+	return archive.Export(ctx, b.store, w, opts...)
+}
+
+// pull fetches the image index or manifest and the content of the matching platforms into the store
+func (b *BundleBuilder) pull(ctx context.Context, ref string, matcher platforms.MatchComparer) (ocispec.Descriptor, error) {
+	name, desc, err := b.resolver.Resolve(ctx, ref)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("can't resolve %s: %w", ref, err)
+	}
+	if cached, ok := b.pulled[ref]; ok && cached.Digest == desc.Digest {
+		return desc, nil
+	}
+	fetcher, err := b.resolver.Fetcher(ctx, name)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	logrus.Infof("pulling %s", ref)
+	handler := images.Handlers(
+		remotes.FetchHandler(b.store, fetcher),
+		images.FilterPlatforms(images.ChildrenHandler(b.store), matcher),
+	)
+	if err := images.Dispatch(ctx, handler, nil, desc); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("can't pull %s: %w", ref, err)
+	}
+	b.pulled[ref] = desc
+	return desc, nil
+}
+
+// MissingPlatforms returns the wanted platforms the image has no variant for
+func MissingPlatforms(available []ocispec.Platform, wanted []ocispec.Platform) []ocispec.Platform {
+	var missing []ocispec.Platform
+	for _, p := range wanted {
+		matcher := platforms.Only(p)
+		found := false
+		for _, a := range available {
+			if matcher.Match(a) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+func formatPlatforms(list []ocispec.Platform) string {
+	formatted := make([]string, len(list))
+	for i, p := range list {
+		formatted[i] = platforms.Format(p)
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlatforms(t *testing.T) {
+	list, err := ParsePlatforms("linux/amd64, linux/arm64,windows/amd64")
+	require.NoError(t, err)
+	assert.Equal(t, []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+		{OS: "windows", Architecture: "amd64"},
+	}, list)
+
+	_, err = ParsePlatforms("")
+	assert.Error(t, err)
+	_, err = ParsePlatforms("linux/not-an-arch/x/y")
+	assert.Error(t, err)
+}
+
+func TestMissingPlatforms(t *testing.T) {
+	amd64 := ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := ocispec.Platform{OS: "linux", Architecture: "arm64"}
+	windows := ocispec.Platform{OS: "windows", Architecture: "amd64"}
+
+	assert.Empty(t, MissingPlatforms([]ocispec.Platform{amd64, arm64}, []ocispec.Platform{amd64, arm64}))
+	assert.Equal(t, []ocispec.Platform{windows}, MissingPlatforms([]ocispec.Platform{amd64, arm64}, []ocispec.Platform{amd64, windows}))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// containerLists are the fields of the pod specs listing containers
+var containerLists = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// ImagesFromManifests returns the sorted images of the containers of the pod specs found in the YAML documents, in any
+// kind of workload or custom resource embedding a pod template
+func ImagesFromManifests(manifests string) ([]string, error) {
+	images := make(map[string]bool)
+	decoder := yaml.NewDecoder(strings.NewReader(manifests))
+	for {
+		var doc interface{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+		collectImages(doc, images)
+	}
+
+	result := make([]string, 0, len(images))
+	for image := range images {
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func collectImages(node interface{}, images map[string]bool) {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		for _, field := range containerLists {
+			containers, _ := n[field].([]interface{})
+			for _, container := range containers {
+				c, _ := container.(map[interface{}]interface{})
+				if image, ok := c["image"].(string); ok && image != "" {
+					images[image] = true
+				}
+			}
+		}
+		for _, v := range n {
+			collectImages(v, images)
+		}
+	case []interface{}:
+		for _, v := range n {
+			collectImages(v, images)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImagesFromManifests(t *testing.T) {
+	manifests := `
+---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.32
+      containers:
+      - name: app
+        image: registry.example.com/app:2.0.0
+      - name: sidecar
+        image: registry.example.com/app:2.0.0
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: registry.example.com/backup:1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  image: not-an-image
+---
+`
+	images, err := ImagesFromManifests(manifests)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"busybox:1.32", "registry.example.com/app:2.0.0", "registry.example.com/backup:1.0"}, images)
+
+	_, err = ImagesFromManifests("kind: [")
+	assert.Error(t, err)
+}
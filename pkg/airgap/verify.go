@@ -0,0 +1,338 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxMetadataSize limits the files kept in memory while reading a bundle, the manifests and the configs are small
+const maxMetadataSize = 1 << 20
+
+const (
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerIndex = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// BundleImage is an image found in a bundle
+type BundleImage struct {
+	// Names are the normalized references of the image
+	Names        []string `json:"names"`
+	OS           string   `json:"os,omitempty"`
+	Architecture string   `json:"architecture,omitempty"`
+	// Problems are the missing and corrupt parts of the image
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Bundle is the content of an image bundle created with docker save or ctr export
+type Bundle struct {
+	Images []BundleImage `json:"images"`
+	// Problems are the problems of the bundle not belonging to any image
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Find returns the image with the reference, nil if it's not in the bundle
+func (b *Bundle) Find(ref string) *BundleImage {
+	ref = NormalizeReference(ref)
+	for i := range b.Images {
+		for _, name := range b.Images[i].Names {
+			if name == ref {
+				return &b.Images[i]
+			}
+		}
+	}
+	return nil
+}
+
+type bundleFile struct {
+	digest string
+	size   int64
+	data   []byte
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+type imageConfig struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	RootFS       struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+type bundleReader struct {
+	files map[string]*bundleFile
+	os    string
+	arch  string
+}
+
+// ReadBundle reads an uncompressed image bundle and verifies the digests of its content. The images of multi-platform
+// indexes are resolved for the os and the arch.
+func ReadBundle(r io.Reader, os, arch string) (*Bundle, error) {
+	br := &bundleReader{files: make(map[string]*bundleFile), os: os, arch: arch}
+	// docker save links the layers shared by several images
+	links := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the bundle: %w", err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			links[path.Clean(hdr.Name)] = path.Join(path.Dir(hdr.Name), hdr.Linkname)
+			continue
+		case tar.TypeLink:
+			links[path.Clean(hdr.Name)] = path.Clean(hdr.Linkname)
+			continue
+		case tar.TypeReg:
+		default:
+			continue
+		}
+		hash := sha256.New()
+		var data bytes.Buffer
+		var w io.Writer = hash
+		if hdr.Size <= maxMetadataSize {
+			w = io.MultiWriter(hash, &data)
+		}
+		size, err := io.Copy(w, tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from the bundle: %w", hdr.Name, err)
+		}
+		file := &bundleFile{digest: "sha256:" + hex.EncodeToString(hash.Sum(nil)), size: size}
+		if hdr.Size <= maxMetadataSize {
+			file.data = data.Bytes()
+		}
+		br.files[path.Clean(hdr.Name)] = file
+	}
+	for name, target := range links {
+		if file, ok := br.files[target]; ok {
+			br.files[name] = file
+		}
+	}
+
+	bundle := &Bundle{}
+	seen := make(map[string]bool)
+	if index, ok := br.files["index.json"]; ok {
+		var idx struct {
+			Manifests []descriptor `json:"manifests"`
+		}
+		if err := json.Unmarshal(index.data, &idx); err != nil {
+			return nil, fmt.Errorf("invalid index.json: %w", err)
+		}
+		for _, desc := range idx.Manifests {
+			image := br.readOCIImage(desc)
+			for _, name := range image.Names {
+				seen[name] = true
+			}
+			bundle.Images = append(bundle.Images, image)
+		}
+	}
+	if manifest, ok := br.files["manifest.json"]; ok {
+		var entries []struct {
+			Config   string
+			RepoTags []string
+			Layers   []string
+		}
+		if err := json.Unmarshal(manifest.data, &entries); err != nil {
+			return nil, fmt.Errorf("invalid manifest.json: %w", err)
+		}
+		for _, entry := range entries {
+			// the bundles of ctr export and of the recent docker versions have both the index and the manifest
+			if len(entry.RepoTags) > 0 && seen[NormalizeReference(entry.RepoTags[0])] {
+				continue
+			}
+			bundle.Images = append(bundle.Images, br.readDockerImage(entry.Config, entry.RepoTags, entry.Layers))
+		}
+	}
+	if len(bundle.Images) == 0 {
+		bundle.Problems = append(bundle.Problems, "no images found, neither index.json nor manifest.json is present")
+	}
+	return bundle, nil
+}
+
+// readOCIImage verifies the image of an index.json manifest
+func (br *bundleReader) readOCIImage(desc descriptor) BundleImage {
+	var image BundleImage
+	if name := desc.Annotations["io.containerd.image.name"]; name != "" {
+		image.Names = append(image.Names, NormalizeReference(name))
+	} else if name := desc.Annotations["org.opencontainers.image.ref.name"]; strings.Contains(name, "/") || strings.Contains(name, ":") {
+		image.Names = append(image.Names, NormalizeReference(name))
+	}
+
+	data, err := br.blob(desc)
+	if err != nil {
+		image.Problems = append(image.Problems, err.Error())
+		return image
+	}
+	if desc.MediaType == mediaTypeOCIIndex || desc.MediaType == mediaTypeDockerIndex {
+		var idx struct {
+			Manifests []descriptor `json:"manifests"`
+		}
+		if err := json.Unmarshal(data, &idx); err != nil {
+			image.Problems = append(image.Problems, fmt.Sprintf("invalid index %s: %v", desc.Digest, err))
+			return image
+		}
+		desc = descriptor{}
+		for _, m := range idx.Manifests {
+			if m.Platform != nil && m.Platform.OS == br.os && m.Platform.Architecture == br.arch {
+				desc = m
+				break
+			}
+		}
+		if desc.Digest == "" {
+			image.Problems = append(image.Problems, fmt.Sprintf("no manifest for %s/%s", br.os, br.arch))
+			return image
+		}
+		if data, err = br.blob(desc); err != nil {
+			image.Problems = append(image.Problems, err.Error())
+			return image
+		}
+	}
+
+	var manifest struct {
+		Config descriptor   `json:"config"`
+		Layers []descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		image.Problems = append(image.Problems, fmt.Sprintf("invalid manifest %s: %v", desc.Digest, err))
+		return image
+	}
+	if config, err := br.blob(manifest.Config); err != nil {
+		image.Problems = append(image.Problems, err.Error())
+	} else {
+		var c imageConfig
+		if err := json.Unmarshal(config, &c); err != nil {
+			image.Problems = append(image.Problems, fmt.Sprintf("invalid config %s: %v", manifest.Config.Digest, err))
+		}
+		image.OS, image.Architecture = c.OS, c.Architecture
+	}
+	for _, layer := range manifest.Layers {
+		if _, err := br.blobFile(layer); err != nil {
+			image.Problems = append(image.Problems, err.Error())
+		}
+	}
+	return image
+}
+
+// readDockerImage verifies the image of a docker save manifest.json entry, its layers are verified against the diff
+// IDs of the config
+func (br *bundleReader) readDockerImage(configPath string, repoTags []string, layers []string) BundleImage {
+	var image BundleImage
+	for _, tag := range repoTags {
+		image.Names = append(image.Names, NormalizeReference(tag))
+	}
+
+	configFile, ok := br.files[path.Clean(configPath)]
+	if !ok || configFile.data == nil {
+		image.Problems = append(image.Problems, fmt.Sprintf("config %s is missing", configPath))
+		return image
+	}
+	if expected := "sha256:" + strings.TrimSuffix(path.Base(configPath), ".json"); expected != configFile.digest {
+		image.Problems = append(image.Problems, fmt.Sprintf("config %s is corrupt: digest %s", configPath, configFile.digest))
+	}
+	var config imageConfig
+	if err := json.Unmarshal(configFile.data, &config); err != nil {
+		image.Problems = append(image.Problems, fmt.Sprintf("invalid config %s: %v", configPath, err))
+		return image
+	}
+	image.OS, image.Architecture = config.OS, config.Architecture
+
+	for i, layerPath := range layers {
+		layer, ok := br.files[path.Clean(layerPath)]
+		if !ok {
+			image.Problems = append(image.Problems, fmt.Sprintf("layer %s is missing", layerPath))
+			continue
+		}
+		if i < len(config.RootFS.DiffIDs) && layer.digest != config.RootFS.DiffIDs[i] {
+			image.Problems = append(image.Problems, fmt.Sprintf("layer %s is corrupt: digest %s, expected %s", layerPath, layer.digest, config.RootFS.DiffIDs[i]))
+		}
+	}
+	return image
+}
+
+// blobFile looks up the blob of the descriptor and verifies its size and digest
+func (br *bundleReader) blobFile(desc descriptor) (*bundleFile, error) {
+	file, ok := br.files[path.Join("blobs", strings.Replace(desc.Digest, ":", "/", 1))]
+	if !ok {
+		return nil, fmt.Errorf("blob %s is missing", desc.Digest)
+	}
+	if desc.Size != 0 && file.size != desc.Size {
+		return nil, fmt.Errorf("blob %s is truncated: %d bytes, expected %d", desc.Digest, file.size, desc.Size)
+	}
+	if file.digest != desc.Digest {
+		return nil, fmt.Errorf("blob %s is corrupt: digest %s", desc.Digest, file.digest)
+	}
+	return file, nil
+}
+
+func (br *bundleReader) blob(desc descriptor) ([]byte, error) {
+	file, err := br.blobFile(desc)
+	if err != nil {
+		return nil, err
+	}
+	if file.data == nil {
+		return nil, fmt.Errorf("blob %s is too large for a manifest", desc.Digest)
+	}
+	return file.data, nil
+}
+
+// NormalizeReference returns the fully qualified form of an image reference, e.g. docker.io/library/nginx:latest
+// for nginx
+func NormalizeReference(ref string) string {
+	name, tag := ref, ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, tag = name[:i], name[i:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i:]
+	}
+	if tag == "" {
+		tag = ":latest"
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		name = "docker.io/" + name
+		parts = strings.SplitN(name, "/", 2)
+	}
+	if parts[0] == "index.docker.io" {
+		parts[0] = "docker.io"
+	}
+	if parts[0] == "docker.io" && !strings.Contains(parts[1], "/") {
+		parts[1] = "library/" + parts[1]
+	}
+	return parts[0] + "/" + parts[1] + tag
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package airgap
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Digest(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func writeTar(t *testing.T, files map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func ociBundle(arch string, corruptLayer bool) map[string]string {
+	layer := "layer content"
+	config := fmt.Sprintf(`{"os":"linux","architecture":%q,"rootfs":{"diff_ids":[%q]}}`, arch, sha256Digest(layer))
+	manifest := fmt.Sprintf(`{"config":{"digest":%q,"size":%d},"layers":[{"digest":%q,"size":%d}]}`,
+		sha256Digest(config), len(config), sha256Digest(layer), len(layer))
+	index := fmt.Sprintf(`{"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":%q,"size":%d,"annotations":{"io.containerd.image.name":"docker.io/library/nginx:1.19"}}]}`,
+		sha256Digest(manifest), len(manifest))
+
+	blob := func(content string) string { return "blobs/sha256/" + sha256Digest(content)[len("sha256:"):] }
+	files := map[string]string{
+		"index.json":    index,
+		blob(manifest):  manifest,
+		blob(config):    config,
+		blob(layer):     layer,
+		"oci-layout":    `{"imageLayoutVersion":"1.0.0"}`,
+		"manifest.json": fmt.Sprintf(`[{"Config":%q,"RepoTags":["nginx:1.19"],"Layers":[%q]}]`, blob(config), blob(layer)),
+	}
+	if corruptLayer {
+		files[blob(layer)] = "corrupt content"
+	}
+	return files
+}
+
+func TestReadOCIBundle(t *testing.T) {
+	bundle, err := ReadBundle(writeTar(t, ociBundle("amd64", false)), "linux", "amd64")
+	require.NoError(t, err)
+	require.Len(t, bundle.Images, 1)
+	assert.Empty(t, bundle.Problems)
+
+	image := bundle.Find("nginx:1.19")
+	require.NotNil(t, image)
+	assert.Equal(t, "amd64", image.Architecture)
+	assert.Empty(t, image.Problems)
+	assert.Nil(t, bundle.Find("nginx:1.20"))
+
+	bundle, err = ReadBundle(writeTar(t, ociBundle("amd64", true)), "linux", "amd64")
+	require.NoError(t, err)
+	require.Len(t, bundle.Images, 1)
+	assert.Len(t, bundle.Images[0].Problems, 1)
+}
+
+func TestReadDockerBundle(t *testing.T) {
+	layer := "layer content"
+	config := fmt.Sprintf(`{"os":"linux","architecture":"arm64","rootfs":{"diff_ids":[%q]}}`, sha256Digest(layer))
+	configPath := sha256Digest(config)[len("sha256:"):] + ".json"
+	files := map[string]string{
+		"manifest.json": fmt.Sprintf(`[{"Config":%q,"RepoTags":["quay.io/k0sproject/calico-node:v3.16.2-0"],"Layers":["abc/layer.tar","def/layer.tar"]}]`, configPath),
+		configPath:      config,
+		"abc/layer.tar": layer,
+	}
+
+	bundle, err := ReadBundle(writeTar(t, files), "linux", "amd64")
+	require.NoError(t, err)
+	image := bundle.Find("quay.io/k0sproject/calico-node:v3.16.2-0")
+	require.NotNil(t, image)
+	assert.Equal(t, "arm64", image.Architecture)
+	assert.Equal(t, []string{"layer def/layer.tar is missing"}, image.Problems)
+}
+
+func TestReadBundleTruncated(t *testing.T) {
+	buf := writeTar(t, ociBundle("amd64", false))
+	_, err := ReadBundle(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), "linux", "amd64")
+	assert.Error(t, err)
+}
+
+func TestNormalizeReference(t *testing.T) {
+	for ref, expected := range map[string]string{
+		"nginx":                         "docker.io/library/nginx:latest",
+		"nginx:1.19":                    "docker.io/library/nginx:1.19",
+		"coredns/coredns:1.7.0":         "docker.io/coredns/coredns:1.7.0",
+		"index.docker.io/library/nginx": "docker.io/library/nginx:latest",
+		"k8s.gcr.io/pause:3.2":          "k8s.gcr.io/pause:3.2",
+		"registry.local:5000/app":       "registry.local:5000/app:latest",
+		"localhost/app@sha256:abc":      "localhost/app@sha256:abc",
+	} {
+		assert.Equal(t, expected, NormalizeReference(ref), ref)
+	}
+}
@@ -54,6 +54,7 @@ type ChartInterface interface {
 	Get(ctx context.Context, name string, opts metav1.GetOptions) (*v1beta1.Chart, error)
 	Create(ctx context.Context, chart *v1beta1.Chart) (*v1beta1.Chart, error)
 	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Update(ctx context.Context, chart *v1beta1.Chart, opts metav1.UpdateOptions) (*v1beta1.Chart, error)
 	UpdateStatus(ctx context.Context, chart *v1beta1.Chart, opts metav1.UpdateOptions) (*v1beta1.Chart, error)
 }
 
@@ -113,6 +114,20 @@ func (c chartClient) Get(ctx context.Context, name string, opts metav1.GetOption
 	return &result, err
 }
 
+// Update updates the chart, the status is ignored
+func (c chartClient) Update(ctx context.Context, chart *v1beta1.Chart, opts metav1.UpdateOptions) (*v1beta1.Chart, error) {
+	result := &v1beta1.Chart{}
+	err := c.restClient.Put().
+		Namespace(c.ns).
+		Resource(resourceName).
+		Name(chart.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(chart).
+		Do(ctx).
+		Into(result)
+	return result, err
+}
+
 func (c chartClient) UpdateStatus(ctx context.Context, chart *v1beta1.Chart, opts metav1.UpdateOptions) (*v1beta1.Chart, error) {
 	result := &v1beta1.Chart{}
 	err := c.restClient.Put().
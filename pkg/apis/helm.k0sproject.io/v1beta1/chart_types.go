@@ -28,6 +28,33 @@ type ChartSpec struct {
 	Values    string `json:"values,omitempty"`
 	Version   string `json:"version,omitempty"`
 	Namespace string `json:"namespace,omitempty"`
+	// ValuesFrom are merged in order, the values on top of them
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+	// DependsOn are the names of the charts in the same namespace whose releases must be deployed and ready before
+	// this chart is installed or upgraded
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Timeout of waiting for the resources and hooks on install and upgrade, e.g. 10m
+	Timeout string `json:"timeout,omitempty"`
+	// Atomic uninstalls a failed install and rolls back a failed upgrade, it implies wait
+	Atomic bool `json:"atomic,omitempty"`
+	// Wait for the resources to be ready before marking the release successful
+	Wait bool `json:"wait,omitempty"`
+	// SkipCRDs skips installing the CRDs of the chart
+	SkipCRDs bool `json:"skipCRDs,omitempty"`
+	// DisableHooks skips running the hooks of the chart
+	DisableHooks bool `json:"disableHooks,omitempty"`
+	// UninstallPolicy tells what happens to the release when the chart is deleted: Uninstall, Orphan or KeepCRDs
+	UninstallPolicy string `json:"uninstallPolicy,omitempty"`
+}
+
+// ValuesReference references chart values in a key of a Secret or ConfigMap, or in a local file on the controllers
+type ValuesReference struct {
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key,omitempty"`
+	File      string `json:"file,omitempty"`
+	Optional  bool   `json:"optional,omitempty"`
 }
 
 // YamlValues returns values as map
@@ -51,6 +78,12 @@ type ChartStatus struct {
 	Namespace   string `json:"namespace,omitempty"`
 	Revision    int64  `json:"revision,omitempty"`
 	Error       string `json:"error,omitempty"`
+	// Drift lists the resources of the release changed or deleted outside of helm, as of the last drift check
+	Drift []string `json:"drift,omitempty"`
+	// DriftChecked is the time of the last drift check
+	DriftChecked string `json:"driftChecked,omitempty"`
+	// Removal records what was done with the release when the chart was deleted
+	Removal string `json:"removal,omitempty"`
 }
 
 // +kubebuilder:object:root=true
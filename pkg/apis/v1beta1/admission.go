@@ -0,0 +1,95 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultAdmissionPlugin is always enabled by k0s and cannot be disabled
+const DefaultAdmissionPlugin = "NodeRestriction"
+
+// AdmissionSpec defines the admission plugins of the api server
+type AdmissionSpec struct {
+	EnabledPlugins  []string                `yaml:"enabledPlugins,omitempty"`
+	DisabledPlugins []string                `yaml:"disabledPlugins,omitempty"`
+	Plugins         []AdmissionPluginConfig `yaml:"plugins,omitempty"`
+}
+
+// AdmissionPluginConfig holds the configuration of a single admission plugin.
+// The configuration is either given inline or as a path to an existing file on the controllers.
+type AdmissionPluginConfig struct {
+	Name          string                 `yaml:"name"`
+	Path          string                 `yaml:"path,omitempty"`
+	Configuration map[string]interface{} `yaml:"configuration,omitempty"`
+}
+
+// APIServerArgs returns the kube-apiserver flags for the admission plugins, the path of the AdmissionConfiguration
+// file is set separately as k0s stages it
+func (a *AdmissionSpec) APIServerArgs() map[string]string {
+	args := map[string]string{
+		"enable-admission-plugins": strings.Join(a.enabledPlugins(), ","),
+	}
+	if len(a.DisabledPlugins) > 0 {
+		args["disable-admission-plugins"] = strings.Join(a.DisabledPlugins, ",")
+	}
+	return args
+}
+
+func (a *AdmissionSpec) enabledPlugins() []string {
+	plugins := []string{DefaultAdmissionPlugin}
+	for _, p := range a.EnabledPlugins {
+		if p != DefaultAdmissionPlugin {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins
+}
+
+// Validate validates AdmissionSpec struct
+func (a *AdmissionSpec) Validate() []error {
+	var errors []error
+
+	enabled := make(map[string]bool)
+	for _, p := range a.EnabledPlugins {
+		enabled[p] = true
+	}
+	for _, p := range a.DisabledPlugins {
+		if p == DefaultAdmissionPlugin {
+			errors = append(errors, fmt.Errorf("admission plugin %s cannot be disabled", p))
+		} else if enabled[p] {
+			errors = append(errors, fmt.Errorf("admission plugin %s cannot be both enabled and disabled", p))
+		}
+	}
+
+	configured := make(map[string]bool)
+	for _, p := range a.Plugins {
+		if p.Name == "" {
+			errors = append(errors, fmt.Errorf("admission plugin configuration must have a name"))
+			continue
+		}
+		if configured[p.Name] {
+			errors = append(errors, fmt.Errorf("admission plugin %s is configured more than once", p.Name))
+		}
+		configured[p.Name] = true
+		if (p.Path == "") == (p.Configuration == nil) {
+			errors = append(errors, fmt.Errorf("admission plugin %s must have either path or configuration", p.Name))
+		}
+	}
+
+	return errors
+}
@@ -28,8 +28,13 @@ import (
 type APISpec struct {
 	Address         string            `yaml:"address"`
 	ExternalAddress string            `yaml:"externalAddress,omitempty"`
+	Port            int               `yaml:"port"`
+	K0sAPIPort      int               `yaml:"k0sApiPort"`
 	SANs            []string          `yaml:"sans"`
 	ExtraArgs       map[string]string `yaml:"extraArgs,omitempty"`
+	OIDC            *OIDCSpec         `yaml:"oidc,omitempty"`
+	Admission       *AdmissionSpec    `yaml:"admission,omitempty"`
+	Join            *JoinAPISpec      `yaml:"join,omitempty"`
 }
 
 // DefaultAPISpec default settings for api
@@ -38,9 +43,12 @@ func DefaultAPISpec() *APISpec {
 	addresses, _ := util.AllAddresses()
 	publicAddress, _ := util.FirstPublicAddress()
 	return &APISpec{
-		SANs:      addresses,
-		Address:   publicAddress,
-		ExtraArgs: make(map[string]string),
+		SANs:       addresses,
+		Address:    publicAddress,
+		Port:       6443,
+		K0sAPIPort: 9443,
+		ExtraArgs:  make(map[string]string),
+		Join:       DefaultJoinAPISpec(),
 	}
 }
 
@@ -53,7 +61,28 @@ func (a *APISpec) APIAddress() string {
 }
 
 func (a *APISpec) APIAddressURL() string {
-	return a.getExternalURIForPort(6443)
+	return a.getExternalURIForPort(a.APIPort())
+}
+
+// APIPort returns the port of the kube-apiserver, 6443 unless set
+func (a *APISpec) APIPort() int {
+	if a.Port == 0 {
+		return 6443
+	}
+	return a.Port
+}
+
+// JoinAPIPort returns the port of the k0s join API, 9443 unless set
+func (a *APISpec) JoinAPIPort() int {
+	if a.K0sAPIPort == 0 {
+		return 9443
+	}
+	return a.K0sAPIPort
+}
+
+// LocalURL returns the URL the kube-apiserver is reached at on the controller itself
+func (a *APISpec) LocalURL() string {
+	return fmt.Sprintf("https://localhost:%d", a.APIPort())
 }
 
 // IsIPv6String returns if ip is IPv6.
@@ -64,7 +93,7 @@ func IsIPv6String(ip string) bool {
 
 // K0sControlPlaneAPIAddress returns the controller join APIs address
 func (a *APISpec) K0sControlPlaneAPIAddress() string {
-	return a.getExternalURIForPort(9443)
+	return a.getExternalURIForPort(a.JoinAPIPort())
 }
 
 func (a *APISpec) getExternalURIForPort(port int) string {
@@ -104,5 +133,23 @@ func (a *APISpec) Validate() []error {
 		errors = append(errors, fmt.Errorf("%s is not a valid address for sans", a))
 	}
 
+	if a.Port < 0 || a.Port > 65535 {
+		errors = append(errors, fmt.Errorf("invalid api port %d", a.Port))
+	}
+	if a.K0sAPIPort < 0 || a.K0sAPIPort > 65535 {
+		errors = append(errors, fmt.Errorf("invalid k0s api port %d", a.K0sAPIPort))
+	}
+	if a.APIPort() == a.JoinAPIPort() {
+		errors = append(errors, fmt.Errorf("api port and k0s api port must differ, both are %d", a.APIPort()))
+	}
+
+	if a.OIDC != nil {
+		errors = append(errors, a.OIDC.Validate()...)
+	}
+	if a.Admission != nil {
+		errors = append(errors, a.Admission.Validate()...)
+	}
+	errors = append(errors, a.Join.Validate()...)
+
 	return errors
 }
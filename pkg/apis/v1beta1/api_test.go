@@ -65,6 +65,134 @@ func (s *APISuite) TestValidation() {
 		s.Len(errors, 1)
 		s.Contains(errors[0].Error(), "is not a valid address for sans")
 	})
+
+	s.T().Run("valid_oidc", func(t *testing.T) {
+		a := APISpec{
+			Address: "1.2.3.4",
+			OIDC: &OIDCSpec{
+				IssuerURL:     "https://accounts.example.com",
+				ClientID:      "k0s",
+				UsernameClaim: "email",
+			},
+		}
+
+		s.Nil(a.Validate())
+		s.Equal(map[string]string{
+			"oidc-issuer-url":     "https://accounts.example.com",
+			"oidc-client-id":      "k0s",
+			"oidc-username-claim": "email",
+		}, a.OIDC.APIServerArgs())
+	})
+
+	s.T().Run("invalid_oidc", func(t *testing.T) {
+		a := APISpec{
+			Address: "1.2.3.4",
+			OIDC: &OIDCSpec{
+				IssuerURL: "http://accounts.example.com",
+			},
+		}
+
+		errors := a.Validate()
+		s.Len(errors, 2)
+		s.Contains(errors[0].Error(), "must be a https URL")
+		s.Contains(errors[1].Error(), "clientID must be set")
+	})
+
+	s.T().Run("valid_admission", func(t *testing.T) {
+		a := APISpec{
+			Address: "1.2.3.4",
+			Admission: &AdmissionSpec{
+				EnabledPlugins:  []string{"EventRateLimit", "NodeRestriction"},
+				DisabledPlugins: []string{"DefaultStorageClass"},
+				Plugins: []AdmissionPluginConfig{
+					{
+						Name: "EventRateLimit",
+						Configuration: map[string]interface{}{
+							"apiVersion": "eventratelimit.admission.k8s.io/v1alpha1",
+							"kind":       "Configuration",
+						},
+					},
+				},
+			},
+		}
+
+		s.Nil(a.Validate())
+		s.Equal(map[string]string{
+			"enable-admission-plugins":  "NodeRestriction,EventRateLimit",
+			"disable-admission-plugins": "DefaultStorageClass",
+		}, a.Admission.APIServerArgs())
+	})
+
+	s.T().Run("invalid_admission", func(t *testing.T) {
+		a := APISpec{
+			Address: "1.2.3.4",
+			Admission: &AdmissionSpec{
+				EnabledPlugins:  []string{"EventRateLimit"},
+				DisabledPlugins: []string{"EventRateLimit", "NodeRestriction"},
+				Plugins: []AdmissionPluginConfig{
+					{
+						Name: "ImagePolicyWebhook",
+					},
+				},
+			},
+		}
+
+		errors := a.Validate()
+		s.Len(errors, 3)
+		s.Contains(errors[0].Error(), "cannot be both enabled and disabled")
+		s.Contains(errors[1].Error(), "cannot be disabled")
+		s.Contains(errors[2].Error(), "must have either path or configuration")
+	})
+
+	s.T().Run("custom_ports", func(t *testing.T) {
+		a := APISpec{
+			Address:         "1.2.3.4",
+			ExternalAddress: "cp.example.com",
+			Port:            443,
+			K0sAPIPort:      8443,
+		}
+
+		s.Nil(a.Validate())
+		s.Equal("https://cp.example.com:443", a.APIAddressURL())
+		s.Equal("https://cp.example.com:8443", a.K0sControlPlaneAPIAddress())
+		s.Equal("https://localhost:443", a.LocalURL())
+	})
+
+	s.T().Run("invalid_ports", func(t *testing.T) {
+		a := APISpec{
+			Address:    "1.2.3.4",
+			Port:       70000,
+			K0sAPIPort: 6443,
+		}
+
+		errors := a.Validate()
+		s.Len(errors, 2)
+		s.Contains(errors[0].Error(), "invalid api port")
+		s.Contains(errors[1].Error(), "must differ")
+	})
+
+	s.T().Run("join_rate_limit", func(t *testing.T) {
+		perMinute, burst := DefaultAPISpec().Join.Limits()
+		s.Equal(60, perMinute)
+		s.Equal(20, burst)
+
+		a := APISpec{Address: "1.2.3.4"}
+		perMinute, burst = a.Join.Limits()
+		s.Equal(60, perMinute)
+		s.Equal(20, burst)
+		s.False(a.Join.EventsEnabled())
+
+		a.Join = &JoinAPISpec{RateLimit: 10}
+		perMinute, burst = a.Join.Limits()
+		s.Equal(10, perMinute)
+		s.Equal(10, burst)
+
+		a.Join = &JoinAPISpec{RateLimit: -1, FailureEvents: true}
+		s.True(a.Join.EventsEnabled())
+		errors := a.Validate()
+		s.Len(errors, 1)
+		s.Contains(errors[0].Error(), "rateLimit")
+	})
 }
 
 func TestApiSuite(t *testing.T) {
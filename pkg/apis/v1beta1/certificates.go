@@ -0,0 +1,55 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+)
+
+// CertificatesSpec defines the lifetimes of the certificates issued by k0s
+type CertificatesSpec struct {
+	// CALifetime is the lifetime of the CAs generated by k0s
+	CALifetime time.Duration `yaml:"caLifetime"`
+	// Lifetime is the lifetime of the certificates issued by the CAs
+	Lifetime time.Duration `yaml:"lifetime"`
+}
+
+// DefaultCertificatesSpec default settings
+func DefaultCertificatesSpec() *CertificatesSpec {
+	return &CertificatesSpec{
+		CALifetime: 10 * 365 * 24 * time.Hour,
+		Lifetime:   365 * 24 * time.Hour,
+	}
+}
+
+// Validate validates the certificate lifetimes
+func (c *CertificatesSpec) Validate() []error {
+	if c == nil {
+		return nil
+	}
+	var errors []error
+	if c.CALifetime <= 0 {
+		errors = append(errors, fmt.Errorf("certificates: caLifetime must be positive, got %s", c.CALifetime))
+	}
+	if c.Lifetime <= 0 {
+		errors = append(errors, fmt.Errorf("certificates: lifetime must be positive, got %s", c.Lifetime))
+	}
+	if c.Lifetime > c.CALifetime {
+		errors = append(errors, fmt.Errorf("certificates: lifetime %s cannot be longer than caLifetime %s", c.Lifetime, c.CALifetime))
+	}
+	return errors
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+)
+
+// DefaultCloudConfigKey is the key of the cloud config in its secret when the key isn't given
+const DefaultCloudConfigKey = "cloud.conf"
+
+// CloudControllerManagerSpec defines the out-of-tree cloud controller manager k0s deploys. With it the kubelets run
+// with --cloud-provider=external.
+type CloudControllerManagerSpec struct {
+	// Image is the cloud controller manager image of the cloud provider
+	Image string `yaml:"image"`
+	// Provider is the --cloud-provider of the cloud controller manager, e.g. aws or openstack
+	Provider string `yaml:"provider"`
+	// CloudConfig is the secret in kube-system holding the cloud config, passed with --cloud-config
+	CloudConfig *CloudConfigSecretRef `yaml:"cloudConfig,omitempty"`
+	ExtraArgs   map[string]string     `yaml:"extraArgs,omitempty"`
+}
+
+// CloudConfigSecretRef refers to a key of a secret in kube-system
+type CloudConfigSecretRef struct {
+	SecretName string `yaml:"secretName"`
+	Key        string `yaml:"key,omitempty"`
+}
+
+// CloudControllerManager returns spec.extensions.cloudControllerManager, nil if the cloud controller manager isn't
+// deployed by k0s
+func (s *ClusterSpec) CloudControllerManager() *CloudControllerManagerSpec {
+	if s == nil || s.Extensions == nil {
+		return nil
+	}
+	return s.Extensions.CloudControllerManager
+}
+
+// CloudConfigKey returns the key of the cloud config in its secret
+func (c *CloudControllerManagerSpec) CloudConfigKey() string {
+	if c.CloudConfig == nil || c.CloudConfig.Key == "" {
+		return DefaultCloudConfigKey
+	}
+	return c.CloudConfig.Key
+}
+
+// Validate validates CloudControllerManagerSpec struct
+func (c *CloudControllerManagerSpec) Validate() []error {
+	if c == nil {
+		return nil
+	}
+	var errors []error
+	fieldError := func(field string, format string, args ...interface{}) {
+		errors = append(errors, &FieldError{Field: "spec.extensions.cloudControllerManager." + field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if c.Image == "" {
+		fieldError("image", "the cloud controller manager image must be set")
+	}
+	if c.Provider == "" {
+		fieldError("provider", "the cloud provider must be set")
+	}
+	if c.CloudConfig != nil && c.CloudConfig.SecretName == "" {
+		fieldError("cloudConfig.secretName", "the cloud config secret name must be set")
+	}
+	for _, name := range []string{"cloud-provider", "cloud-config"} {
+		if _, found := c.ExtraArgs[name]; found {
+			fieldError("extraArgs", "%s is set by k0s and cannot be set in extraArgs", name)
+		}
+	}
+
+	return errors
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 
@@ -51,26 +52,31 @@ type ClusterSpec struct {
 	Install           *InstallSpec           `yaml:"installConfig,omitempty"`
 	Images            *ClusterImages         `yaml:"images"`
 	Extensions        *ClusterExtensions     `yaml:"extensions,omitempty"`
-}
-
-// ControllerManagerSpec ...
-type ControllerManagerSpec struct {
-	ExtraArgs map[string]string `yaml:"extraArgs,omitempty"`
-}
-
-// IsZero needed to omit empty object from yaml output
-func (c *ControllerManagerSpec) IsZero() bool {
-	return len(c.ExtraArgs) == 0
+	FeatureGates      FeatureGates           `yaml:"featureGates,omitempty"`
+	Certificates      *CertificatesSpec      `yaml:"certificates,omitempty"`
+	CSRApprover       *CSRApproverSpec       `yaml:"csrApprover,omitempty"`
+	WorkloadSecurity  *WorkloadSecurity      `yaml:"workloadSecurity,omitempty"`
+	Hardening         *HardeningSpec         `yaml:"hardening,omitempty"`
+	Components        *ComponentsSpec        `yaml:"components,omitempty"`
+	Konnectivity      *KonnectivitySpec      `yaml:"konnectivity,omitempty"`
+	HostAliases       HostAliases            `yaml:"hostAliases,omitempty"`
+	Registries        Registries             `yaml:"registries,omitempty"`
+	PeerMirror        *PeerMirrorSpec        `yaml:"peerMirror,omitempty"`
+	NodeLabels        *NodeLabelsSpec        `yaml:"nodeLabels,omitempty"`
+	// Preset enables a named set of settings on top of the config, see preset.go
+	Preset string `yaml:"preset,omitempty"`
 }
 
 // SchedulerSpec ...
 type SchedulerSpec struct {
 	ExtraArgs map[string]string `yaml:"extraArgs,omitempty"`
+	// Config is a KubeSchedulerConfiguration, see scheduler.go
+	Config map[string]interface{} `yaml:"config,omitempty"`
 }
 
 // IsZero needed to omit empty object from yaml output
 func (s *SchedulerSpec) IsZero() bool {
-	return len(s.ExtraArgs) == 0
+	return len(s.ExtraArgs) == 0 && len(s.Config) == 0
 }
 
 // InstallSpec defines the required fields for the `k0s install` command
@@ -87,7 +93,49 @@ func (c *ClusterConfig) Validate() []error {
 	errors = append(errors, c.Spec.Network.Validate()...)
 	errors = append(errors, c.Spec.WorkerProfiles.Validate()...)
 	errors = append(errors, c.Spec.PodSecurityPolicy.Validate()...)
+	errors = append(errors, c.Spec.FeatureGates.Validate()...)
+	errors = append(errors, c.Spec.Certificates.Validate()...)
+	errors = append(errors, validatePreset(c.Spec.Preset)...)
+	errors = append(errors, c.Spec.Hardening.Validate()...)
+	errors = append(errors, c.Spec.Components.Validate()...)
+	errors = append(errors, c.Spec.Konnectivity.Validate()...)
+	errors = append(errors, c.Spec.HostAliases.Validate()...)
+	errors = append(errors, c.Spec.Registries.Validate()...)
+	errors = append(errors, c.Spec.PeerMirror.Validate()...)
+	errors = append(errors, c.Spec.NodeLabels.Validate()...)
+	errors = append(errors, c.Spec.ControllerManager.Validate()...)
+	errors = append(errors, c.Spec.CloudControllerManager().Validate()...)
+	errors = append(errors, c.Spec.Nvidia().Validate()...)
+	errors = append(errors, c.Spec.GitOps().Validate()...)
+	errors = append(errors, c.Spec.LocalPath().Validate()...)
+	errors = append(errors, c.Spec.Snapshotter().Validate()...)
+	errors = append(errors, c.Spec.Scheduler.Validate()...)
+	errors = append(errors, c.Spec.HelmExtensions().Validate()...)
+	if len(c.Spec.FeatureGates) > 0 {
+		errors = append(errors, c.Spec.validateFeatureGateExtraArgs()...)
+	}
+
+	return errors
+}
 
+// validateFeatureGateExtraArgs makes sure the feature gates are not set both in spec.featureGates and in the extraArgs
+func (s *ClusterSpec) validateFeatureGateExtraArgs() []error {
+	var errors []error
+	extraArgs := map[string]map[string]string{}
+	if s.API != nil {
+		extraArgs[APIServerComponent] = s.API.ExtraArgs
+	}
+	if s.ControllerManager != nil {
+		extraArgs[ControllerManagerComponent] = s.ControllerManager.ExtraArgs
+	}
+	if s.Scheduler != nil {
+		extraArgs[SchedulerComponent] = s.Scheduler.ExtraArgs
+	}
+	for _, component := range []string{APIServerComponent, ControllerManagerComponent, SchedulerComponent} {
+		if _, found := extraArgs[component]["feature-gates"]; found {
+			errors = append(errors, fmt.Errorf("%s: feature-gates cannot be set in extraArgs when spec.featureGates is used", component))
+		}
+	}
 	return errors
 }
 
@@ -111,10 +159,26 @@ func FromYamlPipe(r io.Reader, k0sVars constant.CfgVars) (*ClusterConfig, error)
 
 }
 
-// FromYamlString
+// FromYamlString parses the ClusterConfig, the YAML may have several documents but only one ClusterConfig
 func FromYamlString(yml string, k0sVars constant.CfgVars) (*ClusterConfig, error) {
+	docs := clusterConfigDocuments(yml)
+	if len(docs) > 1 {
+		return nil, fmt.Errorf("found %d ClusterConfig documents, only one is allowed", len(docs))
+	}
+	if len(docs) == 1 {
+		yml = docs[0].content
+	}
+	return fromYamlDocument(yml, k0sVars, false)
+}
+
+// fromYamlDocument parses a single ClusterConfig document, in strict mode unknown fields are errors
+func fromYamlDocument(yml string, k0sVars constant.CfgVars, strict bool) (*ClusterConfig, error) {
 	config := &ClusterConfig{k0sVars: k0sVars}
-	err := yaml.Unmarshal([]byte(yml), &config)
+	unmarshal := yaml.Unmarshal
+	if strict {
+		unmarshal = yaml.UnmarshalStrict
+	}
+	err := unmarshal([]byte(yml), &config)
 	if err != nil {
 		return config, err
 	}
@@ -172,5 +236,10 @@ func DefaultClusterSpec(k0sVars constant.CfgVars) *ClusterSpec {
 		Install:           DefaultInstallSpec(),
 		Images:            DefaultClusterImages(),
 		Telemetry:         DefaultClusterTelemetry(),
+		Certificates:      DefaultCertificatesSpec(),
+		CSRApprover:       DefaultCSRApproverSpec(),
+		WorkloadSecurity:  DefaultWorkloadSecurity(),
+		Components:        DefaultComponentsSpec(),
+		Konnectivity:      DefaultKonnectivitySpec(),
 	}
 }
@@ -17,6 +17,7 @@ package v1beta1
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
@@ -68,6 +69,30 @@ spec:
 	assert.Equal(t, addr, c.Spec.Storage.Etcd.PeerAddress)
 }
 
+func TestCertificateLifetimes(t *testing.T) {
+	yamlData := `
+apiVersion: k0s.k0sproject.io/v1beta1
+kind: Cluster
+metadata:
+  name: foobar
+spec:
+  certificates:
+    lifetime: 2160h
+`
+
+	c, err := fromYaml(t, yamlData)
+	assert.NoError(t, err)
+	assert.Equal(t, 90*24*time.Hour, c.Spec.Certificates.Lifetime)
+	assert.Equal(t, DefaultCertificatesSpec().CALifetime, c.Spec.Certificates.CALifetime)
+	assert.Empty(t, c.Spec.Certificates.Validate())
+
+	c.Spec.Certificates.Lifetime = 20 * 365 * 24 * time.Hour
+	assert.Len(t, c.Spec.Certificates.Validate(), 1)
+
+	c.Spec.Certificates.Lifetime = 0
+	assert.Len(t, c.Spec.Certificates.Validate(), 1)
+}
+
 func fromYaml(t *testing.T, yamlData string) (*ClusterConfig, error) {
 	config := &ClusterConfig{}
 	err := yaml.Unmarshal([]byte(yamlData), &config)
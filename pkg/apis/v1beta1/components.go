@@ -0,0 +1,55 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import "fmt"
+
+const (
+	// MetricsServerProvider deploys metrics-server as the metrics.k8s.io provider
+	MetricsServerProvider = "metrics-server"
+	// BuiltinMetricsProvider serves metrics.k8s.io from the controllers, see docs/configuration.md
+	BuiltinMetricsProvider = "builtin"
+)
+
+// ComponentsSpec selects the implementations of the optional system components
+type ComponentsSpec struct {
+	// Metrics is the provider of the resource metrics API, metrics-server or builtin
+	Metrics string `yaml:"metrics,omitempty"`
+}
+
+// DefaultComponentsSpec default settings
+func DefaultComponentsSpec() *ComponentsSpec {
+	return &ComponentsSpec{
+		Metrics: MetricsServerProvider,
+	}
+}
+
+// BuiltinMetrics tells if the resource metrics are served by the builtin aggregator
+func (c *ComponentsSpec) BuiltinMetrics() bool {
+	return c != nil && c.Metrics == BuiltinMetricsProvider
+}
+
+// Validate validates the component selection
+func (c *ComponentsSpec) Validate() []error {
+	if c == nil {
+		return nil
+	}
+	switch c.Metrics {
+	case "", MetricsServerProvider, BuiltinMetricsProvider:
+		return nil
+	}
+	return []error{fmt.Errorf("unknown metrics provider %q, supported providers: %s, %s", c.Metrics, MetricsServerProvider, BuiltinMetricsProvider)}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestComponentsSpec(t *testing.T) {
+	c := DefaultClusterConfig(constant.GetConfig(""))
+	assert.False(t, c.Spec.Components.BuiltinMetrics())
+	assert.Empty(t, c.Spec.Components.Validate())
+
+	c.Spec.Components.Metrics = BuiltinMetricsProvider
+	assert.True(t, c.Spec.Components.BuiltinMetrics())
+	assert.Empty(t, c.Spec.Components.Validate())
+
+	c.Spec.Components.Metrics = "heapster"
+	assert.Len(t, c.Spec.Components.Validate(), 1)
+
+	var nilSpec *ComponentsSpec
+	assert.False(t, nilSpec.BuiltinMetrics())
+	assert.Empty(t, nilSpec.Validate())
+}
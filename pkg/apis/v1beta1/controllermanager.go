@@ -0,0 +1,133 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ControllerManagerSpec ...
+type ControllerManagerSpec struct {
+	ExtraArgs map[string]string `yaml:"extraArgs,omitempty"`
+	// NodeMonitorGracePeriod is how long a node may stop posting its status before it's marked unhealthy
+	NodeMonitorGracePeriod string `yaml:"nodeMonitorGracePeriod,omitempty"`
+	// PodEvictionTimeout is the grace period for deleting the pods of failed nodes
+	PodEvictionTimeout string `yaml:"podEvictionTimeout,omitempty"`
+	// TerminatedPodGCThreshold is the number of terminated pods kept before they're garbage collected, zero disables
+	// the garbage collection
+	TerminatedPodGCThreshold *int `yaml:"terminatedPodGCThreshold,omitempty"`
+	// ConcurrentSyncs are the numbers of objects synced concurrently by the controllers, keyed by the controller
+	ConcurrentSyncs map[string]int `yaml:"concurrentSyncs,omitempty"`
+}
+
+// concurrentSyncFlags are the kube-controller-manager flags of the controllers supported in concurrentSyncs
+var concurrentSyncFlags = map[string]string{
+	"deployment":            "concurrent-deployment-syncs",
+	"endpoint":              "concurrent-endpoint-syncs",
+	"endpointSlice":         "concurrent-service-endpoint-syncs",
+	"garbageCollector":      "concurrent-gc-syncs",
+	"namespace":             "concurrent-namespace-syncs",
+	"replicaSet":            "concurrent-replicaset-syncs",
+	"replicationController": "concurrent_rc_syncs",
+	"resourceQuota":         "concurrent-resource-quota-syncs",
+	"service":               "concurrent-service-syncs",
+	"serviceAccountToken":   "concurrent-serviceaccount-token-syncs",
+	"statefulSet":           "concurrent-statefulset-syncs",
+	"ttlAfterFinished":      "concurrent-ttl-after-finished-syncs",
+}
+
+// IsZero needed to omit empty object from yaml output
+func (c *ControllerManagerSpec) IsZero() bool {
+	return len(c.ExtraArgs) == 0 && len(c.Args()) == 0
+}
+
+// Args returns the kube-controller-manager flags for the typed settings
+func (c *ControllerManagerSpec) Args() map[string]string {
+	args := make(map[string]string)
+	if c == nil {
+		return args
+	}
+	if c.NodeMonitorGracePeriod != "" {
+		args["node-monitor-grace-period"] = c.NodeMonitorGracePeriod
+	}
+	if c.PodEvictionTimeout != "" {
+		args["pod-eviction-timeout"] = c.PodEvictionTimeout
+	}
+	if c.TerminatedPodGCThreshold != nil {
+		args["terminated-pod-gc-threshold"] = strconv.Itoa(*c.TerminatedPodGCThreshold)
+	}
+	for controller, syncs := range c.ConcurrentSyncs {
+		if flag, ok := concurrentSyncFlags[controller]; ok {
+			args[flag] = strconv.Itoa(syncs)
+		}
+	}
+	return args
+}
+
+// Validate validates the typed settings, they can't be set in the extraArgs too
+func (c *ControllerManagerSpec) Validate() []error {
+	if c == nil {
+		return nil
+	}
+	var errors []error
+	fieldError := func(field string, format string, args ...interface{}) {
+		errors = append(errors, &FieldError{Field: "spec.controllerManager." + field, Err: fmt.Errorf(format, args...)})
+	}
+
+	for _, duration := range []struct{ field, value string }{
+		{"nodeMonitorGracePeriod", c.NodeMonitorGracePeriod},
+		{"podEvictionTimeout", c.PodEvictionTimeout},
+	} {
+		if duration.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(duration.value); err != nil || d <= 0 {
+			fieldError(duration.field, "%q is not a positive duration", duration.value)
+		}
+	}
+	if c.TerminatedPodGCThreshold != nil && *c.TerminatedPodGCThreshold < 0 {
+		fieldError("terminatedPodGCThreshold", "must not be negative")
+	}
+
+	controllers := make([]string, 0, len(c.ConcurrentSyncs))
+	for controller := range c.ConcurrentSyncs {
+		controllers = append(controllers, controller)
+	}
+	sort.Strings(controllers)
+	for _, controller := range controllers {
+		if _, ok := concurrentSyncFlags[controller]; !ok {
+			fieldError("concurrentSyncs."+controller, "unknown controller")
+		} else if c.ConcurrentSyncs[controller] < 1 {
+			fieldError("concurrentSyncs."+controller, "must be at least 1")
+		}
+	}
+
+	var flags []string
+	for flag := range c.Args() {
+		if _, found := c.ExtraArgs[flag]; found {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		fieldError("extraArgs", "%s is set by the typed settings and cannot be set in extraArgs", flag)
+	}
+
+	return errors
+}
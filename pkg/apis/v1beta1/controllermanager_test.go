@@ -0,0 +1,82 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControllerManagerArgs(t *testing.T) {
+	threshold := 100
+	c := &ControllerManagerSpec{
+		NodeMonitorGracePeriod:   "20s",
+		TerminatedPodGCThreshold: &threshold,
+		ConcurrentSyncs: map[string]int{
+			"deployment":            10,
+			"replicationController": 8,
+		},
+	}
+	assert.Empty(t, c.Validate())
+	assert.Equal(t, map[string]string{
+		"node-monitor-grace-period":   "20s",
+		"terminated-pod-gc-threshold": "100",
+		"concurrent-deployment-syncs": "10",
+		"concurrent_rc_syncs":         "8",
+	}, c.Args())
+}
+
+func TestControllerManagerValidation(t *testing.T) {
+	threshold := -1
+	c := &ControllerManagerSpec{
+		ExtraArgs:                map[string]string{"pod-eviction-timeout": "1m"},
+		NodeMonitorGracePeriod:   "soon",
+		PodEvictionTimeout:       "2m",
+		TerminatedPodGCThreshold: &threshold,
+		ConcurrentSyncs: map[string]int{
+			"cronJob":    5,
+			"deployment": 0,
+		},
+	}
+	errors := c.Validate()
+	require.Len(t, errors, 5)
+	var fields []string
+	for _, err := range errors {
+		fields = append(fields, err.(*FieldError).Field)
+	}
+	assert.Equal(t, []string{
+		"spec.controllerManager.nodeMonitorGracePeriod",
+		"spec.controllerManager.terminatedPodGCThreshold",
+		"spec.controllerManager.concurrentSyncs.cronJob",
+		"spec.controllerManager.concurrentSyncs.deployment",
+		"spec.controllerManager.extraArgs",
+	}, fields)
+}
+
+func TestControllerManagerHardening(t *testing.T) {
+	threshold := 50
+	spec := &ClusterSpec{
+		API:               DefaultAPISpec(),
+		ControllerManager: &ControllerManagerSpec{TerminatedPodGCThreshold: &threshold},
+		Hardening:         &HardeningSpec{Profile: CISHardeningProfile},
+	}
+	spec.ApplyHardening()
+	_, found := spec.ControllerManager.ExtraArgs["terminated-pod-gc-threshold"]
+	assert.False(t, found)
+	assert.Empty(t, spec.ControllerManager.Validate())
+}
@@ -23,6 +23,28 @@ type CaResponse struct {
 	Cert  []byte `json:"cert"`
 	SAKey []byte `json:"saKey"`
 	SAPub []byte `json:"saPub"`
+	// APICAKey and APICACert are the CA of the k0s API client certificates
+	APICAKey  []byte `json:"apiCaKey,omitempty"`
+	APICACert []byte `json:"apiCaCert,omitempty"`
+}
+
+// ClientCertRequest defines the request type for /certificates/client control API
+type ClientCertRequest struct {
+	// CSR is the PEM encoded certificate signing request, its subject is set by the API based on the role of the join token
+	CSR []byte `json:"csr"`
+}
+
+// ClientCertResponse defines the response type for /certificates/client control API
+type ClientCertResponse struct {
+	Cert []byte `json:"cert"`
+}
+
+// Validate validates the request
+func (c *ClientCertRequest) Validate() error {
+	if len(c.CSR) == 0 {
+		return fmt.Errorf("csr cannot be empty")
+	}
+	return nil
 }
 
 // EtcdRequest defines the etcd control api request structure
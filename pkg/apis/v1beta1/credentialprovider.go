@@ -0,0 +1,146 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+const (
+	// CredentialProviderAPIVersion is the only version of the exec plugin API of the bundled kubelet
+	CredentialProviderAPIVersion = "credentialprovider.kubelet.k8s.io/v1alpha1"
+	// DefaultCredentialProviderCacheDuration is the cache duration of the credentials the plugins return without one
+	DefaultCredentialProviderCacheDuration = "10m"
+)
+
+// KubeletCredentialProviders configures the exec plugins kubelet fetches the image pull credentials with, e.g. from
+// ECR, GCR or ACR, instead of a static docker config on the nodes
+type KubeletCredentialProviders struct {
+	// BinDir is the directory of the plugin binaries on the workers
+	BinDir    string                      `yaml:"binDir,omitempty"`
+	Providers []KubeletCredentialProvider `yaml:"providers"`
+}
+
+// KubeletCredentialProvider is an exec plugin of kubelet
+type KubeletCredentialProvider struct {
+	// Name is the name of the plugin binary in the bin directory
+	Name string `yaml:"name"`
+	// MatchImages are the patterns of the images the plugin is used for, e.g. *.dkr.ecr.*.amazonaws.com
+	MatchImages          []string                       `yaml:"matchImages"`
+	DefaultCacheDuration string                         `yaml:"defaultCacheDuration,omitempty"`
+	APIVersion           string                         `yaml:"apiVersion,omitempty"`
+	Args                 []string                       `yaml:"args,omitempty"`
+	Env                  []KubeletCredentialProviderEnv `yaml:"env,omitempty"`
+}
+
+// KubeletCredentialProviderEnv is an environment variable of the plugin
+type KubeletCredentialProviderEnv struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// GetBinDir returns the plugin directory, the default one if not set
+func (c *KubeletCredentialProviders) GetBinDir() string {
+	if c.BinDir != "" {
+		return c.BinDir
+	}
+	return constant.KubeletCredentialProviderBinDir
+}
+
+// Validate validates the plugins like kubelet does when starting
+func (c *KubeletCredentialProviders) Validate() error {
+	if c.BinDir != "" && !filepath.IsAbs(c.BinDir) && !strings.HasPrefix(c.BinDir, "C:\\") {
+		return fmt.Errorf("binDir must be an absolute path")
+	}
+	if len(c.Providers) == 0 {
+		return fmt.Errorf("no providers given")
+	}
+	names := make(map[string]bool)
+	for _, p := range c.Providers {
+		if p.Name == "" || strings.ContainsAny(p.Name, "/\\") || p.Name == "." || p.Name == ".." {
+			return fmt.Errorf("invalid provider name %q, must be the name of the plugin binary", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate provider %s", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("provider %s: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *KubeletCredentialProvider) validate() error {
+	if len(p.MatchImages) == 0 {
+		return fmt.Errorf("matchImages is required")
+	}
+	for _, image := range p.MatchImages {
+		if image == "" || strings.Contains(image, "://") {
+			return fmt.Errorf("invalid matchImages pattern %q, must be like *.dkr.ecr.*.amazonaws.com or registry.local:5000/team", image)
+		}
+	}
+	if p.DefaultCacheDuration != "" {
+		if d, err := time.ParseDuration(p.DefaultCacheDuration); err != nil || d < 0 {
+			return fmt.Errorf("invalid defaultCacheDuration %q", p.DefaultCacheDuration)
+		}
+	}
+	if p.APIVersion != "" && p.APIVersion != CredentialProviderAPIVersion {
+		return fmt.Errorf("apiVersion must be %s", CredentialProviderAPIVersion)
+	}
+	for _, env := range p.Env {
+		if env.Name == "" || strings.Contains(env.Name, "=") {
+			return fmt.Errorf("invalid env name %q", env.Name)
+		}
+	}
+	return nil
+}
+
+// CredentialProviderConfig renders the CredentialProviderConfig file of kubelet
+func (c *KubeletCredentialProviders) CredentialProviderConfig() map[string]interface{} {
+	providers := make([]map[string]interface{}, 0, len(c.Providers))
+	for _, p := range c.Providers {
+		provider := map[string]interface{}{
+			"name":                 p.Name,
+			"matchImages":          p.MatchImages,
+			"defaultCacheDuration": p.DefaultCacheDuration,
+			"apiVersion":           p.APIVersion,
+		}
+		if p.DefaultCacheDuration == "" {
+			provider["defaultCacheDuration"] = DefaultCredentialProviderCacheDuration
+		}
+		if p.APIVersion == "" {
+			provider["apiVersion"] = CredentialProviderAPIVersion
+		}
+		if len(p.Args) > 0 {
+			provider["args"] = p.Args
+		}
+		if len(p.Env) > 0 {
+			provider["env"] = p.Env
+		}
+		providers = append(providers, provider)
+	}
+	return map[string]interface{}{
+		"apiVersion": "kubelet.config.k8s.io/v1alpha1",
+		"kind":       "CredentialProviderConfig",
+		"providers":  providers,
+	}
+}
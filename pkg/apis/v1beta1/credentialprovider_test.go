@@ -0,0 +1,81 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestKubeletCredentialProvidersValidate(t *testing.T) {
+	ecr := KubeletCredentialProvider{
+		Name:        "ecr-credential-provider",
+		MatchImages: []string{"*.dkr.ecr.*.amazonaws.com", "*.dkr.ecr.*.amazonaws.com.cn"},
+	}
+	cases := []struct {
+		name      string
+		providers KubeletCredentialProviders
+		valid     bool
+	}{
+		{"valid", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{ecr}}, true},
+		{"no providers", KubeletCredentialProviders{}, false},
+		{"relative bin dir", KubeletCredentialProviders{BinDir: "plugins", Providers: []KubeletCredentialProvider{ecr}}, false},
+		{"duplicate", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{ecr, ecr}}, false},
+		{"path as name", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{{Name: "/usr/bin/plugin", MatchImages: ecr.MatchImages}}}, false},
+		{"no match images", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{{Name: "plugin"}}}, false},
+		{"url as match image", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{{Name: "plugin", MatchImages: []string{"https://gcr.io"}}}}, false},
+		{"invalid cache duration", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{{Name: "plugin", MatchImages: []string{"gcr.io"}, DefaultCacheDuration: "1 hour"}}}, false},
+		{"other api version", KubeletCredentialProviders{Providers: []KubeletCredentialProvider{{Name: "plugin", MatchImages: []string{"gcr.io"}, APIVersion: "credentialprovider.kubelet.k8s.io/v1"}}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.providers.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCredentialProviderConfig(t *testing.T) {
+	providers := KubeletCredentialProviders{Providers: []KubeletCredentialProvider{{
+		Name:        "acr-credential-provider",
+		MatchImages: []string{"*.azurecr.io"},
+		Args:        []string{"/etc/kubernetes/azure.json"},
+		Env:         []KubeletCredentialProviderEnv{{Name: "AZURE_ENVIRONMENT", Value: "AzurePublicCloud"}},
+	}}}
+	data, err := yaml.Marshal(providers.CredentialProviderConfig())
+	assert.NoError(t, err)
+	assert.YAMLEq(t, `apiVersion: kubelet.config.k8s.io/v1alpha1
+kind: CredentialProviderConfig
+providers:
+- name: acr-credential-provider
+  matchImages: ["*.azurecr.io"]
+  defaultCacheDuration: 10m
+  apiVersion: credentialprovider.kubelet.k8s.io/v1alpha1
+  args: [/etc/kubernetes/azure.json]
+  env:
+  - name: AZURE_ENVIRONMENT
+    value: AzurePublicCloud
+`, string(data))
+	assert.Equal(t, constant.KubeletCredentialProviderBinDir, providers.GetBinDir())
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+// CSRApproverSpec defines how k0s approves the kubelet certificate requests
+type CSRApproverSpec struct {
+	// Strict makes k0s approve a request only when its SANs are addresses of the requesting node and the node has joined the cluster with a join token
+	Strict bool `yaml:"strict"`
+	// TPMAttestation makes k0s sign kubelet client certificates only for nodes attested with an enrolled TPM key, see docs/tpm-attestation.md
+	TPMAttestation bool `yaml:"tpmAttestation"`
+}
+
+// DefaultCSRApproverSpec default settings
+func DefaultCSRApproverSpec() *CSRApproverSpec {
+	return &CSRApproverSpec{
+		Strict:         false,
+		TPMAttestation: false,
+	}
+}
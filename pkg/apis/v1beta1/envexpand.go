@@ -0,0 +1,51 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/k0sproject/k0s/internal/util"
+)
+
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces the ${VAR} references in the config with the values of the environment variables, $${ is a
+// literal ${. Referencing an unset variable is an error, so that a missing value doesn't silently end up empty.
+func ExpandEnv(yml string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(yml, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		name := ref[2 : len(ref)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if !util.StringSliceContains(missing, name) {
+				missing = append(missing, name)
+			}
+			return ref
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("the config references unset environment variables: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
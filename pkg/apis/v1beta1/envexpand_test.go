@@ -0,0 +1,44 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	require.NoError(t, os.Setenv("K0S_TEST_ADDRESS", "10.0.0.1"))
+	defer os.Unsetenv("K0S_TEST_ADDRESS")
+
+	expanded, err := ExpandEnv(`spec:
+  api:
+    address: ${K0S_TEST_ADDRESS}
+    sans: ["${K0S_TEST_ADDRESS}", "$K0S_TEST_ADDRESS", "$${K0S_TEST_ADDRESS}"]
+`)
+	require.NoError(t, err)
+	assert.Equal(t, `spec:
+  api:
+    address: 10.0.0.1
+    sans: ["10.0.0.1", "$K0S_TEST_ADDRESS", "${K0S_TEST_ADDRESS}"]
+`, expanded)
+
+	_, err = ExpandEnv("address: ${K0S_TEST_UNSET}\nsans: [${K0S_TEST_UNSET}, ${K0S_TEST_ALSO_UNSET}]")
+	assert.EqualError(t, err, "the config references unset environment variables: K0S_TEST_UNSET, K0S_TEST_ALSO_UNSET")
+}
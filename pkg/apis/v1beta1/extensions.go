@@ -15,15 +15,101 @@ limitations under the License.
 */
 package v1beta1
 
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
 // ClusterExtensions specifies cluster extensions
 type ClusterExtensions struct {
-	Helm *HelmExtensions `yaml:"helm"`
+	Helm                   *HelmExtensions             `yaml:"helm"`
+	CloudControllerManager *CloudControllerManagerSpec `yaml:"cloudControllerManager,omitempty"`
+	Nvidia                 *NvidiaSpec                 `yaml:"nvidia,omitempty"`
+	GitOps                 *GitOpsSpec                 `yaml:"gitops,omitempty"`
+	LocalPath              *LocalPathSpec              `yaml:"localPath,omitempty"`
+	Snapshotter            *SnapshotterSpec            `yaml:"snapshotter,omitempty"`
 }
 
 // HelmExtensions specifies settings for cluster helm based extensions
 type HelmExtensions struct {
 	Repositories []Repository `yaml:"repositories"`
 	Charts       []Chart      `yaml:"charts"`
+	// DriftDetection periodically compares the resources of the chart releases with the cluster
+	DriftDetection *HelmDriftDetection `yaml:"driftDetection,omitempty"`
+}
+
+// HelmExtensions returns the helm repositories and charts to deploy, spec.extensions.helm with the charts of the
+// other extensions added. Nil if there's nothing to deploy.
+func (s *ClusterSpec) HelmExtensions() *HelmExtensions {
+	var helm *HelmExtensions
+	if s != nil && s.Extensions != nil && s.Extensions.Helm != nil {
+		helm = &HelmExtensions{
+			Repositories:   append([]Repository(nil), s.Extensions.Helm.Repositories...),
+			Charts:         append([]Chart(nil), s.Extensions.Helm.Charts...),
+			DriftDetection: s.Extensions.Helm.DriftDetection,
+		}
+	}
+	add := func(repository Repository, chart Chart) {
+		if helm == nil {
+			helm = &HelmExtensions{}
+		}
+		helm.Repositories = append(helm.Repositories, repository)
+		helm.Charts = append(helm.Charts, chart)
+	}
+
+	if n := s.Nvidia(); n != nil && n.GPUOperator != nil {
+		add(n.GPUOperator.chart())
+	}
+	if g := s.GitOps(); g != nil {
+		// an invalid spec is rejected by the validation
+		if repository, chart, err := g.chart(); err == nil {
+			add(repository, chart)
+		}
+	}
+
+	return helm
+}
+
+// Drift corrections of the helm extensions
+const (
+	// DriftCorrectionNone only reports the drift in the status of the Chart objects
+	DriftCorrectionNone = "none"
+	// DriftCorrectionPatch upgrades the release in place, helm three-way patches the changed resources back
+	DriftCorrectionPatch = "patch"
+	// DriftCorrectionForce upgrades the release with --force, replacing the changed resources
+	DriftCorrectionForce = "force"
+
+	// DefaultDriftDetectionInterval is the interval of the drift detection if none is given
+	DefaultDriftDetectionInterval = "5m"
+)
+
+// HelmDriftDetection configures the detection and correction of changes made to the resources of the chart
+// releases outside of helm
+type HelmDriftDetection struct {
+	// Interval between the checks, defaults to 5m
+	Interval string `yaml:"interval,omitempty"`
+	// Correction is none, patch or force, defaults to none
+	Correction string `yaml:"correction,omitempty"`
+}
+
+// IntervalDuration returns the interval between the drift checks
+func (d *HelmDriftDetection) IntervalDuration() time.Duration {
+	interval, err := time.ParseDuration(d.Interval)
+	if err != nil || interval <= 0 {
+		interval, _ = time.ParseDuration(DefaultDriftDetectionInterval)
+	}
+	return interval
+}
+
+// CorrectionOrDefault returns the drift correction, none unless set
+func (d *HelmDriftDetection) CorrectionOrDefault() string {
+	if d.Correction == "" {
+		return DriftCorrectionNone
+	}
+	return d.Correction
 }
 
 // Chart single helm addon
@@ -33,6 +119,165 @@ type Chart struct {
 	Version   string `yaml:"version"`
 	Values    string `yaml:"values"`
 	TargetNS  string `yaml:"namespace"`
+	// ValuesFrom are merged in order, the inline values on top of them
+	ValuesFrom []ValuesReference `yaml:"valuesFrom,omitempty"`
+	// DependsOn are the names of the charts which must be deployed and ready before this one is installed
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+	// Timeout of waiting for the resources and hooks on install and upgrade, e.g. 10m
+	Timeout string `yaml:"timeout,omitempty"`
+	// Atomic uninstalls a failed install and rolls back a failed upgrade, it implies wait
+	Atomic bool `yaml:"atomic,omitempty"`
+	// Wait for the resources to be ready before marking the release successful
+	Wait bool `yaml:"wait,omitempty"`
+	// SkipCRDs skips installing the CRDs of the chart
+	SkipCRDs bool `yaml:"skipCRDs,omitempty"`
+	// DisableHooks skips running the hooks of the chart
+	DisableHooks bool `yaml:"disableHooks,omitempty"`
+	// UninstallPolicy tells what happens to the release when the chart is removed: Uninstall, Orphan or KeepCRDs,
+	// defaults to Uninstall
+	UninstallPolicy string `yaml:"uninstallPolicy,omitempty"`
+}
+
+// Uninstall policies of the charts
+const (
+	// UninstallPolicyUninstall uninstalls the release of a removed chart
+	UninstallPolicyUninstall = "Uninstall"
+	// UninstallPolicyOrphan keeps the release of a removed chart, it's no longer managed by k0s
+	UninstallPolicyOrphan = "Orphan"
+	// UninstallPolicyKeepCRDs uninstalls the release of a removed chart but keeps its CRDs and so the custom resources
+	UninstallPolicyKeepCRDs = "KeepCRDs"
+)
+
+// Values reference kinds
+const (
+	ValuesFromSecret    = "Secret"
+	ValuesFromConfigMap = "ConfigMap"
+)
+
+// ValuesReference references chart values kept outside of the cluster config, either in a key of an in-cluster
+// Secret or ConfigMap or in a local file on the controllers
+type ValuesReference struct {
+	// Kind is Secret or ConfigMap, empty for a local file
+	Kind string `yaml:"kind,omitempty"`
+	// Name is the name of the Secret or ConfigMap
+	Name string `yaml:"name,omitempty"`
+	// Namespace of the Secret or ConfigMap, defaults to kube-system
+	Namespace string `yaml:"namespace,omitempty"`
+	// Key holding the values in the Secret or ConfigMap, defaults to values.yaml
+	Key string `yaml:"key,omitempty"`
+	// File is the absolute path of a local values file, which must exist on all the controllers
+	File string `yaml:"file,omitempty"`
+	// Optional tells to skip the reference if the values aren't found instead of failing the chart
+	Optional bool `yaml:"optional,omitempty"`
+}
+
+// Validate validates the charts of the helm extensions
+func (h *HelmExtensions) Validate() []error {
+	if h == nil {
+		return nil
+	}
+	var errors []error
+	for i, repo := range h.Repositories {
+		errors = append(errors, repo.validate(fmt.Sprintf("spec.extensions.helm.repositories[%d]", i))...)
+	}
+	if d := h.DriftDetection; d != nil {
+		if d.Interval != "" {
+			if interval, err := time.ParseDuration(d.Interval); err != nil || interval <= 0 {
+				errors = append(errors, fmt.Errorf("spec.extensions.helm.driftDetection.interval: invalid interval %q", d.Interval))
+			}
+		}
+		switch d.CorrectionOrDefault() {
+		case DriftCorrectionNone, DriftCorrectionPatch, DriftCorrectionForce:
+		default:
+			errors = append(errors, fmt.Errorf("spec.extensions.helm.driftDetection.correction: unsupported correction %q, must be %s, %s or %s", d.Correction, DriftCorrectionNone, DriftCorrectionPatch, DriftCorrectionForce))
+		}
+	}
+	for _, chart := range h.Charts {
+		if chart.Timeout != "" {
+			if timeout, err := time.ParseDuration(chart.Timeout); err != nil || timeout <= 0 {
+				errors = append(errors, fmt.Errorf("spec.extensions.helm.charts[%s].timeout: invalid timeout %q", chart.Name, chart.Timeout))
+			}
+		}
+		switch chart.UninstallPolicy {
+		case "", UninstallPolicyUninstall, UninstallPolicyOrphan, UninstallPolicyKeepCRDs:
+		default:
+			errors = append(errors, fmt.Errorf("spec.extensions.helm.charts[%s].uninstallPolicy: unsupported policy %q, must be %s, %s or %s", chart.Name, chart.UninstallPolicy, UninstallPolicyUninstall, UninstallPolicyOrphan, UninstallPolicyKeepCRDs))
+		}
+		if strings.HasPrefix(chart.ChartName, OCIScheme) && chart.Version == "" {
+			errors = append(errors, fmt.Errorf("spec.extensions.helm.charts[%s].version: version is required for an OCI chart", chart.Name))
+		}
+		for i, ref := range chart.ValuesFrom {
+			field := fmt.Sprintf("spec.extensions.helm.charts[%s].valuesFrom[%d]", chart.Name, i)
+			switch ref.Kind {
+			case ValuesFromSecret, ValuesFromConfigMap:
+				if ref.Name == "" {
+					errors = append(errors, fmt.Errorf("%s: name is required for a %s", field, ref.Kind))
+				}
+				if ref.File != "" {
+					errors = append(errors, fmt.Errorf("%s: file can't be set for a %s", field, ref.Kind))
+				}
+			case "":
+				if !filepath.IsAbs(ref.File) {
+					errors = append(errors, fmt.Errorf("%s: either kind or an absolute file path is required", field))
+				}
+			default:
+				errors = append(errors, fmt.Errorf("%s: unsupported kind %q, must be %s or %s", field, ref.Kind, ValuesFromSecret, ValuesFromConfigMap))
+			}
+		}
+	}
+	return append(errors, h.validateDependencies()...)
+}
+
+// validateDependencies checks that the charts depend only on other existing charts, without cycles
+func (h *HelmExtensions) validateDependencies() []error {
+	var errors []error
+	dependencies := make(map[string][]string, len(h.Charts))
+	for _, chart := range h.Charts {
+		dependencies[chart.Name] = chart.DependsOn
+	}
+	for _, chart := range h.Charts {
+		for _, dependency := range chart.DependsOn {
+			field := fmt.Sprintf("spec.extensions.helm.charts[%s].dependsOn", chart.Name)
+			if dependency == chart.Name {
+				errors = append(errors, fmt.Errorf("%s: chart can't depend on itself", field))
+			} else if _, ok := dependencies[dependency]; !ok {
+				errors = append(errors, fmt.Errorf("%s: unknown chart %q", field, dependency))
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return errors
+	}
+
+	// the charts are visited depth first, a chart still in progress when reached again closes a cycle
+	const (
+		inProgress = 1
+		done       = 2
+	)
+	state := make(map[string]int, len(h.Charts))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case inProgress:
+			return fmt.Errorf("spec.extensions.helm.charts[%s].dependsOn: dependency cycle %s", name, strings.Join(append(path, name), " -> "))
+		case done:
+			return nil
+		}
+		state[name] = inProgress
+		for _, dependency := range dependencies[name] {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, chart := range h.Charts {
+		if err := visit(chart.Name, nil); err != nil {
+			return []error{err}
+		}
+	}
+	return nil
 }
 
 // Repository describes single repository entry. Fields map to the CLI flags for the "helm add" command
@@ -45,4 +290,41 @@ type Repository struct {
 	KeyFile  string `yaml:"keyfile"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// CA is a PEM encoded CA bundle of the repository, an alternative to caFile
+	CA string `yaml:"ca,omitempty"`
+	// Auth refers to the credentials of the repository in the docker config.json format, an alternative to
+	// username and password
+	Auth *RegistryAuth `yaml:"auth,omitempty"`
+}
+
+// OCIScheme is the URL scheme of the charts and repositories in OCI registries
+const OCIScheme = "oci://"
+
+// IsOCI tells if the repository is an OCI registry instead of a chart repository with an index
+func (r Repository) IsOCI() bool {
+	return strings.HasPrefix(r.URL, OCIScheme)
+}
+
+func (r Repository) validate(field string) []error {
+	var errors []error
+	if r.Name == "" {
+		errors = append(errors, fmt.Errorf("%s.name: name is required", field))
+	}
+	if u, err := url.Parse(r.URL); err != nil || u.Host == "" {
+		errors = append(errors, fmt.Errorf("%s.url: invalid repository url %q", field, r.URL))
+	} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "oci" {
+		errors = append(errors, fmt.Errorf("%s.url: unsupported scheme %q, must be http, https or oci", field, u.Scheme))
+	}
+	if r.CA != "" && r.CAFile != "" {
+		errors = append(errors, fmt.Errorf("%s: ca and caFile are mutually exclusive", field))
+	}
+	if r.Auth != nil {
+		if (r.Auth.File == "") == (r.Auth.SecretRef == "") {
+			errors = append(errors, fmt.Errorf("%s.auth: exactly one of file or secretRef is required", field))
+		}
+		if r.Username != "" || r.Password != "" {
+			errors = append(errors, fmt.Errorf("%s: auth and username/password are mutually exclusive", field))
+		}
+	}
+	return errors
 }
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHelmExtensionsValidateValuesFrom(t *testing.T) {
+	helm := &HelmExtensions{Charts: []Chart{{
+		Name: "app",
+		ValuesFrom: []ValuesReference{
+			{Kind: "Secret", Name: "creds"},
+			{File: "/etc/k0s/app-values.yaml"},
+			{Kind: "ConfigMap"},
+			{Kind: "Secret", Name: "creds", File: "/etc/k0s/app-values.yaml"},
+			{File: "relative.yaml"},
+			{Kind: "Pod", Name: "app"},
+		},
+	}}}
+	errors := helm.Validate()
+	if assert.Len(t, errors, 4) {
+		assert.EqualError(t, errors[0], "spec.extensions.helm.charts[app].valuesFrom[2]: name is required for a ConfigMap")
+		assert.EqualError(t, errors[1], "spec.extensions.helm.charts[app].valuesFrom[3]: file can't be set for a Secret")
+		assert.Contains(t, errors[2].Error(), "valuesFrom[4]: either kind or an absolute file path is required")
+		assert.Contains(t, errors[3].Error(), `unsupported kind "Pod"`)
+	}
+
+	var none *HelmExtensions
+	assert.Empty(t, none.Validate())
+}
+
+func TestHelmExtensionsValidateRepositories(t *testing.T) {
+	helm := &HelmExtensions{
+		Repositories: []Repository{
+			{Name: "stable", URL: "https://charts.helm.sh/stable"},
+			{Name: "private", URL: "oci://registry.example.com/charts", Auth: &RegistryAuth{SecretRef: "registry-creds"}},
+			{Name: "ftp", URL: "ftp://example.com/charts"},
+			{Name: "both", URL: "https://example.com", CA: "pem", CAFile: "/etc/ssl/ca.pem"},
+			{Name: "auth", URL: "https://example.com", Username: "user", Auth: &RegistryAuth{}},
+		},
+		Charts: []Chart{
+			{Name: "app", ChartName: "oci://registry.example.com/charts/app"},
+		},
+	}
+	errors := helm.Validate()
+	if assert.Len(t, errors, 5) {
+		assert.EqualError(t, errors[0], `spec.extensions.helm.repositories[2].url: unsupported scheme "ftp", must be http, https or oci`)
+		assert.EqualError(t, errors[1], "spec.extensions.helm.repositories[3]: ca and caFile are mutually exclusive")
+		assert.EqualError(t, errors[2], "spec.extensions.helm.repositories[4].auth: exactly one of file or secretRef is required")
+		assert.EqualError(t, errors[3], "spec.extensions.helm.repositories[4]: auth and username/password are mutually exclusive")
+		assert.EqualError(t, errors[4], "spec.extensions.helm.charts[app].version: version is required for an OCI chart")
+	}
+}
+
+func TestHelmExtensionsValidateDependencies(t *testing.T) {
+	helm := &HelmExtensions{Charts: []Chart{
+		{Name: "cert-manager"},
+		{Name: "app", DependsOn: []string{"cert-manager", "database"}},
+		{Name: "self", DependsOn: []string{"self"}},
+	}}
+	errors := helm.Validate()
+	if assert.Len(t, errors, 2) {
+		assert.EqualError(t, errors[0], `spec.extensions.helm.charts[app].dependsOn: unknown chart "database"`)
+		assert.EqualError(t, errors[1], "spec.extensions.helm.charts[self].dependsOn: chart can't depend on itself")
+	}
+
+	helm = &HelmExtensions{Charts: []Chart{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"c"}},
+		{Name: "c", DependsOn: []string{"a"}},
+		{Name: "d", DependsOn: []string{"a"}},
+	}}
+	errors = helm.Validate()
+	if assert.Len(t, errors, 1) {
+		assert.EqualError(t, errors[0], "spec.extensions.helm.charts[a].dependsOn: dependency cycle a -> b -> c -> a")
+	}
+
+	helm = &HelmExtensions{Charts: []Chart{
+		{Name: "a", DependsOn: []string{"b", "c"}},
+		{Name: "b", DependsOn: []string{"c"}},
+		{Name: "c"},
+	}}
+	assert.Empty(t, helm.Validate())
+}
+
+func TestHelmExtensionsValidateDriftDetection(t *testing.T) {
+	helm := &HelmExtensions{DriftDetection: &HelmDriftDetection{Interval: "-1m", Correction: "rollback"}}
+	errors := helm.Validate()
+	if assert.Len(t, errors, 2) {
+		assert.EqualError(t, errors[0], `spec.extensions.helm.driftDetection.interval: invalid interval "-1m"`)
+		assert.EqualError(t, errors[1], `spec.extensions.helm.driftDetection.correction: unsupported correction "rollback", must be none, patch or force`)
+	}
+
+	drift := &HelmDriftDetection{}
+	assert.Empty(t, (&HelmExtensions{DriftDetection: drift}).Validate())
+	assert.Equal(t, 5*time.Minute, drift.IntervalDuration())
+	assert.Equal(t, DriftCorrectionNone, drift.CorrectionOrDefault())
+}
+
+func TestHelmExtensionsValidateTimeout(t *testing.T) {
+	helm := &HelmExtensions{Charts: []Chart{{Name: "app", Timeout: "10m"}, {Name: "other", Timeout: "ten"}}}
+	errors := helm.Validate()
+	if assert.Len(t, errors, 1) {
+		assert.EqualError(t, errors[0], `spec.extensions.helm.charts[other].timeout: invalid timeout "ten"`)
+	}
+}
+
+func TestHelmExtensionsValidateUninstallPolicy(t *testing.T) {
+	helm := &HelmExtensions{Charts: []Chart{
+		{Name: "app", UninstallPolicy: UninstallPolicyKeepCRDs},
+		{Name: "other", UninstallPolicy: "Delete"},
+	}}
+	errors := helm.Validate()
+	if assert.Len(t, errors, 1) {
+		assert.EqualError(t, errors[0], `spec.extensions.helm.charts[other].uninstallPolicy: unsupported policy "Delete", must be Uninstall, Orphan or KeepCRDs`)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Components accepting feature gates
+const (
+	APIServerComponent         = "kube-apiserver"
+	ControllerManagerComponent = "kube-controller-manager"
+	SchedulerComponent         = "kube-scheduler"
+	KubeletComponent           = "kubelet"
+	KubeProxyComponent         = "kube-proxy"
+)
+
+var featureGateComponents = []string{
+	APIServerComponent,
+	ControllerManagerComponent,
+	SchedulerComponent,
+	KubeletComponent,
+	KubeProxyComponent,
+}
+
+// FeatureGates collection of feature gates
+type FeatureGates []FeatureGate
+
+// FeatureGate defines a Kubernetes feature gate and the components it's set on
+type FeatureGate struct {
+	Name    string `yaml:"name"`
+	Enabled bool   `yaml:"enabled"`
+	// Components the gate is set on, all the components if empty
+	Components []string `yaml:"components,omitempty"`
+}
+
+func (fg FeatureGate) appliesTo(component string) bool {
+	if len(fg.Components) == 0 {
+		return true
+	}
+	for _, c := range fg.Components {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// ForComponent returns the feature gates set on the given component
+func (fgs FeatureGates) ForComponent(component string) map[string]bool {
+	gates := make(map[string]bool)
+	for _, fg := range fgs {
+		if fg.appliesTo(component) {
+			gates[fg.Name] = fg.Enabled
+		}
+	}
+	return gates
+}
+
+// BuildArgs sets the --feature-gates flag of the given component in args
+func (fgs FeatureGates) BuildArgs(args map[string]string, component string) {
+	gates := fgs.ForComponent(component)
+	if len(gates) == 0 {
+		return
+	}
+	flags := make([]string, 0, len(gates))
+	for name, enabled := range gates {
+		flags = append(flags, fmt.Sprintf("%s=%t", name, enabled))
+	}
+	sort.Strings(flags)
+	if fg := args["feature-gates"]; fg != "" {
+		flags = append([]string{fg}, flags...)
+	}
+	args["feature-gates"] = strings.Join(flags, ",")
+}
+
+// Validate validates the feature gates against the Kubernetes version bundled with k0s
+func (fgs FeatureGates) Validate() []error {
+	var errors []error
+
+	seen := make(map[string]bool)
+	for _, fg := range fgs {
+		if _, known := knownFeatureGates[fg.Name]; !known {
+			errors = append(errors, fmt.Errorf("unknown feature gate %q for Kubernetes %s", fg.Name, kubernetesFeatureGatesVersion))
+			continue
+		}
+		if locked := knownFeatureGates[fg.Name]; locked != nil && *locked != fg.Enabled {
+			errors = append(errors, fmt.Errorf("feature gate %s is locked to %t in Kubernetes %s", fg.Name, *locked, kubernetesFeatureGatesVersion))
+		}
+		for _, c := range fg.Components {
+			if !isFeatureGateComponent(c) {
+				errors = append(errors, fmt.Errorf("feature gate %s: unknown component %q, must be one of %s", fg.Name, c, strings.Join(featureGateComponents, ", ")))
+			}
+		}
+		for _, c := range featureGateComponents {
+			if !fg.appliesTo(c) {
+				continue
+			}
+			if seen[c+"/"+fg.Name] {
+				errors = append(errors, fmt.Errorf("feature gate %s is set more than once for %s", fg.Name, c))
+			}
+			seen[c+"/"+fg.Name] = true
+		}
+	}
+
+	return errors
+}
+
+func isFeatureGateComponent(component string) bool {
+	for _, c := range featureGateComponents {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
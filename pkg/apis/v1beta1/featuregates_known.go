@@ -0,0 +1,129 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+// kubernetesFeatureGatesVersion is the Kubernetes version the known feature gates are listed for
+const kubernetesFeatureGatesVersion = "v1.20"
+
+// knownFeatureGates lists the feature gates of the Kubernetes components bundled with k0s.
+// The value is the state a GA feature is locked to, nil for the gates which can be toggled.
+// This needs to be updated together with the Kubernetes version.
+var knownFeatureGates = map[string]*bool{
+	"AllowInsecureBackendProxy":                      nil,
+	"AnyVolumeDataSource":                            nil,
+	"APIListChunking":                                nil,
+	"APIPriorityAndFairness":                         nil,
+	"APIResponseCompression":                         nil,
+	"AppArmor":                                       nil,
+	"AttachVolumeLimit":                              lockedTo(true),
+	"BalanceAttachedNodeVolumes":                     nil,
+	"BoundServiceAccountTokenVolume":                 nil,
+	"ConfigurableFSGroupPolicy":                      nil,
+	"CPUCFSQuotaPeriod":                              nil,
+	"CPUManager":                                     nil,
+	"CRIContainerLogRotation":                        lockedTo(true),
+	"CSIInlineVolume":                                nil,
+	"CSIMigration":                                   nil,
+	"CSIMigrationAWS":                                nil,
+	"CSIMigrationAWSComplete":                        nil,
+	"CSIMigrationAzureDisk":                          nil,
+	"CSIMigrationAzureDiskComplete":                  nil,
+	"CSIMigrationAzureFile":                          nil,
+	"CSIMigrationAzureFileComplete":                  nil,
+	"CSIMigrationGCE":                                nil,
+	"CSIMigrationGCEComplete":                        nil,
+	"CSIMigrationOpenStack":                          nil,
+	"CSIMigrationOpenStackComplete":                  nil,
+	"CSIMigrationvSphere":                            nil,
+	"CSIMigrationvSphereComplete":                    nil,
+	"CSIServiceAccountToken":                         nil,
+	"CSIStorageCapacity":                             nil,
+	"CSIVolumeFSGroupPolicy":                         nil,
+	"DefaultPodTopologySpread":                       nil,
+	"DevicePlugins":                                  nil,
+	"DisableAcceleratorUsageMetrics":                 nil,
+	"DownwardAPIHugePages":                           nil,
+	"DryRun":                                         lockedTo(true),
+	"DynamicKubeletConfig":                           nil,
+	"EndpointSlice":                                  nil,
+	"EndpointSliceNodeName":                          nil,
+	"EndpointSliceProxying":                          nil,
+	"EndpointSliceTerminatingCondition":              nil,
+	"EphemeralContainers":                            nil,
+	"ExecProbeTimeout":                               nil,
+	"ExpandCSIVolumes":                               nil,
+	"ExpandInUsePersistentVolumes":                   nil,
+	"ExpandPersistentVolumes":                        nil,
+	"ExperimentalHostUserNamespaceDefaulting":        nil,
+	"GenericEphemeralVolume":                         nil,
+	"GracefulNodeShutdown":                           nil,
+	"HPAScaleToZero":                                 nil,
+	"HugePageStorageMediumSize":                      nil,
+	"ImmutableEphemeralVolumes":                      nil,
+	"IPv6DualStack":                                  nil,
+	"KubeletCredentialProviders":                     nil,
+	"KubeletPodResources":                            nil,
+	"LegacyNodeRoleBehavior":                         nil,
+	"LocalStorageCapacityIsolation":                  nil,
+	"LocalStorageCapacityIsolationFSQuotaMonitoring": nil,
+	"MixedProtocolLBService":                         nil,
+	"NodeDisruptionExclusion":                        nil,
+	"NodeLease":                                      lockedTo(true),
+	"NonPreemptingPriority":                          nil,
+	"PodDisruptionBudget":                            nil,
+	"PodOverhead":                                    nil,
+	"PodShareProcessNamespace":                       lockedTo(true),
+	"PreferNominatedNode":                            nil,
+	"ProcMountType":                                  nil,
+	"QOSReserved":                                    nil,
+	"RemainingItemCount":                             nil,
+	"RemoveSelfLink":                                 nil,
+	"RootCAConfigMap":                                nil,
+	"RotateKubeletServerCertificate":                 nil,
+	"RunAsGroup":                                     nil,
+	"RuntimeClass":                                   lockedTo(true),
+	"SCTPSupport":                                    lockedTo(true),
+	"ServerSideApply":                                nil,
+	"ServiceAccountIssuerDiscovery":                  nil,
+	"ServiceLBNodePortControl":                       nil,
+	"ServiceNodeExclusion":                           nil,
+	"ServiceTopology":                                nil,
+	"SetHostnameAsFQDN":                              nil,
+	"SizeMemoryBackedVolumes":                        nil,
+	"StartupProbe":                                   lockedTo(true),
+	"StorageVersionAPI":                              nil,
+	"StorageVersionHash":                             nil,
+	"StreamingProxyRedirects":                        nil,
+	"SupportNodePidsLimit":                           lockedTo(true),
+	"SupportPodPidsLimit":                            lockedTo(true),
+	"Sysctls":                                        nil,
+	"TokenRequest":                                   lockedTo(true),
+	"TokenRequestProjection":                         lockedTo(true),
+	"TopologyManager":                                nil,
+	"TTLAfterFinished":                               nil,
+	"ValidateProxyRedirects":                         nil,
+	"VolumePVCDataSource":                            nil,
+	"VolumeSnapshotDataSource":                       lockedTo(true),
+	"WarningHeaders":                                 nil,
+	"WatchBookmark":                                  lockedTo(true),
+	"WindowsEndpointSliceProxying":                   nil,
+	"WinDSR":                                         nil,
+	"WinOverlay":                                     nil,
+}
+
+func lockedTo(enabled bool) *bool {
+	return &enabled
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureGates(t *testing.T) {
+	fgs := FeatureGates{
+		{Name: "EphemeralContainers", Enabled: true},
+		{Name: "GracefulNodeShutdown", Enabled: true, Components: []string{KubeletComponent}},
+		{Name: "TopologyManager", Enabled: false, Components: []string{KubeletComponent, APIServerComponent}},
+	}
+
+	t.Run("for component", func(t *testing.T) {
+		require.Equal(t, map[string]bool{
+			"EphemeralContainers":  true,
+			"GracefulNodeShutdown": true,
+			"TopologyManager":      false,
+		}, fgs.ForComponent(KubeletComponent))
+		require.Equal(t, map[string]bool{"EphemeralContainers": true}, fgs.ForComponent(KubeProxyComponent))
+	})
+
+	t.Run("build args", func(t *testing.T) {
+		args := map[string]string{}
+		fgs.BuildArgs(args, APIServerComponent)
+		require.Equal(t, "EphemeralContainers=true,TopologyManager=false", args["feature-gates"])
+
+		args = map[string]string{}
+		FeatureGates{}.BuildArgs(args, APIServerComponent)
+		require.Empty(t, args)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		require.Empty(t, fgs.Validate())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		errors := FeatureGates{
+			{Name: "NoSuchGate", Enabled: true},
+			{Name: "NodeLease", Enabled: false},
+			{Name: "EphemeralContainers", Enabled: true, Components: []string{"etcd"}},
+			{Name: "TopologyManager", Enabled: true},
+			{Name: "TopologyManager", Enabled: false, Components: []string{KubeletComponent}},
+		}.Validate()
+		require.Len(t, errors, 4)
+		require.Contains(t, errors[0].Error(), "unknown feature gate")
+		require.Contains(t, errors[1].Error(), "locked to true")
+		require.Contains(t, errors[2].Error(), "unknown component")
+		require.Contains(t, errors[3].Error(), "set more than once for kubelet")
+	})
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// GitOps providers
+const (
+	GitOpsFlux   = "flux"
+	GitOpsArgoCD = "argocd"
+)
+
+const (
+	// FluxHelmRepository is the helm repository of the Flux chart
+	FluxHelmRepository = "https://fluxcd-community.github.io/helm-charts"
+	// ArgoCDHelmRepository is the helm repository of the Argo CD chart
+	ArgoCDHelmRepository = "https://argoproj.github.io/argo-helm"
+	// GitOpsChart is the name of the Chart resource of the GitOps provider
+	GitOpsChart = "gitops"
+	// FluxNamespace is the namespace of Flux and its bootstrap resources
+	FluxNamespace = "flux-system"
+	// ArgoCDNamespace is the namespace of Argo CD and its bootstrap Application
+	ArgoCDNamespace = "argocd"
+)
+
+// GitOpsSpec installs Flux or Argo CD and points it at a git repository, from which the cluster then configures
+// itself
+type GitOpsSpec struct {
+	// Provider is flux or argocd
+	Provider string `yaml:"provider"`
+	// Version of the chart of the provider
+	Version string `yaml:"version,omitempty"`
+	// Values are merged on top of the k0s default values of the chart
+	Values string `yaml:"values,omitempty"`
+	// Repository is the URL of the git repository
+	Repository string `yaml:"repository"`
+	// Branch of the repository, defaults to main
+	Branch string `yaml:"branch,omitempty"`
+	// Path of the manifests in the repository, defaults to the root
+	Path string `yaml:"path,omitempty"`
+	// SecretRef is a Secret in the namespace of the provider holding the credentials of the repository, username and
+	// password for HTTPS or identity (and known_hosts for flux) for SSH
+	SecretRef string `yaml:"secretRef,omitempty"`
+	// Interval between the syncs of flux, defaults to 1m. Argo CD syncs at the interval of its own config.
+	Interval string `yaml:"interval,omitempty"`
+}
+
+// GitOps returns spec.extensions.gitops, nil if the GitOps bootstrap isn't enabled
+func (s *ClusterSpec) GitOps() *GitOpsSpec {
+	if s == nil || s.Extensions == nil {
+		return nil
+	}
+	return s.Extensions.GitOps
+}
+
+// Namespace returns the namespace of the provider
+func (g *GitOpsSpec) Namespace() string {
+	if g.Provider == GitOpsArgoCD {
+		return ArgoCDNamespace
+	}
+	return FluxNamespace
+}
+
+// BranchOrDefault returns the branch of the repository, main unless set
+func (g *GitOpsSpec) BranchOrDefault() string {
+	if g.Branch == "" {
+		return "main"
+	}
+	return g.Branch
+}
+
+// PathOrDefault returns the path of the manifests in the repository, relative to its root
+func (g *GitOpsSpec) PathOrDefault() string {
+	return "./" + strings.TrimPrefix(path.Clean("/"+g.Path), "/")
+}
+
+// IntervalOrDefault returns the sync interval of flux
+func (g *GitOpsSpec) IntervalOrDefault() string {
+	if g.Interval == "" {
+		return "1m"
+	}
+	return g.Interval
+}
+
+// IsSSH tells if the repository is accessed over SSH
+func (g *GitOpsSpec) IsSSH() bool {
+	return strings.HasPrefix(g.Repository, "ssh://") || strings.HasPrefix(g.Repository, "git@")
+}
+
+// chart returns the repository and the chart of the provider
+func (g *GitOpsSpec) chart() (Repository, Chart, error) {
+	var repository Repository
+	var defaults map[interface{}]interface{}
+	chart := Chart{Name: GitOpsChart, Version: g.Version, TargetNS: g.Namespace()}
+	switch g.Provider {
+	case GitOpsFlux:
+		repository = Repository{Name: "fluxcd-community", URL: FluxHelmRepository}
+		chart.ChartName = "fluxcd-community/flux2"
+		if chart.Version == "" {
+			chart.Version = constant.FluxChartVersion
+		}
+	case GitOpsArgoCD:
+		repository = Repository{Name: "argo", URL: ArgoCDHelmRepository}
+		chart.ChartName = "argo/argo-cd"
+		if chart.Version == "" {
+			chart.Version = constant.ArgoCDChartVersion
+		}
+		if g.SecretRef != "" {
+			defaults = map[interface{}]interface{}{
+				"server": map[interface{}]interface{}{
+					"config": map[interface{}]interface{}{"repositories": g.argoCDRepositories()},
+				},
+			}
+		}
+	default:
+		return repository, chart, fmt.Errorf("unsupported GitOps provider %q", g.Provider)
+	}
+
+	values := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal([]byte(g.Values), &values); err != nil {
+		return repository, chart, fmt.Errorf("invalid values: %v", err)
+	}
+	merged, err := yaml.Marshal(mergeYAMLMaps(defaults, values))
+	if err != nil {
+		return repository, chart, err
+	}
+	if len(defaults) > 0 || len(values) > 0 {
+		chart.Values = string(merged)
+	}
+	return repository, chart, nil
+}
+
+// argoCDRepositories returns the repositories of argocd-cm, referring to the credentials in the Secret
+func (g *GitOpsSpec) argoCDRepositories() string {
+	secretKey := func(field, key string) string {
+		return fmt.Sprintf("  %s:\n    name: %q\n    key: %s\n", field, g.SecretRef, key)
+	}
+	repositories := fmt.Sprintf("- url: %q\n", g.Repository)
+	if g.IsSSH() {
+		return repositories + secretKey("sshPrivateKeySecret", "identity")
+	}
+	return repositories + secretKey("usernameSecret", "username") + secretKey("passwordSecret", "password")
+}
+
+// mergeYAMLMaps merges values on top of defaults, maps are merged key by key and any other values replaced
+func mergeYAMLMaps(defaults, values map[interface{}]interface{}) map[interface{}]interface{} {
+	merged := make(map[interface{}]interface{}, len(defaults)+len(values))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range values {
+		if valueMap, ok := value.(map[interface{}]interface{}); ok {
+			if defaultMap, ok := merged[key].(map[interface{}]interface{}); ok {
+				merged[key] = mergeYAMLMaps(defaultMap, valueMap)
+				continue
+			}
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// Validate validates GitOpsSpec struct
+func (g *GitOpsSpec) Validate() []error {
+	if g == nil {
+		return nil
+	}
+	var errors []error
+	fieldError := func(field string, format string, args ...interface{}) {
+		errors = append(errors, &FieldError{Field: "spec.extensions.gitops." + field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if g.Provider != GitOpsFlux && g.Provider != GitOpsArgoCD {
+		fieldError("provider", "unsupported provider %q, must be %s or %s", g.Provider, GitOpsFlux, GitOpsArgoCD)
+	}
+	if g.Repository == "" {
+		fieldError("repository", "repository is required")
+	} else if !strings.HasPrefix(g.Repository, "git@") {
+		if u, err := url.Parse(g.Repository); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "ssh") {
+			fieldError("repository", "invalid repository %q, must be an https, http or ssh URL", g.Repository)
+		}
+	}
+	if strings.Contains(g.Path, "..") {
+		fieldError("path", "path must be within the repository")
+	}
+	if g.Interval != "" {
+		if g.Provider == GitOpsArgoCD {
+			fieldError("interval", "interval is only supported with %s", GitOpsFlux)
+		} else if interval, err := time.ParseDuration(g.Interval); err != nil || interval <= 0 {
+			fieldError("interval", "invalid interval %q", g.Interval)
+		}
+	}
+	if g.Provider == GitOpsFlux || g.Provider == GitOpsArgoCD {
+		if _, _, err := g.chart(); err != nil {
+			fieldError("values", "%v", err)
+		}
+	}
+	return errors
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitOpsHelmExtensions(t *testing.T) {
+	spec := &ClusterSpec{Extensions: &ClusterExtensions{GitOps: &GitOpsSpec{
+		Provider:   GitOpsFlux,
+		Repository: "https://git.example.com/cluster.git",
+	}}}
+	helm := spec.HelmExtensions()
+	require.Len(t, helm.Charts, 1)
+	assert.Equal(t, Chart{Name: GitOpsChart, ChartName: "fluxcd-community/flux2", Version: "0.2.1", TargetNS: "flux-system"}, helm.Charts[0])
+	assert.Equal(t, FluxHelmRepository, helm.Repositories[0].URL)
+
+	spec.Extensions.GitOps = &GitOpsSpec{
+		Provider:   GitOpsArgoCD,
+		Repository: "git@git.example.com:cluster.git",
+		SecretRef:  "git-credentials",
+		Values:     "server:\n  replicas: 2\n",
+	}
+	helm = spec.HelmExtensions()
+	require.Len(t, helm.Charts, 1)
+	assert.Equal(t, "argo/argo-cd", helm.Charts[0].ChartName)
+	assert.Equal(t, "argocd", helm.Charts[0].TargetNS)
+	assert.Equal(t, `server:
+  config:
+    repositories: |
+      - url: "git@git.example.com:cluster.git"
+        sshPrivateKeySecret:
+          name: "git-credentials"
+          key: identity
+  replicas: 2
+`, helm.Charts[0].Values)
+}
+
+func TestGitOpsDefaults(t *testing.T) {
+	gitOps := &GitOpsSpec{Provider: GitOpsFlux, Repository: "https://git.example.com/cluster.git"}
+	assert.Equal(t, "main", gitOps.BranchOrDefault())
+	assert.Equal(t, "./", gitOps.PathOrDefault())
+	assert.Equal(t, "1m", gitOps.IntervalOrDefault())
+	assert.False(t, gitOps.IsSSH())
+
+	gitOps.Path = "/clusters/production/"
+	assert.Equal(t, "./clusters/production", gitOps.PathOrDefault())
+}
+
+func TestGitOpsValidate(t *testing.T) {
+	var none *GitOpsSpec
+	assert.Empty(t, none.Validate())
+
+	valid := &GitOpsSpec{Provider: GitOpsFlux, Repository: "ssh://git@git.example.com/cluster.git", Interval: "5m"}
+	assert.Empty(t, valid.Validate())
+
+	errors := (&GitOpsSpec{Provider: "jenkins", Repository: "ftp://example.com/repo", Path: "../other"}).Validate()
+	if assert.Len(t, errors, 3) {
+		assert.EqualError(t, errors[0], `spec.extensions.gitops.provider: unsupported provider "jenkins", must be flux or argocd`)
+		assert.EqualError(t, errors[1], `spec.extensions.gitops.repository: invalid repository "ftp://example.com/repo", must be an https, http or ssh URL`)
+		assert.EqualError(t, errors[2], "spec.extensions.gitops.path: path must be within the repository")
+	}
+
+	errors = (&GitOpsSpec{Provider: GitOpsArgoCD, Interval: "1m", Values: "- not a map"}).Validate()
+	if assert.Len(t, errors, 3) {
+		assert.EqualError(t, errors[0], "spec.extensions.gitops.repository: repository is required")
+		assert.EqualError(t, errors[1], "spec.extensions.gitops.interval: interval is only supported with flux")
+		assert.Contains(t, errors[2].Error(), "spec.extensions.gitops.values: invalid values")
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+)
+
+// KubeletGracefulShutdown configures how long kubelet delays the shutdown of the host to terminate the pods
+type KubeletGracefulShutdown struct {
+	// GracePeriod is the total time the shutdown is delayed
+	GracePeriod string `yaml:"gracePeriod"`
+	// CriticalPodsGracePeriod is the part of GracePeriod reserved for terminating the critical pods, the regular
+	// pods are terminated first in the rest of it
+	CriticalPodsGracePeriod string `yaml:"criticalPodsGracePeriod,omitempty"`
+}
+
+// Validate validates the grace periods
+func (s *KubeletGracefulShutdown) Validate() error {
+	total, err := time.ParseDuration(s.GracePeriod)
+	if err != nil || total <= 0 {
+		return fmt.Errorf("invalid gracePeriod %q, must be a positive duration like 30s", s.GracePeriod)
+	}
+	if s.CriticalPodsGracePeriod == "" {
+		return nil
+	}
+	critical, err := time.ParseDuration(s.CriticalPodsGracePeriod)
+	if err != nil || critical < 0 {
+		return fmt.Errorf("invalid criticalPodsGracePeriod %q", s.CriticalPodsGracePeriod)
+	}
+	if critical > total {
+		return fmt.Errorf("criticalPodsGracePeriod must not be longer than gracePeriod")
+	}
+	return nil
+}
+
+// KubeletValues returns the kubelet config fields of the grace periods
+func (s *KubeletGracefulShutdown) KubeletValues() map[string]interface{} {
+	critical := s.CriticalPodsGracePeriod
+	if critical == "" {
+		critical = "0s"
+	}
+	return map[string]interface{}{
+		"shutdownGracePeriod":             s.GracePeriod,
+		"shutdownGracePeriodCriticalPods": critical,
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubeletGracefulShutdownValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		shutdown KubeletGracefulShutdown
+		valid    bool
+	}{
+		{"grace period only", KubeletGracefulShutdown{GracePeriod: "30s"}, true},
+		{"critical pods", KubeletGracefulShutdown{GracePeriod: "1m", CriticalPodsGracePeriod: "20s"}, true},
+		{"missing grace period", KubeletGracefulShutdown{}, false},
+		{"zero grace period", KubeletGracefulShutdown{GracePeriod: "0s"}, false},
+		{"invalid critical pods", KubeletGracefulShutdown{GracePeriod: "30s", CriticalPodsGracePeriod: "ten"}, false},
+		{"critical pods longer", KubeletGracefulShutdown{GracePeriod: "30s", CriticalPodsGracePeriod: "1m"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.shutdown.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestKubeletGracefulShutdownKubeletValues(t *testing.T) {
+	s := KubeletGracefulShutdown{GracePeriod: "30s"}
+	assert.Equal(t, map[string]interface{}{
+		"shutdownGracePeriod":             "30s",
+		"shutdownGracePeriodCriticalPods": "0s",
+	}, s.KubeletValues())
+}
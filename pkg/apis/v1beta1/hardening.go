@@ -0,0 +1,179 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/k0sproject/k0s/internal/util"
+)
+
+// CISHardeningProfile applies the CIS Kubernetes Benchmark recommendations k0s can apply on its own
+const CISHardeningProfile = "cis"
+
+// HardeningSpec defines the hardening profile of the cluster
+type HardeningSpec struct {
+	Profile string `yaml:"profile,omitempty"`
+}
+
+// CIS tells if the CIS hardening profile is enabled
+func (h *HardeningSpec) CIS() bool {
+	return h != nil && h.Profile == CISHardeningProfile
+}
+
+// Validate validates the hardening profile
+func (h *HardeningSpec) Validate() []error {
+	if h == nil || h.Profile == "" || h.Profile == CISHardeningProfile {
+		return nil
+	}
+	return []error{fmt.Errorf("unknown hardening profile %q, supported profiles: %s", h.Profile, CISHardeningProfile)}
+}
+
+// cisAdmissionPlugins are the admission plugins recommended by the CIS benchmark section 1.2
+var cisAdmissionPlugins = []string{
+	"AlwaysPullImages",
+	"NamespaceLifecycle",
+	"ServiceAccount",
+}
+
+// cisCipherSuites are the strong cipher suites recommended by the CIS benchmark, limited to the ones allowed in FIPS mode
+var cisCipherSuites = []string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+}
+
+var cisAPIServerArgs = map[string]string{
+	"anonymous-auth":         "false",
+	"service-account-lookup": "true",
+	"tls-cipher-suites":      strings.Join(cisCipherSuites, ","),
+}
+
+var cisControllerManagerArgs = map[string]string{
+	"terminated-pod-gc-threshold": "10",
+}
+
+// CISKubeletConfig are the kubelet settings the CIS hardening profile adds to the worker profiles
+var CISKubeletConfig = map[string]interface{}{
+	"readOnlyPort":                   0,
+	"streamingConnectionIdleTimeout": "5m",
+	"makeIPTablesUtilChains":         true,
+}
+
+// CISEtcdArgs are the etcd flags the CIS hardening profile sets
+var CISEtcdArgs = []string{
+	"--auto-tls=false",
+	"--peer-auto-tls=false",
+}
+
+// ApplyHardening applies spec.hardening on top of the spec and returns the settings changed from the defaults. Like
+// with the presets the settings given explicitly in the config are kept. The kubelet and etcd settings and the file
+// permissions are applied by the components and only reported here.
+func (s *ClusterSpec) ApplyHardening() []PresetDeviation {
+	if !s.Hardening.CIS() {
+		return nil
+	}
+	var deviations []PresetDeviation
+
+	if s.API.Admission == nil {
+		s.API.Admission = &AdmissionSpec{}
+	}
+	admission := s.API.Admission
+	for _, plugin := range cisAdmissionPlugins {
+		if util.StringSliceContains(admission.EnabledPlugins, plugin) || util.StringSliceContains(admission.DisabledPlugins, plugin) {
+			continue
+		}
+		admission.EnabledPlugins = append(admission.EnabledPlugins, plugin)
+		deviations = append(deviations, PresetDeviation{
+			Setting: "spec.api.admission.enabledPlugins",
+			Value:   plugin,
+		})
+	}
+
+	if s.API.ExtraArgs == nil {
+		s.API.ExtraArgs = make(map[string]string)
+	}
+	deviations = append(deviations, applyArgs("spec.api.extraArgs", s.API.ExtraArgs, cisAPIServerArgs)...)
+	if s.ControllerManager.ExtraArgs == nil {
+		s.ControllerManager.ExtraArgs = make(map[string]string)
+	}
+	// the typed settings take precedence over the hardening defaults
+	cmDefaults := make(map[string]string)
+	typedArgs := s.ControllerManager.Args()
+	for name, value := range cisControllerManagerArgs {
+		if _, found := typedArgs[name]; !found {
+			cmDefaults[name] = value
+		}
+	}
+	deviations = append(deviations, applyArgs("spec.controllerManager.extraArgs", s.ControllerManager.ExtraArgs, cmDefaults)...)
+
+	for _, field := range sortedKeys(CISKubeletConfig) {
+		deviations = append(deviations, PresetDeviation{
+			Setting: "kubelet." + field,
+			Value:   fmt.Sprintf("%v", CISKubeletConfig[field]),
+		})
+	}
+	for _, arg := range CISEtcdArgs {
+		deviations = append(deviations, PresetDeviation{
+			Setting: "etcd",
+			Value:   arg,
+		})
+	}
+	deviations = append(deviations, PresetDeviation{
+		Setting: "file permissions",
+		Value:   "private keys in the certificate directory are made readable by their owner only",
+	})
+	deviations = append(deviations, PresetDeviation{
+		Setting: "audit",
+		Value:   "a Metadata level audit policy is used unless the AuditPolicy object is created",
+	})
+
+	return deviations
+}
+
+// applyArgs sets the flags not set explicitly and returns them as deviations, in a stable order
+func applyArgs(setting string, args map[string]string, defaults map[string]string) []PresetDeviation {
+	var deviations []PresetDeviation
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, found := args[name]; found {
+			continue
+		}
+		args[name] = defaults[name]
+		deviations = append(deviations, PresetDeviation{
+			Setting: setting + "." + name,
+			Value:   defaults[name],
+		})
+	}
+	return deviations
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCISHardening(t *testing.T) {
+	yamlData := `
+apiVersion: k0s.k0sproject.io/v1beta1
+kind: Cluster
+metadata:
+  name: foobar
+spec:
+  hardening:
+    profile: cis
+  api:
+    extraArgs:
+      anonymous-auth: "true"
+    admission:
+      disabledPlugins:
+      - AlwaysPullImages
+`
+
+	c, err := fromYaml(t, yamlData)
+	assert.NoError(t, err)
+	assert.Empty(t, c.Spec.Hardening.Validate())
+	assert.True(t, c.Spec.Hardening.CIS())
+
+	deviations := c.Spec.ApplyHardening()
+	assert.Contains(t, deviations, PresetDeviation{Setting: "spec.api.extraArgs.service-account-lookup", Value: "true"})
+	assert.Contains(t, deviations, PresetDeviation{Setting: "spec.controllerManager.extraArgs.terminated-pod-gc-threshold", Value: "10"})
+	assert.Contains(t, deviations, PresetDeviation{Setting: "kubelet.readOnlyPort", Value: "0"})
+	assert.Equal(t, "true", c.Spec.API.ExtraArgs["anonymous-auth"], "explicitly set flags must be kept")
+	assert.NotContains(t, c.Spec.API.Admission.EnabledPlugins, "AlwaysPullImages", "explicitly disabled plugins must be kept disabled")
+	assert.Contains(t, c.Spec.API.Admission.EnabledPlugins, "NamespaceLifecycle")
+	assert.Empty(t, c.Spec.API.Admission.Validate())
+}
+
+func TestHardeningValidation(t *testing.T) {
+	c, err := fromYaml(t, "apiVersion: k0s.k0sproject.io/v1beta1\nspec:\n  hardening:\n    profile: stig")
+	assert.NoError(t, err)
+	assert.Len(t, c.Spec.Hardening.Validate(), 1)
+	assert.False(t, c.Spec.Hardening.CIS())
+
+	c = DefaultClusterConfig(c.k0sVars)
+	assert.Empty(t, c.Spec.Hardening.Validate())
+	assert.Nil(t, c.Spec.ApplyHardening())
+}
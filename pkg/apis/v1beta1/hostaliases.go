@@ -0,0 +1,63 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// HostAliases are static name resolution entries for environments without reliable DNS. They are added to
+// /etc/hosts of every node and served cluster-wide by CoreDNS.
+type HostAliases []HostAlias
+
+// HostAlias maps the hostnames to the IP address
+type HostAlias struct {
+	IP        string   `yaml:"ip"`
+	Hostnames []string `yaml:"hostnames"`
+}
+
+var hostnameRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// Validate checks the addresses and hostnames
+func (h HostAliases) Validate() []error {
+	var errors []error
+	for _, alias := range h {
+		if net.ParseIP(alias.IP) == nil {
+			errors = append(errors, fmt.Errorf("hostAliases: %q is not a valid IP address", alias.IP))
+		}
+		if len(alias.Hostnames) == 0 {
+			errors = append(errors, fmt.Errorf("hostAliases: no hostnames given for %s", alias.IP))
+		}
+		for _, hostname := range alias.Hostnames {
+			if len(hostname) > 253 || !hostnameRe.MatchString(hostname) {
+				errors = append(errors, fmt.Errorf("hostAliases: %q is not a valid lowercase hostname", hostname))
+			}
+		}
+	}
+	return errors
+}
+
+// HostsEntries renders the aliases in the /etc/hosts format, one line per alias
+func (h HostAliases) HostsEntries() string {
+	var b strings.Builder
+	for _, alias := range h {
+		fmt.Fprintf(&b, "%s %s\n", alias.IP, strings.Join(alias.Hostnames, " "))
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostAliases(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		h := HostAliases{
+			{IP: "10.0.0.10", Hostnames: []string{"registry.edge.local", "registry"}},
+			{IP: "fd00::1", Hostnames: []string{"api.edge.local"}},
+		}
+		assert.Empty(t, h.Validate())
+		assert.Equal(t, "10.0.0.10 registry.edge.local registry\nfd00::1 api.edge.local\n", h.HostsEntries())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		h := HostAliases{
+			{IP: "10.0.0", Hostnames: []string{"Registry"}},
+			{IP: "10.0.0.11"},
+		}
+		errors := h.Validate()
+		assert.Len(t, errors, 3)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var h HostAliases
+		assert.Empty(t, h.Validate())
+		assert.Equal(t, "", h.HostsEntries())
+	})
+}
@@ -44,6 +44,10 @@ type ClusterImages struct {
 
 	Repository        string `yaml:"repository,omitempty"`
 	DefaultPullPolicy string `yaml:"default_pull_policy,omitempty"`
+
+	// Extra are the images of the workloads deployed by the user, listed by k0s airgap list-images with the images of
+	// the components. The repository override does not apply to them.
+	Extra []string `yaml:"extra,omitempty"`
 }
 
 func (ci *ClusterImages) UnmarshalYAML(unmarshal func(interface{}) error) error {
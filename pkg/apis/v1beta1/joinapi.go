@@ -0,0 +1,73 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import "fmt"
+
+const (
+	defaultJoinRateLimit = 60
+	defaultJoinBurst     = 20
+)
+
+// JoinAPISpec configures the brute-force protection and the auditing of the join endpoint of the k0s API
+type JoinAPISpec struct {
+	// RateLimit is the number of join attempts a single source IP can make per minute, 0 disables the limit
+	RateLimit int `yaml:"rateLimit"`
+	// Burst is the number of join attempts a single source IP can make at once
+	Burst int `yaml:"burst"`
+	// FailureEvents creates Kubernetes Events for the failed join attempts
+	FailureEvents bool `yaml:"failureEvents"`
+}
+
+// DefaultJoinAPISpec default settings for the join API
+func DefaultJoinAPISpec() *JoinAPISpec {
+	return &JoinAPISpec{
+		RateLimit: defaultJoinRateLimit,
+		Burst:     defaultJoinBurst,
+	}
+}
+
+// Limits returns the per source IP rate limit per minute and the burst, the defaults if the spec is not set
+func (j *JoinAPISpec) Limits() (int, int) {
+	if j == nil {
+		return defaultJoinRateLimit, defaultJoinBurst
+	}
+	burst := j.Burst
+	if burst == 0 {
+		burst = j.RateLimit
+	}
+	return j.RateLimit, burst
+}
+
+// EventsEnabled tells if failed join attempts are recorded as Events
+func (j *JoinAPISpec) EventsEnabled() bool {
+	return j != nil && j.FailureEvents
+}
+
+// Validate validates the join API settings
+func (j *JoinAPISpec) Validate() []error {
+	if j == nil {
+		return nil
+	}
+	var errors []error
+	if j.RateLimit < 0 {
+		errors = append(errors, fmt.Errorf("api.join.rateLimit must not be negative"))
+	}
+	if j.Burst < 0 {
+		errors = append(errors, fmt.Errorf("api.join.burst must not be negative"))
+	}
+	return errors
+}
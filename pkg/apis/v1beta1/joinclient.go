@@ -17,25 +17,47 @@ package v1beta1
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
 	"github.com/k0sproject/k0s/pkg/token"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// JoinClient is the client we can use to call k0s join APIs
+// K0sAPIServiceName is the kube-system service the k0s API of the controllers is published as, a joining controller
+// reaches it through the Kubernetes API service proxy when it can't connect to the k0s API directly
+const K0sAPIServiceName = "k0s-api"
+
+// JoinTokenHeader carries the join token on the requests tunneled through the Kubernetes API. The kube-apiserver
+// consumes the Authorization header when it authenticates the request, so it never reaches the k0s API.
+const JoinTokenHeader = "K0s-Join-Token"
+
+// JoinClient is the client we can use to call k0s join APIs. The join token is only used to bootstrap a client
+// certificate, all the other calls are authenticated with the client certificate.
 type JoinClient struct {
 	joinAddress string
 	httpClient  http.Client
+	tlsConfig   *tls.Config
 	bearerToken string
+	viaKubeAPI  bool
 }
 
 // JoinClientFromToken creates a new join api client from a token
@@ -63,6 +85,7 @@ func JoinClientFromToken(encodedToken string) (*JoinClient, error) {
 	tr := &http.Transport{TLSClientConfig: tlsConfig}
 	c := &JoinClient{
 		httpClient:  http.Client{Transport: tr},
+		tlsConfig:   tlsConfig,
 		bearerToken: config.BearerToken,
 	}
 	c.joinAddress = config.Host
@@ -70,14 +93,152 @@ func JoinClientFromToken(encodedToken string) (*JoinClient, error) {
 	return c, nil
 }
 
+// SetAddress overrides the k0s API address of the token
+func (j *JoinClient) SetAddress(address string) {
+	j.joinAddress = address
+}
+
+// Address returns the k0s API address the client calls
+func (j *JoinClient) Address() string {
+	return j.joinAddress
+}
+
+// Reachable tells if a TCP connection to the k0s API address can be opened within the timeout
+func (j *JoinClient) Reachable(timeout time.Duration) bool {
+	u, err := url.Parse(j.joinAddress)
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// UseKubeAPIProxy makes the client tunnel the calls through the Kubernetes API service proxy. The Kubernetes API
+// is expected on the host of the k0s API address of the token, at apiPort. The client certificate can't be passed
+// through the proxy, so all the calls are authenticated with the join token instead.
+func (j *JoinClient) UseKubeAPIProxy(apiPort int) error {
+	u, err := url.Parse(j.joinAddress)
+	if err != nil {
+		return errors.Wrap(err, "invalid k0s API address")
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(apiPort))
+	u.Path = fmt.Sprintf("/api/v1/namespaces/kube-system/services/https:%s:https/proxy", K0sAPIServiceName)
+	j.joinAddress = u.String()
+	j.viaKubeAPI = true
+	return nil
+}
+
+// ViaKubeAPI tells if the client tunnels the calls through the Kubernetes API service proxy
+func (j *JoinClient) ViaKubeAPI() bool {
+	return j.viaKubeAPI
+}
+
+// newRequest creates a request to the k0s API, the requests tunneled through the Kubernetes API carry the join token
+// for both the kube-apiserver and the k0s API
+func (j *JoinClient) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, j.joinAddress+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if j.viaKubeAPI {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", j.bearerToken))
+		req.Header.Set(JoinTokenHeader, j.bearerToken)
+	}
+	return req, nil
+}
+
+// BootstrapClientCertificate makes the client authenticate with the client certificate at certPath and keyPath.
+// If they don't exist yet, a new key is generated and the certificate is requested with the join token.
+func (j *JoinClient) BootstrapClientCertificate(certPath, keyPath string) error {
+	if !util.FileExists(certPath) || !util.FileExists(keyPath) {
+		if err := j.requestClientCertificate(certPath, keyPath); err != nil {
+			return errors.Wrap(err, "failed to bootstrap k0s API client certificate")
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to load k0s API client certificate")
+	}
+	j.tlsConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
+
+func (j *JoinClient) requestClientCertificate(certPath, keyPath string) error {
+	name, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}}, key)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	certRequest := ClientCertRequest{
+		CSR: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}),
+	}
+	if err := json.NewEncoder(buf).Encode(certRequest); err != nil {
+		return err
+	}
+	req, err := j.newRequest(http.MethodPost, "/v1beta1/certificates/client", buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", j.bearerToken))
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	var certResponse ClientCertResponse
+	if err := json.NewDecoder(resp.Body).Decode(&certResponse); err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(keyPath, keyPEM, constant.CertSecureMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certPath, certResponse.Cert, constant.CertMode)
+}
+
+// GetCalicoKubeConfig calls the calico kubeconfig API
+func (j *JoinClient) GetCalicoKubeConfig() ([]byte, error) {
+	req, err := j.newRequest(http.MethodGet, "/v1beta1/calico/kubeconfig", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
 // GetCA calls the CA sync API
 func (j *JoinClient) GetCA() (CaResponse, error) {
 	var caData CaResponse
-	req, err := http.NewRequest(http.MethodGet, j.joinAddress+"/v1beta1/ca", nil)
+	req, err := j.newRequest(http.MethodGet, "/v1beta1/ca", nil)
 	if err != nil {
 		return caData, err
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", j.bearerToken))
 
 	resp, err := j.httpClient.Do(req)
 	if err != nil {
@@ -120,11 +281,10 @@ func (j *JoinClient) JoinEtcd(peerAddress string) (EtcdResponse, error) {
 		return etcdResponse, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, j.joinAddress+"/v1beta1/etcd/members", buf)
+	req, err := j.newRequest(http.MethodPost, "/v1beta1/etcd/members", buf)
 	if err != nil {
 		return etcdResponse, err
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", j.bearerToken))
 	resp, err := j.httpClient.Do(req)
 	if err != nil {
 		return etcdResponse, err
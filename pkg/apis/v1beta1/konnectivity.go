@@ -0,0 +1,68 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import "fmt"
+
+// KonnectivitySpec defines the ports of the konnectivity server
+type KonnectivitySpec struct {
+	// AgentPort is the port the konnectivity agents connect to
+	AgentPort int `yaml:"agentPort"`
+	// AdminPort is the port of the konnectivity server admin interface
+	AdminPort int `yaml:"adminPort"`
+}
+
+// DefaultKonnectivitySpec default settings
+func DefaultKonnectivitySpec() *KonnectivitySpec {
+	return &KonnectivitySpec{
+		AgentPort: 8132,
+		AdminPort: 8133,
+	}
+}
+
+// AgentPortOrDefault returns the port the konnectivity agents connect to, 8132 unless set
+func (k *KonnectivitySpec) AgentPortOrDefault() int {
+	if k == nil || k.AgentPort == 0 {
+		return 8132
+	}
+	return k.AgentPort
+}
+
+// AdminPortOrDefault returns the port of the konnectivity server admin interface, 8133 unless set
+func (k *KonnectivitySpec) AdminPortOrDefault() int {
+	if k == nil || k.AdminPort == 0 {
+		return 8133
+	}
+	return k.AdminPort
+}
+
+// Validate validates the ports
+func (k *KonnectivitySpec) Validate() []error {
+	if k == nil {
+		return nil
+	}
+	var errors []error
+	if k.AgentPort < 0 || k.AgentPort > 65535 {
+		errors = append(errors, fmt.Errorf("invalid konnectivity agent port %d", k.AgentPort))
+	}
+	if k.AdminPort < 0 || k.AdminPort > 65535 {
+		errors = append(errors, fmt.Errorf("invalid konnectivity admin port %d", k.AdminPort))
+	}
+	if k.AgentPortOrDefault() == k.AdminPortOrDefault() {
+		errors = append(errors, fmt.Errorf("konnectivity agent and admin ports must differ, both are %d", k.AgentPortOrDefault()))
+	}
+	return errors
+}
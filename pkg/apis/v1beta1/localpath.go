@@ -0,0 +1,101 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// LocalPathSpec enables the local-path provisioner, which provisions the persistent volumes as directories on the
+// nodes. It suits single node and edge clusters, the volumes are bound to the node they were created on.
+type LocalPathSpec struct {
+	// DataDir is the directory of the volumes on the nodes, defaults to /var/lib/k0s/local-path
+	DataDir string `yaml:"dataDir,omitempty"`
+	// DefaultStorageClass makes the local-path StorageClass the default one of the cluster
+	DefaultStorageClass bool `yaml:"defaultStorageClass,omitempty"`
+	// Image of the provisioner
+	Image *ImageSpec `yaml:"image,omitempty"`
+	// HelperImage is the image of the pods creating and removing the volume directories
+	HelperImage *ImageSpec `yaml:"helperImage,omitempty"`
+}
+
+// LocalPath returns spec.extensions.localPath, nil if the local-path provisioner isn't enabled
+func (s *ClusterSpec) LocalPath() *LocalPathSpec {
+	if s == nil || s.Extensions == nil {
+		return nil
+	}
+	return s.Extensions.LocalPath
+}
+
+// DataDirOrDefault returns the directory of the volumes on the nodes
+func (l *LocalPathSpec) DataDirOrDefault() string {
+	if l.DataDir == "" {
+		return constant.LocalPathDefaultDataDir
+	}
+	return l.DataDir
+}
+
+// LocalPathProvisionerImage returns the image URI of the provisioner, with the image repository override applied
+func (s *ClusterSpec) LocalPathProvisionerImage() string {
+	var override *ImageSpec
+	if l := s.LocalPath(); l != nil {
+		override = l.Image
+	}
+	return s.localPathImage(constant.LocalPathProvisionerImage, constant.LocalPathProvisionerImageVersion, override)
+}
+
+// LocalPathHelperImage returns the image URI of the helper pods, with the image repository override applied
+func (s *ClusterSpec) LocalPathHelperImage() string {
+	var override *ImageSpec
+	if l := s.LocalPath(); l != nil {
+		override = l.HelperImage
+	}
+	return s.localPathImage(constant.LocalPathHelperImage, constant.LocalPathHelperImageVersion, override)
+}
+
+func (s *ClusterSpec) localPathImage(defaultImage string, defaultVersion string, override *ImageSpec) string {
+	image := ImageSpec{Image: defaultImage, Version: defaultVersion}
+	if override != nil {
+		if override.Image != "" {
+			image.Image = override.Image
+		}
+		if override.Version != "" {
+			image.Version = override.Version
+		}
+	}
+	if s.Images != nil && s.Images.Repository != "" {
+		image.Image = overrideRepository(s.Images.Repository, image.Image)
+	}
+	return image.URI()
+}
+
+// Validate validates LocalPathSpec struct
+func (l *LocalPathSpec) Validate() []error {
+	if l == nil {
+		return nil
+	}
+	var errors []error
+	if l.DataDir != "" && (!filepath.IsAbs(l.DataDir) || filepath.Clean(l.DataDir) == "/") {
+		errors = append(errors, &FieldError{
+			Field: "spec.extensions.localPath.dataDir",
+			Err:   fmt.Errorf("dataDir must be an absolute path other than /, got %q", l.DataDir),
+		})
+	}
+	return errors
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalPathImages(t *testing.T) {
+	spec := &ClusterSpec{
+		Images:     DefaultClusterImages(),
+		Extensions: &ClusterExtensions{LocalPath: &LocalPathSpec{}},
+	}
+	assert.Equal(t, "docker.io/rancher/local-path-provisioner:v0.0.19", spec.LocalPathProvisionerImage())
+	assert.Equal(t, "docker.io/library/busybox:1.33.1", spec.LocalPathHelperImage())
+
+	spec.Images.Repository = "registry.example.com"
+	spec.Extensions.LocalPath.Image = &ImageSpec{Version: "v0.0.20"}
+	assert.Equal(t, "registry.example.com/rancher/local-path-provisioner:v0.0.20", spec.LocalPathProvisionerImage())
+	assert.Equal(t, "registry.example.com/library/busybox:1.33.1", spec.LocalPathHelperImage())
+}
+
+func TestLocalPathValidate(t *testing.T) {
+	assert.Nil(t, (&ClusterSpec{}).LocalPath().Validate())
+
+	l := &LocalPathSpec{}
+	assert.Empty(t, l.Validate())
+	assert.Equal(t, "/var/lib/k0s/local-path", l.DataDirOrDefault())
+
+	l.DataDir = "/mnt/volumes"
+	assert.Empty(t, l.Validate())
+	assert.Equal(t, "/mnt/volumes", l.DataDirOrDefault())
+
+	for _, dataDir := range []string{"volumes", "/"} {
+		l.DataDir = dataDir
+		assert.Len(t, l.Validate(), 1, dataDir)
+	}
+}
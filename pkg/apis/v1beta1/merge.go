@@ -0,0 +1,212 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// patchDirective is the key of the strategic merge directive in a patch map
+	patchDirective = "$patch"
+	// patchMergeKey is the key the list items are matched with
+	patchMergeKey = "name"
+)
+
+// MergeYAML merges the patches in order into the ClusterConfig document of the base config. The other documents of
+// the base are kept as they are. The patches are strategic merge patches:
+//   - maps are merged recursively and a null value removes the key
+//   - lists of maps with a name, e.g. spec.workerProfiles, are merged by the name, other lists are replaced
+//   - "$patch: replace" in a map replaces the map in the base instead of merging into it
+//   - "$patch: delete" in a list item removes the item with the same name from the base
+func MergeYAML(base string, patches ...string) (string, error) {
+	docs := splitDocuments(base)
+	target := -1
+	for i, doc := range docs {
+		if doc.isClusterConfig() {
+			if target >= 0 {
+				return "", fmt.Errorf("found several ClusterConfig documents in the base config, only one is allowed")
+			}
+			target = i
+		}
+	}
+
+	var merged yaml.MapSlice
+	if target >= 0 {
+		if err := yaml.Unmarshal([]byte(docs[target].content), &merged); err != nil {
+			return "", fmt.Errorf("failed to parse the base config: %w", err)
+		}
+	}
+	for i, patch := range patches {
+		patchDocs := clusterConfigDocuments(patch)
+		if len(patchDocs) != 1 {
+			return "", fmt.Errorf("config patch %d must have exactly one ClusterConfig document, found %d", i, len(patchDocs))
+		}
+		var p yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(patchDocs[0].content), &p); err != nil {
+			return "", fmt.Errorf("failed to parse config patch %d: %w", i, err)
+		}
+		merged = mergeMaps(merged, p)
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	if target < 0 {
+		docs = append(docs, yamlDocument{})
+		target = len(docs) - 1
+	}
+	contents := make([]string, len(docs))
+	for i, doc := range docs {
+		contents[i] = strings.TrimSuffix(doc.content, "\n")
+	}
+	contents[target] = strings.TrimSuffix(string(out), "\n")
+	return strings.Join(contents, "\n---\n") + "\n", nil
+}
+
+// mergeMaps merges the patch into the base map, the base is not modified
+func mergeMaps(base, patch yaml.MapSlice) yaml.MapSlice {
+	if directive, _ := lookup(patch, patchDirective); directive == "replace" {
+		return mergeMaps(nil, withoutKey(patch, patchDirective))
+	}
+
+	merged := make(yaml.MapSlice, 0, len(base)+len(patch))
+	merged = append(merged, base...)
+	for _, item := range patch {
+		if item.Key == patchDirective {
+			continue
+		}
+		index := -1
+		for i, baseItem := range merged {
+			if baseItem.Key == item.Key {
+				index = i
+				break
+			}
+		}
+		switch {
+		case item.Value == nil:
+			if index >= 0 {
+				merged = append(merged[:index:index], merged[index+1:]...)
+			}
+		case index < 0:
+			merged = append(merged, yaml.MapItem{Key: item.Key, Value: mergeValues(nil, item.Value)})
+		default:
+			merged[index] = yaml.MapItem{Key: item.Key, Value: mergeValues(merged[index].Value, item.Value)}
+		}
+	}
+	return merged
+}
+
+// mergeValues merges the patch value into the base value
+func mergeValues(base, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case yaml.MapSlice:
+		b, _ := base.(yaml.MapSlice)
+		return mergeMaps(b, p)
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || !isNamedList(b) || !isNamedList(p) {
+			return withoutDeletedItems(p)
+		}
+		return mergeNamedLists(b, p)
+	default:
+		return patch
+	}
+}
+
+// mergeNamedLists merges the lists of maps by their names, the new items are appended in the order of the patch
+func mergeNamedLists(base, patch []interface{}) []interface{} {
+	merged := make([]interface{}, 0, len(base)+len(patch))
+	merged = append(merged, base...)
+	for _, item := range patch {
+		p := item.(yaml.MapSlice)
+		name, _ := lookup(p, patchMergeKey)
+		index := -1
+		for i, baseItem := range merged {
+			if baseName, _ := lookup(baseItem.(yaml.MapSlice), patchMergeKey); baseName == name {
+				index = i
+				break
+			}
+		}
+		directive, _ := lookup(p, patchDirective)
+		switch {
+		case directive == "delete":
+			if index >= 0 {
+				merged = append(merged[:index:index], merged[index+1:]...)
+			}
+		case index < 0:
+			merged = append(merged, mergeMaps(nil, p))
+		default:
+			merged[index] = mergeMaps(merged[index].(yaml.MapSlice), p)
+		}
+	}
+	return merged
+}
+
+// withoutDeletedItems drops the items marked to be deleted from a list which replaces the one in the base
+func withoutDeletedItems(list []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(yaml.MapSlice); ok {
+			if directive, _ := lookup(m, patchDirective); directive == "delete" {
+				continue
+			}
+			item = mergeMaps(nil, m)
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// isNamedList tells if the list is a non-empty list of maps which all have a name
+func isNamedList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		m, ok := item.(yaml.MapSlice)
+		if !ok {
+			return false
+		}
+		if _, found := lookup(m, patchMergeKey); !found {
+			return false
+		}
+	}
+	return true
+}
+
+func lookup(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+func withoutKey(m yaml.MapSlice, key string) yaml.MapSlice {
+	result := make(yaml.MapSlice, 0, len(m))
+	for _, item := range m {
+		if item.Key != key {
+			result = append(result, item)
+		}
+	}
+	return result
+}
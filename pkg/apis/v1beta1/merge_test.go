@@ -0,0 +1,103 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+const baseConfig = `apiVersion: k0s.k0sproject.io/v1beta1
+kind: Cluster
+spec:
+  api:
+    address: 10.0.0.1
+    sans:
+    - 10.0.0.1
+    extraArgs:
+      audit-log-maxage: "30"
+  workerProfiles:
+  - name: default
+    values:
+      maxPods: 100
+  - name: gpu
+    values:
+      maxPods: 50
+`
+
+func TestMergeYAML(t *testing.T) {
+	patch := `spec:
+  api:
+    address: 10.0.1.1
+    sans:
+    - k0s.example.com
+    extraArgs: null
+  workerProfiles:
+  - name: gpu
+    $patch: delete
+  - name: default
+    values:
+      podPidsLimit: 1000
+  - name: edge
+    values:
+      maxPods: 20
+`
+	merged, err := MergeYAML(baseConfig, patch)
+	require.NoError(t, err)
+
+	c, err := FromYamlString(merged, constant.GetConfig(""))
+	require.NoError(t, err)
+	assert.Equal(t, "Cluster", c.Kind)
+	assert.Equal(t, "10.0.1.1", c.Spec.API.Address)
+	assert.Equal(t, []string{"k0s.example.com"}, c.Spec.API.SANs)
+	assert.Empty(t, c.Spec.API.ExtraArgs)
+
+	require.Len(t, c.Spec.WorkerProfiles, 2)
+	assert.Equal(t, "default", c.Spec.WorkerProfiles[0].Name)
+	assert.Equal(t, map[string]interface{}{"maxPods": 100, "podPidsLimit": 1000}, c.Spec.WorkerProfiles[0].Values)
+	assert.Equal(t, "edge", c.Spec.WorkerProfiles[1].Name)
+}
+
+func TestMergeYAMLInOrder(t *testing.T) {
+	merged, err := MergeYAML(baseConfig,
+		"spec:\n  api:\n    address: 10.0.1.1\n",
+		"spec:\n  api:\n    $patch: replace\n    address: 10.0.2.1\n",
+	)
+	require.NoError(t, err)
+
+	c, err := FromYamlString(merged, constant.GetConfig(""))
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.2.1", c.Spec.API.Address)
+	assert.Empty(t, c.Spec.API.ExtraArgs)
+}
+
+func TestMergeYAMLMultiDocument(t *testing.T) {
+	merged, err := MergeYAML(multiDocumentConfig, "spec:\n  network:\n    podCIDR: 10.244.0.0/16\n")
+	require.NoError(t, err)
+
+	configs, errors := ValidateYAML(merged, constant.GetConfig(""), false)
+	assert.Empty(t, errors)
+	require.Len(t, configs, 1)
+	assert.Equal(t, 1, configs[0].Index)
+	assert.Equal(t, "10.244.0.0/16", configs[0].Config.Spec.Network.PodCIDR)
+
+	_, err = MergeYAML(baseConfig, "apiVersion: v1\nkind: ConfigMap\n")
+	assert.Error(t, err)
+}
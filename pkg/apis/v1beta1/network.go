@@ -50,33 +50,53 @@ func (n *Network) Validate() []error {
 		errors = append(errors, fmt.Errorf("unsupported network provider: %s", n.Provider))
 	}
 
-	_, _, err := net.ParseCIDR(n.PodCIDR)
+	_, podNet, err := net.ParseCIDR(n.PodCIDR)
 	if err != nil {
 		errors = append(errors, fmt.Errorf("invalid pod CIDR %s", n.PodCIDR))
 	}
 
-	_, _, err = net.ParseCIDR(n.ServiceCIDR)
+	_, serviceNet, err := net.ParseCIDR(n.ServiceCIDR)
 	if err != nil {
 		errors = append(errors, fmt.Errorf("invalid service CIDR %s", n.ServiceCIDR))
 	}
+	if overlaps(podNet, serviceNet) {
+		errors = append(errors, &FieldError{
+			Field: "spec.network.serviceCIDR",
+			Err:   fmt.Errorf("service CIDR %s overlaps with pod CIDR %s", n.ServiceCIDR, n.PodCIDR),
+		})
+	}
 
 	if n.DualStack.Enabled {
 		if n.Provider == "calico" && n.Calico.Mode != "bird" {
 			errors = append(errors, fmt.Errorf("network dual stack is supported only for calico mode `bird`"))
 		}
-		_, _, err := net.ParseCIDR(n.DualStack.IPv6PodCIDR)
+		_, podNet, err := net.ParseCIDR(n.DualStack.IPv6PodCIDR)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("invalid pod IPv6 CIDR %s", n.DualStack.IPv6PodCIDR))
 		}
-		_, _, err = net.ParseCIDR(n.DualStack.IPv6ServiceCIDR)
+		_, serviceNet, err := net.ParseCIDR(n.DualStack.IPv6ServiceCIDR)
 		if err != nil {
 			errors = append(errors, fmt.Errorf("invalid service IPv6 CIDR %s", n.DualStack.IPv6ServiceCIDR))
 		}
+		if overlaps(podNet, serviceNet) {
+			errors = append(errors, &FieldError{
+				Field: "spec.network.dualStack.IPv6serviceCIDR",
+				Err:   fmt.Errorf("service IPv6 CIDR %s overlaps with pod IPv6 CIDR %s", n.DualStack.IPv6ServiceCIDR, n.DualStack.IPv6PodCIDR),
+			})
+		}
 	}
 
 	return errors
 }
 
+// overlaps tells if the networks share any addresses, networks that failed to parse don't overlap
+func overlaps(a, b *net.IPNet) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
 // DNSAddress calculates the 10th address of configured service CIDR block.
 func (n *Network) DNSAddress() (string, error) {
 	_, ipnet, err := net.ParseCIDR(n.ServiceCIDR)
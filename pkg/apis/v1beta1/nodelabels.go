@@ -0,0 +1,66 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NodeLabelsSpec defines which of the labels the workers request with k0s worker --labels, but kubelet isn't allowed
+// to set by itself, e.g. node-role.kubernetes.io/worker, are set by the controllers
+type NodeLabelsSpec struct {
+	// AllowedPrefixes are the prefixes of the label keys the controllers set, e.g. node-role.kubernetes.io/
+	AllowedPrefixes []string `yaml:"allowedPrefixes,omitempty"`
+}
+
+// Validate checks the prefixes are label keys or label key prefixes ending with a slash
+func (n *NodeLabelsSpec) Validate() []error {
+	if n == nil {
+		return nil
+	}
+	var errors []error
+	for _, prefix := range n.AllowedPrefixes {
+		var errs []string
+		if domain := strings.TrimSuffix(prefix, "/"); domain != prefix {
+			errs = validation.IsDNS1123Subdomain(domain)
+		} else {
+			errs = validation.IsQualifiedName(prefix)
+		}
+		if len(errs) > 0 {
+			errors = append(errors, &FieldError{
+				Field: "spec.nodeLabels.allowedPrefixes",
+				Err:   fmt.Errorf("%q must be a label key or a prefix like node-role.kubernetes.io/: %s", prefix, strings.Join(errs, "; ")),
+			})
+		}
+	}
+	return errors
+}
+
+// Allows tells if the label key has one of the allowed prefixes
+func (n *NodeLabelsSpec) Allows(key string) bool {
+	if n == nil {
+		return false
+	}
+	for _, prefix := range n.AllowedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeLabelsSpec(t *testing.T) {
+	var unset *NodeLabelsSpec
+	assert.Empty(t, unset.Validate())
+	assert.False(t, unset.Allows("node-role.kubernetes.io/worker"))
+
+	n := &NodeLabelsSpec{AllowedPrefixes: []string{"node-role.kubernetes.io/", "node-restriction.kubernetes.io/edge"}}
+	assert.Empty(t, n.Validate())
+	assert.True(t, n.Allows("node-role.kubernetes.io/worker"))
+	assert.True(t, n.Allows("node-restriction.kubernetes.io/edge"))
+	assert.False(t, n.Allows("node-restriction.kubernetes.io/other"))
+	assert.False(t, n.Allows("kubernetes.io/hostname"))
+
+	n = &NodeLabelsSpec{AllowedPrefixes: []string{"Node_Role/", "k0s=edge", ""}}
+	assert.Len(t, n.Validate(), 3)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+const (
+	// NvidiaHelmRepository is the helm repository of the NVIDIA GPU operator
+	NvidiaHelmRepository = "https://nvidia.github.io/gpu-operator"
+	// NvidiaGPUOperatorChart is the name of the chart and the Chart resource of the NVIDIA GPU operator
+	NvidiaGPUOperatorChart = "gpu-operator"
+)
+
+// NvidiaSpec enables the NVIDIA GPU support. k0s registers the nvidia runtime of nvidia-container-toolkit in the
+// containerd of the workers and deploys the device plugin, or the GPU operator instead of it.
+type NvidiaSpec struct {
+	// DevicePlugin is the image of the NVIDIA device plugin
+	DevicePlugin *ImageSpec `yaml:"devicePlugin,omitempty"`
+	// GPUOperator deploys the NVIDIA GPU operator chart instead of the device plugin
+	GPUOperator *GPUOperatorSpec `yaml:"gpuOperator,omitempty"`
+}
+
+// GPUOperatorSpec defines the NVIDIA GPU operator chart
+type GPUOperatorSpec struct {
+	Version string `yaml:"version,omitempty"`
+	// Values replace the k0s default values of the chart
+	Values string `yaml:"values,omitempty"`
+}
+
+// defaultGPUOperatorValues disable the container toolkit of the GPU operator, k0s configures the nvidia runtime of
+// containerd itself
+const defaultGPUOperatorValues = `operator:
+  defaultRuntime: containerd
+toolkit:
+  enabled: false
+`
+
+// Nvidia returns spec.extensions.nvidia, nil if the NVIDIA GPU support isn't enabled
+func (s *ClusterSpec) Nvidia() *NvidiaSpec {
+	if s == nil || s.Extensions == nil {
+		return nil
+	}
+	return s.Extensions.Nvidia
+}
+
+// NvidiaDevicePluginImage returns the image URI of the device plugin, with the image repository override applied
+func (s *ClusterSpec) NvidiaDevicePluginImage() string {
+	image := ImageSpec{
+		Image:   constant.NvidiaDevicePluginImage,
+		Version: constant.NvidiaDevicePluginImageVersion,
+	}
+	if n := s.Nvidia(); n != nil && n.DevicePlugin != nil {
+		if n.DevicePlugin.Image != "" {
+			image.Image = n.DevicePlugin.Image
+		}
+		if n.DevicePlugin.Version != "" {
+			image.Version = n.DevicePlugin.Version
+		}
+	}
+	if s.Images != nil && s.Images.Repository != "" {
+		image.Image = overrideRepository(s.Images.Repository, image.Image)
+	}
+	return image.URI()
+}
+
+// chart returns the helm repository and chart of the GPU operator
+func (g *GPUOperatorSpec) chart() (Repository, Chart) {
+	version := g.Version
+	if version == "" {
+		version = constant.NvidiaGPUOperatorVersion
+	}
+	values := g.Values
+	if values == "" {
+		values = defaultGPUOperatorValues
+	}
+	return Repository{Name: "nvidia", URL: NvidiaHelmRepository}, Chart{
+		Name:      NvidiaGPUOperatorChart,
+		ChartName: "nvidia/gpu-operator",
+		Version:   version,
+		Values:    values,
+		TargetNS:  "gpu-operator-resources",
+	}
+}
+
+// Validate validates NvidiaSpec struct
+func (n *NvidiaSpec) Validate() []error {
+	if n == nil {
+		return nil
+	}
+	var errors []error
+	if n.DevicePlugin != nil && n.GPUOperator != nil {
+		errors = append(errors, &FieldError{
+			Field: "spec.extensions.nvidia.devicePlugin",
+			Err:   fmt.Errorf("the GPU operator deploys its own device plugin, devicePlugin can't be set with gpuOperator"),
+		})
+	}
+	return errors
+}
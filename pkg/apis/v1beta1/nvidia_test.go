@@ -0,0 +1,60 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNvidiaDevicePluginImage(t *testing.T) {
+	spec := &ClusterSpec{
+		Images:     DefaultClusterImages(),
+		Extensions: &ClusterExtensions{Nvidia: &NvidiaSpec{}},
+	}
+	assert.Equal(t, "nvcr.io/nvidia/k8s-device-plugin:v0.9.0", spec.NvidiaDevicePluginImage())
+
+	spec.Images.Repository = "registry.example.com"
+	spec.Extensions.Nvidia.DevicePlugin = &ImageSpec{Version: "v0.9.1"}
+	assert.Equal(t, "registry.example.com/nvidia/k8s-device-plugin:v0.9.1", spec.NvidiaDevicePluginImage())
+}
+
+func TestNvidiaGPUOperatorHelmExtensions(t *testing.T) {
+	spec := &ClusterSpec{}
+	assert.Nil(t, spec.HelmExtensions())
+
+	userChart := Chart{Name: "prometheus", ChartName: "stable/prometheus"}
+	drift := &HelmDriftDetection{Correction: DriftCorrectionPatch}
+	spec.Extensions = &ClusterExtensions{
+		Helm:   &HelmExtensions{Charts: []Chart{userChart}, DriftDetection: drift},
+		Nvidia: &NvidiaSpec{GPUOperator: &GPUOperatorSpec{}},
+	}
+	helm := spec.HelmExtensions()
+	require.Len(t, helm.Charts, 2)
+	assert.Equal(t, userChart, helm.Charts[0])
+	assert.Equal(t, "nvidia/gpu-operator", helm.Charts[1].ChartName)
+	assert.Equal(t, "v1.6.2", helm.Charts[1].Version)
+	assert.Contains(t, helm.Charts[1].Values, "enabled: false")
+	assert.Equal(t, NvidiaHelmRepository, helm.Repositories[0].URL)
+	assert.Equal(t, drift, helm.DriftDetection)
+	// the user config is not modified
+	assert.Len(t, spec.Extensions.Helm.Charts, 1)
+
+	spec.Extensions.Nvidia.DevicePlugin = &ImageSpec{Version: "v0.9.1"}
+	assert.Len(t, spec.Nvidia().Validate(), 1)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// OIDCSpec defines the OpenID Connect authentication settings for the api server
+type OIDCSpec struct {
+	IssuerURL      string `yaml:"issuerURL"`
+	ClientID       string `yaml:"clientID"`
+	UsernameClaim  string `yaml:"usernameClaim,omitempty"`
+	UsernamePrefix string `yaml:"usernamePrefix,omitempty"`
+	GroupsClaim    string `yaml:"groupsClaim,omitempty"`
+	GroupsPrefix   string `yaml:"groupsPrefix,omitempty"`
+	CAFile         string `yaml:"caFile,omitempty"`
+}
+
+// APIServerArgs returns the kube-apiserver flags for the OIDC settings
+func (o *OIDCSpec) APIServerArgs() map[string]string {
+	args := map[string]string{
+		"oidc-issuer-url": o.IssuerURL,
+		"oidc-client-id":  o.ClientID,
+	}
+	if o.UsernameClaim != "" {
+		args["oidc-username-claim"] = o.UsernameClaim
+	}
+	if o.UsernamePrefix != "" {
+		args["oidc-username-prefix"] = o.UsernamePrefix
+	}
+	if o.GroupsClaim != "" {
+		args["oidc-groups-claim"] = o.GroupsClaim
+	}
+	if o.GroupsPrefix != "" {
+		args["oidc-groups-prefix"] = o.GroupsPrefix
+	}
+	if o.CAFile != "" {
+		args["oidc-ca-file"] = o.CAFile
+	}
+	return args
+}
+
+// Validate validates OIDCSpec struct
+func (o *OIDCSpec) Validate() []error {
+	var errors []error
+
+	issuer, err := url.Parse(o.IssuerURL)
+	if err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+		errors = append(errors, fmt.Errorf("oidc issuerURL %q must be a https URL", o.IssuerURL))
+	}
+	if o.ClientID == "" {
+		errors = append(errors, fmt.Errorf("oidc clientID must be set"))
+	}
+
+	return errors
+}
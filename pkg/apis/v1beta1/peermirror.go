@@ -0,0 +1,80 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+
+	"github.com/k0sproject/k0s/internal/util"
+)
+
+// DefaultPeerMirrorPort is the port the peer mirrors listen on the workers
+const DefaultPeerMirrorPort = 30020
+
+// defaultPeerMirrorRegistries are the public registries mirrored by the peers by default
+var defaultPeerMirrorRegistries = []string{"docker.io", "gcr.io", "ghcr.io", "k8s.gcr.io", "quay.io"}
+
+// PeerMirrorSpec enables the peer-to-peer registry mirror. Every worker serves the images pulled by its containerd to
+// the other workers, and the other workers pull from their peers before the registries.
+type PeerMirrorSpec struct {
+	// Port is the port the mirror listens on the workers, 30020 by default
+	Port int `yaml:"port,omitempty"`
+	// Registries are the mirrored registries, the public ones and the ones of spec.registries by default
+	Registries []string `yaml:"registries,omitempty"`
+	// ResolveTags serves the tags from the peers too. By default only the digests are, the tags are still resolved
+	// from the registries so the updated tags are never missed.
+	ResolveTags bool `yaml:"resolveTags,omitempty"`
+}
+
+// PeerMirrorConfig returns spec.peerMirror with the defaults applied, nil if the peer mirror isn't enabled
+func (s *ClusterSpec) PeerMirrorConfig() *PeerMirrorSpec {
+	if s == nil || s.PeerMirror == nil {
+		return nil
+	}
+	mirror := *s.PeerMirror
+	if mirror.Port == 0 {
+		mirror.Port = DefaultPeerMirrorPort
+	}
+	if len(mirror.Registries) == 0 {
+		mirror.Registries = append([]string(nil), defaultPeerMirrorRegistries...)
+		for _, registry := range s.Registries {
+			if !util.StringSliceContains(mirror.Registries, registry.Host) {
+				mirror.Registries = append(mirror.Registries, registry.Host)
+			}
+		}
+	}
+	return &mirror
+}
+
+// Validate validates the port and the registries
+func (p *PeerMirrorSpec) Validate() []error {
+	if p == nil {
+		return nil
+	}
+	var errors []error
+	if p.Port < 0 || p.Port > 65535 {
+		errors = append(errors, &FieldError{Field: "spec.peerMirror.port", Err: fmt.Errorf("%d is not a valid port", p.Port)})
+	}
+	for _, registry := range p.Registries {
+		if !validRegistryHost(registry) {
+			errors = append(errors, &FieldError{
+				Field: "spec.peerMirror.registries",
+				Err:   fmt.Errorf("%q is not a valid registry host, expected host or host:port", registry),
+			})
+		}
+	}
+	return errors
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerMirrorConfig(t *testing.T) {
+	assert.Nil(t, (&ClusterSpec{}).PeerMirrorConfig())
+
+	spec := &ClusterSpec{
+		PeerMirror: &PeerMirrorSpec{},
+		Registries: Registries{{Host: "docker.io"}, {Host: "registry.local:5000"}},
+	}
+	config := spec.PeerMirrorConfig()
+	assert.Equal(t, DefaultPeerMirrorPort, config.Port)
+	assert.Equal(t, []string{"docker.io", "gcr.io", "ghcr.io", "k8s.gcr.io", "quay.io", "registry.local:5000"}, config.Registries)
+	assert.Empty(t, spec.PeerMirror.Registries, "the spec must not be modified")
+
+	spec.PeerMirror = &PeerMirrorSpec{Port: 5000, Registries: []string{"quay.io"}}
+	assert.Equal(t, &PeerMirrorSpec{Port: 5000, Registries: []string{"quay.io"}}, spec.PeerMirrorConfig())
+}
+
+func TestPeerMirrorValidate(t *testing.T) {
+	assert.Empty(t, (*PeerMirrorSpec)(nil).Validate())
+	assert.Empty(t, (&PeerMirrorSpec{Port: 30020, Registries: []string{"docker.io", "registry.local:5000"}}).Validate())
+	assert.Len(t, (&PeerMirrorSpec{Port: 70000, Registries: []string{"https://docker.io"}}).Validate(), 2)
+}
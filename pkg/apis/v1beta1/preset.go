@@ -0,0 +1,101 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+
+	"github.com/k0sproject/k0s/internal/util"
+)
+
+// ConformancePreset enables the settings the CNCF conformance tests expect in one switch
+const ConformancePreset = "conformance"
+
+// conformanceAdmissionPlugins are the admission plugins the conformance tests rely on
+var conformanceAdmissionPlugins = []string{
+	"NamespaceLifecycle",
+	"LimitRanger",
+	"ServiceAccount",
+	"DefaultStorageClass",
+	"DefaultTolerationSeconds",
+	"MutatingAdmissionWebhook",
+	"ValidatingAdmissionWebhook",
+	"ResourceQuota",
+}
+
+// conformanceAPIServerArgs are the api server flags the conformance preset sets
+var conformanceAPIServerArgs = map[string]string{
+	"runtime-config": "api/beta=true",
+}
+
+// PresetDeviation is a setting the preset adds on top of the k0s defaults
+type PresetDeviation struct {
+	Setting string
+	Value   string
+}
+
+func (d PresetDeviation) String() string {
+	return fmt.Sprintf("%s: %s", d.Setting, d.Value)
+}
+
+func validatePreset(preset string) []error {
+	switch preset {
+	case "", ConformancePreset:
+		return nil
+	default:
+		return []error{fmt.Errorf("unknown preset %q, supported presets: %s", preset, ConformancePreset)}
+	}
+}
+
+// ApplyPreset applies spec.preset on top of the spec and returns the settings changed from the defaults. The settings
+// given explicitly in the config are kept, so the preset only fills in what's not configured.
+func (s *ClusterSpec) ApplyPreset() []PresetDeviation {
+	if s.Preset != ConformancePreset {
+		return nil
+	}
+	var deviations []PresetDeviation
+
+	if s.API.Admission == nil {
+		s.API.Admission = &AdmissionSpec{}
+	}
+	admission := s.API.Admission
+	for _, plugin := range conformanceAdmissionPlugins {
+		if util.StringSliceContains(admission.EnabledPlugins, plugin) || util.StringSliceContains(admission.DisabledPlugins, plugin) {
+			continue
+		}
+		admission.EnabledPlugins = append(admission.EnabledPlugins, plugin)
+		deviations = append(deviations, PresetDeviation{
+			Setting: "spec.api.admission.enabledPlugins",
+			Value:   plugin,
+		})
+	}
+
+	if s.API.ExtraArgs == nil {
+		s.API.ExtraArgs = make(map[string]string)
+	}
+	for name, value := range conformanceAPIServerArgs {
+		if _, found := s.API.ExtraArgs[name]; found {
+			continue
+		}
+		s.API.ExtraArgs[name] = value
+		deviations = append(deviations, PresetDeviation{
+			Setting: "spec.api.extraArgs." + name,
+			Value:   value,
+		})
+	}
+
+	return deviations
+}
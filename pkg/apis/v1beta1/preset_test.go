@@ -0,0 +1,59 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConformancePreset(t *testing.T) {
+	yamlData := `
+apiVersion: k0s.k0sproject.io/v1beta1
+kind: Cluster
+metadata:
+  name: foobar
+spec:
+  preset: conformance
+  api:
+    extraArgs:
+      runtime-config: api/all=true
+    admission:
+      disabledPlugins:
+      - DefaultStorageClass
+`
+
+	c, err := fromYaml(t, yamlData)
+	assert.NoError(t, err)
+	assert.Empty(t, validatePreset(c.Spec.Preset))
+
+	deviations := c.Spec.ApplyPreset()
+	assert.Len(t, deviations, len(conformanceAdmissionPlugins)-1)
+	assert.Contains(t, c.Spec.API.Admission.EnabledPlugins, "MutatingAdmissionWebhook")
+	assert.NotContains(t, c.Spec.API.Admission.EnabledPlugins, "DefaultStorageClass", "explicitly disabled plugins must be kept disabled")
+	assert.Equal(t, "api/all=true", c.Spec.API.ExtraArgs["runtime-config"], "explicitly set flags must be kept")
+	assert.Empty(t, c.Spec.API.Admission.Validate())
+}
+
+func TestPresetValidation(t *testing.T) {
+	c, err := fromYaml(t, "apiVersion: k0s.k0sproject.io/v1beta1\nspec:\n  preset: foobar")
+	assert.NoError(t, err)
+	assert.Len(t, validatePreset(c.Spec.Preset), 1)
+
+	c = DefaultClusterConfig(c.k0sVars)
+	assert.Nil(t, c.Spec.ApplyPreset())
+}
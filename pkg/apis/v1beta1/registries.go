@@ -0,0 +1,105 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// Registries configure the image registries of the k0s managed containerd on every worker. They are rendered into the
+// certs.d host configs of containerd.
+type Registries []Registry
+
+// Registry configures the pulls from a single registry
+type Registry struct {
+	// Host is the registry host, with the port if any, e.g. docker.io or registry.local:5000
+	Host string `yaml:"host"`
+	// Mirrors are the endpoint URLs tried in order before the registry itself
+	Mirrors []string `yaml:"mirrors,omitempty"`
+	// Insecure skips the TLS verification of the registry and its mirrors
+	Insecure bool `yaml:"insecure,omitempty"`
+	// CA is the PEM encoded CA bundle of the registry and its mirrors
+	CA string `yaml:"ca,omitempty"`
+	// Auth are the pull credentials of the registry
+	Auth *RegistryAuth `yaml:"auth,omitempty"`
+}
+
+// RegistryAuth refers to the credentials of a registry in the docker config.json format. The credentials themselves
+// are never stored in the cluster config.
+type RegistryAuth struct {
+	// File is a docker config.json on the workers
+	File string `yaml:"file,omitempty"`
+	// SecretRef is a kubernetes.io/dockerconfigjson Secret in kube-system, readable by the workers
+	SecretRef string `yaml:"secretRef,omitempty"`
+}
+
+// SecretRefs returns the names of the auth Secrets of the registries
+func (r Registries) SecretRefs() []string {
+	var names []string
+	for _, registry := range r {
+		if registry.Auth != nil && registry.Auth.SecretRef != "" {
+			names = append(names, registry.Auth.SecretRef)
+		}
+	}
+	return names
+}
+
+// Validate validates the registry hosts, mirrors and auth
+func (r Registries) Validate() []error {
+	var errors []error
+	fieldError := func(i int, field string, format string, args ...interface{}) {
+		errors = append(errors, &FieldError{Field: fmt.Sprintf("spec.registries[%d].%s", i, field), Err: fmt.Errorf(format, args...)})
+	}
+
+	hosts := make(map[string]bool)
+	for i, registry := range r {
+		if !validRegistryHost(registry.Host) {
+			fieldError(i, "host", "%q is not a valid registry host, expected host or host:port", registry.Host)
+		} else if hosts[registry.Host] {
+			fieldError(i, "host", "%q is configured more than once", registry.Host)
+		}
+		hosts[registry.Host] = true
+
+		for _, mirror := range registry.Mirrors {
+			u, err := url.Parse(mirror)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fieldError(i, "mirrors", "%q is not a valid http(s) URL", mirror)
+			}
+		}
+
+		if registry.Auth != nil {
+			if (registry.Auth.File == "") == (registry.Auth.SecretRef == "") {
+				fieldError(i, "auth", "exactly one of file and secretRef has to be set")
+			} else if registry.Auth.SecretRef != "" && !hostnameRe.MatchString(registry.Auth.SecretRef) {
+				fieldError(i, "auth.secretRef", "%q is not a valid Secret name", registry.Auth.SecretRef)
+			}
+		}
+	}
+	return errors
+}
+
+func validRegistryHost(host string) bool {
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return false
+		}
+		host = h
+	}
+	return net.ParseIP(host) != nil || (len(host) <= 253 && hostnameRe.MatchString(host))
+}
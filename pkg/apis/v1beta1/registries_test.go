@@ -0,0 +1,61 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistries(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		r := Registries{
+			{Host: "docker.io", Mirrors: []string{"https://mirror.example.com", "http://10.0.0.10:5000"}},
+			{Host: "registry.local:5000", Insecure: true, Auth: &RegistryAuth{SecretRef: "registry-local"}},
+			{Host: "10.0.0.11", Auth: &RegistryAuth{File: "/root/.docker/config.json"}},
+		}
+		assert.Empty(t, r.Validate())
+		assert.Equal(t, []string{"registry-local"}, r.SecretRefs())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		r := Registries{
+			{Host: "https://docker.io", Mirrors: []string{"mirror.example.com"}},
+			{Host: "registry.local:99999"},
+			{Host: "quay.io", Auth: &RegistryAuth{}},
+			{Host: "quay.io", Auth: &RegistryAuth{SecretRef: "Quay_Auth"}},
+		}
+		var fields []string
+		for _, err := range r.Validate() {
+			fields = append(fields, err.(*FieldError).Field)
+		}
+		assert.Equal(t, []string{
+			"spec.registries[0].host",
+			"spec.registries[0].mirrors",
+			"spec.registries[1].host",
+			"spec.registries[2].auth",
+			"spec.registries[3].host",
+			"spec.registries[3].auth.secretRef",
+		}, fields)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var r Registries
+		assert.Empty(t, r.Validate())
+		assert.Empty(t, r.SecretRefs())
+	})
+}
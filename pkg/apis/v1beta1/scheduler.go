@@ -0,0 +1,131 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SchedulerConfigAPIVersion is the KubeSchedulerConfiguration version used when the config doesn't set one
+	SchedulerConfigAPIVersion = "kubescheduler.config.k8s.io/v1beta1"
+	// SchedulerConfigKind is the kind of the scheduler config
+	SchedulerConfigKind = "KubeSchedulerConfiguration"
+)
+
+// Validate checks the scheduler config, the kubeconfig of the scheduler is managed by k0s
+func (s *SchedulerSpec) Validate() []error {
+	if s == nil || len(s.Config) == 0 {
+		return nil
+	}
+	var errors []error
+	fieldError := func(field string, format string, args ...interface{}) {
+		errors = append(errors, &FieldError{Field: "spec.scheduler.config" + field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if _, found := s.ExtraArgs["config"]; found {
+		errors = append(errors, &FieldError{Field: "spec.scheduler.extraArgs", Err: fmt.Errorf("config cannot be set in extraArgs when spec.scheduler.config is used")})
+	}
+	if apiVersion, ok := s.Config["apiVersion"]; ok && !strings.HasPrefix(fmt.Sprint(apiVersion), "kubescheduler.config.k8s.io/") {
+		fieldError(".apiVersion", "unsupported apiVersion %v", apiVersion)
+	}
+	if kind, ok := s.Config["kind"]; ok && kind != SchedulerConfigKind {
+		fieldError(".kind", "kind must be %s", SchedulerConfigKind)
+	}
+	if kubeconfig := configMap(s.Config["clientConnection"])["kubeconfig"]; kubeconfig != nil {
+		fieldError(".clientConnection.kubeconfig", "the scheduler kubeconfig is managed by k0s")
+	}
+
+	if profiles, ok := s.Config["profiles"]; ok {
+		list, ok := profiles.([]interface{})
+		if !ok {
+			fieldError(".profiles", "profiles must be a list")
+			return errors
+		}
+		names := make(map[string]bool)
+		for i, profile := range list {
+			name := fmt.Sprint(configMap(profile)["schedulerName"])
+			if configMap(profile)["schedulerName"] == nil {
+				// the scheduler defaults the name of a single profile only
+				if len(list) > 1 {
+					fieldError(fmt.Sprintf(".profiles[%d].schedulerName", i), "schedulerName is required when there are several profiles")
+				}
+				name = "default-scheduler"
+			}
+			if names[name] {
+				fieldError(fmt.Sprintf(".profiles[%d].schedulerName", i), "duplicate scheduler name %s", name)
+			}
+			names[name] = true
+		}
+	}
+
+	return errors
+}
+
+// KubeSchedulerConfiguration returns the scheduler config with the k0s managed fields set. The fields k0s manages
+// through the flags have to be set in the config as kube-scheduler ignores the deprecated flags when a config is given.
+func (s *SchedulerSpec) KubeSchedulerConfiguration(kubeconfig string, leaderElect bool) map[string]interface{} {
+	config := make(map[string]interface{}, len(s.Config)+4)
+	for k, v := range s.Config {
+		config[k] = v
+	}
+	if config["apiVersion"] == nil {
+		config["apiVersion"] = SchedulerConfigAPIVersion
+	}
+	if config["kind"] == nil {
+		config["kind"] = SchedulerConfigKind
+	}
+	if config["enableProfiling"] == nil {
+		config["enableProfiling"] = false
+	}
+
+	clientConnection := copyConfigMap(config["clientConnection"])
+	clientConnection["kubeconfig"] = kubeconfig
+	config["clientConnection"] = clientConnection
+
+	leaderElection := copyConfigMap(config["leaderElection"])
+	if !leaderElect || leaderElection["leaderElect"] == nil {
+		leaderElection["leaderElect"] = leaderElect
+	}
+	config["leaderElection"] = leaderElection
+
+	return config
+}
+
+// configMap returns the nested map of the config, nil if the value isn't a map
+func configMap(v interface{}) map[interface{}]interface{} {
+	switch m := v.(type) {
+	case map[interface{}]interface{}:
+		return m
+	case map[string]interface{}:
+		result := make(map[interface{}]interface{}, len(m))
+		for k, v := range m {
+			result[k] = v
+		}
+		return result
+	}
+	return nil
+}
+
+// copyConfigMap returns a copy of the nested map of the config which can be modified
+func copyConfigMap(v interface{}) map[interface{}]interface{} {
+	result := make(map[interface{}]interface{})
+	for k, v := range configMap(v) {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestSchedulerConfig(t *testing.T) {
+	yml := `
+spec:
+  scheduler:
+    config:
+      profiles:
+      - schedulerName: default-scheduler
+      - schedulerName: bin-packing
+        pluginConfig:
+        - name: NodeResourcesMostAllocated
+          args:
+            resources:
+            - name: cpu
+              weight: 1
+      leaderElection:
+        leaseDuration: 30s
+`
+	c, err := FromYamlString(yml, constant.GetConfig(""))
+	require.NoError(t, err)
+	assert.Empty(t, c.Validate())
+
+	config := c.Spec.Scheduler.KubeSchedulerConfiguration("/var/lib/k0s/pki/scheduler.conf", false)
+	assert.Equal(t, SchedulerConfigAPIVersion, config["apiVersion"])
+	assert.Equal(t, SchedulerConfigKind, config["kind"])
+	assert.Equal(t, false, config["enableProfiling"])
+	assert.Equal(t, "/var/lib/k0s/pki/scheduler.conf", configMap(config["clientConnection"])["kubeconfig"])
+	assert.Equal(t, false, configMap(config["leaderElection"])["leaderElect"])
+	assert.Equal(t, "30s", configMap(config["leaderElection"])["leaseDuration"])
+	// the config in the cluster config is not modified
+	assert.Nil(t, c.Spec.Scheduler.Config["clientConnection"])
+	assert.Nil(t, configMap(c.Spec.Scheduler.Config["leaderElection"])["leaderElect"])
+}
+
+func TestSchedulerConfigValidation(t *testing.T) {
+	yml := `
+spec:
+  scheduler:
+    extraArgs:
+      config: /etc/kube-scheduler.yaml
+    config:
+      kind: Policy
+      clientConnection:
+        kubeconfig: /etc/kubeconfig
+      profiles:
+      - pluginConfig: []
+      - schedulerName: default-scheduler
+`
+	c, err := FromYamlString(yml, constant.GetConfig(""))
+	require.NoError(t, err)
+
+	var fields []string
+	for _, err := range c.Spec.Scheduler.Validate() {
+		if fieldErr, ok := err.(*FieldError); ok {
+			fields = append(fields, fieldErr.Field)
+		}
+	}
+	assert.Equal(t, []string{
+		"spec.scheduler.extraArgs",
+		"spec.scheduler.config.kind",
+		"spec.scheduler.config.clientConnection.kubeconfig",
+		"spec.scheduler.config.profiles[0].schedulerName",
+		"spec.scheduler.config.profiles[1].schedulerName",
+	}, fields)
+}
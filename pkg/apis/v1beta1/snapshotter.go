@@ -0,0 +1,72 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// SnapshotterSpec enables the CSI external-snapshotter: the snapshot.storage.k8s.io CRDs and the snapshot controller.
+// Their version follows the bundled Kubernetes version, they are upgraded with k0s.
+type SnapshotterSpec struct {
+	// Replicas of the snapshot controller, defaults to 1. The replicas elect a leader.
+	Replicas int `yaml:"replicas,omitempty"`
+}
+
+// Snapshotter returns spec.extensions.snapshotter, nil if the snapshotter isn't enabled
+func (s *ClusterSpec) Snapshotter() *SnapshotterSpec {
+	if s == nil || s.Extensions == nil {
+		return nil
+	}
+	return s.Extensions.Snapshotter
+}
+
+// ReplicasOrDefault returns the replicas of the snapshot controller
+func (sn *SnapshotterSpec) ReplicasOrDefault() int {
+	if sn.Replicas == 0 {
+		return 1
+	}
+	return sn.Replicas
+}
+
+// SnapshotControllerImage returns the image URI of the snapshot controller, with the image repository override applied
+func (s *ClusterSpec) SnapshotControllerImage() string {
+	image := ImageSpec{
+		Image:   constant.SnapshotControllerImage,
+		Version: constant.SnapshotControllerImageVersion,
+	}
+	if s.Images != nil && s.Images.Repository != "" {
+		image.Image = overrideRepository(s.Images.Repository, image.Image)
+	}
+	return image.URI()
+}
+
+// Validate validates SnapshotterSpec struct
+func (sn *SnapshotterSpec) Validate() []error {
+	if sn == nil {
+		return nil
+	}
+	var errors []error
+	if sn.Replicas < 0 {
+		errors = append(errors, &FieldError{
+			Field: "spec.extensions.snapshotter.replicas",
+			Err:   fmt.Errorf("replicas can't be negative, got %d", sn.Replicas),
+		})
+	}
+	return errors
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestSnapshotter(t *testing.T) {
+	// the bundled external-snapshotter has to be bumped with the Kubernetes version
+	assert.Equal(t, constant.KubernetesMajorMinorVersion, constant.SnapshotterKubernetesVersion)
+
+	spec := &ClusterSpec{Images: DefaultClusterImages()}
+	assert.Nil(t, spec.Snapshotter())
+	assert.Nil(t, spec.Snapshotter().Validate())
+
+	spec.Extensions = &ClusterExtensions{Snapshotter: &SnapshotterSpec{}}
+	assert.Equal(t, 1, spec.Snapshotter().ReplicasOrDefault())
+	assert.Equal(t, "k8s.gcr.io/sig-storage/snapshot-controller:v4.0.0", spec.SnapshotControllerImage())
+
+	spec.Images.Repository = "registry.example.com"
+	assert.Equal(t, "registry.example.com/sig-storage/snapshot-controller:v4.0.0", spec.SnapshotControllerImage())
+
+	spec.Extensions.Snapshotter.Replicas = -1
+	assert.Len(t, spec.Snapshotter().Validate(), 1)
+}
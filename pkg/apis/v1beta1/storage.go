@@ -16,6 +16,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -81,6 +82,7 @@ func (s *StorageSpec) IsJoinable() bool {
 func (s *StorageSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s.Type = EtcdStorageType
 	s.Etcd = DefaultEtcdConfig()
+	s.Kine = nil
 
 	type ystorageconfig StorageSpec
 	yc := (*ystorageconfig)(s)
@@ -93,7 +95,23 @@ func (s *StorageSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 // Validate validates storage specs correctness
 func (s *StorageSpec) Validate() []error {
-	return nil
+	var errors []error
+	switch s.Type {
+	case EtcdStorageType:
+		if s.Kine != nil {
+			errors = append(errors, &FieldError{
+				Field: "spec.storage.kine",
+				Err:   fmt.Errorf("kine settings are given but the storage type is %s", s.Type),
+			})
+		}
+	case KineStorageType:
+	default:
+		errors = append(errors, &FieldError{
+			Field: "spec.storage.type",
+			Err:   fmt.Errorf("unsupported storage type %q, must be %s or %s", s.Type, EtcdStorageType, KineStorageType),
+		})
+	}
+	return errors
 }
 
 // EtcdConfig defines etcd related config options
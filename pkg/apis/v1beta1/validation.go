@@ -0,0 +1,189 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// FieldError is a validation error of a single field, the field is its path in the config, e.g. spec.network.podCIDR
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err.Error())
+}
+
+// ValidationError is a config validation error with its location in the config, for reporting it in a machine
+// readable form. The documents are counted from 0 and the lines from 1, zero line means the line is not known.
+type ValidationError struct {
+	Document int    `json:"document"`
+	Line     int    `json:"line,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	location := fmt.Sprintf("document %d", e.Document)
+	if e.Line > 0 {
+		location += fmt.Sprintf(", line %d", e.Line)
+	}
+	if e.Field != "" {
+		location += ", " + e.Field
+	}
+	return fmt.Sprintf("%s: %s", location, e.Message)
+}
+
+// ConfigDocument is a ClusterConfig document of a multi-document YAML stream
+type ConfigDocument struct {
+	// Index is the position of the document in the stream, starting from 0
+	Index  int
+	Config *ClusterConfig
+}
+
+// yamlDocument is a document of a YAML stream and the line it starts from
+type yamlDocument struct {
+	index     int
+	firstLine int
+	content   string
+}
+
+var (
+	documentSeparator = regexp.MustCompile(`^---\s*(#.*)?$`)
+	yamlErrorLine     = regexp.MustCompile(`line (\d+): `)
+)
+
+// splitDocuments splits the YAML stream into its documents, the ones only having comments or whitespace are dropped
+func splitDocuments(yml string) []yamlDocument {
+	var docs []yamlDocument
+	var current []string
+	index, firstLine := 0, 1
+	flush := func() {
+		content := strings.Join(current, "\n")
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(content), &v); err != nil || v != nil {
+			docs = append(docs, yamlDocument{index: index, firstLine: firstLine, content: content})
+		}
+	}
+	for i, line := range strings.Split(yml, "\n") {
+		if documentSeparator.MatchString(line) {
+			if i > 0 {
+				flush()
+				index++
+			}
+			current = nil
+			firstLine = i + 2
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return docs
+}
+
+// isClusterConfig tells if the document is a k0s ClusterConfig. The kind and the apiVersion are optional in k0s.yaml,
+// so the documents without them are taken as ClusterConfigs too.
+func (d yamlDocument) isClusterConfig() bool {
+	var meta struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal([]byte(d.content), &meta); err != nil {
+		// let the caller report the error
+		return true
+	}
+	if meta.APIVersion != "" && !strings.HasPrefix(meta.APIVersion, "k0s.k0sproject.io/") {
+		return false
+	}
+	return meta.Kind == "" || meta.Kind == "Cluster" || meta.Kind == "ClusterConfig"
+}
+
+// clusterConfigDocuments returns the ClusterConfig documents of the YAML stream
+func clusterConfigDocuments(yml string) []yamlDocument {
+	var docs []yamlDocument
+	for _, doc := range splitDocuments(yml) {
+		if doc.isClusterConfig() {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// ValidateYAML parses and validates the ClusterConfig documents of the, possibly multi-document, YAML stream. The
+// documents of other kinds are skipped. In strict mode the fields unknown to k0s are errors too. The errors are
+// returned with their locations in the stream, the configs of the documents that could be parsed are returned too.
+func ValidateYAML(yml string, k0sVars constant.CfgVars, strict bool) ([]ConfigDocument, []ValidationError) {
+	var configs []ConfigDocument
+	var errors []ValidationError
+
+	docs := clusterConfigDocuments(yml)
+	for i, doc := range docs {
+		if i > 0 {
+			errors = append(errors, ValidationError{
+				Document: doc.index,
+				Line:     doc.firstLine,
+				Message:  fmt.Sprintf("only one ClusterConfig document is allowed, the first one is document %d", docs[0].index),
+			})
+		}
+
+		config, err := fromYamlDocument(doc.content, k0sVars, strict)
+		if err != nil {
+			errors = append(errors, yamlValidationErrors(doc, err)...)
+			continue
+		}
+		configs = append(configs, ConfigDocument{Index: doc.index, Config: config})
+
+		for _, err := range config.Validate() {
+			e := ValidationError{Document: doc.index, Message: err.Error()}
+			if fieldErr, ok := err.(*FieldError); ok {
+				e.Field = fieldErr.Field
+				e.Message = fieldErr.Err.Error()
+			}
+			errors = append(errors, e)
+		}
+	}
+
+	return configs, errors
+}
+
+// yamlValidationErrors converts the parsing error of the document, the line numbers are made relative to the stream
+func yamlValidationErrors(doc yamlDocument, err error) []ValidationError {
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+
+	errors := make([]ValidationError, 0, len(messages))
+	for _, message := range messages {
+		e := ValidationError{Document: doc.index, Message: message}
+		if m := yamlErrorLine.FindStringSubmatchIndex(message); m != nil {
+			line, _ := strconv.Atoi(message[m[2]:m[3]])
+			e.Line = doc.firstLine + line - 1
+			e.Message = message[:m[0]] + message[m[1]:]
+		}
+		errors = append(errors, e)
+	}
+	return errors
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+const multiDocumentConfig = `# the cluster config is not the first document
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+---
+apiVersion: k0s.k0sproject.io/v1beta1
+kind: Cluster
+spec:
+  network:
+    podCIDR: 10.96.0.0/16
+    serviceCIDR: 10.96.0.0/12
+    provider: calico
+    unknownField: true
+`
+
+func TestValidateYAML(t *testing.T) {
+	k0sVars := constant.GetConfig("")
+
+	t.Run("multi_document", func(t *testing.T) {
+		configs, errors := ValidateYAML(multiDocumentConfig, k0sVars, false)
+		require.Len(t, configs, 1)
+		assert.Equal(t, 1, configs[0].Index)
+		require.Len(t, errors, 1)
+		assert.Equal(t, 1, errors[0].Document)
+		assert.Equal(t, "spec.network.serviceCIDR", errors[0].Field)
+		assert.Contains(t, errors[0].Message, "overlaps with pod CIDR")
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		configs, errors := ValidateYAML(multiDocumentConfig, k0sVars, true)
+		assert.Empty(t, configs)
+		require.Len(t, errors, 1)
+		assert.Equal(t, 1, errors[0].Document)
+		assert.Equal(t, 14, errors[0].Line)
+		assert.Contains(t, errors[0].Message, "field unknownField not found")
+	})
+
+	t.Run("several_cluster_configs", func(t *testing.T) {
+		_, errors := ValidateYAML("kind: Cluster\n---\nkind: Cluster\n", k0sVars, false)
+		require.Len(t, errors, 1)
+		assert.Equal(t, 1, errors[0].Document)
+		assert.Equal(t, 3, errors[0].Line)
+		assert.Contains(t, errors[0].Message, "only one ClusterConfig document is allowed")
+	})
+
+	t.Run("storage_type_consistency", func(t *testing.T) {
+		yml := `
+spec:
+  storage:
+    type: etcd
+    kine:
+      dataSource: mysql://k0s@tcp(db)/k0s
+`
+		_, errors := ValidateYAML(yml, k0sVars, false)
+		require.Len(t, errors, 1)
+		assert.Equal(t, "spec.storage.kine", errors[0].Field)
+		assert.Equal(t, "document 0, spec.storage.kine: kine settings are given but the storage type is etcd", errors[0].Error())
+	})
+}
+
+func TestFromYamlStringMultiDocument(t *testing.T) {
+	k0sVars := constant.GetConfig("")
+
+	c, err := FromYamlString(multiDocumentConfig, k0sVars)
+	require.NoError(t, err)
+	assert.Equal(t, "10.96.0.0/16", c.Spec.Network.PodCIDR)
+
+	_, err = FromYamlString("kind: Cluster\n---\nkind: Cluster\n", k0sVars)
+	assert.Error(t, err)
+}
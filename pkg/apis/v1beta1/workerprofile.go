@@ -16,7 +16,21 @@ limitations under the License.
 package v1beta1
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kubeletv1beta1 "k8s.io/kubelet/config/v1beta1"
+)
+
+const (
+	// KubeletConfigurationAPIVersion is the apiVersion of the kubelet configs rendered for the worker profiles
+	KubeletConfigurationAPIVersion = "kubelet.config.k8s.io/v1beta1"
+	// KubeletConfigurationKind is the kind of the kubelet configs rendered for the worker profiles
+	KubeletConfigurationKind = "KubeletConfiguration"
 )
 
 // WorkerProfiles profiles collection
@@ -37,6 +51,49 @@ func (wps WorkerProfiles) Validate() []error {
 type WorkerProfile struct {
 	Name   string                 `yaml:"name"`
 	Values map[string]interface{} `yaml:"values"`
+	// Hugepages is the number of hugepages per page size, e.g. 2Mi, the workers using the profile are expected to have pre-allocated
+	Hugepages map[string]int64 `yaml:"hugepages,omitempty"`
+	// APIThrottling sets the rate limits of kubelet towards the API server and the image registries
+	APIThrottling *KubeletAPIThrottling `yaml:"apiThrottling,omitempty"`
+	// KubeletConfiguration is a KubeletConfiguration fragment merged over the values, unlike the values it's
+	// validated against the schema of the bundled kubelet
+	KubeletConfiguration map[string]interface{} `yaml:"kubeletConfiguration,omitempty"`
+	// CredentialProviders are the exec plugins kubelet fetches the image pull credentials with
+	CredentialProviders *KubeletCredentialProviders `yaml:"credentialProviders,omitempty"`
+	// GracefulShutdown makes kubelet delay the shutdown of the host to terminate the pods
+	GracefulShutdown *KubeletGracefulShutdown `yaml:"gracefulShutdown,omitempty"`
+}
+
+// KubeletAPIThrottling defines the client side rate limits of kubelet. Zero values keep the kubelet defaults,
+// or with Adaptive the values the worker derives from the size of the node.
+type KubeletAPIThrottling struct {
+	Adaptive        bool  `yaml:"adaptive,omitempty"`
+	KubeAPIQPS      int32 `yaml:"kubeAPIQPS,omitempty"`
+	KubeAPIBurst    int32 `yaml:"kubeAPIBurst,omitempty"`
+	RegistryPullQPS int32 `yaml:"registryPullQPS,omitempty"`
+	RegistryBurst   int32 `yaml:"registryBurst,omitempty"`
+}
+
+// Validate validates the rate limits
+func (t *KubeletAPIThrottling) Validate() error {
+	limits := map[string]int32{
+		"kubeAPIQPS":      t.KubeAPIQPS,
+		"kubeAPIBurst":    t.KubeAPIBurst,
+		"registryPullQPS": t.RegistryPullQPS,
+		"registryBurst":   t.RegistryBurst,
+	}
+	for name, value := range limits {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if t.KubeAPIQPS > 0 && t.KubeAPIBurst > 0 && t.KubeAPIBurst < t.KubeAPIQPS {
+		return fmt.Errorf("kubeAPIBurst must not be smaller than kubeAPIQPS")
+	}
+	if t.RegistryPullQPS > 0 && t.RegistryBurst > 0 && t.RegistryBurst < t.RegistryPullQPS {
+		return fmt.Errorf("registryBurst must not be smaller than registryPullQPS")
+	}
+	return nil
 }
 
 var lockedFields = map[string]struct{}{
@@ -53,5 +110,196 @@ func (wp *WorkerProfile) Validate() error {
 			return fmt.Errorf("field `%s` is prohibited to override in worker profile", field)
 		}
 	}
+	if wp.KubeletConfiguration != nil {
+		if err := wp.validateKubeletConfiguration(); err != nil {
+			return fmt.Errorf("worker profile %s: invalid kubeletConfiguration: %v", wp.Name, err)
+		}
+	}
+	for size, count := range wp.Hugepages {
+		if !hugepageSizeRe.MatchString(size) {
+			return fmt.Errorf("worker profile %s: invalid hugepage size %q, must be like 2Mi or 1Gi", wp.Name, size)
+		}
+		if count < 0 {
+			return fmt.Errorf("worker profile %s: hugepage count for %s must not be negative", wp.Name, size)
+		}
+	}
+	if wp.APIThrottling != nil {
+		if err := wp.APIThrottling.Validate(); err != nil {
+			return fmt.Errorf("worker profile %s: invalid apiThrottling: %v", wp.Name, err)
+		}
+	}
+	if wp.CredentialProviders != nil {
+		if err := wp.CredentialProviders.Validate(); err != nil {
+			return fmt.Errorf("worker profile %s: invalid credentialProviders: %v", wp.Name, err)
+		}
+	}
+	if wp.GracefulShutdown != nil {
+		if err := wp.GracefulShutdown.Validate(); err != nil {
+			return fmt.Errorf("worker profile %s: invalid gracefulShutdown: %v", wp.Name, err)
+		}
+	}
+	return wp.validateResourceManagers()
+}
+
+// validateKubeletConfiguration validates the fragment, apiVersion and kind may be given but can't be changed
+func (wp *WorkerProfile) validateKubeletConfiguration() error {
+	for field := range wp.KubeletConfiguration {
+		if _, found := lockedFields[field]; found && field != "apiVersion" && field != "kind" {
+			return fmt.Errorf("field `%s` is prohibited to override in worker profile", field)
+		}
+	}
+	if v, found := wp.KubeletConfiguration["apiVersion"]; found && v != KubeletConfigurationAPIVersion {
+		return fmt.Errorf("apiVersion must be %s, got %v", KubeletConfigurationAPIVersion, v)
+	}
+	if v, found := wp.KubeletConfiguration["kind"]; found && v != KubeletConfigurationKind {
+		return fmt.Errorf("kind must be %s, got %v", KubeletConfigurationKind, v)
+	}
+	return ValidateKubeletConfiguration(wp.KubeletConfiguration)
+}
+
+// KubeletConfigurationValues returns the fields of the KubeletConfiguration fragment to merge into the kubelet config
+func (wp *WorkerProfile) KubeletConfigurationValues() map[string]interface{} {
+	values := make(map[string]interface{}, len(wp.KubeletConfiguration))
+	for field, value := range wp.KubeletConfiguration {
+		if field != "apiVersion" && field != "kind" {
+			values[field] = value
+		}
+	}
+	return values
+}
+
+// ValidateKubeletConfiguration validates a KubeletConfiguration fragment against the schema of the bundled kubelet,
+// the unknown fields and the values of the wrong type are rejected
+func ValidateKubeletConfiguration(fragment map[string]interface{}) error {
+	data, err := json.Marshal(jsonValue(fragment))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var config kubeletv1beta1.KubeletConfiguration
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// jsonValue converts the maps of the yaml decoder, keyed with interface{}, into maps the json encoder accepts
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			result[fmt.Sprintf("%v", key)] = jsonValue(value)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			result[key] = jsonValue(value)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = jsonValue(value)
+		}
+		return result
+	}
+	return v
+}
+
+var hugepageSizeRe = regexp.MustCompile(`^[1-9][0-9]*(Ki|Mi|Gi)$`)
+
+var cpuManagerPolicies = []string{"none", "static"}
+var topologyManagerPolicies = []string{"none", "best-effort", "restricted", "single-numa-node"}
+
+// validateResourceManagers validates the cpu and topology manager settings of the profile
+func (wp *WorkerProfile) validateResourceManagers() error {
+	cpuPolicy, err := wp.enumValue("cpuManagerPolicy", cpuManagerPolicies)
+	if err != nil {
+		return err
+	}
+	if _, err := wp.enumValue("topologyManagerPolicy", topologyManagerPolicies); err != nil {
+		return err
+	}
+
+	var reservedCPUs string
+	if v, found := wp.value("reservedSystemCPUs"); found {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("worker profile %s: reservedSystemCPUs must be a string", wp.Name)
+		}
+		if err := validateCPUSet(s); err != nil {
+			return fmt.Errorf("worker profile %s: invalid reservedSystemCPUs: %v", wp.Name, err)
+		}
+		reservedCPUs = s
+	}
+
+	// the static policy refuses to start without a cpu reservation for the system
+	if cpuPolicy == "static" && reservedCPUs == "" && !wp.reservesCPU("kubeReserved") && !wp.reservesCPU("systemReserved") {
+		return fmt.Errorf("worker profile %s: cpuManagerPolicy static requires reservedSystemCPUs or a cpu reservation in kubeReserved or systemReserved", wp.Name)
+	}
+	return nil
+}
+
+// value returns the field of the rendered kubelet config, the KubeletConfiguration fragment overrides the values
+func (wp *WorkerProfile) value(field string) (interface{}, bool) {
+	if v, found := wp.KubeletConfiguration[field]; found {
+		return v, true
+	}
+	v, found := wp.Values[field]
+	return v, found
+}
+
+func (wp *WorkerProfile) enumValue(field string, allowed []string) (string, error) {
+	v, found := wp.value(field)
+	if !found {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if ok {
+		for _, a := range allowed {
+			if s == a {
+				return s, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("worker profile %s: %s must be one of %s", wp.Name, field, strings.Join(allowed, ", "))
+}
+
+// reservesCPU tells if the given reservation field, e.g. kubeReserved, has a cpu reservation
+func (wp *WorkerProfile) reservesCPU(field string) bool {
+	reserved, _ := wp.value(field)
+	switch reserved := reserved.(type) {
+	case map[string]interface{}:
+		return reserved["cpu"] != nil
+	case map[interface{}]interface{}:
+		return reserved["cpu"] != nil
+	}
+	return false
+}
+
+// validateCPUSet validates a linux cpuset list, e.g. "0-1,4"
+func validateCPUSet(cpus string) error {
+	if strings.TrimSpace(cpus) == "" {
+		return fmt.Errorf("empty cpu list")
+	}
+	for _, r := range strings.Split(cpus, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(r), "-", 2)
+		start, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid cpu %q", bounds[0])
+		}
+		if len(bounds) == 2 {
+			end, err := strconv.ParseUint(bounds[1], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid cpu %q", bounds[1])
+			}
+			if end < start {
+				return fmt.Errorf("invalid cpu range %q", r)
+			}
+		}
+	}
 	return nil
 }
@@ -62,6 +62,53 @@ func TestWorkerProfile(t *testing.T) {
 				},
 				valid: false,
 			},
+			{
+				name: "Static cpu manager with reserved cpus",
+				spec: map[string]interface{}{
+					"cpuManagerPolicy":      "static",
+					"topologyManagerPolicy": "single-numa-node",
+					"reservedSystemCPUs":    "0-1,4",
+				},
+				valid: true,
+			},
+			{
+				name: "Static cpu manager with kubeReserved cpu",
+				spec: map[string]interface{}{
+					"cpuManagerPolicy": "static",
+					"kubeReserved": map[interface{}]interface{}{
+						"cpu": "500m",
+					},
+				},
+				valid: true,
+			},
+			{
+				name: "Static cpu manager without cpu reservation",
+				spec: map[string]interface{}{
+					"cpuManagerPolicy": "static",
+				},
+				valid: false,
+			},
+			{
+				name: "Unknown cpu manager policy",
+				spec: map[string]interface{}{
+					"cpuManagerPolicy": "dynamic",
+				},
+				valid: false,
+			},
+			{
+				name: "Unknown topology manager policy",
+				spec: map[string]interface{}{
+					"topologyManagerPolicy": "numa",
+				},
+				valid: false,
+			},
+			{
+				name: "Invalid reservedSystemCPUs",
+				spec: map[string]interface{}{
+					"reservedSystemCPUs": "3-1",
+				},
+				valid: false,
+			},
 		}
 
 		for _, tc := range cases {
@@ -74,4 +121,142 @@ func TestWorkerProfile(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("worker_profile_hugepages_validation", func(t *testing.T) {
+		cases := []struct {
+			name      string
+			hugepages map[string]int64
+			valid     bool
+		}{
+			{
+				name:      "Valid hugepages",
+				hugepages: map[string]int64{"2Mi": 1024, "1Gi": 4},
+				valid:     true,
+			},
+			{
+				name:      "Invalid page size",
+				hugepages: map[string]int64{"2M": 1024},
+				valid:     false,
+			},
+			{
+				name:      "Negative count",
+				hugepages: map[string]int64{"2Mi": -1},
+				valid:     false,
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				profile := WorkerProfile{
+					Hugepages: tc.hugepages,
+				}
+				valid := profile.Validate() == nil
+				assert.Equal(t, valid, tc.valid)
+			})
+		}
+	})
+	t.Run("worker_profile_api_throttling_validation", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			throttling KubeletAPIThrottling
+			valid      bool
+		}{
+			{
+				name:       "Adaptive",
+				throttling: KubeletAPIThrottling{Adaptive: true},
+				valid:      true,
+			},
+			{
+				name:       "Explicit limits",
+				throttling: KubeletAPIThrottling{KubeAPIQPS: 20, KubeAPIBurst: 40, RegistryPullQPS: 10},
+				valid:      true,
+			},
+			{
+				name:       "Negative qps",
+				throttling: KubeletAPIThrottling{KubeAPIQPS: -1},
+				valid:      false,
+			},
+			{
+				name:       "Burst below qps",
+				throttling: KubeletAPIThrottling{RegistryPullQPS: 10, RegistryBurst: 5},
+				valid:      false,
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				throttling := tc.throttling
+				profile := WorkerProfile{
+					APIThrottling: &throttling,
+				}
+				valid := profile.Validate() == nil
+				assert.Equal(t, valid, tc.valid)
+			})
+		}
+	})
+	t.Run("worker_profile_kubelet_configuration_validation", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			fragment map[string]interface{}
+			valid    bool
+		}{
+			{
+				name: "Complete fragment",
+				fragment: map[string]interface{}{
+					"apiVersion":            "kubelet.config.k8s.io/v1beta1",
+					"kind":                  "KubeletConfiguration",
+					"topologyManagerPolicy": "single-numa-node",
+					"shutdownGracePeriod":   "30s",
+					"evictionHard": map[interface{}]interface{}{
+						"memory.available": "200Mi",
+					},
+				},
+				valid: true,
+			},
+			{
+				name:     "Unknown field",
+				fragment: map[string]interface{}{"topologyManagerPolcy": "single-numa-node"},
+				valid:    false,
+			},
+			{
+				name:     "Wrong type",
+				fragment: map[string]interface{}{"maxPods": "many"},
+				valid:    false,
+			},
+			{
+				name:     "Invalid duration",
+				fragment: map[string]interface{}{"shutdownGracePeriod": "sometimes"},
+				valid:    false,
+			},
+			{
+				name:     "Other apiVersion",
+				fragment: map[string]interface{}{"apiVersion": "kubelet.config.k8s.io/v1alpha1"},
+				valid:    false,
+			},
+			{
+				name:     "Locked field",
+				fragment: map[string]interface{}{"clusterDomain": "cluster.org"},
+				valid:    false,
+			},
+			{
+				name: "Overrides the values",
+				fragment: map[string]interface{}{
+					"cpuManagerPolicy":   "static",
+					"reservedSystemCPUs": "0",
+				},
+				valid: true,
+			},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				profile := WorkerProfile{
+					Values:               map[string]interface{}{"cpuManagerPolicy": "none"},
+					KubeletConfiguration: tc.fragment,
+				}
+				valid := profile.Validate() == nil
+				assert.Equal(t, valid, tc.valid)
+			})
+		}
+	})
 }
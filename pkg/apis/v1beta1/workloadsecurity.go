@@ -0,0 +1,34 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// WorkloadSecurity defines the security profiles k0s sets on the system workloads it renders, i.e. CoreDNS,
+// metrics-server, kube-proxy, konnectivity-agent and calico-kube-controllers
+type WorkloadSecurity struct {
+	// Seccomp sets the RuntimeDefault seccomp profile on the pods
+	Seccomp bool `yaml:"seccomp"`
+	// AppArmor sets the runtime/default AppArmor profile on the containers
+	AppArmor bool `yaml:"appArmor"`
+}
+
+// DefaultWorkloadSecurity default settings
+func DefaultWorkloadSecurity() *WorkloadSecurity {
+	return &WorkloadSecurity{
+		Seccomp:  false,
+		AppArmor: false,
+	}
+}
@@ -22,20 +22,26 @@ import (
 	"path"
 	"path/filepath"
 
-	"k8s.io/client-go/util/retry"
-
+	"github.com/k0sproject/k0s/internal/retry"
+	"github.com/k0sproject/k0s/internal/util"
 	"github.com/k0sproject/k0s/pkg/kubernetes"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/cli-runtime/pkg/kustomize"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/kustomize/pkg/constants"
+	"sigs.k8s.io/kustomize/pkg/fs"
 )
 
 // Applier manages all the "static" manifests and applies them on the k8s API
 type Applier struct {
 	Name string
 	Dir  string
+	// Config is the config of the stack as of the last apply
+	Config StackConfig
 
 	log             *logrus.Entry
 	clientFactory   kubernetes.ClientFactory
@@ -78,21 +84,32 @@ func (a *Applier) init() error {
 // Apply resources
 func (a *Applier) Apply() error {
 	if a.client == nil {
-		err := retry.OnError(retry.DefaultBackoff, func(err error) bool {
-			return true
-		}, a.init)
+		err := retry.Do(context.Background(), "init applier "+a.Name, a.init)
 
 		if err != nil {
 			return err
 		}
 	}
-	files, err := filepath.Glob(path.Join(a.Dir, "*.yaml"))
+	resources, err := a.apply()
+	a.reportStatus(resources, err)
+	return err
+}
+
+func (a *Applier) apply() ([]*unstructured.Unstructured, error) {
+	config, err := LoadStackConfig(a.Dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	resources, err := a.parseFiles(files)
+	a.Config = config
+	if err := checkDependencyGraph(a.Dir, config); err != nil {
+		return nil, err
+	}
+	if err := a.checkDependencies(config.DependsOn); err != nil {
+		return nil, err
+	}
+	resources, err := a.resources()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	stack := Stack{
 		Name:      a.Name,
@@ -101,7 +118,10 @@ func (a *Applier) Apply() error {
 		Discovery: a.discoveryClient,
 	}
 	a.log.Debug("applying stack")
-	err = stack.Apply(context.Background(), true)
+	if !config.PruneEnabled() {
+		a.log.Debug("pruning is disabled for the stack")
+	}
+	err = stack.Apply(context.Background(), config.PruneEnabled())
 	if err != nil {
 		a.log.WithError(err).Warn("stack apply failed")
 		a.discoveryClient.Invalidate()
@@ -109,11 +129,16 @@ func (a *Applier) Apply() error {
 		a.log.Debug("successfully applied stack")
 	}
 
-	return err
+	return resources, err
 }
 
-// Delete deletes the entire stack by applying it with empty set of resources
+// Delete deletes the entire stack by applying it with empty set of resources. Nothing is deleted if pruning is
+// disabled for the stack.
 func (a *Applier) Delete() error {
+	if !a.Config.PruneEnabled() {
+		a.log.Info("pruning is disabled for the stack, leaving its resources in place")
+		return nil
+	}
 	stack := Stack{
 		Name:      a.Name,
 		Resources: []*unstructured.Unstructured{},
@@ -122,9 +147,57 @@ func (a *Applier) Delete() error {
 	}
 	logrus.Debugf("about to delete a stack %s with empty apply", a.Name)
 	err := stack.Apply(context.Background(), true)
+	if err == nil {
+		a.deleteStatus()
+	}
 	return err
 }
 
+// resources returns the resources of the stack, built with kustomize if the stack has a kustomization, otherwise
+// parsed from all of its manifest files
+func (a *Applier) resources() ([]*unstructured.Unstructured, error) {
+	kustomization := a.kustomization()
+	if kustomization == "" {
+		files, err := a.manifestFiles()
+		if err != nil {
+			return nil, err
+		}
+		return a.parseFiles(files)
+	}
+
+	a.log.Debugf("building the stack with kustomize from %s", kustomization)
+	var out bytes.Buffer
+	if err := kustomize.RunKustomizeBuild(&out, fs.MakeRealFS(), a.Dir); err != nil {
+		return nil, errors.Wrapf(err, "failed to build %s", kustomization)
+	}
+	return parseManifests(out.Bytes()), nil
+}
+
+// kustomization returns the path of the kustomization of the stack, empty if it has none
+func (a *Applier) kustomization() string {
+	for _, name := range constants.KustomizationFileNames {
+		if p := filepath.Join(a.Dir, name); util.FileExists(p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// manifestFiles returns the manifest files of the stack
+func (a *Applier) manifestFiles() ([]string, error) {
+	files, err := filepath.Glob(path.Join(a.Dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	manifests := []string{}
+	for _, file := range files {
+		if filepath.Base(file) != StackConfigFile {
+			manifests = append(manifests, file)
+		}
+	}
+	return manifests, nil
+}
+
 func (a *Applier) parseFiles(files []string) ([]*unstructured.Unstructured, error) {
 	resources := []*unstructured.Unstructured{}
 	for _, file := range files {
@@ -133,19 +206,25 @@ func (a *Applier) parseFiles(files []string) ([]*unstructured.Unstructured, erro
 		if err != nil {
 			return nil, err
 		}
-
-		decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(source), 4096)
-		var resource map[string]interface{}
-		for decoder.Decode(&resource) == nil {
-			item := &unstructured.Unstructured{
-				Object: resource,
-			}
-			if item.GetAPIVersion() != "" && item.GetKind() != "" {
-				resources = append(resources, item)
-				resource = nil
-			}
-		}
+		resources = append(resources, parseManifests(source)...)
 	}
 
 	return resources, nil
 }
+
+// parseManifests parses the resources of a multi-document YAML or JSON source
+func parseManifests(source []byte) []*unstructured.Unstructured {
+	resources := []*unstructured.Unstructured{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(source), 4096)
+	var resource map[string]interface{}
+	for decoder.Decode(&resource) == nil {
+		item := &unstructured.Unstructured{
+			Object: resource,
+		}
+		if item.GetAPIVersion() != "" && item.GetKind() != "" {
+			resources = append(resources, item)
+			resource = nil
+		}
+	}
+	return resources
+}
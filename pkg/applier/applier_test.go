@@ -17,14 +17,22 @@ package applier
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubetesting "k8s.io/client-go/testing"
 
 	kubeutil "github.com/k0sproject/k0s/internal/testutil"
 )
@@ -87,3 +95,322 @@ spec:
 	assert.Equal(t, "Pod", r.GetKind())
 	assert.Equal(t, "applier", r.GetLabels()["component"])
 }
+
+func TestApplierPrunesRemovedManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	template := `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: %s
+  namespace: kube-system
+data:
+  foo: bar
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte(fmt.Sprintf(template, "applier-a")), 0400))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.yaml"), []byte(fmt.Sprintf(template, "applier-b")), 0400))
+
+	fakes := kubeutil.NewFakeClientFactory()
+	fakes.RawDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: corev1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Namespaced: false, Kind: "Namespace", Verbs: []string{"get", "list", "delete"}},
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap", Verbs: []string{"get", "list", "delete"}},
+			},
+		},
+	}
+	a := NewApplier(dir, fakes)
+	assert.NoError(t, a.Apply())
+	gv, _ := schema.ParseResourceArg("configmaps.v1.")
+	configMaps := func() []string {
+		list, err := a.client.Resource(*gv).Namespace("kube-system").List(context.Background(), metav1.ListOptions{})
+		assert.NoError(t, err)
+		names := []string{}
+		for _, item := range list.Items {
+			names = append(names, item.GetName())
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"applier-a", "applier-b"}, configMaps())
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "b.yaml")))
+	assert.NoError(t, a.Apply())
+	assert.Equal(t, []string{"applier-a"}, configMaps())
+
+	// pruning disabled for the stack
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, StackConfigFile), []byte("prune: false\n"), 0400))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "a.yaml")))
+	assert.NoError(t, a.Apply())
+	assert.Equal(t, []string{"applier-a"}, configMaps())
+	assert.NoError(t, a.Delete())
+	assert.Equal(t, []string{"applier-a"}, configMaps())
+}
+
+func TestApplierAppliesServerSide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	template := `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: applier-test
+  namespace: kube-system
+data:
+  foo: %s
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test.yaml"), []byte(fmt.Sprintf(template, "bar")), 0600))
+
+	fakes := kubeutil.NewFakeClientFactory()
+	fakes.RawDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: corev1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"},
+			},
+		},
+	}
+	a := NewApplier(dir, fakes)
+	assert.NoError(t, a.Apply())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test.yaml"), []byte(fmt.Sprintf(template, "baz")), 0600))
+	assert.NoError(t, a.Apply())
+
+	gv, _ := schema.ParseResourceArg("configmaps.v1.")
+	r, err := a.client.Resource(*gv).Namespace("kube-system").Get(context.Background(), "applier-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	foo, _, _ := unstructured.NestedString(r.Object, "data", "foo")
+	assert.Equal(t, "baz", foo)
+
+	patches := 0
+	for _, action := range fakes.DynamicClient.(*dynamicfake.FakeDynamicClient).Actions() {
+		if patch, ok := action.(kubetesting.PatchAction); ok {
+			assert.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+			patches++
+		}
+		assert.NotEqual(t, "create", action.GetVerb())
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+	assert.Equal(t, 2, patches)
+}
+
+func TestApplierBuildsKustomization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configMap := `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: applier-test
+  namespace: kube-system
+data:
+  foo: bar
+`
+	patch := `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: applier-test
+  namespace: kube-system
+data:
+  foo: patched
+`
+	kustomization := `
+resources:
+- configmap.yaml
+patchesStrategicMerge:
+- patch.yaml
+commonLabels:
+  component: kustomized
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "configmap.yaml"), []byte(configMap), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "patch.yaml"), []byte(patch), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(kustomization), 0600))
+
+	fakes := kubeutil.NewFakeClientFactory()
+	fakes.RawDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: corev1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"},
+			},
+		},
+	}
+	a := NewApplier(dir, fakes)
+	assert.NoError(t, a.Apply())
+
+	gv, _ := schema.ParseResourceArg("configmaps.v1.")
+	r, err := a.client.Resource(*gv).Namespace("kube-system").Get(context.Background(), "applier-test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "kustomized", r.GetLabels()["component"])
+	foo, _, _ := unstructured.NestedString(r.Object, "data", "foo")
+	assert.Equal(t, "patched", foo)
+
+	// an invalid kustomization fails the apply instead of applying the plain manifests
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources:\n- missing.yaml\n"), 0600))
+	assert.Error(t, a.Apply())
+}
+
+func TestApplierReportsStackStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stackDir := filepath.Join(dir, "My_Stack")
+	assert.NoError(t, os.Mkdir(stackDir, 0700))
+	configMap := `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: applier-test
+  namespace: kube-system
+data:
+  foo: bar
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(stackDir, "configmap.yaml"), []byte(configMap), 0600))
+
+	fakes := kubeutil.NewFakeClientFactory()
+	fakes.RawDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: corev1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"},
+			},
+		},
+	}
+	a := NewApplier(stackDir, fakes)
+	assert.NoError(t, a.Apply())
+
+	getStatus := func() map[string]interface{} {
+		// the stack name made a valid object name
+		r, err := a.client.Resource(stackStatusResource).Get(context.Background(), "my-stack", metav1.GetOptions{})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		status, _, _ := unstructured.NestedMap(r.Object, "status")
+		return status
+	}
+	status := getStatus()
+	assert.Equal(t, "My_Stack", status["stack"])
+	assert.EqualValues(t, 1, status["resourceCount"])
+	assert.NotEmpty(t, status["lastSuccessfulApplyTime"])
+	assert.Nil(t, status["error"])
+	lastSuccess := status["lastSuccessfulApplyTime"]
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(stackDir, "kustomization.yaml"), []byte("resources:\n- missing.yaml\n"), 0600))
+	assert.Error(t, a.Apply())
+	status = getStatus()
+	assert.Contains(t, status["error"], "kustomization.yaml")
+	assert.Equal(t, lastSuccess, status["lastSuccessfulApplyTime"])
+	assert.EqualValues(t, 1, status["resourceCount"], "the resources of the last successful apply are kept")
+
+	assert.NoError(t, a.Delete())
+	_, err = a.client.Resource(stackStatusResource).Get(context.Background(), "my-stack", metav1.GetOptions{})
+	assert.True(t, apiErrors.IsNotFound(err))
+}
+
+func TestApplierWaitsForDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	crdDir, crDir := filepath.Join(dir, "crds"), filepath.Join(dir, "crs")
+	assert.NoError(t, os.Mkdir(crdDir, 0700))
+	assert.NoError(t, os.Mkdir(crDir, 0700))
+	configMap := `
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: %s
+  namespace: kube-system
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(crdDir, "crds.yaml"), []byte(fmt.Sprintf(configMap, "crds")), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(crDir, "crs.yaml"), []byte(fmt.Sprintf(configMap, "crs")), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(crDir, StackConfigFile), []byte("dependsOn:\n- crds\n"), 0600))
+
+	fakes := kubeutil.NewFakeClientFactory()
+	fakes.RawDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: corev1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"},
+			},
+		},
+	}
+	crs := NewApplier(crDir, fakes)
+	err = crs.Apply()
+	var pending *DependencyPendingError
+	if assert.True(t, errors.As(err, &pending)) {
+		assert.Equal(t, "crds", pending.Stack)
+	}
+	gv, _ := schema.ParseResourceArg("configmaps.v1.")
+	_, err = crs.client.Resource(*gv).Namespace("kube-system").Get(context.Background(), "crs", metav1.GetOptions{})
+	assert.True(t, apiErrors.IsNotFound(err))
+
+	assert.NoError(t, NewApplier(crdDir, fakes).Apply())
+	assert.NoError(t, crs.Apply())
+	_, err = crs.client.Resource(*gv).Namespace("kube-system").Get(context.Background(), "crs", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestApplierReportsInvalidDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for stack, config := range map[string]string{
+		"a": "dependsOn:\n- b\n",
+		"b": "dependsOn:\n- c\n- a\n",
+		"c": "",
+		"d": "dependsOn:\n- c\n- missing\n",
+	} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, stack), 0700))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, stack, StackConfigFile), []byte(config), 0600))
+	}
+
+	fakes := kubeutil.NewFakeClientFactory()
+	for stack, expected := range map[string]string{
+		"a": "dependency cycle a -> b -> a",
+		"b": "dependency cycle b -> a -> b",
+		"d": "stack d depends on unknown stack missing",
+	} {
+		a := NewApplier(filepath.Join(dir, stack), fakes)
+		err := a.Apply()
+		var invalid *InvalidDependencyError
+		assert.True(t, errors.As(err, &invalid), stack)
+		assert.EqualError(t, err, expected)
+
+		r, err := a.client.Resource(stackStatusResource).Get(context.Background(), stack, metav1.GetOptions{})
+		if assert.NoError(t, err) {
+			status, _, _ := unstructured.NestedString(r.Object, "status", "error")
+			assert.Equal(t, expected, status)
+		}
+	}
+}
+
+func TestLoadStackConfigRejectsSelfDependency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "applier-test-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, StackConfigFile), []byte(fmt.Sprintf("dependsOn:\n- %s\n", filepath.Base(dir))), 0600))
+	_, err = LoadStackConfig(dir)
+	assert.Error(t, err)
+}
+
+func TestSortResources(t *testing.T) {
+	resource := func(apiVersion, kind, namespace string) *unstructured.Unstructured {
+		r := &unstructured.Unstructured{}
+		r.SetAPIVersion(apiVersion)
+		r.SetKind(kind)
+		r.SetNamespace(namespace)
+		return r
+	}
+	cr := resource("example.com/v1", "Widget", "apps")
+	deployment := resource("apps/v1", "Deployment", "apps")
+	clusterRole := resource("rbac.authorization.k8s.io/v1", "ClusterRole", "")
+	namespace := resource("v1", "Namespace", "")
+	crd := resource("apiextensions.k8s.io/v1", "CustomResourceDefinition", "")
+
+	sorted := sortResources([]*unstructured.Unstructured{cr, deployment, clusterRole, namespace, crd})
+	assert.Equal(t, []*unstructured.Unstructured{crd, namespace, clusterRole, cr, deployment}, sorted)
+}
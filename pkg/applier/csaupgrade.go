@@ -0,0 +1,134 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package applier
+
+import (
+	"encoding/json"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// legacyFieldManager is the field manager of the resources created and updated client-side by the k0s versions
+// before the server-side apply, i.e. the default one of the k0s client-go user agent
+const legacyFieldManager = "k0s"
+
+// csaUpgradePatch returns a JSON patch handing the fields managed client-side by older k0s versions over to the
+// server-side apply field manager, like kubectl does with csaupgrade, and removing the deprecated last applied
+// configuration annotation. Without it the fields removed from the manifests are never pruned, they are still owned
+// by the client-side manager. Nil if there is nothing to upgrade.
+func csaUpgradePatch(resource *unstructured.Unstructured) ([]byte, error) {
+	_, hasAnnotation := resource.GetAnnotations()[LastConfigAnnotation]
+	var (
+		managedFields []metav1.ManagedFieldsEntry
+		legacy        []metav1.ManagedFieldsEntry
+		apply         = -1
+	)
+	for _, entry := range resource.GetManagedFields() {
+		switch {
+		case entry.Manager == legacyFieldManager && entry.Operation == metav1.ManagedFieldsOperationUpdate:
+			legacy = append(legacy, entry)
+		case entry.Manager == FieldManager && entry.Operation == metav1.ManagedFieldsOperationApply:
+			apply = len(managedFields)
+			managedFields = append(managedFields, entry)
+		default:
+			managedFields = append(managedFields, entry)
+		}
+	}
+	if len(legacy) == 0 && !hasAnnotation {
+		return nil, nil
+	}
+
+	if len(legacy) > 0 {
+		if apply < 0 {
+			entry := legacy[0]
+			entry.Manager = FieldManager
+			entry.Operation = metav1.ManagedFieldsOperationApply
+			entry.FieldsV1 = nil
+			apply = len(managedFields)
+			managedFields = append(managedFields, entry)
+		}
+		fields := map[string]interface{}{}
+		for _, entry := range append([]metav1.ManagedFieldsEntry{managedFields[apply]}, legacy...) {
+			if err := mergeFields(fields, entry.FieldsV1); err != nil {
+				return nil, err
+			}
+		}
+		// the annotation is removed by the patch, the server-side apply mustn't own it
+		deleteField(fields, "f:metadata", "f:annotations", "f:"+LastConfigAnnotation)
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		managedFields[apply].FieldsV1 = &metav1.FieldsV1{Raw: raw}
+	}
+
+	var ops []map[string]interface{}
+	if resourceVersion := resource.GetResourceVersion(); resourceVersion != "" {
+		ops = append(ops, map[string]interface{}{"op": "test", "path": "/metadata/resourceVersion", "value": resourceVersion})
+	}
+	// the managed fields are replaced also when only the annotation is removed, the server doesn't then attribute the
+	// change to any field manager
+	if len(managedFields) > 0 {
+		ops = append(ops, map[string]interface{}{"op": "replace", "path": "/metadata/managedFields", "value": managedFields})
+	}
+	if hasAnnotation {
+		ops = append(ops, map[string]interface{}{"op": "remove", "path": "/metadata/annotations/" + escapeJSONPointer(LastConfigAnnotation)})
+	}
+	return json.Marshal(ops)
+}
+
+// mergeFields adds the fields of the FieldsV1 trie to fields
+func mergeFields(fields map[string]interface{}, fieldsV1 *metav1.FieldsV1) error {
+	if fieldsV1 == nil || len(fieldsV1.Raw) == 0 {
+		return nil
+	}
+	var other map[string]interface{}
+	if err := json.Unmarshal(fieldsV1.Raw, &other); err != nil {
+		return err
+	}
+	mergeTries(fields, other)
+	return nil
+}
+
+func mergeTries(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		srcChild, ok := value.(map[string]interface{})
+		dstChild, exists := dst[key].(map[string]interface{})
+		if ok && exists {
+			mergeTries(dstChild, srcChild)
+		} else if !exists {
+			dst[key] = value
+		}
+	}
+}
+
+// deleteField removes the field at the path from the FieldsV1 trie
+func deleteField(fields map[string]interface{}, path ...string) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := fields[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields = child
+	}
+	delete(fields, path[len(path)-1])
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
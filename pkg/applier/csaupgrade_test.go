@@ -0,0 +1,95 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package applier
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCSAUpgradePatch(t *testing.T) {
+	resource := &unstructured.Unstructured{}
+	resource.SetResourceVersion("42")
+	assert.Nil(t, mustCSAUpgradePatch(t, resource))
+
+	resource.SetAnnotations(map[string]string{LastConfigAnnotation: "{}", ChecksumAnnotation: "abc"})
+	resource.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:    legacyFieldManager,
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: "apps/v1",
+		FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:annotations":{".":{},"f:` + LastConfigAnnotation +
+			`":{},"f:` + ChecksumAnnotation + `":{}}},"f:spec":{"f:replicas":{}}}`)},
+	}, {
+		Manager:    "kube-controller-manager",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: "apps/v1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:status":{}}`)},
+	}})
+
+	var ops []struct {
+		Op    string
+		Path  string
+		Value json.RawMessage
+	}
+	require.NoError(t, json.Unmarshal(mustCSAUpgradePatch(t, resource), &ops))
+	require.Len(t, ops, 3)
+	assert.Equal(t, "test", ops[0].Op)
+	assert.JSONEq(t, `"42"`, string(ops[0].Value))
+	assert.Equal(t, "remove", ops[2].Op)
+	assert.Equal(t, "/metadata/annotations/k0s.k0sproject.io~1last-applied-configuration", ops[2].Path)
+
+	assert.Equal(t, "replace", ops[1].Op)
+	var managedFields []metav1.ManagedFieldsEntry
+	require.NoError(t, json.Unmarshal(ops[1].Value, &managedFields))
+	require.Len(t, managedFields, 2)
+	assert.Equal(t, "kube-controller-manager", managedFields[0].Manager)
+	assert.Equal(t, FieldManager, managedFields[1].Manager)
+	assert.Equal(t, metav1.ManagedFieldsOperationApply, managedFields[1].Operation)
+	assert.JSONEq(t, `{"f:metadata":{"f:annotations":{".":{},"f:`+ChecksumAnnotation+`":{}}},"f:spec":{"f:replicas":{}}}`,
+		string(managedFields[1].FieldsV1.Raw))
+
+	// the fields are added to an existing server-side apply entry
+	resource.SetAnnotations(nil)
+	resource.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:   FieldManager,
+		Operation: metav1.ManagedFieldsOperationApply,
+		FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:template":{}}}`)},
+	}, {
+		Manager:   legacyFieldManager,
+		Operation: metav1.ManagedFieldsOperationUpdate,
+		FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)},
+	}})
+	require.NoError(t, json.Unmarshal(mustCSAUpgradePatch(t, resource), &ops))
+	require.Len(t, ops, 2)
+	require.NoError(t, json.Unmarshal(ops[1].Value, &managedFields))
+	require.Len(t, managedFields, 1)
+	assert.JSONEq(t, `{"f:spec":{"f:template":{},"f:replicas":{}}}`, string(managedFields[0].FieldsV1.Raw))
+
+	// upgraded already
+	resource.SetManagedFields(managedFields)
+	assert.Nil(t, mustCSAUpgradePatch(t, resource))
+}
+
+func mustCSAUpgradePatch(t *testing.T, resource *unstructured.Unstructured) []byte {
+	patch, err := csaUpgradePatch(resource)
+	require.NoError(t, err)
+	return patch
+}
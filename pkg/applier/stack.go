@@ -22,7 +22,6 @@ import (
 	"fmt"
 	"sync"
 
-	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
@@ -46,7 +45,13 @@ const (
 	ChecksumAnnotation = "k0s.k0sproject.io/stack-checksum"
 
 	// LastConfigAnnotation defines the annotation to be used for last applied configs
+	//
+	// Deprecated: the resources are applied server-side, the annotation is only found on resources applied by older
+	// k0s versions and it's removed from them when they are first applied server-side
 	LastConfigAnnotation = "k0s.k0sproject.io/last-applied-configuration"
+
+	// FieldManager is the field manager the stacks are applied server-side with
+	FieldManager = "k0s-applier"
 )
 
 // Stack is a k8s resource bundle
@@ -58,63 +63,47 @@ type Stack struct {
 	Discovery     discovery.CachedDiscoveryInterface
 }
 
-// Apply applies stack resources by creating or updating the resources. If prune is requested,
-// the previously applied stack resources which are not part of the current stack are removed from k8s api
+// Apply applies stack resources server-side, so the fields set by other controllers and not in the stack manifests
+// are left as they are. If prune is requested, the previously applied stack resources which are not part of the
+// current stack are removed from k8s api
 func (s *Stack) Apply(ctx context.Context, prune bool) error {
 	log := logrus.WithField("stack", s.Name)
 
 	log.Debugf("applying with %d resources", len(s.Resources))
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(s.Discovery)
-	sortedResources := []*unstructured.Unstructured{}
-	for _, resource := range s.Resources {
-		if resource.GetNamespace() == "" {
-			sortedResources = append(sortedResources, resource)
-		}
-	}
-	for _, resource := range s.Resources {
-		if resource.GetNamespace() != "" {
-			sortedResources = append(sortedResources, resource)
-		}
-	}
+	sortedResources := sortResources(s.Resources)
 
+	appliedCRDs := false
 	for _, resource := range sortedResources {
 		s.prepareResource(resource)
-		mapping, err := mapper.RESTMapping(resource.GroupVersionKind().GroupKind(), resource.GroupVersionKind().Version)
+		drClient, err := s.clientForResource(mapper, resource)
+		if err != nil && appliedCRDs {
+			// the kinds of the CRDs just applied might not have been discovered yet
+			mapper.Reset()
+			drClient, err = s.clientForResource(mapper, resource)
+		}
 		if err != nil {
-			return fmt.Errorf("mapping error: %s", err)
+			return err
 		}
-		var drClient dynamic.ResourceInterface
-		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-			drClient = s.Client.Resource(mapping.Resource).Namespace(resource.GetNamespace())
-		} else {
-			drClient = s.Client.Resource(mapping.Resource)
+		if isCRD(resource) {
+			appliedCRDs = true
 		}
 		serverResource, err := drClient.Get(ctx, resource.GetName(), metav1.GetOptions{})
-		if apiErrors.IsNotFound(err) {
-			_, err := drClient.Create(ctx, resource, metav1.CreateOptions{})
-			if err != nil {
-				return fmt.Errorf("cannot create resource %s: %s", resource.GetName(), err)
-			}
-		} else if err != nil {
+		if err != nil && !apiErrors.IsNotFound(err) {
 			return fmt.Errorf("unknown api error: %s", err)
-		} else { // The resource already exists, we need to update/patch it
-			localChecksum := resource.GetAnnotations()[ChecksumAnnotation]
-			if serverResource.GetAnnotations()[ChecksumAnnotation] == localChecksum {
+		}
+		if err == nil {
+			if err := s.upgradeClientSideApply(ctx, drClient, serverResource); err != nil {
+				return fmt.Errorf("can't upgrade resource %s to server-side apply: %v", resource.GetName(), err)
+			}
+			if serverResource.GetAnnotations()[ChecksumAnnotation] == resource.GetAnnotations()[ChecksumAnnotation] {
 				log.Debug("resource checksums match, no need to update")
 				s.keepResource(resource)
 				continue
 			}
-			if serverResource.GetAnnotations()[LastConfigAnnotation] == "" {
-				log.Debug("doing plain update as no last-config label present")
-				resource.SetResourceVersion(serverResource.GetResourceVersion())
-				_, err = drClient.Update(ctx, resource, metav1.UpdateOptions{})
-			} else {
-				log.Debug("patching resource")
-				err = s.patchResource(ctx, drClient, serverResource, resource)
-			}
-			if err != nil {
-				return fmt.Errorf("can't update resource:%v", err)
-			}
+		}
+		if err := s.applyResource(ctx, drClient, resource); err != nil {
+			return fmt.Errorf("can't apply resource %s: %v", resource.GetName(), err)
 		}
 		s.keepResource(resource)
 	}
@@ -127,6 +116,43 @@ func (s *Stack) Apply(ctx context.Context, prune bool) error {
 	return err
 }
 
+// sortResources orders the resources so that the ones others depend on are applied first: the CRDs, then the
+// namespaces, then the other cluster scoped resources and then the namespaced ones
+func sortResources(resources []*unstructured.Unstructured) []*unstructured.Unstructured {
+	sorted := []*unstructured.Unstructured{}
+	for _, filter := range []func(*unstructured.Unstructured) bool{
+		isCRD,
+		func(r *unstructured.Unstructured) bool { return r.GroupVersionKind().GroupKind() == namespaceGroupKind },
+		func(r *unstructured.Unstructured) bool { return r.GetNamespace() == "" },
+		func(r *unstructured.Unstructured) bool { return true },
+	} {
+		for _, resource := range resources {
+			if filter(resource) && !containsResource(sorted, resource) {
+				sorted = append(sorted, resource)
+			}
+		}
+	}
+	return sorted
+}
+
+var (
+	crdGroupKind       = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+	namespaceGroupKind = schema.GroupKind{Kind: "Namespace"}
+)
+
+func isCRD(resource *unstructured.Unstructured) bool {
+	return resource.GroupVersionKind().GroupKind() == crdGroupKind
+}
+
+func containsResource(resources []*unstructured.Unstructured, resource *unstructured.Unstructured) bool {
+	for _, r := range resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Stack) keepResource(resource *unstructured.Unstructured) {
 	resourceID := generateResourceID(*resource)
 	logrus.WithField("stack", s.Name).Debugf("marking resource to be kept: %s", resourceID)
@@ -232,12 +258,15 @@ func (s *Stack) findPruneableResources(ctx context.Context, mapper *restmapper.D
 	}
 
 	wg := sync.WaitGroup{}
+	var mutex sync.Mutex
 	namespaces := s.getAllAccessibleNamespaces(ctx)
 	for _, groupVersionKind := range groupVersionKinds {
 		wg.Add(1)
 		go func(groupVersionKind *schema.GroupVersionKind) {
 			defer wg.Done()
 			pruneableForGvk := s.findPruneableResourceForGroupVersionKind(ctx, mapper, groupVersionKind, namespaces)
+			mutex.Lock()
+			defer mutex.Unlock()
 			pruneableResources = append(pruneableResources, pruneableForGvk...)
 		}(groupVersionKind)
 	}
@@ -316,11 +345,12 @@ func (s *Stack) getPruneableResources(ctx context.Context, drClient dynamic.Reso
 	if err != nil {
 		return []*unstructured.Unstructured{}
 	}
-	for _, resource := range resourceList.Items {
+	for i := range resourceList.Items {
+		resource := &resourceList.Items[i]
 		// We need to filter out objects that do not actually have the stack label set
 		// There are some cases where we get "extra" results, e.g.: https://github.com/kubernetes-sigs/metrics-server/issues/604
-		if !s.isInStack(resource) && len(resource.GetOwnerReferences()) == 0 && resource.GetLabels()[NameLabel] == s.Name {
-			pruneableResources = append(pruneableResources, &resource)
+		if !s.isInStack(*resource) && len(resource.GetOwnerReferences()) == 0 && resource.GetLabels()[NameLabel] == s.Name {
+			pruneableResources = append(pruneableResources, resource)
 		}
 	}
 
@@ -338,28 +368,34 @@ func (s *Stack) isInStack(resource unstructured.Unstructured) bool {
 	return false
 }
 
-func (s *Stack) patchResource(ctx context.Context, drClient dynamic.ResourceInterface, serverResource *unstructured.Unstructured, localResource *unstructured.Unstructured) error {
-	original := serverResource.GetAnnotations()[LastConfigAnnotation]
-	if original == "" {
-		return fmt.Errorf("%s does not have last-applied-configuration", localResource.GetSelfLink())
-	}
-	modified, _ := localResource.MarshalJSON()
-
-	patch, err := jsonpatch.CreateMergePatch([]byte(original), modified)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create jsonpatch data")
-	}
-	_, err = drClient.Patch(ctx, localResource.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+// applyResource applies the resource server-side, taking over the fields of the stack from any other field manager
+func (s *Stack) applyResource(ctx context.Context, drClient dynamic.ResourceInterface, resource *unstructured.Unstructured) error {
+	data, err := resource.MarshalJSON()
 	if err != nil {
-		return errors.Wrapf(err, "failed to patch resource")
+		return errors.Wrapf(err, "failed to marshal resource")
 	}
+	force := true
+	_, err = drClient.Patch(ctx, resource.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+	})
+	return err
+}
 
-	return nil
+// upgradeClientSideApply hands the fields of a resource applied client-side by an older k0s version over to the
+// server-side apply field manager, see csaUpgradePatch
+func (s *Stack) upgradeClientSideApply(ctx context.Context, drClient dynamic.ResourceInterface, serverResource *unstructured.Unstructured) error {
+	patch, err := csaUpgradePatch(serverResource)
+	if err != nil || patch == nil {
+		return err
+	}
+	logrus.WithField("stack", s.Name).Debugf("upgrading %s to server-side apply", serverResource.GetName())
+	_, err = drClient.Patch(ctx, serverResource.GetName(), types.JSONPatchType, patch, metav1.PatchOptions{})
+	return err
 }
 
 func (s *Stack) prepareResource(resource *unstructured.Unstructured) {
 	checksum := resourceChecksum(resource)
-	lastAppliedConfig, _ := resource.MarshalJSON()
 
 	labels := resource.GetLabels()
 	if labels == nil {
@@ -373,7 +409,6 @@ func (s *Stack) prepareResource(resource *unstructured.Unstructured) {
 		annotations = map[string]string{}
 	}
 	annotations[ChecksumAnnotation] = checksum
-	annotations[LastConfigAnnotation] = string(lastAppliedConfig)
 	resource.SetAnnotations(annotations)
 }
 
@@ -16,10 +16,11 @@ limitations under the License.
 package applier
 
 import (
+	"context"
+	"errors"
 	"time"
 
-	"k8s.io/client-go/util/retry"
-
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/pkg/debounce"
 	"github.com/k0sproject/k0s/pkg/kubernetes"
 	"github.com/sirupsen/logrus"
@@ -34,6 +35,8 @@ type StackApplier struct {
 	applier   Applier
 	log       *logrus.Entry
 	done      chan bool
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
 // NewStackApplier crates new stack applier to manage a stack
@@ -49,6 +52,7 @@ func NewStackApplier(path string, kubeClientFactory kubernetes.ClientFactory) (*
 	applier := NewApplier(path, kubeClientFactory)
 	log := logrus.WithField("component", "applier-"+applier.Name)
 	log.WithField("path", path).Debug("created stack applier")
+	ctx, cancel := context.WithCancel(context.Background())
 
 	return &StackApplier{
 		Path:      path,
@@ -56,6 +60,8 @@ func NewStackApplier(path string, kubeClientFactory kubernetes.ClientFactory) (*
 		applier:   applier,
 		log:       log,
 		done:      make(chan bool, 1),
+		ctx:       ctx,
+		cancel:    cancel,
 	}, nil
 }
 
@@ -63,9 +69,7 @@ func NewStackApplier(path string, kubeClientFactory kubernetes.ClientFactory) (*
 func (s *StackApplier) Start() error {
 	debouncer := debounce.New(5*time.Second, s.fsWatcher.Events, func(arg fsnotify.Event) {
 		s.log.Debug("debouncer triggering, applying...")
-		err := retry.OnError(retry.DefaultRetry, func(err error) bool {
-			return true
-		}, s.applier.Apply)
+		err := s.apply()
 		if err != nil {
 			s.log.Warnf("failed to apply manifests: %s", err.Error())
 		}
@@ -81,9 +85,37 @@ func (s *StackApplier) Start() error {
 	return nil
 }
 
+// apply applies the stack, retrying for as long as the stacks it depends on haven't been applied or are invalid,
+// otherwise giving up after five failed attempts. The invalid dependencies are fixed in the configs of other stacks
+// too, whose changes don't trigger an apply of this stack.
+func (s *StackApplier) apply() error {
+	failures := 0
+	return retry.Do(s.ctx, "apply stack "+s.applier.Name, func() error {
+		err := s.applier.Apply()
+		var pending *DependencyPendingError
+		if errors.As(err, &pending) {
+			s.log.Info(err.Error())
+			return err
+		}
+		var invalid *InvalidDependencyError
+		if errors.As(err, &invalid) {
+			s.log.Warnf("can't apply the stack: %s", err.Error())
+			return err
+		}
+		if err != nil {
+			failures++
+			if failures >= 5 {
+				return retry.Unrecoverable(err)
+			}
+		}
+		return err
+	}, retry.Attempts(0))
+}
+
 // Stop stops the stack applier and removes the stack
 func (s *StackApplier) Stop() error {
 	s.log.WithField("stack", s.Path).Info("stopping and deleting stack")
+	s.cancel()
 	s.done <- true
 	close(s.done)
 
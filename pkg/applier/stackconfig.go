@@ -0,0 +1,112 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package applier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StackConfigFile is the optional file in a stack directory configuring how the stack is applied. It's not applied
+// as a manifest.
+const StackConfigFile = ".k0s-stack.yaml"
+
+// StackConfig configures how a stack is applied
+type StackConfig struct {
+	// Prune tells if the resources removed from the stack are deleted from the cluster, defaults to true
+	Prune *bool `yaml:"prune,omitempty"`
+	// DependsOn are the stacks which must have been applied successfully before the stack is applied
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+}
+
+// PruneEnabled tells if the resources removed from the stack are deleted from the cluster
+func (c StackConfig) PruneEnabled() bool {
+	return c.Prune == nil || *c.Prune
+}
+
+// LoadStackConfig loads the config of the stack in dir, the defaults if it has no config file
+func LoadStackConfig(dir string) (StackConfig, error) {
+	var config StackConfig
+	data, err := ioutil.ReadFile(filepath.Join(dir, StackConfigFile))
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("invalid stack config %s: %w", filepath.Join(dir, StackConfigFile), err)
+	}
+	for _, dep := range config.DependsOn {
+		if dep == filepath.Base(dir) {
+			return config, fmt.Errorf("invalid stack config %s: the stack depends on itself", filepath.Join(dir, StackConfigFile))
+		}
+	}
+	return config, nil
+}
+
+// InvalidDependencyError tells that a stack can't be applied because it depends on a stack that doesn't exist, or
+// because its dependencies lead back to the stack itself
+type InvalidDependencyError struct {
+	Reason string
+}
+
+func (e *InvalidDependencyError) Error() string {
+	return e.Reason
+}
+
+// checkDependencyGraph checks the stacks the stack in dir depends on, directly or through other stacks, across the
+// manifests dir the stack is in. It fails if any of them doesn't exist or if they depend on the stack in turn.
+func checkDependencyGraph(dir string, config StackConfig) error {
+	manifestsDir, name := filepath.Dir(dir), filepath.Base(dir)
+	path := []string{name}
+	visited := map[string]bool{}
+
+	var visit func(stack string, deps []string) error
+	visit = func(stack string, deps []string) error {
+		for _, dep := range deps {
+			if dep == name {
+				return &InvalidDependencyError{Reason: fmt.Sprintf("dependency cycle %s", strings.Join(append(path, dep), " -> "))}
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+
+			depDir := filepath.Join(manifestsDir, dep)
+			if stat, err := os.Stat(depDir); err != nil || !stat.IsDir() {
+				return &InvalidDependencyError{Reason: fmt.Sprintf("stack %s depends on unknown stack %s", stack, dep)}
+			}
+			depConfig, err := LoadStackConfig(depDir)
+			if err != nil {
+				// the stack reports its broken config itself
+				continue
+			}
+			path = append(path, dep)
+			if err := visit(dep, depConfig.DependsOn); err != nil {
+				return err
+			}
+			path = path[:len(path)-1]
+		}
+		return nil
+	}
+	return visit(name, config.DependsOn)
+}
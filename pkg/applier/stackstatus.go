@@ -0,0 +1,154 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package applier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// stackStatusResource is the (cluster scoped) StackStatus the applier reports the state of each stack with
+var stackStatusResource = schema.GroupVersionResource{
+	Group:    "applier.k0sproject.io",
+	Version:  "v1beta1",
+	Resource: "stackstatuses",
+}
+
+// StackStatusStatus is the state of the last apply of a stack
+type StackStatusStatus struct {
+	Stack                   string                `json:"stack"`
+	LastApplyTime           string                `json:"lastApplyTime"`
+	LastSuccessfulApplyTime string                `json:"lastSuccessfulApplyTime,omitempty"`
+	Error                   string                `json:"error,omitempty"`
+	ResourceCount           int                   `json:"resourceCount"`
+	Resources               []StackStatusResource `json:"resources,omitempty"`
+}
+
+// StackStatusResource identifies a resource of a stack
+type StackStatusResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// stackStatusName returns the name of the StackStatus of the stack, the stack name made a valid object name
+func stackStatusName(stack string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(stack), "-"), "-.")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
+
+// reportStatus applies the StackStatus of the stack after an apply. Failing to report the status doesn't fail the
+// apply, the StackStatus CRD is applied as a stack itself and might not be there yet.
+func (a *Applier) reportStatus(resources []*unstructured.Unstructured, applyErr error) {
+	ctx := context.Background()
+	client := a.client.Resource(stackStatusResource)
+	name := stackStatusName(a.Name)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	status := StackStatusStatus{
+		Stack:         a.Name,
+		LastApplyTime: now,
+		ResourceCount: len(resources),
+	}
+	for _, resource := range resources {
+		status.Resources = append(status.Resources, StackStatusResource{
+			APIVersion: resource.GetAPIVersion(),
+			Kind:       resource.GetKind(),
+			Namespace:  resource.GetNamespace(),
+			Name:       resource.GetName(),
+		})
+	}
+	if applyErr == nil {
+		status.LastSuccessfulApplyTime = now
+	} else {
+		status.Error = applyErr.Error()
+		// keep the last successful apply, and the resources as of it if the stack couldn't even be loaded
+		if existing, err := client.Get(ctx, name, metav1.GetOptions{}); err == nil {
+			var previous StackStatusStatus
+			if data, err := json.Marshal(existing.Object["status"]); err == nil && json.Unmarshal(data, &previous) == nil {
+				status.LastSuccessfulApplyTime = previous.LastSuccessfulApplyTime
+				if resources == nil {
+					status.ResourceCount, status.Resources = previous.ResourceCount, previous.Resources
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"apiVersion": stackStatusResource.GroupVersion().String(),
+		"kind":       "StackStatus",
+		"metadata":   map[string]interface{}{"name": name},
+		"status":     status,
+	})
+	if err != nil {
+		return
+	}
+	force := true
+	_, err = client.Patch(ctx, name, types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: FieldManager, Force: &force})
+	if err != nil {
+		a.log.WithError(err).Debug("failed to report the stack status")
+	}
+}
+
+// DependencyPendingError tells that a stack isn't applied because a stack it depends on hasn't been applied yet
+type DependencyPendingError struct {
+	Stack string
+}
+
+func (e *DependencyPendingError) Error() string {
+	return fmt.Sprintf("waiting for stack %s to be applied", e.Stack)
+}
+
+// checkDependencies checks that the stacks the stack depends on have been applied successfully, by their StackStatus
+func (a *Applier) checkDependencies(deps []string) error {
+	for _, dep := range deps {
+		r, err := a.client.Resource(stackStatusResource).Get(context.Background(), stackStatusName(dep), metav1.GetOptions{})
+		if apiErrors.IsNotFound(err) {
+			return &DependencyPendingError{Stack: dep}
+		}
+		if err != nil {
+			return fmt.Errorf("can't get the status of stack %s: %w", dep, err)
+		}
+		if applied, _, _ := unstructured.NestedString(r.Object, "status", "lastSuccessfulApplyTime"); applied == "" {
+			return &DependencyPendingError{Stack: dep}
+		}
+	}
+	return nil
+}
+
+// deleteStatus deletes the StackStatus of a deleted stack
+func (a *Applier) deleteStatus() {
+	err := a.client.Resource(stackStatusResource).Delete(context.Background(), stackStatusName(a.Name), metav1.DeleteOptions{})
+	if err != nil && !apiErrors.IsNotFound(err) {
+		a.log.WithError(err).Debug("failed to delete the stack status")
+	}
+}
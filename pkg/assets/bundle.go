@@ -0,0 +1,97 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package assets
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/internal/retry"
+)
+
+// BundleSource is the URL or the local directory of the component bundle the binaries left out of a slim k0s build
+// are fetched from. The bundle has the compressed binaries at bin/<name>.gz.
+var BundleSource string
+
+// bundleClient downloads the binaries, the largest ones are around a hundred megabytes
+var bundleClient = &http.Client{Timeout: 10 * time.Minute}
+
+// isRemoteBundle tells if the bundle source is a URL rather than a local directory
+func isRemoteBundle(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// openBundleFile opens the compressed binary gzname of the bundle at source
+func openBundleFile(ctx context.Context, source string, gzname string) (io.ReadCloser, error) {
+	if !isRemoteBundle(source) {
+		f, err := os.Open(filepath.Join(strings.TrimPrefix(source, "file://"), filepath.FromSlash(gzname)))
+		if os.IsNotExist(err) {
+			return nil, retry.Unrecoverable(err)
+		}
+		return f, err
+	}
+
+	url := strings.TrimSuffix(source, "/") + "/" + gzname
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, retry.Unrecoverable(err)
+	}
+	resp, err := bundleClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err := fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+			return nil, retry.Unrecoverable(err)
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// fetch stages the binary p from the component bundle, verifying it against the digest recorded at build time. The
+// digest is part of the k0s binary, so the bundle can be served from anywhere, plain HTTP mirrors included.
+func fetch(p string, gzname string, digest string) error {
+	if BundleSource == "" {
+		return fmt.Errorf("%s isn't embedded in this slim k0s build, set --bundle-source to the URL or the local directory of the component bundle", filepath.Base(p))
+	}
+	logrus.Infof("Staging %s from %s", p, BundleSource)
+
+	ctx := context.Background()
+	return retry.Do(ctx, "fetch "+gzname, func() error {
+		r, err := openBundleFile(ctx, BundleSource, gzname)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %w", gzname, BundleSource, err)
+		}
+		return extract(p, gz, digest)
+	})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBundle(t *testing.T, dir string, name string, content string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bin", name+".gz"), buf.Bytes(), 0644))
+
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundleDir := filepath.Join(dir, "bundle")
+	binDir := filepath.Join(dir, "bin")
+	require.NoError(t, os.MkdirAll(binDir, 0755))
+	digest := writeBundle(t, bundleDir, "etcd", "#!/bin/sh\necho etcd\n")
+
+	defer func() { BundleSource = "" }()
+
+	t.Run("no_source", func(t *testing.T) {
+		BundleSource = ""
+		err := fetch(filepath.Join(binDir, "etcd"), "bin/etcd.gz", digest)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "--bundle-source")
+	})
+
+	t.Run("local_dir", func(t *testing.T) {
+		BundleSource = "file://" + bundleDir
+		p := filepath.Join(binDir, "etcd")
+		require.NoError(t, fetch(p, "bin/etcd.gz", digest))
+		assert.True(t, isStaged(p, digest))
+	})
+
+	t.Run("url", func(t *testing.T) {
+		server := httptest.NewServer(http.StripPrefix("/v1.20.5+k0s.0", http.FileServer(http.Dir(bundleDir))))
+		defer server.Close()
+		BundleSource = server.URL + "/v1.20.5+k0s.0/"
+		p := filepath.Join(binDir, "etcd-url")
+		require.NoError(t, fetch(p, "bin/etcd.gz", digest))
+		data, err := ioutil.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, "#!/bin/sh\necho etcd\n", string(data))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		BundleSource = bundleDir
+		p := filepath.Join(binDir, "kubelet")
+		assert.Error(t, fetch(p, "bin/kubelet.gz", digest))
+		assert.False(t, isStaged(p, digest))
+	})
+}
@@ -17,10 +17,16 @@ package assets
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -28,23 +34,6 @@ import (
 	"github.com/k0sproject/k0s/internal/util"
 )
 
-// ExecutableIsOlder return true if currently running executable is older than given filepath
-func ExecutableIsOlder(filepath string) bool {
-	ex, err := os.Executable()
-	if err != nil {
-		return false
-	}
-	exinfo, err := os.Stat(ex)
-	if err != nil {
-		return false
-	}
-	pathinfo, err := os.Stat(filepath)
-	if err != nil {
-		return false
-	}
-	return exinfo.ModTime().Unix() < pathinfo.ModTime().Unix()
-}
-
 // BinPath searches for a binary on disk:
 // - in the BinDir folder,
 // - in the PATH.
@@ -64,27 +53,76 @@ func BinPath(name string, binDir string) string {
 	return name
 }
 
-// Stage ...
+// stageStamp records the digest of a staged binary with the size and the modification time of the file, so that
+// unchanged binaries are recognized on the next start without reading them
+type stageStamp struct {
+	Digest  string    `json:"digest"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// VerificationFailure is the last failed verification of the binary, kept after it has been re-staged
+	VerificationFailure string `json:"verificationFailure,omitempty"`
+}
+
+// stampPath returns the path of the stamp of the staged binary at p
+func stampPath(p string) string {
+	return filepath.Join(filepath.Dir(p), "."+filepath.Base(p)+".staged")
+}
+
+// readStamp reads the stamp of the staged binary at p
+func readStamp(p string) (*stageStamp, error) {
+	data, err := ioutil.ReadFile(stampPath(p))
+	if err != nil {
+		return nil, err
+	}
+	var stamp stageStamp
+	if err := json.Unmarshal(data, &stamp); err != nil {
+		return nil, err
+	}
+	return &stamp, nil
+}
+
+// isStaged tells if the binary at p has been staged with the given digest and hasn't been modified since
+func isStaged(p string, digest string) bool {
+	stat, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	stamp, err := readStamp(p)
+	if err != nil {
+		return false
+	}
+	return stamp.Digest == digest && stamp.Size == stat.Size() && stamp.ModTime.Equal(stat.ModTime())
+}
+
+// Stage extracts the embedded binary to dataDir unless it's been staged already with the same content. The binaries
+// left out of a slim build are fetched from the component bundle instead. The others which aren't embedded are
+// skipped, they're looked up from the PATH by BinPath.
 func Stage(dataDir string, name string, filemode os.FileMode) error {
 	p := filepath.Join(dataDir, name)
-	logrus.Infof("Staging %s", p)
 
 	err := util.InitDirectory(filepath.Dir(p), filemode)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create dir %s", filepath.Dir(p))
 	}
 
-	if ExecutableIsOlder(p) {
-		logrus.Debug("Re-use existing file:", p)
-		return nil
-	}
-
 	gzname := "bin/" + name + ".gz"
 	bin, embedded := BinData[gzname]
+	if remote, ok := RemoteBinData[gzname]; !embedded && ok {
+		if isStaged(p, remote.digest) {
+			logrus.Debug("Re-use existing file:", p)
+			return nil
+		}
+		return fetch(p, gzname, remote.digest)
+	}
 	if !embedded {
 		logrus.Debug("Skipping not embedded file:", gzname)
 		return nil
 	}
+	if isStaged(p, bin.digest) {
+		logrus.Debug("Re-use existing file:", p)
+		return nil
+	}
+	logrus.Infof("Staging %s", p)
 	logrus.Debugf("%s is at offset %d", gzname, bin.offset)
 
 	selfexe, err := os.Executable()
@@ -109,29 +147,47 @@ func Stage(dataDir string, name string, filemode os.FileMode) error {
 	}
 
 	logrus.Debug("Writing static file: ", p)
-
-	if err := copyTo(p, gz); err != nil {
-		return err
-	}
-	if err := os.Chmod(p, 0550); err != nil {
-		return errors.Wrapf(err, "Failed to chmod %s", name)
-	}
-	return nil
+	return extract(p, gz, bin.digest)
 }
 
-func copyTo(p string, gz io.Reader) error {
-	_ = os.Remove(p)
-	f, err := os.Create(p)
+// extract writes the binary read from r to p if its content has the given digest, and stamps it. The binary is
+// written next to p and renamed over it, so that a running binary is never partially overwritten.
+func extract(p string, r io.Reader, digest string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".")
 	if err != nil {
 		return errors.Wrapf(err, "failed to create %s", p)
 	}
-	defer f.Close()
-	if err != nil {
-		return errors.Wrapf(err, "failed to create %s", p)
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
 	}
-	_, err = io.Copy(f, gz)
 	if err != nil {
 		return errors.Wrapf(err, "failed to write to %s", p)
 	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != digest {
+		return fmt.Errorf("%s is corrupted, its digest is %s instead of %s", filepath.Base(p), actual, digest)
+	}
+	if err := os.Chmod(tmp.Name(), 0550); err != nil {
+		return errors.Wrapf(err, "Failed to chmod %s", filepath.Base(p))
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return errors.Wrapf(err, "failed to write %s", p)
+	}
+
+	stat, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	stamp, err := json.Marshal(stageStamp{Digest: digest, Size: stat.Size(), ModTime: stat.ModTime()})
+	if err != nil {
+		return err
+	}
+	// without the stamp the binary is only extracted again on the next start
+	if err := ioutil.WriteFile(stampPath(p), stamp, 0644); err != nil {
+		logrus.WithError(err).Warnf("failed to write the stamp of %s", p)
+	}
 	return nil
 }
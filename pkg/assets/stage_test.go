@@ -0,0 +1,63 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-bin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	content := "#!/bin/sh\necho kubelet\n"
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+	p := filepath.Join(dir, "kubelet")
+
+	assert.False(t, isStaged(p, digest))
+	require.NoError(t, extract(p, strings.NewReader(content), digest))
+	assert.True(t, isStaged(p, digest))
+	data, err := ioutil.ReadFile(p)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+
+	// a new k0s version embeds another binary
+	assert.False(t, isStaged(p, strings.Repeat("0", 64)))
+
+	// the binary is modified after staging
+	require.NoError(t, os.Chmod(p, 0750))
+	require.NoError(t, ioutil.WriteFile(p, []byte("#!/bin/sh\necho modified kubelet\n"), 0750))
+	assert.False(t, isStaged(p, digest))
+
+	// a corrupted binary isn't staged
+	err = extract(p, strings.NewReader("truncated"), digest)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "corrupted")
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "the temporary files are removed")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// expectedDigest returns the digest the staged binary name should have, the one of the running k0s binary if it
+// knows the binary, otherwise the one recorded in its stamp, if any
+func expectedDigest(name string, stamp *stageStamp) string {
+	gzname := "bin/" + name + ".gz"
+	if bin, ok := BinData[gzname]; ok {
+		return bin.digest
+	}
+	if remote, ok := RemoteBinData[gzname]; ok {
+		return remote.digest
+	}
+	if stamp == nil {
+		return ""
+	}
+	return stamp.Digest
+}
+
+// fileDigest returns the hex encoded SHA256 of the file at p
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyStaged verifies the content of the binary at p against its expected digest before it's started. A binary
+// which doesn't match, e.g. because of bit-rot or tampering, is staged again and the failure is recorded in its
+// stamp for k0s status. The binaries k0s knows are verified even if their stamp has been removed, only the ones
+// neither known nor staged by k0s are not verified. It only returns an error if the binary doesn't match and
+// couldn't be staged again, so it must not be started.
+func VerifyStaged(p string) error {
+	stamp, _ := readStamp(p)
+	expected := expectedDigest(filepath.Base(p), stamp)
+	if expected == "" {
+		return nil
+	}
+	actual, err := fileDigest(p)
+	if err == nil && actual == expected {
+		return nil
+	}
+
+	var failure string
+	if err != nil {
+		failure = fmt.Sprintf("failed to read %s: %v", p, err)
+	} else {
+		failure = fmt.Sprintf("%s has digest %s instead of %s", p, actual, expected)
+	}
+	logrus.Errorf("integrity verification failed, staging the binary again: %s", failure)
+	failure = time.Now().UTC().Format(time.RFC3339) + ": " + failure
+
+	// the stamp may still match a tampered binary with its size and modification time preserved
+	_ = os.Remove(stampPath(p))
+	if err := Stage(filepath.Dir(p), filepath.Base(p), constant.BinDirMode); err != nil {
+		return fmt.Errorf("%s: failed to stage it again: %w", failure, err)
+	}
+	if actual, err := fileDigest(p); err != nil || actual != expected {
+		return fmt.Errorf("%s: the binary still doesn't match after staging it again", failure)
+	}
+
+	stamp, err = readStamp(p)
+	if err != nil {
+		return nil
+	}
+	stamp.VerificationFailure = failure
+	if data, err := json.Marshal(stamp); err == nil {
+		_ = ioutil.WriteFile(stampPath(p), data, 0644)
+	}
+	return nil
+}
+
+// ReadVerificationFailures returns the last integrity verification failures of the binaries staged in binDir, keyed
+// by the binary
+func ReadVerificationFailures(binDir string) map[string]string {
+	stamps, err := filepath.Glob(filepath.Join(binDir, ".*.staged"))
+	if err != nil {
+		return nil
+	}
+	failures := make(map[string]string)
+	for _, path := range stamps {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "."), ".staged")
+		if stamp, err := readStamp(filepath.Join(binDir, name)); err == nil && stamp.VerificationFailure != "" {
+			failures[name] = stamp.VerificationFailure
+		}
+	}
+	return failures
+}
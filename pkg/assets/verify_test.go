@@ -0,0 +1,100 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package assets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyStaged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bundleDir := filepath.Join(dir, "bundle")
+	binDir := filepath.Join(dir, "bin")
+	require.NoError(t, os.MkdirAll(binDir, 0755))
+
+	content := "#!/bin/sh\necho containerd\n"
+	digest := writeBundle(t, bundleDir, "containerd", content)
+	RemoteBinData["bin/containerd.gz"] = struct {
+		size   int64
+		digest string
+	}{int64(len(content)), digest}
+	BundleSource = bundleDir
+	defer func() {
+		delete(RemoteBinData, "bin/containerd.gz")
+		BundleSource = ""
+	}()
+	p := filepath.Join(binDir, "containerd")
+
+	t.Run("not_staged", func(t *testing.T) {
+		assert.NoError(t, VerifyStaged(filepath.Join(binDir, "runc")))
+	})
+
+	t.Run("intact", func(t *testing.T) {
+		require.NoError(t, Stage(binDir, "containerd", 0755))
+		assert.NoError(t, VerifyStaged(p))
+		assert.Empty(t, ReadVerificationFailures(binDir))
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		stat, err := os.Stat(p)
+		require.NoError(t, err)
+		require.NoError(t, os.Chmod(p, 0750))
+		// same size and modification time so that it still matches the stamp
+		require.NoError(t, ioutil.WriteFile(p, []byte(strings.Replace(content, "echo", "ecko", 1)), 0750))
+		require.NoError(t, os.Chtimes(p, stat.ModTime(), stat.ModTime()))
+
+		assert.NoError(t, VerifyStaged(p))
+		data, err := ioutil.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+		assert.True(t, isStaged(p, digest))
+
+		failures := ReadVerificationFailures(binDir)
+		assert.Len(t, failures, 1)
+		assert.Contains(t, failures["containerd"], "instead of "+digest)
+	})
+
+	t.Run("stamp_removed", func(t *testing.T) {
+		require.NoError(t, os.Chmod(p, 0750))
+		require.NoError(t, ioutil.WriteFile(p, []byte("tampered"), 0750))
+		require.NoError(t, os.Remove(stampPath(p)))
+
+		assert.NoError(t, VerifyStaged(p))
+		data, err := ioutil.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+		assert.True(t, isStaged(p, digest))
+	})
+
+	t.Run("not_restageable", func(t *testing.T) {
+		require.NoError(t, os.Chmod(p, 0750))
+		require.NoError(t, ioutil.WriteFile(p, []byte("truncated"), 0750))
+		BundleSource = filepath.Join(dir, "missing")
+
+		err := VerifyStaged(p)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to stage it again")
+	})
+}
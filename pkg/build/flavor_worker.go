@@ -0,0 +1,6 @@
+// +build worker
+
+package build
+
+// WorkerOnly is set in the worker-only k0s build, which embeds only the binaries of the worker components
+const WorkerOnly = true
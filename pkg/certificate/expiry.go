@@ -0,0 +1,112 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExpiredCertificate describes a certificate on disk which is no longer valid
+type ExpiredCertificate struct {
+	Path     string
+	NotAfter time.Time
+	IsCA     bool
+}
+
+func (e ExpiredCertificate) String() string {
+	return fmt.Sprintf("%s (expired %s)", e.Path, e.NotAfter.Format(time.RFC3339))
+}
+
+// CertificateExpiry describes the validity of a certificate on disk
+type CertificateExpiry struct {
+	Path     string    `json:"path"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+	IsCA     bool      `json:"isCA"`
+}
+
+// ListCertificates walks the given dir and returns the validity of all the certificates found
+func ListCertificates(dir string) ([]CertificateExpiry, error) {
+	var certs []CertificateExpiry
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".crt") {
+			return nil
+		}
+		cert, err := parseCertificateFile(path)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, CertificateExpiry{
+			Path:     path,
+			Subject:  cert.Subject.CommonName,
+			NotAfter: cert.NotAfter,
+			IsCA:     cert.IsCA,
+		})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return certs, err
+}
+
+// FindExpired walks the given dir and returns all the certificates expired at the given time
+func FindExpired(dir string, now time.Time) ([]ExpiredCertificate, error) {
+	certs, err := ListCertificates(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredCertificate
+	for _, cert := range certs {
+		if now.After(cert.NotAfter) {
+			expired = append(expired, ExpiredCertificate{
+				Path:     cert.Path,
+				NotAfter: cert.NotAfter,
+				IsCA:     cert.IsCA,
+			})
+		}
+	}
+	return expired, nil
+}
+
+func parseCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode certificate %s", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %v", path, err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCert(t *testing.T, path string, notAfter time.Time, isCA bool) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: filepath.Base(path)},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+}
+
+func TestFindExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	writeTestCert(t, filepath.Join(dir, "ca.crt"), now.Add(24*time.Hour), true)
+	writeTestCert(t, filepath.Join(dir, "server.crt"), now.Add(-time.Hour), false)
+	writeTestCert(t, filepath.Join(dir, "etcd", "ca.crt"), now.Add(-time.Hour), true)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sa.pub"), []byte("not a cert"), 0644))
+
+	expired, err := FindExpired(dir, now)
+	require.NoError(t, err)
+	require.Len(t, expired, 2)
+	require.Equal(t, filepath.Join(dir, "etcd", "ca.crt"), expired[0].Path)
+	require.True(t, expired[0].IsCA)
+	require.Equal(t, filepath.Join(dir, "server.crt"), expired[1].Path)
+	require.False(t, expired[1].IsCA)
+
+	t.Run("missing_dir_is_not_an_error", func(t *testing.T) {
+		expired, err := FindExpired(filepath.Join(dir, "nonexisting"), now)
+		require.NoError(t, err)
+		require.Empty(t, expired)
+	})
+}
+
+func TestListCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	writeTestCert(t, filepath.Join(dir, "ca.crt"), now.Add(24*time.Hour), true)
+	writeTestCert(t, filepath.Join(dir, "server.crt"), now.Add(time.Hour), false)
+
+	certs, err := ListCertificates(dir)
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+	require.Equal(t, filepath.Join(dir, "ca.crt"), certs[0].Path)
+	require.Equal(t, "ca.crt", certs[0].Subject)
+	require.True(t, certs[0].IsCA)
+	require.Equal(t, filepath.Join(dir, "server.crt"), certs[1].Path)
+	require.False(t, certs[1].IsCA)
+	require.WithinDuration(t, now.Add(time.Hour), certs[1].NotAfter, time.Second)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// ImportCA installs an externally provided CA cert and key as the given CA, e.g. to chain the cluster PKI to a corporate CA.
+// The cert file may contain the chain of the CA after the CA certificate itself, i.e. the parent intermediate CAs and
+// the root. Once installed, the CA is used for all the certificates issued with it. An already existing CA is never replaced.
+func (m *Manager) ImportCA(name, certPath, keyPath string) error {
+	keyFile := filepath.Join(m.K0sVars.CertRootDir, fmt.Sprintf("%s.key", name))
+	certFile := filepath.Join(m.K0sVars.CertRootDir, fmt.Sprintf("%s.crt", name))
+
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read CA key: %v", err)
+	}
+	certs, err := validateCA(certPEM, key, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid CA %s: %v", certPath, err)
+	}
+	cert := encodeCertificates(certs[:1])
+
+	if util.FileExists(certFile) {
+		existing, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+		existingCerts := decodeCertificates(existing)
+		if len(existingCerts) == 0 || !bytes.Equal(existingCerts[0].Raw, certs[0].Raw) {
+			return fmt.Errorf("the cluster already has a different CA in %s, the CA of an existing cluster cannot be changed", certFile)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), constant.CertRootDirMode); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyFile, key, constant.CertSecureMode); err != nil {
+		return err
+	}
+	if len(certs) > 1 {
+		if err := ioutil.WriteFile(chainPath(certFile), encodeCertificates(certs[1:]), constant.CertMode); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(certFile, cert, constant.CertMode)
+}
+
+// validateCA checks that the first cert is a CA certificate valid at the given time, that the key belongs to it and
+// that each of the following certificates has signed the previous one. Returns the parsed certificates.
+func validateCA(certPEM, keyPEM []byte, now time.Time) ([]*x509.Certificate, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for _, der := range pair.Certificate {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		if !cert.IsCA || (cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0) {
+			return nil, fmt.Errorf("certificate %q is not allowed to sign certificates", cert.Subject.CommonName)
+		}
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil, fmt.Errorf("certificate %q is valid only from %s to %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		}
+		if len(certs) > 0 {
+			if err := certs[len(certs)-1].CheckSignatureFrom(cert); err != nil {
+				return nil, fmt.Errorf("certificate %q is not signed by the next certificate %q in the chain: %v", certs[len(certs)-1].Subject.CommonName, cert.Subject.CommonName, err)
+			}
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// chainPath is the path of the file holding the chain of an imported intermediate CA, e.g. ca-chain.crt for ca.crt
+func chainPath(caCertPath string) string {
+	return strings.TrimSuffix(caCertPath, ".crt") + "-chain.crt"
+}
+
+// IssuerChain returns the certificates to bundle with the certificates issued by the given CA so that they can be
+// verified against the root. It's empty unless the CA is an imported intermediate CA.
+func IssuerChain(caCertPath string) ([]byte, error) {
+	chain, err := ioutil.ReadFile(chainPath(caCertPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := ensureTrailingNewline(ca)
+	for _, cert := range decodeCertificates(chain) {
+		// the root is the trust anchor of the clients, no point in sending it
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			continue
+		}
+		bundle = append(bundle, encodeCertificates([]*x509.Certificate{cert})...)
+	}
+	return bundle, nil
+}
+
+// TrustBundle returns the CA certificate with its chain, to be used as the trusted CA data e.g. in kubeconfigs
+func TrustBundle(caCertPath string) ([]byte, error) {
+	ca, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := ioutil.ReadFile(chainPath(caCertPath))
+	if os.IsNotExist(err) {
+		return ca, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return append(ensureTrailingNewline(ca), chain...), nil
+}
+
+func encodeCertificates(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+func decodeCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func ensureTrailingNewline(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return append(data, '\n')
+	}
+	return data
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+type testKeyPair struct {
+	cert    *x509.Certificate
+	key     *rsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestKeyPair creates a key pair signed by the parent, or a self-signed one if parent is nil
+func newTestKeyPair(t *testing.T, name string, isCA bool, parent *testKeyPair) *testKeyPair {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testKeyPair{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+}
+
+// write writes the key pair in the dir, the cert file is followed by the given chain
+func (kp *testKeyPair) write(t *testing.T, dir string, chain ...*testKeyPair) (string, string) {
+	certPEM := kp.certPEM
+	for _, c := range chain {
+		certPEM = append(certPEM, c.certPEM...)
+	}
+	certPath, keyPath := filepath.Join(dir, kp.cert.Subject.CommonName+".crt"), filepath.Join(dir, kp.cert.Subject.CommonName+".key")
+	require.NoError(t, ioutil.WriteFile(certPath, certPEM, 0644))
+	require.NoError(t, ioutil.WriteFile(keyPath, kp.keyPEM, 0600))
+	return certPath, keyPath
+}
+
+func newTestManager(t *testing.T) (Manager, string) {
+	dir, err := ioutil.TempDir("", "k0s-import-ca")
+	require.NoError(t, err)
+	certDir := filepath.Join(dir, "pki")
+	require.NoError(t, os.MkdirAll(certDir, 0755))
+	return Manager{K0sVars: constant.CfgVars{CertRootDir: certDir}}, dir
+}
+
+func TestImportCA(t *testing.T) {
+	m, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+	certDir := m.K0sVars.CertRootDir
+
+	corpCert, corpKey := newTestKeyPair(t, "corp-ca", true, nil).write(t, dir)
+	other := newTestKeyPair(t, "other-ca", true, nil)
+	otherCert, otherKey := other.write(t, dir)
+	leafCert, leafKey := newTestKeyPair(t, "leaf", false, other).write(t, dir)
+
+	t.Run("not_a_ca", func(t *testing.T) {
+		require.Error(t, m.ImportCA("ca", leafCert, leafKey))
+	})
+
+	t.Run("mismatching_key", func(t *testing.T) {
+		require.Error(t, m.ImportCA("ca", corpCert, otherKey))
+	})
+
+	t.Run("import", func(t *testing.T) {
+		require.NoError(t, m.ImportCA("ca", corpCert, corpKey))
+		imported, err := ioutil.ReadFile(filepath.Join(certDir, "ca.crt"))
+		require.NoError(t, err)
+		expected, err := ioutil.ReadFile(corpCert)
+		require.NoError(t, err)
+		require.Equal(t, expected, imported)
+		require.FileExists(t, filepath.Join(certDir, "ca.key"))
+
+		// re-importing the same CA on restart is fine
+		require.NoError(t, m.ImportCA("ca", corpCert, corpKey))
+
+		// no chain, nothing to bundle
+		chain, err := IssuerChain(filepath.Join(certDir, "ca.crt"))
+		require.NoError(t, err)
+		require.Empty(t, chain)
+	})
+
+	t.Run("existing_ca_is_not_replaced", func(t *testing.T) {
+		require.Error(t, m.ImportCA("ca", otherCert, otherKey))
+	})
+}
+
+func TestImportIntermediateCA(t *testing.T) {
+	m, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+	certDir := m.K0sVars.CertRootDir
+
+	root := newTestKeyPair(t, "root", true, nil)
+	corp := newTestKeyPair(t, "corp", true, root)
+	etcd := newTestKeyPair(t, "etcd", true, corp)
+
+	t.Run("broken_chain", func(t *testing.T) {
+		certPath, keyPath := etcd.write(t, dir, root)
+		require.Error(t, m.ImportCA("etcd/ca", certPath, keyPath))
+	})
+
+	certPath, keyPath := etcd.write(t, dir, corp, root)
+	require.NoError(t, m.ImportCA("etcd/ca", certPath, keyPath))
+
+	caPath := filepath.Join(certDir, "etcd", "ca.crt")
+	imported, err := ioutil.ReadFile(caPath)
+	require.NoError(t, err)
+	require.Equal(t, etcd.certPEM, imported)
+
+	// the issued certificates carry the intermediates but not the root
+	chain, err := IssuerChain(caPath)
+	require.NoError(t, err)
+	require.Equal(t, append(append([]byte{}, etcd.certPEM...), corp.certPEM...), chain)
+
+	// the clients trust the whole chain
+	bundle, err := TrustBundle(caPath)
+	require.NoError(t, err)
+	require.Equal(t, append(append(append([]byte{}, etcd.certPEM...), corp.certPEM...), root.certPEM...), bundle)
+}
@@ -16,17 +16,19 @@ limitations under the License.
 package certificate
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 
-	"github.com/cloudflare/cfssl/certinfo"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/cli/genkey"
 	"github.com/cloudflare/cfssl/cli/sign"
+	cfsslconfig "github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/signer"
@@ -55,8 +57,16 @@ type Certificate struct {
 // Manager is the certificate manager
 type Manager struct {
 	K0sVars constant.CfgVars
+	// CALifetime and Lifetime are the lifetimes of the generated CAs and the issued certificates, the defaults are used when not set
+	CALifetime time.Duration
+	Lifetime   time.Duration
 }
 
+const (
+	defaultCALifetime = 10 * 365 * 24 * time.Hour
+	defaultLifetime   = 365 * 24 * time.Hour
+)
+
 // EnsureCA makes sure the given CA certs and key is created.
 func (m *Manager) EnsureCA(name, cn string) error {
 	keyFile := filepath.Join(m.K0sVars.CertRootDir, fmt.Sprintf("%s.key", name))
@@ -71,8 +81,12 @@ func (m *Manager) EnsureCA(name, cn string) error {
 	req.KeyRequest.A = "rsa"
 	req.KeyRequest.S = 2048
 	req.CN = cn
+	caLifetime := m.CALifetime
+	if caLifetime == 0 {
+		caLifetime = defaultCALifetime
+	}
 	req.CA = &csr.CAConfig{
-		Expiry: "87600h",
+		Expiry: caLifetime.String(),
 	}
 	cert, _, key, err := initca.New(req)
 	if err != nil {
@@ -103,40 +117,7 @@ func (m *Manager) EnsureCertificate(certReq Request, ownerName string) (Certific
 	// if regenerateCert returns true, it means we need to create the certs
 	if m.regenerateCert(certReq, keyFile, certFile) {
 		logrus.Debug("creating certificates")
-		req := csr.CertificateRequest{
-			KeyRequest: csr.NewKeyRequest(),
-			CN:         certReq.CN,
-			Names: []csr.Name{
-				{O: certReq.O},
-			},
-		}
-
-		req.KeyRequest.A = "rsa"
-		req.KeyRequest.S = 2048
-		req.Hosts = certReq.Hostnames
-
-		var key, csrBytes []byte
-		g := &csr.Generator{Validator: genkey.Validator}
-		csrBytes, key, err := g.ProcessRequest(&req)
-		if err != nil {
-			return Certificate{}, err
-		}
-		config := cli.Config{
-			CAFile:    certReq.CACert,
-			CAKeyFile: certReq.CAKey,
-		}
-		s, err := sign.SignerFromConfig(config)
-		if err != nil {
-			return Certificate{}, err
-		}
-
-		var cert []byte
-		signReq := signer.SignRequest{
-			Request: string(csrBytes),
-			Profile: "kubernetes",
-		}
-
-		cert, err = s.Sign(signReq)
+		cert, key, err := m.issue(certReq)
 		if err != nil {
 			return Certificate{}, err
 		}
@@ -185,10 +166,115 @@ func (m *Manager) EnsureCertificate(certReq Request, ownerName string) (Certific
 
 }
 
+// IssueCertificate creates a new key and certificate for the request without storing them in the certificate directory
+func (m *Manager) IssueCertificate(certReq Request) (Certificate, error) {
+	cert, key, err := m.issue(certReq)
+	if err != nil {
+		return Certificate{}, err
+	}
+	return Certificate{
+		Key:  string(key),
+		Cert: string(cert),
+	}, nil
+}
+
+// issue creates a new key and a certificate signed by the CA of the request
+func (m *Manager) issue(certReq Request) ([]byte, []byte, error) {
+	req := csr.CertificateRequest{
+		KeyRequest: csr.NewKeyRequest(),
+		CN:         certReq.CN,
+		Names: []csr.Name{
+			{O: certReq.O},
+		},
+	}
+
+	req.KeyRequest.A = "rsa"
+	req.KeyRequest.S = 2048
+	req.Hosts = certReq.Hostnames
+
+	g := &csr.Generator{Validator: genkey.Validator}
+	csrBytes, key, err := g.ProcessRequest(&req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := m.newSigner(certReq.CACert, certReq.CAKey, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := s.Sign(signer.SignRequest{
+		Request: string(csrBytes),
+		Profile: "kubernetes",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// certificates issued by an intermediate CA carry the chain so that they can be verified against the root
+	chain, err := IssuerChain(certReq.CACert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(ensureTrailingNewline(cert), chain...), key, nil
+}
+
+// SignClientCSR issues a client certificate for a PEM encoded certificate signing request. The subject of the request is
+// replaced with the given CN and O and its SANs are dropped, so that the requester can't choose its own identity.
+func (m *Manager) SignClientCSR(csrPEM []byte, cn, o, caCert, caKey string) ([]byte, error) {
+	s, err := m.newSigner(caCert, caKey, []string{"signing", "key encipherment", "client auth"})
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := s.Sign(signer.SignRequest{
+		Request: string(csrPEM),
+		Hosts:   []string{},
+		Subject: &signer.Subject{
+			CN:    cn,
+			Names: []csr.Name{{O: o}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	chain, err := IssuerChain(caCert)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ensureTrailingNewline(cert), chain...), nil
+}
+
+// newSigner creates a signer for the CA issuing certificates with the configured lifetime, usages overrides the default usages
+func (m *Manager) newSigner(caCert, caKey string, usages []string) (signer.Signer, error) {
+	lifetime := m.Lifetime
+	if lifetime == 0 {
+		lifetime = defaultLifetime
+	}
+	profile := cfsslconfig.DefaultConfig()
+	profile.Expiry = lifetime
+	profile.ExpiryString = lifetime.String()
+	if usages != nil {
+		profile.Usage = usages
+	}
+	config := cli.Config{
+		CAFile:    caCert,
+		CAKeyFile: caKey,
+		CFG: &cfsslconfig.Config{
+			Signing: &cfsslconfig.Signing{
+				Profiles: map[string]*cfsslconfig.SigningProfile{},
+				Default:  profile,
+			},
+		},
+	}
+	return sign.SignerFromConfig(config)
+}
+
 // if regenerateCert does not need to do any changes, it will return false
 // if a change in SAN hosts is detected, if will return true, to re-generate certs
 func (m *Manager) regenerateCert(certReq Request, keyFile string, certFile string) bool {
-	var cert *certinfo.Certificate
+	var cert *x509.Certificate
 	var err error
 
 	// if certificate & key don't exist, return true, in order to generate certificates
@@ -196,13 +282,19 @@ func (m *Manager) regenerateCert(certReq Request, keyFile string, certFile strin
 		return true
 	}
 
-	if cert, err = certinfo.ParseCertificateFile(certFile); err != nil {
+	// the certificate file may also hold the chain of the issuer, the certificate itself is the first one
+	if cert, err = parseCertificateFile(certFile); err != nil {
 		logrus.Debugf("unable to parse certificate file: %v", err)
 		return true
 	}
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
 
 	// if existing SANs are different than configured, delete the certificate to re-generate it
-	if !util.IsStringArrayEqual(certReq.Hostnames, cert.SANs) {
+	if !util.IsStringArrayEqual(certReq.Hostnames, sans) {
 		logrus.Debug("found changes in SAN configuration. attempting to re-generate files")
 
 		files := []string{certFile, keyFile}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// caNames are the CAs k0s issues certificates with, relative to the cert dir
+var caNames = []string{"ca", "front-proxy-ca", "etcd/ca"}
+
+// RenewCertificate re-issues the certificate at the given path with the same subject and SANs, signed by the CA which issued it.
+// The files are rewritten in place so that they keep their owner and permissions.
+func (m *Manager) RenewCertificate(certPath string) error {
+	cert, err := parseCertificateFile(certPath)
+	if err != nil {
+		return err
+	}
+	if cert.IsCA {
+		return fmt.Errorf("%s is a CA, it can't be renewed", certPath)
+	}
+	caCert, caKey, err := m.findIssuer(cert)
+	if err != nil {
+		return fmt.Errorf("can't renew %s: %v", certPath, err)
+	}
+
+	hostnames := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hostnames = append(hostnames, ip.String())
+	}
+	var o string
+	if len(cert.Subject.Organization) > 0 {
+		o = cert.Subject.Organization[0]
+	}
+	newCert, key, err := m.issue(Request{
+		CN:        cert.Subject.CommonName,
+		O:         o,
+		CACert:    caCert,
+		CAKey:     caKey,
+		Hostnames: hostnames,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to issue %s: %v", certPath, err)
+	}
+
+	keyPath := strings.TrimSuffix(certPath, ".crt") + ".key"
+	if err := ioutil.WriteFile(keyPath, key, constant.CertSecureMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certPath, newCert, constant.CertMode)
+}
+
+// findIssuer returns the cert and key paths of the k0s CA which signed the given certificate
+func (m *Manager) findIssuer(cert *x509.Certificate) (string, string, error) {
+	for _, name := range caNames {
+		caCertPath := filepath.Join(m.K0sVars.CertRootDir, name+".crt")
+		if !util.FileExists(caCertPath) {
+			continue
+		}
+		ca, err := parseCertificateFile(caCertPath)
+		if err != nil {
+			return "", "", err
+		}
+		if cert.CheckSignatureFrom(ca) == nil {
+			return caCertPath, filepath.Join(m.K0sVars.CertRootDir, name+".key"), nil
+		}
+	}
+	return "", "", fmt.Errorf("issuer %q is not a k0s CA", cert.Issuer.CommonName)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewCertificate(t *testing.T) {
+	m, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+	certDir := m.K0sVars.CertRootDir
+
+	m.Lifetime = 48 * time.Hour
+	require.NoError(t, m.EnsureCA("ca", "kubernetes-ca"))
+	require.NoError(t, os.MkdirAll(filepath.Join(certDir, "etcd"), 0755))
+	require.NoError(t, m.EnsureCA("etcd/ca", "etcd-ca"))
+
+	_, err := m.EnsureCertificate(Request{
+		Name:      "etcd/server",
+		CN:        "etcd-server",
+		O:         "etcd-server",
+		CACert:    filepath.Join(certDir, "etcd", "ca.crt"),
+		CAKey:     filepath.Join(certDir, "etcd", "ca.key"),
+		Hostnames: []string{"127.0.0.1", "localhost"},
+	}, "root")
+	require.NoError(t, err)
+
+	certPath := filepath.Join(certDir, "etcd", "server.crt")
+	old, err := parseCertificateFile(certPath)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(48*time.Hour), old.NotAfter, time.Minute)
+
+	m.Lifetime = 96 * time.Hour
+	require.NoError(t, m.RenewCertificate(certPath))
+
+	renewed, err := parseCertificateFile(certPath)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(96*time.Hour), renewed.NotAfter, time.Minute)
+	require.NotEqual(t, old.SerialNumber, renewed.SerialNumber)
+	require.Equal(t, old.Subject.CommonName, renewed.Subject.CommonName)
+	require.Equal(t, old.Subject.Organization, renewed.Subject.Organization)
+	require.Equal(t, old.DNSNames, renewed.DNSNames)
+	require.Equal(t, old.IPAddresses, renewed.IPAddresses)
+
+	// the renewed certificate is signed by the same CA
+	etcdCA, err := parseCertificateFile(filepath.Join(certDir, "etcd", "ca.crt"))
+	require.NoError(t, err)
+	require.NoError(t, renewed.CheckSignatureFrom(etcdCA))
+
+	t.Run("ca_is_not_renewed", func(t *testing.T) {
+		require.Error(t, m.RenewCertificate(filepath.Join(certDir, "ca.crt")))
+	})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"bufio"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtraSANsFile holds the SANs added with k0s config certs add-san, one per line. It lives in the cert dir.
+const ExtraSANsFile = "extra-sans"
+
+// MissingSANs returns the addresses the certificate is not valid for
+func MissingSANs(cert *x509.Certificate, addresses []string) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, addr := range addresses {
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		if cert.VerifyHostname(addr) != nil {
+			missing = append(missing, addr)
+		}
+	}
+	return missing
+}
+
+// ReadExtraSANs returns the SANs added with k0s config certs add-san
+func ReadExtraSANs(certDir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(certDir, ExtraSANsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sans []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if san := strings.TrimSpace(scanner.Text()); san != "" && !strings.HasPrefix(san, "#") {
+			sans = append(sans, san)
+		}
+	}
+	return sans, scanner.Err()
+}
+
+// AddExtraSANs records the SANs so that they are included in the kube-apiserver and k0s API certificates from now on.
+// It returns the SANs which were not recorded before.
+func AddExtraSANs(certDir string, sans []string) ([]string, error) {
+	existing, err := ReadExtraSANs(certDir)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, san := range existing {
+		known[san] = true
+	}
+	var added []string
+	for _, san := range sans {
+		if !known[san] {
+			known[san] = true
+			added = append(added, san)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	content := strings.Join(append(existing, added...), "\n") + "\n"
+	return added, ioutil.WriteFile(filepath.Join(certDir, ExtraSANsFile), []byte(content), 0640)
+}
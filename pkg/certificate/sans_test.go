@@ -0,0 +1,58 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package certificate
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingSANs(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:    []string{"kubernetes", "api.example.com", "*.lb.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")},
+	}
+	missing := MissingSANs(cert, []string{"api.example.com", "10.0.0.1", "fd00::1", "eu.lb.example.com", "10.0.0.2", "api.other.com", "10.0.0.2", ""})
+	assert.Equal(t, []string{"10.0.0.2", "api.other.com"}, missing)
+}
+
+func TestExtraSANs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extra-sans")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sans, err := ReadExtraSANs(dir)
+	require.NoError(t, err)
+	assert.Empty(t, sans)
+
+	added, err := AddExtraSANs(dir, []string{"10.0.0.2", "api.other.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "api.other.com"}, added)
+
+	added, err = AddExtraSANs(dir, []string{"api.other.com", "192.168.1.1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.1"}, added)
+
+	sans, err = ReadExtraSANs(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "api.other.com", "192.168.1.1"}, sans)
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package check
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/k0sproject/k0s/internal/util"
+)
+
+const (
+	// DefaultNetworkPolicyCheckImage is the multi-OS image used for both the server and the client pods
+	DefaultNetworkPolicyCheckImage = "k8s.gcr.io/e2e-test-images/agnhost:2.21"
+
+	checkLabel     = "k0s.k0sproject.io/netpol-check"
+	checkRoleLabel = "k0s.k0sproject.io/netpol-check-role"
+	serverPort     = 8080
+	// policies are applied asynchronously by the network providers, so each probe is retried a few times
+	probeAttempts = 5
+)
+
+// NetworkPolicyResult is the outcome of a single connectivity probe
+type NetworkPolicyResult struct {
+	OS        string
+	Case      string
+	From      string
+	Expected  bool
+	Connected bool
+}
+
+// Passed tells if the probe matched the expectation
+func (r NetworkPolicyResult) Passed() bool {
+	return r.Expected == r.Connected
+}
+
+// ToArray formats the result for table output
+func (r NetworkPolicyResult) ToArray() []string {
+	status := "PASS"
+	if !r.Passed() {
+		status = "FAIL"
+	}
+	return []string{r.OS, r.Case, r.From, allowedString(r.Expected), allowedString(r.Connected), status}
+}
+
+func allowedString(b bool) string {
+	if b {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// NetworkPolicyCheck verifies that the network provider actually enforces NetworkPolicies.
+// For each OS present in the cluster it runs a server pod and probes it from two namespaces with a deny/allow policy matrix.
+type NetworkPolicyCheck struct {
+	Client  kubernetes.Interface
+	Image   string
+	Timeout time.Duration
+
+	log *logrus.Entry
+	id  string
+}
+
+// NewNetworkPolicyCheck creates new NetworkPolicyCheck
+func NewNetworkPolicyCheck(client kubernetes.Interface, image string, timeout time.Duration) *NetworkPolicyCheck {
+	return &NetworkPolicyCheck{
+		Client:  client,
+		Image:   image,
+		Timeout: timeout,
+		log:     logrus.WithField("component", "netpol-check"),
+		id:      util.RandomString(6),
+	}
+}
+
+// Run runs the check matrix and returns the results of each probe
+func (c *NetworkPolicyCheck) Run(ctx context.Context) ([]NetworkPolicyResult, error) {
+	osList, err := c.nodeOSes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []NetworkPolicyResult
+	for _, os := range osList {
+		osResults, err := c.runForOS(ctx, os)
+		results = append(results, osResults...)
+		if err != nil {
+			return results, fmt.Errorf("network policy check failed on %s nodes: %v", os, err)
+		}
+	}
+	return results, nil
+}
+
+// nodeOSes returns the operating systems of the nodes in the cluster, e.g. linux and windows
+func (c *NetworkPolicyCheck) nodeOSes(ctx context.Context) ([]string, error) {
+	nodes, err := c.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't list nodes: %v", err)
+	}
+	var osList []string
+	for _, node := range nodes.Items {
+		os := node.Labels[corev1.LabelOSStable]
+		if os != "" && !util.StringSliceContains(osList, os) {
+			osList = append(osList, os)
+		}
+	}
+	if len(osList) == 0 {
+		return nil, fmt.Errorf("no worker nodes found")
+	}
+	return osList, nil
+}
+
+func (c *NetworkPolicyCheck) runForOS(ctx context.Context, os string) ([]NetworkPolicyResult, error) {
+	serverNS := fmt.Sprintf("k0s-netpol-check-%s-%s-server", c.id, os)
+	clientNS := fmt.Sprintf("k0s-netpol-check-%s-%s-client", c.id, os)
+
+	for _, ns := range []string{serverNS, clientNS} {
+		_, err := c.Client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+				Labels: map[string]string{
+					checkLabel:     c.id,
+					checkRoleLabel: ns,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("can't create namespace %s: %v", ns, err)
+		}
+		defer c.deleteNamespace(ns)
+	}
+
+	serverIP, err := c.startServer(ctx, serverNS, os)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []NetworkPolicyResult
+	matrix := []struct {
+		name   string
+		policy *networkingv1.NetworkPolicy
+		expect map[string]bool
+	}{
+		{
+			name:   "no policy",
+			expect: map[string]bool{serverNS: true, clientNS: true},
+		},
+		{
+			name: "deny all ingress",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "deny-all"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				},
+			},
+			expect: map[string]bool{serverNS: false, clientNS: false},
+		},
+		{
+			name: "allow from other namespace",
+			policy: &networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "allow-client-ns"},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{{
+						From: []networkingv1.NetworkPolicyPeer{{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{checkRoleLabel: clientNS},
+							},
+						}},
+					}},
+				},
+			},
+			expect: map[string]bool{serverNS: false, clientNS: true},
+		},
+	}
+
+	for _, step := range matrix {
+		if step.policy != nil {
+			if _, err := c.Client.NetworkingV1().NetworkPolicies(serverNS).Create(ctx, step.policy, metav1.CreateOptions{}); err != nil {
+				return results, fmt.Errorf("can't create network policy %s: %v", step.policy.Name, err)
+			}
+		}
+		for _, from := range []string{serverNS, clientNS} {
+			expected := step.expect[from]
+			connected, err := c.probe(ctx, from, os, serverIP, expected)
+			if err != nil {
+				return results, err
+			}
+			results = append(results, NetworkPolicyResult{
+				OS:        os,
+				Case:      step.name,
+				From:      from,
+				Expected:  expected,
+				Connected: connected,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+func (c *NetworkPolicyCheck) startServer(ctx context.Context, ns string, os string) (string, error) {
+	pod := c.pod("server", os, []string{"netexec", "--http-port=" + strconv.Itoa(serverPort)})
+	pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	pod.Spec.Containers[0].Ports = []corev1.ContainerPort{{ContainerPort: serverPort}}
+	if _, err := c.Client.CoreV1().Pods(ns).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("can't create server pod: %v", err)
+	}
+
+	var podIP string
+	err := wait.PollImmediate(time.Second, c.Timeout, func() (bool, error) {
+		p, err := c.Client.CoreV1().Pods(ns).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		podIP = p.Status.PodIP
+		return p.Status.Phase == corev1.PodRunning && podIP != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("server pod did not start in %s: %v", c.Timeout, err)
+	}
+	return podIP, nil
+}
+
+// probe runs a client pod connecting to the server, retrying until the result matches the expectation
+func (c *NetworkPolicyCheck) probe(ctx context.Context, ns string, os string, serverIP string, expected bool) (bool, error) {
+	var connected bool
+	for i := 0; i < probeAttempts; i++ {
+		var err error
+		connected, err = c.probeOnce(ctx, ns, os, serverIP)
+		if err != nil {
+			return false, err
+		}
+		if connected == expected {
+			break
+		}
+		c.log.Debugf("probe from %s: expected %s, got %s, retrying", ns, allowedString(expected), allowedString(connected))
+		time.Sleep(2 * time.Second)
+	}
+	return connected, nil
+}
+
+func (c *NetworkPolicyCheck) probeOnce(ctx context.Context, ns string, os string, serverIP string) (bool, error) {
+	// the previous client pods might still be terminating, so each probe gets an unique name
+	pod := c.pod("client-"+util.RandomString(6), os, []string{"connect", fmt.Sprintf("%s:%d", serverIP, serverPort), "--timeout=5s"})
+	if _, err := c.Client.CoreV1().Pods(ns).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return false, fmt.Errorf("can't create client pod: %v", err)
+	}
+	defer func() {
+		_ = c.Client.CoreV1().Pods(ns).Delete(context.Background(), pod.Name, metav1.DeleteOptions{})
+	}()
+
+	var phase corev1.PodPhase
+	err := wait.PollImmediate(time.Second, c.Timeout, func() (bool, error) {
+		p, err := c.Client.CoreV1().Pods(ns).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		phase = p.Status.Phase
+		return phase == corev1.PodSucceeded || phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("client pod in %s did not finish in %s: %v", ns, c.Timeout, err)
+	}
+	return phase == corev1.PodSucceeded, nil
+}
+
+func (c *NetworkPolicyCheck) pod(name string, os string, args []string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{checkLabel: c.id},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			NodeSelector:  map[string]string{corev1.LabelOSStable: os},
+			Tolerations: []corev1.Toleration{{
+				Operator: corev1.TolerationOpExists,
+			}},
+			Containers: []corev1.Container{{
+				Name:  name,
+				Image: c.Image,
+				Args:  args,
+			}},
+		},
+	}
+}
+
+func (c *NetworkPolicyCheck) deleteNamespace(ns string) {
+	if err := c.Client.CoreV1().Namespaces().Delete(context.Background(), ns, metav1.DeleteOptions{}); err != nil {
+		c.log.Warnf("failed to clean up namespace %s: %v", ns, err)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package check
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func node(name string, os string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{corev1.LabelOSStable: os},
+		},
+	}
+}
+
+func TestNetworkPolicyCheckNodeOSes(t *testing.T) {
+	t.Run("linux_only", func(t *testing.T) {
+		c := NewNetworkPolicyCheck(fake.NewSimpleClientset(node("a", "linux"), node("b", "linux")), DefaultNetworkPolicyCheckImage, time.Minute)
+		osList, err := c.nodeOSes(context.TODO())
+		require.NoError(t, err)
+		require.Equal(t, []string{"linux"}, osList)
+	})
+	t.Run("mixed_cluster", func(t *testing.T) {
+		c := NewNetworkPolicyCheck(fake.NewSimpleClientset(node("a", "linux"), node("b", "windows")), DefaultNetworkPolicyCheckImage, time.Minute)
+		osList, err := c.nodeOSes(context.TODO())
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"linux", "windows"}, osList)
+	})
+	t.Run("no_nodes", func(t *testing.T) {
+		c := NewNetworkPolicyCheck(fake.NewSimpleClientset(), DefaultNetworkPolicyCheckImage, time.Minute)
+		_, err := c.nodeOSes(context.TODO())
+		require.Error(t, err)
+	})
+}
+
+func TestNetworkPolicyResult(t *testing.T) {
+	r := NetworkPolicyResult{OS: "linux", Case: "deny all ingress", From: "ns", Expected: false, Connected: true}
+	require.False(t, r.Passed())
+	require.Equal(t, []string{"linux", "deny all ingress", "ns", "denied", "allowed", "FAIL"}, r.ToArray())
+}
@@ -142,7 +142,7 @@ func (a *APIEndpointReconciler) reconcileEndpoints() error {
 					corev1.EndpointPort{
 						Name:     "https",
 						Protocol: "TCP",
-						Port:     6443,
+						Port:     int32(a.ClusterConfig.Spec.API.APIPort()),
 					},
 				},
 			},
@@ -174,7 +174,7 @@ func (a *APIEndpointReconciler) createEndpoint(addresses []string) error {
 					corev1.EndpointPort{
 						Name:     "https",
 						Protocol: "TCP",
-						Port:     6443,
+						Port:     int32(a.ClusterConfig.Spec.API.APIPort()),
 					},
 				},
 			},
@@ -17,16 +17,22 @@ package controller
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
+	"strconv"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 
 	"github.com/k0sproject/k0s/internal/util"
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/component"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/fips"
 	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
@@ -37,9 +43,16 @@ type APIServer struct {
 	LogLevel           string
 	Storage            component.Component
 	EnableKonnectivity bool
+	FIPS               bool
+	// DefaultAuditPolicy is written on start if there's no audit policy yet
+	DefaultAuditPolicy []byte
 	gid                int
-	supervisor         supervisor.Supervisor
-	uid                int
+	// mutex serializes the runs, stops and restarts, which the audit policy and certificate reloaders trigger
+	// concurrently with the shutdown
+	mutex      sync.Mutex
+	stopped    bool
+	supervisor supervisor.Supervisor
+	uid        int
 }
 
 var apiDefaultArgs = map[string]string{
@@ -49,7 +62,12 @@ var apiDefaultArgs = map[string]string{
 	"requestheader-extra-headers-prefix": "X-Remote-Extra-",
 	"requestheader-group-headers":        "X-Remote-Group",
 	"requestheader-username-headers":     "X-Remote-User",
-	"secure-port":                        "6443",
+}
+
+var auditDefaultArgs = map[string]string{
+	"audit-log-maxage":    "30",
+	"audit-log-maxbackup": "10",
+	"audit-log-maxsize":   "100",
 }
 
 const egressSelectorConfigTemplate = `
@@ -68,6 +86,17 @@ type egressSelectorConfig struct {
 	UDSName string
 }
 
+type admissionConfiguration struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Plugins    []admissionPlugin `yaml:"plugins"`
+}
+
+type admissionPlugin struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
 // Init extracts needed binaries
 func (a *APIServer) Init() error {
 	var err error
@@ -80,6 +109,13 @@ func (a *APIServer) Init() error {
 
 // Run runs kube api
 func (a *APIServer) Run() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stopped = false
+	return a.run()
+}
+
+func (a *APIServer) run() error {
 	logrus.Info("Starting kube-apiserver")
 	args := map[string]string{
 		"advertise-address":                a.ClusterConfig.Spec.API.Address,
@@ -103,6 +139,7 @@ func (a *APIServer) Run() error {
 		"profiling":                        "false",
 		"v":                                a.LogLevel,
 		"kubelet-certificate-authority":    path.Join(a.K0sVars.CertRootDir, "ca.crt"),
+		"secure-port":                      strconv.Itoa(a.ClusterConfig.Spec.API.APIPort()),
 	}
 
 	if a.EnableKonnectivity {
@@ -114,12 +151,48 @@ func (a *APIServer) Run() error {
 		args["api-audiences"] = "system:konnectivity-server"
 	}
 
+	if a.ClusterConfig.Spec.API.OIDC != nil {
+		for name, value := range a.ClusterConfig.Spec.API.OIDC.APIServerArgs() {
+			args[name] = value
+		}
+	}
+
+	if a.ClusterConfig.Spec.API.Admission != nil {
+		for name, value := range a.ClusterConfig.Spec.API.Admission.APIServerArgs() {
+			args[name] = value
+		}
+		if len(a.ClusterConfig.Spec.API.Admission.Plugins) > 0 {
+			configPath, err := a.writeAdmissionConfig()
+			if err != nil {
+				return err
+			}
+			args["admission-control-config-file"] = configPath
+		}
+	}
+
+	// the builtin metrics aggregator runs on the controllers, outside of the service network
+	if a.ClusterConfig.Spec.Components.BuiltinMetrics() {
+		args["enable-aggregator-routing"] = "true"
+	}
+
+	// the audit policy is managed through the AuditPolicy CR, see auditpolicy.go
+	if len(a.DefaultAuditPolicy) > 0 && !util.FileExists(auditPolicyPath(a.K0sVars)) {
+		if err := writeAuditPolicy(a.K0sVars, a.DefaultAuditPolicy, a.uid); err != nil {
+			return err
+		}
+	}
+	if util.FileExists(auditPolicyPath(a.K0sVars)) {
+		args["audit-policy-file"] = auditPolicyPath(a.K0sVars)
+		args["audit-log-path"] = path.Join(a.K0sVars.AuditDir, "audit.log")
+	}
+
 	for name, value := range a.ClusterConfig.Spec.API.ExtraArgs {
 		if args[name] != "" && name != "profiling" {
 			return fmt.Errorf("cannot override apiserver flag: %s", name)
 		}
 		args[name] = value
 	}
+	a.ClusterConfig.Spec.FeatureGates.BuildArgs(args, config.APIServerComponent)
 	a.ClusterConfig.Spec.Network.DualStack.EnableDualStackFeatureGate(args)
 
 	for name, value := range apiDefaultArgs {
@@ -127,6 +200,20 @@ func (a *APIServer) Run() error {
 			args[name] = value
 		}
 	}
+	if a.FIPS {
+		for name, value := range fips.KubeArgs() {
+			if args[name] == "" {
+				args[name] = value
+			}
+		}
+	}
+	if args["audit-policy-file"] != "" {
+		for name, value := range auditDefaultArgs {
+			if args[name] == "" {
+				args[name] = value
+			}
+		}
+	}
 	if a.ClusterConfig.Spec.API.ExternalAddress != "" {
 		args["endpoint-reconciler-type"] = "none"
 	}
@@ -177,10 +264,73 @@ func (a *APIServer) writeKonnectivityConfig() error {
 	return nil
 }
 
+// writeAdmissionConfig stages the inline plugin configurations and the AdmissionConfiguration referencing them
+func (a *APIServer) writeAdmissionConfig() (string, error) {
+	dir := a.K0sVars.AdmissionDir
+	if err := util.InitDirectory(dir, constant.AdmissionDirMode); err != nil {
+		return "", errors.Wrap(err, "failed to initialize admission config dir")
+	}
+	if err := os.Chown(dir, a.uid, -1); err != nil && os.Geteuid() == 0 {
+		return "", errors.Wrap(err, "failed to chown admission config dir")
+	}
+
+	var plugins []admissionPlugin
+	for _, p := range a.ClusterConfig.Spec.API.Admission.Plugins {
+		pluginPath := p.Path
+		if pluginPath == "" {
+			pluginPath = path.Join(dir, p.Name+".yaml")
+			if err := a.writeAdmissionFile(pluginPath, p.Configuration); err != nil {
+				return "", err
+			}
+		}
+		plugins = append(plugins, admissionPlugin{Name: p.Name, Path: pluginPath})
+	}
+
+	configPath := path.Join(dir, "admission-config.yaml")
+	err := a.writeAdmissionFile(configPath, admissionConfiguration{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "AdmissionConfiguration",
+		Plugins:    plugins,
+	})
+	return configPath, err
+}
+
+func (a *APIServer) writeAdmissionFile(filePath string, content interface{}) error {
+	data, err := yaml.Marshal(content)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s", filePath)
+	}
+	if err := ioutil.WriteFile(filePath, data, constant.CertSecureMode); err != nil {
+		return errors.Wrapf(err, "failed to write %s", filePath)
+	}
+	if err := os.Chown(filePath, a.uid, -1); err != nil && os.Geteuid() == 0 {
+		return errors.Wrapf(err, "failed to chown %s", filePath)
+	}
+	return nil
+}
+
 // Stop stops APIServer
 func (a *APIServer) Stop() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stopped = true
 	return a.supervisor.Stop()
 }
 
+// Restart stops the running kube-apiserver and starts it again with freshly calculated args. Once APIServer has been
+// stopped, it's not started again.
+func (a *APIServer) Restart() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.stopped {
+		return fmt.Errorf("kube-apiserver has been stopped")
+	}
+	logrus.Info("Restarting kube-apiserver")
+	if err := a.supervisor.Stop(); err != nil {
+		return err
+	}
+	return a.run()
+}
+
 // Health-check interface
 func (a *APIServer) Healthy() error { return nil }
@@ -0,0 +1,398 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
+	kubeutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+const (
+	// auditPolicyName is the name of the (cluster scoped) AuditPolicy object k0s reconciles
+	auditPolicyName = "k0s"
+	// auditReloadLeaseName is the lease used to make sure only one controller reloads kube-apiserver at a time
+	auditReloadLeaseName = "k0s-audit-policy-reload"
+	// auditReloadLeaseDuration is the time after which a lease held by a crashed controller can be taken over
+	auditReloadLeaseDuration = 300
+	// apiServerReadyTimeout is the time to wait for the restarted kube-apiserver to become ready before rolling back
+	apiServerReadyTimeout = 2 * time.Minute
+)
+
+var auditPolicyGVR = schema.GroupVersionResource{
+	Group:    "audit.k0sproject.io",
+	Version:  "v1beta1",
+	Resource: "auditpolicies",
+}
+
+var auditLevels = []string{"None", "Metadata", "Request", "RequestResponse"}
+
+func auditPolicyPath(k0sVars constant.CfgVars) string {
+	return path.Join(k0sVars.AuditDir, "policy.yaml")
+}
+
+// APIServerRestarter restarts the locally running kube-apiserver
+type APIServerRestarter interface {
+	Restart() error
+}
+
+// AuditPolicyReconciler syncs the AuditPolicy CR onto the controllers disk and reloads kube-apiserver on changes.
+// The reloads are serialized across the controllers using a lease, so the API stays available during a policy roll-out.
+type AuditPolicyReconciler struct {
+	APIServer         APIServerRestarter
+	K0sVars           constant.CfgVars
+	KubeClientFactory kubeutil.ClientFactory
+	// DefaultPolicy is used when the AuditPolicy object does not exist, nil disables auditing then
+	DefaultPolicy []byte
+
+	L          *logrus.Entry
+	client     dynamic.Interface
+	kubeClient clientset.Interface
+	nodeName   string
+	uid        int
+	stopCh     chan struct{}
+	// failedChecksum is the checksum of the policy kube-apiserver didn't become ready with, it's not applied again
+	// until the policy changes
+	failedChecksum string
+}
+
+// NewAuditPolicyReconciler creates the AuditPolicyReconciler component
+func NewAuditPolicyReconciler(k0sVars constant.CfgVars, apiServer APIServerRestarter, kubeClientFactory kubeutil.ClientFactory) *AuditPolicyReconciler {
+	return &AuditPolicyReconciler{
+		APIServer:         apiServer,
+		K0sVars:           k0sVars,
+		KubeClientFactory: kubeClientFactory,
+		L:                 logrus.WithFields(logrus.Fields{"component": "auditpolicy"}),
+		stopCh:            make(chan struct{}),
+	}
+}
+
+// Init initializes the component needs
+func (r *AuditPolicyReconciler) Init() error {
+	var err error
+	r.uid, err = util.GetUID(constant.ApiserverUser)
+	if err != nil {
+		r.L.Warnf("failed to resolve %s user, audit files will be owned by root: %v", constant.ApiserverUser, err)
+	}
+	r.nodeName, err = os.Hostname()
+	if err != nil {
+		return fmt.Errorf("can't resolve hostname for audit policy reconciler: %v", err)
+	}
+	return nil
+}
+
+// Run every 10 seconds checks the AuditPolicy object and reloads the local kube-apiserver if needed
+func (r *AuditPolicyReconciler) Run() error {
+	var err error
+	r.client, err = r.KubeClientFactory.GetDynamicClient()
+	if err != nil {
+		return fmt.Errorf("can't create kubernetes dynamic client for audit policy: %v", err)
+	}
+	r.kubeClient, err = r.KubeClientFactory.GetClient()
+	if err != nil {
+		return fmt.Errorf("can't create kubernetes rest client for audit policy: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.reconcile(context.Background()); err != nil {
+					r.L.Warnf("audit policy reconcile failed: %s", err.Error())
+				}
+			case <-r.stopCh:
+				r.L.Info("audit policy reconciler done")
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the reconciler
+func (r *AuditPolicyReconciler) Stop() error {
+	close(r.stopCh)
+	return nil
+}
+
+// Healthy is a no-op health-check
+func (r *AuditPolicyReconciler) Healthy() error { return nil }
+
+func (r *AuditPolicyReconciler) reconcile(ctx context.Context) error {
+	var desired []byte
+	obj, err := r.client.Resource(auditPolicyGVR).Get(ctx, auditPolicyName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("can't get AuditPolicy %s: %v", auditPolicyName, err)
+	}
+	if err == nil {
+		policy, _, err := unstructured.NestedMap(obj.Object, "spec", "policy")
+		if err != nil {
+			return fmt.Errorf("invalid AuditPolicy %s: %v", auditPolicyName, err)
+		}
+		if err := validateAuditPolicy(policy); err != nil {
+			return fmt.Errorf("invalid AuditPolicy %s: %v", auditPolicyName, err)
+		}
+		desired, err = yaml.Marshal(policy)
+		if err != nil {
+			return err
+		}
+	} else {
+		obj = nil
+		desired = r.DefaultPolicy
+	}
+
+	current, err := ioutil.ReadFile(auditPolicyPath(r.K0sVars))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(current, desired) {
+		return r.updateStatus(ctx, obj, desired)
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(desired))
+	if checksum == r.failedChecksum {
+		r.L.Debug("not reloading kube-apiserver with the audit policy it failed with before")
+		return nil
+	}
+
+	acquired, err := r.acquireReloadLease(ctx)
+	if err != nil || !acquired {
+		r.L.Debug("another controller is reloading kube-apiserver, waiting for it to finish")
+		return err
+	}
+	defer func() {
+		if err := r.releaseReloadLease(context.Background()); err != nil {
+			r.L.Warnf("failed to release audit policy reload lease: %s", err.Error())
+		}
+	}()
+
+	r.L.Info("audit policy changed, reloading kube-apiserver")
+	if err := r.reload(ctx, desired); err != nil {
+		r.L.Warnf("kube-apiserver did not become ready with the new audit policy, rolling back and not retrying it until the AuditPolicy changes: %s", err.Error())
+		r.failedChecksum = checksum
+		if rollbackErr := r.reload(ctx, current); rollbackErr != nil {
+			return fmt.Errorf("audit policy rollback failed: %v", rollbackErr)
+		}
+		return err
+	}
+	r.failedChecksum = ""
+
+	return r.updateStatus(ctx, obj, desired)
+}
+
+// reload writes the policy (or removes it when empty) and restarts kube-apiserver
+func (r *AuditPolicyReconciler) reload(ctx context.Context, policy []byte) error {
+	if err := r.writePolicy(policy); err != nil {
+		return err
+	}
+	if err := r.APIServer.Restart(); err != nil {
+		return fmt.Errorf("failed to restart kube-apiserver: %v", err)
+	}
+	return r.waitForAPIServer(ctx)
+}
+
+func (r *AuditPolicyReconciler) writePolicy(policy []byte) error {
+	policyPath := auditPolicyPath(r.K0sVars)
+	if len(policy) == 0 {
+		if err := os.Remove(policyPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove audit policy: %v", err)
+		}
+		return nil
+	}
+
+	return writeAuditPolicy(r.K0sVars, policy, r.uid)
+}
+
+// writeAuditPolicy writes the audit policy readable by kube-apiserver running as uid
+func writeAuditPolicy(k0sVars constant.CfgVars, policy []byte, uid int) error {
+	policyPath := auditPolicyPath(k0sVars)
+	if err := util.InitDirectory(k0sVars.AuditDir, constant.AuditDirMode); err != nil {
+		return fmt.Errorf("failed to initialize audit dir: %v", err)
+	}
+	if err := os.Chown(k0sVars.AuditDir, uid, -1); err != nil && os.Geteuid() == 0 {
+		return fmt.Errorf("failed to chown audit dir: %v", err)
+	}
+	if err := ioutil.WriteFile(policyPath, policy, constant.CertSecureMode); err != nil {
+		return fmt.Errorf("failed to write audit policy: %v", err)
+	}
+	if err := os.Chown(policyPath, uid, -1); err != nil && os.Geteuid() == 0 {
+		return fmt.Errorf("failed to chown audit policy: %v", err)
+	}
+	return nil
+}
+
+func (r *AuditPolicyReconciler) waitForAPIServer(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, apiServerReadyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, err := r.kubeClient.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+			if err == nil {
+				return nil
+			}
+			r.L.Debugf("kube-apiserver not ready yet: %s", err.Error())
+		case <-ctx.Done():
+			return fmt.Errorf("kube-apiserver not ready after %s", apiServerReadyTimeout)
+		}
+	}
+}
+
+// updateStatus records the policy checksum applied on this controller into the AuditPolicy status
+func (r *AuditPolicyReconciler) updateStatus(ctx context.Context, obj *unstructured.Unstructured, policy []byte) error {
+	if obj == nil {
+		return nil
+	}
+	checksum := fmt.Sprintf("%x", sha256.Sum256(policy))
+	applied, _, _ := unstructured.NestedString(obj.Object, "status", "controllers", r.nodeName)
+	if applied == checksum {
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := r.client.Resource(auditPolicyGVR).Get(ctx, auditPolicyName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(latest.Object, checksum, "status", "controllers", r.nodeName); err != nil {
+			return err
+		}
+		_, err = r.client.Resource(auditPolicyGVR).UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (r *AuditPolicyReconciler) acquireReloadLease(ctx context.Context) (bool, error) {
+	leases := r.kubeClient.CoordinationV1().Leases("kube-system")
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(auditReloadLeaseDuration)
+
+	lease, err := leases.Get(ctx, auditReloadLeaseName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      auditReloadLeaseName,
+				Namespace: "kube-system",
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &r.nodeName,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != "" && holder != r.nodeName && lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil && kubeutil.IsValidLease(*lease) {
+		return false, nil
+	}
+
+	lease.Spec.HolderIdentity = &r.nodeName
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	// the update fails on conflict if some other controller grabbed the lease in between
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *AuditPolicyReconciler) releaseReloadLease(ctx context.Context) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		leases := r.kubeClient.CoordinationV1().Leases("kube-system")
+		lease, err := leases.Get(ctx, auditReloadLeaseName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != r.nodeName {
+			return nil
+		}
+		empty := ""
+		lease.Spec.HolderIdentity = &empty
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// validateAuditPolicy does a basic sanity check on the policy so that a broken policy never makes it to kube-apiserver
+func validateAuditPolicy(policy map[string]interface{}) error {
+	if len(policy) == 0 {
+		return fmt.Errorf("spec.policy must be set")
+	}
+	apiVersion, _, _ := unstructured.NestedString(policy, "apiVersion")
+	if apiVersion != "audit.k8s.io/v1" && apiVersion != "audit.k8s.io/v1beta1" {
+		return fmt.Errorf("unsupported policy apiVersion %q", apiVersion)
+	}
+	kind, _, _ := unstructured.NestedString(policy, "kind")
+	if kind != "Policy" {
+		return fmt.Errorf("unsupported policy kind %q", kind)
+	}
+	rules, found, err := unstructured.NestedSlice(policy, "rules")
+	if err != nil {
+		return fmt.Errorf("invalid policy rules: %v", err)
+	}
+	if !found || len(rules) == 0 {
+		return fmt.Errorf("policy must have at least one rule")
+	}
+	for i, rule := range rules {
+		ruleMap, ok := rule.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("policy rule %d is not an object", i)
+		}
+		level, _ := ruleMap["level"].(string)
+		if !util.StringSliceContains(auditLevels, level) {
+			return fmt.Errorf("policy rule %d has invalid level %q", i, level)
+		}
+	}
+	return nil
+}
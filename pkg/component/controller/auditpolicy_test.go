@@ -0,0 +1,52 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAuditPolicy(t *testing.T) {
+	policy := func(apiVersion, kind string, rules ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"rules":      rules,
+		}
+	}
+	metadataRule := map[string]interface{}{"level": "Metadata"}
+
+	t.Run("valid_policy", func(t *testing.T) {
+		require.NoError(t, validateAuditPolicy(policy("audit.k8s.io/v1", "Policy", metadataRule)))
+	})
+	t.Run("empty_policy", func(t *testing.T) {
+		require.Error(t, validateAuditPolicy(nil))
+	})
+	t.Run("wrong_api_version", func(t *testing.T) {
+		require.Error(t, validateAuditPolicy(policy("v1", "Policy", metadataRule)))
+	})
+	t.Run("wrong_kind", func(t *testing.T) {
+		require.Error(t, validateAuditPolicy(policy("audit.k8s.io/v1", "ConfigMap", metadataRule)))
+	})
+	t.Run("no_rules", func(t *testing.T) {
+		require.Error(t, validateAuditPolicy(policy("audit.k8s.io/v1", "Policy")))
+	})
+	t.Run("invalid_level", func(t *testing.T) {
+		require.Error(t, validateAuditPolicy(policy("audit.k8s.io/v1", "Policy", map[string]interface{}{"level": "Everything"})))
+	})
+}
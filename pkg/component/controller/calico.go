@@ -63,6 +63,7 @@ type calicoConfig struct {
 	Overlay                    string
 	IPAutodetectionMethod      string
 	PullPolicy                 string
+	workloadSecurity
 }
 
 // NewCalico creates new Calico reconciler component
@@ -214,6 +215,8 @@ func (c *Calico) getConfig() (calicoConfig, error) {
 		Overlay:                    c.clusterConf.Spec.Network.Calico.Overlay,
 		IPAutodetectionMethod:      c.clusterConf.Spec.Network.Calico.IPAutodetectionMethod,
 		PullPolicy:                 c.clusterConf.Spec.Images.DefaultPullPolicy,
+
+		workloadSecurity: newWorkloadSecurity(c.clusterConf.Spec.WorkloadSecurity),
 	}
 
 	return config, nil
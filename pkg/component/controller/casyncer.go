@@ -54,6 +54,10 @@ func (c *CASyncer) Stop() error {
 }
 
 func writeCerts(caData v1beta1.CaResponse, k0sVars constant.CfgVars) error {
+	if err := writeAPICA(caData, k0sVars); err != nil {
+		return err
+	}
+
 	keyFile := filepath.Join(k0sVars.CertRootDir, "ca.key")
 	certFile := filepath.Join(k0sVars.CertRootDir, "ca.crt")
 
@@ -85,5 +89,20 @@ func writeCerts(caData v1beta1.CaResponse, k0sVars constant.CfgVars) error {
 	return nil
 }
 
+// writeAPICA writes the CA of the k0s API client certificates, so that all the controllers accept the same clients
+func writeAPICA(caData v1beta1.CaResponse, k0sVars constant.CfgVars) error {
+	keyFile := filepath.Join(k0sVars.CertRootDir, "k0s-api-ca.key")
+	certFile := filepath.Join(k0sVars.CertRootDir, "k0s-api-ca.crt")
+
+	if len(caData.APICACert) == 0 || (util.FileExists(keyFile) && util.FileExists(certFile)) {
+		return nil
+	}
+
+	if err := ioutil.WriteFile(keyFile, caData.APICAKey, constant.CertSecureMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certFile, caData.APICACert, constant.CertMode)
+}
+
 // Health-check interface
 func (c *CASyncer) Healthy() error { return nil }
@@ -23,10 +23,11 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
@@ -71,28 +72,49 @@ type Certificates struct {
 	CertManager certificate.Manager
 	ClusterSpec *config.ClusterSpec
 	K0sVars     constant.CfgVars
+	// ImportCACert and ImportCAKey are the paths of an externally provided cluster CA, used instead of generating one
+	ImportCACert string
+	ImportCAKey  string
+	// ImportCADir is a directory with externally provided CAs laid out like the k0s pki dir
+	ImportCADir string
 }
 
 // Init initializes the certificate component
 func (c *Certificates) Init() error {
+	// expired certificates would make the components crash-loop with TLS errors, fail early with a clear message instead
+	expired, err := certificate.FindExpired(c.K0sVars.CertRootDir, time.Now())
+	if err != nil {
+		logrus.Warnf("failed to check certificate expiry: %v", err)
+	}
+	if len(expired) > 0 {
+		return expiredCertificatesError(expired)
+	}
 
 	eg, _ := errgroup.WithContext(context.Background())
 	// Common CA
 	caCertPath := filepath.Join(c.K0sVars.CertRootDir, "ca.crt")
 	caCertKey := filepath.Join(c.K0sVars.CertRootDir, "ca.key")
 
+	if err := c.importCAs(); err != nil {
+		return err
+	}
 	if err := c.CertManager.EnsureCA("ca", "kubernetes-ca"); err != nil {
 		return err
 	}
 
 	// We need CA cert loaded to generate client configs
 	logrus.Debugf("CA key and cert exists, loading")
-	cert, err := ioutil.ReadFile(caCertPath)
+	cert, err := certificate.TrustBundle(caCertPath)
 	if err != nil {
 		return errors.Wrapf(err, "failed to read ca cert")
 	}
 	c.CACert = string(cert)
 
+	eg.Go(func() error {
+		// CA of the k0s API client certificates
+		return c.CertManager.EnsureCA("k0s-api-ca", "k0s-api-ca")
+	})
+
 	eg.Go(func() error {
 		// Front proxy CA
 		if err := c.CertManager.EnsureCA("front-proxy-ca", "kubernetes-front-proxy-ca"); err != nil {
@@ -126,7 +148,7 @@ func (c *Certificates) Init() error {
 		if err != nil {
 			return err
 		}
-		if err := kubeConfig(c.K0sVars.AdminKubeConfigPath, "https://localhost:6443", c.CACert, adminCert.Cert, adminCert.Key, "root"); err != nil {
+		if err := kubeConfig(c.K0sVars.AdminKubeConfigPath, c.ClusterSpec.API.LocalURL(), c.CACert, adminCert.Cert, adminCert.Key, "root"); err != nil {
 			return err
 		}
 
@@ -146,7 +168,7 @@ func (c *Certificates) Init() error {
 		if err != nil {
 			return err
 		}
-		if err := kubeConfig(c.K0sVars.KonnectivityKubeConfigPath, "https://localhost:6443", c.CACert, konnectivityCert.Cert, konnectivityCert.Key, constant.KonnectivityServerUser); err != nil {
+		if err := kubeConfig(c.K0sVars.KonnectivityKubeConfigPath, c.ClusterSpec.API.LocalURL(), c.CACert, konnectivityCert.Cert, konnectivityCert.Key, constant.KonnectivityServerUser); err != nil {
 			return err
 		}
 
@@ -167,7 +189,7 @@ func (c *Certificates) Init() error {
 			return err
 		}
 
-		return kubeConfig(filepath.Join(c.K0sVars.CertRootDir, "ccm.conf"), "https://localhost:6443", c.CACert, ccmCert.Cert, ccmCert.Key, constant.ApiserverUser)
+		return kubeConfig(filepath.Join(c.K0sVars.CertRootDir, "ccm.conf"), c.ClusterSpec.API.LocalURL(), c.CACert, ccmCert.Cert, ccmCert.Key, constant.ApiserverUser)
 	})
 
 	eg.Go(func() error {
@@ -183,7 +205,7 @@ func (c *Certificates) Init() error {
 			return err
 		}
 
-		return kubeConfig(filepath.Join(c.K0sVars.CertRootDir, "scheduler.conf"), "https://localhost:6443", c.CACert, schedulerCert.Cert, schedulerCert.Key, constant.SchedulerUser)
+		return kubeConfig(filepath.Join(c.K0sVars.CertRootDir, "scheduler.conf"), c.ClusterSpec.API.LocalURL(), c.CACert, schedulerCert.Cert, schedulerCert.Key, constant.SchedulerUser)
 	})
 
 	eg.Go(func() error {
@@ -198,23 +220,10 @@ func (c *Certificates) Init() error {
 		return err
 	})
 
-	hostnames := []string{
-		"kubernetes",
-		"kubernetes.default",
-		"kubernetes.default.svc",
-		"kubernetes.default.svc.cluster",
-		"kubernetes.svc.cluster.local",
-		"127.0.0.1",
-		"localhost",
-	}
-
-	hostnames = append(hostnames, c.ClusterSpec.API.Sans()...)
-
-	internalAPIAddress, err := c.ClusterSpec.Network.InternalAPIAddresses()
+	hostnames, err := APIServerSANs(c.ClusterSpec, c.K0sVars)
 	if err != nil {
 		return err
 	}
-	hostnames = append(hostnames, internalAPIAddress...)
 
 	eg.Go(func() error {
 		serverReq := certificate.Request{
@@ -247,8 +256,39 @@ func (c *Certificates) Init() error {
 	return eg.Wait()
 }
 
-// Run does nothing, the cert component only needs to be initialized
+// APIServerSANs returns the SANs of the kube-apiserver and k0s API serving certificates: the in-cluster names,
+// spec.api.sans, the addresses of the node, the internal service address and the SANs added with k0s config certs add-san
+func APIServerSANs(clusterSpec *config.ClusterSpec, k0sVars constant.CfgVars) ([]string, error) {
+	hostnames := []string{
+		"kubernetes",
+		"kubernetes.default",
+		"kubernetes.default.svc",
+		"kubernetes.default.svc.cluster",
+		"kubernetes.svc.cluster.local",
+		"127.0.0.1",
+		"localhost",
+	}
+
+	hostnames = append(hostnames, clusterSpec.API.Sans()...)
+
+	internalAPIAddress, err := clusterSpec.Network.InternalAPIAddresses()
+	if err != nil {
+		return nil, err
+	}
+	hostnames = append(hostnames, internalAPIAddress...)
+
+	extraSANs, err := certificate.ReadExtraSANs(k0sVars.CertRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the extra SANs: %v", err)
+	}
+	return append(hostnames, extraSANs...), nil
+}
+
+// Run restricts the permissions of the keys with the CIS hardening profile, otherwise the cert component only needs to be initialized
 func (c *Certificates) Run() error {
+	if c.ClusterSpec.Hardening.CIS() {
+		return restrictFilePermissions(c.K0sVars.CertRootDir)
+	}
 	return nil
 }
 
@@ -257,6 +297,40 @@ func (c *Certificates) Stop() error {
 	return nil
 }
 
+func expiredCertificatesError(expired []certificate.ExpiredCertificate) error {
+	renewCmd := "k0s config certs renew"
+	var certs []string
+	for _, cert := range expired {
+		certs = append(certs, cert.String())
+		if cert.IsCA {
+			renewCmd = "k0s config certs renew --force"
+		}
+	}
+	return fmt.Errorf("found expired certificates: %s. Stop k0s and run `%s` to renew them", strings.Join(certs, ", "), renewCmd)
+}
+
+// importCAs installs the externally provided CAs, either the cluster CA given with --ca-cert or all the CAs found in --ca-dir
+func (c *Certificates) importCAs() error {
+	if c.ImportCACert != "" {
+		return c.CertManager.ImportCA("ca", c.ImportCACert, c.ImportCAKey)
+	}
+	if c.ImportCADir == "" {
+		return nil
+	}
+	for _, name := range []string{"ca", "front-proxy-ca", "etcd/ca"} {
+		certPath := filepath.Join(c.ImportCADir, name+".crt")
+		keyPath := filepath.Join(c.ImportCADir, name+".key")
+		if !util.FileExists(certPath) && !util.FileExists(keyPath) {
+			continue
+		}
+		logrus.Infof("importing %s from %s", name, c.ImportCADir)
+		if err := c.CertManager.ImportCA(name, certPath, keyPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func kubeConfig(dest, url, caCert, clientCert, clientKey, owner string) error {
 	if util.FileExists(dest) {
 		return chownFile(dest, owner, constant.CertSecureMode)
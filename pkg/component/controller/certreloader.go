@@ -0,0 +1,176 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// certReloadInterval is how often the certificate files are checked for changes
+const certReloadInterval = 30 * time.Second
+
+// ComponentRestarter restarts a running component
+type ComponentRestarter interface {
+	Restart() error
+}
+
+// certReloadOrder is the order the components are restarted in, the storage first so that the API server can connect to it
+var certReloadOrder = []string{"etcd", "kube-apiserver", "konnectivity-server", "kube-controller-manager", "kube-scheduler", "k0s-api"}
+
+// certificateFiles returns the certificates and kubeconfigs each component reads on start
+func certificateFiles(k0sVars constant.CfgVars) map[string][]string {
+	return map[string][]string{
+		"etcd": {
+			filepath.Join(k0sVars.CertRootDir, "etcd", "server.crt"),
+			filepath.Join(k0sVars.CertRootDir, "etcd", "peer.crt"),
+		},
+		"kube-apiserver": {
+			filepath.Join(k0sVars.CertRootDir, "server.crt"),
+			filepath.Join(k0sVars.CertRootDir, "apiserver-kubelet-client.crt"),
+			filepath.Join(k0sVars.CertRootDir, "apiserver-etcd-client.crt"),
+			filepath.Join(k0sVars.CertRootDir, "front-proxy-client.crt"),
+		},
+		"konnectivity-server": {
+			filepath.Join(k0sVars.CertRootDir, "server.crt"),
+			k0sVars.KonnectivityKubeConfigPath,
+		},
+		"kube-controller-manager": {
+			filepath.Join(k0sVars.CertRootDir, "ccm.conf"),
+		},
+		"kube-scheduler": {
+			filepath.Join(k0sVars.CertRootDir, "scheduler.conf"),
+		},
+		"k0s-api": {
+			filepath.Join(k0sVars.CertRootDir, "k0s-api.crt"),
+			filepath.Join(k0sVars.CertRootDir, "k0s-api-ca.crt"),
+		},
+	}
+}
+
+// CertificateReloader restarts the control plane components when their certificates are renewed on disk, e.g. with `k0s certificate renew`
+type CertificateReloader struct {
+	K0sVars    constant.CfgVars
+	Components map[string]ComponentRestarter
+
+	L         *logrus.Entry
+	checksums map[string]string
+	stopCh    chan struct{}
+}
+
+// NewCertificateReloader creates the CertificateReloader component
+func NewCertificateReloader(k0sVars constant.CfgVars) *CertificateReloader {
+	return &CertificateReloader{
+		K0sVars:    k0sVars,
+		Components: make(map[string]ComponentRestarter),
+		L:          logrus.WithFields(logrus.Fields{"component": "certreloader"}),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Add registers a component to be restarted when its certificates change
+func (r *CertificateReloader) Add(name string, component ComponentRestarter) {
+	r.Components[name] = component
+}
+
+// Init records the current state of the certificates
+func (r *CertificateReloader) Init() error {
+	r.checksums = make(map[string]string)
+	for _, files := range certificateFiles(r.K0sVars) {
+		for _, f := range files {
+			r.checksums[f] = fileChecksum(f)
+		}
+	}
+	return nil
+}
+
+// Run checks the certificates periodically and restarts the components using the changed ones
+func (r *CertificateReloader) Run() error {
+	go func() {
+		ticker := time.NewTicker(certReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.reload()
+			case <-r.stopCh:
+				r.L.Info("certificate reloader done")
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reload restarts the components whose certificates have changed since the last check
+func (r *CertificateReloader) reload() {
+	changed := make(map[string]bool)
+	for f, checksum := range r.checksums {
+		if current := fileChecksum(f); current != checksum {
+			r.checksums[f] = current
+			changed[f] = true
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	files := certificateFiles(r.K0sVars)
+	for _, name := range certReloadOrder {
+		component, ok := r.Components[name]
+		if !ok {
+			continue
+		}
+		for _, f := range files[name] {
+			if changed[f] {
+				r.L.Infof("%s has changed, restarting %s", f, name)
+				if err := component.Restart(); err != nil {
+					r.L.Warnf("failed to restart %s: %v", name, err)
+				}
+				break
+			}
+		}
+	}
+}
+
+// Stop stops the reloader
+func (r *CertificateReloader) Stop() error {
+	close(r.stopCh)
+	return nil
+}
+
+// Healthy is a no-op health-check
+func (r *CertificateReloader) Healthy() error { return nil }
+
+func fileChecksum(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Debugf("failed to read %s: %v", path, err)
+		}
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+type fakeRestarter struct {
+	restarts int
+}
+
+func (f *fakeRestarter) Restart() error {
+	f.restarts++
+	return nil
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-certreloader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	k0sVars := constant.CfgVars{
+		CertRootDir:                dir,
+		KonnectivityKubeConfigPath: filepath.Join(dir, "konnectivity.conf"),
+	}
+	for _, f := range []string{"server.crt", "scheduler.conf", "konnectivity.conf"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, f), []byte("old"), 0644))
+	}
+
+	apiServer, konnectivity, scheduler := &fakeRestarter{}, &fakeRestarter{}, &fakeRestarter{}
+	r := NewCertificateReloader(k0sVars)
+	r.Add("kube-apiserver", apiServer)
+	r.Add("konnectivity-server", konnectivity)
+	r.Add("kube-scheduler", scheduler)
+	require.NoError(t, r.Init())
+
+	r.reload()
+	require.Equal(t, 0, apiServer.restarts+konnectivity.restarts+scheduler.restarts)
+
+	// the server cert is used by both the API server and konnectivity
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "server.crt"), []byte("new"), 0644))
+	r.reload()
+	require.Equal(t, 1, apiServer.restarts)
+	require.Equal(t, 1, konnectivity.restarts)
+	require.Equal(t, 0, scheduler.restarts)
+
+	// the changes are only acted on once
+	r.reload()
+	require.Equal(t, 1, apiServer.restarts)
+
+	// a certificate created later counts as a change too
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "konnectivity.conf"), []byte("new"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "apiserver-kubelet-client.crt"), []byte("new"), 0644))
+	r.reload()
+	require.Equal(t, 2, apiServer.restarts)
+	require.Equal(t, 2, konnectivity.restarts)
+	require.Equal(t, 0, scheduler.restarts)
+}
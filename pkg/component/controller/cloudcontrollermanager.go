@@ -0,0 +1,242 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// CloudControllerManager deploys the out-of-tree cloud controller manager of spec.extensions.cloudControllerManager
+type CloudControllerManager struct {
+	clusterSpec *config.ClusterSpec
+	k0sVars     constant.CfgVars
+}
+
+// cloudConfigDir is where the cloud config secret is mounted in the cloud controller manager pods
+const cloudConfigDir = "/etc/kubernetes/cloud-config"
+
+type cloudControllerManagerConfig struct {
+	Image      string
+	PullPolicy string
+	Args       []string
+	// CloudConfigSecret is the secret mounted to cloudConfigDir, empty if there's no cloud config
+	CloudConfigSecret string
+	// APIHost and APIPort are used instead of the kubernetes service, the cloud controller manager has to run before
+	// the nodes and their networking are initialized
+	APIHost string
+	APIPort int
+	workloadSecurity
+}
+
+// NewCloudControllerManager creates new cloud controller manager reconciler
+func NewCloudControllerManager(clusterSpec *config.ClusterSpec, k0sVars constant.CfgVars) *CloudControllerManager {
+	return &CloudControllerManager{
+		clusterSpec: clusterSpec,
+		k0sVars:     k0sVars,
+	}
+}
+
+// Init does currently nothing
+func (c *CloudControllerManager) Init() error {
+	return nil
+}
+
+// Run writes the cloud controller manager manifests, or removes them if it's not configured anymore
+func (c *CloudControllerManager) Run() error {
+	ccmDir := path.Join(c.k0sVars.ManifestsDir, "cloud-controller-manager")
+	if c.clusterSpec.CloudControllerManager() == nil {
+		if err := os.RemoveAll(ccmDir); err != nil {
+			return errors.Wrap(err, "failed to remove cloud controller manager manifests")
+		}
+		return nil
+	}
+	if err := util.InitDirectory(ccmDir, constant.ManifestsDirMode); err != nil {
+		return err
+	}
+
+	tw := util.TemplateWriter{
+		Name:     "cloud-controller-manager",
+		Template: cloudControllerManagerTemplate,
+		Data:     c.getConfig(),
+		Path:     filepath.Join(ccmDir, "cloud-controller-manager.yaml"),
+	}
+	if err := tw.Write(); err != nil {
+		return errors.Wrap(err, "error writing cloud controller manager manifests, will NOT retry")
+	}
+	return nil
+}
+
+func (c *CloudControllerManager) getConfig() cloudControllerManagerConfig {
+	spec := c.clusterSpec.CloudControllerManager()
+	args := map[string]string{
+		"cloud-provider":                  spec.Provider,
+		"leader-elect":                    "true",
+		"use-service-account-credentials": "true",
+		"bind-address":                    "127.0.0.1",
+	}
+	cfg := cloudControllerManagerConfig{
+		Image:            spec.Image,
+		PullPolicy:       c.clusterSpec.Images.DefaultPullPolicy,
+		APIHost:          c.clusterSpec.API.APIAddress(),
+		APIPort:          c.clusterSpec.API.APIPort(),
+		workloadSecurity: newWorkloadSecurity(c.clusterSpec.WorkloadSecurity),
+	}
+	if spec.CloudConfig != nil {
+		cfg.CloudConfigSecret = spec.CloudConfig.SecretName
+		args["cloud-config"] = path.Join(cloudConfigDir, spec.CloudConfigKey())
+	}
+	for name, value := range spec.ExtraArgs {
+		args[name] = value
+	}
+	for name, value := range args {
+		cfg.Args = append(cfg.Args, fmt.Sprintf("--%s=%s", name, value))
+	}
+	sort.Strings(cfg.Args)
+	return cfg
+}
+
+// Stop does currently nothing
+func (c *CloudControllerManager) Stop() error {
+	return nil
+}
+
+// Health-check interface
+func (c *CloudControllerManager) Healthy() error { return nil }
+
+const cloudControllerManagerTemplate = `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cloud-controller-manager
+  namespace: kube-system
+---
+# the cloud controller managers need wide access to the nodes, services and routes, the cloud provider docs bind
+# them to cluster-admin too
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:cloud-controller-manager
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: cloud-controller-manager
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: cloud-controller-manager:apiserver-authentication-reader
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: extension-apiserver-authentication-reader
+subjects:
+- kind: ServiceAccount
+  name: cloud-controller-manager
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cloud-controller-manager
+  namespace: kube-system
+  labels:
+    k8s-app: cloud-controller-manager
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      k8s-app: cloud-controller-manager
+  template:
+    metadata:
+      labels:
+        k8s-app: cloud-controller-manager
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/cloud-controller-manager: runtime/default
+{{- end }}
+    spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
+      serviceAccountName: cloud-controller-manager
+      priorityClassName: system-cluster-critical
+      # the nodes are tainted until the cloud controller manager initializes them, and the pod network may not be
+      # up before that
+      hostNetwork: true
+      tolerations:
+      - key: node.cloudprovider.kubernetes.io/uninitialized
+        value: "true"
+        effect: NoSchedule
+      - key: node.kubernetes.io/not-ready
+        effect: NoSchedule
+      - key: CriticalAddonsOnly
+        operator: Exists
+      affinity:
+        podAntiAffinity:
+          preferredDuringSchedulingIgnoredDuringExecution:
+          - weight: 100
+            podAffinityTerm:
+              topologyKey: kubernetes.io/hostname
+              labelSelector:
+                matchLabels:
+                  k8s-app: cloud-controller-manager
+      nodeSelector:
+        kubernetes.io/os: linux
+      containers:
+      - name: cloud-controller-manager
+        image: {{ .Image }}
+        imagePullPolicy: {{ .PullPolicy }}
+        args:
+{{- range .Args }}
+        - {{ . | quote }}
+{{- end }}
+        env:
+        - name: KUBERNETES_SERVICE_HOST
+          value: "{{ .APIHost }}"
+        - name: KUBERNETES_SERVICE_PORT
+          value: "{{ .APIPort }}"
+        resources:
+          requests:
+            cpu: 100m
+            memory: 50Mi
+{{- if .CloudConfigSecret }}
+        volumeMounts:
+        - name: cloud-config
+          mountPath: ` + cloudConfigDir + `
+          readOnly: true
+      volumes:
+      - name: cloud-config
+        secret:
+          secretName: {{ .CloudConfigSecret }}
+{{- end }}
+`
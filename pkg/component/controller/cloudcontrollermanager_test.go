@@ -0,0 +1,79 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestCloudControllerManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ccm")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	vars := constant.GetConfig(dir)
+
+	clusterConfig := config.DefaultClusterConfig(vars)
+	clusterConfig.Spec.API.Address = "10.0.0.1"
+	clusterConfig.Spec.Extensions = &config.ClusterExtensions{
+		CloudControllerManager: &config.CloudControllerManagerSpec{
+			Image:       "registry.k8s.io/provider-aws/cloud-controller-manager:v1.20.0",
+			Provider:    "aws",
+			CloudConfig: &config.CloudConfigSecretRef{SecretName: "aws-cloud-config"},
+			ExtraArgs:   map[string]string{"configure-cloud-routes": "false"},
+		},
+	}
+	require.Empty(t, clusterConfig.Validate())
+
+	ccm := NewCloudControllerManager(clusterConfig.Spec, vars)
+	assert.Equal(t, []string{
+		"--bind-address=127.0.0.1",
+		"--cloud-config=/etc/kubernetes/cloud-config/cloud.conf",
+		"--cloud-provider=aws",
+		"--configure-cloud-routes=false",
+		"--leader-elect=true",
+		"--use-service-account-credentials=true",
+	}, ccm.getConfig().Args)
+
+	require.NoError(t, ccm.Run())
+	manifestPath := filepath.Join(vars.ManifestsDir, "cloud-controller-manager", "cloud-controller-manager.yaml")
+	manifest, err := ioutil.ReadFile(manifestPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), "secretName: aws-cloud-config")
+	assert.Contains(t, string(manifest), `value: "10.0.0.1"`)
+
+	// the kubelets of all the profiles run with an external cloud provider
+	kubeletConfig, err := NewKubeletConfig(clusterConfig.Spec, vars)
+	require.NoError(t, err)
+	buf, err := kubeletConfig.run("10.96.0.10")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(buf.String(), "cloudProvider: external"))
+
+	// the manifests are removed with the cloud controller manager
+	clusterConfig.Spec.Extensions.CloudControllerManager = nil
+	require.NoError(t, ccm.Run())
+	_, err = os.Stat(manifestPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -28,6 +28,7 @@ import (
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/fips"
 	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
@@ -37,6 +38,7 @@ type Manager struct {
 	gid           int
 	K0sVars       constant.CfgVars
 	LogLevel      string
+	FIPS          bool
 	supervisor    supervisor.Supervisor
 	uid           int
 }
@@ -88,6 +90,9 @@ func (a *Manager) Run() error {
 		"v":                                a.LogLevel,
 	}
 
+	for name, value := range a.ClusterConfig.Spec.ControllerManager.Args() {
+		args[name] = value
+	}
 	for name, value := range a.ClusterConfig.Spec.ControllerManager.ExtraArgs {
 		if args[name] != "" && name != "profiling" {
 			return fmt.Errorf("cannot override kube-controller-manager flag: %s", name)
@@ -100,12 +105,20 @@ func (a *Manager) Run() error {
 	} else {
 		args["node-cidr-mask-size"] = "24"
 	}
+	a.ClusterConfig.Spec.FeatureGates.BuildArgs(args, config.ControllerManagerComponent)
 	a.ClusterConfig.Spec.Network.DualStack.EnableDualStackFeatureGate(args)
 	for name, value := range cmDefaultArgs {
 		if args[name] == "" {
 			args[name] = value
 		}
 	}
+	if a.FIPS {
+		for name, value := range fips.KubeArgs() {
+			if args[name] == "" {
+				args[name] = value
+			}
+		}
+	}
 	cmArgs := []string{}
 	for name, value := range args {
 		cmArgs = append(cmArgs, fmt.Sprintf("--%s=%s", name, value))
@@ -133,5 +146,10 @@ func (a *Manager) Stop() error {
 	return a.supervisor.Stop()
 }
 
+// Restart restarts kube-controller-manager so that it picks up a renewed kubeconfig
+func (a *Manager) Restart() error {
+	return a.supervisor.Restart()
+}
+
 // Health-check interface
 func (a *Manager) Healthy() error { return nil }
@@ -94,6 +94,12 @@ data:
           fallthrough in-addr.arpa ip6.arpa
         }
         prometheus :9153
+{{- if .Hosts }}
+        hosts {
+{{ .Hosts | trim | indent 10 }}
+          fallthrough
+        }
+{{- end }}
         forward . /etc/resolv.conf
         cache 30
         loop
@@ -122,7 +128,16 @@ spec:
     metadata:
       labels:
         k8s-app: kube-dns
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/coredns: runtime/default
+{{- end }}
     spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
       serviceAccountName: coredns
       tolerations:
         - key: "CriticalAddonsOnly"
@@ -237,6 +252,9 @@ type coreDNSConfig struct {
 	ClusterDomain string
 	Image         string
 	PullPolicy    string
+	// Hosts are the spec.hostAliases entries served by the hosts plugin
+	Hosts string
+	workloadSecurity
 }
 
 // NewCoreDNS creates new instance of CoreDNS component
@@ -321,6 +339,9 @@ func (c *CoreDNS) getConfig() (coreDNSConfig, error) {
 		ClusterDNSIP:  dns,
 		Image:         c.clusterConfig.Spec.Images.CoreDNS.URI(),
 		PullPolicy:    c.clusterConfig.Spec.Images.DefaultPullPolicy,
+		Hosts:         c.clusterConfig.Spec.HostAliases.HostsEntries(),
+
+		workloadSecurity: newWorkloadSecurity(c.clusterConfig.Spec.WorkloadSecurity),
 	}
 
 	return config, nil
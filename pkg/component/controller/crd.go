@@ -36,6 +36,10 @@ func NewCRD(s manifestsSaver) *CRD {
 
 var bundles = []string{
 	"helm",
+	"audit",
+	"attestation",
+	"images",
+	"applier",
 }
 
 // Init  (c CRD) Init() error {
@@ -18,8 +18,10 @@ package controller
 import (
 	"context"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
 	"sync/atomic"
@@ -29,15 +31,27 @@ import (
 	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
 	kubeutil "github.com/k0sproject/k0s/pkg/kubernetes"
+	"github.com/k0sproject/k0s/pkg/token"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	authorization "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/certificates/v1"
 	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	clientset "k8s.io/client-go/kubernetes"
 )
 
+// BootstrapTokenAnnotation records the ID of the join token a node has bootstrapped with
+const BootstrapTokenAnnotation = "k0s.k0sproject.io/bootstrap-token-id"
+
+const (
+	kubeletClientSignerName = "kubernetes.io/kube-apiserver-client-kubelet"
+	bootstrapUserPrefix     = "system:bootstrap:"
+	nodeUserPrefix          = "system:node:"
+)
+
 var kubeletServerUsages = []v1.KeyUsage{
 	v1.UsageKeyEncipherment,
 	v1.UsageDigitalSignature,
@@ -105,6 +119,14 @@ func (a *CSRApprover) Run() error {
 				if err != nil {
 					a.L.Warnf("CSR approval failed: %s", err.Error())
 				}
+				if err := a.recordJoinTokens(); err != nil {
+					a.L.Warnf("join token bookkeeping failed: %s", err.Error())
+				}
+				if a.tpmAttestation() {
+					if err := a.approveAttestedClientCSRs(); err != nil {
+						a.L.Warnf("kubelet client CSR approval failed: %s", err.Error())
+					}
+				}
 			case <-a.stopCh:
 				a.L.Info("CSR Approver done")
 				return
@@ -150,6 +172,13 @@ func (a *CSRApprover) approveCSR() error {
 				continue
 			}
 
+			if a.strict() {
+				if err := a.verifyNode(x509cr); err != nil {
+					a.L.Warnf("not approving csr %s: %v", csr.Name, err)
+					break
+				}
+			}
+
 			approved, err := a.authorize(&csr, recognizer.permission)
 			if err != nil {
 				a.L.Warningf("SubjectAccessReview failed: %s", err)
@@ -174,6 +203,213 @@ func (a *CSRApprover) approveCSR() error {
 	return nil
 }
 
+func (a *CSRApprover) strict() bool {
+	return a.ClusterConfig != nil && a.ClusterConfig.Spec.CSRApprover != nil && a.ClusterConfig.Spec.CSRApprover.Strict
+}
+
+// verifyNode checks that the node requesting the serving certificate is registered, requests only its own
+// addresses and has joined the cluster with a join token
+func (a *CSRApprover) verifyNode(x509cr *x509.CertificateRequest) error {
+	nodeName := strings.TrimPrefix(x509cr.Subject.CommonName, nodeUserPrefix)
+	node, err := a.clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("can't get node %s: %v", nodeName, err)
+	}
+	if err := verifySANs(node, x509cr); err != nil {
+		return err
+	}
+	return a.verifyJoinToken(node)
+}
+
+// verifySANs checks that all the requested SANs are registered addresses of the node
+func verifySANs(node *core.Node, x509cr *x509.CertificateRequest) error {
+	if len(x509cr.EmailAddresses) > 0 || len(x509cr.URIs) > 0 {
+		return fmt.Errorf("only DNS and IP SANs are allowed")
+	}
+
+	dnsNames := map[string]struct{}{}
+	ips := map[string]struct{}{}
+	for _, addr := range node.Status.Addresses {
+		switch addr.Type {
+		case core.NodeHostName, core.NodeInternalDNS, core.NodeExternalDNS:
+			dnsNames[addr.Address] = struct{}{}
+		case core.NodeInternalIP, core.NodeExternalIP:
+			if ip := net.ParseIP(addr.Address); ip != nil {
+				ips[ip.String()] = struct{}{}
+			}
+		}
+	}
+
+	for _, name := range x509cr.DNSNames {
+		if _, ok := dnsNames[name]; !ok {
+			return fmt.Errorf("DNS name %s is not an address of node %s", name, node.Name)
+		}
+	}
+	for _, ip := range x509cr.IPAddresses {
+		if _, ok := ips[ip.String()]; !ok {
+			return fmt.Errorf("IP address %s is not an address of node %s", ip, node.Name)
+		}
+	}
+	return nil
+}
+
+// verifyJoinToken checks that the node has obtained its client certificate with a join token. The ID of
+// the token is recorded on the node so that the check holds once the bootstrap CSR has been garbage collected.
+func (a *CSRApprover) verifyJoinToken(node *core.Node) error {
+	if node.Annotations[BootstrapTokenAnnotation] != "" {
+		return nil
+	}
+
+	tokenIDs, err := a.bootstrapTokenIDs()
+	if err != nil {
+		return err
+	}
+	tokenID, ok := tokenIDs[node.Name]
+	if !ok {
+		return fmt.Errorf("node %s has not joined with a join token", node.Name)
+	}
+	return a.recordJoinToken(node, tokenID)
+}
+
+// recordJoinTokens records the join token on the nodes which have joined since the last round, and applies
+// the labels and taints of the token to them
+func (a *CSRApprover) recordJoinTokens() error {
+	if !a.leaderElector.IsLeader() {
+		return nil
+	}
+
+	nodes, err := a.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("can't fetch nodes: %v", err)
+	}
+	var tokenIDs map[string]string
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if node.Annotations[BootstrapTokenAnnotation] != "" {
+			continue
+		}
+		// the CSRs are only fetched when there are new nodes
+		if tokenIDs == nil {
+			if tokenIDs, err = a.bootstrapTokenIDs(); err != nil {
+				return err
+			}
+		}
+		// nodes which did not join with a token, e.g. controllers running a worker, are left as is
+		if tokenID, ok := tokenIDs[node.Name]; ok {
+			if err := a.recordJoinToken(node, tokenID); err != nil {
+				a.L.Warnf("failed to record join token of node %s: %v", node.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bootstrapTokenIDs maps the nodes to the IDs of the join tokens they have obtained their client certificates with
+func (a *CSRApprover) bootstrapTokenIDs() (map[string]string, error) {
+	opts := metav1.ListOptions{
+		FieldSelector: "spec.signerName=" + kubeletClientSignerName,
+	}
+	csrs, err := a.clientset.CertificatesV1().CertificateSigningRequests().List(context.TODO(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch kubelet client CSRs: %v", err)
+	}
+
+	tokenIDs := make(map[string]string)
+	for _, csr := range csrs.Items {
+		if csr.Spec.SignerName != kubeletClientSignerName || !strings.HasPrefix(csr.Spec.Username, bootstrapUserPrefix) {
+			continue
+		}
+		if approved, denied := getCertApprovalCondition(&csr.Status); !approved || denied {
+			continue
+		}
+		x509cr, err := parseCSR(&csr)
+		if err != nil || !strings.HasPrefix(x509cr.Subject.CommonName, nodeUserPrefix) {
+			continue
+		}
+		tokenIDs[strings.TrimPrefix(x509cr.Subject.CommonName, nodeUserPrefix)] = strings.TrimPrefix(csr.Spec.Username, bootstrapUserPrefix)
+	}
+	return tokenIDs, nil
+}
+
+// recordJoinToken annotates the node with the ID of its join token and applies the labels and taints of the token.
+// The join is counted for the tokens limited to a number of uses. The token may have been deleted already, in which
+// case only the ID is recorded.
+func (a *CSRApprover) recordJoinToken(node *core.Node, tokenID string) error {
+	var metadata token.NodeMetadata
+	secret, err := a.clientset.CoreV1().Secrets("kube-system").Get(context.TODO(), "bootstrap-token-"+tokenID, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		metadata = token.FromSecret(*secret).Node
+	case !apierrors.IsNotFound(err):
+		return fmt.Errorf("can't get join token %s: %v", tokenID, err)
+	}
+
+	// counted before annotating the node, a failed annotation leads to counting the join again rather than never
+	if err == nil {
+		if err := token.NewManagerForClient(a.clientset).RecordUse(tokenID); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("can't count the use of join token %s: %v", tokenID, err)
+		}
+	}
+
+	patch, err := nodeJoinTokenPatch(node, tokenID, metadata)
+	if err != nil {
+		return err
+	}
+	_, err = a.clientset.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("can't annotate node %s: %v", node.Name, err)
+	}
+	if !metadata.IsEmpty() {
+		a.L.Infof("applied the labels and taints of join token %s to node %s", tokenID, node.Name)
+	}
+	return nil
+}
+
+// nodeJoinTokenPatch creates a merge patch recording the join token on the node and adding the labels and taints
+// of the token the node is missing. The taints are patched as a whole, so the patch is bound to the resource version.
+func nodeJoinTokenPatch(node *core.Node, tokenID string, metadata token.NodeMetadata) ([]byte, error) {
+	meta := map[string]interface{}{
+		"annotations": map[string]string{BootstrapTokenAnnotation: tokenID},
+	}
+	patch := map[string]interface{}{"metadata": meta}
+
+	if len(metadata.Labels) > 0 {
+		labels := make(map[string]string)
+		for _, label := range metadata.Labels {
+			key, value, err := token.ParseLabel(label)
+			if err != nil {
+				return nil, err
+			}
+			labels[key] = value
+		}
+		meta["labels"] = labels
+	}
+
+	taints := append([]core.Taint{}, node.Spec.Taints...)
+	for _, t := range metadata.Taints {
+		taint, err := token.ParseTaint(t)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, existing := range taints {
+			if existing.MatchTaint(&taint) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			taints = append(taints, taint)
+		}
+	}
+	if len(taints) > len(node.Spec.Taints) {
+		meta["resourceVersion"] = node.ResourceVersion
+		patch["spec"] = map[string]interface{}{"taints": taints}
+	}
+
+	return json.Marshal(patch)
+}
+
 func (a *CSRApprover) authorize(csr *v1.CertificateSigningRequest, rattrs authorization.ResourceAttributes) (bool, error) {
 	extra := make(map[string]authorization.ExtraValue)
 	for k, v := range csr.Spec.Extra {
@@ -221,7 +457,7 @@ func (a *CSRApprover) isNodeServingCert(csr *v1.CertificateSigningRequest, x509c
 		a.L.Info("Usage does not match")
 		return false
 	}
-	if !strings.HasPrefix(x509cr.Subject.CommonName, "system:node:") {
+	if !strings.HasPrefix(x509cr.Subject.CommonName, nodeUserPrefix) {
 		a.L.Warningf("CN does not start with 'system:node': %s", x509cr.Subject.CommonName)
 		return false
 	}
@@ -23,10 +23,12 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"net"
 	"testing"
 
 	"github.com/k0sproject/k0s/internal/testutil"
 	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/token"
 	"github.com/stretchr/testify/assert"
 	certv1 "k8s.io/api/certificates/v1"
 	core "k8s.io/api/core/v1"
@@ -84,6 +86,71 @@ func TestBasicCRSApprover(t *testing.T) {
 	}
 }
 
+func TestVerifySANs(t *testing.T) {
+	node := &core.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+		Status: core.NodeStatus{
+			Addresses: []core.NodeAddress{
+				{Type: core.NodeHostName, Address: "worker"},
+				{Type: core.NodeInternalIP, Address: "10.0.0.2"},
+			},
+		},
+	}
+
+	t.Run("own addresses are accepted", func(t *testing.T) {
+		cr := &x509.CertificateRequest{DNSNames: []string{"worker"}, IPAddresses: []net.IP{net.ParseIP("10.0.0.2")}}
+		assert.NoError(t, verifySANs(node, cr))
+	})
+	t.Run("foreign DNS name is rejected", func(t *testing.T) {
+		cr := &x509.CertificateRequest{DNSNames: []string{"kubernetes.default"}}
+		assert.Error(t, verifySANs(node, cr))
+	})
+	t.Run("foreign IP address is rejected", func(t *testing.T) {
+		cr := &x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("10.96.0.1")}}
+		assert.Error(t, verifySANs(node, cr))
+	})
+	t.Run("email SAN is rejected", func(t *testing.T) {
+		cr := &x509.CertificateRequest{DNSNames: []string{"worker"}, EmailAddresses: []string{"admin@example.com"}}
+		assert.Error(t, verifySANs(node, cr))
+	})
+}
+
+func TestVerifyJoinToken(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	client, err := fakeFactory.GetClient()
+	assert.NoError(t, err)
+	ctx := context.TODO()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	c := NewCSRApprover(&v1beta1.ClusterConfig{Spec: v1beta1.DefaultClusterSpec()}, &DummyLeaderElector{Leader: true}, fakeFactory)
+	assert.NoError(t, c.Init())
+
+	node, err := client.CoreV1().Nodes().Create(ctx, &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker"}}, v1.CreateOptions{})
+	assert.NoError(t, err)
+
+	assert.Error(t, c.verifyJoinToken(node), "node without a bootstrap CSR should not be verified")
+
+	clientCSR := &certv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-csr-worker"},
+		Spec: certv1.CertificateSigningRequestSpec{
+			Request:    pemWithTemplate(&x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}}}, privateKey),
+			SignerName: kubeletClientSignerName,
+			Username:   "system:bootstrap:abcdef",
+		},
+	}
+	appendApprovalCondition(clientCSR, "approved")
+	_, err = client.CertificatesV1().CertificateSigningRequests().Create(ctx, clientCSR, v1.CreateOptions{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.verifyJoinToken(node))
+
+	node, err = client.CoreV1().Nodes().Get(ctx, "worker", v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef", node.Annotations[BootstrapTokenAnnotation])
+}
+
 func pemWithPrivateKey(pk crypto.PrivateKey) []byte {
 	template := &x509.CertificateRequest{
 		Subject: pkix.Name{
@@ -112,3 +179,65 @@ func pemWithTemplate(template *x509.CertificateRequest, key crypto.PrivateKey) [
 
 	return p
 }
+
+func TestRecordJoinTokens(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	client, err := fakeFactory.GetClient()
+	assert.NoError(t, err)
+	ctx := context.TODO()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	c := NewCSRApprover(&v1beta1.ClusterConfig{Spec: &v1beta1.ClusterSpec{}}, &DummyLeaderElector{Leader: true}, fakeFactory)
+	assert.NoError(t, c.Init())
+
+	_, err = client.CoreV1().Nodes().Create(ctx, &core.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Labels: map[string]string{"kubernetes.io/os": "linux"}},
+		Spec: core.NodeSpec{
+			Taints: []core.Taint{{Key: "node.kubernetes.io/not-ready", Effect: core.TaintEffectNoSchedule}},
+		},
+	}, v1.CreateOptions{})
+	assert.NoError(t, err)
+	_, err = client.CoreV1().Nodes().Create(ctx, &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "controller"}}, v1.CreateOptions{})
+	assert.NoError(t, err)
+
+	_, err = client.CoreV1().Secrets("kube-system").Create(ctx, &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bootstrap-token-abcdef",
+			Namespace: "kube-system",
+			Annotations: map[string]string{
+				token.NodeLabelsAnnotation: "pool=edge",
+				token.NodeTaintsAnnotation: "dedicated=edge:NoSchedule",
+			},
+		},
+	}, v1.CreateOptions{})
+	assert.NoError(t, err)
+
+	clientCSR := &certv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-csr-worker"},
+		Spec: certv1.CertificateSigningRequestSpec{
+			Request:    pemWithTemplate(&x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}}}, privateKey),
+			SignerName: kubeletClientSignerName,
+			Username:   "system:bootstrap:abcdef",
+		},
+	}
+	appendApprovalCondition(clientCSR, "approved")
+	_, err = client.CertificatesV1().CertificateSigningRequests().Create(ctx, clientCSR, v1.CreateOptions{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.recordJoinTokens())
+
+	node, err := client.CoreV1().Nodes().Get(ctx, "worker", v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef", node.Annotations[BootstrapTokenAnnotation])
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "linux", "pool": "edge"}, node.Labels)
+	assert.Equal(t, []core.Taint{
+		{Key: "node.kubernetes.io/not-ready", Effect: core.TaintEffectNoSchedule},
+		{Key: "dedicated", Value: "edge", Effect: core.TaintEffectNoSchedule},
+	}, node.Spec.Taints)
+
+	node, err = client.CoreV1().Nodes().Get(ctx, "controller", v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, node.Annotations, "node joined without a token should be left as is")
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/internal/util"
 	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
@@ -36,6 +37,7 @@ import (
 	"github.com/k0sproject/k0s/pkg/certificate"
 	"github.com/k0sproject/k0s/pkg/constant"
 	"github.com/k0sproject/k0s/pkg/etcd"
+	"github.com/k0sproject/k0s/pkg/fips"
 	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
@@ -47,6 +49,9 @@ type Etcd struct {
 	JoinClient  *v1beta1.JoinClient
 	K0sVars     constant.CfgVars
 	LogLevel    string
+	FIPS        bool
+	// CIS applies the etcd settings of the CIS hardening profile
+	CIS bool
 
 	supervisor supervisor.Supervisor
 	uid        int
@@ -121,6 +126,12 @@ func (e *Etcd) Run() error {
 		"--peer-client-cert-auth=true",
 		"--enable-pprof=false",
 	}
+	if e.FIPS {
+		args = append(args, fips.EtcdArgs()...)
+	}
+	if e.CIS {
+		args = append(args, config.CISEtcdArgs...)
+	}
 
 	if util.FileExists(filepath.Join(e.K0sVars.EtcdDataDir, "member", "snap", "db")) {
 		logrus.Warnf("etcd db file(s) already exist, not gonna run join process")
@@ -129,15 +140,12 @@ func (e *Etcd) Run() error {
 
 	if e.Join {
 		var etcdResponse config.EtcdResponse
-		var err error
-		for i := 0; i < 20; i++ {
+		err := retry.Do(context.Background(), "join etcd", func() error {
 			logrus.Infof("trying to sync etcd config")
+			var err error
 			etcdResponse, err = e.JoinClient.JoinEtcd(peerURL)
-			if err == nil {
-				break
-			}
-			time.Sleep(500 * time.Millisecond)
-		}
+			return err
+		}, retry.Attempts(20), retry.Delay(500*time.Millisecond), retry.Factor(1.0))
 		if err != nil {
 			return err
 		}
@@ -170,6 +178,11 @@ func (e *Etcd) Run() error {
 	if err := e.setupCerts(); err != nil {
 		return errors.Wrap(err, "failed to create etcd certs")
 	}
+	if e.CIS {
+		if err := restrictFilePermissions(e.K0sVars.EtcdCertDir); err != nil {
+			return errors.Wrap(err, "failed to restrict etcd cert permissions")
+		}
+	}
 
 	logrus.Infof("starting etcd with args: %v", args)
 
@@ -253,6 +266,11 @@ func (e *Etcd) setupCerts() error {
 	return eg.Wait()
 }
 
+// Restart restarts etcd so that it picks up renewed certificates
+func (e *Etcd) Restart() error {
+	return e.supervisor.Restart()
+}
+
 // Health-check interface
 func (e *Etcd) Healthy() error {
 	logrus.WithField("component", "etcd").Debug("checking etcd endpoint for health")
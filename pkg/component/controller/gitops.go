@@ -0,0 +1,239 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	kubeutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+// gitOpsPollInterval is how often the CRDs of the GitOps provider are looked for
+const gitOpsPollInterval = 10 * time.Second
+
+// GitOps bootstraps the GitOps provider of spec.extensions.gitops. The provider itself is deployed as a helm
+// extension, once its CRDs are there the resources pointing it at the git repository are written to the gitops stack.
+type GitOps struct {
+	clusterSpec       *config.ClusterSpec
+	k0sVars           constant.CfgVars
+	kubeClientFactory kubeutil.ClientFactory
+	log               *logrus.Entry
+	cancel            context.CancelFunc
+}
+
+type gitOpsConfig struct {
+	Provider   string
+	Namespace  string
+	Repository string
+	Branch     string
+	Path       string
+	SecretRef  string
+	Interval   string
+}
+
+// gitOpsBootstrapKinds are the group versions and kinds of the bootstrap resources of the providers, which have to
+// be served before the resources can be applied
+var gitOpsBootstrapKinds = map[string]map[string]string{
+	config.GitOpsFlux: {
+		"source.toolkit.fluxcd.io/v1beta1":    "GitRepository",
+		"kustomize.toolkit.fluxcd.io/v1beta1": "Kustomization",
+	},
+	config.GitOpsArgoCD: {
+		"argoproj.io/v1alpha1": "Application",
+	},
+}
+
+// NewGitOps creates new GitOps bootstrap reconciler
+func NewGitOps(clusterSpec *config.ClusterSpec, k0sVars constant.CfgVars, kubeClientFactory kubeutil.ClientFactory) *GitOps {
+	return &GitOps{
+		clusterSpec:       clusterSpec,
+		k0sVars:           k0sVars,
+		kubeClientFactory: kubeClientFactory,
+		log:               logrus.WithField("component", "gitops"),
+	}
+}
+
+// Init does currently nothing
+func (g *GitOps) Init() error {
+	return nil
+}
+
+// Run writes the GitOps bootstrap manifests once the CRDs of the provider are served, or removes them if the
+// GitOps bootstrap isn't enabled anymore
+func (g *GitOps) Run() error {
+	gitOpsDir := path.Join(g.k0sVars.ManifestsDir, "gitops")
+	gitOps := g.clusterSpec.GitOps()
+	if gitOps == nil {
+		if err := os.RemoveAll(gitOpsDir); err != nil {
+			return errors.Wrap(err, "failed to remove GitOps manifests")
+		}
+		return nil
+	}
+
+	manifests, err := renderGitOps(gitOps)
+	if err != nil {
+		return errors.Wrap(err, "error rendering GitOps manifests, will NOT retry")
+	}
+
+	// manifests of a previous config would be applied to a provider which may be gone
+	manifestsFile := filepath.Join(gitOpsDir, "gitops.yaml")
+	if current, err := ioutil.ReadFile(manifestsFile); err == nil && !bytes.Equal(current, manifests) {
+		if err := os.Remove(manifestsFile); err != nil {
+			return errors.Wrap(err, "failed to remove outdated GitOps manifests")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	go func() {
+		err := wait.PollImmediateUntil(gitOpsPollInterval, func() (bool, error) {
+			return g.providerServed(gitOps.Provider), nil
+		}, ctx.Done())
+		if err != nil {
+			return
+		}
+		if err := util.InitDirectory(gitOpsDir, constant.ManifestsDirMode); err != nil {
+			g.log.WithError(err).Error("failed to create the GitOps manifests dir")
+			return
+		}
+		if err := ioutil.WriteFile(manifestsFile, manifests, 0644); err != nil {
+			g.log.WithError(err).Error("failed to write the GitOps manifests")
+			return
+		}
+		g.log.Infof("%s is up, bootstrapping it from %s", gitOps.Provider, gitOps.Repository)
+	}()
+	return nil
+}
+
+// providerServed tells if the kinds of the bootstrap resources of the provider are served by the API server
+func (g *GitOps) providerServed(provider string) bool {
+	client, err := g.kubeClientFactory.GetClient()
+	if err != nil {
+		return false
+	}
+	for groupVersion, kind := range gitOpsBootstrapKinds[provider] {
+		resources, err := client.Discovery().ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			return false
+		}
+		served := false
+		for _, resource := range resources.APIResources {
+			if resource.Kind == kind {
+				served = true
+			}
+		}
+		if !served {
+			return false
+		}
+	}
+	return true
+}
+
+func renderGitOps(gitOps *config.GitOpsSpec) ([]byte, error) {
+	tw := util.TemplateWriter{
+		Name:     "gitops",
+		Template: gitOpsTemplate,
+		Data: gitOpsConfig{
+			Provider:   gitOps.Provider,
+			Namespace:  gitOps.Namespace(),
+			Repository: gitOps.Repository,
+			Branch:     gitOps.BranchOrDefault(),
+			Path:       gitOps.PathOrDefault(),
+			SecretRef:  gitOps.SecretRef,
+			Interval:   gitOps.IntervalOrDefault(),
+		},
+	}
+	var buf bytes.Buffer
+	if err := tw.WriteToBuffer(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Stop stops waiting for the provider
+func (g *GitOps) Stop() error {
+	if g.cancel != nil {
+		g.cancel()
+	}
+	return nil
+}
+
+// Health-check interface
+func (g *GitOps) Healthy() error { return nil }
+
+const gitOpsTemplate = `
+{{- if eq .Provider "flux" }}
+apiVersion: source.toolkit.fluxcd.io/v1beta1
+kind: GitRepository
+metadata:
+  name: k0s-gitops
+  namespace: {{ .Namespace }}
+spec:
+  interval: {{ .Interval }}
+  url: {{ .Repository | quote }}
+  ref:
+    branch: {{ .Branch | quote }}
+{{- if .SecretRef }}
+  secretRef:
+    name: {{ .SecretRef | quote }}
+{{- end }}
+---
+apiVersion: kustomize.toolkit.fluxcd.io/v1beta1
+kind: Kustomization
+metadata:
+  name: k0s-gitops
+  namespace: {{ .Namespace }}
+spec:
+  interval: {{ .Interval }}
+  path: {{ .Path | quote }}
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: k0s-gitops
+{{- else }}
+# the credentials of the repository are registered in argocd-cm by the values of the argo-cd chart
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: k0s-gitops
+  namespace: {{ .Namespace }}
+spec:
+  project: default
+  source:
+    repoURL: {{ .Repository | quote }}
+    targetRevision: {{ .Branch | quote }}
+    path: {{ .Path | quote }}
+  destination:
+    server: https://kubernetes.default.svc
+  syncPolicy:
+    automated:
+      prune: true
+      selfHeal: true
+{{- end }}
+`
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+
+	"github.com/k0sproject/k0s/internal/testutil"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestRenderGitOpsFlux(t *testing.T) {
+	manifests, err := renderGitOps(&config.GitOpsSpec{
+		Provider:   config.GitOpsFlux,
+		Repository: "https://git.example.com/cluster.git",
+		Path:       "clusters/production",
+		SecretRef:  "git-credentials",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(manifests), `kind: GitRepository
+metadata:
+  name: k0s-gitops
+  namespace: flux-system
+spec:
+  interval: 1m
+  url: "https://git.example.com/cluster.git"
+  ref:
+    branch: "main"
+  secretRef:
+    name: "git-credentials"
+`)
+	assert.Contains(t, string(manifests), `path: "./clusters/production"`)
+	assert.NotContains(t, string(manifests), "argoproj.io")
+}
+
+func TestRenderGitOpsArgoCD(t *testing.T) {
+	manifests, err := renderGitOps(&config.GitOpsSpec{
+		Provider:   config.GitOpsArgoCD,
+		Repository: "https://git.example.com/cluster.git",
+		Branch:     "production",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(manifests), `  source:
+    repoURL: "https://git.example.com/cluster.git"
+    targetRevision: "production"
+    path: "./"
+`)
+	assert.NotContains(t, string(manifests), "fluxcd.io")
+}
+
+func TestGitOpsProviderServed(t *testing.T) {
+	fakes := testutil.NewFakeClientFactory()
+	g := NewGitOps(&config.ClusterSpec{}, constant.CfgVars{}, fakes)
+	assert.False(t, g.providerServed(config.GitOpsFlux))
+
+	discovery := fakes.Client.Discovery().(*discoveryfake.FakeDiscovery)
+	discovery.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "source.toolkit.fluxcd.io/v1beta1",
+		APIResources: []metav1.APIResource{{Name: "gitrepositories", Kind: "GitRepository"}},
+	}}
+	assert.False(t, g.providerServed(config.GitOpsFlux))
+
+	discovery.Resources = append(discovery.Resources, &metav1.APIResourceList{
+		GroupVersion: "kustomize.toolkit.fluxcd.io/v1beta1",
+		APIResources: []metav1.APIResource{{Name: "kustomizations", Kind: "Kustomization"}},
+	})
+	assert.True(t, g.providerServed(config.GitOpsFlux))
+	assert.False(t, g.providerServed(config.GitOpsArgoCD))
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cisFileMode is the mode the CIS benchmark recommends for the private keys and kubeconfigs of the control plane
+const cisFileMode = 0600
+
+// CISAuditPolicy is the audit policy used with the CIS hardening profile until the AuditPolicy object is created
+var CISAuditPolicy = []byte(`apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: Metadata
+`)
+
+// restrictFilePermissions makes the private keys and kubeconfigs under dir readable by their owner only. The
+// components read them as their owner, so the group read permission k0s grants by default is not needed.
+func restrictFilePermissions(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !(strings.HasSuffix(path, ".key") || strings.HasSuffix(path, ".conf")) {
+			return nil
+		}
+		if info.Mode().Perm() == cisFileMode {
+			return nil
+		}
+		logrus.Debugf("restricting permissions of %s", path)
+		return os.Chmod(path, cisFileMode)
+	})
+}
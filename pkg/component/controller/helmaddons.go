@@ -3,7 +3,10 @@ package controller
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -35,6 +38,7 @@ type HelmAddons struct {
 	informer          cache.SharedIndexInformer
 	helm              *helm.Commands
 	kubeConfig        string
+	manifestsDir      string
 	kubeClientFactory kubeutil.ClientFactory
 	leaderElector     LeaderElector
 }
@@ -48,6 +52,7 @@ func NewHelmAddons(c *k0sv1beta1.ClusterConfig, s manifestsSaver, k0sVars consta
 		stopCh:            make(chan struct{}),
 		helm:              helm.NewCommands(k0sVars),
 		kubeConfig:        k0sVars.AdminKubeConfigPath,
+		manifestsDir:      filepath.Join(k0sVars.ManifestsDir, "helm"),
 		kubeClientFactory: kubeClientFactory,
 		leaderElector:     leaderElector,
 	}
@@ -57,17 +62,20 @@ const (
 	operationAdd    = "add"
 	operationUpdate = "update"
 	operationDelete = "delete"
+	operationRepair = "repair"
 
 	namespaceToWatch = "kube-system"
+
+	// chartFinalizer keeps the deleted charts until their uninstall policy is applied
+	chartFinalizer = "helm.k0sproject.io/uninstall-policy"
+	// addonManifestPrefix is the prefix of the manifests of the charts in the helm stack
+	addonManifestPrefix = "addon_crd_manifest_"
 )
 
 // Run runs the helm controller
 func (h *HelmAddons) Run() error {
 	h.L.Info("run begin")
-	if h.ClusterConfig.Spec.Extensions == nil || h.ClusterConfig.Spec.Extensions.Helm == nil {
-		h.L.Info("No helm addons specified, do not run HelmAddons reconciler")
-		return nil
-	}
+	// the reconciler runs even without helm extensions, so that the uninstall policy of removed charts is applied
 	// TODO Can we use the shared kube client factory to create the clientset for helm CRDs?
 	client, err := clientset.NewForConfig(h.kubeConfig)
 	if err != nil {
@@ -90,14 +98,23 @@ func (h *HelmAddons) Run() error {
 	return nil
 }
 
+// extensions returns the helm extensions of the cluster config, empty if there are none
+func (h *HelmAddons) extensions() *k0sv1beta1.HelmExtensions {
+	if extensions := h.ClusterConfig.Spec.HelmExtensions(); extensions != nil {
+		return extensions
+	}
+	return &k0sv1beta1.HelmExtensions{}
+}
+
 func (h *HelmAddons) initHelm() error {
-	for _, repo := range h.ClusterConfig.Spec.Extensions.Helm.Repositories {
+	helmExtensions := h.extensions()
+	for _, repo := range helmExtensions.Repositories {
 		if err := h.addRepo(repo); err != nil {
 			return fmt.Errorf("can't init repository `%s`: %v", repo.URL, err)
 		}
 	}
 
-	for _, addon := range h.ClusterConfig.Spec.Extensions.Helm.Charts {
+	for _, addon := range helmExtensions.Charts {
 		tw := util.TemplateWriter{
 			Name:     "addon_crd_manifest",
 			Template: chartCrdTemplate,
@@ -108,10 +125,33 @@ func (h *HelmAddons) initHelm() error {
 			h.L.WithError(err).Errorf("can't render helm addon crd template")
 			return fmt.Errorf("can't create addon `%s`: %v", addon.ChartName, err)
 		}
-		if err := h.saver.Save("addon_crd_manifest_"+addon.Name+".yaml", buf.Bytes()); err != nil {
+		if err := h.saver.Save(addonManifestPrefix+addon.Name+".yaml", buf.Bytes()); err != nil {
 			return fmt.Errorf("can't save addon CRD manifest: %v", err)
 		}
 	}
+	return h.removeStaleAddons(helmExtensions)
+}
+
+// removeStaleAddons removes the manifests of the charts no longer in the cluster config. The applier then deletes
+// their Chart objects, which applies their uninstall policy.
+func (h *HelmAddons) removeStaleAddons(helmExtensions *k0sv1beta1.HelmExtensions) error {
+	configured := make(map[string]bool, len(helmExtensions.Charts))
+	for _, addon := range helmExtensions.Charts {
+		configured[addonManifestPrefix+addon.Name+".yaml"] = true
+	}
+	manifests, err := filepath.Glob(filepath.Join(h.manifestsDir, addonManifestPrefix+"*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, manifest := range manifests {
+		if configured[filepath.Base(manifest)] {
+			continue
+		}
+		h.L.Infof("Chart manifest %s is not in the cluster config anymore, removing it", filepath.Base(manifest))
+		if err := os.Remove(manifest); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("can't remove addon CRD manifest: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -150,6 +190,17 @@ func (h *HelmAddons) CrdControlLoop() {
 			old := oldObj.(*v1beta1.Chart)
 			new := newObj.(*v1beta1.Chart)
 
+			if new.DeletionTimestamp != nil {
+				// the chart is being deleted, the reconcile applies its uninstall policy
+				key, err := cache.MetaNamespaceKeyFunc(new)
+				if err != nil {
+					h.L.WithError(err).Warning("can't build cache key for queue object")
+					return
+				}
+				queue.Add(queueJob{key: key, operation: operationUpdate})
+				return
+			}
+
 			if old.Generation == new.Generation {
 				return
 			}
@@ -168,10 +219,17 @@ func (h *HelmAddons) CrdControlLoop() {
 
 		DeleteFunc: func(obj interface{}) {
 			chart := obj.(*v1beta1.Chart)
+			if chart.Status.Removal != "" || chart.Status.ReleaseName == "" {
+				// the uninstall policy was already applied before the finalizer was removed
+				return
+			}
 			queue.Add(queueJob{key: chart.Status.Namespace + "/" + chart.Status.ReleaseName, operation: operationDelete})
 		},
 	})
 	go h.informer.Run(h.stopCh)
+	if drift := h.extensions().DriftDetection; drift != nil {
+		go wait.Until(func() { h.detectDrift(queue, drift) }, drift.IntervalDuration(), h.stopCh)
+	}
 	wait.Until(func() {
 		for {
 			h.processMessage(queue)
@@ -196,7 +254,18 @@ func (h *HelmAddons) processMessage(q workqueue.RateLimitingInterface) {
 	case operationDelete:
 		err = h.uninstall(job.key)
 	case operationAdd, operationUpdate:
-		err = h.reconcile(job.key)
+		err = h.reconcile(job.key, false)
+	case operationRepair:
+		err = h.reconcile(job.key, h.extensions().DriftDetection.CorrectionOrDefault() == k0sv1beta1.DriftCorrectionForce)
+	}
+
+	var pending *dependencyPendingError
+	if errors.As(err, &pending) {
+		h.L.Infof("Chart %s is %v, retrying in %s", job.key, pending, chartDependencyRetryInterval)
+		h.saveError(err, job.key)
+		q.Forget(job)
+		q.AddAfter(job, chartDependencyRetryInterval)
+		return
 	}
 
 	if err != nil {
@@ -238,13 +307,14 @@ func (h *HelmAddons) uninstall(id string) error {
 		h.L.Info("dry run, doesn't uninstall")
 		return nil
 	}
-	if err := h.helm.UninstallRelease(releaseName, namespace); err != nil {
+	if err := h.helm.UninstallRelease(releaseName, namespace, false); err != nil {
 		return fmt.Errorf("can't uninstall release `%s`: %v", releaseName, err)
 	}
 	return nil
 }
 
-func (h *HelmAddons) reconcile(objectID string) error {
+// reconcile installs or upgrades the release of the chart, force replaces the changed resources on upgrade
+func (h *HelmAddons) reconcile(objectID string, force bool) error {
 
 	if !h.leaderElector.IsLeader() {
 		h.L.Info("dry run, doesn't reconcile")
@@ -256,13 +326,35 @@ func (h *HelmAddons) reconcile(objectID string) error {
 	if err != nil {
 		return fmt.Errorf("can't reconcile chart `%s`: %v", objectID, err)
 	}
+	if chart.DeletionTimestamp != nil {
+		return h.remove(context.Background(), chart)
+	}
+	if !hasFinalizer(chart) {
+		chart.Finalizers = append(chart.Finalizers, chartFinalizer)
+		if chart, err = h.Client.Charts(namespaceToWatch).Update(context.Background(), chart, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("can't add finalizer to chart `%s`: %v", objectID, err)
+		}
+	}
+	if err := h.checkDependencies(context.Background(), chart); err != nil {
+		return fmt.Errorf("can't reconcile chart `%s`: %w", objectID, err)
+	}
+	values, err := h.chartValues(chart.Spec)
+	if err != nil {
+		return fmt.Errorf("can't reconcile chart `%s`: %v", objectID, err)
+	}
+	opts, err := chartOptions(chart.Spec)
+	if err != nil {
+		return fmt.Errorf("can't reconcile chart `%s`: %v", objectID, err)
+	}
+	opts.Force = force
 	var release *release.Release
 	if chart.Status.ReleaseName == "" {
 		// new release
 		release, err = h.helm.InstallChart(chart.Spec.ChartName,
 			chart.Spec.Version,
 			chart.Spec.Namespace,
-			chart.Spec.YamlValues())
+			values,
+			opts)
 		if err != nil {
 			return fmt.Errorf("can't reconcile installation for `%s`: %v", objectID, err)
 		}
@@ -272,7 +364,8 @@ func (h *HelmAddons) reconcile(objectID string) error {
 			chart.Status.Version,
 			chart.Status.ReleaseName,
 			chart.Status.Namespace,
-			chart.Spec.YamlValues(),
+			values,
+			opts,
 		)
 		if err != nil {
 			return fmt.Errorf("can't reconcile upgrade for `%s`: %v", objectID, err)
@@ -286,6 +379,7 @@ func (h *HelmAddons) reconcile(objectID string) error {
 	chart.Status.Revision = int64(release.Version)
 	chart.Status.Namespace = release.Namespace
 	chart.Status.Error = ""
+	chart.Status.Drift = nil
 	_, err = h.Client.Charts(namespaceToWatch).UpdateStatus(context.Background(), chart, metav1.UpdateOptions{})
 	if err != nil {
 		return fmt.Errorf("can't update status for `%s`: %v", objectID, err)
@@ -293,7 +387,81 @@ func (h *HelmAddons) reconcile(objectID string) error {
 	return nil
 }
 
+// remove applies the uninstall policy of the deleted chart, records the decision in its status and lets it go
+func (h *HelmAddons) remove(ctx context.Context, chart *v1beta1.Chart) error {
+	if !hasFinalizer(chart) {
+		return nil
+	}
+	if chart.Status.ReleaseName != "" && chart.Status.Removal == "" {
+		var decision string
+		switch chart.Spec.UninstallPolicy {
+		case k0sv1beta1.UninstallPolicyOrphan:
+			decision = fmt.Sprintf("release %s/%s orphaned", chart.Status.Namespace, chart.Status.ReleaseName)
+		case k0sv1beta1.UninstallPolicyKeepCRDs:
+			if err := h.helm.UninstallRelease(chart.Status.ReleaseName, chart.Status.Namespace, true); err != nil {
+				return err
+			}
+			decision = fmt.Sprintf("release %s/%s uninstalled, CRDs kept", chart.Status.Namespace, chart.Status.ReleaseName)
+		default:
+			if err := h.helm.UninstallRelease(chart.Status.ReleaseName, chart.Status.Namespace, false); err != nil {
+				return err
+			}
+			decision = fmt.Sprintf("release %s/%s uninstalled", chart.Status.Namespace, chart.Status.ReleaseName)
+		}
+		h.L.Infof("Chart %s deleted: %s", chart.Name, decision)
+		chart.Status.Removal = decision + " at " + time.Now().UTC().Format(time.RFC3339)
+		updated, err := h.Client.Charts(namespaceToWatch).UpdateStatus(ctx, chart, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("can't update status for `%s`: %v", chart.Name, err)
+		}
+		chart = updated
+	}
+
+	finalizers := chart.Finalizers[:0]
+	for _, finalizer := range chart.Finalizers {
+		if finalizer != chartFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	chart.Finalizers = finalizers
+	if _, err := h.Client.Charts(namespaceToWatch).Update(ctx, chart, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("can't remove finalizer from chart `%s`: %v", chart.Name, err)
+	}
+	return nil
+}
+
+func hasFinalizer(chart *v1beta1.Chart) bool {
+	for _, finalizer := range chart.Finalizers {
+		if finalizer == chartFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// chartOptions returns the install and upgrade options of the chart
+func chartOptions(spec v1beta1.ChartSpec) (helm.ChartOptions, error) {
+	opts := helm.ChartOptions{
+		Atomic:       spec.Atomic,
+		Wait:         spec.Wait,
+		SkipCRDs:     spec.SkipCRDs,
+		DisableHooks: spec.DisableHooks,
+	}
+	if spec.Timeout != "" {
+		timeout, err := time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout %q: %v", spec.Timeout, err)
+		}
+		opts.Timeout = timeout
+	}
+	return opts, nil
+}
+
 func (h *HelmAddons) addRepo(repo k0sv1beta1.Repository) error {
+	repo, err := resolveRepositoryAuth(context.Background(), h.kubeClientFactory.GetClient, repo)
+	if err != nil {
+		return err
+	}
 	return h.helm.AddRepository(repo)
 }
 
@@ -309,6 +477,33 @@ spec:
 {{ .Values | nindent 4 }}
   version: {{ .Version }}
   namespace: {{ .TargetNS }}
+{{- if .ValuesFrom }}
+  valuesFrom:
+{{- range .ValuesFrom }}
+  - kind: {{ .Kind | quote }}
+    name: {{ .Name | quote }}
+    namespace: {{ .Namespace | quote }}
+    key: {{ .Key | quote }}
+    file: {{ .File | quote }}
+    optional: {{ .Optional }}
+{{- end }}
+{{- end }}
+{{- if .DependsOn }}
+  dependsOn:
+{{- range .DependsOn }}
+  - {{ printf "k0s-addon-chart-%s" . | quote }}
+{{- end }}
+{{- end }}
+{{- if .Timeout }}
+  timeout: {{ .Timeout | quote }}
+{{- end }}
+  atomic: {{ .Atomic }}
+  wait: {{ .Wait }}
+  skipCRDs: {{ .SkipCRDs }}
+  disableHooks: {{ .DisableHooks }}
+{{- if .UninstallPolicy }}
+  uninstallPolicy: {{ .UninstallPolicy | quote }}
+{{- end }}
 `
 
 // Run
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/apis/helm.k0sproject.io/v1beta1"
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/helm"
+)
+
+func TestChartCrdTemplateOptions(t *testing.T) {
+	tw := util.TemplateWriter{
+		Name:     "addon_crd_manifest",
+		Template: chartCrdTemplate,
+		Data: k0sv1beta1.Chart{
+			Name:      "app",
+			ChartName: "example/app",
+			Version:   "1.0.0",
+			TargetNS:  "apps",
+			Timeout:   "10m",
+			Atomic:    true,
+			SkipCRDs:  true,
+
+			UninstallPolicy: k0sv1beta1.UninstallPolicyOrphan,
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, tw.WriteToBuffer(&buf))
+
+	var chart v1beta1.Chart
+	require.NoError(t, yaml.NewYAMLOrJSONDecoder(&buf, buf.Len()).Decode(&chart))
+	opts, err := chartOptions(chart.Spec)
+	require.NoError(t, err)
+	assert.Equal(t, helm.ChartOptions{Timeout: 10 * time.Minute, Atomic: true, SkipCRDs: true}, opts)
+	assert.Equal(t, k0sv1beta1.UninstallPolicyOrphan, chart.Spec.UninstallPolicy)
+}
+
+func TestChartOptionsInvalidTimeout(t *testing.T) {
+	_, err := chartOptions(v1beta1.ChartSpec{Timeout: "ten minutes"})
+	assert.Error(t, err)
+}
+
+func TestRemoveStaleAddons(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-manifests")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"addon_crd_manifest_app.yaml", "addon_crd_manifest_removed.yaml", "helm.k0sproject.io_charts.yaml"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("---"), 0644))
+	}
+
+	h := &HelmAddons{L: logrus.NewEntry(logrus.StandardLogger()), manifestsDir: dir}
+	require.NoError(t, h.removeStaleAddons(&k0sv1beta1.HelmExtensions{Charts: []k0sv1beta1.Chart{{Name: "app"}}}))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{"addon_crd_manifest_app.yaml", "helm.k0sproject.io_charts.yaml"}, names)
+}
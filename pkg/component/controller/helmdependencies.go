@@ -0,0 +1,143 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/k0sproject/k0s/pkg/apis/helm.k0sproject.io/v1beta1"
+)
+
+// chartDependencyRetryInterval is how often a chart waiting for its dependencies is retried
+const chartDependencyRetryInterval = 10 * time.Second
+
+// dependencyPendingError tells that a dependency of the chart isn't deployed and ready yet. The chart is retried
+// until it is, instead of giving up after maxRetries.
+type dependencyPendingError struct {
+	Dependency string
+	Reason     string
+}
+
+func (e *dependencyPendingError) Error() string {
+	return fmt.Sprintf("waiting for chart %s: %s", e.Dependency, e.Reason)
+}
+
+// checkDependencies checks that the releases of the charts the chart depends on are deployed and ready
+func (h *HelmAddons) checkDependencies(ctx context.Context, chart *v1beta1.Chart) error {
+	if len(chart.Spec.DependsOn) == 0 {
+		return nil
+	}
+	client, err := h.kubeClientFactory.GetClient()
+	if err != nil {
+		return err
+	}
+	for _, name := range chart.Spec.DependsOn {
+		dependency, err := h.Client.Charts(namespaceToWatch).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return &dependencyPendingError{Dependency: name, Reason: "chart not found"}
+		}
+		if err != nil {
+			return err
+		}
+		if dependency.Status.Error != "" {
+			return &dependencyPendingError{Dependency: name, Reason: dependency.Status.Error}
+		}
+		if dependency.Status.ReleaseName == "" {
+			return &dependencyPendingError{Dependency: name, Reason: "not installed yet"}
+		}
+		rel, err := h.helm.GetRelease(dependency.Status.ReleaseName, dependency.Status.Namespace)
+		if err != nil {
+			return &dependencyPendingError{Dependency: name, Reason: err.Error()}
+		}
+		if rel.Info.Status != release.StatusDeployed {
+			return &dependencyPendingError{Dependency: name, Reason: fmt.Sprintf("release %s is %s", rel.Name, rel.Info.Status)}
+		}
+		if err := releaseReady(ctx, client, rel); err != nil {
+			return &dependencyPendingError{Dependency: name, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// releaseReady checks that the deployments, stateful sets and daemon sets of the release are rolled out and ready
+func releaseReady(ctx context.Context, client kubernetes.Interface, rel *release.Release) error {
+	for _, manifest := range releaseutil.SplitManifests(rel.Manifest) {
+		var object struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(manifest), &object); err != nil || object.APIVersion != "apps/v1" {
+			continue
+		}
+		name, namespace := object.Metadata.Name, object.Metadata.Namespace
+		if namespace == "" {
+			namespace = rel.Namespace
+		}
+
+		var ready bool
+		switch object.Kind {
+		case "Deployment":
+			deployment, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			replicas := replicasOrDefault(deployment.Spec.Replicas)
+			ready = deployment.Status.ObservedGeneration >= deployment.Generation &&
+				deployment.Status.UpdatedReplicas >= replicas &&
+				deployment.Status.AvailableReplicas >= replicas
+		case "StatefulSet":
+			statefulSet, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			ready = statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+				statefulSet.Status.ReadyReplicas >= replicasOrDefault(statefulSet.Spec.Replicas)
+		case "DaemonSet":
+			daemonSet, err := client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			ready = daemonSet.Status.ObservedGeneration >= daemonSet.Generation &&
+				daemonSet.Status.NumberReady >= daemonSet.Status.DesiredNumberScheduled
+		default:
+			continue
+		}
+		if !ready {
+			return fmt.Errorf("%s %s/%s is not ready", object.Kind, namespace, name)
+		}
+	}
+	return nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
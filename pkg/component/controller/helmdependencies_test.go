@@ -0,0 +1,95 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/k0sproject/k0s/internal/util"
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+const releaseManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+# Source: app/templates/daemonset.yaml
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: monitoring
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`
+
+func TestReleaseReady(t *testing.T) {
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "apps", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+	}
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "monitoring", Generation: 1},
+		Status:     appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, NumberReady: 3},
+	}
+	client := fake.NewSimpleClientset(deployment, daemonSet)
+	rel := &release.Release{Name: "app", Namespace: "apps", Manifest: releaseManifest}
+
+	assert.EqualError(t, releaseReady(context.Background(), client, rel), "Deployment apps/app is not ready")
+
+	deployment.Status.AvailableReplicas = 2
+	_, err := client.AppsV1().Deployments("apps").UpdateStatus(context.Background(), deployment, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.NoError(t, releaseReady(context.Background(), client, rel))
+
+	require.NoError(t, client.AppsV1().DaemonSets("monitoring").Delete(context.Background(), "agent", metav1.DeleteOptions{}))
+	assert.Error(t, releaseReady(context.Background(), client, rel))
+}
+
+func TestChartCrdTemplateDependsOn(t *testing.T) {
+	tw := util.TemplateWriter{
+		Name:     "addon_crd_manifest",
+		Template: chartCrdTemplate,
+		Data: k0sv1beta1.Chart{
+			Name:      "app",
+			ChartName: "example/app",
+			Version:   "1.0.0",
+			TargetNS:  "apps",
+			DependsOn: []string{"cert-manager"},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, tw.WriteToBuffer(&buf))
+	assert.Contains(t, buf.String(), "  dependsOn:\n  - \"k0s-addon-chart-cert-manager\"\n")
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/k0sproject/k0s/pkg/apis/helm.k0sproject.io/v1beta1"
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+// detectDrift checks the releases of the charts for resources changed or deleted outside of helm, reports the drift
+// in the status of the charts and queues the drifted charts for repair if a correction is configured
+func (h *HelmAddons) detectDrift(queue workqueue.Interface, drift *k0sv1beta1.HelmDriftDetection) {
+	if !h.leaderElector.IsLeader() {
+		return
+	}
+	ctx := context.Background()
+	for _, obj := range h.informer.GetStore().List() {
+		chart := obj.(*v1beta1.Chart)
+		if chart.Status.ReleaseName == "" || chart.Status.Error != "" {
+			continue
+		}
+		drifted, err := h.chartDrift(ctx, chart)
+		if err != nil {
+			h.L.WithError(err).Warnf("can't check the drift of chart %s", chart.Name)
+			continue
+		}
+		if err := h.saveDrift(ctx, chart.Name, drifted); err != nil {
+			h.L.WithError(err).Warnf("can't save the drift of chart %s", chart.Name)
+		}
+		if len(drifted) == 0 || drift.CorrectionOrDefault() == k0sv1beta1.DriftCorrectionNone {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(chart)
+		if err != nil {
+			h.L.WithError(err).Warning("can't build cache key for queue object")
+			continue
+		}
+		h.L.Infof("Release %s of chart %s drifted, correcting it with %s", chart.Status.ReleaseName, chart.Name, drift.CorrectionOrDefault())
+		queue.Add(queueJob{key: key, operation: operationRepair})
+	}
+}
+
+func (h *HelmAddons) chartDrift(ctx context.Context, chart *v1beta1.Chart) ([]string, error) {
+	rel, err := h.helm.GetRelease(chart.Status.ReleaseName, chart.Status.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := h.kubeClientFactory.GetDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := h.kubeClientFactory.GetDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	return releaseDrift(ctx, dynamicClient, restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient), rel)
+}
+
+func (h *HelmAddons) saveDrift(ctx context.Context, name string, drifted []string) error {
+	chart, err := h.Client.Charts(namespaceToWatch).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	chart.Status.Drift = drifted
+	chart.Status.DriftChecked = time.Now().String()
+	_, err = h.Client.Charts(namespaceToWatch).UpdateStatus(ctx, chart, metav1.UpdateOptions{})
+	return err
+}
+
+// releaseDrift compares the resources in the manifest of the release with the cluster. A resource has drifted if
+// it's missing or any field set in the manifest has a different value in the cluster, the fields not set in the
+// manifest, like defaults, are ignored.
+func releaseDrift(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, rel *release.Release) ([]string, error) {
+	manifests := releaseutil.SplitManifests(rel.Manifest)
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var drifted []string
+	for _, key := range keys {
+		data, err := utilyaml.ToJSON([]byte(manifests[key]))
+		if err != nil {
+			return nil, err
+		}
+		desired := &unstructured.Unstructured{}
+		if err := json.Unmarshal(data, &desired.Object); err != nil || desired.Object == nil || desired.GetKind() == "" {
+			continue
+		}
+		gvk := desired.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		namespace := ""
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace = desired.GetNamespace()
+			if namespace == "" {
+				namespace = rel.Namespace
+			}
+		}
+		resourceName := gvk.Kind + " " + desired.GetName()
+		if namespace != "" {
+			resourceName = gvk.Kind + " " + namespace + "/" + desired.GetName()
+		}
+
+		live, err := client.Resource(mapping.Resource).Namespace(namespace).Get(ctx, desired.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			drifted = append(drifted, resourceName+" is missing")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		delete(desired.Object, "status")
+		if gvk.Group == "" && gvk.Kind == "Secret" {
+			normalizeSecretData(desired.Object)
+		}
+		if fields := fieldDrift("", desired.Object, live.Object); len(fields) > 0 {
+			drifted = append(drifted, fmt.Sprintf("%s changed: %s", resourceName, strings.Join(fields, ", ")))
+		}
+	}
+	return drifted, nil
+}
+
+// fieldDrift returns the paths of the fields of desired which are different in live
+func fieldDrift(path string, desired, live interface{}) []string {
+	switch desired := desired.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		live, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{path}
+		}
+		keys := make([]string, 0, len(desired))
+		for key := range desired {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var fields []string
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			fields = append(fields, fieldDrift(fieldPath, desired[key], live[key])...)
+		}
+		return fields
+	case []interface{}:
+		live, ok := live.([]interface{})
+		if !ok || len(live) != len(desired) {
+			return []string{path}
+		}
+		var fields []string
+		for i := range desired {
+			fields = append(fields, fieldDrift(fmt.Sprintf("%s[%d]", path, i), desired[i], live[i])...)
+		}
+		return fields
+	default:
+		if scalarEqual(desired, live) {
+			return nil
+		}
+		return []string{path}
+	}
+}
+
+// scalarEqual compares the values the way the API server normalizes them, e.g. 0.5 CPUs is returned as 500m and
+// an int-or-string port 80 may be written as "80"
+func scalarEqual(desired, live interface{}) bool {
+	if reflect.DeepEqual(desired, live) {
+		return true
+	}
+	if live == nil {
+		return false
+	}
+	d, l := fmt.Sprint(desired), fmt.Sprint(live)
+	if d == l {
+		return true
+	}
+	dq, err := resource.ParseQuantity(d)
+	if err != nil {
+		return false
+	}
+	lq, err := resource.ParseQuantity(l)
+	return err == nil && dq.Cmp(lq) == 0
+}
+
+// normalizeSecretData moves the stringData of the Secret into its data, as the API server does
+func normalizeSecretData(secret map[string]interface{}) {
+	stringData, ok := secret["stringData"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	data, ok := secret["data"].(map[string]interface{})
+	if !ok {
+		data = make(map[string]interface{}, len(stringData))
+	}
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+	}
+	secret["data"] = data
+	delete(secret, "stringData")
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const driftManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: example/app:1.0.0
+        resources:
+          requests:
+            cpu: 0.5
+---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+stringData:
+  password: secret
+---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  key: value
+`
+
+func TestReleaseDrift(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "apps", "annotations": map[string]interface{}{"meta.helm.sh/release-name": "app"}},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{
+					"name":                     "app",
+					"image":                    "example/app:1.0.0",
+					"imagePullPolicy":          "IfNotPresent",
+					"resources":                map[string]interface{}{"requests": map[string]interface{}{"cpu": "500m"}},
+					"terminationMessagePolicy": "File",
+				}},
+			}},
+		},
+	}}
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "apps"},
+		"data":       map[string]interface{}{"password": "c2VjcmV0"},
+	}}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment, secret)
+	rel := &release.Release{Name: "app", Namespace: "apps", Manifest: driftManifest}
+
+	drifted, err := releaseDrift(context.Background(), client, mapper, rel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ConfigMap apps/app is missing"}, drifted)
+
+	require.NoError(t, unstructured.SetNestedField(deployment.Object, int64(5), "spec", "replicas"))
+	require.NoError(t, unstructured.SetNestedField(secret.Object, "b3RoZXI=", "data", "password"))
+	deploymentsResource := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	_, err = client.Resource(deploymentsResource).Namespace("apps").Update(context.Background(), deployment, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}).Namespace("apps").Update(context.Background(), secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	drifted, err = releaseDrift(context.Background(), client, mapper, rel)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"ConfigMap apps/app is missing",
+		"Deployment apps/app changed: spec.replicas",
+		"Secret apps/app changed: data.password",
+	}, drifted)
+}
+
+func TestFieldDrift(t *testing.T) {
+	desired := map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"port": float64(80), "targetPort": "8080"}},
+		"mode":  "a",
+		"unset": nil,
+	}
+	live := map[string]interface{}{
+		"ports": []interface{}{map[string]interface{}{"port": int64(80), "targetPort": int64(8080), "protocol": "TCP"}},
+		"mode":  "a",
+		"extra": true,
+	}
+	assert.Empty(t, fieldDrift("", desired, live))
+
+	live["mode"] = "b"
+	live["ports"] = []interface{}{}
+	assert.Equal(t, []string{"mode", "ports"}, fieldDrift("", desired, live))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/helm"
+)
+
+// resolveRepositoryAuth fills in the username and password of the repository from the docker config.json its auth
+// refers to, either a file on the controller or a kubernetes.io/dockerconfigjson Secret in kube-system
+func resolveRepositoryAuth(ctx context.Context, getClient func() (kubernetes.Interface, error), repo k0sv1beta1.Repository) (k0sv1beta1.Repository, error) {
+	if repo.Auth == nil {
+		return repo, nil
+	}
+	u, err := url.Parse(repo.URL)
+	if err != nil {
+		return repo, err
+	}
+
+	var data []byte
+	if repo.Auth.File != "" {
+		if data, err = ioutil.ReadFile(repo.Auth.File); err != nil {
+			return repo, fmt.Errorf("can't read the credentials of repository %s: %v", repo.Name, err)
+		}
+	} else {
+		client, err := getClient()
+		if err != nil {
+			return repo, err
+		}
+		secret, err := client.CoreV1().Secrets(namespaceToWatch).Get(ctx, repo.Auth.SecretRef, metav1.GetOptions{})
+		if err != nil {
+			return repo, fmt.Errorf("can't read the credentials of repository %s: %v", repo.Name, err)
+		}
+		data = secret.Data[corev1.DockerConfigJsonKey]
+	}
+
+	if repo.Username, repo.Password, err = helm.CredentialsFromDockerConfig(data, u.Host); err != nil {
+		return repo, fmt.Errorf("can't read the credentials of repository %s: %v", repo.Name, err)
+	}
+	return repo, nil
+}
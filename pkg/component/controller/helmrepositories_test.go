@@ -0,0 +1,61 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+func TestResolveRepositoryAuth(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-creds", Namespace: "kube-system"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths": {"registry.example.com": {"username": "user", "password": "pass"}}}`),
+		},
+	})
+	getClient := func() (kubernetes.Interface, error) { return client, nil }
+
+	repo, err := resolveRepositoryAuth(context.Background(), getClient, k0sv1beta1.Repository{
+		Name: "private",
+		URL:  "oci://registry.example.com/charts",
+		Auth: &k0sv1beta1.RegistryAuth{SecretRef: "registry-creds"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "user", repo.Username)
+	assert.Equal(t, "pass", repo.Password)
+
+	_, err = resolveRepositoryAuth(context.Background(), getClient, k0sv1beta1.Repository{
+		Name: "other",
+		URL:  "https://charts.example.com",
+		Auth: &k0sv1beta1.RegistryAuth{SecretRef: "registry-creds"},
+	})
+	assert.EqualError(t, err, "can't read the credentials of repository other: no credentials for charts.example.com found in the docker config")
+
+	repo, err = resolveRepositoryAuth(context.Background(), getClient, k0sv1beta1.Repository{Name: "public", URL: "https://charts.example.com"})
+	require.NoError(t, err)
+	assert.Empty(t, repo.Username)
+}
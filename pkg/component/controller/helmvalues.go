@@ -0,0 +1,146 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/k0sproject/k0s/pkg/apis/helm.k0sproject.io/v1beta1"
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+// defaultValuesKey is the key of the values in a referenced Secret or ConfigMap if none is given
+const defaultValuesKey = "values.yaml"
+
+// chartValues returns the values of the chart, the ones referenced by valuesFrom merged in order and the inline
+// values on top of them
+func (h *HelmAddons) chartValues(spec v1beta1.ChartSpec) (map[string]interface{}, error) {
+	if len(spec.ValuesFrom) == 0 {
+		return spec.YamlValues(), nil
+	}
+	client, err := h.kubeClientFactory.GetClient()
+	if err != nil {
+		return nil, err
+	}
+	return resolveChartValues(context.Background(), client, spec)
+}
+
+func resolveChartValues(ctx context.Context, client kubernetes.Interface, spec v1beta1.ChartSpec) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, ref := range spec.ValuesFrom {
+		data, err := readValuesReference(ctx, client, ref)
+		if err != nil {
+			if ref.Optional {
+				continue
+			}
+			return nil, err
+		}
+		refValues := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &refValues); err != nil {
+			return nil, fmt.Errorf("invalid values in %s: %v", describeValuesReference(ref), err)
+		}
+		values = mergeValues(values, v1beta1.CleanUpGenericMap(refValues))
+	}
+	return mergeValues(values, spec.YamlValues()), nil
+}
+
+// readValuesReference reads the values referenced by ref
+func readValuesReference(ctx context.Context, client kubernetes.Interface, ref v1beta1.ValuesReference) ([]byte, error) {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = namespaceToWatch
+	}
+	key := ref.Key
+	if key == "" {
+		key = defaultValuesKey
+	}
+
+	switch ref.Kind {
+	case k0sv1beta1.ValuesFromSecret:
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, valuesReferenceError(ref, err)
+		}
+		if data, ok := secret.Data[key]; ok {
+			return data, nil
+		}
+	case k0sv1beta1.ValuesFromConfigMap:
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, valuesReferenceError(ref, err)
+		}
+		if data, ok := configMap.Data[key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := configMap.BinaryData[key]; ok {
+			return data, nil
+		}
+	case "":
+		data, err := ioutil.ReadFile(ref.File)
+		if err != nil {
+			return nil, valuesReferenceError(ref, err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported values reference kind %q", ref.Kind)
+	}
+	return nil, fmt.Errorf("%s has no key %s", describeValuesReference(ref), key)
+}
+
+func valuesReferenceError(ref v1beta1.ValuesReference, err error) error {
+	if apierrors.IsNotFound(err) || os.IsNotExist(err) {
+		return fmt.Errorf("%s not found", describeValuesReference(ref))
+	}
+	return fmt.Errorf("can't read %s: %v", describeValuesReference(ref), err)
+}
+
+func describeValuesReference(ref v1beta1.ValuesReference) string {
+	if ref.Kind == "" {
+		return "values file " + ref.File
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = namespaceToWatch
+	}
+	return fmt.Sprintf("%s %s/%s", ref.Kind, namespace, ref.Name)
+}
+
+// mergeValues deep merges override into base, the maps are merged key by key, any other value of override replaces
+// the one in base
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		if baseMap, ok := merged[k].(map[string]interface{}); ok {
+			if overrideMap, ok := v.(map[string]interface{}); ok {
+				merged[k] = mergeValues(baseMap, overrideMap)
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
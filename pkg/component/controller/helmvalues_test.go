@@ -0,0 +1,85 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/k0sproject/k0s/pkg/apis/helm.k0sproject.io/v1beta1"
+)
+
+func TestResolveChartValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-values")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	valuesFile := filepath.Join(dir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(valuesFile, []byte("replicas: 3\nimage:\n  tag: file\n"), 0600))
+
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "kube-system"},
+			Data:       map[string]string{"values.yaml": "replicas: 1\nimage:\n  repository: example/app\n  tag: configmap\n"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "apps"},
+			Data:       map[string][]byte{"creds": []byte("auth:\n  password: secret\n")},
+		},
+	)
+
+	spec := v1beta1.ChartSpec{
+		Values: "image:\n  tag: inline\n",
+		ValuesFrom: []v1beta1.ValuesReference{
+			{Kind: "ConfigMap", Name: "defaults"},
+			{Kind: "Secret", Name: "credentials", Namespace: "apps", Key: "creds"},
+			{File: valuesFile},
+			{Kind: "Secret", Name: "missing", Optional: true},
+		},
+	}
+	values, err := resolveChartValues(context.Background(), client, spec)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"replicas": 3,
+		"image": map[string]interface{}{
+			"repository": "example/app",
+			"tag":        "inline",
+		},
+		"auth": map[string]interface{}{
+			"password": "secret",
+		},
+	}, values)
+
+	t.Run("missing", func(t *testing.T) {
+		spec := v1beta1.ChartSpec{ValuesFrom: []v1beta1.ValuesReference{{Kind: "Secret", Name: "missing"}}}
+		_, err := resolveChartValues(context.Background(), client, spec)
+		assert.EqualError(t, err, "Secret kube-system/missing not found")
+	})
+
+	t.Run("missing_key", func(t *testing.T) {
+		spec := v1beta1.ChartSpec{ValuesFrom: []v1beta1.ValuesReference{{Kind: "ConfigMap", Name: "defaults", Key: "other.yaml"}}}
+		_, err := resolveChartValues(context.Background(), client, spec)
+		assert.EqualError(t, err, "ConfigMap kube-system/defaults has no key other.yaml")
+	})
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+// K0sAPICASecretName is the kube-system secret holding the CA of the k0s API client certificates shared by all the controllers
+const K0sAPICASecretName = "k0s-api-ca"
+
+// K0sAPICA makes all the controllers use the same CA for the k0s API client certificates, so a client certificate
+// issued by one controller is accepted by all of them. The leader publishes its CA as the kube-system/k0s-api-ca
+// secret if there's none yet, the other controllers replace theirs with the published one. The CA a controller
+// replaces stays trusted as k0s-api-ca-previous.crt, so the client certificates it has issued keep working.
+type K0sAPICA struct {
+	K0sVars constant.CfgVars
+
+	L *logrus.Entry
+
+	leaderElector     LeaderElector
+	stopCh            chan struct{}
+	kubeClientFactory k8sutil.ClientFactory
+}
+
+// NewK0sAPICA creates new k0s API CA syncer
+func NewK0sAPICA(k0sVars constant.CfgVars, leaderElector LeaderElector, kubeClientFactory k8sutil.ClientFactory) *K0sAPICA {
+	return &K0sAPICA{
+		K0sVars:           k0sVars,
+		leaderElector:     leaderElector,
+		stopCh:            make(chan struct{}),
+		kubeClientFactory: kubeClientFactory,
+		L:                 logrus.WithFields(logrus.Fields{"component": "k0sapica"}),
+	}
+}
+
+// Init does nothing
+func (k *K0sAPICA) Init() error {
+	return nil
+}
+
+// Run runs the main loop syncing the CA
+func (k *K0sAPICA) Run() error {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := k.reconcile(); err != nil {
+					k.L.Warnf("k0s API CA sync failed: %s", err.Error())
+				}
+			case <-k.stopCh:
+				k.L.Info("k0s API CA syncer done")
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the syncer
+func (k *K0sAPICA) Stop() error {
+	close(k.stopCh)
+	return nil
+}
+
+// Healthy dummy implementation
+func (k *K0sAPICA) Healthy() error { return nil }
+
+func (k *K0sAPICA) reconcile() error {
+	c, err := k.kubeClientFactory.GetClient()
+	if err != nil {
+		return err
+	}
+	secrets := c.CoreV1().Secrets("kube-system")
+	secret, err := secrets.Get(context.TODO(), K0sAPICASecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if !k.leaderElector.IsLeader() {
+			k.L.Debug("we're not the leader, not publishing the k0s API CA")
+			return nil
+		}
+		return k.publish(secrets)
+	}
+	if err != nil {
+		return err
+	}
+	return k.adopt(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+}
+
+// publish creates the secret out of the CA of this controller
+func (k *K0sAPICA) publish(secrets corev1client.SecretInterface) error {
+	cert, err := ioutil.ReadFile(filepath.Join(k.K0sVars.CertRootDir, "k0s-api-ca.crt"))
+	if err != nil {
+		return err
+	}
+	key, err := ioutil.ReadFile(filepath.Join(k.K0sVars.CertRootDir, "k0s-api-ca.key"))
+	if err != nil {
+		return err
+	}
+	_, err = secrets.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: K0sAPICASecretName},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       cert,
+			corev1.TLSPrivateKeyKey: key,
+		},
+	}, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// another controller was faster, its CA is adopted on the next round
+		return nil
+	}
+	if err == nil {
+		k.L.Info("published the k0s API CA")
+	}
+	return err
+}
+
+// adopt replaces the CA of this controller with the published one, keeping the replaced certificate trusted
+func (k *K0sAPICA) adopt(cert, key []byte) error {
+	if len(cert) == 0 || len(key) == 0 {
+		k.L.Warnf("kube-system/%s secret has no CA, not adopting it", K0sAPICASecretName)
+		return nil
+	}
+	certFile := filepath.Join(k.K0sVars.CertRootDir, "k0s-api-ca.crt")
+	keyFile := filepath.Join(k.K0sVars.CertRootDir, "k0s-api-ca.key")
+	current, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, cert) {
+		return nil
+	}
+
+	previousFile := filepath.Join(k.K0sVars.CertRootDir, "k0s-api-ca-previous.crt")
+	if err := ioutil.WriteFile(previousFile, current, constant.CertMode); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyFile, key, constant.CertSecureMode); err != nil {
+		return err
+	}
+	// the certificate is written last, the k0s API is restarted once it changes
+	if err := ioutil.WriteFile(certFile, cert, constant.CertMode); err != nil {
+		return err
+	}
+	k.L.Info("adopted the k0s API CA shared by the controllers")
+	return nil
+}
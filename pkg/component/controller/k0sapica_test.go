@@ -0,0 +1,79 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/k0sproject/k0s/internal/testutil"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func apiCADir(t *testing.T, ca string) string {
+	dir, err := ioutil.TempDir("", "k0s-api-ca")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "k0s-api-ca.crt"), []byte(ca+" cert"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "k0s-api-ca.key"), []byte(ca+" key"), 0600))
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestK0sAPICASharesTheLeaderCA(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	leaderDir, followerDir := apiCADir(t, "leader"), apiCADir(t, "follower")
+	defer os.RemoveAll(leaderDir)
+	defer os.RemoveAll(followerDir)
+
+	follower := NewK0sAPICA(constant.CfgVars{CertRootDir: followerDir}, &DummyLeaderElector{Leader: false}, fakeFactory)
+	leader := NewK0sAPICA(constant.CfgVars{CertRootDir: leaderDir}, &DummyLeaderElector{Leader: true}, fakeFactory)
+
+	// nothing is published until there's a leader
+	require.NoError(t, follower.reconcile())
+	assert.Equal(t, "follower cert", readFile(t, filepath.Join(followerDir, "k0s-api-ca.crt")))
+
+	require.NoError(t, leader.reconcile())
+	client, err := fakeFactory.GetClient()
+	require.NoError(t, err)
+	secret, err := client.CoreV1().Secrets("kube-system").Get(context.TODO(), K0sAPICASecretName, v1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "leader cert", string(secret.Data[corev1.TLSCertKey]))
+	assert.Equal(t, "leader key", string(secret.Data[corev1.TLSPrivateKeyKey]))
+
+	require.NoError(t, follower.reconcile())
+	assert.Equal(t, "leader cert", readFile(t, filepath.Join(followerDir, "k0s-api-ca.crt")))
+	assert.Equal(t, "leader key", readFile(t, filepath.Join(followerDir, "k0s-api-ca.key")))
+	assert.Equal(t, "follower cert", readFile(t, filepath.Join(followerDir, "k0s-api-ca-previous.crt")))
+
+	// the sync is idempotent, the previous CA isn't overwritten with the shared one
+	require.NoError(t, follower.reconcile())
+	require.NoError(t, leader.reconcile())
+	assert.Equal(t, "follower cert", readFile(t, filepath.Join(followerDir, "k0s-api-ca-previous.crt")))
+	assert.NoFileExists(t, filepath.Join(leaderDir, "k0s-api-ca-previous.crt"))
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+// K0sAPIService publishes the k0s API of the controllers as the kube-system/k0s-api service. The controllers that
+// can't reach the k0s API directly join through the Kubernetes API service proxy of it.
+// The endpoints are the ones of the default/kubernetes service, i.e. the API servers or the external address.
+type K0sAPIService struct {
+	ClusterConfig *config.ClusterConfig
+
+	L *logrus.Entry
+
+	leaderElector     LeaderElector
+	stopCh            chan struct{}
+	kubeClientFactory k8sutil.ClientFactory
+}
+
+// NewK0sAPIService creates new k0s API service reconciler
+func NewK0sAPIService(c *config.ClusterConfig, leaderElector LeaderElector, kubeClientFactory k8sutil.ClientFactory) *K0sAPIService {
+	return &K0sAPIService{
+		ClusterConfig:     c,
+		leaderElector:     leaderElector,
+		stopCh:            make(chan struct{}),
+		kubeClientFactory: kubeClientFactory,
+		L:                 logrus.WithFields(logrus.Fields{"component": "k0sapiservice"}),
+	}
+}
+
+// Init does nothing
+func (k *K0sAPIService) Init() error {
+	return nil
+}
+
+// Run runs the main loop reconciling the service endpoints
+func (k *K0sAPIService) Run() error {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := k.reconcile(); err != nil {
+					k.L.Warnf("k0s API service reconciliation failed: %s", err.Error())
+				}
+			case <-k.stopCh:
+				k.L.Info("k0s API service reconciler done")
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the reconciler
+func (k *K0sAPIService) Stop() error {
+	close(k.stopCh)
+	return nil
+}
+
+// Healthy dummy implementation
+func (k *K0sAPIService) Healthy() error { return nil }
+
+func (k *K0sAPIService) reconcile() error {
+	if !k.leaderElector.IsLeader() {
+		k.L.Debug("we're not the leader, not reconciling the k0s API service")
+		return nil
+	}
+
+	c, err := k.kubeClientFactory.GetClient()
+	if err != nil {
+		return err
+	}
+	port := int32(k.ClusterConfig.Spec.API.JoinAPIPort())
+
+	if err := k.ensureService(c, port); err != nil {
+		return err
+	}
+
+	apiEndpoints, err := c.CoreV1().Endpoints("default").Get(context.TODO(), "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	subsets := k0sAPISubsets(apiEndpoints, port)
+
+	epClient := c.CoreV1().Endpoints("kube-system")
+	ep, err := epClient.Get(context.TODO(), config.K0sAPIServiceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = epClient.Create(context.TODO(), &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: config.K0sAPIServiceName},
+			Subsets:    subsets,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(ep.Subsets, subsets) {
+		return nil
+	}
+	ep.Subsets = subsets
+	_, err = epClient.Update(context.TODO(), ep, metav1.UpdateOptions{})
+	return err
+}
+
+func (k *K0sAPIService) ensureService(c kubernetes.Interface, port int32) error {
+	svcClient := c.CoreV1().Services("kube-system")
+	svc, err := svcClient.Get(context.TODO(), config.K0sAPIServiceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// no selector, the endpoints are managed by the reconciler
+		_, err = svcClient.Create(context.TODO(), &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: config.K0sAPIServiceName},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{k0sAPIServicePort(port)},
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if len(svc.Spec.Ports) == 1 && svc.Spec.Ports[0].Port == port {
+		return nil
+	}
+	svc.Spec.Ports = []corev1.ServicePort{k0sAPIServicePort(port)}
+	_, err = svcClient.Update(context.TODO(), svc, metav1.UpdateOptions{})
+	return err
+}
+
+func k0sAPIServicePort(port int32) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       "https",
+		Protocol:   corev1.ProtocolTCP,
+		Port:       port,
+		TargetPort: intstr.FromInt(int(port)),
+	}
+}
+
+// k0sAPISubsets maps the addresses of the Kubernetes API endpoints to the k0s API port
+func k0sAPISubsets(apiEndpoints *corev1.Endpoints, port int32) []corev1.EndpointSubset {
+	var addresses []corev1.EndpointAddress
+	for _, subset := range apiEndpoints.Subsets {
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, corev1.EndpointAddress{IP: address.IP})
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+	return []corev1.EndpointSubset{{
+		Addresses: addresses,
+		Ports: []corev1.EndpointPort{{
+			Name:     "https",
+			Protocol: corev1.ProtocolTCP,
+			Port:     port,
+		}},
+	}}
+}
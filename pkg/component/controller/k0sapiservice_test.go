@@ -0,0 +1,83 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/k0sproject/k0s/internal/testutil"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestK0sAPIServiceMirrorsAPIEndpoints(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	client, err := fakeFactory.GetClient()
+	require.NoError(t, err)
+	_, err = client.CoreV1().Endpoints("default").Create(context.TODO(), &corev1.Endpoints{
+		ObjectMeta: v1.ObjectMeta{Name: "kubernetes"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+			Ports:     []corev1.EndpointPort{{Name: "https", Port: 6443}},
+		}},
+	}, v1.CreateOptions{})
+	require.NoError(t, err)
+
+	config := &v1beta1.ClusterConfig{
+		Spec: &v1beta1.ClusterSpec{
+			API: &v1beta1.APISpec{
+				Address:    "10.0.0.1",
+				K0sAPIPort: 8443,
+			},
+		},
+	}
+	k := NewK0sAPIService(config, &DummyLeaderElector{Leader: true}, fakeFactory)
+	require.NoError(t, k.reconcile())
+
+	svc, err := client.CoreV1().Services("kube-system").Get(context.TODO(), "k0s-api", v1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(8443), svc.Spec.Ports[0].Port)
+	assert.Equal(t, "https", svc.Spec.Ports[0].Name)
+
+	ep, err := client.CoreV1().Endpoints("kube-system").Get(context.TODO(), "k0s-api", v1.GetOptions{})
+	require.NoError(t, err)
+	require.Len(t, ep.Subsets, 1)
+	assert.Equal(t, []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}, ep.Subsets[0].Addresses)
+	assert.Equal(t, int32(8443), ep.Subsets[0].Ports[0].Port)
+
+	// the reconciliation is idempotent
+	require.NoError(t, k.reconcile())
+}
+
+func TestK0sAPIServiceWithNoLeader(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	config := &v1beta1.ClusterConfig{
+		Spec: &v1beta1.ClusterSpec{
+			API: &v1beta1.APISpec{Address: "10.0.0.1"},
+		},
+	}
+	k := NewK0sAPIService(config, &DummyLeaderElector{Leader: false}, fakeFactory)
+	require.NoError(t, k.reconcile())
+
+	client, err := fakeFactory.GetClient()
+	require.NoError(t, err)
+	_, err = client.CoreV1().Services("kube-system").Get(context.TODO(), "k0s-api", v1.GetOptions{})
+	assert.Error(t, err)
+}
@@ -29,7 +29,10 @@ type K0SControlAPI struct {
 	ConfigPath    string
 	ClusterConfig *config.ClusterConfig
 	K0sVars       constant.CfgVars
-	supervisor    supervisor.Supervisor
+	FIPS          bool
+	// ExpandEnv makes the API expand the environment variable references in the config like the controller
+	ExpandEnv  bool
+	supervisor supervisor.Supervisor
 }
 
 // Init does currently nothing
@@ -46,16 +49,23 @@ func (m *K0SControlAPI) Run() error {
 	if err != nil {
 		return err
 	}
+	args := []string{
+		"api",
+		fmt.Sprintf("--config=%s", m.ConfigPath),
+		fmt.Sprintf("--data-dir=%s", m.K0sVars.DataDir),
+	}
+	if m.FIPS {
+		args = append(args, "--fips")
+	}
+	if m.ExpandEnv {
+		args = append(args, "--expand-env")
+	}
 	m.supervisor = supervisor.Supervisor{
 		Name:    "k0s-control-api",
 		BinPath: selfExe,
 		RunDir:  m.K0sVars.RunDir,
 		DataDir: m.K0sVars.DataDir,
-		Args: []string{
-			"api",
-			fmt.Sprintf("--config=%s", m.ConfigPath),
-			fmt.Sprintf("--data-dir=%s", m.K0sVars.DataDir),
-		},
+		Args:    args,
 	}
 
 	return m.supervisor.Supervise()
@@ -66,5 +76,10 @@ func (m *K0SControlAPI) Stop() error {
 	return m.supervisor.Stop()
 }
 
+// Restart restarts the k0s API so that it picks up renewed certificates
+func (m *K0SControlAPI) Restart() error {
+	return m.supervisor.Restart()
+}
+
 // Healthy for health-check interface
 func (m *K0SControlAPI) Healthy() error { return nil }
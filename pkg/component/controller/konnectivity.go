@@ -111,8 +111,8 @@ func (k *Konnectivity) defaultArgs() util.MappedArgs {
 		"--kubeconfig":              k.K0sVars.KonnectivityKubeConfigPath,
 		"--mode":                    "grpc",
 		"--server-port":             "0",
-		"--agent-port":              "8132",
-		"--admin-port":              "8133",
+		"--agent-port":              strconv.Itoa(k.ClusterConfig.Spec.Konnectivity.AgentPortOrDefault()),
+		"--admin-port":              strconv.Itoa(k.ClusterConfig.Spec.Konnectivity.AdminPortOrDefault()),
 		"--agent-namespace":         "kube-system",
 		"--agent-service-account":   "konnectivity-agent",
 		"--authentication-audience": "system:konnectivity-server",
@@ -174,10 +174,20 @@ func (k *Konnectivity) Stop() error {
 	return k.supervisor.Stop()
 }
 
+// Restart restarts konnectivity-server so that it picks up renewed certificates
+func (k *Konnectivity) Restart() error {
+	if k.supervisor == nil {
+		return nil
+	}
+	return k.supervisor.Restart()
+}
+
 type konnectivityAgentConfig struct {
 	APIAddress string
+	AgentPort  int
 	Image      string
 	PullPolicy string
+	workloadSecurity
 }
 
 func (k *Konnectivity) writeKonnectivityAgent() error {
@@ -192,8 +202,11 @@ func (k *Konnectivity) writeKonnectivityAgent() error {
 		Template: konnectivityAgentTemplate,
 		Data: konnectivityAgentConfig{
 			APIAddress: k.ClusterConfig.Spec.API.APIAddress(),
+			AgentPort:  k.ClusterConfig.Spec.Konnectivity.AgentPortOrDefault(),
 			Image:      k.ClusterConfig.Spec.Images.Konnectivity.URI(),
 			PullPolicy: k.ClusterConfig.Spec.Images.DefaultPullPolicy,
+
+			workloadSecurity: newWorkloadSecurity(k.ClusterConfig.Spec.WorkloadSecurity),
 		},
 		Path: filepath.Join(konnectivityDir, "konnectivity-agent.yaml"),
 	}
@@ -291,7 +304,16 @@ spec:
     metadata:
       labels:
         k8s-app: konnectivity-agent
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/konnectivity-agent: runtime/default
+{{- end }}
     spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
       nodeSelector:
         kubernetes.io/os: linux
       priorityClassName: system-cluster-critical
@@ -309,7 +331,7 @@ spec:
                   # Since the konnectivity server runs with hostNetwork=true,
                   # this is the IP address of the master machine.
                   "--proxy-server-host={{ .APIAddress }}",
-                  "--proxy-server-port=8132",
+                  "--proxy-server-port={{ .AgentPort }}",
                   "--service-account-token-path=/var/run/secrets/tokens/konnectivity-agent-token"
                   ]
           volumeMounts:
@@ -67,6 +67,13 @@ func (k *KubeletConfig) Run() error {
 		return fmt.Errorf("failed to get DNS address for kubelet config: %v", err)
 	}
 
+	if errs := k.validate(dnsAddress); len(errs) > 0 {
+		for _, err := range errs {
+			k.log.Error(err)
+		}
+		return fmt.Errorf("worker profiles would break the worker nodes, not updating kubelet configs")
+	}
+
 	manifest, err := k.run(dnsAddress)
 	if err != nil {
 		return fmt.Errorf("failed to build final manifest: %v", err)
@@ -84,12 +91,16 @@ func (k *KubeletConfig) run(dnsAddress string) (*bytes.Buffer, error) {
 	clientCAFile := filepath.Join(k.k0sVars.CertRootDir, "ca.crt")
 	volumePluginDir := k.k0sVars.KubeletVolumePluginDir
 	defaultProfile := getDefaultProfile(dnsAddress, clientCAFile, volumePluginDir, k.clusterSpec.Network.DualStack.Enabled)
+	applyFeatureGates(defaultProfile, k.clusterSpec.FeatureGates)
+	applyHardening(defaultProfile, k.clusterSpec.Hardening)
 	winClientCAFile := k.k0sVars.WindowsCertRootDir + "\\ca.crt"
 	winDefaultProfile := getDefaultProfile(dnsAddress, winClientCAFile, volumePluginDir, k.clusterSpec.Network.DualStack.Enabled)
-	if err := k.writeConfigMapWithProfile(manifest, "default", defaultProfile); err != nil {
+	applyFeatureGates(winDefaultProfile, k.clusterSpec.FeatureGates)
+	applyHardening(winDefaultProfile, k.clusterSpec.Hardening)
+	if err := k.writeConfigMapWithProfile(manifest, "default", defaultProfile, nil, false, nil); err != nil {
 		return nil, fmt.Errorf("can't write manifest for default profile config map: %v", err)
 	}
-	if err := k.writeConfigMapWithProfile(manifest, "default-windows", winDefaultProfile); err != nil {
+	if err := k.writeConfigMapWithProfile(manifest, "default-windows", winDefaultProfile, nil, false, nil); err != nil {
 		return nil, fmt.Errorf("can't write manifest for default profile config map: %v", err)
 	}
 	configMapNames := []string{
@@ -98,14 +109,22 @@ func (k *KubeletConfig) run(dnsAddress string) (*bytes.Buffer, error) {
 	}
 	for _, profile := range k.clusterSpec.WorkerProfiles {
 		profileConfig := getDefaultProfile(dnsAddress, clientCAFile, volumePluginDir, false) // Do not add dualstack feature gate to the custom profiles
-		merged, err := mergeProfiles(&profileConfig, profile.Values)
+		applyFeatureGates(profileConfig, k.clusterSpec.FeatureGates)
+		applyHardening(profileConfig, k.clusterSpec.Hardening)
+		applyAPIThrottling(profileConfig, profile.APIThrottling)
+		applyCredentialProviders(profileConfig, profile.CredentialProviders)
+		applyGracefulShutdown(profileConfig, profile.GracefulShutdown)
+		merged, err := mergeWorkerProfile(profileConfig, profile)
 		if err != nil {
 			return nil, fmt.Errorf("can't merge profile `%s` with default profile: %v", profile.Name, err)
 		}
 
 		if err := k.writeConfigMapWithProfile(manifest,
 			profile.Name,
-			merged); err != nil {
+			merged,
+			profile.Hugepages,
+			profile.APIThrottling != nil && profile.APIThrottling.Adaptive,
+			profile.CredentialProviders); err != nil {
 			return nil, fmt.Errorf("can't write manifest for profile config map: %v", err)
 		}
 		configMapNames = append(configMapNames, formatProfileName(profile.Name))
@@ -132,25 +151,85 @@ func (k *KubeletConfig) save(data []byte) error {
 
 type unstructuredYamlObject map[string]interface{}
 
-func (k *KubeletConfig) writeConfigMapWithProfile(w io.Writer, name string, profile unstructuredYamlObject) error {
+func (k *KubeletConfig) writeConfigMapWithProfile(w io.Writer, name string, profile unstructuredYamlObject, hugepages map[string]int64, adaptiveThrottling bool, credentialProviders *config.KubeletCredentialProviders) error {
 	profileYaml, err := yaml.Marshal(profile)
 	if err != nil {
 		return err
 	}
+	var hugepagesYaml []byte
+	if len(hugepages) > 0 {
+		hugepagesYaml, err = yaml.Marshal(hugepages)
+		if err != nil {
+			return err
+		}
+	}
+	var credentialProvidersYaml []byte
+	if credentialProviders != nil {
+		credentialProvidersYaml, err = yaml.Marshal(credentialProviders)
+		if err != nil {
+			return err
+		}
+	}
+	var registriesYaml []byte
+	if len(k.clusterSpec.Registries) > 0 {
+		registriesYaml, err = yaml.Marshal(k.clusterSpec.Registries)
+		if err != nil {
+			return err
+		}
+	}
+	var peerMirrorYaml []byte
+	if peerMirror := k.clusterSpec.PeerMirrorConfig(); peerMirror != nil {
+		peerMirrorYaml, err = yaml.Marshal(peerMirror)
+		if err != nil {
+			return err
+		}
+	}
 	tw := util.TemplateWriter{
 		Name:     "kubelet-config",
 		Template: kubeletConfigsManifestTemplate,
 		Data: struct {
-			Name              string
-			KubeletConfigYAML string
+			Name                    string
+			KubeletConfigYAML       string
+			HugepagesYAML           string
+			AdaptiveThrottling      bool
+			CredentialProvidersYAML string
+			Hosts                   string
+			CloudProvider           string
+			ContainerRuntimes       string
+			RegistriesYAML          string
+			PeerMirrorYAML          string
 		}{
-			Name:              formatProfileName(name),
-			KubeletConfigYAML: string(profileYaml),
+			Name:                    formatProfileName(name),
+			KubeletConfigYAML:       string(profileYaml),
+			HugepagesYAML:           string(hugepagesYaml),
+			AdaptiveThrottling:      adaptiveThrottling,
+			CredentialProvidersYAML: string(credentialProvidersYaml),
+			Hosts:                   k.clusterSpec.HostAliases.HostsEntries(),
+			CloudProvider:           k.cloudProvider(),
+			ContainerRuntimes:       k.containerRuntimes(),
+			RegistriesYAML:          string(registriesYaml),
+			PeerMirrorYAML:          string(peerMirrorYaml),
 		},
 	}
 	return tw.WriteToBuffer(w)
 }
 
+// cloudProvider returns the --cloud-provider of the kubelets, external when k0s deploys the cloud controller manager
+func (k *KubeletConfig) cloudProvider() string {
+	if k.clusterSpec.CloudControllerManager() != nil {
+		return "external"
+	}
+	return ""
+}
+
+// containerRuntimes returns the comma separated extra runtime handlers of the k0s managed containerd of the workers
+func (k *KubeletConfig) containerRuntimes() string {
+	if k.clusterSpec.Nvidia() != nil {
+		return constant.NvidiaRuntimeClass
+	}
+	return ""
+}
+
 func formatProfileName(name string) string {
 	return fmt.Sprintf("kubelet-config-%s-%s", name, constant.KubernetesMajorMinorVersion)
 }
@@ -161,8 +240,10 @@ func (k *KubeletConfig) writeRbacRoleBindings(w io.Writer, configMapNames []stri
 		Template: rbacRoleAndBindingsManifestTemplate,
 		Data: struct {
 			ConfigMapNames []string
+			SecretNames    []string
 		}{
 			ConfigMapNames: configMapNames,
+			SecretNames:    k.clusterSpec.Registries.SecretRefs(),
 		},
 	}
 
@@ -212,15 +293,61 @@ func getDefaultProfile(dnsAddress string, clientCAFile string, volumePluginDir s
 		"failSwapOn":           false,
 		"rotateCertificates":   true,
 		"serverTLSBootstrap":   true,
+		// the podresources API socket is used by the device monitoring agents
+		"featureGates": map[string]bool{
+			"KubeletPodResources": true,
+		},
 	}
 	if dualStack {
-		profile["featureGates"] = map[string]bool{
-			"IPv6DualStack": true,
-		}
+		profile["featureGates"].(map[string]bool)["IPv6DualStack"] = true
 	}
 	return profile
 }
 
+// applyFeatureGates adds the kubelet feature gates of spec.featureGates to the profile, the profile values can still override them
+func applyFeatureGates(profile unstructuredYamlObject, featureGates config.FeatureGates) {
+	gates := featureGates.ForComponent(config.KubeletComponent)
+	if len(gates) == 0 {
+		return
+	}
+	if existing, ok := profile["featureGates"].(map[string]bool); ok {
+		for name, enabled := range existing {
+			if _, found := gates[name]; !found {
+				gates[name] = enabled
+			}
+		}
+	}
+	profile["featureGates"] = gates
+}
+
+// applyHardening adds the kubelet settings of the hardening profile, the profile values can still override them
+func applyHardening(profile unstructuredYamlObject, hardening *config.HardeningSpec) {
+	if !hardening.CIS() {
+		return
+	}
+	for field, value := range config.CISKubeletConfig {
+		profile[field] = value
+	}
+}
+
+// applyAPIThrottling sets the explicit rate limits of the profile, the profile values can still override them
+func applyAPIThrottling(profile unstructuredYamlObject, throttling *config.KubeletAPIThrottling) {
+	if throttling == nil {
+		return
+	}
+	limits := map[string]int32{
+		"kubeAPIQPS":      throttling.KubeAPIQPS,
+		"kubeAPIBurst":    throttling.KubeAPIBurst,
+		"registryPullQPS": throttling.RegistryPullQPS,
+		"registryBurst":   throttling.RegistryBurst,
+	}
+	for field, value := range limits {
+		if value > 0 {
+			profile[field] = int(value)
+		}
+	}
+}
+
 const kubeletConfigsManifestTemplate = `---
 apiVersion: v1
 kind: ConfigMap
@@ -230,6 +357,35 @@ metadata:
 data:
   kubelet: | 
 {{ .KubeletConfigYAML | nindent 4 }}
+{{- if .HugepagesYAML }}
+  hugepages: |
+{{ .HugepagesYAML | nindent 4 }}
+{{- end }}
+{{- if .AdaptiveThrottling }}
+  apiThrottling: adaptive
+{{- end }}
+{{- if .CredentialProvidersYAML }}
+  credentialProviders: |
+{{ .CredentialProvidersYAML | nindent 4 }}
+{{- end }}
+{{- if .Hosts }}
+  hosts: |
+{{ .Hosts | nindent 4 }}
+{{- end }}
+{{- if .CloudProvider }}
+  cloudProvider: {{ .CloudProvider }}
+{{- end }}
+{{- if .ContainerRuntimes }}
+  containerRuntimes: {{ .ContainerRuntimes }}
+{{- end }}
+{{- if .RegistriesYAML }}
+  registries: |
+{{ .RegistriesYAML | nindent 4 }}
+{{- end }}
+{{- if .PeerMirrorYAML }}
+  peerMirror: |
+{{ .PeerMirrorYAML | nindent 4 }}
+{{- end }}
 `
 
 const rbacRoleAndBindingsManifestTemplate = `---
@@ -246,6 +402,16 @@ rules:
     - "{{ . -}}"
 {{ end }}
   verbs: ["get"]
+{{- if .SecretNames }}
+# the registry credentials of the k0s managed containerd
+- apiGroups: [""]
+  resources: ["secrets"]
+  resourceNames:
+{{- range .SecretNames }}
+    - "{{ . }}"
+{{- end }}
+  verbs: ["get"]
+{{- end }}
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: RoleBinding
@@ -265,6 +431,41 @@ subjects:
     name: system:nodes
 `
 
+// applyCredentialProviders enables the alpha feature gate of the credential provider plugins in the bundled kubelet,
+// the profile values can still override it
+func applyCredentialProviders(profile unstructuredYamlObject, credentialProviders *config.KubeletCredentialProviders) {
+	if credentialProviders == nil {
+		return
+	}
+	gates, ok := profile["featureGates"].(map[string]bool)
+	if !ok {
+		gates = make(map[string]bool)
+		profile["featureGates"] = gates
+	}
+	if _, found := gates["KubeletCredentialProviders"]; !found {
+		gates["KubeletCredentialProviders"] = true
+	}
+}
+
+// applyGracefulShutdown sets the grace periods of the node shutdown and enables its feature gate, which is alpha in
+// the bundled kubelet. The profile values can still override them.
+func applyGracefulShutdown(profile unstructuredYamlObject, gracefulShutdown *config.KubeletGracefulShutdown) {
+	if gracefulShutdown == nil {
+		return
+	}
+	for field, value := range gracefulShutdown.KubeletValues() {
+		profile[field] = value
+	}
+	gates, ok := profile["featureGates"].(map[string]bool)
+	if !ok {
+		gates = make(map[string]bool)
+		profile["featureGates"] = gates
+	}
+	if _, found := gates["GracefulNodeShutdown"]; !found {
+		gates["GracefulNodeShutdown"] = true
+	}
+}
+
 // mergeInto merges b to the a, a is modified inplace
 func mergeProfiles(a *unstructuredYamlObject, b unstructuredYamlObject) (unstructuredYamlObject, error) {
 	if err := mergo.Merge(a, b, mergo.WithOverride); err != nil {
@@ -273,5 +474,14 @@ func mergeProfiles(a *unstructuredYamlObject, b unstructuredYamlObject) (unstruc
 	return *a, nil
 }
 
+// mergeWorkerProfile merges the values of the worker profile and then its KubeletConfiguration fragment to the profile
+func mergeWorkerProfile(profileConfig unstructuredYamlObject, profile config.WorkerProfile) (unstructuredYamlObject, error) {
+	merged, err := mergeProfiles(&profileConfig, profile.Values)
+	if err != nil {
+		return nil, err
+	}
+	return mergeProfiles(&merged, profile.KubeletConfigurationValues())
+}
+
 // Health-check interface
 func (k *KubeletConfig) Healthy() error { return nil }
@@ -55,7 +55,14 @@ func Test_KubeletConfig(t *testing.T) {
 	t.Run("default_profile_must_have_feature_gates_if_dualstack_setup", func(t *testing.T) {
 		profile := getDefaultProfile(dnsAddr, clientCAFile, volumePluginDir, true)
 		require.Equal(t, map[string]bool{
-			"IPv6DualStack": true,
+			"IPv6DualStack":       true,
+			"KubeletPodResources": true,
+		}, profile["featureGates"])
+	})
+	t.Run("default_profile_must_enable_pod_resources", func(t *testing.T) {
+		profile := getDefaultProfile(dnsAddr, clientCAFile, volumePluginDir, false)
+		require.Equal(t, map[string]bool{
+			"KubeletPodResources": true,
 		}, profile["featureGates"])
 	})
 	t.Run("with_user_provided_profiles", func(t *testing.T) {
@@ -105,6 +112,307 @@ func Test_KubeletConfig(t *testing.T) {
 			require.YAMLEq(t, string(defaultWithChangesYYY), profileYYY.Data["kubelet"])
 		})
 	})
+	t.Run("api_throttling", func(t *testing.T) {
+		spec := config.DefaultClusterConfig(k0sVars).Spec
+		spec.WorkerProfiles = config.WorkerProfiles{
+			config.WorkerProfile{
+				Name: "dense",
+				Values: map[string]interface{}{
+					"kubeAPIBurst": 100,
+				},
+				APIThrottling: &config.KubeletAPIThrottling{
+					Adaptive:     true,
+					KubeAPIQPS:   20,
+					KubeAPIBurst: 40,
+				},
+			},
+		}
+		k, err := NewKubeletConfig(spec, k0sVars)
+		require.NoError(t, err)
+		buf, err := k.run(dnsAddr)
+		require.NoError(t, err)
+		manifestYamls := strings.Split(strings.TrimSuffix(buf.String(), "---"), "---")[1:]
+
+		profile := struct {
+			Data map[string]string `yaml:"data"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[2]), &profile))
+		require.Equal(t, "adaptive", profile.Data["apiThrottling"])
+
+		kubelet := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal([]byte(profile.Data["kubelet"]), &kubelet))
+		require.Equal(t, 20, kubelet["kubeAPIQPS"])
+		// the values of the profile win over apiThrottling
+		require.Equal(t, 100, kubelet["kubeAPIBurst"])
+		require.NotContains(t, kubelet, "registryPullQPS")
+	})
+	t.Run("kubelet_configuration_fragment", func(t *testing.T) {
+		spec := config.DefaultClusterConfig(k0sVars).Spec
+		spec.WorkerProfiles = config.WorkerProfiles{
+			config.WorkerProfile{
+				Name: "numa",
+				Values: map[string]interface{}{
+					"maxPods":               200,
+					"topologyManagerPolicy": "best-effort",
+				},
+				KubeletConfiguration: map[string]interface{}{
+					"apiVersion":            "kubelet.config.k8s.io/v1beta1",
+					"kind":                  "KubeletConfiguration",
+					"topologyManagerPolicy": "single-numa-node",
+					"shutdownGracePeriod":   "30s",
+				},
+			},
+		}
+		k, err := NewKubeletConfig(spec, k0sVars)
+		require.NoError(t, err)
+		buf, err := k.run(dnsAddr)
+		require.NoError(t, err)
+		manifestYamls := strings.Split(strings.TrimSuffix(buf.String(), "---"), "---")[1:]
+
+		profile := struct {
+			Data map[string]string `yaml:"data"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[2]), &profile))
+		kubelet := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal([]byte(profile.Data["kubelet"]), &kubelet))
+		require.Equal(t, 200, kubelet["maxPods"])
+		// the fragment wins over the values
+		require.Equal(t, "single-numa-node", kubelet["topologyManagerPolicy"])
+		require.Equal(t, "30s", kubelet["shutdownGracePeriod"])
+		require.Equal(t, "KubeletConfiguration", kubelet["kind"])
+	})
+	t.Run("credential_providers", func(t *testing.T) {
+		spec := config.DefaultClusterConfig(k0sVars).Spec
+		credentialProviders := &config.KubeletCredentialProviders{
+			Providers: []config.KubeletCredentialProvider{
+				{Name: "ecr-credential-provider", MatchImages: []string{"*.dkr.ecr.*.amazonaws.com"}},
+			},
+		}
+		spec.WorkerProfiles = config.WorkerProfiles{
+			config.WorkerProfile{Name: "aws", CredentialProviders: credentialProviders},
+		}
+		k, err := NewKubeletConfig(spec, k0sVars)
+		require.NoError(t, err)
+		buf, err := k.run(dnsAddr)
+		require.NoError(t, err)
+		manifestYamls := strings.Split(strings.TrimSuffix(buf.String(), "---"), "---")[1:]
+
+		profile := struct {
+			Data map[string]string `yaml:"data"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[2]), &profile))
+		var rendered config.KubeletCredentialProviders
+		require.NoError(t, yaml.Unmarshal([]byte(profile.Data["credentialProviders"]), &rendered))
+		require.Equal(t, *credentialProviders, rendered)
+
+		kubelet := struct {
+			FeatureGates map[string]bool `yaml:"featureGates"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(profile.Data["kubelet"]), &kubelet))
+		require.True(t, kubelet.FeatureGates["KubeletCredentialProviders"])
+
+		// the default profiles have no plugins
+		defaultProfile := struct {
+			Data map[string]string `yaml:"data"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[0]), &defaultProfile))
+		require.NotContains(t, defaultProfile.Data, "credentialProviders")
+	})
+	t.Run("graceful_shutdown", func(t *testing.T) {
+		spec := config.DefaultClusterConfig(k0sVars).Spec
+		spec.WorkerProfiles = config.WorkerProfiles{
+			config.WorkerProfile{
+				Name:             "edge",
+				GracefulShutdown: &config.KubeletGracefulShutdown{GracePeriod: "1m", CriticalPodsGracePeriod: "15s"},
+			},
+		}
+		k, err := NewKubeletConfig(spec, k0sVars)
+		require.NoError(t, err)
+		buf, err := k.run(dnsAddr)
+		require.NoError(t, err)
+		manifestYamls := strings.Split(strings.TrimSuffix(buf.String(), "---"), "---")[1:]
+
+		profile := struct {
+			Data map[string]string `yaml:"data"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[2]), &profile))
+		kubelet := struct {
+			ShutdownGracePeriod             string          `yaml:"shutdownGracePeriod"`
+			ShutdownGracePeriodCriticalPods string          `yaml:"shutdownGracePeriodCriticalPods"`
+			FeatureGates                    map[string]bool `yaml:"featureGates"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(profile.Data["kubelet"]), &kubelet))
+		require.Equal(t, "1m", kubelet.ShutdownGracePeriod)
+		require.Equal(t, "15s", kubelet.ShutdownGracePeriodCriticalPods)
+		require.True(t, kubelet.FeatureGates["GracefulNodeShutdown"])
+		require.Empty(t, k.validate(dnsAddr))
+	})
+	t.Run("host_aliases", func(t *testing.T) {
+		spec := config.DefaultClusterConfig(k0sVars).Spec
+		spec.HostAliases = config.HostAliases{
+			{IP: "10.0.0.10", Hostnames: []string{"registry.edge.local"}},
+		}
+		k, err := NewKubeletConfig(spec, k0sVars)
+		require.NoError(t, err)
+		buf, err := k.run(dnsAddr)
+		require.NoError(t, err)
+		manifestYamls := strings.Split(strings.TrimSuffix(buf.String(), "---"), "---")[1:]
+
+		for _, manifest := range manifestYamls[:2] {
+			profile := struct {
+				Data map[string]string `yaml:"data"`
+			}{}
+			require.NoError(t, yaml.Unmarshal([]byte(manifest), &profile))
+			require.Equal(t, "10.0.0.10 registry.edge.local", strings.TrimSpace(profile.Data["hosts"]))
+		}
+	})
+	t.Run("registries", func(t *testing.T) {
+		spec := config.DefaultClusterConfig(k0sVars).Spec
+		spec.Registries = config.Registries{
+			{Host: "docker.io", Mirrors: []string{"https://mirror.example.com"}},
+			{Host: "registry.local:5000", Auth: &config.RegistryAuth{SecretRef: "registry-local"}},
+		}
+		k, err := NewKubeletConfig(spec, k0sVars)
+		require.NoError(t, err)
+		buf, err := k.run(dnsAddr)
+		require.NoError(t, err)
+		manifestYamls := strings.Split(strings.TrimSuffix(buf.String(), "---"), "---")[1:]
+
+		profile := struct {
+			Data map[string]string `yaml:"data"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[0]), &profile))
+		var registries config.Registries
+		require.NoError(t, yaml.Unmarshal([]byte(profile.Data["registries"]), &registries))
+		require.Equal(t, spec.Registries, registries)
+
+		// the workers can read the auth secrets
+		role := struct {
+			Rules []struct {
+				Resources     []string `yaml:"resources"`
+				ResourceNames []string `yaml:"resourceNames"`
+			} `yaml:"rules"`
+		}{}
+		require.NoError(t, yaml.Unmarshal([]byte(manifestYamls[2]), &role))
+		require.Len(t, role.Rules, 2)
+		require.Equal(t, []string{"secrets"}, role.Rules[1].Resources)
+		require.Equal(t, []string{"registry-local"}, role.Rules[1].ResourceNames)
+	})
+}
+
+func Test_KubeletConfigValidation(t *testing.T) {
+	dnsAddr := "dns.local"
+
+	t.Run("valid_user_profiles", func(t *testing.T) {
+		k := defaultConfigWithUserProvidedProfiles(t)
+		require.Empty(t, k.validate(dnsAddr))
+	})
+	t.Run("wrong_field_types_are_reported_per_profile", func(t *testing.T) {
+		k := defaultConfigWithUserProvidedProfiles(t)
+		k.clusterSpec.WorkerProfiles = append(k.clusterSpec.WorkerProfiles,
+			config.WorkerProfile{
+				Name:   "broken",
+				Values: map[string]interface{}{"maxPods": "many"},
+			},
+			config.WorkerProfile{
+				Name:   "broken-duration",
+				Values: map[string]interface{}{"syncFrequency": "sometimes"},
+			},
+		)
+		errs := k.validate(dnsAddr)
+		require.Len(t, errs, 2)
+		require.Contains(t, errs[0].Error(), "worker profile broken (linux)")
+		require.Contains(t, errs[1].Error(), "worker profile broken-duration (linux)")
+	})
+	t.Run("unknown_fields_are_reported", func(t *testing.T) {
+		k := defaultConfigWithUserProvidedProfiles(t)
+		k.clusterSpec.WorkerProfiles = append(k.clusterSpec.WorkerProfiles,
+			config.WorkerProfile{
+				Name:   "typo",
+				Values: map[string]interface{}{"maxPod": 300},
+			},
+			config.WorkerProfile{
+				Name: "nested-typo",
+				Values: map[string]interface{}{
+					"authentication": map[string]interface{}{
+						"webhook": map[string]interface{}{
+							"enable": true,
+						},
+					},
+				},
+			},
+			config.WorkerProfile{
+				Name:   "wrong-type",
+				Values: map[string]interface{}{"evictionHard": []string{"memory.available<100Mi"}},
+			},
+		)
+		errs := k.validate(dnsAddr)
+		require.Len(t, errs, 3)
+		require.Contains(t, errs[0].Error(), "worker profile typo (linux)")
+		require.Contains(t, errs[0].Error(), `unknown field "maxPod"`)
+		require.Contains(t, errs[1].Error(), `unknown field "enable"`)
+		require.Contains(t, errs[2].Error(), "worker profile wrong-type (linux)")
+	})
+	t.Run("windows_profiles_must_not_enable_qos_cgroups", func(t *testing.T) {
+		k := defaultConfigWithUserProvidedProfiles(t)
+		k.clusterSpec.WorkerProfiles = append(k.clusterSpec.WorkerProfiles,
+			config.WorkerProfile{
+				Name:   "linux-qos",
+				Values: map[string]interface{}{"cgroupsPerQOS": true},
+			},
+			config.WorkerProfile{
+				Name:   "custom-windows",
+				Values: map[string]interface{}{"cgroupsPerQOS": true},
+			},
+		)
+		errs := k.validate(dnsAddr)
+		require.Len(t, errs, 1)
+		require.Contains(t, errs[0].Error(), "worker profile custom-windows (windows)")
+	})
+	t.Run("kubelet_server_settings", func(t *testing.T) {
+		k := defaultConfigWithUserProvidedProfiles(t)
+		k.clusterSpec.WorkerProfiles = append(k.clusterSpec.WorkerProfiles,
+			config.WorkerProfile{
+				Name: "scraped",
+				Values: map[string]interface{}{
+					"port": 10260,
+					"authorization": map[string]interface{}{
+						"webhook": map[string]interface{}{
+							"cacheAuthorizedTTL": "1m",
+						},
+					},
+				},
+			},
+			config.WorkerProfile{
+				Name: "open",
+				Values: map[string]interface{}{
+					"authentication": map[string]interface{}{
+						"anonymous": map[string]interface{}{
+							"enabled": true,
+						},
+					},
+					"authorization": map[string]interface{}{
+						"mode": "AlwaysAllow",
+					},
+				},
+			},
+			config.WorkerProfile{
+				Name: "custom-cert",
+				Values: map[string]interface{}{
+					"tlsCertFile": "/etc/kubelet/serving.crt",
+				},
+			},
+			config.WorkerProfile{
+				Name:   "bad-port",
+				Values: map[string]interface{}{"readOnlyPort": 70000},
+			},
+		)
+		errs := k.validate(dnsAddr)
+		require.Len(t, errs, 3)
+		require.Contains(t, errs[0].Error(), "worker profile open (linux)")
+		require.Contains(t, errs[1].Error(), "tlsCertFile and tlsPrivateKeyFile must be set together")
+		require.Contains(t, errs[2].Error(), "readOnlyPort must be a valid port number")
+	})
 }
 
 func defaultConfigWithUserProvidedProfiles(t *testing.T) *KubeletConfig {
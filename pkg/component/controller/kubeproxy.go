@@ -18,6 +18,7 @@ package controller
 import (
 	"path"
 	"path/filepath"
+	"reflect"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -75,7 +76,7 @@ func (k *KubeProxy) Run() error {
 					k.log.Errorf("error calculating proxy configs: %s. will retry", err.Error())
 					continue
 				}
-				if config == previousConfig {
+				if reflect.DeepEqual(config, previousConfig) {
 					k.log.Infof("current config matches existing, not gonna do anything")
 					continue
 				}
@@ -110,6 +111,10 @@ func (k *KubeProxy) Stop() error {
 }
 
 func (k *KubeProxy) getConfig() (proxyConfig, error) {
+	featureGates := k.clusterConf.Spec.FeatureGates.ForComponent(config.KubeProxyComponent)
+	if k.clusterConf.Spec.Network.DualStack.Enabled {
+		featureGates["IPv6DualStack"] = true
+	}
 	config := proxyConfig{
 		// FIXME get this from somewhere
 		ClusterCIDR:          k.clusterConf.Spec.Network.BuildPodCIDR(),
@@ -117,6 +122,9 @@ func (k *KubeProxy) getConfig() (proxyConfig, error) {
 		Image:                k.clusterConf.Spec.Images.KubeProxy.URI(),
 		PullPolicy:           k.clusterConf.Spec.Images.DefaultPullPolicy,
 		DualStack:            k.clusterConf.Spec.Network.DualStack.Enabled,
+		FeatureGates:         featureGates,
+
+		workloadSecurity: newWorkloadSecurity(k.clusterConf.Spec.WorkloadSecurity),
 	}
 
 	return config, nil
@@ -124,10 +132,12 @@ func (k *KubeProxy) getConfig() (proxyConfig, error) {
 
 type proxyConfig struct {
 	DualStack            bool
+	FeatureGates         map[string]bool
 	ControlPlaneEndpoint string
 	ClusterCIDR          string
 	Image                string
 	PullPolicy           string
+	workloadSecurity
 }
 
 const proxyTemplate = `
@@ -222,9 +232,13 @@ data:
       qps: 0
     clusterCIDR: {{ .ClusterCIDR }}
     configSyncPeriod: 0s
-    {{ if .DualStack }}
+    {{- if .FeatureGates }}
     featureGates:
-      IPv6DualStack: true
+    {{- range $name, $enabled := .FeatureGates }}
+      {{ $name }}: {{ $enabled }}
+    {{- end }}
+    {{- end }}
+    {{ if .DualStack }}
     mode: "ipvs"
     {{ else }}
     mode: ""
@@ -282,7 +296,16 @@ spec:
     metadata:
       labels:
         k8s-app: kube-proxy
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/kube-proxy: runtime/default
+{{- end }}
     spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
       priorityClassName: system-node-critical
       containers:
       - name: kube-proxy
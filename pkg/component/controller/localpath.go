@@ -0,0 +1,279 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// LocalPath deploys the local-path provisioner of spec.extensions.localPath
+type LocalPath struct {
+	clusterSpec *config.ClusterSpec
+	k0sVars     constant.CfgVars
+}
+
+type localPathConfig struct {
+	Image               string
+	HelperImage         string
+	PullPolicy          string
+	DataDir             string
+	StorageClass        string
+	DefaultStorageClass bool
+	workloadSecurity
+}
+
+// NewLocalPath creates new local-path provisioner reconciler
+func NewLocalPath(clusterSpec *config.ClusterSpec, k0sVars constant.CfgVars) *LocalPath {
+	return &LocalPath{
+		clusterSpec: clusterSpec,
+		k0sVars:     k0sVars,
+	}
+}
+
+// Init does currently nothing
+func (l *LocalPath) Init() error {
+	return nil
+}
+
+// Run writes the local-path provisioner manifests, or removes them if the provisioner isn't enabled anymore.
+// Removing the manifests leaves the provisioned volumes and their data on the nodes.
+func (l *LocalPath) Run() error {
+	localPathDir := path.Join(l.k0sVars.ManifestsDir, "local-path")
+	localPath := l.clusterSpec.LocalPath()
+	if localPath == nil {
+		if err := os.RemoveAll(localPathDir); err != nil {
+			return errors.Wrap(err, "failed to remove local-path provisioner manifests")
+		}
+		return nil
+	}
+	if err := util.InitDirectory(localPathDir, constant.ManifestsDirMode); err != nil {
+		return err
+	}
+
+	tw := util.TemplateWriter{
+		Name:     "local-path",
+		Template: localPathTemplate,
+		Data: localPathConfig{
+			Image:               l.clusterSpec.LocalPathProvisionerImage(),
+			HelperImage:         l.clusterSpec.LocalPathHelperImage(),
+			PullPolicy:          l.clusterSpec.Images.DefaultPullPolicy,
+			DataDir:             localPath.DataDirOrDefault(),
+			StorageClass:        constant.LocalPathStorageClass,
+			DefaultStorageClass: localPath.DefaultStorageClass,
+			workloadSecurity:    newWorkloadSecurity(l.clusterSpec.WorkloadSecurity),
+		},
+		Path: filepath.Join(localPathDir, "local-path.yaml"),
+	}
+	if err := tw.Write(); err != nil {
+		return errors.Wrap(err, "error writing local-path provisioner manifests, will NOT retry")
+	}
+	return nil
+}
+
+// Stop does currently nothing
+func (l *LocalPath) Stop() error {
+	return nil
+}
+
+// Health-check interface
+func (l *LocalPath) Healthy() error { return nil }
+
+const localPathTemplate = `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: local-path-provisioner
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:k0s:local-path-provisioner
+rules:
+- apiGroups: [""]
+  resources: ["nodes", "persistentvolumeclaims", "configmaps"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["endpoints", "persistentvolumes", "pods"]
+  verbs: ["*"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "patch"]
+- apiGroups: ["storage.k8s.io"]
+  resources: ["storageclasses"]
+  verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:k0s:local-path-provisioner
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:k0s:local-path-provisioner
+subjects:
+- kind: ServiceAccount
+  name: local-path-provisioner
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: local-path-provisioner
+  namespace: kube-system
+  labels:
+    k8s-app: local-path-provisioner
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      k8s-app: local-path-provisioner
+  template:
+    metadata:
+      labels:
+        k8s-app: local-path-provisioner
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/local-path-provisioner: runtime/default
+{{- end }}
+    spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
+      serviceAccountName: local-path-provisioner
+      priorityClassName: system-cluster-critical
+      tolerations:
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: local-path-provisioner
+        image: {{ .Image }}
+        imagePullPolicy: {{ .PullPolicy }}
+        command:
+        - local-path-provisioner
+        - --debug
+        - start
+        - --config
+        - /etc/config/config.json
+        - --provisioner-name
+        - rancher.io/{{ .StorageClass }}
+        - --helper-image
+        - {{ .HelperImage }}
+        - --configmap-name
+        - local-path-config
+        env:
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+        securityContext:
+          allowPrivilegeEscalation: false
+        volumeMounts:
+        - name: config-volume
+          mountPath: /etc/config/
+      volumes:
+      - name: config-volume
+        configMap:
+          name: local-path-config
+---
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: {{ .StorageClass }}
+{{- if .DefaultStorageClass }}
+  annotations:
+    storageclass.kubernetes.io/is-default-class: "true"
+{{- end }}
+provisioner: rancher.io/{{ .StorageClass }}
+volumeBindingMode: WaitForFirstConsumer
+reclaimPolicy: Delete
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-path-config
+  namespace: kube-system
+data:
+  config.json: |-
+    {
+      "nodePathMap": [
+        {
+          "node": "DEFAULT_PATH_FOR_NON_LISTED_NODES",
+          "paths": ["{{ .DataDir }}"]
+        }
+      ]
+    }
+  setup: |-
+    #!/bin/sh
+    set -eu
+    while getopts "m:s:p:" opt
+    do
+        case $opt in
+            p)
+            absolutePath=$OPTARG
+            ;;
+            s)
+            sizeInBytes=$OPTARG
+            ;;
+            m)
+            volMode=$OPTARG
+            ;;
+        esac
+    done
+    mkdir -m 0777 -p ${absolutePath:-$VOL_DIR}
+  teardown: |-
+    #!/bin/sh
+    set -eu
+    while getopts "m:s:p:" opt
+    do
+        case $opt in
+            p)
+            absolutePath=$OPTARG
+            ;;
+            s)
+            sizeInBytes=$OPTARG
+            ;;
+            m)
+            volMode=$OPTARG
+            ;;
+        esac
+    done
+    rm -rf ${absolutePath:-$VOL_DIR}
+  helperPod.yaml: |-
+    apiVersion: v1
+    kind: Pod
+    metadata:
+      name: helper-pod
+    spec:
+      priorityClassName: system-node-critical
+      tolerations:
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: helper-pod
+        image: {{ .HelperImage }}
+        imagePullPolicy: {{ .PullPolicy }}
+`
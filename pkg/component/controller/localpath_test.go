@@ -0,0 +1,65 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestLocalPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-path")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	vars := constant.GetConfig(dir)
+
+	clusterConfig := config.DefaultClusterConfig(vars)
+	clusterConfig.Spec.Extensions = &config.ClusterExtensions{
+		LocalPath: &config.LocalPathSpec{DataDir: "/mnt/volumes", DefaultStorageClass: true},
+	}
+	require.Empty(t, clusterConfig.Validate())
+
+	localPath := NewLocalPath(clusterConfig.Spec, vars)
+	require.NoError(t, localPath.Run())
+	manifestPath := filepath.Join(vars.ManifestsDir, "local-path", "local-path.yaml")
+	manifest, err := ioutil.ReadFile(manifestPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), `"paths": ["/mnt/volumes"]`)
+	assert.Contains(t, string(manifest), `storageclass.kubernetes.io/is-default-class: "true"`)
+	assert.Contains(t, string(manifest), "image: docker.io/rancher/local-path-provisioner:v0.0.19")
+
+	clusterConfig.Spec.Extensions.LocalPath.DataDir = ""
+	clusterConfig.Spec.Extensions.LocalPath.DefaultStorageClass = false
+	require.NoError(t, localPath.Run())
+	manifest, err = ioutil.ReadFile(manifestPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), `"paths": ["/var/lib/k0s/local-path"]`)
+	assert.NotContains(t, string(manifest), "is-default-class")
+
+	// the manifests are removed with the provisioner
+	clusterConfig.Spec.Extensions.LocalPath = nil
+	require.NoError(t, localPath.Run())
+	_, err = os.Stat(manifestPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,630 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+const (
+	metricsAggregatorName = "k0s-metrics"
+	metricsScrapeInterval = 15 * time.Second
+	metricsScrapeTimeout  = 10 * time.Second
+	metricsAPIPrefix      = "/apis/metrics.k8s.io/v1beta1"
+	metricsAPIVersion     = "metrics.k8s.io/v1beta1"
+	metricsFrontProxyCN   = "front-proxy-client"
+)
+
+const metricsAggregatorTemplate = `
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system-aggregated-metrics-reader
+  labels:
+    rbac.authorization.k8s.io/aggregate-to-view: "true"
+    rbac.authorization.k8s.io/aggregate-to-edit: "true"
+    rbac.authorization.k8s.io/aggregate-to-admin: "true"
+rules:
+- apiGroups: ["metrics.k8s.io"]
+  resources: ["pods", "nodes"]
+  verbs: ["get", "list"]
+---
+# The endpoints of the service are managed by the k0s controller holding the leader lease
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+  namespace: kube-system
+spec:
+  ports:
+  - name: https
+    port: 443
+    protocol: TCP
+    targetPort: {{ .Port }}
+---
+apiVersion: apiregistration.k8s.io/v1
+kind: APIService
+metadata:
+  name: v1beta1.metrics.k8s.io
+spec:
+  service:
+    name: {{ .Name }}
+    namespace: kube-system
+  group: metrics.k8s.io
+  version: v1beta1
+  insecureSkipTLSVerify: true
+  groupPriorityMinimum: 100
+  versionPriority: 100
+`
+
+// MetricsAggregator serves the metrics.k8s.io API straight from the kubelet summary API of the nodes.
+// It's a lightweight alternative to metrics-server, selected with spec.components.metrics: builtin
+type MetricsAggregator struct {
+	clusterConfig     *config.ClusterConfig
+	K0sVars           constant.CfgVars
+	log               *logrus.Entry
+	kubeClientFactory k8sutil.ClientFactory
+	leaderElector     LeaderElector
+
+	server *http.Server
+	stopCh chan struct{}
+
+	mu    sync.RWMutex
+	nodes map[string]nodeMetrics
+	pods  map[string]podMetrics
+}
+
+// the metrics.k8s.io/v1beta1 types, kept local to not pull in k8s.io/metrics for a handful of structs
+type nodeMetrics struct {
+	v1.TypeMeta   `json:",inline"`
+	v1.ObjectMeta `json:"metadata,omitempty"`
+	Timestamp     v1.Time             `json:"timestamp"`
+	Window        v1.Duration         `json:"window"`
+	Usage         corev1.ResourceList `json:"usage"`
+}
+
+type podMetrics struct {
+	v1.TypeMeta   `json:",inline"`
+	v1.ObjectMeta `json:"metadata,omitempty"`
+	Timestamp     v1.Time            `json:"timestamp"`
+	Window        v1.Duration        `json:"window"`
+	Containers    []containerMetrics `json:"containers"`
+}
+
+type containerMetrics struct {
+	Name  string              `json:"name"`
+	Usage corev1.ResourceList `json:"usage"`
+}
+
+type nodeMetricsList struct {
+	v1.TypeMeta `json:",inline"`
+	v1.ListMeta `json:"metadata,omitempty"`
+	Items       []nodeMetrics `json:"items"`
+}
+
+type podMetricsList struct {
+	v1.TypeMeta `json:",inline"`
+	v1.ListMeta `json:"metadata,omitempty"`
+	Items       []podMetrics `json:"items"`
+}
+
+// the parts of the kubelet stats/summary response the aggregator needs
+type kubeletSummary struct {
+	Node struct {
+		NodeName string              `json:"nodeName"`
+		CPU      *kubeletCPUStats    `json:"cpu,omitempty"`
+		Memory   *kubeletMemoryStats `json:"memory,omitempty"`
+	} `json:"node"`
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name   string              `json:"name"`
+			CPU    *kubeletCPUStats    `json:"cpu,omitempty"`
+			Memory *kubeletMemoryStats `json:"memory,omitempty"`
+		} `json:"containers"`
+	} `json:"pods"`
+}
+
+type kubeletCPUStats struct {
+	Time           v1.Time `json:"time"`
+	UsageNanoCores *uint64 `json:"usageNanoCores,omitempty"`
+}
+
+type kubeletMemoryStats struct {
+	Time            v1.Time `json:"time"`
+	WorkingSetBytes *uint64 `json:"workingSetBytes,omitempty"`
+}
+
+type metricsAggregatorConfig struct {
+	Name string
+	Port int
+}
+
+// NewMetricsAggregator creates new MetricsAggregator component
+func NewMetricsAggregator(clusterConfig *config.ClusterConfig, k0sVars constant.CfgVars, kubeClientFactory k8sutil.ClientFactory, leaderElector LeaderElector) *MetricsAggregator {
+	return &MetricsAggregator{
+		clusterConfig:     clusterConfig,
+		K0sVars:           k0sVars,
+		log:               logrus.WithFields(logrus.Fields{"component": "metricsAggregator"}),
+		kubeClientFactory: kubeClientFactory,
+		leaderElector:     leaderElector,
+		nodes:             make(map[string]nodeMetrics),
+		pods:              make(map[string]podMetrics),
+	}
+}
+
+// Init does nothing
+func (m *MetricsAggregator) Init() error {
+	return nil
+}
+
+// Run starts the metrics API server and the kubelet scrape loop
+func (m *MetricsAggregator) Run() error {
+	// the stacks serve the same APIService, drop metrics-server in case the cluster was switched over from it
+	if err := os.RemoveAll(path.Join(m.K0sVars.ManifestsDir, "metricserver")); err != nil {
+		return err
+	}
+	dir := path.Join(m.K0sVars.ManifestsDir, "metricsaggregator")
+	if err := util.InitDirectory(dir, constant.ManifestsDirMode); err != nil {
+		return err
+	}
+	tw := util.TemplateWriter{
+		Name:     "metricsAggregator",
+		Template: metricsAggregatorTemplate,
+		Data: metricsAggregatorConfig{
+			Name: metricsAggregatorName,
+			Port: constant.MetricsAggregatorPort,
+		},
+		Path: filepath.Join(dir, "metrics_aggregator.yaml"),
+	}
+	if err := tw.Write(); err != nil {
+		return err
+	}
+
+	tlsConfig, err := m.tlsConfig()
+	if err != nil {
+		return err
+	}
+	m.server = &http.Server{
+		Addr:      fmt.Sprintf(":%d", constant.MetricsAggregatorPort),
+		Handler:   m,
+		TLSConfig: tlsConfig,
+	}
+	go func() {
+		if err := m.server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			m.log.Errorf("metrics API server failed: %s", err.Error())
+		}
+	}()
+
+	m.stopCh = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(metricsScrapeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// only the leader is in the service endpoints, the others have nothing to serve
+				if !m.leaderElector.IsLeader() {
+					continue
+				}
+				if err := m.reconcileEndpoints(); err != nil {
+					m.log.Warnf("failed to reconcile metrics API endpoints: %s", err.Error())
+				}
+				if err := m.scrape(); err != nil {
+					m.log.Warnf("failed to scrape kubelet metrics: %s", err.Error())
+				}
+			case <-m.stopCh:
+				m.log.Info("metrics aggregator done")
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the scrape loop and the metrics API server
+func (m *MetricsAggregator) Stop() error {
+	if m.stopCh != nil {
+		close(m.stopCh)
+	}
+	if m.server != nil {
+		return m.server.Close()
+	}
+	return nil
+}
+
+// Healthy dummy implementation
+func (m *MetricsAggregator) Healthy() error { return nil }
+
+// tlsConfig serves with the kube-apiserver certificate and accepts only the kube-apiserver aggregation layer,
+// authenticated with the front proxy client certificate. The apiserver has authorized the request already.
+func (m *MetricsAggregator) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(path.Join(m.K0sVars.CertRootDir, "server.crt"), path.Join(m.K0sVars.CertRootDir, "server.key"))
+	if err != nil {
+		return nil, err
+	}
+	caData, err := ioutil.ReadFile(path.Join(m.K0sVars.CertRootDir, "front-proxy-ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no certificates found in front-proxy-ca.crt")
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		VerifyPeerCertificate: func(_ [][]byte, chains [][]*x509.Certificate) error {
+			if len(chains) == 0 || chains[0][0].Subject.CommonName != metricsFrontProxyCN {
+				return fmt.Errorf("client certificate is not issued for %s", metricsFrontProxyCN)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// reconcileEndpoints points the metrics API service to this controller
+func (m *MetricsAggregator) reconcileEndpoints() error {
+	c, err := m.kubeClientFactory.GetClient()
+	if err != nil {
+		return err
+	}
+	subsets := []corev1.EndpointSubset{{
+		Addresses: stringsToEndpointAddresses([]string{m.clusterConfig.Spec.API.Address}),
+		Ports: []corev1.EndpointPort{{
+			Name:     "https",
+			Protocol: "TCP",
+			Port:     constant.MetricsAggregatorPort,
+		}},
+	}}
+
+	epClient := c.CoreV1().Endpoints("kube-system")
+	ep, err := epClient.Get(context.TODO(), metricsAggregatorName, v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = epClient.Create(context.TODO(), &corev1.Endpoints{
+			ObjectMeta: v1.ObjectMeta{Name: metricsAggregatorName, Namespace: "kube-system"},
+			Subsets:    subsets,
+		}, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if len(ep.Subsets) == 1 && equalEndpointSubset(ep.Subsets[0], subsets[0]) {
+		return nil
+	}
+	ep.Subsets = subsets
+	_, err = epClient.Update(context.TODO(), ep, v1.UpdateOptions{})
+	return err
+}
+
+func equalEndpointSubset(a, b corev1.EndpointSubset) bool {
+	return len(a.Ports) == 1 && a.Ports[0].Port == b.Ports[0].Port &&
+		strings.Join(endpointAddressesToStrings(a.Addresses), ",") == strings.Join(endpointAddressesToStrings(b.Addresses), ",")
+}
+
+// scrape fetches the summary of every node through the apiserver node proxy and replaces the cached metrics
+func (m *MetricsAggregator) scrape() error {
+	c, err := m.kubeClientFactory.GetClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metricsScrapeTimeout)
+	defer cancel()
+
+	nodeList, err := c.CoreV1().Nodes().List(ctx, v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	summaries := make([]*kubeletSummary, len(nodeList.Items))
+	for i, node := range nodeList.Items {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			data, err := c.CoreV1().RESTClient().Get().Resource("nodes").Name(name).SubResource("proxy").Suffix("stats/summary").DoRaw(ctx)
+			if err != nil {
+				m.log.Warnf("failed to get kubelet summary of node %s: %s", name, err.Error())
+				return
+			}
+			summary := &kubeletSummary{}
+			if err := json.Unmarshal(data, summary); err != nil {
+				m.log.Warnf("failed to parse kubelet summary of node %s: %s", name, err.Error())
+				return
+			}
+			summaries[i] = summary
+		}(i, node.Name)
+	}
+	wg.Wait()
+
+	nodes := make(map[string]nodeMetrics)
+	pods := make(map[string]podMetrics)
+	for i, summary := range summaries {
+		if summary == nil {
+			continue
+		}
+		if nm, ok := summaryNodeMetrics(summary); ok {
+			nm.Labels = nodeList.Items[i].Labels
+			nodes[nm.Name] = nm
+		}
+		for _, pm := range summaryPodMetrics(summary) {
+			pods[pm.Namespace+"/"+pm.Name] = pm
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes = nodes
+	m.pods = pods
+	return nil
+}
+
+// summaryNodeMetrics converts the node part of a kubelet summary, nodes without cpu or memory usage are skipped
+func summaryNodeMetrics(s *kubeletSummary) (nodeMetrics, bool) {
+	if s.Node.CPU == nil || s.Node.CPU.UsageNanoCores == nil || s.Node.Memory == nil || s.Node.Memory.WorkingSetBytes == nil {
+		return nodeMetrics{}, false
+	}
+	return nodeMetrics{
+		TypeMeta:   v1.TypeMeta{Kind: "NodeMetrics", APIVersion: metricsAPIVersion},
+		ObjectMeta: v1.ObjectMeta{Name: s.Node.NodeName},
+		Timestamp:  s.Node.CPU.Time,
+		Window:     v1.Duration{Duration: metricsScrapeInterval},
+		Usage:      usage(*s.Node.CPU.UsageNanoCores, *s.Node.Memory.WorkingSetBytes),
+	}, true
+}
+
+// summaryPodMetrics converts the pods of a kubelet summary, pods with a container without cpu or memory usage are skipped
+// the same way metrics-server does
+func summaryPodMetrics(s *kubeletSummary) []podMetrics {
+	var pods []podMetrics
+PODS:
+	for _, pod := range s.Pods {
+		pm := podMetrics{
+			TypeMeta:   v1.TypeMeta{Kind: "PodMetrics", APIVersion: metricsAPIVersion},
+			ObjectMeta: v1.ObjectMeta{Name: pod.PodRef.Name, Namespace: pod.PodRef.Namespace},
+			Window:     v1.Duration{Duration: metricsScrapeInterval},
+			Containers: []containerMetrics{},
+		}
+		for _, c := range pod.Containers {
+			if c.CPU == nil || c.CPU.UsageNanoCores == nil || c.Memory == nil || c.Memory.WorkingSetBytes == nil {
+				continue PODS
+			}
+			if pm.Timestamp.Before(&c.CPU.Time) {
+				pm.Timestamp = c.CPU.Time
+			}
+			pm.Containers = append(pm.Containers, containerMetrics{
+				Name:  c.Name,
+				Usage: usage(*c.CPU.UsageNanoCores, *c.Memory.WorkingSetBytes),
+			})
+		}
+		pods = append(pods, pm)
+	}
+	return pods
+}
+
+func usage(nanoCores, workingSetBytes uint64) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewScaledQuantity(int64(nanoCores), -9),
+		corev1.ResourceMemory: *resource.NewQuantity(int64(workingSetBytes), resource.BinarySI),
+	}
+}
+
+// metricsRequest is a parsed metrics.k8s.io request path
+type metricsRequest struct {
+	Resource  string
+	Namespace string
+	Name      string
+}
+
+// parseMetricsPath parses the paths of the metrics.k8s.io/v1beta1 API, an empty resource is the discovery document
+func parseMetricsPath(p string) (metricsRequest, bool) {
+	if p == metricsAPIPrefix {
+		return metricsRequest{}, true
+	}
+	if !strings.HasPrefix(p, metricsAPIPrefix+"/") {
+		return metricsRequest{}, false
+	}
+	parts := strings.Split(strings.TrimPrefix(p, metricsAPIPrefix+"/"), "/")
+	switch {
+	case len(parts) == 1 && (parts[0] == "nodes" || parts[0] == "pods"):
+		return metricsRequest{Resource: parts[0]}, true
+	case len(parts) == 2 && parts[0] == "nodes" && parts[1] != "":
+		return metricsRequest{Resource: "nodes", Name: parts[1]}, true
+	case len(parts) == 3 && parts[0] == "namespaces" && parts[1] != "" && parts[2] == "pods":
+		return metricsRequest{Resource: "pods", Namespace: parts[1]}, true
+	case len(parts) == 4 && parts[0] == "namespaces" && parts[1] != "" && parts[2] == "pods" && parts[3] != "":
+		return metricsRequest{Resource: "pods", Namespace: parts[1], Name: parts[3]}, true
+	}
+	return metricsRequest{}, false
+}
+
+var metricsAPIResources = v1.APIResourceList{
+	TypeMeta:     v1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+	GroupVersion: metricsAPIVersion,
+	APIResources: []v1.APIResource{
+		{Name: "nodes", Kind: "NodeMetrics", Namespaced: false, Verbs: v1.Verbs{"get", "list"}},
+		{Name: "pods", Kind: "PodMetrics", Namespaced: true, Verbs: v1.Verbs{"get", "list"}},
+	},
+}
+
+// ServeHTTP serves the metrics.k8s.io API from the cached kubelet metrics
+func (m *MetricsAggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMetricsStatus(w, http.StatusMethodNotAllowed, v1.StatusReasonMethodNotAllowed, fmt.Sprintf("%s is not supported", r.Method))
+		return
+	}
+	req, ok := parseMetricsPath(r.URL.Path)
+	if !ok {
+		writeMetricsStatus(w, http.StatusNotFound, v1.StatusReasonNotFound, "the server could not find the requested resource")
+		return
+	}
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeMetricsStatus(w, http.StatusBadRequest, v1.StatusReasonBadRequest, err.Error())
+		return
+	}
+
+	switch {
+	case req.Resource == "":
+		writeMetricsJSON(w, metricsAPIResources)
+	case req.Resource == "nodes" && req.Name != "":
+		if nm, ok := m.getNodeMetrics(req.Name); ok {
+			writeMetricsJSON(w, nm)
+			return
+		}
+		writeMetricsStatus(w, http.StatusNotFound, v1.StatusReasonNotFound, fmt.Sprintf("nodemetrics.metrics.k8s.io %q not found", req.Name))
+	case req.Resource == "nodes":
+		writeMetricsJSON(w, nodeMetricsList{
+			TypeMeta: v1.TypeMeta{Kind: "NodeMetricsList", APIVersion: metricsAPIVersion},
+			Items:    m.listNodeMetrics(selector),
+		})
+	case req.Name != "":
+		if pm, ok := m.getPodMetrics(req.Namespace, req.Name); ok {
+			writeMetricsJSON(w, pm)
+			return
+		}
+		writeMetricsStatus(w, http.StatusNotFound, v1.StatusReasonNotFound, fmt.Sprintf("podmetrics.metrics.k8s.io %q not found", req.Name))
+	default:
+		items, err := m.listPodMetrics(r.Context(), req.Namespace, selector)
+		if err != nil {
+			writeMetricsStatus(w, http.StatusInternalServerError, v1.StatusReasonInternalError, err.Error())
+			return
+		}
+		writeMetricsJSON(w, podMetricsList{
+			TypeMeta: v1.TypeMeta{Kind: "PodMetricsList", APIVersion: metricsAPIVersion},
+			Items:    items,
+		})
+	}
+}
+
+func (m *MetricsAggregator) getNodeMetrics(name string) (nodeMetrics, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	nm, ok := m.nodes[name]
+	return nm, ok
+}
+
+func (m *MetricsAggregator) listNodeMetrics(selector labels.Selector) []nodeMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []nodeMetrics{}
+	for _, nm := range m.nodes {
+		if selector.Matches(labels.Set(nm.Labels)) {
+			items = append(items, nm)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+func (m *MetricsAggregator) getPodMetrics(namespace, name string) (podMetrics, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pm, ok := m.pods[namespace+"/"+name]
+	return pm, ok
+}
+
+// listPodMetrics lists the cached pod metrics, the kubelet summary has no pod labels so a label selector is
+// resolved to the matching pods with the kube API
+func (m *MetricsAggregator) listPodMetrics(ctx context.Context, namespace string, selector labels.Selector) ([]podMetrics, error) {
+	var matching map[string]bool
+	if !selector.Empty() {
+		c, err := m.kubeClientFactory.GetClient()
+		if err != nil {
+			return nil, err
+		}
+		podList, err := c.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		matching = make(map[string]bool, len(podList.Items))
+		for _, pod := range podList.Items {
+			matching[pod.Namespace+"/"+pod.Name] = true
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	items := []podMetrics{}
+	for key, pm := range m.pods {
+		if namespace != "" && pm.Namespace != namespace {
+			continue
+		}
+		if matching != nil && !matching[key] {
+			continue
+		}
+		items = append(items, pm)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+func writeMetricsJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		logrus.Warnf("failed to write metrics API response: %s", err.Error())
+	}
+}
+
+func writeMetricsStatus(w http.ResponseWriter, code int, reason v1.StatusReason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v1.Status{
+		TypeMeta: v1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   v1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
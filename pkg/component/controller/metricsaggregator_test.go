@@ -0,0 +1,107 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseMetricsPath(t *testing.T) {
+	tests := []struct {
+		path string
+		req  metricsRequest
+		ok   bool
+	}{
+		{"/apis/metrics.k8s.io/v1beta1", metricsRequest{}, true},
+		{"/apis/metrics.k8s.io/v1beta1/nodes", metricsRequest{Resource: "nodes"}, true},
+		{"/apis/metrics.k8s.io/v1beta1/nodes/worker-1", metricsRequest{Resource: "nodes", Name: "worker-1"}, true},
+		{"/apis/metrics.k8s.io/v1beta1/pods", metricsRequest{Resource: "pods"}, true},
+		{"/apis/metrics.k8s.io/v1beta1/namespaces/kube-system/pods", metricsRequest{Resource: "pods", Namespace: "kube-system"}, true},
+		{"/apis/metrics.k8s.io/v1beta1/namespaces/kube-system/pods/coredns", metricsRequest{Resource: "pods", Namespace: "kube-system", Name: "coredns"}, true},
+		{"/apis/metrics.k8s.io/v1beta1/namespaces/kube-system", metricsRequest{}, false},
+		{"/apis/metrics.k8s.io/v1beta1/services", metricsRequest{}, false},
+		{"/apis/metrics.k8s.io/v1beta1/nodes/", metricsRequest{}, false},
+		{"/api/v1/nodes", metricsRequest{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			req, ok := parseMetricsPath(tc.path)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.req, req)
+		})
+	}
+}
+
+const testKubeletSummary = `{
+  "node": {
+    "nodeName": "worker-1",
+    "cpu": {"time": "2021-04-01T10:00:00Z", "usageNanoCores": 250000000},
+    "memory": {"time": "2021-04-01T10:00:00Z", "workingSetBytes": 1073741824}
+  },
+  "pods": [
+    {
+      "podRef": {"name": "coredns", "namespace": "kube-system"},
+      "containers": [
+        {
+          "name": "coredns",
+          "cpu": {"time": "2021-04-01T10:00:05Z", "usageNanoCores": 3000000},
+          "memory": {"time": "2021-04-01T10:00:05Z", "workingSetBytes": 16777216}
+        }
+      ]
+    },
+    {
+      "podRef": {"name": "starting", "namespace": "default"},
+      "containers": [
+        {"name": "app"}
+      ]
+    }
+  ]
+}`
+
+func TestSummaryMetrics(t *testing.T) {
+	summary := &kubeletSummary{}
+	require.NoError(t, json.Unmarshal([]byte(testKubeletSummary), summary))
+
+	nm, ok := summaryNodeMetrics(summary)
+	require.True(t, ok)
+	assert.Equal(t, "worker-1", nm.Name)
+	assert.Equal(t, "250m", nm.Usage.Cpu().String())
+	assert.Equal(t, "1Gi", nm.Usage.Memory().String())
+
+	pods := summaryPodMetrics(summary)
+	require.Len(t, pods, 1, "pods without usage stats should be skipped")
+	assert.Equal(t, "kube-system", pods[0].Namespace)
+	assert.Equal(t, "coredns", pods[0].Name)
+	assert.Equal(t, "2021-04-01T10:00:05Z", pods[0].Timestamp.UTC().Format("2006-01-02T15:04:05Z"))
+	require.Len(t, pods[0].Containers, 1)
+	assert.Equal(t, "3m", pods[0].Containers[0].Usage.Cpu().String())
+	assert.Equal(t, "16Mi", pods[0].Containers[0].Usage.Memory().String())
+
+	summary.Node.Memory = nil
+	_, ok = summaryNodeMetrics(summary)
+	assert.False(t, ok)
+}
+
+func TestUsage(t *testing.T) {
+	u := usage(1500000000, 512)
+	assert.Equal(t, int64(1500), u.Cpu().MilliValue())
+	assert.Equal(t, int64(512), u.Name(corev1.ResourceMemory, "").Value())
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"os"
 	"path"
 	"path/filepath"
 	"time"
@@ -144,7 +145,16 @@ spec:
       name: metrics-server
       labels:
         k8s-app: metrics-server
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/metrics-server: runtime/default
+{{- end }}
     spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
       serviceAccountName: metrics-server
       volumes:
       # mount in tmp so we can safely use from-scratch images and/or read-only containers
@@ -216,6 +226,7 @@ type metricsConfig struct {
 	PullPolicy string
 	CPURequest string
 	MEMRequest string
+	workloadSecurity
 }
 
 // NewMetricServer creates new MetricServer reconciler
@@ -238,6 +249,11 @@ func (m *MetricServer) Init() error {
 func (m *MetricServer) Run() error {
 	m.tickerDone = make(chan struct{})
 
+	// the stacks serve the same APIService, drop the builtin aggregator in case the cluster was switched over from it
+	if err := os.RemoveAll(path.Join(m.K0sVars.ManifestsDir, "metricsaggregator")); err != nil {
+		return err
+	}
+
 	msDir := path.Join(m.K0sVars.ManifestsDir, "metricserver")
 	err := util.InitDirectory(msDir, constant.ManifestsDirMode)
 	if err != nil {
@@ -300,6 +316,8 @@ func (m *MetricServer) getConfig() (metricsConfig, error) {
 	cfg := metricsConfig{
 		Image:      m.clusterConfig.Spec.Images.MetricsServer.URI(),
 		PullPolicy: m.clusterConfig.Spec.Images.DefaultPullPolicy,
+
+		workloadSecurity: newWorkloadSecurity(m.clusterConfig.Spec.WorkloadSecurity),
 	}
 
 	kubeClient, err := m.kubeClientFactory.GetClient()
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	kubeutil "github.com/k0sproject/k0s/pkg/kubernetes"
+	"github.com/k0sproject/k0s/pkg/token"
+)
+
+// NodeLabeler sets the labels the workers request with k0s worker --labels but kubelet isn't allowed to set, e.g.
+// node-role.kubernetes.io/worker, if spec.nodeLabels allows them. The NodeRestriction admission plugin keeps the
+// nodes from setting them by themselves.
+type NodeLabeler struct {
+	L      *logrus.Entry
+	stopCh chan struct{}
+
+	spec              *config.NodeLabelsSpec
+	leaderElector     LeaderElector
+	kubeClientFactory kubeutil.ClientFactory
+	clientset         clientset.Interface
+	// rejected are the node/label pairs already reported as not allowed
+	rejected map[string]bool
+}
+
+// NewNodeLabeler creates the NodeLabeler component
+func NewNodeLabeler(spec *config.NodeLabelsSpec, leaderElector LeaderElector, kubeClientFactory kubeutil.ClientFactory) *NodeLabeler {
+	return &NodeLabeler{
+		spec:              spec,
+		leaderElector:     leaderElector,
+		kubeClientFactory: kubeClientFactory,
+		stopCh:            make(chan struct{}),
+		rejected:          make(map[string]bool),
+		L:                 logrus.WithFields(logrus.Fields{"component": "nodelabeler"}),
+	}
+}
+
+// Init initializes the kubernetes client
+func (n *NodeLabeler) Init() error {
+	var err error
+	n.clientset, err = n.kubeClientFactory.GetClient()
+	if err != nil {
+		return fmt.Errorf("can't create kubernetes rest client for node labeling: %v", err)
+	}
+	return nil
+}
+
+// Run checks the requested labels of the nodes every 10 seconds
+func (n *NodeLabeler) Run() error {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !n.leaderElector.IsLeader() {
+					continue
+				}
+				if err := n.labelNodes(context.Background()); err != nil {
+					n.L.Warnf("node labeling failed: %s", err.Error())
+				}
+			case <-n.stopCh:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the NodeLabeler
+func (n *NodeLabeler) Stop() error {
+	close(n.stopCh)
+	return nil
+}
+
+// Healthy is a no-op healthchecker
+func (n *NodeLabeler) Healthy() error { return nil }
+
+func (n *NodeLabeler) labelNodes(ctx context.Context) error {
+	nodes, err := n.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range nodes.Items {
+		if err := n.labelNode(ctx, &nodes.Items[i]); err != nil {
+			n.L.Warnf("failed to label node %s: %s", nodes.Items[i].Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// labelNode sets the allowed labels of the annotation. The labels are only added or updated, a label removed from
+// the worker flags stays on the node until removed with kubectl.
+func (n *NodeLabeler) labelNode(ctx context.Context, node *core.Node) error {
+	requested := node.Annotations[token.RequestedNodeLabelsAnnotation]
+	if requested == "" {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for _, label := range strings.Split(requested, ",") {
+		key, value, err := token.ParseLabel(label)
+		if err != nil {
+			return err
+		}
+		if !n.spec.Allows(key) {
+			if id := node.Name + "/" + key; !n.rejected[id] {
+				n.rejected[id] = true
+				n.L.Warnf("not setting label %s requested by node %s, the key is not allowed by spec.nodeLabels.allowedPrefixes", key, node.Name)
+			}
+			continue
+		}
+		if current, found := node.Labels[key]; !found || current != value {
+			labels[key] = value
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": labels},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := n.clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	n.L.Infof("set the labels %v requested by node %s", labels, node.Name)
+	return nil
+}
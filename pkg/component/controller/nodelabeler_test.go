@@ -0,0 +1,65 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/k0sproject/k0s/internal/testutil"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/token"
+)
+
+func TestNodeLabeler(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	client, err := fakeFactory.GetClient()
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	_, err = client.CoreV1().Nodes().Create(ctx, &core.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "worker-1",
+			Labels:      map[string]string{"kubernetes.io/hostname": "worker-1"},
+			Annotations: map[string]string{token.RequestedNodeLabelsAnnotation: "node-role.kubernetes.io/worker=,node-restriction.kubernetes.io/pool=edge"},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = client.CoreV1().Nodes().Create(ctx, &core.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-2"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	spec := &v1beta1.NodeLabelsSpec{AllowedPrefixes: []string{"node-role.kubernetes.io/"}}
+	n := NewNodeLabeler(spec, &DummyLeaderElector{Leader: true}, fakeFactory)
+	require.NoError(t, n.Init())
+	require.NoError(t, n.labelNodes(ctx))
+
+	node, err := client.CoreV1().Nodes().Get(ctx, "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/hostname":         "worker-1",
+		"node-role.kubernetes.io/worker": "",
+	}, node.Labels)
+	assert.True(t, n.rejected["worker-1/node-restriction.kubernetes.io/pool"])
+
+	node, err = client.CoreV1().Nodes().Get(ctx, "worker-2", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, node.Labels)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// Nvidia deploys the nvidia RuntimeClass and the NVIDIA device plugin of spec.extensions.nvidia. The GPU operator is
+// deployed as a helm extension instead.
+type Nvidia struct {
+	clusterSpec *config.ClusterSpec
+	k0sVars     constant.CfgVars
+}
+
+type nvidiaConfig struct {
+	RuntimeClass       string
+	DevicePlugin       bool
+	DevicePluginImage  string
+	PullPolicy         string
+	NvidiaGPUNodeLabel string
+	// DevicePluginDir is the device plugin dir of the kubelets on the nodes
+	DevicePluginDir string
+	workloadSecurity
+}
+
+// NewNvidia creates new NVIDIA GPU support reconciler
+func NewNvidia(clusterSpec *config.ClusterSpec, k0sVars constant.CfgVars) *Nvidia {
+	return &Nvidia{
+		clusterSpec: clusterSpec,
+		k0sVars:     k0sVars,
+	}
+}
+
+// Init does currently nothing
+func (n *Nvidia) Init() error {
+	return nil
+}
+
+// Run writes the NVIDIA manifests, or removes them if the GPU support isn't enabled anymore
+func (n *Nvidia) Run() error {
+	nvidiaDir := path.Join(n.k0sVars.ManifestsDir, "nvidia")
+	nvidia := n.clusterSpec.Nvidia()
+	if nvidia == nil {
+		if err := os.RemoveAll(nvidiaDir); err != nil {
+			return errors.Wrap(err, "failed to remove NVIDIA manifests")
+		}
+		return nil
+	}
+	if err := util.InitDirectory(nvidiaDir, constant.ManifestsDirMode); err != nil {
+		return err
+	}
+
+	tw := util.TemplateWriter{
+		Name:     "nvidia",
+		Template: nvidiaTemplate,
+		Data: nvidiaConfig{
+			RuntimeClass:       constant.NvidiaRuntimeClass,
+			DevicePlugin:       nvidia.GPUOperator == nil,
+			DevicePluginImage:  n.clusterSpec.NvidiaDevicePluginImage(),
+			PullPolicy:         n.clusterSpec.Images.DefaultPullPolicy,
+			NvidiaGPUNodeLabel: constant.NvidiaGPUNodeLabel,
+			DevicePluginDir:    filepath.Join(n.k0sVars.DataDir, "kubelet", "device-plugins"),
+			workloadSecurity:   newWorkloadSecurity(n.clusterSpec.WorkloadSecurity),
+		},
+		Path: filepath.Join(nvidiaDir, "nvidia.yaml"),
+	}
+	if err := tw.Write(); err != nil {
+		return errors.Wrap(err, "error writing NVIDIA manifests, will NOT retry")
+	}
+	return nil
+}
+
+// Stop does currently nothing
+func (n *Nvidia) Stop() error {
+	return nil
+}
+
+// Health-check interface
+func (n *Nvidia) Healthy() error { return nil }
+
+const nvidiaTemplate = `
+# the handler is configured in the k0s managed containerd of the workers
+apiVersion: node.k8s.io/v1
+kind: RuntimeClass
+metadata:
+  name: {{ .RuntimeClass }}
+handler: {{ .RuntimeClass }}
+scheduling:
+  nodeSelector:
+    {{ .NvidiaGPUNodeLabel }}: "true"
+{{- if .DevicePlugin }}
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: nvidia-device-plugin
+  namespace: kube-system
+  labels:
+    k8s-app: nvidia-device-plugin
+spec:
+  selector:
+    matchLabels:
+      k8s-app: nvidia-device-plugin
+  updateStrategy:
+    type: RollingUpdate
+  template:
+    metadata:
+      labels:
+        k8s-app: nvidia-device-plugin
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/nvidia-device-plugin: runtime/default
+{{- end }}
+    spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
+      priorityClassName: system-node-critical
+      # the device plugin needs the NVIDIA libraries injected by the nvidia runtime
+      runtimeClassName: {{ .RuntimeClass }}
+      nodeSelector:
+        {{ .NvidiaGPUNodeLabel }}: "true"
+      tolerations:
+      - key: CriticalAddonsOnly
+        operator: Exists
+      - key: nvidia.com/gpu
+        operator: Exists
+        effect: NoSchedule
+      containers:
+      - name: nvidia-device-plugin
+        image: {{ .DevicePluginImage }}
+        imagePullPolicy: {{ .PullPolicy }}
+        args:
+        - --fail-on-init-error=false
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+        volumeMounts:
+        - name: device-plugin
+          mountPath: /var/lib/kubelet/device-plugins
+      volumes:
+      - name: device-plugin
+        hostPath:
+          path: {{ .DevicePluginDir }}
+{{- end }}
+`
@@ -17,15 +17,19 @@ package controller
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 
 	"github.com/k0sproject/k0s/internal/util"
 	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/fips"
 	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
@@ -35,6 +39,7 @@ type Scheduler struct {
 	gid           int
 	K0sVars       constant.CfgVars
 	LogLevel      string
+	FIPS          bool
 	supervisor    supervisor.Supervisor
 	uid           int
 }
@@ -68,11 +73,31 @@ func (a *Scheduler) Run() error {
 		}
 		args[name] = value
 	}
+	leaderElect := a.ClusterConfig.Spec.API.ExternalAddress != ""
+	if len(a.ClusterConfig.Spec.Scheduler.Config) > 0 {
+		configPath, err := a.writeConfig(schedulerAuthConf, leaderElect)
+		if err != nil {
+			return err
+		}
+		// kube-scheduler ignores the deprecated flags when the config is given, they're set in the config instead
+		for _, name := range []string{"kubeconfig", "leader-elect", "profiling"} {
+			delete(args, name)
+		}
+		args["config"] = configPath
+	}
+	a.ClusterConfig.Spec.FeatureGates.BuildArgs(args, config.SchedulerComponent)
+	if a.FIPS {
+		for name, value := range fips.KubeArgs() {
+			if args[name] == "" {
+				args[name] = value
+			}
+		}
+	}
 	schedulerArgs := []string{}
 	for name, value := range args {
 		schedulerArgs = append(schedulerArgs, fmt.Sprintf("--%s=%s", name, value))
 	}
-	if a.ClusterConfig.Spec.API.ExternalAddress == "" {
+	if !leaderElect && args["config"] == "" {
 		schedulerArgs = append(schedulerArgs, "--leader-elect=false")
 	}
 
@@ -85,15 +110,35 @@ func (a *Scheduler) Run() error {
 		UID:     a.uid,
 		GID:     a.gid,
 	}
-	// TODO We need to dump the config file suited for k0s use
 
 	return a.supervisor.Supervise()
 }
 
+// writeConfig stages the KubeSchedulerConfiguration given in the cluster config
+func (a *Scheduler) writeConfig(kubeconfig string, leaderElect bool) (string, error) {
+	configPath := filepath.Join(a.K0sVars.DataDir, "kube-scheduler-config.yaml")
+	data, err := yaml.Marshal(a.ClusterConfig.Spec.Scheduler.KubeSchedulerConfiguration(kubeconfig, leaderElect))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal kube-scheduler config")
+	}
+	if err := ioutil.WriteFile(configPath, data, constant.CertSecureMode); err != nil {
+		return "", errors.Wrap(err, "failed to write kube-scheduler config")
+	}
+	if err := os.Chown(configPath, a.uid, -1); err != nil && os.Geteuid() == 0 {
+		return "", errors.Wrap(err, "failed to chown kube-scheduler config")
+	}
+	return configPath, nil
+}
+
 // Stop stops Scheduler
 func (a *Scheduler) Stop() error {
 	return a.supervisor.Stop()
 }
 
+// Restart restarts kube-scheduler so that it picks up a renewed kubeconfig
+func (a *Scheduler) Restart() error {
+	return a.supervisor.Restart()
+}
+
 // Health-check interface
 func (a *Scheduler) Healthy() error { return nil }
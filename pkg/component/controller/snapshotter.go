@@ -0,0 +1,249 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/static"
+)
+
+// Snapshotter deploys the CSI external-snapshotter of spec.extensions.snapshotter: the bundled snapshot CRDs and the
+// snapshot controller. The CRDs are a stack of their own, which is kept when the snapshotter is disabled, as removing
+// the CRDs would delete all the snapshots of the cluster.
+type Snapshotter struct {
+	clusterSpec *config.ClusterSpec
+	k0sVars     constant.CfgVars
+}
+
+type snapshotterConfig struct {
+	Image      string
+	PullPolicy string
+	Replicas   int
+	workloadSecurity
+}
+
+// NewSnapshotter creates new CSI snapshotter reconciler
+func NewSnapshotter(clusterSpec *config.ClusterSpec, k0sVars constant.CfgVars) *Snapshotter {
+	return &Snapshotter{
+		clusterSpec: clusterSpec,
+		k0sVars:     k0sVars,
+	}
+}
+
+// Init does currently nothing
+func (s *Snapshotter) Init() error {
+	return nil
+}
+
+// Run writes the snapshot CRDs and the snapshot controller manifests, or removes the controller manifests if the
+// snapshotter isn't enabled anymore
+func (s *Snapshotter) Run() error {
+	controllerDir := path.Join(s.k0sVars.ManifestsDir, "snapshot-controller")
+	snapshotter := s.clusterSpec.Snapshotter()
+	if snapshotter == nil {
+		if err := os.RemoveAll(controllerDir); err != nil {
+			return errors.Wrap(err, "failed to remove snapshot controller manifests")
+		}
+		return nil
+	}
+
+	if err := s.writeCRDs(); err != nil {
+		return err
+	}
+
+	if err := util.InitDirectory(controllerDir, constant.ManifestsDirMode); err != nil {
+		return err
+	}
+	tw := util.TemplateWriter{
+		Name:     "snapshot-controller",
+		Template: snapshotControllerTemplate,
+		Data: snapshotterConfig{
+			Image:            s.clusterSpec.SnapshotControllerImage(),
+			PullPolicy:       s.clusterSpec.Images.DefaultPullPolicy,
+			Replicas:         snapshotter.ReplicasOrDefault(),
+			workloadSecurity: newWorkloadSecurity(s.clusterSpec.WorkloadSecurity),
+		},
+		Path: filepath.Join(controllerDir, "snapshot-controller.yaml"),
+	}
+	if err := tw.Write(); err != nil {
+		return errors.Wrap(err, "error writing snapshot controller manifests, will NOT retry")
+	}
+	return nil
+}
+
+// writeCRDs writes the bundled snapshot CRDs, replacing the ones of the previous k0s version
+func (s *Snapshotter) writeCRDs() error {
+	saver, err := NewManifestsSaver("snapshot-crds", s.k0sVars.DataDir)
+	if err != nil {
+		return err
+	}
+	crds, err := static.AssetDir("manifests/snapshotter/CustomResourceDefinition")
+	if err != nil {
+		return fmt.Errorf("can't unbundle the snapshot CRDs: %v", err)
+	}
+	for _, filename := range crds {
+		content, err := static.Asset(fmt.Sprintf("manifests/snapshotter/CustomResourceDefinition/%s", filename))
+		if err != nil {
+			return fmt.Errorf("failed to fetch crd `%s`: %v", filename, err)
+		}
+		if err := saver.Save(filename, content); err != nil {
+			return fmt.Errorf("failed to save snapshot CRD `%s`: %v", filename, err)
+		}
+	}
+	return nil
+}
+
+// Stop does currently nothing
+func (s *Snapshotter) Stop() error {
+	return nil
+}
+
+// Health-check interface
+func (s *Snapshotter) Healthy() error { return nil }
+
+const snapshotControllerTemplate = `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: snapshot-controller
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:k0s:snapshot-controller
+rules:
+- apiGroups: [""]
+  resources: ["persistentvolumes"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["persistentvolumeclaims"]
+  verbs: ["get", "list", "watch", "update"]
+- apiGroups: ["storage.k8s.io"]
+  resources: ["storageclasses"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["list", "watch", "create", "update", "patch"]
+- apiGroups: ["snapshot.storage.k8s.io"]
+  resources: ["volumesnapshotclasses"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["snapshot.storage.k8s.io"]
+  resources: ["volumesnapshotcontents"]
+  verbs: ["create", "get", "list", "watch", "update", "delete", "patch"]
+- apiGroups: ["snapshot.storage.k8s.io"]
+  resources: ["volumesnapshots"]
+  verbs: ["get", "list", "watch", "update", "patch"]
+- apiGroups: ["snapshot.storage.k8s.io"]
+  resources: ["volumesnapshots/status"]
+  verbs: ["update", "patch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:k0s:snapshot-controller
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:k0s:snapshot-controller
+subjects:
+- kind: ServiceAccount
+  name: snapshot-controller
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: snapshot-controller-leaderelection
+  namespace: kube-system
+rules:
+- apiGroups: ["coordination.k8s.io"]
+  resources: ["leases"]
+  verbs: ["get", "watch", "list", "delete", "update", "create"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: snapshot-controller-leaderelection
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: snapshot-controller-leaderelection
+subjects:
+- kind: ServiceAccount
+  name: snapshot-controller
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: snapshot-controller
+  namespace: kube-system
+  labels:
+    k8s-app: snapshot-controller
+spec:
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+      k8s-app: snapshot-controller
+  # the replicas elect a leader, the old one has to step down before the new one starts
+  strategy:
+    rollingUpdate:
+      maxSurge: 0
+      maxUnavailable: 1
+    type: RollingUpdate
+  template:
+    metadata:
+      labels:
+        k8s-app: snapshot-controller
+{{- if .AppArmor }}
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/snapshot-controller: runtime/default
+{{- end }}
+    spec:
+{{- if .Seccomp }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- end }}
+      serviceAccountName: snapshot-controller
+      priorityClassName: system-cluster-critical
+      tolerations:
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: snapshot-controller
+        image: {{ .Image }}
+        imagePullPolicy: {{ .PullPolicy }}
+        args:
+        - --v=2
+        - --leader-election=true
+        - --leader-election-namespace=kube-system
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+`
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestSnapshotter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshotter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	vars := constant.GetConfig(dir)
+
+	clusterConfig := config.DefaultClusterConfig(vars)
+	clusterConfig.Spec.Extensions = &config.ClusterExtensions{
+		Snapshotter: &config.SnapshotterSpec{Replicas: 2},
+	}
+	require.Empty(t, clusterConfig.Validate())
+
+	snapshotter := NewSnapshotter(clusterConfig.Spec, vars)
+	require.NoError(t, snapshotter.Run())
+	controllerPath := filepath.Join(vars.ManifestsDir, "snapshot-controller", "snapshot-controller.yaml")
+	manifest, err := ioutil.ReadFile(controllerPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), "replicas: 2")
+	assert.Contains(t, string(manifest), "image: k8s.gcr.io/sig-storage/snapshot-controller:v4.0.0")
+
+	crdDir := filepath.Join(vars.ManifestsDir, "snapshot-crds")
+	crds, err := ioutil.ReadDir(crdDir)
+	require.NoError(t, err)
+	assert.Len(t, crds, 3)
+
+	// the controller is removed with the snapshotter, the CRDs and so the snapshots are kept
+	clusterConfig.Spec.Extensions.Snapshotter = nil
+	require.NoError(t, snapshotter.Run())
+	_, err = os.Stat(controllerPath)
+	assert.True(t, os.IsNotExist(err))
+	crds, err = ioutil.ReadDir(crdDir)
+	require.NoError(t, err)
+	assert.Len(t, crds, 3)
+}
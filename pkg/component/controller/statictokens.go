@@ -0,0 +1,107 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	kubeutil "github.com/k0sproject/k0s/pkg/kubernetes"
+	"github.com/k0sproject/k0s/pkg/token"
+)
+
+// StaticTokens provisions the pre-shared join tokens of the static token file as bootstrap tokens
+type StaticTokens struct {
+	Path              string
+	KubeClientFactory kubeutil.ClientFactory
+
+	L             *logrus.Entry
+	leaderElector LeaderElector
+	manager       *token.Manager
+	stopCh        chan struct{}
+}
+
+// NewStaticTokens creates the StaticTokens component for the token file in the given path
+func NewStaticTokens(path string, leaderElector LeaderElector, kubeClientFactory kubeutil.ClientFactory) *StaticTokens {
+	return &StaticTokens{
+		Path:              path,
+		KubeClientFactory: kubeClientFactory,
+		L:                 logrus.WithFields(logrus.Fields{"component": "statictokens"}),
+		leaderElector:     leaderElector,
+		stopCh:            make(chan struct{}),
+	}
+}
+
+// Init validates the static token file, so that a broken file fails the controller start
+func (s *StaticTokens) Init() error {
+	if _, err := token.LoadStaticTokens(s.Path); err != nil {
+		return err
+	}
+	client, err := s.KubeClientFactory.GetClient()
+	if err != nil {
+		return fmt.Errorf("can't create kubernetes rest client for static tokens: %v", err)
+	}
+	s.manager = token.NewManagerForClient(client)
+	return nil
+}
+
+// Run every 10 seconds re-reads the static token file and provisions the tokens missing from the cluster
+func (s *StaticTokens) Run() error {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !s.leaderElector.IsLeader() {
+					continue
+				}
+				if err := s.reconcile(context.Background()); err != nil {
+					s.L.Warnf("static token provisioning failed: %s", err.Error())
+				}
+			case <-s.stopCh:
+				s.L.Info("static token provisioner done")
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *StaticTokens) reconcile(ctx context.Context) error {
+	tokens, err := token.LoadStaticTokens(s.Path)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := s.manager.EnsureStatic(ctx, t); err != nil {
+			return fmt.Errorf("failed to provision static token %s: %v", t.ID(), err)
+		}
+	}
+	return nil
+}
+
+// Stop stops the provisioner
+func (s *StaticTokens) Stop() error {
+	close(s.stopCh)
+	return nil
+}
+
+// Healthy is a no-op healthchecker
+func (s *StaticTokens) Healthy() error { return nil }
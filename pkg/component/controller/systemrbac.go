@@ -22,18 +22,27 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	"github.com/k0sproject/k0s/pkg/constant"
 )
 
 // SystemRBAC implements system RBAC reconciler
 type SystemRBAC struct {
 	manifestDir string
+	clusterSpec *config.ClusterSpec
+}
+
+type systemRBACConfig struct {
+	// AutoApproveBootstrap lets kube-controller-manager approve the kubelet client certificates of joining nodes.
+	// With TPM attestation the k0s CSR approver approves them instead, see tpmattestation.go
+	AutoApproveBootstrap bool
 }
 
 // NewSystemRBAC creates new system level RBAC reconciler
-func NewSystemRBAC(manifestDir string) (*SystemRBAC, error) {
+func NewSystemRBAC(manifestDir string, clusterSpec *config.ClusterSpec) (*SystemRBAC, error) {
 	return &SystemRBAC{
 		manifestDir: manifestDir,
+		clusterSpec: clusterSpec,
 	}, nil
 }
 
@@ -52,8 +61,10 @@ func (s *SystemRBAC) Run() error {
 	tw := util.TemplateWriter{
 		Name:     "bootstrap-rbac",
 		Template: bootstrapRBACTemplate,
-		Data:     struct{}{},
-		Path:     filepath.Join(rbacDir, "bootstrap-rbac.yaml"),
+		Data: systemRBACConfig{
+			AutoApproveBootstrap: s.clusterSpec.CSRApprover == nil || !s.clusterSpec.CSRApprover.TPMAttestation,
+		},
+		Path: filepath.Join(rbacDir, "bootstrap-rbac.yaml"),
 	}
 	err = tw.Write()
 	if err != nil {
@@ -81,6 +92,7 @@ subjects:
 - apiGroup: rbac.authorization.k8s.io
   kind: Group
   name: system:bootstrappers
+{{- if .AutoApproveBootstrap }}
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
@@ -94,6 +106,7 @@ subjects:
 - apiGroup: rbac.authorization.k8s.io
   kind: Group
   name: system:bootstrappers
+{{- end }}
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
@@ -107,6 +120,58 @@ subjects:
 - apiGroup: rbac.authorization.k8s.io
   kind: Group
   name: system:nodes
+---
+# lets the workers pull the images of the ImagePrePulls and report the results
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: k0s:image-prepull
+rules:
+- apiGroups: ["images.k0sproject.io"]
+  resources: ["imageprepulls"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["images.k0sproject.io"]
+  resources: ["imageprepulls/status"]
+  verbs: ["get", "update"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: k0s:image-prepull
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: k0s:image-prepull
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: Group
+  name: system:nodes
+---
+# lets the joining controllers tunnel the k0s API calls through the Kubernetes API service proxy
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: k0s:controller-join
+  namespace: kube-system
+rules:
+- apiGroups: [""]
+  resources: ["services/proxy"]
+  resourceNames: ["https:k0s-api:https"]
+  verbs: ["get", "create"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: k0s:controller-join
+  namespace: kube-system
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: k0s:controller-join
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: Group
+  name: system:bootstrappers:k0s-controllers
 `
 
 // Health-check interface
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	authorization "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/k0sproject/k0s/pkg/tpm"
+)
+
+var tpmEnrollmentGVR = schema.GroupVersionResource{
+	Group:    "attestation.k0sproject.io",
+	Version:  "v1beta1",
+	Resource: "tpmenrollments",
+}
+
+func (a *CSRApprover) tpmAttestation() bool {
+	return a.ClusterConfig != nil && a.ClusterConfig.Spec.CSRApprover != nil && a.ClusterConfig.Spec.CSRApprover.TPMAttestation
+}
+
+// approveAttestedClientCSRs approves the kubelet client certificate requests made with a join token once the
+// node has attested the possession of an enrolled TPM key. With TPM attestation enabled kube-controller-manager
+// does not auto-approve the bootstrap requests, see systemrbac.go
+func (a *CSRApprover) approveAttestedClientCSRs() error {
+	if !a.leaderElector.IsLeader() {
+		return nil
+	}
+
+	csrs, err := a.clientset.CertificatesV1().CertificateSigningRequests().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("can't fetch CSRs: %v", err)
+	}
+
+	var pending, attestations []*v1.CertificateSigningRequest
+	for i := range csrs.Items {
+		csr := &csrs.Items[i]
+		switch {
+		case csr.Spec.SignerName == tpm.AttestationSignerName:
+			attestations = append(attestations, csr)
+		case csr.Spec.SignerName == kubeletClientSignerName && strings.HasPrefix(csr.Spec.Username, bootstrapUserPrefix):
+			if approved, denied := getCertApprovalCondition(&csr.Status); !approved && !denied {
+				pending = append(pending, csr)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	enrolled, err := a.enrolledTPMKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, csr := range pending {
+		x509cr, err := parseCSR(csr)
+		if err != nil {
+			a.L.Warnf("unable to parse csr %q: %v", csr.Name, err)
+			continue
+		}
+		fingerprint, attestation := findAttestation(attestations, csr, x509cr)
+		if attestation == nil {
+			a.L.Debugf("no TPM attestation for csr %s yet", csr.Name)
+			continue
+		}
+		if !enrolled[fingerprint] {
+			a.L.Warnf("not approving csr %s: TPM key %s is not enrolled", csr.Name, fingerprint)
+			continue
+		}
+
+		approved, err := a.authorize(csr, authorization.ResourceAttributes{Group: "certificates.k8s.io", Resource: "certificatesigningrequests", Verb: "create"})
+		if err != nil {
+			return fmt.Errorf("SubjectAccessReview failed: %v", err)
+		}
+		if !approved {
+			a.L.Warnf("not approving csr %s: %s is not allowed to create CSRs", csr.Name, csr.Spec.Username)
+			continue
+		}
+
+		a.L.Infof("approving kubelet client csr %s attested with TPM key %s", csr.Name, fingerprint)
+		appendApprovalCondition(csr, fmt.Sprintf("Auto approving kubelet client certificate after attestation with TPM key %s.", fingerprint))
+		if _, err := a.clientset.CertificatesV1().CertificateSigningRequests().UpdateApproval(context.TODO(), csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("error updating approval for csr: %v", err)
+		}
+		// there is no signer for the attestations, approving just records that it has been used
+		if approved, _ := getCertApprovalCondition(&attestation.Status); !approved {
+			appendApprovalCondition(attestation, fmt.Sprintf("Attested kubelet client csr %s.", csr.Name))
+			if _, err := a.clientset.CertificatesV1().CertificateSigningRequests().UpdateApproval(context.TODO(), attestation.Name, attestation, metav1.UpdateOptions{}); err != nil {
+				a.L.Warnf("error updating approval for attestation csr %s: %v", attestation.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// enrolledTPMKeys returns the fingerprints of the TPM keys enrolled with TPMEnrollment objects
+func (a *CSRApprover) enrolledTPMKeys() (map[string]bool, error) {
+	client, err := a.KubeClientFactory.GetDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(tpmEnrollmentGVR).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch TPM enrollments: %v", err)
+	}
+	enrolled := make(map[string]bool, len(list.Items))
+	for _, item := range list.Items {
+		if fingerprint, _, _ := unstructured.NestedString(item.Object, "spec", "fingerprint"); fingerprint != "" {
+			enrolled[fingerprint] = true
+		}
+	}
+	return enrolled, nil
+}
+
+// findAttestation finds the attestation made with the same join token for the kubelet key of the request and
+// returns it with the fingerprint of the attested TPM key
+func findAttestation(attestations []*v1.CertificateSigningRequest, csr *v1.CertificateSigningRequest, x509cr *x509.CertificateRequest) (string, *v1.CertificateSigningRequest) {
+	for _, attestation := range attestations {
+		if attestation.Spec.Username != csr.Spec.Username {
+			continue
+		}
+		if _, denied := getCertApprovalCondition(&attestation.Status); denied {
+			continue
+		}
+		attestationCR, err := parseCSR(attestation)
+		if err != nil {
+			continue
+		}
+		fingerprint, err := tpm.VerifyAttestation(attestationCR, x509cr.PublicKey)
+		if err != nil {
+			continue
+		}
+		return fingerprint, attestation
+	}
+	return "", nil
+}
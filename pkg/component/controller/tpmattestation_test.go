@@ -0,0 +1,119 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorization "k8s.io/api/authorization/v1"
+	certv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/k0sproject/k0s/internal/testutil"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/tpm"
+)
+
+func TestApproveAttestedClientCSRs(t *testing.T) {
+	fakeFactory := testutil.NewFakeClientFactory()
+	client, err := fakeFactory.GetClient()
+	require.NoError(t, err)
+	client.(*fake.Clientset).PrependReactor("create", "subjectaccessreviews", func(kubetesting.Action) (bool, runtime.Object, error) {
+		return true, &authorization.SubjectAccessReview{Status: authorization.SubjectAccessReviewStatus{Allowed: true}}, nil
+	})
+	ctx := context.TODO()
+
+	// a software key stands in for the TPM key
+	tpmKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	kubeletKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	clientCSR := &certv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-csr-worker"},
+		Spec: certv1.CertificateSigningRequestSpec{
+			Request:    pemWithTemplate(&x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}}}, kubeletKey),
+			SignerName: kubeletClientSignerName,
+			Username:   "system:bootstrap:abcdef",
+		},
+	}
+	_, err = client.CertificatesV1().CertificateSigningRequests().Create(ctx, clientCSR, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	request, err := tpm.CreateAttestationRequest(tpmKey, "worker", kubeletKey.Public())
+	require.NoError(t, err)
+	for name, username := range map[string]string{"tpm-attestation-other": "system:bootstrap:ghijkl", "tpm-attestation-worker": "system:bootstrap:abcdef"} {
+		attestation := &certv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: certv1.CertificateSigningRequestSpec{
+				Request:    request,
+				SignerName: tpm.AttestationSignerName,
+				Username:   username,
+			},
+		}
+		_, err = client.CertificatesV1().CertificateSigningRequests().Create(ctx, attestation, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	config := &v1beta1.ClusterConfig{
+		Spec: &v1beta1.ClusterSpec{
+			CSRApprover: &v1beta1.CSRApproverSpec{TPMAttestation: true},
+		},
+	}
+	c := NewCSRApprover(config, &DummyLeaderElector{Leader: true}, fakeFactory)
+	require.NoError(t, c.Init())
+	require.True(t, c.tpmAttestation())
+
+	isApproved := func(name string) bool {
+		csr, err := client.CertificatesV1().CertificateSigningRequests().Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		approved, _ := getCertApprovalCondition(&csr.Status)
+		return approved
+	}
+
+	require.NoError(t, c.approveAttestedClientCSRs())
+	assert.False(t, isApproved("node-csr-worker"), "csr attested with a key that is not enrolled should not be approved")
+
+	fingerprint, err := tpm.Fingerprint(tpmKey.Public())
+	require.NoError(t, err)
+	dynamicClient, err := fakeFactory.GetDynamicClient()
+	require.NoError(t, err)
+	enrollment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "attestation.k0sproject.io/v1beta1",
+		"kind":       "TPMEnrollment",
+		"metadata":   map[string]interface{}{"name": "worker"},
+		"spec":       map[string]interface{}{"fingerprint": fingerprint},
+	}}
+	_, err = dynamicClient.Resource(tpmEnrollmentGVR).Create(ctx, enrollment, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, c.approveAttestedClientCSRs())
+	assert.True(t, isApproved("node-csr-worker"))
+	assert.True(t, isApproved("tpm-attestation-worker"))
+	assert.False(t, isApproved("tpm-attestation-other"), "attestation made with another join token should not be used")
+}
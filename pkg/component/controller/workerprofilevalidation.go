@@ -0,0 +1,181 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+var kubeletCgroupDrivers = []string{"cgroupfs", "systemd"}
+
+var kubeletPortFields = []string{
+	"healthzPort",
+	"port",
+	"readOnlyPort",
+}
+
+var kubeletAuthorizationModes = []string{"AlwaysAllow", "Webhook"}
+
+// validate renders each worker profile for the worker OS it targets and checks the result is usable by kubelet.
+// The returned errors are prefixed with the profile name and OS so that the user can pinpoint the broken profile.
+func (k *KubeletConfig) validate(dnsAddress string) []error {
+	var errors []error
+	for _, profile := range k.clusterSpec.WorkerProfiles {
+		os := workerProfileOS(profile.Name)
+		clientCAFile := filepath.Join(k.k0sVars.CertRootDir, "ca.crt")
+		if os == "windows" {
+			clientCAFile = k.k0sVars.WindowsCertRootDir + "\\ca.crt"
+		}
+		profileConfig := getDefaultProfile(dnsAddress, clientCAFile, k.k0sVars.KubeletVolumePluginDir, false)
+		applyFeatureGates(profileConfig, k.clusterSpec.FeatureGates)
+		applyHardening(profileConfig, k.clusterSpec.Hardening)
+		applyAPIThrottling(profileConfig, profile.APIThrottling)
+		applyCredentialProviders(profileConfig, profile.CredentialProviders)
+		applyGracefulShutdown(profileConfig, profile.GracefulShutdown)
+		merged, err := mergeWorkerProfile(profileConfig, profile)
+		if err == nil {
+			err = validateKubeletProfile(merged, os)
+		}
+		if err != nil {
+			errors = append(errors, fmt.Errorf("worker profile %s (%s): %v", profile.Name, os, err))
+		}
+	}
+
+	return errors
+}
+
+// workerProfileOS follows the naming of the built-in profiles: profiles meant for windows workers are suffixed with -windows
+func workerProfileOS(name string) string {
+	if strings.HasSuffix(name, "-windows") {
+		return "windows"
+	}
+	return "linux"
+}
+
+// Validate checks that the worker profiles render into kubelet configs the workers can use
+func (k *KubeletConfig) Validate() []error {
+	dnsAddress, err := k.clusterSpec.Network.DNSAddress()
+	if err != nil {
+		return []error{fmt.Errorf("failed to get DNS address for kubelet config: %v", err)}
+	}
+	return k.validate(dnsAddress)
+}
+
+func validateKubeletProfile(profile unstructuredYamlObject, os string) error {
+	// the workers read the config from the configmap, so it must survive a round-trip as-is
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("can't marshal kubelet config: %v", err)
+	}
+	var rendered map[string]interface{}
+	if err := yaml.Unmarshal(data, &rendered); err != nil {
+		return fmt.Errorf("can't unmarshal kubelet config: %v", err)
+	}
+
+	if v, ok := rendered["cgroupDriver"]; ok {
+		driver, _ := v.(string)
+		if !util.StringSliceContains(kubeletCgroupDrivers, driver) {
+			return fmt.Errorf("cgroupDriver must be one of %v, got %v", kubeletCgroupDrivers, v)
+		}
+	}
+	// the values are free form, so check the whole config against the schema of the bundled kubelet to catch the
+	// misspelled and unknown fields and the values of the wrong type kubelet would refuse to start with
+	if err := config.ValidateKubeletConfiguration(rendered); err != nil {
+		return fmt.Errorf("invalid kubelet config: %v", err)
+	}
+
+	if err := validateKubeletServing(rendered); err != nil {
+		return err
+	}
+
+	if os == "windows" {
+		// windows kubelet refuses to start with QoS cgroups or node allocatable enforcement
+		if v, ok := rendered["cgroupsPerQOS"]; ok && v == true {
+			return fmt.Errorf("cgroupsPerQOS is not supported on windows workers")
+		}
+		if v, ok := rendered["enforceNodeAllocatable"]; ok {
+			if list, isList := v.([]interface{}); !isList || len(list) > 0 {
+				return fmt.Errorf("enforceNodeAllocatable is not supported on windows workers")
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateKubeletServing checks the settings of the kubelet server, e.g. used by the metrics scrapers
+func validateKubeletServing(rendered map[string]interface{}) error {
+	for _, field := range kubeletPortFields {
+		// the zero value disables the optional ports, the main port must be set
+		if port, ok := rendered[field].(int); ok && (port < 0 || port > 65535 || (port == 0 && field == "port")) {
+			return fmt.Errorf("%s must be a valid port number, got %d", field, port)
+		}
+	}
+
+	mode, _ := nestedField(rendered, "authorization", "mode")
+	modeString, _ := mode.(string)
+	if !util.StringSliceContains(kubeletAuthorizationModes, modeString) {
+		return fmt.Errorf("authorization.mode must be one of %v, got %v", kubeletAuthorizationModes, mode)
+	}
+	anonymous, _ := nestedField(rendered, "authentication", "anonymous", "enabled")
+	if modeString == "AlwaysAllow" && anonymous == true {
+		return fmt.Errorf("authorization.mode AlwaysAllow with authentication.anonymous.enabled would give anyone full access to the kubelet API")
+	}
+	webhook, _ := nestedField(rendered, "authentication", "webhook", "enabled")
+	if modeString == "Webhook" && webhook != true {
+		return fmt.Errorf("authorization.mode Webhook requires authentication.webhook.enabled, otherwise the API server tokens of the scrapers are not accepted")
+	}
+
+	certFile, hasCert := rendered["tlsCertFile"]
+	keyFile, hasKey := rendered["tlsPrivateKeyFile"]
+	if hasCert != hasKey {
+		return fmt.Errorf("tlsCertFile and tlsPrivateKeyFile must be set together")
+	}
+	if hasCert && (certFile == "" || keyFile == "") {
+		return fmt.Errorf("tlsCertFile and tlsPrivateKeyFile must not be empty")
+	}
+	if hasCert && rendered["serverTLSBootstrap"] == true {
+		return fmt.Errorf("serverTLSBootstrap must be disabled when the serving certificate is given with tlsCertFile")
+	}
+
+	return nil
+}
+
+// nestedField returns the value in the given path of the unmarshalled yaml object
+func nestedField(obj map[string]interface{}, path ...string) (interface{}, bool) {
+	var current interface{} = obj
+	for _, key := range path {
+		switch m := current.(type) {
+		case map[string]interface{}:
+			current = m[key]
+		case map[interface{}]interface{}:
+			current = m[key]
+		default:
+			return nil, false
+		}
+		if current == nil {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+// workloadSecurity is embedded into the template data of the system manifests so that the templates can set the
+// security profiles of spec.workloadSecurity on the pods
+type workloadSecurity struct {
+	Seccomp  bool
+	AppArmor bool
+}
+
+func newWorkloadSecurity(spec *config.WorkloadSecurity) workloadSecurity {
+	if spec == nil {
+		return workloadSecurity{}
+	}
+	return workloadSecurity{
+		Seccomp:  spec.Seccomp,
+		AppArmor: spec.AppArmor,
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/internal/util"
+	config "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+func TestWorkloadSecurity(t *testing.T) {
+	render := func(security *config.WorkloadSecurity) string {
+		output := bytes.NewBuffer([]byte{})
+		tw := util.TemplateWriter{
+			Name:     "coredns",
+			Template: coreDNSTemplate,
+			Data: coreDNSConfig{
+				Replicas:         1,
+				Image:            "coredns",
+				workloadSecurity: newWorkloadSecurity(security),
+			},
+		}
+		require.NoError(t, tw.WriteToBuffer(output))
+		return output.String()
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		manifest := render(config.DefaultWorkloadSecurity())
+		require.NotContains(t, manifest, "seccompProfile")
+		require.NotContains(t, manifest, "container.apparmor.security.beta.kubernetes.io")
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		manifest := render(&config.WorkloadSecurity{Seccomp: true, AppArmor: true})
+		require.Contains(t, manifest, `
+    spec:
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+`)
+		require.Contains(t, manifest, `
+      annotations:
+        container.apparmor.security.beta.kubernetes.io/coredns: runtime/default
+    spec:
+`)
+	})
+}
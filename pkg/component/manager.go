@@ -17,8 +17,11 @@ package component
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/k0sproject/k0s/pkg/performance"
@@ -29,7 +32,25 @@ import (
 // Manager manages components
 type Manager struct {
 	components []Component
-	sync       map[string]struct{}
+	// deps are the indices of the components each component depends on
+	deps [][]int
+	sync map[string]struct{}
+
+	mutex   sync.Mutex
+	timings map[string]*Timing
+
+	// TimingsPath is the file the startup timings of the components are written to, if set
+	TimingsPath string
+}
+
+// Timing is the startup timing of a component
+type Timing struct {
+	// Init is how long initializing the component took
+	Init time.Duration `json:"init"`
+	// Waited is how long the component waited for its dependencies to get healthy
+	Waited time.Duration `json:"waited"`
+	// Start is how long the component took to get healthy after it was started
+	Start time.Duration `json:"start"`
 }
 
 // NewManager creates a manager
@@ -37,19 +58,45 @@ func NewManager() *Manager {
 	return &Manager{
 		components: []Component{},
 		sync:       map[string]struct{}{},
+		timings:    map[string]*Timing{},
 	}
 }
 
-// Add adds a component to the manager
+// Add adds a component to the manager. It's started once all the components added before it are healthy.
 func (m *Manager) Add(component Component) {
+	deps := make([]int, len(m.components))
+	for i := range deps {
+		deps[i] = i
+	}
 	m.components = append(m.components, component)
+	m.deps = append(m.deps, deps)
+}
+
+// AddWithDeps adds a component to the manager that's started as soon as the given components are healthy,
+// concurrently with the other components. The dependencies must have been added to the manager before.
+func (m *Manager) AddWithDeps(component Component, deps ...Component) {
+	indices := []int{}
+	for _, dep := range deps {
+		found := false
+		for i, comp := range m.components {
+			if comp == dep {
+				indices = append(indices, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			panic(fmt.Sprintf("%s depends on %s which hasn't been added to the component manager", componentName(component), componentName(dep)))
+		}
+	}
+	m.components = append(m.components, component)
+	m.deps = append(m.deps, indices)
 }
 
 // AddSync adds a component to the manager that should be initialized synchronously
 func (m *Manager) AddSync(component Component) {
-	m.components = append(m.components, component)
-	compName := reflect.TypeOf(component).Elem().Name()
-	m.sync[compName] = struct{}{}
+	m.Add(component)
+	m.sync[componentName(component)] = struct{}{}
 }
 
 // Init initializes all managed components
@@ -57,41 +104,79 @@ func (m *Manager) Init() error {
 	var g errgroup.Group
 
 	for _, comp := range m.components {
-		compName := reflect.TypeOf(comp).Elem().Name()
+		compName := componentName(comp)
 		logrus.Infof("initializing %v\n", compName)
 		c := comp
 		if _, found := m.sync[compName]; found {
-			if err := c.Init(); err != nil {
+			if err := m.initComponent(c, compName); err != nil {
 				return err
 			}
 		} else {
 			// init this async
-			g.Go(c.Init)
+			g.Go(func() error {
+				return m.initComponent(c, compName)
+			})
 		}
 	}
 	err := g.Wait()
 	return err
 }
 
-// Start starts all managed components
-func (m *Manager) Start(ctx context.Context) error {
+func (m *Manager) initComponent(comp Component, name string) error {
+	start := time.Now()
+	err := comp.Init()
+	m.updateTiming(name, func(timing *Timing) {
+		timing.Init = time.Since(start)
+	})
+	return err
+}
 
+// Start starts all managed components. The components are started concurrently, each as soon as the components it
+// depends on are healthy.
+func (m *Manager) Start(ctx context.Context) error {
 	perfTimer := performance.NewTimer("component-start").Buffer().Start()
-	for _, comp := range m.components {
-		compName := reflect.TypeOf(comp).Elem().Name()
-		perfTimer.Checkpoint(fmt.Sprintf("running-%s", compName))
-		logrus.Infof("starting %v", compName)
+	healthy := make([]chan struct{}, len(m.components))
+	for i := range healthy {
+		healthy[i] = make(chan struct{})
+	}
 
-		if err := comp.Run(); err != nil {
-			return err
-		}
-		perfTimer.Checkpoint(fmt.Sprintf("running-%s-done", compName))
-		if err := waitForHealthy(ctx, comp, compName); err != nil {
-			return err
-		}
+	g, ctx := errgroup.WithContext(ctx)
+	for i, comp := range m.components {
+		i, comp := i, comp
+		g.Go(func() error {
+			compName := componentName(comp)
+			waitStart := time.Now()
+			for _, dep := range m.deps[i] {
+				select {
+				case <-healthy[dep]:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			waited := time.Since(waitStart)
+
+			m.checkpoint(perfTimer, fmt.Sprintf("running-%s", compName))
+			logrus.Infof("starting %v", compName)
+			start := time.Now()
+			if err := comp.Run(); err != nil {
+				return err
+			}
+			m.checkpoint(perfTimer, fmt.Sprintf("running-%s-done", compName))
+			if err := waitForHealthy(ctx, comp, compName); err != nil {
+				return err
+			}
+
+			m.updateTiming(compName, func(timing *Timing) {
+				timing.Waited, timing.Start = waited, time.Since(start)
+			})
+			close(healthy[i])
+			return nil
+		})
 	}
+	err := g.Wait()
 	perfTimer.Output()
-	return nil
+	m.writeTimings()
+	return err
 }
 
 // Stop stops all managed components
@@ -108,6 +193,65 @@ func (m *Manager) Stop() error {
 	return ret
 }
 
+// Timings returns the startup timings of the components, keyed by the component
+func (m *Manager) Timings() map[string]Timing {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	timings := make(map[string]Timing, len(m.timings))
+	for name, timing := range m.timings {
+		timings[name] = *timing
+	}
+	return timings
+}
+
+// ReadTimings reads the startup timings written by a running manager to path
+func ReadTimings(path string) (map[string]Timing, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var timings map[string]Timing
+	if err := json.Unmarshal(data, &timings); err != nil {
+		return nil, err
+	}
+	return timings, nil
+}
+
+func (m *Manager) writeTimings() {
+	if m.TimingsPath == "" {
+		return
+	}
+	data, err := json.Marshal(m.Timings())
+	if err != nil {
+		return
+	}
+	if err := ioutil.WriteFile(m.TimingsPath, data, 0644); err != nil {
+		logrus.WithError(err).Warn("failed to write the component startup timings")
+	}
+}
+
+func (m *Manager) updateTiming(name string, update func(*Timing)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	timing, ok := m.timings[name]
+	if !ok {
+		timing = &Timing{}
+		m.timings[name] = timing
+	}
+	update(timing)
+}
+
+// checkpoint records a checkpoint of the timer, which isn't safe for concurrent use
+func (m *Manager) checkpoint(timer *performance.Timer, name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	timer.Checkpoint(name)
+}
+
+func componentName(comp Component) string {
+	return reflect.TypeOf(comp).Elem().Name()
+}
+
 // waitForHealthy waits until the component is healthy and returns true upon success. If a timeout occurs, it returns false
 func waitForHealthy(ctx context.Context, comp Component, name string) error {
 	ctx, cancelFunction := context.WithTimeout(ctx, 2*time.Minute)
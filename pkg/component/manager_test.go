@@ -0,0 +1,134 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package component
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type startLog struct {
+	mutex   sync.Mutex
+	started []string
+}
+
+func (l *startLog) add(name string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.started = append(l.started, name)
+}
+
+func (l *startLog) get() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string{}, l.started...)
+}
+
+type Storage struct {
+	log     *startLog
+	healthy chan struct{}
+}
+
+func (c *Storage) Init() error { return nil }
+func (c *Storage) Run() error  { c.log.add("Storage"); return nil }
+func (c *Storage) Stop() error { return nil }
+func (c *Storage) Healthy() error {
+	select {
+	case <-c.healthy:
+		return nil
+	default:
+		return errors.New("not yet")
+	}
+}
+
+type APIServer struct{ log *startLog }
+
+func (c *APIServer) Init() error    { return nil }
+func (c *APIServer) Run() error     { c.log.add("APIServer"); return nil }
+func (c *APIServer) Stop() error    { return nil }
+func (c *APIServer) Healthy() error { return nil }
+
+type Independent struct {
+	log *startLog
+	err error
+}
+
+func (c *Independent) Init() error    { return nil }
+func (c *Independent) Run() error     { c.log.add("Independent"); return c.err }
+func (c *Independent) Stop() error    { return nil }
+func (c *Independent) Healthy() error { return nil }
+
+func TestManagerStartsByDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-manager")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	log := &startLog{}
+	storage := &Storage{log: log, healthy: make(chan struct{})}
+	apiServer := &APIServer{log: log}
+	independent := &Independent{log: log}
+
+	m := NewManager()
+	m.TimingsPath = filepath.Join(dir, "timings.json")
+	m.Add(storage)
+	m.AddWithDeps(apiServer, storage)
+	m.AddWithDeps(independent)
+	require.NoError(t, m.Init())
+
+	done := make(chan error)
+	go func() { done <- m.Start(context.Background()) }()
+
+	// the independent component starts while the storage isn't healthy yet
+	assert.Eventually(t, func() bool { return len(log.get()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"Storage", "Independent"}, log.get())
+
+	close(storage.healthy)
+	require.NoError(t, <-done)
+	assert.Equal(t, "APIServer", log.get()[2])
+
+	timings, err := ReadTimings(m.TimingsPath)
+	require.NoError(t, err)
+	assert.Len(t, timings, 3)
+}
+
+func TestManagerStartFailure(t *testing.T) {
+	log := &startLog{}
+	storage := &Storage{log: log, healthy: make(chan struct{})}
+	apiServer := &APIServer{log: log}
+
+	m := NewManager()
+	m.Add(storage)
+	m.AddWithDeps(apiServer, storage)
+	m.AddWithDeps(&Independent{log: log, err: errors.New("failed")})
+
+	err := m.Start(context.Background())
+	assert.EqualError(t, err, "failed")
+	assert.NotContains(t, log.get(), "APIServer")
+}
+
+func TestManagerAddWithUnknownDep(t *testing.T) {
+	m := NewManager()
+	assert.Panics(t, func() { m.AddWithDeps(&APIServer{}, &Storage{}) })
+}
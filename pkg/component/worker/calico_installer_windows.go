@@ -1,23 +1,23 @@
 package worker
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"time"
 
 	"github.com/Microsoft/hcsshim"
-	"github.com/avast/retry-go"
-	"github.com/k0sproject/k0s/pkg/token"
+	"github.com/k0sproject/k0s/internal/retry"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
 	"github.com/sirupsen/logrus"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 type CalicoInstaller struct {
+	K0sVars    constant.CfgVars
 	Token      string
 	APIAddress string
 	CIDRRange  string
@@ -47,45 +47,20 @@ func (c CalicoInstaller) Init() error {
 }
 
 func (c CalicoInstaller) SaveKubeConfig(path string) error {
-	tokenBytes, err := token.DecodeJoinToken(c.Token)
+	joinClient, err := v1beta1.JoinClientFromToken(c.Token)
 	if err != nil {
-		return fmt.Errorf("failed to decode token: %v", err)
+		return fmt.Errorf("failed to create k0s API client: %v", err)
 	}
-	clientConfig, err := clientcmd.NewClientConfigFromBytes(tokenBytes)
-	if err != nil {
-		return fmt.Errorf("failed to create api client config: %v", err)
-	}
-	config, err := clientConfig.ClientConfig()
-	if err != nil {
-		return fmt.Errorf("failed to create api client config: %v", err)
-	}
-
-	ca := x509.NewCertPool()
-	ca.AppendCertsFromPEM(config.CAData)
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: false,
-		RootCAs:            ca,
+	joinClient.SetAddress(c.APIAddress)
+	clientCert, clientKey := filepath.Join(c.K0sVars.CertRootDir, "k0s-api-client.crt"), filepath.Join(c.K0sVars.CertRootDir, "k0s-api-client.key")
+	if err := joinClient.BootstrapClientCertificate(clientCert, clientKey); err != nil {
+		return err
 	}
-	tr := &http.Transport{TLSClientConfig: tlsConfig}
-	client := http.Client{Transport: tr}
 
-	req, err := http.NewRequest(http.MethodGet, c.APIAddress+"/v1beta1/calico/kubeconfig", nil)
-	if err != nil {
-		return fmt.Errorf("can't create http request: %v", err)
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", config.BearerToken))
-	resp, err := client.Do(req)
+	b, err := joinClient.GetCalicoKubeConfig()
 	if err != nil {
 		return fmt.Errorf("can't download kubelet config for calico: %v", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected response status: %s", resp.Status)
-	}
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("can't read response body: %v", err)
-	}
 	if err := ioutil.WriteFile(path, b, 0700); err != nil {
 		return fmt.Errorf("can't save kubeconfig for calico: %v", err)
 	}
@@ -132,7 +107,7 @@ func (p *PowerShell) execute(args ...string) error {
 func getSourceVip() (string, error) {
 	var vip string
 
-	err := retry.Do(func() error {
+	err := retry.Do(context.Background(), "get Calico_ep endpoint", func() error {
 		ep, err := hcsshim.GetHNSEndpointByName("Calico_ep")
 		if err != nil {
 			logrus.WithError(err).Warning("can't get Calico_ep endpoint")
@@ -16,14 +16,23 @@ limitations under the License.
 package worker
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/fsnotify.v1"
 
+	"github.com/k0sproject/k0s/internal/retry"
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/debounce"
 	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
@@ -34,6 +43,21 @@ type ContainerD struct {
 	K0sVars    constant.CfgVars
 
 	OCIBundlePath string
+
+	// KubeletConfigClient and Profile are used to read the runtime handlers and the registries of the managed
+	// containerd config
+	KubeletConfigClient *KubeletConfigClient
+	Profile             string
+	// DetectedRuntimes are the runtimes found on the node, added to the managed containerd config in addition to the
+	// runtimes of the worker profile
+	DetectedRuntimes map[string]string
+	// Rootless tells if containerd runs in the user namespace of a rootless worker
+	Rootless bool
+
+	config        containerdConfig
+	configFetched bool
+	watcher       *fsnotify.Watcher
+	debouncer     debounce.Debouncer
 }
 
 // Init extracts the needed binaries
@@ -51,6 +75,10 @@ func (c *ContainerD) Init() error {
 
 // Run runs containerD
 func (c *ContainerD) Run() error {
+	if err := c.setupConfig(); err != nil {
+		return err
+	}
+
 	logrus.Info("Starting containerD")
 	c.supervisor = supervisor.Supervisor{
 		Name:    "containerd",
@@ -62,16 +90,164 @@ func (c *ContainerD) Run() error {
 			fmt.Sprintf("--state=%s", filepath.Join(c.K0sVars.RunDir, "containerd")),
 			fmt.Sprintf("--address=%s", filepath.Join(c.K0sVars.RunDir, "containerd.sock")),
 			fmt.Sprintf("--log-level=%s", c.LogLevel),
-			"--config=/etc/k0s/containerd.toml",
+			fmt.Sprintf("--config=%s", c.K0sVars.ContainerdConfigPath),
 		},
 	}
-	// TODO We need to dump the config file suited for k0s use
 
-	return c.supervisor.Supervise()
+	if err := c.supervisor.Supervise(); err != nil {
+		return err
+	}
+	return c.watchDropIns()
+}
+
+// setupConfig writes the k0s managed containerd config with the runtime handlers and the registries of the worker
+// profile, the detected runtimes and the drop-ins
+func (c *ContainerD) setupConfig() error {
+	// don't hold up containerd for long if there's a config already, the profile rarely changes
+	attempts := retry.DefaultBackoff.Attempts
+	if util.FileExists(c.K0sVars.ContainerdConfigPath) {
+		attempts = 3
+	}
+	err := c.fetchConfig(attempts)
+	if err != nil && util.FileExists(c.K0sVars.ContainerdConfigPath) {
+		logrus.WithError(err).Warn("failed to fetch the containerd config of the worker profile, using the existing containerd config")
+		return nil
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("failed to fetch the containerd config of the worker profile, starting containerd without it")
+	}
+
+	_, err = c.writeConfig()
+	return err
+}
+
+// fetchConfig fetches the runtime handlers and the registries of the worker profile, and writes the registry host
+// configs
+func (c *ContainerD) fetchConfig(attempts int) error {
+	c.config = containerdConfig{runtimes: containerdRuntimes(nil, c.DetectedRuntimes), rootless: c.Rootless}
+	if c.KubeletConfigClient == nil {
+		c.configFetched = true
+		return nil
+	}
+
+	var runtimes []string
+	var registries v1beta1.Registries
+	var peerMirror *v1beta1.PeerMirrorSpec
+	err := retry.Do(context.Background(), "fetch containerd config", func() error {
+		var err error
+		if runtimes, err = c.KubeletConfigClient.GetContainerRuntimes(c.Profile); err != nil {
+			return err
+		}
+		if registries, err = c.KubeletConfigClient.GetRegistries(c.Profile); err != nil {
+			return err
+		}
+		peerMirror, err = c.KubeletConfigClient.GetPeerMirror(c.Profile)
+		return err
+	}, retry.Attempts(attempts))
+	if err != nil {
+		return err
+	}
+	registries = withPeerMirror(registries, peerMirror)
+
+	c.config.runtimes = containerdRuntimes(runtimes, c.DetectedRuntimes)
+	if err := writeRegistryHosts(c.K0sVars.ContainerdCertsDir, registries); err != nil {
+		return fmt.Errorf("failed to write the registry host configs: %w", err)
+	}
+	if len(registries) > 0 {
+		c.config.registryConfigPath = c.K0sVars.ContainerdCertsDir
+		c.config.registryAuths = registryAuths(registries, c.KubeletConfigClient.GetRegistryAuth)
+	}
+	c.configFetched = true
+	return nil
+}
+
+// writeConfig writes the managed containerd config and the status of its drop-ins. It returns if the config has
+// changed.
+func (c *ContainerD) writeConfig() (bool, error) {
+	changed, status, err := writeContainerdConfig(c.K0sVars.ContainerdConfigPath, c.K0sVars.ContainerdDropInDir, c.config)
+	if err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return changed, err
+	}
+	if err := ioutil.WriteFile(ContainerdDropInStatusPath(c.K0sVars), data, 0644); err != nil {
+		logrus.WithError(err).Warn("failed to write the containerd drop-in status")
+	}
+	return changed, nil
+}
+
+// watchDropIns regenerates the managed containerd config and restarts containerd when the drop-ins change
+func (c *ContainerD) watchDropIns() error {
+	managed, err := isManagedContainerdConfig(c.K0sVars.ContainerdConfigPath)
+	if err != nil {
+		return err
+	}
+	if !managed {
+		logrus.Infof("%s is not managed by k0s, ignoring the drop-ins in %s", c.K0sVars.ContainerdConfigPath, c.K0sVars.ContainerdDropInDir)
+		return nil
+	}
+
+	if err := util.InitDirectory(c.K0sVars.ContainerdDropInDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", c.K0sVars.ContainerdDropInDir, err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(c.K0sVars.ContainerdDropInDir); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		for err := range watcher.Errors {
+			logrus.WithError(err).Warn("error watching the containerd drop-ins")
+		}
+	}()
+
+	c.watcher = watcher
+	c.debouncer = debounce.New(time.Second, watcher.Events, func(arg fsnotify.Event) {
+		c.reloadConfig()
+	})
+	go c.debouncer.Start()
+	return nil
+}
+
+// reloadConfig regenerates the managed containerd config and restarts containerd if the config has changed.
+// containerd doesn't reload its config on SIGHUP, the running containers survive the restart with their shims.
+func (c *ContainerD) reloadConfig() {
+	logrus.Info("containerd config drop-ins have changed, regenerating the containerd config")
+	if !c.configFetched {
+		// the config would lose the runtimes and the registries of the worker profile
+		if err := c.fetchConfig(3); err != nil {
+			logrus.WithError(err).Error("failed to fetch the containerd config of the worker profile, not regenerating the containerd config")
+			return
+		}
+	}
+
+	changed, err := c.writeConfig()
+	if err != nil {
+		logrus.WithError(err).Error("failed to regenerate the containerd config")
+		return
+	}
+	if !changed {
+		return
+	}
+	logrus.Info("containerd config has changed, restarting containerd")
+	if err := c.supervisor.Restart(); err != nil {
+		logrus.WithError(err).Error("failed to restart containerd")
+	}
 }
 
 // Stop stops containerD
 func (c *ContainerD) Stop() error {
+	if c.debouncer != nil {
+		c.debouncer.Stop()
+	}
+	if c.watcher != nil {
+		c.watcher.Close()
+	}
 	return c.supervisor.Stop()
 }
 
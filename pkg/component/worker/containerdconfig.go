@@ -0,0 +1,288 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// managedContainerdConfigMarker is the first line of the containerd configs generated by k0s. Configs without it are
+// provided by the user and never overwritten.
+const managedContainerdConfigMarker = "# k0s_managed=true"
+
+// containerdRuntimeBinaries are the binaries of the runtime handlers k0s can add to its managed containerd config,
+// in the order they're looked up on the node. The first one is used if the runtime isn't found.
+var containerdRuntimeBinaries = map[string][]string{
+	constant.NvidiaRuntimeClass: {
+		"/usr/bin/nvidia-container-runtime",
+		"/usr/local/bin/nvidia-container-runtime",
+		// installed by the container toolkit of the NVIDIA GPU operator
+		"/usr/local/nvidia/toolkit/nvidia-container-runtime",
+	},
+}
+
+// ContainerdRuntimeNodeLabels are the node labels of the nodes with the detected runtimes
+var ContainerdRuntimeNodeLabels = map[string]string{
+	constant.NvidiaRuntimeClass: constant.NvidiaGPUNodeLabel + "=true",
+}
+
+// isManagedContainerdConfig tells if k0s manages the containerd config, i.e. it doesn't exist or k0s has generated it
+func isManagedContainerdConfig(configPath string) (bool, error) {
+	f, err := os.Open(configPath)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text()) == managedContainerdConfigMarker, nil
+	}
+	return false, scanner.Err()
+}
+
+// DetectContainerdRuntimes looks up the runtimes k0s can add to its managed containerd config from the node. It
+// returns the binaries of the found runtimes keyed by the runtime handler.
+func DetectContainerdRuntimes() map[string]string {
+	detected := make(map[string]string)
+	for runtime, binaries := range containerdRuntimeBinaries {
+		for _, binary := range binaries {
+			if info, err := os.Stat(binary); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				detected[runtime] = binary
+				break
+			}
+		}
+	}
+	return detected
+}
+
+// containerdRuntimes returns the binaries of the given runtime handlers, preferring the detected ones. The unknown
+// runtimes are skipped.
+func containerdRuntimes(runtimes []string, detected map[string]string) map[string]string {
+	binaries := make(map[string]string)
+	for runtime, binary := range detected {
+		binaries[runtime] = binary
+	}
+	for _, runtime := range runtimes {
+		if _, found := binaries[runtime]; found {
+			continue
+		}
+		if candidates, ok := containerdRuntimeBinaries[runtime]; ok {
+			binaries[runtime] = candidates[0]
+		} else {
+			logrus.Warnf("unknown containerd runtime %q, skipping", runtime)
+		}
+	}
+	return binaries
+}
+
+// ContainerdDropInStatus is the status of the drop-ins of the k0s managed containerd config
+type ContainerdDropInStatus struct {
+	// DropIns are the drop-ins merged into the config
+	DropIns []string `json:"dropIns,omitempty"`
+	// Invalid are the errors of the drop-ins skipped as invalid, keyed by the drop-in
+	Invalid map[string]string `json:"invalid,omitempty"`
+}
+
+// ContainerdDropInStatusPath returns the path the containerd component keeps the drop-in status in
+func ContainerdDropInStatusPath(k0sVars constant.CfgVars) string {
+	return filepath.Join(k0sVars.RunDir, "containerd-dropins.json")
+}
+
+// ReadContainerdDropInStatus reads the status of the containerd config drop-ins of the running worker
+func ReadContainerdDropInStatus(k0sVars constant.CfgVars) (*ContainerdDropInStatus, error) {
+	data, err := ioutil.ReadFile(ContainerdDropInStatusPath(k0sVars))
+	if err != nil {
+		return nil, err
+	}
+	var status ContainerdDropInStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// loadContainerdDropIns parses the *.toml drop-ins of dropInDir in lexical order. The invalid ones are skipped and
+// reported in the status.
+func loadContainerdDropIns(dropInDir string) ([]map[string]interface{}, ContainerdDropInStatus, error) {
+	var status ContainerdDropInStatus
+	paths, err := filepath.Glob(filepath.Join(dropInDir, "*.toml"))
+	if err != nil {
+		return nil, status, err
+	}
+	sort.Strings(paths)
+
+	var dropIns []map[string]interface{}
+	for _, path := range paths {
+		dropIn := make(map[string]interface{})
+		err := func() error {
+			if _, err := toml.DecodeFile(path, &dropIn); err != nil {
+				return err
+			}
+			// the version 1 plugin names wouldn't merge with the ones of the generated config
+			if version, found := dropIn["version"]; found && version != int64(2) {
+				return fmt.Errorf("only version 2 configs are supported, got version %v", version)
+			}
+			return nil
+		}()
+		if err != nil {
+			if status.Invalid == nil {
+				status.Invalid = make(map[string]string)
+			}
+			status.Invalid[path] = err.Error()
+			logrus.WithError(err).Errorf("skipping invalid containerd config drop-in %s", path)
+			continue
+		}
+		dropIns = append(dropIns, dropIn)
+		status.DropIns = append(status.DropIns, path)
+	}
+	return dropIns, status, nil
+}
+
+// mergeContainerdConfig merges src into dst, the tables are merged recursively and the other values are replaced
+func mergeContainerdConfig(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcTable, srcIsTable := value.(map[string]interface{})
+		dstTable, dstIsTable := dst[key].(map[string]interface{})
+		if srcIsTable && dstIsTable {
+			mergeContainerdConfig(dstTable, srcTable)
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// containerdConfig is the generated part of the k0s managed containerd config
+type containerdConfig struct {
+	// runtimes are the binaries of the extra runtime handlers
+	runtimes map[string]string
+	// registryConfigPath is the certs.d dir of the registry host configs, empty if there are no registries
+	registryConfigPath string
+	// registryAuths are the credentials of the registries keyed by the registry host
+	registryAuths map[string]registryAuth
+	// rootless tells if containerd runs in a user namespace, without access to the cgroups and AppArmor
+	rootless bool
+}
+
+// renderContainerdConfig renders the k0s managed containerd config with the drop-ins merged into it in order
+func renderContainerdConfig(c containerdConfig, dropIns []map[string]interface{}) (string, error) {
+	config := map[string]interface{}{"version": 2}
+	cri := make(map[string]interface{})
+	criContainerd := make(map[string]interface{})
+	if len(c.runtimes) > 0 {
+		handlers := make(map[string]interface{})
+		for runtime, binary := range c.runtimes {
+			handlers[runtime] = map[string]interface{}{
+				"runtime_type": "io.containerd.runc.v2",
+				"options":      map[string]interface{}{"BinaryName": binary},
+			}
+		}
+		criContainerd["runtimes"] = handlers
+	}
+	if c.rootless {
+		cri["disable_cgroup"] = true
+		cri["disable_apparmor"] = true
+		cri["disable_hugetlb_controller"] = true
+		cri["restrict_oom_score_adj"] = true
+		// overlayfs can't be mounted in a user namespace on most kernels, fuse-overlayfs can be set in a drop-in
+		criContainerd["snapshotter"] = "native"
+	}
+	if len(criContainerd) > 0 {
+		cri["containerd"] = criContainerd
+	}
+	if c.registryConfigPath != "" {
+		registry := map[string]interface{}{"config_path": c.registryConfigPath}
+		if len(c.registryAuths) > 0 {
+			configs := make(map[string]interface{})
+			for host, auth := range c.registryAuths {
+				hostAuth := make(map[string]interface{})
+				for key, value := range map[string]string{"username": auth.Username, "password": auth.Password, "auth": auth.Auth} {
+					if value != "" {
+						hostAuth[key] = value
+					}
+				}
+				configs[host] = map[string]interface{}{"auth": hostAuth}
+			}
+			registry["configs"] = configs
+		}
+		cri["registry"] = registry
+	}
+	if len(cri) > 0 {
+		config["plugins"] = map[string]interface{}{"io.containerd.grpc.v1.cri": cri}
+	}
+	for _, dropIn := range dropIns {
+		mergeContainerdConfig(config, dropIn)
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, managedContainerdConfigMarker)
+	fmt.Fprintln(&b, "# This containerd config is generated by k0s, changes to it are overwritten. Add the changes as drop-ins")
+	fmt.Fprintln(&b, "# to the containerd.d directory next to it, or replace the file with your own config without the line above.")
+	if err := toml.NewEncoder(&b).Encode(config); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// writeContainerdConfig writes the k0s managed containerd config with the drop-ins of dropInDir, unless the user
+// provides the config. It returns if the config has changed.
+func writeContainerdConfig(configPath string, dropInDir string, c containerdConfig) (bool, ContainerdDropInStatus, error) {
+	managed, err := isManagedContainerdConfig(configPath)
+	if err != nil {
+		return false, ContainerdDropInStatus{}, fmt.Errorf("failed to read containerd config %s: %w", configPath, err)
+	}
+	if !managed {
+		for runtime := range c.runtimes {
+			logrus.Warnf("%s is not managed by k0s, the containerd runtime %s has to be configured in it manually", configPath, runtime)
+		}
+		if c.registryConfigPath != "" {
+			logrus.Warnf("%s is not managed by k0s, the registries need config_path = %q in it", configPath, c.registryConfigPath)
+		}
+		return false, ContainerdDropInStatus{}, nil
+	}
+
+	dropIns, status, err := loadContainerdDropIns(dropInDir)
+	if err != nil {
+		return false, status, err
+	}
+	config, err := renderContainerdConfig(c, dropIns)
+	if err != nil {
+		return false, status, err
+	}
+	if current, err := ioutil.ReadFile(configPath); err == nil && string(current) == config {
+		return false, status, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return false, status, err
+	}
+	return true, status, ioutil.WriteFile(configPath, []byte(config), 0644)
+}
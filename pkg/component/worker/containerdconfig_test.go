@@ -0,0 +1,169 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteContainerdConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "k0s", "containerd.toml")
+	dropInDir := filepath.Join(dir, "k0s", "containerd.d")
+
+	changed, _, err := writeContainerdConfig(configPath, dropInDir, containerdConfig{runtimes: containerdRuntimes([]string{"nvidia", "unknown"}, nil)})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	config, err := ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(config), `[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]`)
+	assert.Contains(t, string(config), `BinaryName = "/usr/bin/nvidia-container-runtime"`)
+	assert.NotContains(t, string(config), "unknown")
+
+	// the managed config is regenerated when the runtimes change
+	changed, _, err = writeContainerdConfig(configPath, dropInDir, containerdConfig{})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	config, err = ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(config), "nvidia")
+
+	changed, _, err = writeContainerdConfig(configPath, dropInDir, containerdConfig{})
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// configs provided by the user are never touched
+	userConfig := "version = 2\n"
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(userConfig), 0644))
+	changed, _, err = writeContainerdConfig(configPath, dropInDir, containerdConfig{runtimes: map[string]string{"nvidia": "/usr/bin/nvidia-container-runtime"}})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	config, err = ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, userConfig, string(config))
+}
+
+func TestWriteContainerdConfigDropIns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "containerd.toml")
+	dropInDir := filepath.Join(dir, "containerd.d")
+	require.NoError(t, os.Mkdir(dropInDir, 0755))
+
+	dropIns := map[string]string{
+		"10-mirror.toml": `
+[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]
+  endpoint = ["https://mirror.example.com"]
+`,
+		"20-debug.toml": `
+[debug]
+  level = "info"
+`,
+		// the later drop-ins override the earlier ones
+		"30-debug.toml": `
+[debug]
+  level = "debug"
+`,
+		"40-invalid.toml": "[debug\n",
+		"50-v1.toml":      "version = 1\n",
+		"README":          "not a drop-in",
+	}
+	for name, content := range dropIns {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dropInDir, name), []byte(content), 0644))
+	}
+
+	changed, status, err := writeContainerdConfig(configPath, dropInDir, containerdConfig{runtimes: map[string]string{"nvidia": "/usr/bin/nvidia-container-runtime"}})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{
+		filepath.Join(dropInDir, "10-mirror.toml"),
+		filepath.Join(dropInDir, "20-debug.toml"),
+		filepath.Join(dropInDir, "30-debug.toml"),
+	}, status.DropIns)
+	assert.Len(t, status.Invalid, 2)
+	assert.Contains(t, status.Invalid, filepath.Join(dropInDir, "40-invalid.toml"))
+	assert.Contains(t, status.Invalid, filepath.Join(dropInDir, "50-v1.toml"))
+
+	config, err := ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(config), managedContainerdConfigMarker)
+	assert.Contains(t, string(config), `[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]`)
+	assert.Contains(t, string(config), `[plugins."io.containerd.grpc.v1.cri".registry.mirrors."docker.io"]`)
+	assert.Contains(t, string(config), `level = "debug"`)
+	assert.Contains(t, string(config), "version = 2")
+	assert.NotContains(t, string(config), "version = 1")
+
+	// the config changes when a drop-in is removed
+	require.NoError(t, os.Remove(filepath.Join(dropInDir, "30-debug.toml")))
+	changed, _, err = writeContainerdConfig(configPath, dropInDir, containerdConfig{runtimes: map[string]string{"nvidia": "/usr/bin/nvidia-container-runtime"}})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	config, err = ioutil.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(config), `level = "info"`)
+}
+
+func TestRenderContainerdConfigRegistries(t *testing.T) {
+	config, err := renderContainerdConfig(containerdConfig{
+		registryConfigPath: "/etc/k0s/certs.d",
+		registryAuths: map[string]registryAuth{
+			"registry-1.docker.io": {Username: "user", Password: "secret"},
+		},
+	}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, config, `config_path = "/etc/k0s/certs.d"`)
+	assert.Contains(t, config, `[plugins."io.containerd.grpc.v1.cri".registry.configs."registry-1.docker.io".auth]`)
+	assert.Contains(t, config, `username = "user"`)
+	assert.Contains(t, config, `password = "secret"`)
+	assert.NotContains(t, config, "auth = ")
+}
+
+func TestRenderContainerdConfigRootless(t *testing.T) {
+	config, err := renderContainerdConfig(containerdConfig{
+		runtimes: map[string]string{"nvidia": "/usr/bin/nvidia-container-runtime"},
+		rootless: true,
+	}, []map[string]interface{}{{
+		"plugins": map[string]interface{}{
+			"io.containerd.grpc.v1.cri": map[string]interface{}{
+				"containerd": map[string]interface{}{"snapshotter": "fuse-overlayfs"},
+			},
+		},
+	}})
+	require.NoError(t, err)
+	assert.Contains(t, config, "disable_cgroup = true")
+	assert.Contains(t, config, "restrict_oom_score_adj = true")
+	assert.Contains(t, config, `BinaryName = "/usr/bin/nvidia-container-runtime"`)
+	// the drop-ins can replace the snapshotter
+	assert.Contains(t, config, `snapshotter = "fuse-overlayfs"`)
+	assert.NotContains(t, config, `snapshotter = "native"`)
+}
+
+func TestContainerdRuntimes(t *testing.T) {
+	detected := map[string]string{"nvidia": "/usr/local/nvidia/toolkit/nvidia-container-runtime"}
+	// the detected binary is preferred over the default one
+	assert.Equal(t, detected, containerdRuntimes([]string{"nvidia"}, detected))
+	assert.Equal(t, detected, containerdRuntimes(nil, detected))
+	assert.Empty(t, containerdRuntimes([]string{"unknown"}, nil))
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	cpuManagerStateFile     = "cpu_manager_state"
+	defaultCPUManagerPolicy = "none"
+)
+
+// resetCPUManagerState removes the kubelet cpu manager checkpoint if it was written with a different policy
+// than the one in the given kubelet config. Kubelet refuses to start when the policy does not match its checkpoint.
+func resetCPUManagerState(kubeletRootDir string, kubeletConfig []byte) error {
+	config := struct {
+		CPUManagerPolicy string `yaml:"cpuManagerPolicy"`
+	}{}
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return fmt.Errorf("failed to parse kubelet config: %v", err)
+	}
+	policy := config.CPUManagerPolicy
+	if policy == "" {
+		policy = defaultCPUManagerPolicy
+	}
+
+	statePath := filepath.Join(kubeletRootDir, cpuManagerStateFile)
+	data, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read cpu manager state: %v", err)
+	}
+
+	state := struct {
+		PolicyName string `json:"policyName"`
+	}{}
+	// a corrupted checkpoint would also prevent kubelet from starting, so it's reset as well
+	if err := json.Unmarshal(data, &state); err == nil && state.PolicyName == policy {
+		return nil
+	}
+
+	logrus.Infof("cpu manager policy changed from %q to %q, removing %s", state.PolicyName, policy, statePath)
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cpu manager state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetCPUManagerState(t *testing.T) {
+	cases := []struct {
+		name    string
+		state   string
+		config  string
+		removed bool
+	}{
+		{
+			name:    "same policy",
+			state:   `{"policyName":"static","defaultCpuSet":"2-7","checksum":1}`,
+			config:  "cpuManagerPolicy: static\n",
+			removed: false,
+		},
+		{
+			name:    "default policy",
+			state:   `{"policyName":"none","defaultCpuSet":"","checksum":1}`,
+			config:  "kind: KubeletConfiguration\n",
+			removed: false,
+		},
+		{
+			name:    "changed policy",
+			state:   `{"policyName":"none","defaultCpuSet":"","checksum":1}`,
+			config:  "cpuManagerPolicy: static\n",
+			removed: true,
+		},
+		{
+			name:    "corrupted state",
+			state:   `{"policyName"`,
+			config:  "cpuManagerPolicy: static\n",
+			removed: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "k0s-kubelet")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			statePath := filepath.Join(dir, cpuManagerStateFile)
+			require.NoError(t, ioutil.WriteFile(statePath, []byte(tc.state), 0600))
+
+			require.NoError(t, resetCPUManagerState(dir, []byte(tc.config)))
+			_, err = os.Stat(statePath)
+			require.Equal(t, tc.removed, os.IsNotExist(err))
+		})
+	}
+
+	t.Run("missing state", func(t *testing.T) {
+		require.NoError(t, resetCPUManagerState(filepath.Join(os.TempDir(), "k0s-nonexisting"), []byte("cpuManagerPolicy: static\n")))
+	})
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/k0sproject/k0s/internal/retry"
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/crictl"
+)
+
+// The container runtimes k0s knows, as reported by the CRI version call
+const (
+	RuntimeContainerd = "containerd"
+	RuntimeCRIO       = "cri-o"
+	RuntimeDocker     = "docker"
+)
+
+// runtimeServices are the systemd services the container runtimes usually run as
+var runtimeServices = map[string]string{
+	RuntimeContainerd: "containerd.service",
+	RuntimeCRIO:       "crio.service",
+	RuntimeDocker:     "docker.service",
+}
+
+// CRIRuntime is the container runtime the kubelet of the worker uses
+type CRIRuntime struct {
+	// Name is the runtime, e.g. containerd or cri-o
+	Name string
+	// Socket is the socket of the runtime, unix:// prefixed
+	Socket string
+	// Managed tells if the runtime is the containerd managed by k0s
+	Managed bool
+}
+
+// SocketPath returns the path of the runtime socket without the unix:// prefix
+func (r CRIRuntime) SocketPath() string {
+	return strings.TrimPrefix(r.Socket, "unix://")
+}
+
+// DetectCRIRuntime returns the runtime behind the --cri-socket, the k0s managed containerd if criSocket is empty.
+// The name of a remote runtime is asked from the runtime itself, so it has to be running already.
+func DetectCRIRuntime(ctx context.Context, k0sVars constant.CfgVars, criSocket string) (CRIRuntime, error) {
+	if criSocket == "" {
+		return CRIRuntime{
+			Name:    RuntimeContainerd,
+			Socket:  "unix://" + filepath.Join(k0sVars.RunDir, "containerd.sock"),
+			Managed: true,
+		}, nil
+	}
+
+	rtType, rtSock, err := splitRuntimeConfig(criSocket)
+	if err != nil {
+		return CRIRuntime{}, err
+	}
+	if rtType == "docker" {
+		return CRIRuntime{Name: RuntimeDocker, Socket: rtSock}, nil
+	}
+
+	var name string
+	err = retry.Do(ctx, "detect the container runtime", func() error {
+		name, err = crictl.NewCriCtl(rtSock).RuntimeName()
+		return err
+	})
+	if err != nil {
+		return CRIRuntime{}, fmt.Errorf("failed to detect the container runtime at %s: %w", rtSock, err)
+	}
+	return CRIRuntime{Name: name, Socket: rtSock}, nil
+}
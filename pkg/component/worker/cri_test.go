@@ -0,0 +1,45 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestDetectCRIRuntime(t *testing.T) {
+	k0sVars := constant.GetConfig("/var/lib/k0s")
+
+	cri, err := DetectCRIRuntime(context.Background(), k0sVars, "")
+	require.NoError(t, err)
+	assert.True(t, cri.Managed)
+	assert.Equal(t, RuntimeContainerd, cri.Name)
+	assert.Equal(t, k0sVars.RunDir+"/containerd.sock", cri.SocketPath())
+
+	cri, err = DetectCRIRuntime(context.Background(), k0sVars, "docker:unix:///var/run/docker.sock")
+	require.NoError(t, err)
+	assert.False(t, cri.Managed)
+	assert.Equal(t, RuntimeDocker, cri.Name)
+	assert.Equal(t, "/var/run/docker.sock", cri.SocketPath())
+
+	_, err = DetectCRIRuntime(context.Background(), k0sVars, "crio:unix:///var/run/crio/crio.sock")
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/pkg/hostsfile"
+)
+
+// HostAliases keeps the k0s managed block of the hosts file in sync with the spec.hostAliases of the cluster
+type HostAliases struct {
+	KubeletConfigClient *KubeletConfigClient
+	Profile             string
+
+	log    *logrus.Entry
+	stopCh chan struct{}
+}
+
+// Init does nothing
+func (h *HostAliases) Init() error {
+	h.log = logrus.WithField("component", "hostaliases")
+	return nil
+}
+
+// Run updates the hosts file right away and then every minute
+func (h *HostAliases) Run() error {
+	h.stopCh = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			if err := h.sync(); err != nil {
+				h.log.Warnf("failed to update host aliases: %s", err.Error())
+			}
+			select {
+			case <-ticker.C:
+			case <-h.stopCh:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (h *HostAliases) sync() error {
+	entries, err := h.KubeletConfigClient.GetHostAliases(h.Profile)
+	if err != nil {
+		return err
+	}
+	return hostsfile.Update(hostsfile.DefaultPath, entries)
+}
+
+// Stop stops the syncing, the entries are left in place until k0s reset
+func (h *HostAliases) Stop() error {
+	if h.stopCh != nil {
+		close(h.stopCh)
+	}
+	return nil
+}
+
+// Healthy is a no-op healthchecker
+func (h *HostAliases) Healthy() error { return nil }
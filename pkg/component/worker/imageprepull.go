@@ -0,0 +1,272 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/crictl"
+	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+// imagePrePullRetryInterval is the time after which the failed images are pulled again
+const imagePrePullRetryInterval = 5 * time.Minute
+
+var imagePrePullGVR = schema.GroupVersionResource{
+	Group:    "images.k0sproject.io",
+	Version:  "v1beta1",
+	Resource: "imageprepulls",
+}
+
+type imagePrePull struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              imagePrePullSpec   `json:"spec"`
+	Status            imagePrePullStatus `json:"status"`
+}
+
+type imagePrePullSpec struct {
+	Images       []string          `json:"images"`
+	NodeSelector map[string]string `json:"nodeSelector"`
+	Parallelism  int               `json:"parallelism"`
+	Schedule     string            `json:"schedule"`
+}
+
+type imagePrePullStatus struct {
+	Nodes map[string]imagePrePullNodeStatus `json:"nodes"`
+}
+
+type imagePrePullNodeStatus struct {
+	ObservedGeneration int64       `json:"observedGeneration"`
+	LastPullTime       metav1.Time `json:"lastPullTime"`
+	Pulled             int         `json:"pulled"`
+	Failed             []string    `json:"failed,omitempty"`
+}
+
+// ImagePrePuller pulls the images of the ImagePrePull objects selecting the node with the CRI of the worker
+type ImagePrePuller struct {
+	K0sVars   constant.CfgVars
+	CRISocket string
+	// KubeletExtraArgs are the extra args of kubelet, for the --hostname-override of the node name
+	KubeletExtraArgs string
+
+	log      *logrus.Entry
+	cancel   context.CancelFunc
+	nodeName string
+}
+
+// Init resolves the node name the same way kubelet does
+func (i *ImagePrePuller) Init() error {
+	i.log = logrus.WithField("component", "imageprepull")
+	nodeName, err := kubeletNodeName(i.KubeletExtraArgs)
+	if err != nil {
+		return fmt.Errorf("can't resolve hostname for image pre-puller: %v", err)
+	}
+	i.nodeName = nodeName
+	return nil
+}
+
+// Run checks the ImagePrePull objects every minute in the background
+func (i *ImagePrePuller) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	go i.run(ctx)
+	return nil
+}
+
+func (i *ImagePrePuller) run(ctx context.Context) {
+	// the kubelet creates its kubeconfig only after it has bootstrapped
+	var kubeClient kubernetes.Interface
+	var dynamicClient dynamic.Interface
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if kubeClient == nil {
+			var err error
+			kubeClient, dynamicClient, err = i.clients()
+			if err != nil {
+				i.log.WithError(err).Debug("kubelet kubeconfig not available yet")
+			}
+		}
+		if kubeClient != nil {
+			if err := i.sync(ctx, kubeClient, dynamicClient); err != nil && ctx.Err() == nil {
+				i.log.WithError(err).Warn("failed to pre-pull images")
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (i *ImagePrePuller) clients() (kubernetes.Interface, dynamic.Interface, error) {
+	kubeClient, err := k8sutil.NewClient(i.K0sVars.KubeletAuthConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClient, err := k8sutil.NewDynamicClient(i.K0sVars.KubeletAuthConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kubeClient, dynamicClient, nil
+}
+
+func (i *ImagePrePuller) sync(ctx context.Context, kubeClient kubernetes.Interface, dynamicClient dynamic.Interface) error {
+	list, err := dynamicClient.Resource(imagePrePullGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("can't fetch image pre-pulls: %v", err)
+	}
+	if len(list.Items) == 0 {
+		return nil
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(ctx, i.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range list.Items {
+		var prePull imagePrePull
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &prePull); err != nil {
+			i.log.WithError(err).Warnf("invalid image pre-pull %s", item.GetName())
+			continue
+		}
+		if !labels.SelectorFromSet(prePull.Spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		var schedule cron.Schedule
+		if prePull.Spec.Schedule != "" {
+			if schedule, err = cron.ParseStandard(prePull.Spec.Schedule); err != nil {
+				i.log.WithError(err).Warnf("invalid schedule in image pre-pull %s, pulling the images only once", prePull.Name)
+			}
+		}
+		status, found := prePull.Status.Nodes[i.nodeName]
+		if !prePullDue(prePull.Generation, schedule, status, found, time.Now()) {
+			continue
+		}
+
+		i.log.Infof("pre-pulling %d images of %s", len(prePull.Spec.Images), prePull.Name)
+		status = i.pull(ctx, prePull)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := i.updateStatus(ctx, dynamicClient, prePull.Name, status); err != nil {
+			i.log.WithError(err).Warnf("failed to update the status of image pre-pull %s", prePull.Name)
+		}
+	}
+	return nil
+}
+
+// prePullDue tells if the images are pulled now: the first time, after the spec has changed, when the schedule is due
+// and when some of the images failed a while ago
+func prePullDue(generation int64, schedule cron.Schedule, status imagePrePullNodeStatus, found bool, now time.Time) bool {
+	if !found || status.ObservedGeneration != generation {
+		return true
+	}
+	if len(status.Failed) > 0 && !now.Before(status.LastPullTime.Add(imagePrePullRetryInterval)) {
+		return true
+	}
+	return schedule != nil && !now.Before(schedule.Next(status.LastPullTime.Time))
+}
+
+// pull pulls the images with the parallelism of the pre-pull
+func (i *ImagePrePuller) pull(ctx context.Context, prePull imagePrePull) imagePrePullNodeStatus {
+	cri, err := DetectCRIRuntime(ctx, i.K0sVars, i.CRISocket)
+	status := imagePrePullNodeStatus{ObservedGeneration: prePull.Generation}
+	if err != nil {
+		status.Failed = []string{err.Error()}
+		status.LastPullTime = metav1.Now()
+		return status
+	}
+	socket := cri.Socket
+	if cri.Name == RuntimeDocker {
+		socket = "unix:///var/run/dockershim.sock"
+	}
+	client := crictl.NewCriCtl(socket)
+
+	parallelism := prePull.Spec.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+	for _, image := range prePull.Spec.Images {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(image string) {
+			defer func() { <-sem; wg.Done() }()
+			err := client.PullImage(ctx, image)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				i.log.WithError(err).Warnf("failed to pre-pull %s", image)
+				status.Failed = append(status.Failed, err.Error())
+				return
+			}
+			status.Pulled++
+		}(image)
+	}
+	wg.Wait()
+	status.LastPullTime = metav1.Now()
+	return status
+}
+
+// updateStatus records the result of the pull of this node into the ImagePrePull status
+func (i *ImagePrePuller) updateStatus(ctx context.Context, client dynamic.Interface, name string, status imagePrePullNodeStatus) error {
+	nodeStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := client.Resource(imagePrePullGVR).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(latest.Object, nodeStatus, "status", "nodes", i.nodeName); err != nil {
+			return err
+		}
+		_, err = client.Resource(imagePrePullGVR).UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// Stop stops pre-pulling, the pulls in progress are cancelled
+func (i *ImagePrePuller) Stop() error {
+	if i.cancel != nil {
+		i.cancel()
+	}
+	return nil
+}
+
+// Healthy is a no-op healthchecker
+func (i *ImagePrePuller) Healthy() error { return nil }
@@ -0,0 +1,45 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrePullDue(t *testing.T) {
+	lastPull := time.Date(2021, 3, 1, 2, 0, 0, 0, time.UTC)
+	pulled := imagePrePullNodeStatus{ObservedGeneration: 1, LastPullTime: metav1.NewTime(lastPull), Pulled: 2}
+
+	assert.True(t, prePullDue(1, nil, imagePrePullNodeStatus{}, false, lastPull), "never pulled")
+	assert.False(t, prePullDue(1, nil, pulled, true, lastPull.Add(24*time.Hour)), "pulled once")
+	assert.True(t, prePullDue(2, nil, pulled, true, lastPull.Add(time.Minute)), "spec changed")
+
+	failed := pulled
+	failed.Failed = []string{"failed to pull registry.example.com/app:2.0.0"}
+	assert.False(t, prePullDue(1, nil, failed, true, lastPull.Add(time.Minute)))
+	assert.True(t, prePullDue(1, nil, failed, true, lastPull.Add(imagePrePullRetryInterval)))
+
+	schedule, err := cron.ParseStandard("0 2 * * *")
+	require.NoError(t, err)
+	assert.False(t, prePullDue(1, schedule, pulled, true, lastPull.Add(23*time.Hour)))
+	assert.True(t, prePullDue(1, schedule, pulled, true, lastPull.Add(24*time.Hour)))
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package worker
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -24,16 +25,17 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
-	"time"
 
-	"github.com/avast/retry-go"
 	"github.com/docker/libnetwork/resolvconf"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/internal/util"
 	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/fips"
 	"github.com/k0sproject/k0s/pkg/supervisor"
 )
 
@@ -49,7 +51,23 @@ type Kubelet struct {
 	supervisor          supervisor.Supervisor
 	ClusterDNS          string
 	Labels              []string
+	Taints              []string
 	ExtraArgs           string
+	FIPS                bool
+	// RequestedLabels are the labels kubelet isn't allowed to set, the controllers set them if allowed
+	RequestedLabels []string
+	// ProviderID is the provider ID kubelet registers the node with
+	ProviderID string
+	// Rootless tells if kubelet runs in the user namespace of a rootless worker, without access to the cgroups
+	Rootless bool
+
+	// profile is the worker profile in use, Profile or the one of the node annotation
+	profile   string
+	nodeName  string
+	args      util.MappedArgs
+	extraArgs util.MappedArgs
+	cancel    context.CancelFunc
+	inhibitor *shutdownInhibitor
 }
 
 // Init extracts the needed binaries
@@ -101,6 +119,12 @@ func (k *Kubelet) Run() error {
 	if len(k.Labels) > 0 {
 		args["--node-labels"] = strings.Join(k.Labels, ",")
 	}
+	if len(k.Taints) > 0 {
+		args["--register-with-taints"] = strings.Join(k.Taints, ",")
+	}
+	if k.ProviderID != "" {
+		args["--provider-id"] = k.ProviderID
+	}
 
 	if runtime.GOOS == "windows" {
 		node, err := getNodeName()
@@ -109,7 +133,7 @@ func (k *Kubelet) Run() error {
 		}
 		args["--cgroups-per-qos"] = "false"
 		args["--enforce-node-allocatable"] = ""
-		args["--pod-infra-container-image"] = "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"
+		args["--pod-infra-container-image"] = constant.KubePauseWindowsContainerImage
 		args["--network-plugin"] = "cni"
 		args["--cni-bin-dir"] = "C:\\k\\cni"
 		args["--cni-conf-dir"] = "C:\\k\\cni\\config"
@@ -140,6 +164,9 @@ func (k *Kubelet) Run() error {
 		} else {
 			args["--container-runtime-endpoint"] = rtSock
 		}
+		if runtime.GOOS != "windows" {
+			k.setRuntimeArgs(args)
+		}
 	} else {
 		sockPath := path.Join(k.K0sVars.RunDir, "containerd.sock")
 		args["--container-runtime"] = "remote"
@@ -147,15 +174,80 @@ func (k *Kubelet) Run() error {
 		args["--containerd"] = sockPath
 	}
 
+	if k.Rootless {
+		// the cgroups aren't delegated to the user namespace, kubelet can neither create nor move processes to them
+		args["--cgroups-per-qos"] = "false"
+		args["--enforce-node-allocatable"] = ""
+		delete(args, "--kube-reserved-cgroup")
+		delete(args, "--runtime-cgroups")
+		delete(args, "--kubelet-cgroups")
+	}
+
 	// We only support external providers
 	if k.EnableCloudProvider {
 		args["--cloud-provider"] = "external"
 	}
 
+	if k.FIPS {
+		for name, value := range fips.KubeArgs() {
+			args["--"+name] = value
+		}
+	}
+
 	// Handle the extra args as last so they can be used to overrride some k0s "hardcodings"
 	if k.ExtraArgs != "" {
-		extras := util.SplitFlags(k.ExtraArgs)
-		args.Merge(extras)
+		k.extraArgs = util.SplitFlags(k.ExtraArgs)
+		args.Merge(k.extraArgs)
+	}
+
+	// the node name is needed for reading the worker profile annotation of the node
+	if override := args["--hostname-override"]; override != "" {
+		k.nodeName = override
+	} else {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("can't get hostname: %v", err)
+		}
+		k.nodeName = strings.ToLower(hostname)
+	}
+
+	// the profile of the node annotation wins over --profile once the node has registered
+	var cfg *kubeletProfileConfig
+	if profile := k.nodeProfile(); profile != "" && profile != k.Profile {
+		err := retry.Do(context.Background(), "fetch kubelet config", func() (err error) {
+			cfg, err = k.writeConfig(profile, kubeletConfigPath)
+			return err
+		}, retry.Attempts(3))
+		if err != nil {
+			logrus.WithError(err).Warnf("can't use worker profile %s of the node annotation, using %s", profile, k.Profile)
+		} else {
+			logrus.Infof("using worker profile %s of the node annotation", profile)
+			k.profile = profile
+		}
+	}
+	if cfg == nil {
+		k.profile = k.Profile
+		err := retry.Do(context.Background(), "fetch kubelet config", func() (err error) {
+			cfg, err = k.writeConfig(k.profile, kubeletConfigPath)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		logPreflightWarnings(k.K0sVars.DataDir, cfg.kubeletConfig, cfg.hugepages)
+	}
+
+	k.args = args
+	k.setCredentialProviderArgs(cfg)
+	k.inhibitor = newShutdownInhibitor()
+	k.setShutdownGracePeriod(cfg)
+
+	// the cloud provider is external when the cluster runs a cloud controller manager deployed by k0s
+	if cfg.cloudProvider != "" && args["--cloud-provider"] == "" {
+		args["--cloud-provider"] = cfg.cloudProvider
 	}
 
 	logrus.Infof("starting kubelet with args: %v", args)
@@ -167,31 +259,140 @@ func (k *Kubelet) Run() error {
 		Args:    args.ToArgs(),
 	}
 
-	err := retry.Do(func() error {
-		kubeletconfig, err := k.KubeletConfigClient.Get(k.Profile)
+	if err := k.supervisor.Supervise(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+	go k.reconcileProfile(ctx, kubeletConfigPath)
+	go k.inhibitor.run(ctx)
+	return nil
+}
+
+// kubeletProfileConfig is the config of a worker profile needed on the worker
+type kubeletProfileConfig struct {
+	kubeletConfig []byte
+	hugepages     map[string]int64
+	cloudProvider string
+	// credentialProviderBinDir is the directory of the image credential provider plugins, empty without plugins
+	credentialProviderBinDir string
+}
+
+func (k *Kubelet) credentialProviderConfigPath() string {
+	return filepath.Join(k.dataDir, "credential-providers.yaml")
+}
+
+// setCredentialProviderArgs points kubelet to the image credential provider plugins of the profile, unless they are
+// given in the extra args
+func (k *Kubelet) setCredentialProviderArgs(cfg *kubeletProfileConfig) {
+	if k.extraArgs["--image-credential-provider-config"] != "" {
+		return
+	}
+	if cfg.credentialProviderBinDir == "" {
+		delete(k.args, "--image-credential-provider-config")
+		delete(k.args, "--image-credential-provider-bin-dir")
+		return
+	}
+	k.args["--image-credential-provider-config"] = k.credentialProviderConfigPath()
+	k.args["--image-credential-provider-bin-dir"] = cfg.credentialProviderBinDir
+}
+
+// setShutdownGracePeriod makes the host shutdown wait for the graceful node shutdown of kubelet
+func (k *Kubelet) setShutdownGracePeriod(cfg *kubeletProfileConfig) {
+	if k.inhibitor == nil {
+		return
+	}
+	gracePeriod, err := shutdownGracePeriod(cfg.kubeletConfig)
+	if err != nil {
+		logrus.WithError(err).Warn("not delaying the host shutdown")
+	}
+	k.inhibitor.setGracePeriod(gracePeriod)
+}
+
+// writeConfig fetches the config of the worker profile and writes the kubelet config. The config is written only
+// after all of it has been fetched, so that a failed fetch leaves the previous config in place.
+func (k *Kubelet) writeConfig(profile string, kubeletConfigPath string) (*kubeletProfileConfig, error) {
+	kubeletconfig, err := k.KubeletConfigClient.Get(profile)
+	if err != nil {
+		logrus.Warnf("failed to get initial kubelet config with join token: %s", err.Error())
+		return nil, err
+	}
+
+	throttling, err := k.KubeletConfigClient.GetAPIThrottling(profile)
+	if err != nil {
+		return nil, err
+	}
+	if throttling == "adaptive" {
+		adapted, err := applyAdaptiveAPIThrottling([]byte(kubeletconfig), runtime.NumCPU())
 		if err != nil {
-			logrus.Warnf("failed to get initial kubelet config with join token: %s", err.Error())
-			return err
+			return nil, err
 		}
+		kubeletconfig = string(adapted)
+	}
 
-		err = ioutil.WriteFile(kubeletConfigPath, []byte(kubeletconfig), constant.CertSecureMode)
+	withDropIns, dropIns, err := applyKubeletDropIns([]byte(kubeletconfig), k.K0sVars.KubeletConfigDropInDir)
+	if err != nil {
+		// a broken drop-in is fixed on the node, fetching the config again won't help
+		return nil, retry.Unrecoverable(err)
+	}
+	if len(dropIns) > 0 {
+		logrus.Infof("applying kubelet config drop-ins %s", strings.Join(dropIns, ", "))
+	}
+
+	cfg := &kubeletProfileConfig{kubeletConfig: withDropIns}
+	if cfg.hugepages, err = k.KubeletConfigClient.GetHugepages(profile); err != nil {
+		return nil, err
+	}
+	if cfg.cloudProvider, err = k.KubeletConfigClient.GetCloudProvider(profile); err != nil {
+		return nil, err
+	}
+	credentialProviders, err := k.KubeletConfigClient.GetCredentialProviders(profile)
+	if err != nil {
+		return nil, err
+	}
+	if credentialProviders != nil {
+		data, err := yaml.Marshal(credentialProviders.CredentialProviderConfig())
 		if err != nil {
-			return errors.Wrap(err, "failed to write kubelet config to disk")
+			return nil, err
 		}
+		if err := ioutil.WriteFile(k.credentialProviderConfigPath(), data, constant.CertSecureMode); err != nil {
+			return nil, errors.Wrap(err, "failed to write kubelet credential provider config to disk")
+		}
+		cfg.credentialProviderBinDir = credentialProviders.GetBinDir()
+	}
 
-		return nil
-	},
-		retry.Delay(time.Millisecond*500),
-		retry.DelayType(retry.BackOffDelay))
+	if err := ioutil.WriteFile(kubeletConfigPath, cfg.kubeletConfig, constant.CertSecureMode); err != nil {
+		return nil, errors.Wrap(err, "failed to write kubelet config to disk")
+	}
+	return cfg, resetCPUManagerState(k.dataDir, cfg.kubeletConfig)
+}
+
+// setRuntimeArgs sets the kubelet args depending on the external container runtime
+func (k *Kubelet) setRuntimeArgs(args util.MappedArgs) {
+	cri, err := DetectCRIRuntime(context.Background(), k.K0sVars, k.CRISocket)
 	if err != nil {
-		return err
+		logrus.WithError(err).Warn("not setting the runtime cgroups of kubelet")
+		delete(args, "--runtime-cgroups")
+		return
 	}
+	logrus.Infof("using the %s container runtime at %s", cri.Name, cri.Socket)
 
-	return k.supervisor.Supervise()
+	if service, ok := runtimeServices[cri.Name]; ok {
+		args["--runtime-cgroups"] = "/system.slice/" + service
+	} else {
+		delete(args, "--runtime-cgroups")
+	}
+	// the pause image of the remote runtimes is set in their own config, dockershim takes it from kubelet
+	if cri.Name == RuntimeDocker {
+		args["--pod-infra-container-image"] = fmt.Sprintf("%s:%s", constant.KubePauseContainerImage, constant.KubePauseContainerImageVersion)
+	}
 }
 
 // Stop stops kubelet
 func (k *Kubelet) Stop() error {
+	if k.cancel != nil {
+		k.cancel()
+	}
 	return k.supervisor.Stop()
 }
 
@@ -212,6 +413,21 @@ func splitRuntimeConfig(rtConfig string) (string, string, error) {
 	return runtimeType, runtimeSocket, nil
 }
 
+// kubeletNodeName returns the name kubelet registers the node with when it's run with the given extra args
+func kubeletNodeName(extraArgs string) (string, error) {
+	if override := util.SplitFlags(extraArgs)["--hostname-override"]; override != "" {
+		return override, nil
+	}
+	if runtime.GOOS == "windows" {
+		return getNodeName()
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(hostname), nil
+}
+
 const awsMetaInformationURI = "http://169.254.169.254/latest/meta-data/local-hostname"
 
 func getNodeName() (string, error) {
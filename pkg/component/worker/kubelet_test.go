@@ -65,3 +65,9 @@ func TestCRISocketParsing(t *testing.T) {
 	}
 
 }
+
+func TestKubeletNodeName(t *testing.T) {
+	nodeName, err := kubeletNodeName("--v=2 --hostname-override=worker-1.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "worker-1.example.com", nodeName)
+}
@@ -18,10 +18,14 @@ package worker
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
 	"github.com/k0sproject/k0s/pkg/constant"
 	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -45,14 +49,132 @@ func NewKubeletConfigClient(kubeconfigPath string) (*KubeletConfigClient, error)
 
 // Get reads the config from kube api
 func (k *KubeletConfigClient) Get(profile string) (string, error) {
-	cmName := fmt.Sprintf("kubelet-config-%s-%s", profile, constant.KubernetesMajorMinorVersion)
-	cm, err := k.kubeClient.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), cmName, v1.GetOptions{})
+	cm, err := k.getConfigMap(profile)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get kubelet config from API")
+		return "", err
 	}
 	config := cm.Data["kubelet"]
 	if config == "" {
-		return "", fmt.Errorf("no config found with key 'kubelet' in %s", cmName)
+		return "", fmt.Errorf("no config found with key 'kubelet' in %s", cm.Name)
 	}
 	return config, nil
 }
+
+// GetHugepages reads the hugepages the profile expects to be pre-allocated on the node
+func (k *KubeletConfigClient) GetHugepages(profile string) (map[string]int64, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return nil, err
+	}
+	hugepages := make(map[string]int64)
+	if err := yaml.Unmarshal([]byte(cm.Data["hugepages"]), &hugepages); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse hugepages in %s", cm.Name)
+	}
+	return hugepages, nil
+}
+
+// GetAPIThrottling reads the kubelet API throttling mode of the profile, "adaptive" or empty
+func (k *KubeletConfigClient) GetAPIThrottling(profile string) (string, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return "", err
+	}
+	return cm.Data["apiThrottling"], nil
+}
+
+// GetHostAliases reads the spec.hostAliases entries to add to the hosts file of the node
+func (k *KubeletConfigClient) GetHostAliases(profile string) (string, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return "", err
+	}
+	return cm.Data["hosts"], nil
+}
+
+// GetCloudProvider reads the --cloud-provider of kubelet, "external" when the cluster runs a cloud controller manager
+func (k *KubeletConfigClient) GetCloudProvider(profile string) (string, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return "", err
+	}
+	return cm.Data["cloudProvider"], nil
+}
+
+// GetContainerRuntimes reads the extra runtime handlers of the k0s managed containerd, e.g. nvidia
+func (k *KubeletConfigClient) GetContainerRuntimes(profile string) ([]string, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return nil, err
+	}
+	if cm.Data["containerRuntimes"] == "" {
+		return nil, nil
+	}
+	return strings.Split(cm.Data["containerRuntimes"], ","), nil
+}
+
+// GetRegistries reads the registries of the k0s managed containerd
+func (k *KubeletConfigClient) GetRegistries(profile string) (v1beta1.Registries, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return nil, err
+	}
+	var registries v1beta1.Registries
+	if err := yaml.Unmarshal([]byte(cm.Data["registries"]), &registries); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse registries in %s", cm.Name)
+	}
+	return registries, nil
+}
+
+// GetPeerMirror reads the peer mirror config with the defaults applied, nil if the peer mirror isn't enabled
+func (k *KubeletConfigClient) GetPeerMirror(profile string) (*v1beta1.PeerMirrorSpec, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return nil, err
+	}
+	if cm.Data["peerMirror"] == "" {
+		return nil, nil
+	}
+	var peerMirror v1beta1.PeerMirrorSpec
+	if err := yaml.Unmarshal([]byte(cm.Data["peerMirror"]), &peerMirror); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse peer mirror in %s", cm.Name)
+	}
+	return &peerMirror, nil
+}
+
+// GetCredentialProviders reads the image credential provider plugins of kubelet, nil if the profile has none
+func (k *KubeletConfigClient) GetCredentialProviders(profile string) (*v1beta1.KubeletCredentialProviders, error) {
+	cm, err := k.getConfigMap(profile)
+	if err != nil {
+		return nil, err
+	}
+	if cm.Data["credentialProviders"] == "" {
+		return nil, nil
+	}
+	var credentialProviders v1beta1.KubeletCredentialProviders
+	if err := yaml.Unmarshal([]byte(cm.Data["credentialProviders"]), &credentialProviders); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse credential providers in %s", cm.Name)
+	}
+	return &credentialProviders, nil
+}
+
+// GetRegistryAuth reads the docker config.json of a registry auth Secret
+func (k *KubeletConfigClient) GetRegistryAuth(secretName string) ([]byte, error) {
+	secret, err := k.kubeClient.CoreV1().Secrets("kube-system").Get(context.TODO(), secretName, v1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get registry auth secret %s", secretName)
+	}
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return nil, fmt.Errorf("no %s found in registry auth secret %s", corev1.DockerConfigJsonKey, secretName)
+	}
+	return data, nil
+}
+
+func (k *KubeletConfigClient) getConfigMap(profile string) (*corev1.ConfigMap, error) {
+	cmName := fmt.Sprintf("kubelet-config-%s-%s", profile, constant.KubernetesMajorMinorVersion)
+	cm, err := k.kubeClient.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), cmName, v1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubelet config from API")
+	}
+	return cm, nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+// applyKubeletDropIns merges the KubeletConfiguration fragments of the *.conf and *.yaml files of the drop-in
+// directory into the kubelet config in the lexical order of the file names, like the kubelet --config-dir of the
+// later Kubernetes versions: the mappings are merged, the other values, lists included, are replaced. The drop-ins
+// are validated against the schema of the bundled kubelet.
+func applyKubeletDropIns(kubeletConfig []byte, dir string) ([]byte, []string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return kubeletConfig, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := make(map[string]interface{})
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse kubelet config: %v", err)
+	}
+	var applied []string
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || (ext != ".conf" && ext != ".yaml") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		dropIn := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &dropIn); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse kubelet drop-in %s: %v", file.Name(), err)
+		}
+		if v, found := dropIn["apiVersion"]; found && v != v1beta1.KubeletConfigurationAPIVersion {
+			return nil, nil, fmt.Errorf("kubelet drop-in %s: apiVersion must be %s, got %v", file.Name(), v1beta1.KubeletConfigurationAPIVersion, v)
+		}
+		if v, found := dropIn["kind"]; found && v != v1beta1.KubeletConfigurationKind {
+			return nil, nil, fmt.Errorf("kubelet drop-in %s: kind must be %s, got %v", file.Name(), v1beta1.KubeletConfigurationKind, v)
+		}
+		if err := v1beta1.ValidateKubeletConfiguration(dropIn); err != nil {
+			return nil, nil, fmt.Errorf("kubelet drop-in %s: %v", file.Name(), err)
+		}
+		delete(dropIn, "apiVersion")
+		delete(dropIn, "kind")
+		mergeKubeletConfig(config, dropIn)
+		applied = append(applied, file.Name())
+	}
+	if len(applied) == 0 {
+		return kubeletConfig, nil, nil
+	}
+
+	merged, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, applied, nil
+}
+
+// mergeKubeletConfig merges src into dst recursively, the values of src win
+func mergeKubeletConfig(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := stringMap(value)
+		dstMap, dstIsMap := stringMap(dst[key])
+		if srcIsMap && dstIsMap {
+			mergeKubeletConfig(dstMap, srcMap)
+			dst[key] = dstMap
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// stringMap returns a copy of the yaml mapping keyed with strings
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			result[key] = value
+		}
+		return result, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			result[fmt.Sprintf("%v", key)] = value
+		}
+		return result, true
+	}
+	return nil, false
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const dropInBaseConfig = `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 110
+evictionHard:
+  memory.available: 100Mi
+  nodefs.available: 10%
+`
+
+func TestApplyKubeletDropIns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubelet-dropins")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("missing directory keeps the config", func(t *testing.T) {
+		config, applied, err := applyKubeletDropIns([]byte(dropInBaseConfig), filepath.Join(dir, "missing"))
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+		assert.Equal(t, dropInBaseConfig, string(config))
+	})
+
+	t.Run("drop-ins are merged in order", func(t *testing.T) {
+		files := map[string]string{
+			"10-eviction.conf": "evictionHard:\n  memory.available: 500Mi\nmaxPods: 150\n",
+			"20-pods.yaml":     "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\nmaxPods: 200\n",
+			"README":           "not a drop-in",
+		}
+		for name, content := range files {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+		}
+
+		data, applied, err := applyKubeletDropIns([]byte(dropInBaseConfig), dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10-eviction.conf", "20-pods.yaml"}, applied)
+
+		config := make(map[string]interface{})
+		require.NoError(t, yaml.Unmarshal(data, &config))
+		assert.Equal(t, 200, config["maxPods"])
+		assert.Equal(t, "KubeletConfiguration", config["kind"])
+		assert.Equal(t, map[interface{}]interface{}{"memory.available": "500Mi", "nodefs.available": "10%"}, config["evictionHard"])
+	})
+
+	t.Run("invalid drop-in is rejected", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "30-typo.conf"), []byte("maxPod: 300\n"), 0600))
+		_, _, err := applyKubeletDropIns([]byte(dropInBaseConfig), dir)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"strings"
+
+	"github.com/k0sproject/k0s/pkg/token"
+)
+
+// SplitNodeLabels splits the key=value labels into the ones kubelet sets when registering the node and the ones
+// kubelet isn't allowed to set, which are requested from the controllers with a node annotation
+func SplitNodeLabels(labels []string) ([]string, []string) {
+	var kubelet, requested []string
+	for _, label := range labels {
+		key := strings.SplitN(label, "=", 2)[0]
+		if token.IsKubeletLabel(key) {
+			kubelet = append(kubelet, label)
+		} else {
+			requested = append(requested, label)
+		}
+	}
+	return kubelet, requested
+}
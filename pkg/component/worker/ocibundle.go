@@ -2,29 +2,42 @@ package worker
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
-	"github.com/avast/retry-go"
 	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/remotes"
+	"github.com/k0sproject/k0s/internal/retry"
 	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/airgap"
 	"github.com/k0sproject/k0s/pkg/constant"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
-// OCIBundleReconciler tries to import OCI bundle into the running containerd instance
+// OCIBundleReconciler tries to import OCI bundle into the running container runtime
 type OCIBundleReconciler struct {
-	k0sVars constant.CfgVars
-	log     *logrus.Entry
+	k0sVars   constant.CfgVars
+	criSocket string
+	log       *logrus.Entry
+
+	// BundleRefs are the references of the bundle artifacts pulled into the bundles directory before importing
+	BundleRefs []string
+	// RegistryAuthFile is the docker config.json with the credentials of the registry of the bundle artifacts
+	RegistryAuthFile string
 }
 
-// NewOCIBundleReconciler builds new reconciler
-func NewOCIBundleReconciler(vars constant.CfgVars) *OCIBundleReconciler {
+// NewOCIBundleReconciler builds new reconciler, criSocket is the --cri-socket of an external runtime
+func NewOCIBundleReconciler(vars constant.CfgVars, criSocket string) *OCIBundleReconciler {
 	return &OCIBundleReconciler{
-		k0sVars: vars,
-		log:     logrus.WithField("component", "OCIBundleReconciler"),
+		k0sVars:   vars,
+		criSocket: criSocket,
+		log:       logrus.WithField("component", "OCIBundleReconciler"),
 	}
 }
 
@@ -33,6 +46,12 @@ func (a *OCIBundleReconciler) Init() error {
 }
 
 func (a *OCIBundleReconciler) Run() error {
+	if len(a.BundleRefs) > 0 {
+		// the bundles pulled earlier are still imported if the registry can't be reached
+		if err := a.pullBundles(); err != nil {
+			a.log.WithError(err).Error("can't pull the bundle artifacts")
+		}
+	}
 	files, err := ioutil.ReadDir(a.k0sVars.OCIBundleDir)
 	if err != nil {
 		return fmt.Errorf("can't read bundles directory")
@@ -40,15 +59,108 @@ func (a *OCIBundleReconciler) Run() error {
 	if len(files) == 0 {
 		return nil
 	}
+
+	cri, err := DetectCRIRuntime(context.Background(), a.k0sVars, a.criSocket)
+	if err != nil {
+		return err
+	}
+	var bundles []string
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		bundles = append(bundles, a.k0sVars.OCIBundleDir+"/"+file.Name())
+	}
+
+	switch cri.Name {
+	case RuntimeContainerd:
+		return a.importContainerd(cri.SocketPath(), bundles)
+	case RuntimeDocker:
+		return a.importCommand(bundles, "docker", "--host", cri.Socket, "load", "--input")
+	case RuntimeCRIO:
+		// CRI-O keeps the images in containers/storage, shared with podman
+		return a.importCommand(bundles, "podman", "load", "--input")
+	default:
+		return fmt.Errorf("can't import the image bundles into the %s container runtime", cri.Name)
+	}
+}
+
+// pullBundles pulls the bundle artifacts into the bundles directory. The file names have the digest of the bundle,
+// so a bundle is pulled again only when the tag has been moved, and the bundles of the previous tags are removed.
+func (a *OCIBundleReconciler) pullBundles() error {
+	resolver, err := airgap.NewResolver(a.RegistryAuthFile)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, ref := range a.BundleRefs {
+		if err := a.pullBundle(ctx, resolver, ref); err != nil {
+			a.log.WithError(err).Errorf("can't pull bundle %s", ref)
+		}
+	}
+	return nil
+}
+
+func (a *OCIBundleReconciler) pullBundle(ctx context.Context, resolver remotes.Resolver, ref string) error {
+	var fetcher remotes.Fetcher
+	var layer ocispec.Descriptor
+	err := retry.Do(ctx, "resolve bundle artifact", func() (err error) {
+		fetcher, layer, err = airgap.ResolveBundle(ctx, resolver, ref)
+		return err
+	}, retry.Attempts(3))
+	if err != nil {
+		return err
+	}
+
+	prefix := fmt.Sprintf("artifact-%x-", sha256.Sum256([]byte(ref)))[:len("artifact-")+12]
+	name := prefix + layer.Digest.Encoded()[:12] + ".tar"
+	path := filepath.Join(a.k0sVars.OCIBundleDir, name)
+	if !util.FileExists(path) {
+		a.log.Infof("pulling bundle %s", ref)
+		// the bundle is written into a hidden temporary file first, so that no partial bundle is ever imported
+		tmp := filepath.Join(a.k0sVars.OCIBundleDir, "."+name+".tmp")
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		if err := airgap.FetchBundle(ctx, fetcher, layer, f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+
+	files, err := ioutil.ReadDir(a.k0sVars.OCIBundleDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), prefix) && file.Name() != name {
+			if err := os.Remove(filepath.Join(a.k0sVars.OCIBundleDir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// importContainerd imports the bundles with the containerd client
+func (a *OCIBundleReconciler) importContainerd(sock string, bundles []string) error {
 	var client *containerd.Client
-	sock := filepath.Join(a.k0sVars.RunDir, "containerd.sock")
-	err = retry.Do(func() error {
+	err := retry.Do(context.Background(), "connect to containerd", func() error {
+		var err error
 		client, err = containerd.New(sock, containerd.WithDefaultNamespace("k8s.io"))
 		if err != nil {
 			logrus.WithError(err).Errorf("can't connect to containerd socket %s", sock)
 			return err
 		}
-		_, err := client.ListImages(context.Background())
+		_, err = client.ListImages(context.Background())
 		if err != nil {
 			logrus.WithError(err).Errorf("can't use containerd client")
 			return err
@@ -60,11 +172,26 @@ func (a *OCIBundleReconciler) Run() error {
 	}
 	defer client.Close()
 
-	for _, file := range files {
-		if err := a.unpackBundle(client, a.k0sVars.OCIBundleDir+"/"+file.Name()); err != nil {
-			logrus.WithError(err).Errorf("can't unpack bundle %s", file.Name())
-			return fmt.Errorf("can't unpack bundle %s: %w", file.Name(), err)
+	for _, bundle := range bundles {
+		if err := a.unpackBundle(client, bundle); err != nil {
+			logrus.WithError(err).Errorf("can't unpack bundle %s", bundle)
+			return fmt.Errorf("can't unpack bundle %s: %w", bundle, err)
+		}
+	}
+	return nil
+}
+
+// importCommand imports the bundles with the CLI of the container runtime, the bundle is added to the given args
+func (a *OCIBundleReconciler) importCommand(bundles []string, command string, args ...string) error {
+	if _, err := exec.LookPath(command); err != nil {
+		return fmt.Errorf("%s is needed to import the image bundles: %w", command, err)
+	}
+	for _, bundle := range bundles {
+		out, err := exec.Command(command, append(args, bundle)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("can't import bundle %s: %w: %s", bundle, err, out)
 		}
+		logrus.Infof("Imported bundle %s", bundle)
 	}
 	return nil
 }
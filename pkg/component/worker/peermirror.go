@@ -0,0 +1,388 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/k0sproject/k0s/internal/retry"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
+)
+
+// peerMirrorHeader marks the requests of the peers, they are served from the local content only
+const peerMirrorHeader = "X-K0s-Peer-Mirror"
+
+// maxManifestSize limits the manifests read for detecting their media type
+const maxManifestSize = 4 << 20
+
+var distributionPathRe = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs)/([^/]+)$`)
+
+// PeerMirror serves the images pulled by the k0s managed containerd to the other workers over the OCI distribution
+// API. The local containerd uses it as the first mirror of the mirrored registries, and it serves the content from the
+// local content store or the first peer that has it. The misses are answered with 404 so that containerd falls back
+// to the registry.
+type PeerMirror struct {
+	KubeletConfigClient *KubeletConfigClient
+	Profile             string
+	K0sVars             constant.CfgVars
+
+	log         *logrus.Entry
+	cancel      context.CancelFunc
+	client      *containerd.Client
+	resolveTags bool
+	port        int
+	peerClient  *http.Client
+
+	mu    sync.RWMutex
+	peers []string
+}
+
+// Init does nothing
+func (p *PeerMirror) Init() error {
+	p.log = logrus.WithField("component", "peermirror")
+	p.peerClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext:           (&net.Dialer{Timeout: time.Second}).DialContext,
+			ResponseHeaderTimeout: 2 * time.Second,
+		},
+	}
+	return nil
+}
+
+// Run starts the mirror in the background if it's enabled in the cluster config
+func (p *PeerMirror) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return nil
+}
+
+func (p *PeerMirror) run(ctx context.Context) {
+	var config *v1beta1.PeerMirrorSpec
+	err := retry.Do(ctx, "fetch peer mirror config", func() error {
+		var err error
+		config, err = p.KubeletConfigClient.GetPeerMirror(p.Profile)
+		return err
+	})
+	if err != nil {
+		p.log.WithError(err).Error("failed to fetch the peer mirror config, not serving the peers")
+		return
+	}
+	if config == nil {
+		return
+	}
+	p.port, p.resolveTags = config.Port, config.ResolveTags
+
+	err = retry.Do(ctx, "connect to containerd", func() error {
+		var err error
+		p.client, err = containerd.New(filepath.Join(p.K0sVars.RunDir, "containerd.sock"), containerd.WithDefaultNamespace("k8s.io"))
+		return err
+	})
+	if err != nil {
+		p.log.WithError(err).Error("failed to connect to containerd, not serving the peers")
+		return
+	}
+	defer p.client.Close()
+
+	server := &http.Server{Addr: fmt.Sprintf(":%d", p.port), Handler: p}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			p.log.WithError(err).Error("peer mirror failed")
+		}
+	}()
+	p.log.Infof("serving the peers on port %d", p.port)
+
+	// the kubelet creates its kubeconfig only after it has bootstrapped
+	var kubeClient kubernetes.Interface
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		if kubeClient == nil {
+			kubeClient, err = k8sutil.NewClient(p.K0sVars.KubeletAuthConfigPath)
+			if err != nil {
+				p.log.WithError(err).Debug("kubelet kubeconfig not available yet")
+			}
+		}
+		if kubeClient != nil {
+			if err := p.updatePeers(ctx, kubeClient); err != nil {
+				p.log.WithError(err).Warn("failed to update the peers")
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+			return
+		}
+	}
+}
+
+// updatePeers updates the mirrors of the other ready nodes
+func (p *PeerMirror) updatePeers(ctx context.Context, kubeClient kubernetes.Interface) error {
+	nodes, err := kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	peers := peerMirrorURLs(nodes.Items, strings.ToLower(hostname), p.port)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = peers
+	return nil
+}
+
+// peerMirrorURLs returns the mirror URLs of the ready nodes other than self
+func peerMirrorURLs(nodes []corev1.Node, self string, port int) []string {
+	var urls []string
+	for _, node := range nodes {
+		if node.Name == self || !nodeReady(node) {
+			continue
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == corev1.NodeInternalIP {
+				urls = append(urls, "http://"+net.JoinHostPort(address.Address, strconv.Itoa(port)))
+				break
+			}
+		}
+	}
+	return urls
+}
+
+func nodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// ServeHTTP serves the manifests and the blobs of the OCI distribution API
+func (p *PeerMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if r.URL.Path == "/v2" || r.URL.Path == "/v2/" {
+		return
+	}
+
+	name, kind, ref, ok := parseDistributionPath(r.URL.Path)
+	ns := r.URL.Query().Get("ns")
+	if !ok || !p.servable(ns, kind, ref) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	desc, err := p.resolve(r.Context(), ns, name, ref)
+	if err == nil {
+		p.serveContent(w, r, desc, kind)
+		return
+	}
+	if !errdefs.IsNotFound(err) {
+		p.log.WithError(err).Warnf("failed to resolve %s", r.URL.Path)
+	}
+	// the peers only serve their own content, the requests are never forwarded further
+	if r.Header.Get(peerMirrorHeader) == "" && p.servePeer(w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// parseDistributionPath splits /v2/<name>/<manifests|blobs>/<reference>
+func parseDistributionPath(path string) (name string, kind string, ref string, ok bool) {
+	match := distributionPathRe.FindStringSubmatch(path)
+	if match == nil {
+		return "", "", "", false
+	}
+	return match[1], match[2], match[3], true
+}
+
+// servable tells if the mirror serves the reference. The tags are served only if enabled and the registry is known
+// from the ns query parameter added by containerd.
+func (p *PeerMirror) servable(ns, kind, ref string) bool {
+	if _, err := digest.Parse(ref); err == nil {
+		return true
+	}
+	return kind == "manifests" && p.resolveTags && ns != ""
+}
+
+// resolve looks up the descriptor of the content from the local containerd
+func (p *PeerMirror) resolve(ctx context.Context, ns, name, ref string) (ocispec.Descriptor, error) {
+	if dgst, err := digest.Parse(ref); err == nil {
+		info, err := p.client.ContentStore().Info(ctx, dgst)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		return ocispec.Descriptor{Digest: info.Digest, Size: info.Size}, nil
+	}
+	image, err := p.client.ImageService().Get(ctx, fmt.Sprintf("%s/%s:%s", ns, name, ref))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return image.Target, nil
+}
+
+func (p *PeerMirror) serveContent(w http.ResponseWriter, r *http.Request, desc ocispec.Descriptor, kind string) {
+	ra, err := p.client.ContentStore().ReaderAt(r.Context(), desc)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer ra.Close()
+	content := io.NewSectionReader(ra, 0, ra.Size())
+
+	mediaType := desc.MediaType
+	if mediaType == "" && kind == "manifests" {
+		manifest, err := ioutil.ReadAll(io.LimitReader(content, maxManifestSize))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mediaType = manifestMediaType(manifest)
+		content = io.NewSectionReader(ra, 0, ra.Size())
+	}
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.FormatInt(ra.Size(), 10))
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, content); err != nil {
+		p.log.WithError(err).Debugf("failed to serve %s", desc.Digest)
+	}
+}
+
+// manifestMediaType detects the media type of a manifest, the OCI ones may leave it out
+func manifestMediaType(manifest []byte) string {
+	var m struct {
+		MediaType string          `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return ""
+	}
+	if m.MediaType != "" {
+		return m.MediaType
+	}
+	if m.Manifests != nil {
+		return ocispec.MediaTypeImageIndex
+	}
+	return ocispec.MediaTypeImageManifest
+}
+
+// servePeer proxies the request to the first peer that has the content, in random order to spread the load
+func (p *PeerMirror) servePeer(w http.ResponseWriter, r *http.Request) bool {
+	p.mu.RLock()
+	peers := append([]string(nil), p.peers...)
+	p.mu.RUnlock()
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+
+	for _, peer := range peers {
+		req, err := http.NewRequestWithContext(r.Context(), r.Method, peer+r.URL.RequestURI(), nil)
+		if err != nil {
+			return false
+		}
+		req.Header.Set(peerMirrorHeader, "true")
+		resp, err := p.peerClient.Do(req)
+		if err != nil {
+			p.log.WithError(err).Debugf("peer %s failed", peer)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			continue
+		}
+
+		for _, header := range []string{"Content-Type", "Content-Length", "Docker-Content-Digest"} {
+			if value := resp.Header.Get(header); value != "" {
+				w.Header().Set(header, value)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			p.log.WithError(err).Debugf("failed to proxy %s from %s", r.URL.Path, peer)
+		}
+		resp.Body.Close()
+		return true
+	}
+	return false
+}
+
+// Stop stops serving the peers
+func (p *PeerMirror) Stop() error {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return nil
+}
+
+// Healthy is a no-op healthchecker
+func (p *PeerMirror) Healthy() error { return nil }
+
+// withPeerMirror adds the local peer mirror as the first mirror of the mirrored registries
+func withPeerMirror(registries v1beta1.Registries, peerMirror *v1beta1.PeerMirrorSpec) v1beta1.Registries {
+	if peerMirror == nil {
+		return registries
+	}
+	mirror := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(peerMirror.Port))
+	result := append(v1beta1.Registries(nil), registries...)
+	for _, host := range peerMirror.Registries {
+		found := false
+		for i := range result {
+			if result[i].Host == host {
+				result[i].Mirrors = append([]string{mirror}, result[i].Mirrors...)
+				found = true
+			}
+		}
+		if !found {
+			result = append(result, v1beta1.Registry{Host: host, Mirrors: []string{mirror}})
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+func TestPeerMirrorURLs(t *testing.T) {
+	node := func(name, ip string, ready corev1.ConditionStatus) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Addresses:  []corev1.NodeAddress{{Type: corev1.NodeHostName, Address: name}, {Type: corev1.NodeInternalIP, Address: ip}},
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	nodes := []corev1.Node{
+		node("self", "10.0.0.1", corev1.ConditionTrue),
+		node("ready", "10.0.0.2", corev1.ConditionTrue),
+		node("notready", "10.0.0.3", corev1.ConditionFalse),
+		node("ipv6", "fd00::4", corev1.ConditionTrue),
+	}
+	assert.Equal(t, []string{"http://10.0.0.2:30020", "http://[fd00::4]:30020"}, peerMirrorURLs(nodes, "self", 30020))
+}
+
+func TestParseDistributionPath(t *testing.T) {
+	name, kind, ref, ok := parseDistributionPath("/v2/library/nginx/manifests/1.19")
+	assert.True(t, ok)
+	assert.Equal(t, "library/nginx", name)
+	assert.Equal(t, "manifests", kind)
+	assert.Equal(t, "1.19", ref)
+
+	_, kind, ref, ok = parseDistributionPath("/v2/nginx/blobs/sha256:abc")
+	assert.True(t, ok)
+	assert.Equal(t, "blobs", kind)
+	assert.Equal(t, "sha256:abc", ref)
+
+	_, _, _, ok = parseDistributionPath("/v2/nginx/tags/list")
+	assert.False(t, ok)
+}
+
+func TestPeerMirrorServable(t *testing.T) {
+	dgst := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	p := &PeerMirror{}
+	assert.True(t, p.servable("", "blobs", dgst))
+	assert.True(t, p.servable("docker.io", "manifests", dgst))
+	assert.False(t, p.servable("docker.io", "manifests", "latest"))
+
+	p.resolveTags = true
+	assert.True(t, p.servable("docker.io", "manifests", "latest"))
+	assert.False(t, p.servable("", "manifests", "latest"))
+	assert.False(t, p.servable("docker.io", "blobs", "latest"))
+}
+
+func TestManifestMediaType(t *testing.T) {
+	assert.Equal(t, "application/vnd.docker.distribution.manifest.v2+json",
+		manifestMediaType([]byte(`{"mediaType":"application/vnd.docker.distribution.manifest.v2+json"}`)))
+	assert.Equal(t, ocispec.MediaTypeImageIndex, manifestMediaType([]byte(`{"manifests":[]}`)))
+	assert.Equal(t, ocispec.MediaTypeImageManifest, manifestMediaType([]byte(`{"layers":[]}`)))
+	assert.Equal(t, "", manifestMediaType([]byte(`not json`)))
+}
+
+func TestWithPeerMirror(t *testing.T) {
+	registries := v1beta1.Registries{{Host: "docker.io", Mirrors: []string{"https://mirror.example.com"}}}
+	assert.Equal(t, registries, withPeerMirror(registries, nil))
+
+	result := withPeerMirror(registries, &v1beta1.PeerMirrorSpec{Port: 30020, Registries: []string{"docker.io", "quay.io"}})
+	assert.Equal(t, v1beta1.Registries{
+		{Host: "docker.io", Mirrors: []string{"http://127.0.0.1:30020", "https://mirror.example.com"}},
+		{Host: "quay.io", Mirrors: []string{"http://127.0.0.1:30020"}},
+	}, result)
+	assert.Equal(t, []string{"https://mirror.example.com"}, registries[0].Mirrors, "the original registries must not be modified")
+}
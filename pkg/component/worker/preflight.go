@@ -0,0 +1,194 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/sysinfo"
+)
+
+// numaPolicies are the topology manager policies which rely on the NUMA information of the host
+var numaPolicies = map[string]bool{
+	"restricted":       true,
+	"single-numa-node": true,
+}
+
+// selinuxDataDirType is the SELinux type the k0s policy module labels the data directory with
+const selinuxDataDirType = "container_var_lib_t"
+
+// preflightWarnings checks that the host is able to satisfy the hugepages and NUMA settings of the worker profile.
+// Kubelet starts anyway, so the problems are only reported together with the kernel boot parameters fixing them.
+func preflightWarnings(sysfsRoot string, kubeletConfig []byte, hugepages map[string]int64) ([]string, error) {
+	var warnings []string
+
+	if len(hugepages) > 0 {
+		available, err := sysinfo.Hugepages(sysfsRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe hugepages: %v", err)
+		}
+		sizes := make([]string, 0, len(hugepages))
+		for size := range hugepages {
+			sizes = append(sizes, size)
+		}
+		sort.Strings(sizes)
+		for _, size := range sizes {
+			count, found := available[size]
+			if !found {
+				warnings = append(warnings, fmt.Sprintf("hugepage size %s is not supported by the kernel or the CPU, add `%s` to the kernel boot parameters", size, sysinfo.KernelParam(size, hugepages[size])))
+			} else if count < hugepages[size] {
+				warnings = append(warnings, fmt.Sprintf("%d hugepages of %s pre-allocated while the worker profile expects %d, add `%s` to the kernel boot parameters", count, size, hugepages[size], sysinfo.KernelParam(size, hugepages[size])))
+			}
+		}
+	}
+
+	config := struct {
+		TopologyManagerPolicy string `yaml:"topologyManagerPolicy"`
+	}{}
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet config: %v", err)
+	}
+	if numaPolicies[config.TopologyManagerPolicy] {
+		nodes, err := sysinfo.NUMANodes(sysfsRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe NUMA nodes: %v", err)
+		}
+		if nodes == 0 {
+			warnings = append(warnings, fmt.Sprintf("topologyManagerPolicy %s needs NUMA support but the kernel does not expose any NUMA nodes, check that `numa=off` is not set in the kernel boot parameters", config.TopologyManagerPolicy))
+		}
+	}
+
+	return warnings, nil
+}
+
+// selinuxWarnings checks that the k0s data directory carries the labels of the k0s SELinux policy when SELinux is enforcing.
+// Unlabeled directories are the usual cause of AVC denials for containerd and kubelet.
+func selinuxWarnings(sysfsRoot string, dataDir string) ([]string, error) {
+	mode, err := sysinfo.SELinuxMode(sysfsRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe SELinux mode: %v", err)
+	}
+	logrus.Infof("SELinux mode: %s", mode)
+	if mode != sysinfo.SELinuxEnforcing {
+		return nil, nil
+	}
+
+	label, err := sysinfo.FileSELinuxType(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SELinux label of %s: %v", dataDir, err)
+	}
+	if label != selinuxDataDirType {
+		if label == "" {
+			label = "unlabeled"
+		}
+		return []string{fmt.Sprintf("SELinux is enforcing but %s is %s instead of %s, run `k0s install worker --selinux` to load the k0s policy and label the k0s directories", dataDir, label, selinuxDataDirType)}, nil
+	}
+	return nil, nil
+}
+
+// swapWarnings checks that kubelet is allowed to start on a host with swap. The bundled kubelet doesn't limit the
+// swap usage of the pods, so with swap they're limited only by the memory cgroup settings of the host.
+func swapWarnings(procRoot string, kubeletConfig []byte) ([]string, error) {
+	devices, err := sysinfo.SwapDevices(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe swap: %v", err)
+	}
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	config := struct {
+		FailSwapOn *bool `yaml:"failSwapOn"`
+	}{}
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet config: %v", err)
+	}
+	// kubelet fails on swap unless told otherwise
+	if config.FailSwapOn == nil || *config.FailSwapOn {
+		return []string{fmt.Sprintf("swap is enabled on %s but failSwapOn is set in the worker profile, kubelet refuses to start: run `swapoff -a` or set failSwapOn to false", strings.Join(devices, ", "))}, nil
+	}
+	logrus.Infof("swap is enabled on %s, the pods may use it", strings.Join(devices, ", "))
+	return nil, nil
+}
+
+// WritableDirs returns the directories the worker writes to. The containerd config directory is only written to
+// with the k0s managed containerd, and the registry host configs with it.
+func WritableDirs(k0sVars constant.CfgVars, criSocket string) []string {
+	dirs := []string{k0sVars.DataDir, k0sVars.RunDir, k0sVars.BinDir}
+	if criSocket != "" {
+		return dirs
+	}
+	dirs = append(dirs, k0sVars.ContainerdCertsDir)
+	if managed, err := isManagedContainerdConfig(k0sVars.ContainerdConfigPath); err != nil || managed {
+		dirs = append(dirs, filepath.Dir(k0sVars.ContainerdConfigPath), k0sVars.ContainerdDropInDir)
+	}
+	return dirs
+}
+
+// volumePluginDirWarnings checks that kubelet can create the volume plugin dir of the worker profile, which is
+// outside of the data dir. kubelet runs without it but keeps logging the errors.
+func volumePluginDirWarnings(kubeletConfig []byte) ([]string, error) {
+	config := struct {
+		VolumePluginDir string `yaml:"volumePluginDir"`
+	}{}
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet config: %v", err)
+	}
+	if config.VolumePluginDir == "" {
+		return nil, nil
+	}
+	if err := util.CheckWritableDirs([]string{config.VolumePluginDir}, constant.KubeletVolumePluginDirMode); err != nil {
+		return []string{fmt.Sprintf("%v, set volumePluginDir to a writable path in a kubelet config drop-in to use the FlexVolume plugins", err)}, nil
+	}
+	return nil, nil
+}
+
+func logPreflightWarnings(dataDir string, kubeletConfig []byte, hugepages map[string]int64) {
+	warnings, err := preflightWarnings(sysinfo.SysfsRoot, kubeletConfig, hugepages)
+	if err != nil {
+		logrus.Warnf("failed to run worker preflight checks: %v", err)
+		return
+	}
+	selinux, err := selinuxWarnings(sysinfo.SysfsRoot, dataDir)
+	if err != nil {
+		logrus.Warnf("failed to run worker preflight checks: %v", err)
+		return
+	}
+	warnings = append(warnings, selinux...)
+	swap, err := swapWarnings(sysinfo.ProcRoot, kubeletConfig)
+	if err != nil {
+		logrus.Warnf("failed to run worker preflight checks: %v", err)
+		return
+	}
+	warnings = append(warnings, swap...)
+	volumePluginDir, err := volumePluginDirWarnings(kubeletConfig)
+	if err != nil {
+		logrus.Warnf("failed to run worker preflight checks: %v", err)
+		return
+	}
+	warnings = append(warnings, volumePluginDir...)
+	for _, w := range warnings {
+		logrus.Warnf("preflight: %s", w)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+func TestPreflightWarnings(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-sysfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "kernel", "mm", "hugepages", "hugepages-2048kB")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "nr_hugepages"), []byte("512\n"), 0644))
+
+	t.Run("satisfied", func(t *testing.T) {
+		warnings, err := preflightWarnings(root, []byte("cpuManagerPolicy: static\n"), map[string]int64{"2Mi": 512})
+		require.NoError(t, err)
+		require.Empty(t, warnings)
+	})
+
+	t.Run("missing_hugepages_and_numa", func(t *testing.T) {
+		warnings, err := preflightWarnings(root, []byte("topologyManagerPolicy: single-numa-node\n"), map[string]int64{"2Mi": 1024, "1Gi": 2})
+		require.NoError(t, err)
+		require.Len(t, warnings, 3)
+		require.Contains(t, warnings[0], "hugepagesz=1G hugepages=2")
+		require.Contains(t, warnings[1], "hugepagesz=2M hugepages=1024")
+		require.Contains(t, warnings[2], "NUMA")
+	})
+}
+
+func TestSELinuxWarnings(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-sysfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	warnings, err := selinuxWarnings(root, root)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	dir := filepath.Join(root, "fs", "selinux")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "enforce"), []byte("0\n"), 0644))
+	warnings, err = selinuxWarnings(root, root)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+}
+
+func TestSwapWarnings(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-procfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	warnings, err := swapWarnings(root, []byte("failSwapOn: true\n"))
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	swaps := "Filename\tType\tSize\tUsed\tPriority\n/swapfile\tfile\t2097148\t0\t-2\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "swaps"), []byte(swaps), 0644))
+
+	warnings, err = swapWarnings(root, []byte("failSwapOn: false\n"))
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	warnings, err = swapWarnings(root, []byte("failSwapOn: true\n"))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "/swapfile")
+
+	// kubelet defaults to failSwapOn
+	warnings, err = swapWarnings(root, []byte("maxPods: 100\n"))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+}
+
+func TestWritableDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-etc")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	k0sVars := constant.GetConfigDirs(constant.Dirs{DataDir: "/var/lib/k0s", RunDir: "/var/run/k0s", ContainerdConfigDir: dir})
+	require.Equal(t, []string{"/var/lib/k0s", "/var/run/k0s", "/var/lib/k0s/bin"}, WritableDirs(k0sVars, "remote:/run/crio/crio.sock"))
+	require.Contains(t, WritableDirs(k0sVars, ""), dir)
+
+	// a user provided containerd config is only read
+	require.NoError(t, ioutil.WriteFile(k0sVars.ContainerdConfigPath, []byte("version = 2\n"), 0644))
+	dirs := WritableDirs(k0sVars, "")
+	require.NotContains(t, dirs, dir)
+	require.Contains(t, dirs, k0sVars.ContainerdCertsDir)
+}
+
+func TestVolumePluginDirWarnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k0s-libexec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	warnings, err := volumePluginDirWarnings([]byte("volumePluginDir: " + filepath.Join(dir, "volume", "exec") + "\n"))
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	file := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	warnings, err = volumePluginDirWarnings([]byte("volumePluginDir: " + filepath.Join(file, "exec") + "\n"))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "kubelet config drop-in")
+}
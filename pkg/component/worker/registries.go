@@ -0,0 +1,189 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+// dockerHubHosts are the names of Docker Hub in the docker config.json files
+var dockerHubHosts = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+// registryAuth are the credentials of a registry in the CRI registry config of containerd
+type registryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// registryServer returns the URL of the registry itself, Docker Hub is served from registry-1.docker.io
+func registryServer(host string) string {
+	if host == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + host
+}
+
+// registryAuthFromDockerConfig looks up the credentials of the registry from a docker config.json. The keys of the
+// auths may be URLs, e.g. https://index.docker.io/v1/.
+func registryAuthFromDockerConfig(data []byte, host string) (*registryAuth, error) {
+	var config struct {
+		Auths map[string]registryAuth `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the docker config: %w", err)
+	}
+
+	names := []string{host}
+	if host == "docker.io" {
+		names = dockerHubHosts
+	}
+	for key, auth := range config.Auths {
+		keyHost := key
+		if u, err := url.Parse(key); err == nil && u.Host != "" {
+			keyHost = u.Host
+		}
+		for _, name := range names {
+			if keyHost == name {
+				auth := auth
+				return &auth, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no credentials for %s found in the docker config", host)
+}
+
+// registryAuths resolves the credentials of the registries from the files on the node or the Secrets. They are
+// keyed by the host of the registry server, as containerd looks them up. The registries whose credentials can't be
+// resolved are pulled from without them.
+func registryAuths(registries v1beta1.Registries, getSecret func(name string) ([]byte, error)) map[string]registryAuth {
+	auths := make(map[string]registryAuth)
+	for _, registry := range registries {
+		if registry.Auth == nil {
+			continue
+		}
+		auth, err := func() (*registryAuth, error) {
+			var data []byte
+			var err error
+			if registry.Auth.File != "" {
+				data, err = ioutil.ReadFile(registry.Auth.File)
+			} else {
+				data, err = getSecret(registry.Auth.SecretRef)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return registryAuthFromDockerConfig(data, registry.Host)
+		}()
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to read the credentials of registry %s, pulling without them", registry.Host)
+			continue
+		}
+		server, _ := url.Parse(registryServer(registry.Host))
+		auths[server.Host] = *auth
+	}
+	return auths
+}
+
+// renderRegistryHosts renders the certs.d hosts.toml of the registry, caPath is empty if the registry has no CA
+func renderRegistryHosts(registry v1beta1.Registry, caPath string) string {
+	var b strings.Builder
+	hostOptions := func(indent string) {
+		if caPath != "" {
+			fmt.Fprintf(&b, "%sca = %q\n", indent, caPath)
+		}
+		if registry.Insecure {
+			fmt.Fprintf(&b, "%sskip_verify = true\n", indent)
+		}
+	}
+
+	fmt.Fprintln(&b, managedContainerdConfigMarker)
+	fmt.Fprintf(&b, "server = %q\n", registryServer(registry.Host))
+	hostOptions("")
+	for _, mirror := range registry.Mirrors {
+		fmt.Fprintf(&b, "\n[host.%q]\n", mirror)
+		fmt.Fprintf(&b, "  capabilities = [\"pull\", \"resolve\"]\n")
+		hostOptions("  ")
+	}
+	return b.String()
+}
+
+// writeRegistryHosts writes the certs.d host configs of the registries and removes the ones of the registries not
+// configured anymore. The host configs provided by the user are never touched.
+func writeRegistryHosts(certsDir string, registries v1beta1.Registries) error {
+	hosts := make(map[string]bool)
+	for _, registry := range registries {
+		hosts[registry.Host] = true
+		hostDir := filepath.Join(certsDir, registry.Host)
+		hostsPath := filepath.Join(hostDir, "hosts.toml")
+		managed, err := isManagedContainerdConfig(hostsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", hostsPath, err)
+		}
+		if !managed {
+			logrus.Warnf("%s is not managed by k0s, skipping registry %s", hostsPath, registry.Host)
+			continue
+		}
+		if err := os.MkdirAll(hostDir, 0755); err != nil {
+			return err
+		}
+
+		var caPath string
+		if registry.CA != "" {
+			caPath = filepath.Join(hostDir, "ca.crt")
+			if err := ioutil.WriteFile(caPath, []byte(registry.CA), 0644); err != nil {
+				return err
+			}
+		} else if err := os.RemoveAll(filepath.Join(hostDir, "ca.crt")); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(hostsPath, []byte(renderRegistryHosts(registry, caPath)), 0644); err != nil {
+			return err
+		}
+	}
+
+	dirs, err := ioutil.ReadDir(certsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		hostsPath := filepath.Join(certsDir, dir.Name(), "hosts.toml")
+		if hosts[dir.Name()] || !util.FileExists(hostsPath) {
+			continue
+		}
+		if managed, err := isManagedContainerdConfig(hostsPath); err != nil || !managed {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(certsDir, dir.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
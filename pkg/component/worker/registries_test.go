@@ -0,0 +1,112 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+func TestRenderRegistryHosts(t *testing.T) {
+	hosts := renderRegistryHosts(v1beta1.Registry{
+		Host:     "docker.io",
+		Mirrors:  []string{"https://mirror.example.com"},
+		Insecure: true,
+	}, "/etc/k0s/certs.d/docker.io/ca.crt")
+	assert.Equal(t, `# k0s_managed=true
+server = "https://registry-1.docker.io"
+ca = "/etc/k0s/certs.d/docker.io/ca.crt"
+skip_verify = true
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+  ca = "/etc/k0s/certs.d/docker.io/ca.crt"
+  skip_verify = true
+`, hosts)
+
+	hosts = renderRegistryHosts(v1beta1.Registry{Host: "registry.local:5000"}, "")
+	assert.Equal(t, "# k0s_managed=true\nserver = \"https://registry.local:5000\"\n", hosts)
+}
+
+func TestWriteRegistryHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs.d")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	userHosts := filepath.Join(dir, "quay.io", "hosts.toml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(userHosts), 0755))
+	require.NoError(t, ioutil.WriteFile(userHosts, []byte(`server = "https://quay.io"`), 0644))
+
+	require.NoError(t, writeRegistryHosts(dir, v1beta1.Registries{
+		{Host: "docker.io", Mirrors: []string{"https://mirror.example.com"}},
+		{Host: "registry.local:5000", CA: "-----BEGIN CERTIFICATE-----"},
+		{Host: "quay.io", Insecure: true},
+	}))
+	assert.FileExists(t, filepath.Join(dir, "docker.io", "hosts.toml"))
+	assert.FileExists(t, filepath.Join(dir, "registry.local:5000", "ca.crt"))
+	hosts, err := ioutil.ReadFile(filepath.Join(dir, "registry.local:5000", "hosts.toml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(hosts), fmt.Sprintf("ca = %q", filepath.Join(dir, "registry.local:5000", "ca.crt")))
+	// the host configs of the user are never touched
+	hosts, err = ioutil.ReadFile(userHosts)
+	require.NoError(t, err)
+	assert.Equal(t, `server = "https://quay.io"`, string(hosts))
+
+	// the host configs of the removed registries are removed
+	require.NoError(t, writeRegistryHosts(dir, v1beta1.Registries{{Host: "docker.io"}}))
+	assert.FileExists(t, filepath.Join(dir, "docker.io", "hosts.toml"))
+	assert.NoDirExists(t, filepath.Join(dir, "registry.local:5000"))
+	assert.FileExists(t, userHosts)
+}
+
+func TestRegistryAuths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry-auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(authFile, []byte(`{"auths": {"https://index.docker.io/v1/": {"auth": "dXNlcjpzZWNyZXQ="}}}`), 0600))
+
+	secrets := map[string][]byte{
+		"registry-local": []byte(`{"auths": {"registry.local:5000": {"username": "user", "password": "secret"}}}`),
+		"no-quay":        []byte(`{"auths": {"registry.local:5000": {"username": "user", "password": "secret"}}}`),
+	}
+	getSecret := func(name string) ([]byte, error) {
+		if data, ok := secrets[name]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("secret %s not found", name)
+	}
+
+	auths := registryAuths(v1beta1.Registries{
+		{Host: "docker.io", Auth: &v1beta1.RegistryAuth{File: authFile}},
+		{Host: "registry.local:5000", Auth: &v1beta1.RegistryAuth{SecretRef: "registry-local"}},
+		{Host: "quay.io", Auth: &v1beta1.RegistryAuth{SecretRef: "no-quay"}},
+		{Host: "gcr.io", Auth: &v1beta1.RegistryAuth{SecretRef: "missing"}},
+		{Host: "ghcr.io"},
+	}, getSecret)
+	assert.Equal(t, map[string]registryAuth{
+		"registry-1.docker.io": {Auth: "dXNlcjpzZWNyZXQ="},
+		"registry.local:5000":  {Username: "user", Password: "secret"},
+	}, auths)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RootlessKitBinary is the binary used for entering the user namespace of a rootless worker
+const RootlessKitBinary = "rootlesskit"
+
+// RootlessDataDir returns the default data dir of a rootless worker, $XDG_DATA_HOME/k0s or ~/.local/share/k0s
+func RootlessDataDir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "k0s"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("can't get the home directory of the user for the rootless data dir: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "k0s"), nil
+}
+
+// rootlessKitArgs are the args of rootlesskit for running the given command. /etc, /run, /var/lib and /var/log are
+// copied up so that the worker, the CNI plugins and kubelet can write their configs, sockets and logs there like
+// rootful ones. The copies are lost when the worker stops.
+func rootlessKitArgs(command []string) []string {
+	args := []string{
+		"--net=slirp4netns",
+		"--mtu=65520",
+		"--slirp4netns-sandbox=auto",
+		"--slirp4netns-seccomp=auto",
+		"--disable-host-loopback",
+		"--port-driver=builtin",
+		"--copy-up=/etc",
+		"--copy-up=/run",
+		"--copy-up=/var/lib",
+		"--copy-up=/var/log",
+		"--propagation=rslave",
+		"--pidns",
+		"--",
+	}
+	return append(args, command...)
+}
+
+// isHostUIDMap tells if the uid_map is the identity mapping of the initial user namespace
+func isHostUIDMap(uidMap string) bool {
+	lines := strings.Split(strings.TrimSpace(uidMap), "\n")
+	if len(lines) != 1 {
+		return false
+	}
+	fields := strings.Fields(lines[0])
+	return len(fields) == 3 && fields[0] == "0" && fields[1] == "0" && fields[2] == "4294967295"
+}
@@ -0,0 +1,57 @@
+// +build linux
+
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// InUserNamespace tells if k0s runs in a user namespace other than the initial one
+func InUserNamespace() bool {
+	uidMap, err := ioutil.ReadFile("/proc/self/uid_map")
+	if err != nil {
+		return false
+	}
+	return !isHostUIDMap(string(uidMap))
+}
+
+// ReexecRootless replaces the k0s process with rootlesskit running the same command in a new user namespace. It
+// only returns on errors.
+func ReexecRootless() error {
+	if os.Geteuid() == 0 {
+		return fmt.Errorf("rootless mode is for running the worker as a non-root user")
+	}
+	rootlessKit, err := exec.LookPath(RootlessKitBinary)
+	if err != nil {
+		return fmt.Errorf("rootless mode needs %s and slirp4netns in the PATH, see https://github.com/rootless-containers/rootlesskit: %w", RootlessKitBinary, err)
+	}
+	if _, err := exec.LookPath("slirp4netns"); err != nil {
+		return fmt.Errorf("rootless mode needs slirp4netns in the PATH: %w", err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := append([]string{RootlessKitBinary}, rootlessKitArgs(append([]string{self}, os.Args[1:]...))...)
+	return syscall.Exec(rootlessKit, args, os.Environ())
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsHostUIDMap(t *testing.T) {
+	assert.True(t, isHostUIDMap("         0          0 4294967295\n"))
+	// rootlesskit maps the user to root and the subordinate ids after it
+	assert.False(t, isHostUIDMap("         0       1000          1\n         1     100000      65536\n"))
+	assert.False(t, isHostUIDMap("         0       1000          1\n"))
+}
+
+func TestRootlessKitArgs(t *testing.T) {
+	args := rootlessKitArgs([]string{"/usr/local/bin/k0s", "worker", "--rootless"})
+	assert.Contains(t, args, "--copy-up=/etc")
+	assert.Contains(t, args, "--net=slirp4netns")
+	assert.Equal(t, []string{"--", "/usr/local/bin/k0s", "worker", "--rootless"}, args[len(args)-4:])
+}
+
+func TestRootlessDataDir(t *testing.T) {
+	os.Setenv("XDG_DATA_HOME", "/home/k0s/.data")
+	defer os.Unsetenv("XDG_DATA_HOME")
+	dataDir, err := RootlessDataDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "/home/k0s/.data/k0s", dataDir)
+}
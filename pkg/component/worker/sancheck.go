@@ -0,0 +1,113 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/certificate"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// APIServerSANCheck warns when the kube-apiserver certificate is not valid for the address the worker connects to,
+// before kubelet runs into x509 errors
+type APIServerSANCheck struct {
+	K0sVars constant.CfgVars
+
+	log    *logrus.Entry
+	stopCh chan struct{}
+}
+
+// Init does nothing
+func (s *APIServerSANCheck) Init() error {
+	s.log = logrus.WithField("component", "apiserver-san-check")
+	return nil
+}
+
+// Run checks the certificate right away and then every 10 minutes
+func (s *APIServerSANCheck) Run() error {
+	s.stopCh = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for {
+			if err := s.check(); err != nil {
+				s.log.Debugf("kube-apiserver SAN check failed: %s", err.Error())
+			}
+			select {
+			case <-ticker.C:
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *APIServerSANCheck) check() error {
+	kubeconfig := s.K0sVars.KubeletAuthConfigPath
+	if !util.FileExists(kubeconfig) {
+		kubeconfig = s.K0sVars.KubeletBootstrapConfigPath
+	}
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	server, err := url.Parse(restConfig.Host)
+	if err != nil {
+		return err
+	}
+	port := server.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	// the certificate is only inspected, the trust is verified by kubelet itself
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", net.JoinHostPort(server.Hostname(), port), &tls.Config{
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return fmt.Errorf("%s presented no certificate", server.Host)
+	}
+	if missing := certificate.MissingSANs(certs[0], []string{server.Hostname()}); len(missing) > 0 {
+		s.log.Warnf("the kube-apiserver certificate is not valid for %s this worker connects to, kubelet will fail with x509 errors. Add the SAN on the controllers with `k0s config certs add-san %s` or in spec.api.sans", missing[0], missing[0])
+	}
+	return nil
+}
+
+// Stop stops the checks
+func (s *APIServerSANCheck) Stop() error {
+	if s.stopCh != nil {
+		close(s.stopCh)
+	}
+	return nil
+}
+
+// Healthy is a no-op healthchecker
+func (s *APIServerSANCheck) Healthy() error { return nil }
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// shutdownInhibitor delays the shutdown of the host until kubelet has terminated the pods. Kubelet takes a
+// systemd-logind delay lock of its own, the one of k0s keeps the host up also while kubelet is (re)starting and
+// until kubelet has released its lock.
+type shutdownInhibitor struct {
+	mu          sync.Mutex
+	gracePeriod time.Duration
+	changed     chan struct{}
+}
+
+func newShutdownInhibitor() *shutdownInhibitor {
+	return &shutdownInhibitor{changed: make(chan struct{}, 1)}
+}
+
+// setGracePeriod sets the longest time the shutdown is delayed, zero releases the lock
+func (s *shutdownInhibitor) setGracePeriod(gracePeriod time.Duration) {
+	s.mu.Lock()
+	s.gracePeriod = gracePeriod
+	s.mu.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *shutdownInhibitor) getGracePeriod() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gracePeriod
+}
+
+// shutdownGracePeriod returns the shutdown grace period of the kubelet config, zero when graceful node shutdown is
+// not enabled
+func shutdownGracePeriod(kubeletConfig []byte) (time.Duration, error) {
+	config := struct {
+		ShutdownGracePeriod string          `yaml:"shutdownGracePeriod"`
+		FeatureGates        map[string]bool `yaml:"featureGates"`
+	}{}
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return 0, err
+	}
+	if !config.FeatureGates["GracefulNodeShutdown"] || config.ShutdownGracePeriod == "" {
+		return 0, nil
+	}
+	gracePeriod, err := time.ParseDuration(config.ShutdownGracePeriod)
+	if err != nil {
+		return 0, fmt.Errorf("invalid shutdownGracePeriod %q: %v", config.ShutdownGracePeriod, err)
+	}
+	return gracePeriod, nil
+}
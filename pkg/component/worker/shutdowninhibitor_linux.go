@@ -0,0 +1,165 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logindService   = "org.freedesktop.login1"
+	logindObject    = dbus.ObjectPath("/org/freedesktop/login1")
+	logindInterface = "org.freedesktop.login1.Manager"
+	// kubeletInhibitorWho is the name kubelet takes its own delay lock with
+	kubeletInhibitorWho = "kubelet"
+)
+
+type logindInhibitor struct {
+	What string
+	Who  string
+	Why  string
+	Mode string
+	UID  uint32
+	PID  uint32
+}
+
+// run holds a delay lock of systemd-logind while the grace period is set. When the host is shutting down the lock is
+// released once kubelet has released its own lock, or at the latest after the grace period.
+func (s *shutdownInhibitor) run(ctx context.Context) {
+	conn, err := dbus.SystemBusPrivate()
+	if err == nil {
+		if err = conn.Auth(nil); err == nil {
+			err = conn.Hello()
+		}
+		if err != nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Info("can't connect to the system bus, not delaying the host shutdown")
+		return
+	}
+	defer conn.Close()
+
+	match := "type='signal',interface='" + logindInterface + "',member='PrepareForShutdown'"
+	if err := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match).Err; err != nil {
+		logrus.WithError(err).Warn("can't subscribe to the shutdown signal of systemd-logind, not delaying the host shutdown")
+		return
+	}
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	logind := conn.Object(logindService, logindObject)
+	lock := -1
+	release := func() {
+		if lock >= 0 {
+			_ = syscall.Close(lock)
+			lock = -1
+		}
+	}
+	defer release()
+
+	shuttingDown := false
+	for {
+		gracePeriod := s.getGracePeriod()
+		if gracePeriod == 0 {
+			release()
+		} else if lock < 0 && !shuttingDown {
+			if fd, err := inhibitShutdown(logind, gracePeriod); err != nil {
+				logrus.WithError(err).Warn("can't take the shutdown delay lock of systemd-logind")
+			} else {
+				lock = fd
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.changed:
+		case signal, ok := <-signals:
+			if !ok {
+				return
+			}
+			if signal.Name != logindInterface+".PrepareForShutdown" || len(signal.Body) == 0 {
+				continue
+			}
+			shuttingDown, _ = signal.Body[0].(bool)
+			if shuttingDown && lock >= 0 {
+				logrus.Infof("host is shutting down, waiting up to %s for kubelet to terminate the pods", gracePeriod)
+				waitForKubelet(ctx, logind, gracePeriod)
+				release()
+			}
+		}
+	}
+}
+
+// inhibitShutdown takes a delay lock and warns when systemd-logind won't wait for the whole grace period
+func inhibitShutdown(logind dbus.BusObject, gracePeriod time.Duration) (int, error) {
+	var fd dbus.UnixFD
+	err := logind.Call(logindInterface+".Inhibit", 0, "shutdown", "k0s", "Kubelet terminates the pods of the node", "delay").Store(&fd)
+	if err != nil {
+		return -1, err
+	}
+	if delayMax, err := logind.GetProperty(logindInterface + ".InhibitDelayMaxUSec"); err == nil {
+		if usec, ok := delayMax.Value().(uint64); ok && time.Duration(usec)*time.Microsecond < gracePeriod {
+			logrus.Warnf("systemd-logind delays the shutdown at most %s, less than the shutdown grace period %s, raise InhibitDelayMaxSec in logind.conf",
+				time.Duration(usec)*time.Microsecond, gracePeriod)
+		}
+	}
+	return int(fd), nil
+}
+
+// waitForKubelet waits until kubelet has released its delay lock or the grace period has passed
+func waitForKubelet(ctx context.Context, logind dbus.BusObject, gracePeriod time.Duration) {
+	deadline := time.NewTimer(gracePeriod)
+	defer deadline.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			logrus.Warn("kubelet didn't finish terminating the pods within the shutdown grace period")
+			return
+		case <-ticker.C:
+		}
+		var inhibitors []logindInhibitor
+		if err := logind.Call(logindInterface+".ListInhibitors", 0).Store(&inhibitors); err != nil {
+			logrus.WithError(err).Debug("can't list the inhibitors of systemd-logind")
+			continue
+		}
+		if !kubeletInhibits(inhibitors) {
+			logrus.Info("kubelet has terminated the pods, releasing the shutdown delay lock")
+			return
+		}
+	}
+}
+
+func kubeletInhibits(inhibitors []logindInhibitor) bool {
+	for _, i := range inhibitors {
+		if i.Who == kubeletInhibitorWho && i.Mode == "delay" {
+			return true
+		}
+	}
+	return false
+}
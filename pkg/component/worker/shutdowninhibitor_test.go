@@ -0,0 +1,46 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownGracePeriod(t *testing.T) {
+	gracePeriod, err := shutdownGracePeriod([]byte("shutdownGracePeriod: 1m\nfeatureGates:\n  GracefulNodeShutdown: true\n"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, gracePeriod)
+
+	// the grace period is ignored by kubelet without the feature gate
+	gracePeriod, err = shutdownGracePeriod([]byte("shutdownGracePeriod: 1m\n"))
+	require.NoError(t, err)
+	assert.Zero(t, gracePeriod)
+
+	_, err = shutdownGracePeriod([]byte("shutdownGracePeriod: soon\nfeatureGates:\n  GracefulNodeShutdown: true\n"))
+	assert.Error(t, err)
+}
+
+func TestShutdownInhibitorSetGracePeriod(t *testing.T) {
+	s := newShutdownInhibitor()
+	s.setGracePeriod(30 * time.Second)
+	s.setGracePeriod(time.Minute)
+	assert.Equal(t, time.Minute, s.getGracePeriod())
+	assert.Len(t, s.changed, 1)
+}
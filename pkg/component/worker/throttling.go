@@ -0,0 +1,85 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// kubelet defaults for the settings the adaptive throttling derives the limits from
+	defaultMaxPods = 110
+
+	minKubeAPIQPS      = 5
+	maxKubeAPIQPS      = 50
+	minRegistryPullQPS = 5
+	maxRegistryPullQPS = 10
+)
+
+// applyAdaptiveAPIThrottling sets the kubelet API and registry rate limits missing from the kubelet config based on
+// the pod density of the node. The kubelet defaults are kept for small nodes, denser nodes get higher limits capped
+// so that a mass restart of big nodes does not overwhelm a small control plane.
+func applyAdaptiveAPIThrottling(kubeletConfig []byte, cpus int) ([]byte, error) {
+	config := make(map[string]interface{})
+	if err := yaml.Unmarshal(kubeletConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet config: %v", err)
+	}
+
+	pods := podDensity(config, cpus)
+	kubeAPIQPS := clamp(pods/10, minKubeAPIQPS, maxKubeAPIQPS)
+	registryPullQPS := clamp(pods/50, minRegistryPullQPS, maxRegistryPullQPS)
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"kubeAPIQPS", kubeAPIQPS},
+		{"kubeAPIBurst", 2 * kubeAPIQPS},
+		{"registryPullQPS", registryPullQPS},
+		{"registryBurst", 2 * registryPullQPS},
+	}
+	for _, l := range limits {
+		if _, found := config[l.field]; !found {
+			config[l.field] = l.value
+		}
+	}
+
+	return yaml.Marshal(config)
+}
+
+// podDensity returns the number of pods kubelet admits on the node, limited by podsPerCore if set
+func podDensity(config map[string]interface{}, cpus int) int {
+	pods := defaultMaxPods
+	if maxPods, ok := config["maxPods"].(int); ok && maxPods > 0 {
+		pods = maxPods
+	}
+	if podsPerCore, ok := config["podsPerCore"].(int); ok && podsPerCore > 0 && podsPerCore*cpus < pods {
+		pods = podsPerCore * cpus
+	}
+	return pods
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestApplyAdaptiveAPIThrottling(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   string
+		cpus     int
+		expected map[string]int
+	}{
+		{
+			name:     "kubelet defaults",
+			config:   "kind: KubeletConfiguration\n",
+			cpus:     4,
+			expected: map[string]int{"kubeAPIQPS": 11, "kubeAPIBurst": 22, "registryPullQPS": 5, "registryBurst": 10},
+		},
+		{
+			name:     "dense node is capped",
+			config:   "maxPods: 1000\n",
+			cpus:     128,
+			expected: map[string]int{"kubeAPIQPS": 50, "kubeAPIBurst": 100, "registryPullQPS": 10, "registryBurst": 20},
+		},
+		{
+			name:     "pods per core limits the density",
+			config:   "maxPods: 500\npodsPerCore: 10\n",
+			cpus:     2,
+			expected: map[string]int{"kubeAPIQPS": 5, "kubeAPIBurst": 10, "registryPullQPS": 5, "registryBurst": 10},
+		},
+		{
+			name:     "explicit limits are kept",
+			config:   "maxPods: 250\nkubeAPIQPS: 7\n",
+			cpus:     16,
+			expected: map[string]int{"kubeAPIQPS": 7, "kubeAPIBurst": 50, "registryPullQPS": 5, "registryBurst": 10},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := applyAdaptiveAPIThrottling([]byte(tc.config), tc.cpus)
+			require.NoError(t, err)
+			config := make(map[string]interface{})
+			require.NoError(t, yaml.Unmarshal(out, &config))
+			for field, value := range tc.expected {
+				require.Equal(t, value, config[field], field)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	certificates "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/keyutil"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/tpm"
+)
+
+// kubeletBootstrapKeyFile is the key kubelet requests its client certificate for when bootstrapping, if it exists
+const kubeletBootstrapKeyFile = "kubelet-client.key.tmp"
+
+// AttestTPM proves to the controllers that the node holds the TPM key before kubelet bootstraps its client
+// certificate. The kubelet client key is created upfront, so an attestation signed with the TPM key can bind
+// it, and the attestation is submitted with the join token as a certificate signing request.
+func AttestTPM(k0sVars constant.CfgVars, keyHandle string) error {
+	key, err := tpm.LoadKey(keyHandle)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := tpm.Fingerprint(key.Public())
+	if err != nil {
+		return err
+	}
+
+	certDir := filepath.Join(k0sVars.DataDir, "kubelet", "pki")
+	if err := util.InitDirectory(certDir, constant.DataDirMode); err != nil {
+		return err
+	}
+	keyData, _, err := keyutil.LoadOrGenerateKeyFile(filepath.Join(certDir, kubeletBootstrapKeyFile))
+	if err != nil {
+		return fmt.Errorf("failed to create kubelet client key: %v", err)
+	}
+	privateKey, err := keyutil.ParsePrivateKeyPEM(keyData)
+	if err != nil {
+		return fmt.Errorf("failed to parse kubelet client key: %v", err)
+	}
+	kubeletKey, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported kubelet client key type %T", privateKey)
+	}
+
+	nodeName, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("can't get hostname: %v", err)
+	}
+	request, err := tpm.CreateAttestationRequest(key, strings.ToLower(nodeName), kubeletKey.Public())
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", k0sVars.KubeletBootstrapConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load kubelet bootstrap config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	csr := &certificates.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "tpm-attestation-"},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: tpm.AttestationSignerName,
+			Usages:     []certificates.KeyUsage{certificates.UsageDigitalSignature},
+		},
+	}
+	csr, err = client.CertificatesV1().CertificateSigningRequests().Create(context.TODO(), csr, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to submit TPM attestation: %v", err)
+	}
+
+	logrus.Infof("submitted TPM attestation %s for key %s", csr.Name, fingerprint)
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
+	"github.com/k0sproject/k0s/pkg/token"
+)
+
+const (
+	// WorkerProfileAnnotation is the node annotation selecting the worker profile of the node, the worker sets it to
+	// its --profile when the node has no profile yet
+	WorkerProfileAnnotation = "k0s.k0sproject.io/worker-profile"
+	// AppliedWorkerProfileAnnotation is the node annotation telling the worker profile kubelet runs with
+	AppliedWorkerProfileAnnotation = "k0s.k0sproject.io/applied-worker-profile"
+
+	profileCheckInterval = 30 * time.Second
+)
+
+// nodeProfile returns the worker profile of the node annotation, empty if the node or the annotation doesn't exist.
+// The node can be read only once kubelet has bootstrapped its credentials.
+func (k *Kubelet) nodeProfile() string {
+	client, err := k8sutil.NewClient(k.K0sVars.KubeletAuthConfigPath)
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	node, err := client.CoreV1().Nodes().Get(ctx, k.nodeName, metav1.GetOptions{})
+	if err != nil {
+		logrus.WithError(err).Debug("can't read the worker profile annotation of the node")
+		return ""
+	}
+	return node.Annotations[WorkerProfileAnnotation]
+}
+
+// reconcileProfile moves the node to the worker profile of its annotation and records the labels requested from the
+// controllers
+func (k *Kubelet) reconcileProfile(ctx context.Context, kubeletConfigPath string) {
+	var client kubernetes.Interface
+	ticker := time.NewTicker(profileCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if client == nil {
+			var err error
+			if client, err = k8sutil.NewClient(k.K0sVars.KubeletAuthConfigPath); err != nil {
+				logrus.WithError(err).Debug("kubelet kubeconfig not available yet")
+				continue
+			}
+		}
+		if err := k.syncProfile(ctx, client, kubeletConfigPath); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("failed to reconcile the worker profile of the node")
+		}
+	}
+}
+
+func (k *Kubelet) syncProfile(ctx context.Context, client kubernetes.Interface, kubeletConfigPath string) error {
+	node, err := client.CoreV1().Nodes().Get(ctx, k.nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// not registered yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	profile, record := desiredProfile(node.Annotations, k.profile)
+	annotations := make(map[string]interface{})
+	if record {
+		annotations[WorkerProfileAnnotation] = profile
+	}
+	if profile != k.profile {
+		cfg, err := k.writeConfig(profile, kubeletConfigPath)
+		if err != nil {
+			return fmt.Errorf("can't switch to worker profile %s: %v", profile, err)
+		}
+		if runtime.GOOS == "linux" {
+			logPreflightWarnings(k.K0sVars.DataDir, cfg.kubeletConfig, cfg.hugepages)
+		}
+		logrus.Infof("worker profile of the node changed from %s to %s, restarting kubelet", k.profile, profile)
+		k.profile = profile
+		k.setCredentialProviderArgs(cfg)
+		k.setShutdownGracePeriod(cfg)
+		k.supervisor.Args = k.args.ToArgs()
+		if err := k.supervisor.Restart(); err != nil {
+			return err
+		}
+	}
+	if node.Annotations[AppliedWorkerProfileAnnotation] != k.profile {
+		annotations[AppliedWorkerProfileAnnotation] = k.profile
+	}
+	if requested := strings.Join(k.RequestedLabels, ","); node.Annotations[token.RequestedNodeLabelsAnnotation] != requested {
+		if requested == "" {
+			// null removes the annotation in the merge patch
+			annotations[token.RequestedNodeLabelsAnnotation] = nil
+		} else {
+			annotations[token.RequestedNodeLabelsAnnotation] = requested
+		}
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Nodes().Patch(ctx, k.nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// desiredProfile returns the worker profile of the node annotation, or the current one if the node has no
+// annotation yet, in which case the annotation is to be recorded
+func desiredProfile(annotations map[string]string, current string) (string, bool) {
+	if profile := annotations[WorkerProfileAnnotation]; profile != "" {
+		return profile, false
+	}
+	return current, true
+}
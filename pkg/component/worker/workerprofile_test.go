@@ -0,0 +1,70 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/k0sproject/k0s/pkg/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDesiredProfile(t *testing.T) {
+	profile, record := desiredProfile(nil, "default")
+	assert.Equal(t, "default", profile)
+	assert.True(t, record)
+
+	profile, record = desiredProfile(map[string]string{WorkerProfileAnnotation: "numa"}, "default")
+	assert.Equal(t, "numa", profile)
+	assert.False(t, record)
+}
+
+func TestSyncProfileRecordsTheProfile(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}})
+	k := &Kubelet{profile: "default", nodeName: "worker-1"}
+
+	require.NoError(t, k.syncProfile(context.Background(), client, "kubelet-config.yaml"))
+
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "default", node.Annotations[WorkerProfileAnnotation])
+	assert.Equal(t, "default", node.Annotations[AppliedWorkerProfileAnnotation])
+
+	// nodes not registered yet are skipped
+	k.nodeName = "worker-2"
+	assert.NoError(t, k.syncProfile(context.Background(), client, "kubelet-config.yaml"))
+}
+
+func TestSyncProfileRecordsTheRequestedLabels(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}})
+	k := &Kubelet{profile: "default", nodeName: "worker-1", RequestedLabels: []string{"node-role.kubernetes.io/worker=", "node-role.kubernetes.io/edge="}}
+
+	require.NoError(t, k.syncProfile(context.Background(), client, "kubelet-config.yaml"))
+	node, err := client.CoreV1().Nodes().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "node-role.kubernetes.io/worker=,node-role.kubernetes.io/edge=", node.Annotations[token.RequestedNodeLabelsAnnotation])
+
+	k.RequestedLabels = nil
+	require.NoError(t, k.syncProfile(context.Background(), client, "kubelet-config.yaml"))
+	node, err = client.CoreV1().Nodes().Get(context.Background(), "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, node.Annotations, token.RequestedNodeLabelsAnnotation)
+}
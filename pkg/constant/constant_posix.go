@@ -27,6 +27,14 @@ const (
 	KineSocket                     = "kine/kine.sock:2379"
 	KubePauseContainerImage        = "k8s.gcr.io/pause"
 	KubePauseContainerImageVersion = "3.2"
+	// ContainerdConfigPath is the config of the k0s managed containerd, k0s generates it unless it's provided by the user
+	ContainerdConfigPath = "/etc/k0s/containerd.toml"
+	// ContainerdDropInDir has the drop-ins merged into the k0s managed containerd config
+	ContainerdDropInDir = "/etc/k0s/containerd.d"
+	// ContainerdCertsDir has the registry host configs of the k0s managed containerd
+	ContainerdCertsDir = "/etc/k0s/certs.d"
+	// KubeletCredentialProviderBinDir is the default location of the kubelet image credential provider plugins
+	KubeletCredentialProviderBinDir = "/usr/libexec/k0s/kubelet-plugins/credential-provider/exec"
 )
 
 func formatPath(dir string, file string) string {
@@ -0,0 +1,46 @@
+// +build !windows
+
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetConfigDirs(t *testing.T) {
+	vars := GetConfig("/var/lib/k0s")
+	assert.Equal(t, "/var/lib/k0s/bin", vars.BinDir)
+	assert.Equal(t, ContainerdConfigPath, vars.ContainerdConfigPath)
+
+	vars = GetConfigDirs(Dirs{
+		DataDir:             "/var/lib/k0s",
+		RunDir:              "/var/run/k0s",
+		BinDir:              "/opt/k0s/bin",
+		ContainerdConfigDir: "/var/lib/k0s/etc",
+	})
+	assert.Equal(t, "/var/run/k0s", vars.RunDir)
+	assert.Equal(t, "/var/run/k0s/kine/kine.sock:2379", vars.KineSocketPath)
+	assert.Equal(t, "/opt/k0s/bin", vars.BinDir)
+	assert.Equal(t, "/var/lib/k0s/etc/containerd.toml", vars.ContainerdConfigPath)
+	assert.Equal(t, "/var/lib/k0s/etc/containerd.d", vars.ContainerdDropInDir)
+	assert.Equal(t, "/var/lib/k0s/etc/certs.d", vars.ContainerdCertsDir)
+	// the state stays in the data dir
+	assert.Equal(t, "/var/lib/k0s/kubelet.conf", vars.KubeletAuthConfigPath)
+}
@@ -2,6 +2,7 @@ package constant
 
 import (
 	"os"
+	"path/filepath"
 	"runtime"
 )
 
@@ -35,6 +36,10 @@ const (
 	ManifestsDirMode = 0755
 	// KubeletVolumePlugindDirMode is the expected directory permissions for KubeleteVolumePluginDir
 	KubeletVolumePluginDirMode = 0700
+	// AuditDirMode is the expected directory permissions for AuditDir
+	AuditDirMode = 0750
+	// AdmissionDirMode is the expected directory permissions for AdmissionDir
+	AdmissionDirMode = 0750
 
 	// User accounts for services
 
@@ -50,6 +55,8 @@ const (
 	KonnectivityServerUser = "konnectivity-server"
 	// KubernetesMajorMinorVersion defines the current embedded major.minor version info
 	KubernetesMajorMinorVersion = "1.20"
+	// MetricsAggregatorPort is the port the builtin metrics.k8s.io aggregator listens on
+	MetricsAggregatorPort = 9446
 	// DefaultPSP defines the system level default PSP to apply
 	DefaultPSP = "00-k0s-privileged"
 	// Image Constants
@@ -67,11 +74,53 @@ const (
 	CalicoNodeImageVersion     = "v3.16.2"
 	KubeControllerImage        = "docker.io/calico/kube-controllers"
 	KubeControllerImageVersion = "v3.16.2"
+	// SnapshotControllerImage is the controller of the external-snapshotter release of KubernetesMajorMinorVersion, the
+	// snapshot CRDs are bundled from the same release. Both are bumped together with the Kubernetes minor version.
+	SnapshotControllerImage        = "k8s.gcr.io/sig-storage/snapshot-controller"
+	SnapshotControllerImageVersion = "v4.0.0"
+	// SnapshotterKubernetesVersion is the Kubernetes major.minor version the external-snapshotter release supports
+	SnapshotterKubernetesVersion = "1.20"
+	// KubePauseWindowsContainerImage is the pause image of the Windows workers, for bundling it on other platforms
+	KubePauseWindowsContainerImage = "mcr.microsoft.com/oss/kubernetes/pause:1.4.1"
+)
+
+// NVIDIA extension constants
+const (
+	NvidiaDevicePluginImage        = "nvcr.io/nvidia/k8s-device-plugin"
+	NvidiaDevicePluginImageVersion = "v0.9.0"
+	// NvidiaGPUOperatorVersion is the default version of the gpu-operator chart
+	NvidiaGPUOperatorVersion = "v1.6.2"
+	// NvidiaRuntimeClass is the name of the RuntimeClass and the containerd runtime handler of the NVIDIA runtime
+	NvidiaRuntimeClass = "nvidia"
+	// NvidiaGPUNodeLabel selects the nodes with the NVIDIA runtime for the device plugin and the RuntimeClass
+	NvidiaGPUNodeLabel = "nvidia.com/gpu.present"
+)
+
+// local-path provisioner extension constants
+const (
+	LocalPathProvisionerImage        = "docker.io/rancher/local-path-provisioner"
+	LocalPathProvisionerImageVersion = "v0.0.19"
+	LocalPathHelperImage             = "docker.io/library/busybox"
+	LocalPathHelperImageVersion      = "1.33.1"
+	// LocalPathDefaultDataDir is the default directory of the local-path volumes on the nodes
+	LocalPathDefaultDataDir = "/var/lib/k0s/local-path"
+	// LocalPathStorageClass is the name of the StorageClass and the provisioner of the local-path volumes
+	LocalPathStorageClass = "local-path"
+)
+
+// GitOps extension constants
+const (
+	// FluxChartVersion is the default version of the flux2 chart
+	FluxChartVersion = "0.2.1"
+	// ArgoCDChartVersion is the default version of the argo-cd chart
+	ArgoCDChartVersion = "3.6.8"
 )
 
 // CfgVars is a struct that holds all the config variables required for K0s
 type CfgVars struct {
 	AdminKubeConfigPath        string // The cluster admin kubeconfig location
+	AdmissionDir               string // location for the staged apiserver admission plugin configs
+	AuditDir                   string // location for the apiserver audit policy and audit logs
 	BinDir                     string // location for all pki related binaries
 	CertRootDir                string // CertRootDir defines the root location for all pki related artifacts
 	WindowsCertRootDir         string // WindowsCertRootDir defines the root location for all pki related artifacts
@@ -82,12 +131,17 @@ type CfgVars struct {
 	KonnectivitySocketDir      string // location of konnectivity's socket path
 	KubeletAuthConfigPath      string // KubeletAuthConfigPath defines the default kubelet auth config path
 	KubeletBootstrapConfigPath string // KubeletBootstrapConfigPath defines the default path for kubelet bootstrap auth config
+	KubeletConfigDropInDir     string // location of the kubelet config drop-ins merged into the config of the worker profile
 	KubeletVolumePluginDir     string // location for kubelet plugins volume executables
+	KubeletPodResourcesSocket  string // location of the kubelet podresources API socket
 	ManifestsDir               string // location for all stack manifests
 	RunDir                     string // location of supervised pid files and sockets
 	KonnectivityKubeConfigPath string // location for konnectivity kubeconfig
 	OCIBundleDir               string // location for OCI bundles
 	DefaultStorageType         string // Default backend storage
+	ContainerdConfigPath       string // location of the k0s managed containerd config
+	ContainerdDropInDir        string // location of the drop-ins merged into the k0s managed containerd config
+	ContainerdCertsDir         string // location of the registry host configs of the k0s managed containerd
 
 	// Helm config
 	HelmHome             string
@@ -95,8 +149,27 @@ type CfgVars struct {
 	HelmRepositoryConfig string
 }
 
+// Dirs are the directories k0s writes to. The empty ones default to the ones derived from the data dir, so that
+// hosts with a read-only root filesystem can point them to writable volumes.
+type Dirs struct {
+	// DataDir contains the k0s state
+	DataDir string
+	// RunDir contains the pid files and the sockets, /run/k0s for root
+	RunDir string
+	// BinDir contains the staged binaries
+	BinDir string
+	// ContainerdConfigDir contains the k0s managed containerd config, its drop-ins and the registry host configs
+	ContainerdConfigDir string
+}
+
 // GetConfig returns the pointer to a Config struct
 func GetConfig(dataDir string) CfgVars {
+	return GetConfigDirs(Dirs{DataDir: dataDir})
+}
+
+// GetConfigDirs returns the config variables with the given directories
+func GetConfigDirs(dirs Dirs) CfgVars {
+	dataDir := dirs.DataDir
 	if dataDir == "" {
 		switch runtime.GOOS {
 		case "windows":
@@ -106,19 +179,31 @@ func GetConfig(dataDir string) CfgVars {
 		}
 	}
 
-	var runDir string
-	if os.Geteuid() == 0 {
+	runDir := dirs.RunDir
+	if runDir == "" && os.Geteuid() == 0 {
 		runDir = "/run/k0s"
-	} else {
+	} else if runDir == "" {
 		runDir = formatPath(dataDir, "run")
 	}
+	binDir := dirs.BinDir
+	if binDir == "" {
+		binDir = formatPath(dataDir, "bin")
+	}
+	containerdConfigPath, containerdDropInDir, containerdCertsDir := ContainerdConfigPath, ContainerdDropInDir, ContainerdCertsDir
+	if dirs.ContainerdConfigDir != "" {
+		containerdConfigPath = formatPath(dirs.ContainerdConfigDir, filepath.Base(ContainerdConfigPath))
+		containerdDropInDir = formatPath(dirs.ContainerdConfigDir, filepath.Base(ContainerdDropInDir))
+		containerdCertsDir = formatPath(dirs.ContainerdConfigDir, filepath.Base(ContainerdCertsDir))
+	}
 	certDir := formatPath(dataDir, "pki")
 	winCertDir := WinDataDirDefault + "\\pki" // hacky but we need it to be windows style even on linux machine
 	helmHome := formatPath(dataDir, "helmhome")
 
 	return CfgVars{
 		AdminKubeConfigPath:        formatPath(certDir, "admin.conf"),
-		BinDir:                     formatPath(dataDir, "bin"),
+		AdmissionDir:               formatPath(dataDir, "admission"),
+		AuditDir:                   formatPath(dataDir, "audit"),
+		BinDir:                     binDir,
 		OCIBundleDir:               formatPath(dataDir, "images"),
 		CertRootDir:                certDir,
 		WindowsCertRootDir:         winCertDir,
@@ -129,10 +214,15 @@ func GetConfig(dataDir string) CfgVars {
 		KonnectivitySocketDir:      formatPath(runDir, "konnectivity-server"),
 		KubeletAuthConfigPath:      formatPath(dataDir, "kubelet.conf"),
 		KubeletBootstrapConfigPath: formatPath(dataDir, "kubelet-bootstrap.conf"),
+		KubeletConfigDropInDir:     formatPath(dataDir, "kubelet.conf.d"),
 		KubeletVolumePluginDir:     KubeletVolumePluginDir,
+		KubeletPodResourcesSocket:  formatPath(dataDir, "kubelet/pod-resources/kubelet.sock"),
 		ManifestsDir:               formatPath(dataDir, "manifests"),
 		RunDir:                     runDir,
 		KonnectivityKubeConfigPath: formatPath(certDir, "konnectivity.conf"),
+		ContainerdConfigPath:       containerdConfigPath,
+		ContainerdDropInDir:        containerdDropInDir,
+		ContainerdCertsDir:         containerdCertsDir,
 
 		// Helm Config
 		HelmHome:             helmHome,
@@ -33,10 +33,18 @@ const (
 	ManifestsDir = "C:\\var\\lib\\k0s\\manifests"
 	// KubeletVolumePluginDir defines the location for kubelet plugins volume executables
 	KubeletVolumePluginDir = "C:\\usr\\libexec\\k0s\\kubelet-plugins\\volume\\exec"
+	// KubeletCredentialProviderBinDir is the default location of the kubelet image credential provider plugins
+	KubeletCredentialProviderBinDir = "C:\\usr\\libexec\\k0s\\kubelet-plugins\\credential-provider\\exec"
 
 	KineSocket                     = "kine\\kine.sock:2379"
 	KubePauseContainerImage        = "mcr.microsoft.com/oss/kubernetes/pause"
 	KubePauseContainerImageVersion = "1.4.1"
+	// ContainerdConfigPath is the config of the k0s managed containerd, k0s generates it unless it's provided by the user
+	ContainerdConfigPath = "C:\\etc\\k0s\\containerd.toml"
+	// ContainerdDropInDir has the drop-ins merged into the k0s managed containerd config
+	ContainerdDropInDir = "C:\\etc\\k0s\\containerd.d"
+	// ContainerdCertsDir has the registry host configs of the k0s managed containerd
+	ContainerdCertsDir = "C:\\etc\\k0s\\certs.d"
 )
 
 func formatPath(dir string, file string) string {
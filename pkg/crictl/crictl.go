@@ -79,6 +79,43 @@ func (c *CriCtl) StopPod(id string) error {
 	return nil
 }
 
+// RuntimeName returns the name of the container runtime, e.g. containerd or cri-o
+func (c *CriCtl) RuntimeName() (string, error) {
+	client, conn, err := getRuntimeClient(c.addr)
+	defer closeConnection(conn)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create CRI runtime client")
+	}
+	if client == nil {
+		return "", errors.Errorf("failed to create CRI runtime client")
+	}
+	request := &pb.VersionRequest{}
+	logrus.Debugf("VersionRequest: %v", request)
+	r, err := client.Version(context.Background(), request)
+	logrus.Debugf("VersionResponse: %v", r)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the runtime version")
+	}
+	return r.RuntimeName, nil
+}
+
+// PullImage pulls the image with the CRI image service. The layers present already are not pulled again, so pulling
+// an image again only refreshes its tag.
+func (c *CriCtl) PullImage(ctx context.Context, image string) error {
+	conn, err := getRuntimeClientConnection(c.addr)
+	defer closeConnection(conn)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create CRI image client")
+	}
+	client := pb.NewImageServiceClient(conn)
+	r, err := client.PullImage(ctx, &pb.PullImageRequest{Image: &pb.ImageSpec{Image: image}})
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull %s", image)
+	}
+	logrus.Debugf("pulled %s: %s", image, r.GetImageRef())
+	return nil
+}
+
 func getRuntimeClient(addr string) (pb.RuntimeServiceClient, *grpc.ClientConn, error) {
 	conn, err := getRuntimeClientConnection(addr)
 	if err != nil {
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fips
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// CipherSuites are the FIPS 140-2 approved TLS 1.2 cipher suites supported by the k0s components
+var CipherSuites = []string{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+}
+
+// MinTLSVersion is the lowest TLS version allowed in FIPS mode
+const MinTLSVersion = "VersionTLS12"
+
+// Enabled reports whether k0s has been built with the FIPS validated crypto backend
+func Enabled() bool {
+	return enabled
+}
+
+// Check fails if FIPS mode is requested but k0s hasn't been built with the FIPS validated crypto backend
+func Check() error {
+	if !enabled {
+		return fmt.Errorf("FIPS mode requested but k0s has not been built with FIPS support, see docs/fips.md")
+	}
+	return nil
+}
+
+// KubeArgs returns the TLS flags of the kubernetes components (kube-apiserver, kube-controller-manager, kube-scheduler
+// and kubelet) for FIPS mode
+func KubeArgs() map[string]string {
+	return map[string]string{
+		"tls-cipher-suites": strings.Join(CipherSuites, ","),
+		"tls-min-version":   MinTLSVersion,
+	}
+}
+
+// EtcdArgs returns the TLS flags of etcd for FIPS mode
+func EtcdArgs() []string {
+	return []string{
+		fmt.Sprintf("--cipher-suites=%s", strings.Join(CipherSuites, ",")),
+	}
+}
+
+// TLSConfig restricts the TLS config of the k0s servers to FIPS approved parameters
+func TLSConfig(config *tls.Config) {
+	config.MinVersion = tls.VersionTLS12
+	config.CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}
+}
+
+// ValidateArgs checks the flags of a component for TLS settings not allowed in FIPS mode
+func ValidateArgs(component string, args map[string]string) []error {
+	var errors []error
+	for _, name := range []string{"tls-cipher-suites", "cipher-suites"} {
+		value, found := args[name]
+		if !found {
+			continue
+		}
+		for _, suite := range strings.Split(value, ",") {
+			if !isApproved(strings.TrimSpace(suite)) {
+				errors = append(errors, fmt.Errorf("%s: cipher suite %s is not allowed in FIPS mode", component, suite))
+			}
+		}
+	}
+	if version, found := args["tls-min-version"]; found && version != "VersionTLS12" && version != "VersionTLS13" {
+		errors = append(errors, fmt.Errorf("%s: TLS version %s is not allowed in FIPS mode, use %s or later", component, version, MinTLSVersion))
+	}
+	return errors
+}
+
+func isApproved(suite string) bool {
+	for _, s := range CipherSuites {
+		if s == suite {
+			return true
+		}
+	}
+	return false
+}
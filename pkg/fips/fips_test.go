@@ -0,0 +1,44 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fips
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateArgs(t *testing.T) {
+	assert.Empty(t, ValidateArgs("kube-apiserver", KubeArgs()))
+	assert.Empty(t, ValidateArgs("kube-apiserver", map[string]string{"tls-min-version": "VersionTLS13"}))
+
+	errors := ValidateArgs("kube-apiserver", map[string]string{
+		"tls-cipher-suites": "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+		"tls-min-version":   "VersionTLS10",
+	})
+	assert.Len(t, errors, 2)
+
+	errors = ValidateArgs("etcd", map[string]string{"cipher-suites": "TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Len(t, errors, 1)
+}
+
+func TestCheck(t *testing.T) {
+	if Enabled() {
+		assert.NoError(t, Check())
+	} else {
+		assert.Error(t, Check())
+	}
+}
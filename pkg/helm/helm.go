@@ -1,11 +1,14 @@
 package helm
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/k0sproject/k0s/internal/util"
 	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
@@ -18,7 +21,9 @@ import (
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
 	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
@@ -63,19 +68,16 @@ func (hc *Commands) getActionCfg(namespace string) (*action.Configuration, error
 	return actionConfig, nil
 }
 
+// AddRepository adds the repository to the repositories file of helm. The index of chart repositories is downloaded
+// right away, OCI registries are only contacted once a chart is pulled from them.
 func (hc *Commands) AddRepository(repoCfg k0sv1beta1.Repository) error {
 	err := util.InitDirectory(filepath.Dir(hc.repoFile), constant.DataDirMode)
 	if err != nil && !os.IsExist(err) {
 		return fmt.Errorf("can't add repository to %s: %v", hc.repoFile, err)
 	}
 
-	b, err := ioutil.ReadFile(hc.repoFile)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("can't add repository to %s: %v", hc.repoFile, err)
-	}
-
-	var f repo.File
-	if err := yaml.Unmarshal(b, &f); err != nil {
+	f, err := hc.loadRepoFile()
+	if err != nil {
 		return fmt.Errorf("can't add repository to %s: %v", hc.repoFile, err)
 	}
 
@@ -87,18 +89,24 @@ func (hc *Commands) AddRepository(repoCfg k0sv1beta1.Repository) error {
 		CertFile:              repoCfg.CertFile,
 		KeyFile:               repoCfg.KeyFile,
 		CAFile:                repoCfg.CAFile,
-		InsecureSkipTLSverify: true,
+		InsecureSkipTLSverify: repoCfg.Insecure,
 	}
-
-	r, err := repo.NewChartRepository(&c, getters)
-	r.CachePath = hc.helmCacheDir
-
-	if err != nil {
-		return fmt.Errorf("can't add repository to %s: %v", hc.repoFile, err)
+	if repoCfg.CA != "" {
+		if c.CAFile, err = hc.writeCA(repoCfg.Name, repoCfg.CA); err != nil {
+			return fmt.Errorf("can't add repository %s: %v", repoCfg.Name, err)
+		}
 	}
 
-	if _, err := r.DownloadIndexFile(); err != nil {
-		return fmt.Errorf("can't add repository: %q is not a valid chart repository or cannot be reached: %v", "repo", err)
+	if !repoCfg.IsOCI() {
+		r, err := repo.NewChartRepository(&c, getters)
+		if err != nil {
+			return fmt.Errorf("can't add repository to %s: %v", hc.repoFile, err)
+		}
+		r.CachePath = hc.helmCacheDir
+
+		if _, err := r.DownloadIndexFile(); err != nil {
+			return fmt.Errorf("can't add repository: %q is not a valid chart repository or cannot be reached: %v", repoCfg.URL, err)
+		}
 	}
 	f.Update(&c)
 	if err := f.WriteFile(hc.repoFile, 0644); err != nil {
@@ -108,6 +116,79 @@ func (hc *Commands) AddRepository(repoCfg k0sv1beta1.Repository) error {
 	return nil
 }
 
+func (hc *Commands) loadRepoFile() (*repo.File, error) {
+	b, err := ioutil.ReadFile(hc.repoFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var f repo.File
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// writeCA writes the CA bundle of the repository into the helm cache and returns its path
+func (hc *Commands) writeCA(name string, ca string) (string, error) {
+	dir := filepath.Join(hc.helmCacheDir, "ca")
+	if err := util.InitDirectory(dir, constant.DataDirMode); err != nil {
+		return "", err
+	}
+	caFile := filepath.Join(dir, name+".crt")
+	if err := ioutil.WriteFile(caFile, []byte(ca), 0644); err != nil {
+		return "", err
+	}
+	return caFile, nil
+}
+
+// ociChart resolves the chart name to an oci:// reference and the repository entry holding its credentials. The
+// chart may be given either as a full oci:// reference or as <repository>/<chart> of an OCI repository.
+func (hc *Commands) ociChart(name string) (string, *repo.Entry, bool, error) {
+	isOCI := strings.HasPrefix(name, k0sv1beta1.OCIScheme)
+	if !isOCI && !strings.Contains(name, "/") {
+		return "", nil, false, nil
+	}
+	f, err := hc.loadRepoFile()
+	if err != nil {
+		return "", nil, false, err
+	}
+	for _, entry := range f.Repositories {
+		if !strings.HasPrefix(entry.URL, k0sv1beta1.OCIScheme) {
+			continue
+		}
+		url := strings.TrimSuffix(entry.URL, "/")
+		if isOCI && strings.HasPrefix(name, url+"/") {
+			return name, entry, true, nil
+		}
+		if !isOCI && strings.HasPrefix(name, entry.Name+"/") {
+			return url + strings.TrimPrefix(name, entry.Name), entry, true, nil
+		}
+	}
+	return name, nil, isOCI, nil
+}
+
+// pullOCIChart downloads the chart from the OCI registry into the helm cache and returns the path of the archive
+func (hc *Commands) pullOCIChart(name string, version string, entry *repo.Entry) (string, error) {
+	ref, err := parseOCIReference(name, version)
+	if err != nil {
+		return "", err
+	}
+	client, err := newOCIClient(entry)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(hc.helmCacheDir, "oci")
+	if err := util.InitDirectory(dir, constant.DataDirMode); err != nil {
+		return "", err
+	}
+	filename, err := client.pull(ref, dir)
+	if err != nil {
+		return "", fmt.Errorf("can't pull chart `%s`: %v", name, err)
+	}
+	return filename, nil
+}
+
 func (hc *Commands) downloadDependencies(chart *chart.Chart, chartPath string) error {
 	if chart.Metadata.Dependencies == nil {
 		return nil
@@ -143,6 +224,12 @@ func (hc *Commands) locateChart(name string, version string) (string, error) {
 		return name, fmt.Errorf("can't locate chart: path not found: %s", name)
 	}
 
+	if ref, entry, ok, err := hc.ociChart(name); err != nil {
+		return name, fmt.Errorf("can't locate chart `%s-%s`: %v", name, version, err)
+	} else if ok {
+		return hc.pullOCIChart(ref, version, entry)
+	}
+
 	dl := downloader.ChartDownloader{
 		Out:     os.Stdout,
 		Getters: getters,
@@ -195,13 +282,34 @@ func (hc *Commands) isInstallable(chart *chart.Chart) bool {
 	return true
 }
 
-func (hc *Commands) InstallChart(chartName string, version string, namespace string, values map[string]interface{}) (*release.Release, error) {
+// ChartOptions are the options of installing and upgrading a chart, the same as the flags of helm install and upgrade
+type ChartOptions struct {
+	// Timeout of waiting for the resources and hooks
+	Timeout time.Duration
+	// Atomic uninstalls a failed install and rolls back a failed upgrade, it implies Wait
+	Atomic bool
+	// Wait for the resources to be ready before marking the release successful
+	Wait bool
+	// SkipCRDs skips installing the CRDs of the chart
+	SkipCRDs bool
+	// DisableHooks skips running the hooks of the chart
+	DisableHooks bool
+	// Force replaces the changed resources on upgrade instead of patching them
+	Force bool
+}
+
+func (hc *Commands) InstallChart(chartName string, version string, namespace string, values map[string]interface{}, opts ChartOptions) (*release.Release, error) {
 	cfg, err := hc.getActionCfg(namespace)
 	if err != nil {
 		return nil, fmt.Errorf("can't create action configuration: %v", err)
 	}
 	install := action.NewInstall(cfg)
 	install.CreateNamespace = true
+	install.Timeout = opts.Timeout
+	install.Atomic = opts.Atomic
+	install.Wait = opts.Wait || opts.Atomic
+	install.SkipCRDs = opts.SkipCRDs
+	install.DisableHooks = opts.DisableHooks
 	chartDir, err := hc.locateChart(chartName, version)
 	if err != nil {
 		return nil, err
@@ -238,13 +346,19 @@ func (hc *Commands) InstallChart(chartName string, version string, namespace str
 	return release, nil
 }
 
-func (hc *Commands) UpgradeChart(chartName string, version string, releaseName string, namespace string, values map[string]interface{}) (*release.Release, error) {
+// UpgradeChart upgrades the release to the chart. Upgrades never install the CRDs of the chart, like helm upgrade.
+func (hc *Commands) UpgradeChart(chartName string, version string, releaseName string, namespace string, values map[string]interface{}, opts ChartOptions) (*release.Release, error) {
 	cfg, err := hc.getActionCfg(namespace)
 	if err != nil {
 		return nil, fmt.Errorf("can't create action configuration: %v", err)
 	}
 	upgrade := action.NewUpgrade(cfg)
 	upgrade.Namespace = namespace
+	upgrade.Timeout = opts.Timeout
+	upgrade.Atomic = opts.Atomic
+	upgrade.Wait = opts.Wait || opts.Atomic
+	upgrade.DisableHooks = opts.DisableHooks
+	upgrade.Force = opts.Force
 
 	chartDir, err := hc.locateChart(chartName, version)
 	if err != nil {
@@ -276,6 +390,44 @@ func (hc *Commands) UpgradeChart(chartName string, version string, releaseName s
 	return release, nil
 }
 
+// TemplateChart renders the manifests of the chart and its hooks locally, like helm template, without installing it
+func (hc *Commands) TemplateChart(chartName string, version string, namespace string, values map[string]interface{}) (string, error) {
+	install := action.NewInstall(&action.Configuration{})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.Namespace = namespace
+	install.ReleaseName = "release-name"
+
+	chartDir, err := hc.locateChart(chartName, version)
+	if err != nil {
+		return "", err
+	}
+	chart, err := loader.Load(chartDir)
+	if err != nil {
+		return "", fmt.Errorf("can't load chart `%s`: %v", chartDir, err)
+	}
+	if err := hc.downloadDependencies(chart, chartDir); err != nil {
+		return "", err
+	}
+	chart, err = loader.Load(chartDir)
+	if err != nil {
+		return "", fmt.Errorf("can't reload chart `%s`: %v", chartDir, err)
+	}
+
+	release, err := install.Run(chart, values)
+	if err != nil {
+		return "", fmt.Errorf("can't render chart `%s`: %v", chart.Name(), err)
+	}
+	var manifests strings.Builder
+	manifests.WriteString(release.Manifest)
+	for _, hook := range release.Hooks {
+		fmt.Fprintf(&manifests, "\n---\n%s", hook.Manifest)
+	}
+	return manifests.String(), nil
+}
+
 func stringptr(s string) *string {
 	return &s
 }
@@ -289,14 +441,63 @@ func (hc *Commands) ListReleases(namespace string) ([]*release.Release, error) {
 	return action.Run()
 }
 
-func (hc *Commands) UninstallRelease(releaseName string, namespace string) error {
+// GetRelease returns the latest revision of the release
+func (hc *Commands) GetRelease(releaseName string, namespace string) (*release.Release, error) {
+	cfg, err := hc.getActionCfg(namespace)
+	if err != nil {
+		return nil, fmt.Errorf("can't create action configuration: %v", err)
+	}
+	return action.NewGet(cfg).Run(releaseName)
+}
+
+// UninstallRelease uninstalls the release, a release already gone isn't an error. With keepCRDs the CRDs are first
+// dropped from the manifest of the release, so that helm keeps them along with the custom resources.
+func (hc *Commands) UninstallRelease(releaseName string, namespace string, keepCRDs bool) error {
 	cfg, err := hc.getActionCfg(namespace)
 	if err != nil {
 		return fmt.Errorf("can't create action configuration: %v", err)
 	}
+	if keepCRDs {
+		rel, err := cfg.Releases.Last(releaseName)
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("can't get release `%s`: %v", releaseName, err)
+		}
+		rel.Manifest = withoutCRDs(rel.Manifest)
+		if err := cfg.Releases.Update(rel); err != nil {
+			return fmt.Errorf("can't drop the CRDs from release `%s`: %v", releaseName, err)
+		}
+	}
 	action := action.NewUninstall(cfg)
 	if _, err := action.Run(releaseName); err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil
+		}
 		return fmt.Errorf("can't uninstall release `%s`: %v", releaseName, err)
 	}
 	return nil
 }
+
+// withoutCRDs removes the CustomResourceDefinitions from the release manifest
+func withoutCRDs(manifest string) string {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var b strings.Builder
+	for _, key := range keys {
+		var object struct {
+			Kind string `yaml:"kind"`
+		}
+		if err := yaml.Unmarshal([]byte(manifests[key]), &object); err == nil && object.Kind == "CustomResourceDefinition" {
+			continue
+		}
+		fmt.Fprintf(&b, "---\n%s\n", manifests[key])
+	}
+	return b.String()
+}
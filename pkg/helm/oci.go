@@ -0,0 +1,325 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// chartLayerMediaTypes are the media types of the chart archive layer, helm 3.0-3.6 pushed charts with the
+	// legacy one
+	chartLayerMediaType       = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	legacyChartLayerMediaType = "application/tar+gzip"
+)
+
+// ociReference is a chart in an OCI registry, oci://<host>/<repository>:<tag>
+type ociReference struct {
+	Host       string
+	Repository string
+	Tag        string
+}
+
+// parseOCIReference parses the oci:// chart name, the version is used as the tag unless the name has one
+func parseOCIReference(name string, version string) (ociReference, error) {
+	ref := strings.TrimPrefix(name, k0sv1beta1.OCIScheme)
+	i := strings.Index(ref, "/")
+	if i <= 0 || i == len(ref)-1 {
+		return ociReference{}, fmt.Errorf("invalid OCI chart reference %q", name)
+	}
+	r := ociReference{Host: ref[:i], Repository: ref[i+1:], Tag: version}
+	if j := strings.LastIndex(r.Repository, ":"); j >= 0 {
+		if version != "" && version != r.Repository[j+1:] {
+			return ociReference{}, fmt.Errorf("OCI chart reference %q doesn't match version %s", name, version)
+		}
+		r.Tag = r.Repository[j+1:]
+		r.Repository = r.Repository[:j]
+	}
+	if r.Tag == "" {
+		return ociReference{}, fmt.Errorf("version is required for OCI chart %q", name)
+	}
+	// OCI tags can't contain the + of semver build metadata, helm pushes them with _ instead
+	r.Tag = strings.Replace(r.Tag, "+", "_", -1)
+	return r, nil
+}
+
+// CredentialsFromDockerConfig looks up the username and password of the registry host from a docker config.json.
+// The keys of the auths may be URLs, e.g. https://registry.example.com/v2/.
+func CredentialsFromDockerConfig(data []byte, host string) (string, string, error) {
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", "", fmt.Errorf("failed to parse the docker config: %w", err)
+	}
+	for key, auth := range config.Auths {
+		keyHost := key
+		if u, err := url.Parse(key); err == nil && u.Host != "" {
+			keyHost = u.Host
+		}
+		if keyHost != host {
+			continue
+		}
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid auth of %s in the docker config: %w", key, err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", "", fmt.Errorf("invalid auth of %s in the docker config: expected username:password", key)
+		}
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("no credentials for %s found in the docker config", host)
+}
+
+// ociClient pulls charts from an OCI registry with the distribution API. The registry token is requested on demand
+// when the registry challenges a request.
+type ociClient struct {
+	client   *http.Client
+	username string
+	password string
+	token    string
+}
+
+// newOCIClient creates a client using the credentials and TLS settings of the repository entry, which may be nil
+func newOCIClient(entry *repo.Entry) (*ociClient, error) {
+	c := &ociClient{}
+	tlsConfig := &tls.Config{}
+	if entry != nil {
+		c.username = entry.Username
+		c.password = entry.Password
+		tlsConfig.InsecureSkipVerify = entry.InsecureSkipTLSverify
+		if entry.CAFile != "" {
+			ca, err := ioutil.ReadFile(entry.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("can't read the CA of repository %s: %v", entry.Name, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in the CA of repository %s", entry.Name)
+			}
+		}
+		if entry.CertFile != "" && entry.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(entry.CertFile, entry.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("can't load the client certificate of repository %s: %v", entry.Name, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.client = &http.Client{Transport: transport, Timeout: 5 * time.Minute}
+	return c, nil
+}
+
+// pull downloads the chart archive into dir and returns its path
+func (c *ociClient) pull(ref ociReference, dir string) (string, error) {
+	base := fmt.Sprintf("https://%s/v2/%s", ref.Host, ref.Repository)
+	resp, err := c.get(base+"/manifests/"+ref.Tag, ociManifestMediaType)
+	if err != nil {
+		return "", err
+	}
+	var manifest struct {
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	digest := ""
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == chartLayerMediaType || layer.MediaType == legacyChartLayerMediaType {
+			digest = layer.Digest
+			break
+		}
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("%s:%s is not a helm chart", ref.Repository, ref.Tag)
+	}
+
+	resp, err = c.get(base+"/blobs/"+digest, "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	filename := filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", path.Base(ref.Repository), ref.Tag))
+	tmp, err := ioutil.TempFile(dir, ".oci-chart-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download the chart: %v", err)
+	}
+	if actual := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		return "", fmt.Errorf("digest mismatch of the chart: expected %s, got %s", digest, actual)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// get requests the url, authorizing against the registry if it challenges the request
+func (c *ociClient) get(url string, accept string) (*http.Response, error) {
+	resp, err := c.do(url, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authorize(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(url, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *ociClient) do(url string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.client.Do(req)
+}
+
+// authorize requests a token as described by the bearer challenge of the registry
+func (c *ociClient) authorize(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if scheme != "bearer" {
+		if c.username == "" {
+			return fmt.Errorf("the registry requires credentials")
+		}
+		return fmt.Errorf("the registry rejected the credentials")
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	for _, param := range []string{"service", "scope"} {
+		if params[param] != "" {
+			query.Set(param, params[param])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get a registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get a registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("invalid registry token: %v", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("the registry returned an empty token")
+	}
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header, e.g. Bearer realm="https://auth.example.com/token",scope="..."
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme := strings.ToLower(parts[0])
+	if len(parts) == 1 {
+		return scheme, params
+	}
+	rest := parts[1]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma+1:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
@@ -0,0 +1,131 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/repo"
+
+	k0sv1beta1 "github.com/k0sproject/k0s/pkg/apis/v1beta1"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	ref, err := parseOCIReference("oci://registry.example.com/charts/app", "1.2.3+build.1")
+	require.NoError(t, err)
+	assert.Equal(t, ociReference{Host: "registry.example.com", Repository: "charts/app", Tag: "1.2.3_build.1"}, ref)
+
+	ref, err = parseOCIReference("oci://localhost:5000/app:0.1.0", "")
+	require.NoError(t, err)
+	assert.Equal(t, ociReference{Host: "localhost:5000", Repository: "app", Tag: "0.1.0"}, ref)
+
+	_, err = parseOCIReference("oci://registry.example.com/charts/app", "")
+	assert.EqualError(t, err, `version is required for OCI chart "oci://registry.example.com/charts/app"`)
+	_, err = parseOCIReference("oci://registry.example.com", "1.0.0")
+	assert.Error(t, err)
+}
+
+func TestCredentialsFromDockerConfig(t *testing.T) {
+	config := []byte(`{"auths": {
+		"https://registry.example.com/v2/": {"auth": "dXNlcjpwYXNz"},
+		"other.example.com": {"username": "other", "password": "secret"}
+	}}`)
+
+	username, password, err := CredentialsFromDockerConfig(config, "registry.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "pass", password)
+
+	username, password, err = CredentialsFromDockerConfig(config, "other.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "other", username)
+	assert.Equal(t, "secret", password)
+
+	_, _, err = CredentialsFromDockerConfig(config, "unknown.example.com")
+	assert.EqualError(t, err, "no credentials for unknown.example.com found in the docker config")
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:charts/app:pull,push"`)
+	assert.Equal(t, "bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry",
+		"scope":   "repository:charts/app:pull,push",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	assert.Equal(t, "basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
+
+func TestPullOCIChart(t *testing.T) {
+	chart := []byte("chart archive")
+	sum := sha256.Sum256(chart)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "user" || password != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, "repository:charts/app:pull", r.URL.Query().Get("scope"))
+			fmt.Fprint(w, `{"token": "t0ken"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:charts/app:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/charts/app/manifests/1.0.0":
+			assert.Equal(t, ociManifestMediaType, r.Header.Get("Accept"))
+			fmt.Fprintf(w, `{"layers": [{"mediaType": "application/vnd.cncf.helm.config.v1+json", "digest": "sha256:0"}, {"mediaType": %q, "digest": %q}]}`, chartLayerMediaType, digest)
+		case "/v2/charts/app/blobs/" + digest:
+			_, _ = w.Write(chart)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	dir, err := ioutil.TempDir("", "helm-oci")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	hc := &Commands{repoFile: filepath.Join(dir, "repositories.yaml"), helmCacheDir: filepath.Join(dir, "cache")}
+
+	require.NoError(t, hc.AddRepository(k0sv1beta1.Repository{
+		Name:     "private",
+		URL:      "oci://" + host + "/charts",
+		Username: "user",
+		Password: "pass",
+		Insecure: true,
+	}))
+
+	filename, err := hc.locateChart("private/app", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "cache", "oci", "app-1.0.0.tgz"), filename)
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, chart, data)
+
+	_, err = hc.pullOCIChart("oci://"+host+"/charts/app", "1.0.0", &repo.Entry{Name: "anonymous", InsecureSkipTLSverify: true})
+	assert.Contains(t, err.Error(), "failed to get a registry token: 401 Unauthorized")
+
+	_, err = hc.locateChart("oci://"+host+"/charts/app", "2.0.0")
+	assert.Contains(t, err.Error(), "404 Not Found")
+}
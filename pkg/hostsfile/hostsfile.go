@@ -0,0 +1,84 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package hostsfile
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// DefaultPath is the hosts file of the node
+const DefaultPath = "/etc/hosts"
+
+const (
+	beginMarker = "# BEGIN k0s managed host aliases, do not edit"
+	endMarker   = "# END k0s managed host aliases"
+)
+
+// Update replaces the k0s managed block of the hosts file with the given entries, an empty entries removes the block.
+// The rest of the file is left untouched and the file is not rewritten if nothing changes.
+func Update(path string, entries string) error {
+	current, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && entries == "" {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	updated := render(string(current), entries)
+	if updated == string(current) {
+		return nil
+	}
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	}
+	// the hosts file is often a bind mount, e.g. in containers, so it's written in place instead of renamed over
+	return ioutil.WriteFile(path, []byte(updated), mode)
+}
+
+// Remove removes the k0s managed block from the hosts file
+func Remove(path string) error {
+	return Update(path, "")
+}
+
+// render returns the content with the managed block replaced by the entries
+func render(content string, entries string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var b strings.Builder
+	inBlock := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == beginMarker:
+			inBlock = true
+		case trimmed == endMarker:
+			inBlock = false
+		case !inBlock:
+			b.WriteString(line)
+		}
+	}
+	result := b.String()
+	entries = strings.TrimSpace(entries)
+	if entries == "" {
+		return result
+	}
+	if result != "" && !strings.HasSuffix(result, "\n") {
+		result += "\n"
+	}
+	return result + beginMarker + "\n" + entries + "\n" + endMarker + "\n"
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package hostsfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostsfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts")
+	original := "127.0.0.1 localhost\n::1 localhost\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(original), 0644))
+
+	read := func() string {
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	require.NoError(t, Update(path, "10.0.0.10 registry.edge.local\n"))
+	assert.Equal(t, original+beginMarker+"\n10.0.0.10 registry.edge.local\n"+endMarker+"\n", read())
+
+	// the block is replaced, not appended
+	require.NoError(t, Update(path, "10.0.0.11 registry.edge.local\n10.0.0.12 api.edge.local\n"))
+	assert.Equal(t, original+beginMarker+"\n10.0.0.11 registry.edge.local\n10.0.0.12 api.edge.local\n"+endMarker+"\n", read())
+
+	require.NoError(t, Remove(path))
+	assert.Equal(t, original, read())
+
+	require.NoError(t, Remove(filepath.Join(dir, "missing")))
+}
+
+func TestRenderKeepsSurroundingLines(t *testing.T) {
+	content := "127.0.0.1 localhost\n" + beginMarker + "\n1.2.3.4 old\n" + endMarker + "\n10.0.0.1 custom"
+	assert.Equal(t, "127.0.0.1 localhost\n10.0.0.1 custom\n"+beginMarker+"\n1.2.3.4 new\n"+endMarker+"\n", render(content, "1.2.3.4 new"))
+	assert.Equal(t, "127.0.0.1 localhost\n10.0.0.1 custom", render(content, ""))
+}
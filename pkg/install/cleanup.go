@@ -30,10 +30,17 @@ import (
 type CleanUpConfig struct {
 	containerdBinPath    string
 	containerdCmd        *exec.Cmd
+	containerdConfigPath string
 	containerdSockerPath string
 	criCtl               *crictl.CriCtl
 	dataDir              string
 	runDir               string
+	// externalCRI is set when the worker uses an external container runtime instead of the k0s managed containerd
+	externalCRI bool
+	// dockerHost is the docker socket when the external runtime is docker
+	dockerHost string
+	// binDir is removed along the data dir when it's relocated out of it
+	binDir string
 }
 
 func (c *CleanUpConfig) WorkerCleanup() error {
@@ -42,12 +49,14 @@ func (c *CleanUpConfig) WorkerCleanup() error {
 	if err := c.workerPreFlightChecks(); err != nil {
 		logrus.Fatalf("failed clean up pre-flight-checks: %v", err)
 	}
-	logrus.Info("starting containerd for cleanup operations...")
+	if !c.externalCRI {
+		logrus.Info("starting containerd for cleanup operations...")
 
-	if err := c.startContainerd(); err != nil {
-		return err
+		if err := c.startContainerd(); err != nil {
+			return err
+		}
+		logrus.Info("containerd succesfully started")
 	}
-	logrus.Info("containerd succesfully started")
 
 	logrus.Info("attempting to clean up kubelet volumes...")
 	if err := c.cleanupMount(); err != nil {
@@ -62,26 +71,39 @@ func (c *CleanUpConfig) WorkerCleanup() error {
 	}
 	logrus.Info("successfully removed network namespaces!")
 
-	logrus.Info("attempting to stop containers...")
-	time.Sleep(5 * time.Second)
-	if err := c.stopAllContainers(); err != nil {
-		logrus.Errorf("error stopping containers: %v", err)
-		msg = append(msg, err.Error())
-	}
-
-	if err := c.removeAllContainers(); err != nil {
-		logrus.Errorf("error removing containers: %v", err)
-		msg = append(msg, err.Error())
+	if c.dockerHost != "" {
+		logrus.Info("attempting to remove docker containers...")
+		if err := c.removeDockerContainers(); err != nil {
+			logrus.Errorf("error removing containers: %v", err)
+			msg = append(msg, err.Error())
+		} else {
+			logrus.Info("successfully removed k0s containers!")
+		}
+	} else {
+		logrus.Info("attempting to stop containers...")
+		if !c.externalCRI {
+			time.Sleep(5 * time.Second)
+		}
+		if err := c.stopAllContainers(); err != nil {
+			logrus.Errorf("error stopping containers: %v", err)
+			msg = append(msg, err.Error())
+		}
+
+		if err := c.removeAllContainers(); err != nil {
+			logrus.Errorf("error removing containers: %v", err)
+			msg = append(msg, err.Error())
+		}
+
+		containers, err := c.criCtl.ListPods()
+		if err == nil && len(containers) == 0 {
+			logrus.Info("successfully removed k0s containers!")
+		}
 	}
 
-	containers, err := c.criCtl.ListPods()
-	if err == nil && len(containers) == 0 {
-		logrus.Info("successfully removed k0s containers!")
+	if !c.externalCRI {
+		c.stopContainerd()
 	}
 
-	// stop containerd
-	c.stopContainerd()
-
 	if len(msg) > 0 {
 		return fmt.Errorf("errors received during clean-up: %v", strings.Join(msg, ", "))
 	}
@@ -17,6 +17,7 @@ package install
 
 import (
 	"fmt"
+	"github.com/k0sproject/k0s/pkg/constant"
 	"github.com/k0sproject/k0s/pkg/crictl"
 	"os"
 	"os/exec"
@@ -28,17 +29,41 @@ import (
 	"k8s.io/mount-utils"
 )
 
-func NewCleanUpConfig(dataDir string) *CleanUpConfig {
-	runDir := "/run/k0s" // https://github.com/k0sproject/k0s/pull/591/commits/c3f932de85a0b209908ad39b817750efc4987395
+// NewCleanUpConfig creates the clean up config, criSocket is the --cri-socket of the worker if it uses an external
+// container runtime
+func NewCleanUpConfig(k0sVars constant.CfgVars, criSocket string) (*CleanUpConfig, error) {
+	runDir := k0sVars.RunDir
 	criSocketPath := fmt.Sprintf("unix:///%s/containerd.sock", runDir)
 
-	return &CleanUpConfig{
-		dataDir:              dataDir,
+	c := &CleanUpConfig{
+		dataDir:              k0sVars.DataDir,
 		runDir:               runDir,
 		containerdSockerPath: fmt.Sprintf("%s/containerd.sock", runDir),
-		containerdBinPath:    fmt.Sprintf("%s/%s", dataDir, "bin/containerd"),
+		containerdBinPath:    fmt.Sprintf("%s/%s", k0sVars.BinDir, "containerd"),
+		containerdConfigPath: k0sVars.ContainerdConfigPath,
 		criCtl:               crictl.NewCriCtl(criSocketPath),
+		binDir:               k0sVars.BinDir,
 	}
+	if criSocket == "" {
+		return c, nil
+	}
+
+	// the external runtimes are not started nor stopped, the pods are removed through their own socket
+	runtimeConfig := strings.SplitN(criSocket, ":", 2)
+	if len(runtimeConfig) != 2 {
+		return nil, fmt.Errorf("cannot parse CRI socket path")
+	}
+	c.externalCRI = true
+	switch runtimeConfig[0] {
+	case "docker":
+		// dockershim is gone with kubelet, the containers it has created are removed with docker itself
+		c.dockerHost = runtimeConfig[1]
+	case "remote":
+		c.criCtl = crictl.NewCriCtl(runtimeConfig[1])
+	default:
+		return nil, fmt.Errorf("unknown runtime type %s, must be either of remote or docker", runtimeConfig[0])
+	}
+	return c, nil
 }
 
 func (c *CleanUpConfig) cleanupMount() error {
@@ -140,12 +165,29 @@ func (c *CleanUpConfig) removeAllContainers() error {
 	return nil
 }
 
+// removeDockerContainers removes the containers kubelet has created with dockershim
+func (c *CleanUpConfig) removeDockerContainers() error {
+	out, err := exec.Command("docker", "--host", c.dockerHost, "ps", "--all", "--quiet", "--filter", "name=k8s_").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list the docker containers: %v", err)
+	}
+	containers := strings.Fields(string(out))
+	if len(containers) == 0 {
+		return nil
+	}
+	args := append([]string{"--host", c.dockerHost, "rm", "--force"}, containers...)
+	if out, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove the docker containers: %v: %s", err, out)
+	}
+	return nil
+}
+
 func (c *CleanUpConfig) startContainerd() error {
 	args := []string{
 		fmt.Sprintf("--root=%s", filepath.Join(c.dataDir, "containerd")),
 		fmt.Sprintf("--state=%s", filepath.Join(c.runDir, "containerd")),
 		fmt.Sprintf("--address=%s", c.containerdSockerPath),
-		"--config=/etc/k0s/containerd.toml",
+		fmt.Sprintf("--config=%s", c.containerdConfigPath),
 	}
 	cmd := exec.Command(c.containerdBinPath, args...)
 	if err := cmd.Start(); err != nil {
@@ -206,6 +248,10 @@ func (c *CleanUpConfig) RemoveAllDirectories() error {
 		fmtError := fmt.Errorf("failed to delete %v. err: %v", c.runDir, err)
 		msg = append(msg, fmtError.Error())
 	}
+	if err := os.RemoveAll(c.binDir); err != nil {
+		fmtError := fmt.Errorf("failed to delete %v. err: %v", c.binDir, err)
+		msg = append(msg, fmtError.Error())
+	}
 	if len(msg) > 0 {
 		return fmt.Errorf("%v", strings.Join(msg, ", "))
 	}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/constant"
+	"github.com/k0sproject/k0s/pkg/sysinfo"
+	"github.com/k0sproject/k0s/static"
+)
+
+const (
+	// the module name is derived from the file name by semodule
+	selinuxModuleFile = "k0s.cil"
+	// defaultRunDir is the run directory the policy module labels, see constant.GetConfig
+	defaultRunDir = "/run/k0s"
+)
+
+// InstallSELinuxPolicy loads the k0s SELinux policy module and labels the k0s data and run directories with it.
+// Directories other than the defaults are labeled like the defaults by adding file context equivalence rules.
+func InstallSELinuxPolicy(k0sVars constant.CfgVars) error {
+	mode, err := sysinfo.SELinuxMode(sysinfo.SysfsRoot)
+	if err != nil {
+		return fmt.Errorf("failed to probe SELinux mode: %v", err)
+	}
+	if mode == sysinfo.SELinuxDisabled {
+		return fmt.Errorf("SELinux is disabled on this host")
+	}
+	for _, tool := range []string{"semodule", "semanage", "restorecon"} {
+		if _, err := util.GetExecPath(tool); err != nil {
+			return fmt.Errorf("%s not found, install the SELinux policy management tools: %v", tool, err)
+		}
+	}
+
+	policy, err := static.Asset("selinux/" + selinuxModuleFile)
+	if err != nil {
+		return fmt.Errorf("failed to read SELinux policy module: %v", err)
+	}
+	tmpDir, err := ioutil.TempDir("", "k0s-selinux")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	modulePath := filepath.Join(tmpDir, selinuxModuleFile)
+	if err := ioutil.WriteFile(modulePath, policy, 0600); err != nil {
+		return fmt.Errorf("failed to write SELinux policy module: %v", err)
+	}
+
+	logrus.Infof("loading SELinux policy module %s", selinuxModuleFile)
+	if err := execCmd(exec.Command("semodule", "-i", modulePath)); err != nil {
+		return err
+	}
+
+	dirs := map[string]string{
+		k0sVars.DataDir: constant.DataDirDefault,
+		k0sVars.RunDir:  defaultRunDir,
+	}
+	for dir, original := range dirs {
+		if err := os.MkdirAll(dir, constant.DataDirMode); err != nil {
+			return err
+		}
+		if dir != original {
+			if err := ensureFcontextEquivalence(dir, original); err != nil {
+				return err
+			}
+		}
+		logrus.Infof("labeling %s", dir)
+		if err := execCmd(exec.Command("restorecon", "-R", dir)); err != nil {
+			return err
+		}
+	}
+
+	if mode == sysinfo.SELinuxPermissive {
+		logrus.Warn("SELinux is permissive, the k0s policy will be enforced once the host is switched to enforcing mode")
+	}
+	return nil
+}
+
+// ensureFcontextEquivalence makes dir labeled like original. Adding an existing rule fails, so it is modified instead.
+func ensureFcontextEquivalence(dir string, original string) error {
+	logrus.Infof("labeling %s like %s", dir, original)
+	if err := exec.Command("semanage", "fcontext", "-a", "-e", original, dir).Run(); err == nil {
+		return nil
+	}
+	return execCmd(exec.Command("semanage", "fcontext", "-m", "-e", original, dir))
+}
@@ -149,3 +149,19 @@ func NewClient(kubeconfig string) (kubernetes.Interface, error) {
 
 	return clientset, nil
 }
+
+// NewDynamicClient creates new dynamic k8s client based of the given kubeconfig
+// This should be only used in cases where the client is "short-running" and shouldn't/cannot use the common "cached" one.
+func NewDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load kubeconfig")
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create dynamic k8s client")
+	}
+
+	return client, nil
+}
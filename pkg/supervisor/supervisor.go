@@ -23,12 +23,14 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/assets"
 	"github.com/k0sproject/k0s/pkg/constant"
 )
 
@@ -45,10 +47,14 @@ type Supervisor struct {
 	TimeoutStop    time.Duration
 	TimeoutRespawn time.Duration
 
-	cmd  *exec.Cmd
-	quit chan bool
-	done chan bool
-	log  *logrus.Entry
+	// cmdMutex guards cmd, which is replaced by the supervising goroutine on each respawn
+	cmdMutex sync.Mutex
+	cmd      *exec.Cmd
+	// stopMutex makes concurrent Stop calls wait for the first one
+	stopMutex sync.Mutex
+	quit      chan bool
+	done      chan bool
+	log       *logrus.Entry
 }
 
 // processWaitQuit waits for a process to exit or a shut down signal
@@ -111,18 +117,37 @@ func (s *Supervisor) Supervise() error {
 	go func() {
 		s.log.Info("Starting to supervise")
 		for {
-			s.cmd = exec.Command(s.BinPath, s.Args...)
-			s.cmd.Dir = s.DataDir
-			s.cmd.Env = getEnv(s.DataDir)
+			// don't (re)start a corrupted or tampered binary
+			if err := assets.VerifyStaged(s.BinPath); err != nil {
+				s.log.Errorf("Failed to verify %s: %v", s.BinPath, err)
+				if s.quit == nil {
+					started <- err
+					return
+				}
+				select {
+				case <-s.quit:
+					s.log.Debug("respawn cancelled")
+					return
+				case <-time.After(s.TimeoutRespawn):
+					continue
+				}
+			}
+
+			cmd := exec.Command(s.BinPath, s.Args...)
+			cmd.Dir = s.DataDir
+			cmd.Env = getEnv(s.DataDir)
 
 			// detach from the process group so children don't
 			// get signals sent directly to parent.
-			s.cmd.SysProcAttr = DetachAttr(s.UID, s.GID)
+			cmd.SysProcAttr = DetachAttr(s.UID, s.GID)
 
-			s.cmd.Stdout = s.log.Writer()
-			s.cmd.Stderr = s.log.Writer()
+			cmd.Stdout = s.log.Writer()
+			cmd.Stderr = s.log.Writer()
 
-			err := s.cmd.Start()
+			err := cmd.Start()
+			s.cmdMutex.Lock()
+			s.cmd = cmd
+			s.cmdMutex.Unlock()
 			if err != nil {
 				s.log.Warnf("Failed to start: %s", err)
 				if s.quit == nil {
@@ -161,15 +186,36 @@ func (s *Supervisor) Supervise() error {
 	return <-started
 }
 
-// Stop stops the supervised
+// Stop stops the supervised. Stopping a supervisor which has been stopped already does nothing.
 func (s *Supervisor) Stop() error {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+
 	if s.quit != nil {
 		s.quit <- true
 		<-s.done
+		s.quit = nil
+		s.done = nil
+		s.cmdMutex.Lock()
+		s.cmd = nil
+		s.cmdMutex.Unlock()
 	}
 	return nil
 }
 
+// Restart terminates the supervised process so that the supervisor respawns it
+func (s *Supervisor) Restart() error {
+	s.cmdMutex.Lock()
+	cmd := s.cmd
+	s.cmdMutex.Unlock()
+
+	if cmd == nil || cmd.Process == nil {
+		return fmt.Errorf("%s is not running", s.Name)
+	}
+	s.log.Infof("Restarting pid %d", cmd.Process.Pid)
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
+
 // Modifies the current processes env so that we inject k0s embedded bins into path
 func getEnv(dataDir string) []string {
 	env := os.Environ()
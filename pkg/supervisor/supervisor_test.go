@@ -1,6 +1,9 @@
 package supervisor
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 type SupervisorTest struct {
 	shouldFail bool
@@ -44,7 +47,8 @@ func TestSupervisor(t *testing.T) {
 		},
 	}
 
-	for _, s := range testSupervisors {
+	for i := range testSupervisors {
+		s := &testSupervisors[i]
 		err := s.proc.Supervise()
 		if err != nil && !s.shouldFail {
 			t.Errorf("Failed to start %s: %w", s.proc.Name, err)
@@ -57,3 +61,33 @@ func TestSupervisor(t *testing.T) {
 		}
 	}
 }
+
+func TestStopRestartedSupervisorTwice(t *testing.T) {
+	s := Supervisor{
+		Name:    "supervisor-test-restart",
+		BinPath: "/bin/sh",
+		RunDir:  ".",
+		Args:    []string{"-c", "sleep 10s"},
+	}
+	if err := s.Supervise(); err != nil {
+		t.Fatalf("Failed to start %s: %v", s.Name, err)
+	}
+	if err := s.Restart(); err != nil {
+		t.Errorf("Failed to restart %s: %v", s.Name, err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		_ = s.Stop()
+		_ = s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("stopping %s twice didn't return", s.Name)
+	}
+	if err := s.Restart(); err == nil {
+		t.Errorf("restarting the stopped %s should fail", s.Name)
+	}
+}
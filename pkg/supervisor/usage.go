@@ -0,0 +1,143 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the USER_HZ the CPU times in /proc/<pid>/stat are counted in, it is 100 on all the Linux platforms k0s runs on
+const clockTicks = 100
+
+// procDir is the proc filesystem the usage is read from
+var procDir = "/proc"
+
+// Usage is the resource usage of a supervised process
+type Usage struct {
+	Name string
+	PID  int
+	// RSS is the resident memory of the process in bytes
+	RSS uint64
+	// CPUTime is the CPU time the process has used since it started
+	CPUTime time.Duration
+	// CPUPercent is the share of a CPU the process used over the sampling interval
+	CPUPercent float64
+}
+
+// ReadUsage samples the resource usage of the processes supervised in runDir twice, interval apart, to
+// tell their current CPU usage. The processes are found by the pid files the supervisors keep in runDir.
+func ReadUsage(runDir string, interval time.Duration) ([]Usage, error) {
+	pids, err := supervisedPIDs(runDir)
+	if err != nil {
+		return nil, err
+	}
+
+	before := make(map[string]Usage, len(pids))
+	for name, pid := range pids {
+		if u, err := processUsage(name, pid); err == nil {
+			before[name] = u
+		}
+	}
+	time.Sleep(interval)
+
+	usages := make([]Usage, 0, len(before))
+	for name, prev := range before {
+		u, err := processUsage(name, prev.PID)
+		if err != nil {
+			// the process has exited in between
+			continue
+		}
+		if interval > 0 {
+			u.CPUPercent = float64(u.CPUTime-prev.CPUTime) / float64(interval) * 100
+		}
+		usages = append(usages, u)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Name < usages[j].Name })
+	return usages, nil
+}
+
+func supervisedPIDs(runDir string) (map[string]int, error) {
+	files, err := filepath.Glob(filepath.Join(runDir, "*.pid"))
+	if err != nil {
+		return nil, err
+	}
+	pids := make(map[string]int, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			continue
+		}
+		pids[strings.TrimSuffix(filepath.Base(file), ".pid")] = pid
+	}
+	return pids, nil
+}
+
+func processUsage(name string, pid int) (Usage, error) {
+	stat, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return Usage{}, err
+	}
+	// the command name in parentheses may contain spaces, the fields are counted from the closing parenthesis
+	i := strings.LastIndex(string(stat), ")")
+	if i < 0 {
+		return Usage{}, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	// the fields after the command start from the 3rd one, state, so utime and stime (14th and 15th) are at 11 and 12
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 13 {
+		return Usage{}, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	statm, err := ioutil.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "statm"))
+	if err != nil {
+		return Usage{}, err
+	}
+	// statm is in pages: size resident shared ...
+	pages := strings.Fields(string(statm))
+	if len(pages) < 2 {
+		return Usage{}, fmt.Errorf("malformed statm of pid %d", pid)
+	}
+	resident, err := strconv.ParseUint(pages[1], 10, 64)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	return Usage{
+		Name:    name,
+		PID:     pid,
+		RSS:     resident * uint64(os.Getpagesize()),
+		CPUTime: time.Duration(utime+stime) * time.Second / clockTicks,
+	}, nil
+}
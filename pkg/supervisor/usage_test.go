@@ -0,0 +1,57 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestReadUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	runDir := filepath.Join(dir, "run")
+	procDir = filepath.Join(dir, "proc")
+	defer func() { procDir = "/proc" }()
+
+	writeFile(t, filepath.Join(runDir, "etcd.pid"), "42\n")
+	writeFile(t, filepath.Join(runDir, "gone.pid"), "43\n")
+	writeFile(t, filepath.Join(runDir, "garbage.pid"), "not a pid\n")
+	// the command name contains a space and a parenthesis to check the parsing
+	writeFile(t, filepath.Join(procDir, "42", "stat"), "42 (etcd (x) y) S 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 12 0 100 1000 2000")
+	writeFile(t, filepath.Join(procDir, "42", "statm"), "1000 256 100 1 0 500 0")
+
+	usages, err := ReadUsage(runDir, 0)
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+	assert.Equal(t, "etcd", usages[0].Name)
+	assert.Equal(t, 42, usages[0].PID)
+	assert.Equal(t, uint64(256*os.Getpagesize()), usages[0].RSS)
+	assert.Equal(t, 3*time.Second, usages[0].CPUTime)
+}
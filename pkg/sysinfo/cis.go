@@ -0,0 +1,179 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysinfo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/k0sproject/k0s/internal/util"
+	"github.com/k0sproject/k0s/pkg/apis/v1beta1"
+	"github.com/k0sproject/k0s/pkg/constant"
+)
+
+// ProcRoot is the default mount point of procfs
+const ProcRoot = "/proc"
+
+// CIS check statuses
+const (
+	CISPass   = "PASS"
+	CISFail   = "FAIL"
+	CISManual = "MANUAL"
+)
+
+// CISItem is a CIS Kubernetes Benchmark recommendation which the CIS hardening profile does not apply on its own
+type CISItem struct {
+	ID          string
+	Title       string
+	Status      string
+	Remediation string
+}
+
+// ToArray formats the item as a table row
+func (i CISItem) ToArray() []string {
+	return []string{i.ID, i.Status, i.Title, i.Remediation}
+}
+
+// kubeletKernelDefaults are the kernel parameters kubelet expects with protectKernelDefaults
+var kubeletKernelDefaults = map[string]string{
+	"vm/overcommit_memory": "1",
+	"vm/panic_on_oom":      "0",
+	"kernel/panic":         "10",
+	"kernel/panic_on_oops": "1",
+}
+
+// CISManualItems checks the recommendations left to the administrator on the host and in the cluster config
+func CISManualItems(spec *v1beta1.ClusterSpec, k0sVars constant.CfgVars, procRoot string) []CISItem {
+	var admission v1beta1.AdmissionSpec
+	if spec.API.Admission != nil {
+		admission = *spec.API.Admission
+	}
+
+	items := []CISItem{
+		{
+			ID:          "1.1.11",
+			Title:       "etcd data directory permissions are 700 or more restrictive",
+			Status:      etcdDataDirStatus(spec, k0sVars),
+			Remediation: fmt.Sprintf("chmod 700 %s", k0sVars.EtcdDataDir),
+		},
+		{
+			ID:          "1.2.10",
+			Title:       "EventRateLimit admission plugin is enabled and configured",
+			Status:      admissionPluginStatus(admission, "EventRateLimit", true),
+			Remediation: "add EventRateLimit to spec.api.admission.enabledPlugins and its limits to spec.api.admission.plugins",
+		},
+		{
+			ID:          "1.2.16",
+			Title:       "PodSecurityPolicy admission plugin is enabled",
+			Status:      admissionPluginStatus(admission, "PodSecurityPolicy", false),
+			Remediation: "review the PodSecurityPolicies bound to the workloads, then add PodSecurityPolicy to spec.api.admission.enabledPlugins",
+		},
+		{
+			ID:          "1.2.22",
+			Title:       "audit logging is enabled",
+			Status:      auditStatus(spec, k0sVars),
+			Remediation: "use the cis hardening profile or create an AuditPolicy object",
+		},
+		{
+			ID:          "1.2.33",
+			Title:       "secrets are encrypted at rest",
+			Status:      argStatus(spec.API.ExtraArgs, "encryption-provider-config"),
+			Remediation: "create an EncryptionConfiguration and set encryption-provider-config in spec.api.extraArgs",
+		},
+		{
+			ID:          "4.2.6",
+			Title:       "kernel parameters allow kubelet to run with protectKernelDefaults",
+			Status:      kernelDefaultsStatus(procRoot),
+			Remediation: "set " + kernelDefaultsRemediation() + " with sysctl and protectKernelDefaults: true in the worker profiles",
+		},
+		{
+			ID:          "5.1",
+			Title:       "RBAC grants cluster-admin, secrets access and pod creation only where needed",
+			Status:      CISManual,
+			Remediation: "review the ClusterRoleBindings and RoleBindings",
+		},
+		{
+			ID:          "5.3.2",
+			Title:       "all namespaces have NetworkPolicies defined",
+			Status:      CISManual,
+			Remediation: "define NetworkPolicies, `k0s check network-policy` verifies that they are enforced",
+		},
+	}
+	return items
+}
+
+func etcdDataDirStatus(spec *v1beta1.ClusterSpec, k0sVars constant.CfgVars) string {
+	if spec.Storage.Type != v1beta1.EtcdStorageType {
+		return CISPass
+	}
+	info, err := os.Stat(k0sVars.EtcdDataDir)
+	if err != nil || info.Mode().Perm()&0077 != 0 {
+		return CISFail
+	}
+	return CISPass
+}
+
+func admissionPluginStatus(admission v1beta1.AdmissionSpec, plugin string, needsConfig bool) string {
+	if !util.StringSliceContains(admission.EnabledPlugins, plugin) {
+		return CISFail
+	}
+	if needsConfig {
+		for _, p := range admission.Plugins {
+			if p.Name == plugin {
+				return CISPass
+			}
+		}
+		return CISFail
+	}
+	return CISPass
+}
+
+func auditStatus(spec *v1beta1.ClusterSpec, k0sVars constant.CfgVars) string {
+	if spec.Hardening.CIS() || util.FileExists(filepath.Join(k0sVars.AuditDir, "policy.yaml")) {
+		return CISPass
+	}
+	return CISFail
+}
+
+func argStatus(args map[string]string, name string) string {
+	if args[name] != "" {
+		return CISPass
+	}
+	return CISFail
+}
+
+func kernelDefaultsStatus(procRoot string) string {
+	for param, expected := range kubeletKernelDefaults {
+		value, err := readInt(filepath.Join(procRoot, "sys", param))
+		if err != nil || fmt.Sprint(value) != expected {
+			return CISFail
+		}
+	}
+	return CISPass
+}
+
+func kernelDefaultsRemediation() string {
+	var params []string
+	for param, value := range kubeletKernelDefaults {
+		params = append(params, strings.ReplaceAll(param, "/", ".")+"="+value)
+	}
+	sort.Strings(params)
+	return strings.Join(params, " ")
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package sysinfo probes the host for the kernel features needed by the workloads
+package sysinfo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SysfsRoot is the default mount point of sysfs
+const SysfsRoot = "/sys"
+
+// Hugepages returns the number of pre-allocated hugepages per page size, e.g. {"2Mi": 1024}
+func Hugepages(sysfsRoot string) (map[string]int64, error) {
+	dir := filepath.Join(sysfsRoot, "kernel", "mm", "hugepages")
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]int64{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pages := make(map[string]int64)
+	for _, e := range entries {
+		// the directories are named like hugepages-2048kB
+		sizeKB, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(e.Name(), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		count, err := readInt(filepath.Join(dir, e.Name(), "nr_hugepages"))
+		if err != nil {
+			return nil, err
+		}
+		pages[FormatPageSize(sizeKB)] = count
+	}
+	return pages, nil
+}
+
+// FormatPageSize formats the page size given in kB the same way kubelet names the hugepages resources, e.g. 2Mi or 1Gi
+func FormatPageSize(sizeKB int64) string {
+	switch {
+	case sizeKB%(1024*1024) == 0:
+		return fmt.Sprintf("%dGi", sizeKB/(1024*1024))
+	case sizeKB%1024 == 0:
+		return fmt.Sprintf("%dMi", sizeKB/1024)
+	}
+	return fmt.Sprintf("%dKi", sizeKB)
+}
+
+// KernelParam returns the kernel boot parameters reserving the given hugepages, e.g. "hugepagesz=2M hugepages=1024"
+func KernelParam(pageSize string, count int64) string {
+	return fmt.Sprintf("hugepagesz=%s hugepages=%d", strings.TrimSuffix(pageSize, "i"), count)
+}
+
+func readInt(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sysinfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var numaNodeRe = regexp.MustCompile(`^node[0-9]+$`)
+
+// NUMANodes returns the number of NUMA nodes of the host. Zero means that the kernel has no NUMA support.
+func NUMANodes(sysfsRoot string) (int, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(sysfsRoot, "devices", "system", "node"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var nodes int
+	for _, e := range entries {
+		if e.IsDir() && numaNodeRe.MatchString(e.Name()) {
+			nodes++
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysinfo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SELinux modes, named like getenforce reports them
+const (
+	SELinuxDisabled   = "disabled"
+	SELinuxPermissive = "permissive"
+	SELinuxEnforcing  = "enforcing"
+)
+
+// SELinuxMode returns the current SELinux mode of the host. Hosts without selinuxfs are reported as disabled.
+func SELinuxMode(sysfsRoot string) (string, error) {
+	enforce, err := readInt(filepath.Join(sysfsRoot, "fs", "selinux", "enforce"))
+	if os.IsNotExist(err) {
+		return SELinuxDisabled, nil
+	} else if err != nil {
+		return "", err
+	}
+	if enforce == 1 {
+		return SELinuxEnforcing, nil
+	}
+	return SELinuxPermissive, nil
+}
+
+// SELinuxType returns the type of an SELinux security context, e.g. container_var_lib_t for
+// system_u:object_r:container_var_lib_t:s0
+func SELinuxType(context string) string {
+	parts := strings.SplitN(strings.TrimRight(context, "\x00"), ":", 4)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
@@ -0,0 +1,35 @@
+// +build linux
+
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysinfo
+
+import (
+	"syscall"
+)
+
+// FileSELinuxType returns the SELinux type the given path is labeled with, or an empty string if the path has no label
+func FileSELinuxType(path string) (string, error) {
+	buf := make([]byte, 256)
+	n, err := syscall.Getxattr(path, "security.selinux", buf)
+	if err == syscall.ENODATA || err == syscall.ENOTSUP {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return SELinuxType(string(buf[:n])), nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sysinfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbes(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-sysfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	t.Run("empty_sysfs", func(t *testing.T) {
+		pages, err := Hugepages(root)
+		require.NoError(t, err)
+		require.Empty(t, pages)
+		nodes, err := NUMANodes(root)
+		require.NoError(t, err)
+		require.Equal(t, 0, nodes)
+	})
+
+	for size, count := range map[string]string{"hugepages-2048kB": "512\n", "hugepages-1048576kB": "0\n"} {
+		dir := filepath.Join(root, "kernel", "mm", "hugepages", size)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "nr_hugepages"), []byte(count), 0644))
+	}
+	for _, node := range []string{"node0", "node1", "power"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "devices", "system", "node", node), 0755))
+	}
+
+	pages, err := Hugepages(root)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"2Mi": 512, "1Gi": 0}, pages)
+
+	nodes, err := NUMANodes(root)
+	require.NoError(t, err)
+	require.Equal(t, 2, nodes)
+
+	require.Equal(t, "hugepagesz=1G hugepages=4", KernelParam("1Gi", 4))
+}
+
+func TestSELinux(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-sysfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	mode, err := SELinuxMode(root)
+	require.NoError(t, err)
+	require.Equal(t, SELinuxDisabled, mode)
+
+	dir := filepath.Join(root, "fs", "selinux")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for enforce, expected := range map[string]string{"0": SELinuxPermissive, "1": SELinuxEnforcing} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "enforce"), []byte(enforce), 0644))
+		mode, err := SELinuxMode(root)
+		require.NoError(t, err)
+		require.Equal(t, expected, mode)
+	}
+
+	require.Equal(t, "container_var_lib_t", SELinuxType("system_u:object_r:container_var_lib_t:s0\x00"))
+	require.Equal(t, "container_file_t", SELinuxType("system_u:object_r:container_file_t:s0:c1,c2"))
+	require.Equal(t, "", SELinuxType("unlabeled"))
+}
+
+func TestKernelDefaultsStatus(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-procfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.Equal(t, CISFail, kernelDefaultsStatus(root))
+
+	for param, value := range kubeletKernelDefaults {
+		path := filepath.Join(root, "sys", param)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(value+"\n"), 0644))
+	}
+	require.Equal(t, CISPass, kernelDefaultsStatus(root))
+
+	require.Equal(t, "kernel.panic=10 kernel.panic_on_oops=1 vm.overcommit_memory=1 vm.panic_on_oom=0", kernelDefaultsRemediation())
+}
+
+func TestSwapDevices(t *testing.T) {
+	root, err := ioutil.TempDir("", "k0s-procfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	devices, err := SwapDevices(root)
+	require.NoError(t, err)
+	require.Empty(t, devices)
+
+	swaps := "Filename\t\t\t\tType\t\tSize\tUsed\tPriority\n/swapfile                               file\t\t2097148\t0\t-2\n/dev/zram0                              partition\t524284\t0\t100\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "swaps"), []byte(swaps), 0644))
+	devices, err = SwapDevices(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/swapfile", "/dev/zram0"}, devices)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "swaps"), []byte("Filename\tType\tSize\tUsed\tPriority\n"), 0644))
+	devices, err = SwapDevices(root)
+	require.NoError(t, err)
+	require.Empty(t, devices)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CloudJoinConfig is the k0s section of the instance user-data the worker reads its join token from, e.g.
+//
+//	#cloud-config
+//	k0s:
+//	  joinToken: H4sIAAAAAAAC/2yV...
+//
+// Exactly one of JoinToken and JoinTokenURL must be set.
+type CloudJoinConfig struct {
+	// JoinToken is the join token itself
+	JoinToken string `yaml:"joinToken,omitempty"`
+	// JoinTokenURL is an URL the join token is fetched from, e.g. a pre-signed object storage URL
+	JoinTokenURL string `yaml:"joinTokenURL,omitempty"`
+}
+
+// cloudUserData is the schema of the user-data, other top level keys such as the cloud-init ones are ignored
+type cloudUserData struct {
+	K0s *CloudJoinConfig `yaml:"k0s"`
+}
+
+// CloudProviders lists the supported instance metadata services
+var CloudProviders = []string{"aws", "azure", "gcp", "openstack"}
+
+// metadata service endpoints, variables so that they can be pointed to a test server
+var (
+	awsMetadataURL       = "http://169.254.169.254"
+	azureMetadataURL     = "http://169.254.169.254"
+	gcpMetadataURL       = "http://metadata.google.internal"
+	openstackMetadataURL = "http://169.254.169.254"
+)
+
+var metadataClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchFromCloudMetadata reads the instance user-data from the metadata service of the given cloud provider and
+// returns the join token configured in its k0s section
+func FetchFromCloudMetadata(ctx context.Context, provider string) (string, error) {
+	userData, err := cloudUserDataFor(ctx, provider)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s instance user-data: %v", provider, err)
+	}
+	cfg, err := ParseCloudJoinConfig(userData)
+	if err != nil {
+		return "", err
+	}
+	if cfg.JoinToken != "" {
+		return cfg.JoinToken, nil
+	}
+	token, err := metadataGet(ctx, cfg.JoinTokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch the join token from %s: %v", cfg.JoinTokenURL, err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// ParseCloudJoinConfig parses and validates the k0s section of the user-data
+func ParseCloudJoinConfig(userData []byte) (*CloudJoinConfig, error) {
+	var ud cloudUserData
+	if err := yaml.Unmarshal(userData, &ud); err != nil || ud.K0s == nil {
+		return nil, fmt.Errorf("instance user-data has no k0s section")
+	}
+	cfg := ud.K0s
+	if (cfg.JoinToken == "") == (cfg.JoinTokenURL == "") {
+		return nil, fmt.Errorf("exactly one of k0s.joinToken and k0s.joinTokenURL must be set in the instance user-data")
+	}
+	if cfg.JoinTokenURL != "" && !strings.HasPrefix(cfg.JoinTokenURL, "https://") {
+		return nil, fmt.Errorf("k0s.joinTokenURL must be an https URL")
+	}
+	return cfg, nil
+}
+
+func cloudUserDataFor(ctx context.Context, provider string) ([]byte, error) {
+	switch provider {
+	case "aws":
+		headers, err := awsMetadataHeaders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return metadataGet(ctx, awsMetadataURL+"/latest/user-data", headers)
+	case "azure":
+		data, err := metadataGet(ctx, azureMetadataURL+"/metadata/instance/compute/userData?api-version=2021-01-01&format=text", map[string]string{"Metadata": "true"})
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(string(data))
+	case "gcp":
+		return metadataGet(ctx, gcpMetadataURL+"/computeMetadata/v1/instance/attributes/user-data", map[string]string{"Metadata-Flavor": "Google"})
+	case "openstack":
+		return metadataGet(ctx, openstackMetadataURL+"/openstack/latest/user_data", nil)
+	default:
+		return nil, fmt.Errorf("unsupported cloud provider %q, must be one of %s", provider, strings.Join(CloudProviders, ", "))
+	}
+}
+
+// awsMetadataHeaders starts an IMDSv2 session, which works also when IMDSv1 is disabled
+func awsMetadataHeaders(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, awsMetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	session, err := metadataDo(req)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"X-aws-ec2-metadata-token": string(session)}, nil
+}
+
+func metadataGet(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return metadataDo(req)
+}
+
+func metadataDo(req *http.Request) ([]byte, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
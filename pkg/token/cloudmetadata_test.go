@@ -0,0 +1,101 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCloudJoinConfig(t *testing.T) {
+	cfg, err := ParseCloudJoinConfig([]byte(`#cloud-config
+packages:
+- curl
+k0s:
+  joinToken: abc
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", cfg.JoinToken)
+
+	_, err = ParseCloudJoinConfig([]byte("#!/bin/sh\necho hello\n"))
+	assert.Error(t, err)
+
+	_, err = ParseCloudJoinConfig([]byte("k0s:\n  joinToken: abc\n  joinTokenURL: https://example.com/token\n"))
+	assert.Error(t, err)
+
+	_, err = ParseCloudJoinConfig([]byte("k0s:\n  joinTokenURL: http://example.com/token\n"))
+	assert.Error(t, err)
+}
+
+func TestFetchFromCloudMetadata(t *testing.T) {
+	userData := "#cloud-config\nk0s:\n  joinToken: abc\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_, _ = w.Write([]byte("session"))
+	})
+	mux.HandleFunc("/latest/user-data", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(userData))
+	})
+	mux.HandleFunc("/metadata/instance/compute/userData", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(userData))))
+	})
+	mux.HandleFunc("/computeMetadata/v1/instance/attributes/user-data", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(userData))
+	})
+	mux.HandleFunc("/openstack/latest/user_data", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(userData))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	awsMetadataURL = server.URL
+	azureMetadataURL = server.URL
+	gcpMetadataURL = server.URL
+	openstackMetadataURL = server.URL
+
+	for _, provider := range CloudProviders {
+		t.Run(provider, func(t *testing.T) {
+			token, err := FetchFromCloudMetadata(context.TODO(), provider)
+			require.NoError(t, err)
+			assert.Equal(t, "abc", token)
+		})
+	}
+
+	_, err := FetchFromCloudMetadata(context.TODO(), "ibm")
+	assert.Error(t, err)
+}
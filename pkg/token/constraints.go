@@ -0,0 +1,90 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AllowedCIDRsAnnotation holds the comma separated networks the join API accepts a token from
+	AllowedCIDRsAnnotation = "k0s.k0sproject.io/allowed-cidrs"
+	// AllowedNodeNamesAnnotation holds the glob pattern of the node names the join API accepts a token for
+	AllowedNodeNamesAnnotation = "k0s.k0sproject.io/allowed-node-names"
+)
+
+// Constraints restrict where and for which nodes a token can be used, limiting the damage of a leaked token
+type Constraints struct {
+	// SourceCIDRs are the networks the token may be used from, any network if empty
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty" yaml:"sourceCIDRs,omitempty"`
+	// NodeNamePattern is a glob pattern the name of the joining node must match, any name if empty
+	NodeNamePattern string `json:"nodeNamePattern,omitempty" yaml:"nodeNamePattern,omitempty"`
+}
+
+// IsEmpty tells if the token is not constrained at all
+func (c Constraints) IsEmpty() bool {
+	return len(c.SourceCIDRs) == 0 && c.NodeNamePattern == ""
+}
+
+// Validate validates the CIDRs and the node name pattern
+func (c Constraints) Validate() error {
+	for _, cidr := range c.SourceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid source CIDR %q: %v", cidr, err)
+		}
+	}
+	if _, err := path.Match(c.NodeNamePattern, ""); err != nil {
+		return fmt.Errorf("invalid node name pattern %q: %v", c.NodeNamePattern, err)
+	}
+	return nil
+}
+
+// Allows checks that a request from sourceIP for the node nodeName satisfies the constraints
+func (c Constraints) Allows(sourceIP net.IP, nodeName string) error {
+	if len(c.SourceCIDRs) > 0 {
+		allowed := false
+		for _, cidr := range c.SourceCIDRs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err == nil && sourceIP != nil && network.Contains(sourceIP) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("source address %s is not in the allowed networks %s", sourceIP, strings.Join(c.SourceCIDRs, ","))
+		}
+	}
+	if c.NodeNamePattern != "" {
+		if matched, err := path.Match(c.NodeNamePattern, nodeName); err != nil || !matched {
+			return fmt.Errorf("node name %q does not match the allowed pattern %q", nodeName, c.NodeNamePattern)
+		}
+	}
+	return nil
+}
+
+func constraintsFromSecret(secret v1.Secret) Constraints {
+	var c Constraints
+	if cidrs := secret.Annotations[AllowedCIDRsAnnotation]; cidrs != "" {
+		c.SourceCIDRs = strings.Split(cidrs, ",")
+	}
+	c.NodeNamePattern = secret.Annotations[AllowedNodeNamesAnnotation]
+	return c
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConstraintsValidate(t *testing.T) {
+	assert.NoError(t, Constraints{}.Validate())
+	assert.NoError(t, Constraints{SourceCIDRs: []string{"10.0.0.0/8", "fd00::/8"}, NodeNamePattern: "edge-*"}.Validate())
+	assert.Error(t, Constraints{SourceCIDRs: []string{"10.0.0.1"}}.Validate())
+	assert.Error(t, Constraints{NodeNamePattern: "edge-[a"}.Validate())
+}
+
+func TestConstraintsAllows(t *testing.T) {
+	c := Constraints{SourceCIDRs: []string{"10.0.0.0/8", "192.168.1.0/24"}, NodeNamePattern: "edge-*"}
+
+	assert.NoError(t, c.Allows(net.ParseIP("10.1.2.3"), "edge-1"))
+	assert.NoError(t, c.Allows(net.ParseIP("192.168.1.20"), "edge-2"))
+	assert.Error(t, c.Allows(net.ParseIP("192.168.2.20"), "edge-1"))
+	assert.Error(t, c.Allows(nil, "edge-1"))
+	assert.Error(t, c.Allows(net.ParseIP("10.1.2.3"), "core-1"))
+
+	assert.NoError(t, Constraints{}.Allows(net.ParseIP("203.0.113.1"), "anything"))
+}
+
+func TestConstraintsFromSecret(t *testing.T) {
+	secret := v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				AllowedCIDRsAnnotation:     "10.0.0.0/8,192.168.1.0/24",
+				AllowedNodeNamesAnnotation: "edge-*",
+			},
+		},
+	}
+	assert.Equal(t, Constraints{SourceCIDRs: []string{"10.0.0.0/8", "192.168.1.0/24"}, NodeNamePattern: "edge-*"}, FromSecret(secret).Constraints)
+	assert.True(t, FromSecret(v1.Secret{}).Constraints.IsEmpty())
+}
@@ -17,7 +17,11 @@ package token
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/pem"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -30,14 +34,82 @@ import (
 	k8sutil "github.com/k0sproject/k0s/pkg/kubernetes"
 )
 
+// CAFingerprintAnnotation links a join token to the cluster CA it was issued with, the token can't be used once the CA is rotated
+const CAFingerprintAnnotation = "k0s.k0sproject.io/ca-fingerprint"
+
+// ControllerJoinGroup is the group the controller join tokens authenticate as against the Kubernetes API
+const ControllerJoinGroup = "system:bootstrappers:k0s-controllers"
+
 type Token struct {
-	ID     string
-	Role   string
-	Expiry string
+	ID            string       `json:"id" yaml:"id"`
+	Role          string       `json:"role" yaml:"role"`
+	Created       string       `json:"created,omitempty" yaml:"created,omitempty"`
+	Expiry        string       `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	CAFingerprint string       `json:"caFingerprint,omitempty" yaml:"caFingerprint,omitempty"`
+	Node          NodeMetadata `json:"node" yaml:"node"`
+	Constraints   Constraints  `json:"constraints" yaml:"constraints"`
+	// MaxUses is the number of joins the token can be used for, zero meaning unlimited
+	MaxUses int `json:"maxUses,omitempty" yaml:"maxUses,omitempty"`
+	// Uses is the number of joins the token has been used for so far
+	Uses int `json:"uses,omitempty" yaml:"uses,omitempty"`
+	// Static tells if the token was provisioned from the static token file
+	Static bool `json:"static,omitempty" yaml:"static,omitempty"`
 }
 
+// ToArray formats the token as a table row
 func (t Token) ToArray() []string {
-	return []string{t.ID, t.Role, t.Expiry}
+	return []string{t.ID, t.Role, t.Created, t.Expiry, t.RemainingUses(), strings.Join(t.Node.Labels, ","), strings.Join(t.Node.Taints, ",")}
+}
+
+// RemainingUses tells how many more joins the token can be used for
+func (t Token) RemainingUses() string {
+	if t.MaxUses == 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(t.MaxUses - t.Uses)
+}
+
+// IsStale tells if the token can no longer be used, either because it has expired or because it was issued for a previous cluster CA.
+// Tokens created before the CA bookkeeping have no fingerprint and are only checked for expiry.
+func (t Token) IsStale(caFingerprint string, now time.Time) bool {
+	if t.Expiry != "" {
+		expiry, err := time.Parse(time.RFC3339, t.Expiry)
+		if err != nil || now.After(expiry) {
+			return true
+		}
+	}
+	return t.CAFingerprint != "" && t.CAFingerprint != caFingerprint
+}
+
+// FromSecret returns the token stored in the given bootstrap token secret
+func FromSecret(secret v1.Secret) Token {
+	role := "worker"
+	if string(secret.Data["usage-controller-join"]) == "true" {
+		role = "controller"
+	}
+	t := Token{
+		ID:            string(secret.Data["token-id"]),
+		Role:          role,
+		Expiry:        string(secret.Data["expiration"]),
+		CAFingerprint: secret.Annotations[CAFingerprintAnnotation],
+		Node:          nodeMetadataFromSecret(secret),
+		Constraints:   constraintsFromSecret(secret),
+		Static:        secret.Annotations[StaticTokenAnnotation] == "true",
+	}
+	if !secret.CreationTimestamp.IsZero() {
+		t.Created = secret.CreationTimestamp.UTC().Format(time.RFC3339)
+	}
+	t.MaxUses, t.Uses = usesFromSecret(secret)
+	return t
+}
+
+// CAFingerprint returns the SHA256 fingerprint of the first certificate in the given PEM data
+func CAFingerprint(caCert []byte) (string, error) {
+	block, _ := pem.Decode(caCert)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode the CA certificate")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(block.Bytes)), nil
 }
 
 // NewManager creates a new token manager using given kubeconfig
@@ -57,19 +129,67 @@ type Manager struct {
 	client kubernetes.Interface
 }
 
-// Create creates a new bootstrap token
-func (m *Manager) Create(valid time.Duration, role string) (string, error) {
+// Create creates a new bootstrap token, caFingerprint is the fingerprint of the cluster CA embedded in the join token.
+// The node labels and taints are recorded on the token so that the controllers can apply them to the nodes joining with it.
+// The constraints are recorded on the token for the join API to verify. A token with positive maxUses is invalidated
+// once it has been used for that many joins.
+func (m *Manager) Create(valid time.Duration, role string, caFingerprint string, node NodeMetadata, constraints Constraints, maxUses int) (string, error) {
+	if !node.IsEmpty() && role != "worker" {
+		return "", fmt.Errorf("node labels and taints can only be set on worker tokens")
+	}
+	if err := node.Validate(); err != nil {
+		return "", err
+	}
+	if err := constraints.Validate(); err != nil {
+		return "", err
+	}
+	if maxUses < 0 {
+		return "", fmt.Errorf("invalid max uses %d, must be zero for unlimited or positive", maxUses)
+	}
+
 	tokenID := util.RandomString(6)
 	tokenSecret := util.RandomString(16)
 
 	token := fmt.Sprintf("%s.%s", tokenID, tokenSecret)
 
+	var expiration string
+	if valid != 0 {
+		expiration = time.Now().Add(valid).UTC().Format(time.RFC3339)
+		logrus.Debugf("Set expiry to %s", expiration)
+	}
+	secret := newTokenSecret(tokenID, tokenSecret, role, expiration)
+	secret.Annotations[CAFingerprintAnnotation] = caFingerprint
+	if len(node.Labels) > 0 {
+		secret.Annotations[NodeLabelsAnnotation] = strings.Join(node.Labels, ",")
+	}
+	if len(node.Taints) > 0 {
+		secret.Annotations[NodeTaintsAnnotation] = strings.Join(node.Taints, ",")
+	}
+	if len(constraints.SourceCIDRs) > 0 {
+		secret.Annotations[AllowedCIDRsAnnotation] = strings.Join(constraints.SourceCIDRs, ",")
+	}
+	if constraints.NodeNamePattern != "" {
+		secret.Annotations[AllowedNodeNamesAnnotation] = constraints.NodeNamePattern
+	}
+	if maxUses > 0 {
+		secret.Annotations[MaxUsesAnnotation] = strconv.Itoa(maxUses)
+	}
+
+	_, err := m.client.CoreV1().Secrets("kube-system").Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// newTokenSecret builds the bootstrap token secret for the given role, expiration is in RFC3339 and may be empty
+func newTokenSecret(tokenID, tokenSecret, role, expiration string) *v1.Secret {
 	data := make(map[string]string)
 	data["token-id"] = tokenID
 	data["token-secret"] = tokenSecret
-	if valid != 0 {
-		data["expiration"] = time.Now().Add(valid).UTC().Format(time.RFC3339)
-		logrus.Debugf("Set expiry to %s", data["expiration"])
+	if expiration != "" {
+		data["expiration"] = expiration
 	}
 
 	// This "usage-" is shared for both roles of the token
@@ -84,26 +204,24 @@ func (m *Manager) Create(valid time.Duration, role string) (string, error) {
 		data["usage-bootstrap-api-worker-calls"] = "true"
 	} else {
 		data["description"] = "Controller bootstrap token generated by k0s"
-		data["usage-bootstrap-authentication"] = "false"
+		// the controller tokens authenticate against the Kubernetes API too, so the join can be tunneled
+		// through its service proxy. They give access to the cluster CA anyway, the node bootstrapper
+		// permissions that come with the authentication add nothing to that.
+		data["usage-bootstrap-authentication"] = "true"
+		data["auth-extra-groups"] = ControllerJoinGroup
 		data["usage-bootstrap-signing"] = "false"
 		data["usage-controller-join"] = "true"
 	}
 
-	secret := &v1.Secret{
+	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("bootstrap-token-%s", tokenID),
-			Namespace: "kube-system",
+			Name:        fmt.Sprintf("bootstrap-token-%s", tokenID),
+			Namespace:   "kube-system",
+			Annotations: map[string]string{},
 		},
 		Type:       v1.SecretTypeBootstrapToken,
 		StringData: data,
 	}
-
-	_, err := m.client.CoreV1().Secrets("kube-system").Create(context.TODO(), secret, metav1.CreateOptions{})
-	if err != nil {
-		return "", err
-	}
-
-	return token, nil
 }
 
 // List returna all the join tokens for given role. If role == "" then it returns all join tokens
@@ -116,24 +234,33 @@ func (m *Manager) List(role string) ([]Token, error) {
 	}
 	tokens := make([]Token, 0, len(tokenList.Items))
 
-	for _, t := range tokenList.Items {
-		r := "worker"
-		if string(t.Data["usage-controller-join"]) == "true" {
-			r = "controller"
-		}
-		if r == role || role == "" {
-			tokens = append(tokens, Token{
-				ID:     string(t.Data["token-id"]),
-				Role:   r,
-				Expiry: string(t.Data["expiration"]),
-			})
+	for _, secret := range tokenList.Items {
+		t := FromSecret(secret)
+		if t.Role == role || role == "" {
+			tokens = append(tokens, t)
 		}
 	}
 	return tokens, nil
 }
 
+// Remove invalidates the token by deleting its bootstrap secret. Static tokens are also recorded as revoked,
+// so the controllers do not provision them again from the static token file.
 func (m *Manager) Remove(tokenID string) error {
-	err := m.client.CoreV1().Secrets("kube-system").Delete(context.TODO(), fmt.Sprintf("bootstrap-token-%s", tokenID), metav1.DeleteOptions{})
+	secrets := m.client.CoreV1().Secrets("kube-system")
+	name := fmt.Sprintf("bootstrap-token-%s", tokenID)
+	secret, err := secrets.Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if secret.Annotations[StaticTokenAnnotation] == "true" {
+		if err := m.revokeStatic(tokenID); err != nil {
+			return err
+		}
+	}
+	err = secrets.Delete(context.TODO(), name, metav1.DeleteOptions{})
 	if errors.IsNotFound(err) {
 		return nil
 	}
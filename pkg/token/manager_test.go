@@ -0,0 +1,104 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFromSecret(t *testing.T) {
+	secret := v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{CAFingerprintAnnotation: "abc"},
+		},
+		Data: map[string][]byte{
+			"token-id":              []byte("xyz123"),
+			"expiration":            []byte("2021-05-01T10:00:00Z"),
+			"usage-controller-join": []byte("true"),
+		},
+	}
+	assert.Equal(t, Token{ID: "xyz123", Role: "controller", Expiry: "2021-05-01T10:00:00Z", CAFingerprint: "abc"}, FromSecret(secret))
+
+	delete(secret.Data, "usage-controller-join")
+	assert.Equal(t, "worker", FromSecret(secret).Role)
+
+	secret.CreationTimestamp = metav1.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2021-04-01T12:00:00Z", FromSecret(secret).Created)
+}
+
+func TestToArray(t *testing.T) {
+	tok := Token{
+		ID:      "abc",
+		Role:    "worker",
+		Created: "2021-04-01T12:00:00Z",
+		Node:    NodeMetadata{Labels: []string{"pool=edge", "zone=a"}, Taints: []string{"dedicated=edge:NoSchedule"}},
+		MaxUses: 3,
+		Uses:    1,
+	}
+	assert.Equal(t, []string{"abc", "worker", "2021-04-01T12:00:00Z", "", "2", "pool=edge,zone=a", "dedicated=edge:NoSchedule"}, tok.ToArray())
+	assert.Equal(t, "unlimited", Token{}.RemainingUses())
+}
+
+func TestIsStale(t *testing.T) {
+	now := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name  string
+		token Token
+		stale bool
+	}{
+		{"valid", Token{Expiry: "2021-05-02T10:00:00Z", CAFingerprint: "current"}, false},
+		{"no_expiry", Token{CAFingerprint: "current"}, false},
+		{"expired", Token{Expiry: "2021-05-01T09:00:00Z", CAFingerprint: "current"}, true},
+		{"invalid_expiry", Token{Expiry: "tomorrow", CAFingerprint: "current"}, true},
+		{"previous_ca", Token{Expiry: "2021-05-02T10:00:00Z", CAFingerprint: "previous"}, true},
+		{"created_before_ca_bookkeeping", Token{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.stale, tc.token.IsStale("current", now))
+		})
+	}
+}
+
+func TestCAFingerprint(t *testing.T) {
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("ca")})
+	other := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("other")})
+
+	fingerprint, err := CAFingerprint(ca)
+	require.NoError(t, err)
+	assert.Len(t, fingerprint, 64)
+
+	// the fingerprint only depends on the CA certificate, not on the chain following it
+	withChain, err := CAFingerprint(append(append([]byte{}, ca...), other...))
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, withChain)
+
+	otherFingerprint, err := CAFingerprint(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, fingerprint, otherFingerprint)
+
+	_, err = CAFingerprint([]byte("not a certificate"))
+	assert.Error(t, err)
+}
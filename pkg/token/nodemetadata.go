@@ -0,0 +1,183 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// NodeLabelsAnnotation holds the comma separated labels of the nodes joining with a token
+	NodeLabelsAnnotation = "k0s.k0sproject.io/node-labels"
+	// NodeTaintsAnnotation holds the comma separated taints of the nodes joining with a token
+	NodeTaintsAnnotation = "k0s.k0sproject.io/node-taints"
+	// NodeMetadataExtension is the name of the join kubeconfig context extension the worker reads the labels and taints from
+	NodeMetadataExtension = "k0s.k0sproject.io/node"
+	// RequestedNodeLabelsAnnotation holds the comma separated labels a worker requests but kubelet isn't allowed to
+	// set, the controllers set the ones allowed by spec.nodeLabels
+	RequestedNodeLabelsAnnotation = "k0s.k0sproject.io/requested-node-labels"
+)
+
+// kubeletLabels are the labels in the kubernetes.io and k8s.io namespaces kubelet may set, see the NodeRestriction
+// admission plugin
+var kubeletLabels = map[string]bool{
+	"kubernetes.io/hostname":                   true,
+	"kubernetes.io/arch":                       true,
+	"kubernetes.io/os":                         true,
+	"beta.kubernetes.io/arch":                  true,
+	"beta.kubernetes.io/os":                    true,
+	"beta.kubernetes.io/instance-type":         true,
+	"node.kubernetes.io/instance-type":         true,
+	"failure-domain.beta.kubernetes.io/region": true,
+	"failure-domain.beta.kubernetes.io/zone":   true,
+	"topology.kubernetes.io/region":            true,
+	"topology.kubernetes.io/zone":              true,
+}
+
+var kubeletLabelNamespaces = []string{"kubelet.kubernetes.io", "node.kubernetes.io"}
+
+// IsKubeletLabel tells if kubelet may set the label with --node-labels, kubelet refuses to start with the other labels
+// in the kubernetes.io and k8s.io namespaces
+func IsKubeletLabel(key string) bool {
+	if kubeletLabels[key] {
+		return true
+	}
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return true
+	}
+	namespace := key[:i]
+	for _, ns := range kubeletLabelNamespaces {
+		if namespace == ns || strings.HasSuffix(namespace, "."+ns) {
+			return true
+		}
+	}
+	for _, ns := range []string{"kubernetes.io", "k8s.io"} {
+		if namespace == ns || strings.HasSuffix(namespace, "."+ns) {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeMetadata is the labels and taints of the nodes joining with a token
+type NodeMetadata struct {
+	Labels []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Taints []string `json:"taints,omitempty" yaml:"taints,omitempty"`
+}
+
+// IsEmpty tells if there are no labels nor taints
+func (n NodeMetadata) IsEmpty() bool {
+	return len(n.Labels) == 0 && len(n.Taints) == 0
+}
+
+// Validate validates the labels in key=value and the taints in key[=value]:Effect format
+func (n NodeMetadata) Validate() error {
+	for _, label := range n.Labels {
+		if _, _, err := ParseLabel(label); err != nil {
+			return err
+		}
+	}
+	for _, taint := range n.Taints {
+		if _, err := ParseTaint(taint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseLabel parses a label in key=value format
+func ParseLabel(label string) (string, string, error) {
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid label %q, expected key=value", label)
+	}
+	if errs := validation.IsQualifiedName(parts[0]); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid label key %q: %s", parts[0], strings.Join(errs, "; "))
+	}
+	if errs := validation.IsValidLabelValue(parts[1]); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid label value %q: %s", parts[1], strings.Join(errs, "; "))
+	}
+	return parts[0], parts[1], nil
+}
+
+// ParseTaint parses a taint in key[=value]:Effect format, the format of the kubelet --register-with-taints flag
+func ParseTaint(taint string) (v1.Taint, error) {
+	i := strings.LastIndex(taint, ":")
+	if i < 0 {
+		return v1.Taint{}, fmt.Errorf("invalid taint %q, expected key[=value]:Effect", taint)
+	}
+	t := v1.Taint{Effect: v1.TaintEffect(taint[i+1:])}
+	switch t.Effect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		return v1.Taint{}, fmt.Errorf("invalid taint effect %q, expected one of %s, %s, %s", t.Effect, v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute)
+	}
+	parts := strings.SplitN(taint[:i], "=", 2)
+	t.Key = parts[0]
+	if errs := validation.IsQualifiedName(t.Key); len(errs) > 0 {
+		return v1.Taint{}, fmt.Errorf("invalid taint key %q: %s", t.Key, strings.Join(errs, "; "))
+	}
+	if len(parts) == 2 {
+		t.Value = parts[1]
+		if errs := validation.IsValidLabelValue(t.Value); len(errs) > 0 {
+			return v1.Taint{}, fmt.Errorf("invalid taint value %q: %s", t.Value, strings.Join(errs, "; "))
+		}
+	}
+	return t, nil
+}
+
+// nodeMetadataFromSecret reads the node metadata from the annotations of a bootstrap token secret
+func nodeMetadataFromSecret(secret v1.Secret) NodeMetadata {
+	var n NodeMetadata
+	if labels := secret.Annotations[NodeLabelsAnnotation]; labels != "" {
+		n.Labels = strings.Split(labels, ",")
+	}
+	if taints := secret.Annotations[NodeTaintsAnnotation]; taints != "" {
+		n.Taints = strings.Split(taints, ",")
+	}
+	return n
+}
+
+// NodeMetadataFromKubeconfig reads the node metadata embedded in a join token kubeconfig
+func NodeMetadataFromKubeconfig(kubeconfig []byte) (NodeMetadata, error) {
+	var cfg struct {
+		Contexts []struct {
+			Context struct {
+				Extensions []struct {
+					Name      string       `yaml:"name"`
+					Extension NodeMetadata `yaml:"extension"`
+				} `yaml:"extensions"`
+			} `yaml:"context"`
+		} `yaml:"contexts"`
+	}
+	if err := yaml.Unmarshal(kubeconfig, &cfg); err != nil {
+		return NodeMetadata{}, err
+	}
+	for _, c := range cfg.Contexts {
+		for _, e := range c.Context.Extensions {
+			if e.Name == NodeMetadataExtension {
+				return e.Extension, e.Extension.Validate()
+			}
+		}
+	}
+	return NodeMetadata{}, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseLabel(t *testing.T) {
+	key, value, err := ParseLabel("k0sproject.io/pool=edge")
+	require.NoError(t, err)
+	assert.Equal(t, "k0sproject.io/pool", key)
+	assert.Equal(t, "edge", value)
+
+	key, value, err = ParseLabel("empty=")
+	require.NoError(t, err)
+	assert.Equal(t, "empty", key)
+	assert.Equal(t, "", value)
+
+	for _, invalid := range []string{"novalue", "=edge", "pool=edge site", "-pool=edge"} {
+		_, _, err := ParseLabel(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseTaint(t *testing.T) {
+	taint, err := ParseTaint("dedicated=edge:NoSchedule")
+	require.NoError(t, err)
+	assert.Equal(t, v1.Taint{Key: "dedicated", Value: "edge", Effect: v1.TaintEffectNoSchedule}, taint)
+
+	taint, err = ParseTaint("k0sproject.io/edge:NoExecute")
+	require.NoError(t, err)
+	assert.Equal(t, v1.Taint{Key: "k0sproject.io/edge", Effect: v1.TaintEffectNoExecute}, taint)
+
+	for _, invalid := range []string{"dedicated=edge", "dedicated=edge:Sometimes", ":NoSchedule", "dedicated=edge site:NoSchedule"} {
+		_, err := ParseTaint(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNodeMetadataFromSecret(t *testing.T) {
+	secret := v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				NodeLabelsAnnotation: "pool=edge,site=42",
+				NodeTaintsAnnotation: "dedicated=edge:NoSchedule",
+			},
+		},
+	}
+	assert.Equal(t, NodeMetadata{Labels: []string{"pool=edge", "site=42"}, Taints: []string{"dedicated=edge:NoSchedule"}}, FromSecret(secret).Node)
+	assert.True(t, FromSecret(v1.Secret{}).Node.IsEmpty())
+}
+
+func TestNodeMetadataFromKubeconfig(t *testing.T) {
+	kubeconfig := `
+apiVersion: v1
+clusters:
+- cluster:
+    server: https://10.0.0.1:6443
+  name: k0s
+contexts:
+- context:
+    cluster: k0s
+    user: kubelet-bootstrap
+    extensions:
+    - name: k0s.k0sproject.io/node
+      extension:
+        labels:
+        - pool=edge
+        taints:
+        - dedicated=edge:NoSchedule
+  name: k0s
+current-context: k0s
+kind: Config
+`
+	node, err := NodeMetadataFromKubeconfig([]byte(kubeconfig))
+	require.NoError(t, err)
+	assert.Equal(t, NodeMetadata{Labels: []string{"pool=edge"}, Taints: []string{"dedicated=edge:NoSchedule"}}, node)
+
+	node, err = NodeMetadataFromKubeconfig([]byte("apiVersion: v1\nkind: Config\n"))
+	require.NoError(t, err)
+	assert.True(t, node.IsEmpty())
+}
+
+func TestIsKubeletLabel(t *testing.T) {
+	for _, key := range []string{"pool", "k0sproject.io/pool", "kubernetes.io/os", "node.kubernetes.io/pool", "edge.kubelet.kubernetes.io/site"} {
+		assert.True(t, IsKubeletLabel(key), key)
+	}
+	for _, key := range []string{"node-role.kubernetes.io/worker", "kubernetes.io/role", "node-restriction.kubernetes.io/edge", "k8s.io/pool"} {
+		assert.False(t, IsKubeletLabel(key), key)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// InstanceMetadata are the fields of the instance metadata the provider ID templates can use
+type InstanceMetadata struct {
+	InstanceID string
+	// Name is the name of the instance, GCP and Azure use it in the provider IDs
+	Name     string
+	Hostname string
+	Zone     string
+	Region   string
+	// ProjectID is the GCP project of the instance
+	ProjectID string
+	// SubscriptionID and ResourceGroup are the Azure subscription and resource group of the instance
+	SubscriptionID string
+	ResourceGroup  string
+}
+
+// providerIDSchemes maps the schemes of the provider IDs to the metadata services
+var providerIDSchemes = map[string]string{
+	"aws":       "aws",
+	"azure":     "azure",
+	"gce":       "gcp",
+	"openstack": "openstack",
+}
+
+// RenderProviderID renders the provider ID template with the metadata of the instance, e.g.
+// aws:///{{.Zone}}/{{.InstanceID}}. The metadata service is picked by the scheme of the template.
+func RenderProviderID(ctx context.Context, providerIDTemplate string) (string, error) {
+	tmpl, provider, err := parseProviderIDTemplate(providerIDTemplate)
+	if err != nil {
+		return "", err
+	}
+	metadata, err := FetchInstanceMetadata(ctx, provider)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s instance metadata: %v", provider, err)
+	}
+	return renderProviderID(tmpl, metadata)
+}
+
+// ValidateProviderIDTemplate checks the template without reading the instance metadata
+func ValidateProviderIDTemplate(providerIDTemplate string) error {
+	_, _, err := parseProviderIDTemplate(providerIDTemplate)
+	return err
+}
+
+func parseProviderIDTemplate(providerIDTemplate string) (*template.Template, string, error) {
+	i := strings.Index(providerIDTemplate, "://")
+	if i < 0 {
+		return nil, "", fmt.Errorf("invalid provider ID template %q, must be like aws:///{{.Zone}}/{{.InstanceID}}", providerIDTemplate)
+	}
+	provider, ok := providerIDSchemes[providerIDTemplate[:i]]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported provider ID scheme %q, must be one of aws, azure, gce, openstack", providerIDTemplate[:i])
+	}
+	tmpl, err := template.New("providerID").Option("missingkey=error").Parse(providerIDTemplate)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid provider ID template: %v", err)
+	}
+	return tmpl, provider, nil
+}
+
+func renderProviderID(tmpl *template.Template, metadata *InstanceMetadata) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, metadata); err != nil {
+		return "", fmt.Errorf("invalid provider ID template: %v", err)
+	}
+	providerID := b.String()
+	// the host part may be empty as in aws:///, but an empty field would make the cloud controller manager look up
+	// a different or no instance
+	path := strings.TrimPrefix(providerID[strings.Index(providerID, "://")+3:], "/")
+	if path == "" || strings.HasPrefix(path, "/") || strings.Contains(path, "//") || strings.HasSuffix(path, "/") {
+		return "", fmt.Errorf("provider ID %q has empty fields, the instance metadata is missing some of the template fields", providerID)
+	}
+	return providerID, nil
+}
+
+// FetchInstanceMetadata reads the metadata of the instance from the metadata service of the cloud provider
+func FetchInstanceMetadata(ctx context.Context, provider string) (*InstanceMetadata, error) {
+	switch provider {
+	case "aws":
+		headers, err := awsMetadataHeaders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		get := func(path string) (string, error) {
+			data, err := metadataGet(ctx, awsMetadataURL+"/latest/meta-data/"+path, headers)
+			return strings.TrimSpace(string(data)), err
+		}
+		m := &InstanceMetadata{}
+		for path, field := range map[string]*string{
+			"instance-id":                 &m.InstanceID,
+			"local-hostname":              &m.Hostname,
+			"placement/availability-zone": &m.Zone,
+			"placement/region":            &m.Region,
+		} {
+			if *field, err = get(path); err != nil {
+				return nil, err
+			}
+		}
+		m.Name = m.InstanceID
+		return m, nil
+	case "azure":
+		data, err := metadataGet(ctx, azureMetadataURL+"/metadata/instance/compute?api-version=2021-01-01&format=json", map[string]string{"Metadata": "true"})
+		if err != nil {
+			return nil, err
+		}
+		var compute struct {
+			VMID              string `json:"vmId"`
+			Name              string `json:"name"`
+			Location          string `json:"location"`
+			Zone              string `json:"zone"`
+			SubscriptionID    string `json:"subscriptionId"`
+			ResourceGroupName string `json:"resourceGroupName"`
+			OSProfile         struct {
+				ComputerName string `json:"computerName"`
+			} `json:"osProfile"`
+		}
+		if err := json.Unmarshal(data, &compute); err != nil {
+			return nil, err
+		}
+		return &InstanceMetadata{
+			InstanceID:     compute.VMID,
+			Name:           compute.Name,
+			Hostname:       compute.OSProfile.ComputerName,
+			Zone:           compute.Zone,
+			Region:         compute.Location,
+			SubscriptionID: compute.SubscriptionID,
+			ResourceGroup:  compute.ResourceGroupName,
+		}, nil
+	case "gcp":
+		headers := map[string]string{"Metadata-Flavor": "Google"}
+		get := func(path string) (string, error) {
+			data, err := metadataGet(ctx, gcpMetadataURL+"/computeMetadata/v1/"+path, headers)
+			return strings.TrimSpace(string(data)), err
+		}
+		m := &InstanceMetadata{}
+		var zone string
+		var err error
+		for path, field := range map[string]*string{
+			"instance/id":        &m.InstanceID,
+			"instance/name":      &m.Name,
+			"instance/hostname":  &m.Hostname,
+			"instance/zone":      &zone,
+			"project/project-id": &m.ProjectID,
+		} {
+			if *field, err = get(path); err != nil {
+				return nil, err
+			}
+		}
+		// the zone is given as projects/<number>/zones/<zone>, the region is the zone without the last part
+		m.Zone = zone[strings.LastIndex(zone, "/")+1:]
+		if i := strings.LastIndex(m.Zone, "-"); i > 0 {
+			m.Region = m.Zone[:i]
+		}
+		return m, nil
+	case "openstack":
+		data, err := metadataGet(ctx, openstackMetadataURL+"/openstack/latest/meta_data.json", nil)
+		if err != nil {
+			return nil, err
+		}
+		var metadata struct {
+			UUID             string `json:"uuid"`
+			Name             string `json:"name"`
+			Hostname         string `json:"hostname"`
+			AvailabilityZone string `json:"availability_zone"`
+		}
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return nil, err
+		}
+		return &InstanceMetadata{
+			InstanceID: metadata.UUID,
+			Name:       metadata.Name,
+			Hostname:   metadata.Hostname,
+			Zone:       metadata.AvailabilityZone,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported cloud provider %q, must be one of %s", provider, strings.Join(CloudProviders, ", "))
+	}
+}
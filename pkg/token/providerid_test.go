@@ -0,0 +1,99 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderProviderID(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("session"))
+	})
+	awsMetadata := map[string]string{
+		"instance-id":                 "i-0123456789",
+		"local-hostname":              "ip-10-0-0-1.eu-west-1.compute.internal",
+		"placement/availability-zone": "eu-west-1a",
+		"placement/region":            "eu-west-1",
+	}
+	for path, value := range awsMetadata {
+		value := value
+		mux.HandleFunc("/latest/meta-data/"+path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-aws-ec2-metadata-token") != "session" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(value))
+		})
+	}
+	gcpMetadata := map[string]string{
+		"instance/id":        "1234567890",
+		"instance/name":      "worker-1",
+		"instance/hostname":  "worker-1.c.edge.internal",
+		"instance/zone":      "projects/123/zones/europe-north1-a",
+		"project/project-id": "edge",
+	}
+	for path, value := range gcpMetadata {
+		value := value
+		mux.HandleFunc("/computeMetadata/v1/"+path, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(value + "\n"))
+		})
+	}
+	mux.HandleFunc("/metadata/instance/compute", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"vmId":"0000-1111","name":"worker-1","location":"westeurope","zone":"1","subscriptionId":"sub","resourceGroupName":"edge","osProfile":{"computerName":"worker-1"}}`))
+	})
+	mux.HandleFunc("/openstack/latest/meta_data.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"uuid":"83679162-1378-4288-a2d4-70e13ec132aa","name":"worker-1","hostname":"worker-1.novalocal","availability_zone":"nova"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	awsMetadataURL = server.URL
+	azureMetadataURL = server.URL
+	gcpMetadataURL = server.URL
+	openstackMetadataURL = server.URL
+
+	tests := map[string]string{
+		"aws:///{{.Zone}}/{{.InstanceID}}":         "aws:///eu-west-1a/i-0123456789",
+		"gce://{{.ProjectID}}/{{.Zone}}/{{.Name}}": "gce://edge/europe-north1-a/worker-1",
+		"openstack:///{{.InstanceID}}":             "openstack:///83679162-1378-4288-a2d4-70e13ec132aa",
+		"azure:///subscriptions/{{.SubscriptionID}}/resourceGroups/{{.ResourceGroup}}/providers/Microsoft.Compute/virtualMachines/{{.Name}}": "azure:///subscriptions/sub/resourceGroups/edge/providers/Microsoft.Compute/virtualMachines/worker-1",
+	}
+	for tmpl, expected := range tests {
+		providerID, err := RenderProviderID(context.TODO(), tmpl)
+		require.NoError(t, err, tmpl)
+		assert.Equal(t, expected, providerID)
+	}
+
+	for _, invalid := range []string{
+		"i-0123456789",
+		"ibm:///{{.InstanceID}}",
+		"aws:///{{.Zone}/{{.InstanceID}}",
+		"aws:///{{.Rack}}/{{.InstanceID}}",
+		// openstack has no region
+		"openstack:///{{.Region}}/{{.InstanceID}}",
+	} {
+		_, err := RenderProviderID(context.TODO(), invalid)
+		assert.Error(t, err, invalid)
+	}
+}
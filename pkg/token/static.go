@@ -0,0 +1,170 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/k0sproject/k0s/internal/retry"
+)
+
+const (
+	// StaticTokenAnnotation marks the bootstrap secrets provisioned from a static token file
+	StaticTokenAnnotation = "k0s.k0sproject.io/static"
+	// revokedStaticTokensConfigMap records the static tokens invalidated with k0s token invalidate, so they are not provisioned again
+	revokedStaticTokensConfigMap = "k0s-revoked-static-tokens"
+)
+
+// bootstrapTokenRegexp is the format of kubernetes bootstrap tokens
+var bootstrapTokenRegexp = regexp.MustCompile(`^([a-z0-9]{6})\.([a-z0-9]{16})$`)
+
+// StaticToken is a pre-shared join token given to the controllers in a file
+type StaticToken struct {
+	// Token is the bootstrap token in the form of [a-z0-9]{6}.[a-z0-9]{16}
+	Token string `yaml:"token"`
+	// Role is either worker or controller
+	Role string `yaml:"role"`
+	// Expiry is the RFC3339 time after which the token is no longer valid, empty for no expiry
+	Expiry string `yaml:"expiry,omitempty"`
+}
+
+// StaticTokenFile is the format of the static token file
+type StaticTokenFile struct {
+	Tokens []StaticToken `yaml:"tokens"`
+}
+
+// LoadStaticTokens reads and validates the static token file in the given path
+func LoadStaticTokens(path string) ([]StaticToken, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f StaticTokenFile
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse static token file %s: %v", path, err)
+	}
+	ids := make(map[string]bool)
+	for _, t := range f.Tokens {
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid token in static token file %s: %v", path, err)
+		}
+		if ids[t.ID()] {
+			return nil, fmt.Errorf("duplicate token id %s in static token file %s", t.ID(), path)
+		}
+		ids[t.ID()] = true
+	}
+	return f.Tokens, nil
+}
+
+// Validate checks the format of the token, the role and the expiry
+func (t StaticToken) Validate() error {
+	if !bootstrapTokenRegexp.MatchString(t.Token) {
+		return fmt.Errorf("token must be in the form of [a-z0-9]{6}.[a-z0-9]{16}")
+	}
+	if t.Role != "worker" && t.Role != "controller" {
+		return fmt.Errorf("invalid role %q for token %s, must be either worker or controller", t.Role, t.ID())
+	}
+	if t.Expiry != "" {
+		if _, err := time.Parse(time.RFC3339, t.Expiry); err != nil {
+			return fmt.Errorf("invalid expiry %q for token %s: %v", t.Expiry, t.ID(), err)
+		}
+	}
+	return nil
+}
+
+// ID returns the public part of the token
+func (t StaticToken) ID() string {
+	if m := bootstrapTokenRegexp.FindStringSubmatch(t.Token); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// IsExpired tells if the token has passed its expiry
+func (t StaticToken) IsExpired(now time.Time) bool {
+	if t.Expiry == "" {
+		return false
+	}
+	expiry, err := time.Parse(time.RFC3339, t.Expiry)
+	return err != nil || now.After(expiry)
+}
+
+// EnsureStatic makes sure the bootstrap secret of the given static token exists. Expired tokens and tokens
+// invalidated with k0s token invalidate are not provisioned again. An existing secret is left as is.
+func (m *Manager) EnsureStatic(ctx context.Context, t StaticToken) error {
+	if t.IsExpired(time.Now()) {
+		return nil
+	}
+	revoked, err := m.client.CoreV1().ConfigMaps("kube-system").Get(ctx, revokedStaticTokensConfigMap, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return err
+	default:
+		if _, ok := revoked.Data[t.ID()]; ok {
+			return nil
+		}
+	}
+
+	parts := bootstrapTokenRegexp.FindStringSubmatch(t.Token)
+	secret := newTokenSecret(parts[1], parts[2], t.Role, t.Expiry)
+	secret.Annotations[StaticTokenAnnotation] = "true"
+	secret.StringData["description"] = fmt.Sprintf("Static %s bootstrap token provisioned by k0s", t.Role)
+
+	_, err = m.client.CoreV1().Secrets("kube-system").Create(ctx, secret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// revokeStatic records the static token as invalidated, so the controllers do not provision it again
+func (m *Manager) revokeStatic(tokenID string) error {
+	configMaps := m.client.CoreV1().ConfigMaps("kube-system")
+	return retry.Do(context.TODO(), "revoke static token", func() error {
+		cm, err := configMaps.Get(context.TODO(), revokedStaticTokensConfigMap, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = configMaps.Create(context.TODO(), &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      revokedStaticTokensConfigMap,
+					Namespace: "kube-system",
+				},
+				Data: map[string]string{tokenID: time.Now().UTC().Format(time.RFC3339)},
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[tokenID] = time.Now().UTC().Format(time.RFC3339)
+		_, err = configMaps.Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	}, retry.If(func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}))
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadStaticTokens(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static-tokens")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "tokens.yaml")
+
+	write := func(content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+
+	write(`tokens:
+- token: abcdef.0123456789abcdef
+  role: worker
+  expiry: "2030-01-01T00:00:00Z"
+- token: ctrl01.0123456789abcdef
+  role: controller
+`)
+	tokens, err := LoadStaticTokens(path)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "abcdef", tokens[0].ID())
+	assert.Equal(t, "controller", tokens[1].Role)
+
+	write(`tokens:
+- token: ABCDEF.0123456789abcdef
+  role: worker
+`)
+	_, err = LoadStaticTokens(path)
+	assert.Error(t, err)
+
+	write(`tokens:
+- token: abcdef.0123456789abcdef
+  role: admin
+`)
+	_, err = LoadStaticTokens(path)
+	assert.Error(t, err)
+
+	write(`tokens:
+- token: abcdef.0123456789abcdef
+  role: worker
+- token: abcdef.fedcba9876543210
+  role: worker
+`)
+	_, err = LoadStaticTokens(path)
+	assert.Error(t, err)
+}
+
+func TestEnsureStatic(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	m := NewManagerForClient(client)
+	secrets := client.CoreV1().Secrets("kube-system")
+	ctx := context.TODO()
+
+	static := StaticToken{Token: "abcdef.0123456789abcdef", Role: "worker"}
+	require.NoError(t, m.EnsureStatic(ctx, static))
+	secret, err := secrets.Get(ctx, "bootstrap-token-abcdef", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "true", secret.Annotations[StaticTokenAnnotation])
+	assert.Equal(t, "0123456789abcdef", secret.StringData["token-secret"])
+	assert.Equal(t, "true", secret.StringData["usage-bootstrap-authentication"])
+
+	// provisioning is idempotent
+	require.NoError(t, m.EnsureStatic(ctx, static))
+
+	// invalidated static tokens are not provisioned again
+	require.NoError(t, m.Remove("abcdef"))
+	require.NoError(t, m.EnsureStatic(ctx, static))
+	_, err = secrets.Get(ctx, "bootstrap-token-abcdef", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "revoked static token should not be provisioned")
+
+	expired := StaticToken{Token: "expird.0123456789abcdef", Role: "worker", Expiry: "2020-01-01T00:00:00Z"}
+	require.NoError(t, m.EnsureStatic(ctx, expired))
+	_, err = secrets.Get(ctx, "bootstrap-token-expird", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "expired static token should not be provisioned")
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/k0sproject/k0s/internal/retry"
+)
+
+const (
+	// MaxUsesAnnotation holds the number of joins a token can be used for
+	MaxUsesAnnotation = "k0s.k0sproject.io/max-uses"
+	// UsesAnnotation holds the number of joins a token has been used for so far
+	UsesAnnotation = "k0s.k0sproject.io/uses"
+)
+
+// NewManagerForClient creates a new token manager using the given kube client
+func NewManagerForClient(client kubernetes.Interface) *Manager {
+	return &Manager{client: client}
+}
+
+// RecordUse counts a successful join made with the token. A token limited to a number of uses is invalidated,
+// i.e. its bootstrap secret is deleted, once it has been used up. A NotFound error is returned if the token
+// does not exist (anymore), so a join racing with the last use can be rejected.
+func (m *Manager) RecordUse(tokenID string) error {
+	return retry.Do(context.TODO(), "record join token use", func() error {
+		secrets := m.client.CoreV1().Secrets("kube-system")
+		secret, err := secrets.Get(context.TODO(), "bootstrap-token-"+tokenID, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		t := FromSecret(*secret)
+		if t.MaxUses == 0 {
+			return nil
+		}
+
+		uses := t.Uses + 1
+		if uses >= t.MaxUses {
+			return secrets.Delete(context.TODO(), secret.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{ResourceVersion: &secret.ResourceVersion},
+			})
+		}
+
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[UsesAnnotation] = strconv.Itoa(uses)
+		_, err = secrets.Update(context.TODO(), secret, metav1.UpdateOptions{})
+		return err
+	}, retry.If(errors.IsConflict))
+}
+
+// usesFromSecret returns the maximum and the current number of uses of the token, zero maximum meaning unlimited
+func usesFromSecret(secret v1.Secret) (int, int) {
+	maxUses, err := strconv.Atoi(secret.Annotations[MaxUsesAnnotation])
+	if err != nil || maxUses < 0 {
+		return 0, 0
+	}
+	uses, err := strconv.Atoi(secret.Annotations[UsesAnnotation])
+	if err != nil || uses < 0 {
+		uses = 0
+	}
+	return maxUses, uses
+}
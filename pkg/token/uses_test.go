@@ -0,0 +1,74 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func tokenSecret(id string, annotations map[string]string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "bootstrap-token-" + id,
+			Namespace:   "kube-system",
+			Annotations: annotations,
+		},
+		Data: map[string][]byte{"token-id": []byte(id)},
+	}
+}
+
+func TestRecordUse(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		tokenSecret("twice", map[string]string{MaxUsesAnnotation: "2"}),
+		tokenSecret("unlimited", nil),
+	)
+	m := NewManagerForClient(client)
+	secrets := client.CoreV1().Secrets("kube-system")
+
+	require.NoError(t, m.RecordUse("twice"))
+	secret, err := secrets.Get(context.TODO(), "bootstrap-token-twice", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, FromSecret(*secret).Uses)
+	assert.Equal(t, 2, FromSecret(*secret).MaxUses)
+
+	require.NoError(t, m.RecordUse("twice"))
+	_, err = secrets.Get(context.TODO(), "bootstrap-token-twice", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err), "used up token should be deleted")
+	assert.True(t, errors.IsNotFound(m.RecordUse("twice")))
+
+	require.NoError(t, m.RecordUse("unlimited"))
+	secret, err = secrets.Get(context.TODO(), "bootstrap-token-unlimited", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, secret.Annotations[UsesAnnotation])
+}
+
+func TestUsesFromSecret(t *testing.T) {
+	maxUses, uses := usesFromSecret(*tokenSecret("abc", map[string]string{MaxUsesAnnotation: "3", UsesAnnotation: "1"}))
+	assert.Equal(t, 3, maxUses)
+	assert.Equal(t, 1, uses)
+
+	maxUses, uses = usesFromSecret(*tokenSecret("abc", map[string]string{MaxUsesAnnotation: "many"}))
+	assert.Equal(t, 0, maxUses)
+	assert.Equal(t, 0, uses)
+}
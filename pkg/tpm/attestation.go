@@ -0,0 +1,95 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+)
+
+// AttestationSignerName is the signer name of the attestation requests. No signer issues certificates for them,
+// the requests only carry the proof of possession of the TPM key to the k0s CSR approver.
+const AttestationSignerName = "k0sproject.io/tpm-attestation"
+
+const kubeletKeyURIPrefix = "urn:k0s:kubelet-client-key:sha256:"
+
+// Fingerprint returns the SHA-256 fingerprint of the DER encoded public key, the form the TPM keys are enrolled with
+func Fingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func kubeletKeyURI(kubeletKey crypto.PublicKey) (*url.URL, error) {
+	der, err := x509.MarshalPKIXPublicKey(kubeletKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return url.Parse(kubeletKeyURIPrefix + hex.EncodeToString(sum[:]))
+}
+
+// CreateAttestationRequest creates a PEM encoded certificate request signed with the TPM key. The request binds
+// the TPM key to the kubelet client key of the node by carrying the hash of the kubelet key as an URI SAN.
+func CreateAttestationRequest(key crypto.Signer, nodeName string, kubeletKey crypto.PublicKey) ([]byte, error) {
+	uri, err := kubeletKeyURI(kubeletKey)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   "system:node:" + nodeName,
+			Organization: []string{"system:nodes"},
+		},
+		URIs:               []*url.URL{uri},
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+	if _, ok := key.Public().(*ecdsa.PublicKey); ok {
+		template.SignatureAlgorithm = x509.ECDSAWithSHA256
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create attestation request: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// VerifyAttestation checks that the attestation request is signed with its key and binds the given kubelet
+// client key, and returns the fingerprint of the attested TPM key
+func VerifyAttestation(attestation *x509.CertificateRequest, kubeletKey crypto.PublicKey) (string, error) {
+	if err := attestation.CheckSignature(); err != nil {
+		return "", fmt.Errorf("invalid attestation signature: %v", err)
+	}
+	uri, err := kubeletKeyURI(kubeletKey)
+	if err != nil {
+		return "", err
+	}
+	if len(attestation.URIs) != 1 || attestation.URIs[0].String() != uri.String() {
+		return "", fmt.Errorf("attestation is not for the kubelet client key")
+	}
+	return Fingerprint(attestation.PublicKey)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tpm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseRequest(t *testing.T, data []byte) *x509.CertificateRequest {
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	return req
+}
+
+func TestAttestation(t *testing.T) {
+	// software keys stand in for the TPM key, the requests are the same
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kubeletKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("ecdsa", func(t *testing.T) {
+		data, err := CreateAttestationRequest(ecKey, "worker-1", kubeletKey.Public())
+		require.NoError(t, err)
+		req := parseRequest(t, data)
+		assert.Equal(t, "system:node:worker-1", req.Subject.CommonName)
+
+		fingerprint, err := VerifyAttestation(req, kubeletKey.Public())
+		require.NoError(t, err)
+		expected, err := Fingerprint(ecKey.Public())
+		require.NoError(t, err)
+		assert.Equal(t, expected, fingerprint)
+		assert.Len(t, fingerprint, len("sha256:")+64)
+
+		_, err = VerifyAttestation(req, otherKey.Public())
+		assert.Error(t, err, "attestation must be bound to the kubelet key")
+	})
+
+	t.Run("rsa", func(t *testing.T) {
+		data, err := CreateAttestationRequest(rsaKey, "worker-1", kubeletKey.Public())
+		require.NoError(t, err)
+		req := parseRequest(t, data)
+		assert.Equal(t, x509.SHA256WithRSA, req.SignatureAlgorithm)
+		_, err = VerifyAttestation(req, kubeletKey.Public())
+		assert.NoError(t, err)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		data, err := CreateAttestationRequest(ecKey, "worker-1", kubeletKey.Public())
+		require.NoError(t, err)
+		req := parseRequest(t, data)
+		req.PublicKey = otherKey.Public()
+		_, err = VerifyAttestation(req, kubeletKey.Public())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 k0s authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/k0sproject/k0s/internal/util"
+)
+
+// DefaultKeyHandle is the persistent handle the attestation key is looked up from by default
+const DefaultKeyHandle = "0x81010002"
+
+// Key is a signing key that never leaves the TPM. It's used through tpm2-tools, so the key has to be
+// created and persisted beforehand, e.g. with tpm2_createprimary and tpm2_evictcontrol.
+type Key struct {
+	Handle string
+	public crypto.PublicKey
+}
+
+// LoadKey reads the public part of the persistent key at the given handle
+func LoadKey(handle string) (*Key, error) {
+	for _, tool := range []string{"tpm2_readpublic", "tpm2_sign"} {
+		if _, err := util.GetExecPath(tool); err != nil {
+			return nil, fmt.Errorf("%s not found, install tpm2-tools: %v", tool, err)
+		}
+	}
+
+	tmpDir, err := ioutil.TempDir("", "k0s-tpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pubPath := filepath.Join(tmpDir, "key.der")
+	if err := run("tpm2_readpublic", "-c", handle, "-f", "der", "-o", pubPath); err != nil {
+		return nil, fmt.Errorf("failed to read TPM key %s: %v", handle, err)
+	}
+	der, err := ioutil.ReadFile(pubPath)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TPM key %s: %v", handle, err)
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported TPM key type %T", pub)
+	}
+	return &Key{Handle: handle, public: pub}, nil
+}
+
+// Public implements crypto.Signer
+func (k *Key) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign implements crypto.Signer by signing the digest in the TPM. Only SHA-256 digests are supported,
+// signed with ECDSA or RSASSA-PKCS1-v1_5 depending on the key type.
+func (k *Key) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("unsupported hash function %v, only SHA-256 is supported", opts.HashFunc())
+	}
+	scheme := "rsassa"
+	if _, ok := k.public.(*ecdsa.PublicKey); ok {
+		scheme = "ecdsa"
+	}
+
+	tmpDir, err := ioutil.TempDir("", "k0s-tpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	digestPath := filepath.Join(tmpDir, "digest")
+	sigPath := filepath.Join(tmpDir, "signature")
+	if err := ioutil.WriteFile(digestPath, digest, 0600); err != nil {
+		return nil, err
+	}
+	// the plain format is the ASN.1 DER encoding for ECDSA and the raw signature for RSA, the same as crypto.Signer returns
+	if err := run("tpm2_sign", "-c", k.Handle, "-g", "sha256", "-s", scheme, "-d", "-f", "plain", "-o", sigPath, digestPath); err != nil {
+		return nil, fmt.Errorf("failed to sign with TPM key %s: %v", k.Handle, err)
+	}
+	return ioutil.ReadFile(sigPath)
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}